@@ -12,7 +12,11 @@ import (
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/binary"
+	"log/slog"
+	"math"
 	"sort"
+	"sync"
+	"time"
 
 	"github.com/awcullen/opcua/ua"
 	"github.com/djherbis/buffer"
@@ -25,13 +29,17 @@ func Dial(ctx context.Context, endpointURL string, opts ...Option) (c *Client, e
 		userIdentity:      ua.AnonymousIdentity{},
 		applicationName:   "awcullen/opcua",
 		sessionTimeout:    defaultSessionTimeout,
+		localeIDs:         []string{"en"},
 		securityPolicyURI: ua.SecurityPolicyURIBestAvailable,
 		timeoutHint:       defaultTimeoutHint,
 		diagnosticsHint:   defaultDiagnosticsHint,
 		tokenLifetime:     defaultTokenRequestedLifetime,
 		connectTimeout:    defaultConnectTimeout,
+		reconnectInterval: defaultReconnectInterval,
 		trace:             false,
+		logger:            slog.New(ua.DiscardHandler{}),
 	}
+	cli.channelCond = sync.NewCond(&cli.channelLock)
 
 	// apply each option to the default
 	for _, opt := range opts {
@@ -40,6 +48,10 @@ func Dial(ctx context.Context, endpointURL string, opts ...Option) (c *Client, e
 		}
 	}
 
+	if cli.onStale != nil {
+		cli.subscriptionMonitor = newSubscriptionMonitor(cli.onStale, cli.staleFactor)
+	}
+
 	// get endpoints from discovery url
 	req := &ua.GetEndpointsRequest{
 		EndpointURL: endpointURL,
@@ -52,12 +64,17 @@ func Dial(ctx context.Context, endpointURL string, opts ...Option) (c *Client, e
 
 	// order endpoints by decreasing security level.
 	var orderedEndpoints = res.Endpoints
-	sort.Slice(orderedEndpoints, func(i, j int) bool {
+	sort.SliceStable(orderedEndpoints, func(i, j int) bool {
 		return orderedEndpoints[i].SecurityLevel > orderedEndpoints[j].SecurityLevel
 	})
 
-	// if client certificate is not set then limit secuity policy to none
+	// if security policy is required then select only that policy
 	securityPolicyURI := cli.securityPolicyURI
+	if securityPolicyURI == ua.SecurityPolicyURIBestAvailable && cli.requiredSecurityPolicyURI != "" {
+		securityPolicyURI = cli.requiredSecurityPolicyURI
+	}
+
+	// if client certificate is not set then limit secuity policy to none
 	if securityPolicyURI == ua.SecurityPolicyURIBestAvailable && len(cli.localCertificate) == 0 {
 		securityPolicyURI = ua.SecurityPolicyURINone
 	}
@@ -73,6 +90,10 @@ func Dial(ctx context.Context, endpointURL string, opts ...Option) (c *Client, e
 		default:
 			continue
 		}
+		// filter out policy uri not matching the required policy uri
+		if cli.requiredSecurityPolicyURI != "" && e.SecurityPolicyURI != cli.requiredSecurityPolicyURI {
+			continue
+		}
 		// if policy uri is empty string, select the first endpoint
 		if securityPolicyURI == "" {
 			selectedEndpoint = &e
@@ -85,6 +106,9 @@ func Dial(ctx context.Context, endpointURL string, opts ...Option) (c *Client, e
 		}
 	}
 	if selectedEndpoint == nil {
+		if cli.requiredSecurityPolicyURI != "" {
+			return nil, ua.BadSecurityPolicyRejected
+		}
 		return nil, ua.BadUnexpectedError
 	}
 	// HACK: the UA server (usually) doesn't know what it's talking about
@@ -95,7 +119,9 @@ func Dial(ctx context.Context, endpointURL string, opts ...Option) (c *Client, e
 	cli.securityPolicyURI = selectedEndpoint.SecurityPolicyURI
 	cli.securityMode = selectedEndpoint.SecurityMode
 	cli.serverCertificate = []byte(selectedEndpoint.ServerCertificate)
+	cli.serverApplicationURI = selectedEndpoint.Server.ApplicationURI
 	cli.userTokenPolicies = selectedEndpoint.UserIdentityTokens
+	cli.discoveryEndpoints = orderedEndpoints
 
 	cli.localDescription = ua.ApplicationDescription{
 		ApplicationName: ua.LocalizedText{Text: cli.applicationName},
@@ -110,23 +136,7 @@ func Dial(ctx context.Context, endpointURL string, opts ...Option) (c *Client, e
 		}
 	}
 
-	cli.channel = newClientSecureChannel(
-		cli.localDescription,
-		cli.localCertificate,
-		cli.localPrivateKey,
-		cli.endpointURL,
-		cli.securityPolicyURI,
-		cli.securityMode,
-		cli.serverCertificate,
-		cli.connectTimeout,
-		cli.trustedCertsFile,
-		cli.suppressHostNameInvalid,
-		cli.suppressCertificateExpired,
-		cli.suppressCertificateChainIncomplete,
-		cli.timeoutHint,
-		cli.diagnosticsHint,
-		cli.tokenLifetime,
-		cli.trace)
+	cli.channel = cli.newSecureChannel()
 
 	// open session and read the namespace table
 	if err := cli.open(ctx); err != nil {
@@ -134,6 +144,11 @@ func Dial(ctx context.Context, endpointURL string, opts ...Option) (c *Client, e
 		return nil, err
 	}
 
+	if cli.autoReconnect {
+		cli.done = make(chan struct{})
+		go cli.watchChannel(cli.channel)
+	}
+
 	return cli, nil
 }
 
@@ -144,14 +159,18 @@ type Client struct {
 	localDescription                   ua.ApplicationDescription
 	endpointURL                        string
 	securityPolicyURI                  string
+	requiredSecurityPolicyURI          string
 	securityMode                       ua.MessageSecurityMode
 	serverCertificate                  []byte
+	serverApplicationURI               string
 	userTokenPolicies                  []ua.UserTokenPolicy
+	discoveryEndpoints                 []ua.EndpointDescription
 	userIdentity                       interface{}
 	sessionID                          ua.NodeID
 	sessionName                        string
 	applicationName                    string
 	sessionTimeout                     float64
+	localeIDs                          []string
 	clientSignature                    ua.SignatureData
 	identityToken                      interface{}
 	identityTokenSignature             ua.SignatureData
@@ -164,8 +183,29 @@ type Client struct {
 	suppressHostNameInvalid            bool
 	suppressCertificateExpired         bool
 	suppressCertificateChainIncomplete bool
+	certificateValidator               *ua.CertificateValidator
 	connectTimeout                     int64
 	trace                              bool
+	logger                             *slog.Logger
+	onStale                            StaleFunc
+	staleFactor                        float64
+	subscriptionMonitor                *subscriptionMonitor
+	subscriptionsLock                  sync.Mutex
+	subscriptions                      map[uint32]*Subscription
+	republishedAcks                    []ua.SubscriptionAcknowledgement
+	publishing                         bool
+	autoReconnect                      bool
+	onReconnect                        ReconnectFunc
+	reconnectInterval                  int64
+	channelLock                        sync.Mutex
+	channelCond                        *sync.Cond
+	reconnecting                       bool
+	closing                            bool
+	done                               chan struct{}
+	serverNonce                        []byte
+	transferPending                    bool
+	registeredNodesLock                sync.RWMutex
+	registeredNodes                    map[ua.NodeID]ua.NodeID
 }
 
 // EndpointURL gets the EndpointURL of the server.
@@ -185,23 +225,67 @@ func (ch *Client) SecurityMode() ua.MessageSecurityMode {
 
 // SessionID gets the id of the current session.
 func (ch *Client) SessionID() ua.NodeID {
+	ch.channelLock.Lock()
+	defer ch.channelLock.Unlock()
 	return ch.sessionID
 }
 
+// newSecureChannel initializes a secure channel to the selected endpoint.
+func (ch *Client) newSecureChannel() *clientSecureChannel {
+	return newClientSecureChannel(
+		ch.localDescription,
+		ch.localCertificate,
+		ch.localPrivateKey,
+		ch.endpointURL,
+		ch.securityPolicyURI,
+		ch.securityMode,
+		ch.serverCertificate,
+		ch.serverApplicationURI,
+		ch.connectTimeout,
+		ch.trustedCertsFile,
+		ch.suppressHostNameInvalid,
+		ch.suppressCertificateExpired,
+		ch.suppressCertificateChainIncomplete,
+		ch.certificateValidator,
+		ch.timeoutHint,
+		ch.diagnosticsHint,
+		ch.tokenLifetime,
+		ch.trace,
+		ch.logger)
+}
+
 // Request sends a service request to the server and returns the response.
 func (ch *Client) request(ctx context.Context, req ua.ServiceRequest) (ua.ServiceResponse, error) {
-	return ch.channel.Request(ctx, req)
+	res, err := ch.secureChannel().Request(ctx, req)
+	if err != nil {
+		level := slog.LevelWarn
+		switch err {
+		case ua.BadTimeout, ua.BadRequestTimeout, ua.BadNoSubscription, ua.BadTooManyPublishRequests:
+			// expected in the normal course of publishing.
+			level = slog.LevelDebug
+		}
+		ch.logger.Log(ctx, level, "Service fault", ua.ServiceAttr(req), ua.StatusCodeAttr(err))
+	}
+	if err == nil && ch.subscriptionMonitor != nil {
+		ch.subscriptionMonitor.update(req, res)
+	}
+	return res, err
 }
 
 // Open opens a secure channel to the server and creates a session.
 func (ch *Client) open(ctx context.Context) error {
-	if err := ch.channel.Open(ctx); err != nil {
+	if err := ch.secureChannel().Open(ctx); err != nil {
 		return err
 	}
+	return ch.openSession(ctx)
+}
 
+// openSession creates and activates a session on the secure channel, and reads the namespace table.
+func (ch *Client) openSession(ctx context.Context) error {
+	channel := ch.secureChannel()
 	var localNonce, localCertificate, remoteNonce []byte
 	localNonce = getNextNonce(nonceLength)
-	localCertificate = ch.channel.localCertificate
+	localCertificate = channel.localCertificate
 
 	var createSessionRequest = &ua.CreateSessionRequest{
 		ClientDescription:       ch.localDescription,
@@ -217,8 +301,11 @@ func (ch *Client) open(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	ch.channelLock.Lock()
 	ch.sessionID = createSessionResponse.SessionID
-	ch.channel.SetAuthenticationToken(createSessionResponse.AuthenticationToken)
+	ch.channelLock.Unlock()
+	channel.SetAuthenticationToken(createSessionResponse.AuthenticationToken)
+	ch.logger.Info("Created session", ua.SessionIDAttr(createSessionResponse.SessionID), ua.ChannelIDAttr(channel.channelID))
 	remoteNonce = []byte(createSessionResponse.ServerNonce)
 
 	// verify the server's certificate is the same as the certificate from the selected endpoint.
@@ -226,6 +313,11 @@ func (ch *Client) open(ctx context.Context) error {
 		return ua.BadCertificateInvalid
 	}
 
+	// verify the server's endpoints include every endpoint returned by discovery.
+	if !containsEndpoints(createSessionResponse.ServerEndpoints, ch.discoveryEndpoints) {
+		return ua.BadSecurityChecksFailed
+	}
+
 	// verify the server's signature.
 	switch ch.securityPolicyURI {
 	case ua.SecurityPolicyURIBasic128Rsa15, ua.SecurityPolicyURIBasic256:
@@ -233,7 +325,7 @@ func (ch *Client) open(ctx context.Context) error {
 		hash.Write(localCertificate)
 		hash.Write(localNonce)
 		hashed := hash.Sum(nil)
-		err := rsa.VerifyPKCS1v15(ch.channel.remotePublicKey, crypto.SHA1, hashed, []byte(createSessionResponse.ServerSignature.Signature))
+		err := rsa.VerifyPKCS1v15(channel.remotePublicKey, crypto.SHA1, hashed, []byte(createSessionResponse.ServerSignature.Signature))
 		if err != nil {
 			return ua.BadApplicationSignatureInvalid
 		}
@@ -243,7 +335,7 @@ func (ch *Client) open(ctx context.Context) error {
 		hash.Write(localCertificate)
 		hash.Write(localNonce)
 		hashed := hash.Sum(nil)
-		err := rsa.VerifyPKCS1v15(ch.channel.remotePublicKey, crypto.SHA256, hashed, []byte(createSessionResponse.ServerSignature.Signature))
+		err := rsa.VerifyPKCS1v15(channel.remotePublicKey, crypto.SHA256, hashed, []byte(createSessionResponse.ServerSignature.Signature))
 		if err != nil {
 			return ua.BadApplicationSignatureInvalid
 		}
@@ -253,12 +345,50 @@ func (ch *Client) open(ctx context.Context) error {
 		hash.Write(localCertificate)
 		hash.Write(localNonce)
 		hashed := hash.Sum(nil)
-		err := rsa.VerifyPSS(ch.channel.remotePublicKey, crypto.SHA256, hashed, []byte(createSessionResponse.ServerSignature.Signature), &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		err := rsa.VerifyPSS(channel.remotePublicKey, crypto.SHA256, hashed, []byte(createSessionResponse.ServerSignature.Signature), &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
 		if err != nil {
 			return ua.BadApplicationSignatureInvalid
 		}
 	}
 
+	if err := ch.activate(ctx, remoteNonce); err != nil {
+		return err
+	}
+
+	// fetch namespace array, etc.
+	var readRequest = &ua.ReadRequest{
+		NodesToRead: []ua.ReadValueID{
+			{
+				NodeID:      ua.VariableIDServerNamespaceArray,
+				AttributeID: ua.AttributeIDValue,
+			},
+			{
+				NodeID:      ua.VariableIDServerServerArray,
+				AttributeID: ua.AttributeIDValue,
+			},
+		},
+	}
+	readResponse, err := ch.Read(ctx, readRequest)
+	if err != nil {
+		return err
+	}
+	if len(readResponse.Results) == 2 {
+		if readResponse.Results[0].StatusCode.IsGood() {
+			value := readResponse.Results[0].Value.([]string)
+			channel.SetNamespaceURIs(value)
+		}
+
+		if readResponse.Results[1].StatusCode.IsGood() {
+			value := readResponse.Results[1].Value.([]string)
+			channel.SetServerURIs(value)
+		}
+	}
+	return nil
+}
+
+// activate activates the session on the secure channel, signing the nonce last returned by the server.
+func (ch *Client) activate(ctx context.Context, remoteNonce []byte) error {
+	channel := ch.secureChannel()
 	// create client signature
 	var clientSignature ua.SignatureData
 	switch ch.securityPolicyURI {
@@ -267,7 +397,7 @@ func (ch *Client) open(ctx context.Context) error {
 		hash.Write(ch.serverCertificate)
 		hash.Write(remoteNonce)
 		hashed := hash.Sum(nil)
-		signature, err := rsa.SignPKCS1v15(rand.Reader, ch.channel.localPrivateKey, crypto.SHA1, hashed)
+		signature, err := rsa.SignPKCS1v15(rand.Reader, channel.localPrivateKey, crypto.SHA1, hashed)
 		if err != nil {
 			return err
 		}
@@ -281,7 +411,7 @@ func (ch *Client) open(ctx context.Context) error {
 		hash.Write(ch.serverCertificate)
 		hash.Write(remoteNonce)
 		hashed := hash.Sum(nil)
-		signature, err := rsa.SignPKCS1v15(rand.Reader, ch.channel.localPrivateKey, crypto.SHA256, hashed)
+		signature, err := rsa.SignPKCS1v15(rand.Reader, channel.localPrivateKey, crypto.SHA256, hashed)
 		if err != nil {
 			return err
 		}
@@ -295,7 +425,7 @@ func (ch *Client) open(ctx context.Context) error {
 		hash.Write(ch.serverCertificate)
 		hash.Write(remoteNonce)
 		hashed := hash.Sum(nil)
-		signature, err := rsa.SignPSS(rand.Reader, ch.channel.localPrivateKey, crypto.SHA256, hashed, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		signature, err := rsa.SignPSS(rand.Reader, channel.localPrivateKey, crypto.SHA256, hashed, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
 		if err != nil {
 			return err
 		}
@@ -332,7 +462,7 @@ func (ch *Client) open(ctx context.Context) error {
 
 		switch secPolicyURI {
 		case ua.SecurityPolicyURIBasic128Rsa15:
-			publickey := ch.channel.remotePublicKey
+			publickey := channel.remotePublicKey
 			if publickey == nil {
 				return ua.BadIdentityTokenRejected
 			}
@@ -363,7 +493,7 @@ func (ch *Client) open(ctx context.Context) error {
 			identityTokenSignature = ua.SignatureData{}
 
 		case ua.SecurityPolicyURIBasic256, ua.SecurityPolicyURIBasic256Sha256, ua.SecurityPolicyURIAes128Sha256RsaOaep:
-			publickey := ch.channel.remotePublicKey
+			publickey := channel.remotePublicKey
 			if publickey == nil {
 				return ua.BadIdentityTokenRejected
 			}
@@ -394,7 +524,7 @@ func (ch *Client) open(ctx context.Context) error {
 			identityTokenSignature = ua.SignatureData{}
 
 		case ua.SecurityPolicyURIAes256Sha256RsaPss:
-			publickey := ch.channel.remotePublicKey
+			publickey := channel.remotePublicKey
 			if publickey == nil {
 				return ua.BadIdentityTokenRejected
 			}
@@ -533,7 +663,7 @@ func (ch *Client) open(ctx context.Context) error {
 
 		switch secPolicyURI {
 		case ua.SecurityPolicyURIBasic128Rsa15:
-			publickey := ch.channel.remotePublicKey
+			publickey := channel.remotePublicKey
 			if publickey == nil {
 				return ua.BadIdentityTokenRejected
 			}
@@ -566,7 +696,7 @@ func (ch *Client) open(ctx context.Context) error {
 			identityTokenSignature = ua.SignatureData{}
 
 		case ua.SecurityPolicyURIBasic256, ua.SecurityPolicyURIBasic256Sha256, ua.SecurityPolicyURIAes128Sha256RsaOaep:
-			publickey := ch.channel.remotePublicKey
+			publickey := channel.remotePublicKey
 			if publickey == nil {
 				return ua.BadIdentityTokenRejected
 			}
@@ -599,7 +729,7 @@ func (ch *Client) open(ctx context.Context) error {
 			identityTokenSignature = ua.SignatureData{}
 
 		case ua.SecurityPolicyURIAes256Sha256RsaPss:
-			publickey := ch.channel.remotePublicKey
+			publickey := channel.remotePublicKey
 			if publickey == nil {
 				return ua.BadIdentityTokenRejected
 			}
@@ -664,60 +794,279 @@ func (ch *Client) open(ctx context.Context) error {
 
 	activateSessionRequest := &ua.ActivateSessionRequest{
 		ClientSignature:    ch.clientSignature,
-		LocaleIDs:          []string{"en"},
+		LocaleIDs:          ch.localeIDs,
 		UserIdentityToken:  identityToken,
 		UserTokenSignature: ch.identityTokenSignature,
 	}
-	activateSessionResponse, err := ch.activateSession(ctx, activateSessionRequest)
+	activateSessionResponse, err := ch.ActivateSession(ctx, activateSessionRequest)
 	if err != nil {
 		return err
 	}
-	_ = []byte(activateSessionResponse.ServerNonce)
+	// save the nonce to sign when the session is activated on a new secure channel.
+	ch.channelLock.Lock()
+	ch.serverNonce = []byte(activateSessionResponse.ServerNonce)
+	ch.channelLock.Unlock()
+	ch.logger.Info("Activated session", ua.SessionIDAttr(ch.SessionID()), ua.ChannelIDAttr(channel.channelID))
+	return nil
+}
 
-	// fetch namespace array, etc.
-	var readRequest = &ua.ReadRequest{
-		NodesToRead: []ua.ReadValueID{
-			{
-				NodeID:      ua.VariableIDServerNamespaceArray,
-				AttributeID: ua.AttributeIDValue,
-			},
-			{
-				NodeID:      ua.VariableIDServerServerArray,
-				AttributeID: ua.AttributeIDValue,
-			},
-		},
+// Close closes the session and secure channel.
+func (ch *Client) Close(ctx context.Context) error {
+	ch.stopReconnect()
+	ch.stopSubscriptionMonitor()
+	ch.unregisterAllNodeIDs(ctx)
+	var request = &ua.CloseSessionRequest{
+		DeleteSubscriptions: true,
 	}
-	readResponse, err := ch.Read(ctx, readRequest)
+	_, err := ch.closeSession(ctx, request)
 	if err != nil {
 		return err
 	}
-	if len(readResponse.Results) == 2 {
-		if readResponse.Results[0].StatusCode.IsGood() {
-			value := readResponse.Results[0].Value.([]string)
-			ch.channel.SetNamespaceURIs(value)
-		}
+	ch.logger.Info("Closed session", ua.SessionIDAttr(ch.SessionID()))
+	return ch.secureChannel().Close(ctx)
+}
 
-		if readResponse.Results[1].StatusCode.IsGood() {
-			value := readResponse.Results[1].Value.([]string)
-			ch.channel.SetServerURIs(value)
+// CloseRetainSubscriptions closes the session and secure channel, but retains the subscriptions
+// of the session, so they may be transferred to another session.
+func (ch *Client) CloseRetainSubscriptions(ctx context.Context) error {
+	ch.stopReconnect()
+	ch.stopSubscriptionMonitor()
+	ch.unregisterAllNodeIDs(ctx)
+	var request = &ua.CloseSessionRequest{
+		DeleteSubscriptions: false,
+	}
+	_, err := ch.closeSession(ctx, request)
+	if err != nil {
+		return err
+	}
+	ch.logger.Info("Closed session", ua.SessionIDAttr(ch.SessionID()))
+	return ch.secureChannel().Close(ctx)
+}
+
+// RegisterNodeIDs registers the nodes that will be accessed repeatedly, and returns the NodeIDs
+// assigned by the server. Subsequent calls of Read and Write substitute the registered NodeIDs
+// for the original NodeIDs. If the server returns a NodeID unchanged, the original NodeID is used.
+// The nodes are unregistered by UnregisterNodeIDs or Close.
+func (ch *Client) RegisterNodeIDs(ctx context.Context, nodeIDs []ua.NodeID) ([]ua.NodeID, error) {
+	res, err := ch.RegisterNodes(ctx, &ua.RegisterNodesRequest{
+		NodesToRegister: nodeIDs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(res.RegisteredNodeIDs) != len(nodeIDs) {
+		return nil, ua.BadUnexpectedError
+	}
+	ch.registeredNodesLock.Lock()
+	if ch.registeredNodes == nil {
+		ch.registeredNodes = make(map[ua.NodeID]ua.NodeID, len(nodeIDs))
+	}
+	for i, id := range nodeIDs {
+		ch.registeredNodes[id] = res.RegisteredNodeIDs[i]
+	}
+	ch.registeredNodesLock.Unlock()
+	return res.RegisteredNodeIDs, nil
+}
+
+// UnregisterNodeIDs unregisters nodes that have been registered by RegisterNodeIDs. Subsequent
+// calls of Read and Write use the original NodeIDs.
+func (ch *Client) UnregisterNodeIDs(ctx context.Context, nodeIDs []ua.NodeID) error {
+	ch.registeredNodesLock.Lock()
+	registered := make([]ua.NodeID, 0, len(nodeIDs))
+	for _, id := range nodeIDs {
+		if alias, ok := ch.registeredNodes[id]; ok {
+			registered = append(registered, alias)
+			delete(ch.registeredNodes, id)
 		}
 	}
+	ch.registeredNodesLock.Unlock()
+	if len(registered) == 0 {
+		return nil
+	}
+	_, err := ch.UnregisterNodes(ctx, &ua.UnregisterNodesRequest{
+		NodesToUnregister: registered,
+	})
+	return err
+}
+
+// RegisteredNodeID returns the NodeID registered for the node, or the original NodeID if
+// the node is not registered.
+func (ch *Client) RegisteredNodeID(nodeID ua.NodeID) ua.NodeID {
+	ch.registeredNodesLock.RLock()
+	defer ch.registeredNodesLock.RUnlock()
+	if alias, ok := ch.registeredNodes[nodeID]; ok {
+		return alias
+	}
+	return nodeID
+}
+
+// unregisterAllNodeIDs unregisters all nodes registered by RegisterNodeIDs, before the session is closed.
+func (ch *Client) unregisterAllNodeIDs(ctx context.Context) {
+	ch.registeredNodesLock.Lock()
+	registered := make([]ua.NodeID, 0, len(ch.registeredNodes))
+	for _, alias := range ch.registeredNodes {
+		registered = append(registered, alias)
+	}
+	ch.registeredNodes = nil
+	ch.registeredNodesLock.Unlock()
+	if len(registered) == 0 {
+		return
+	}
+	ch.UnregisterNodes(ctx, &ua.UnregisterNodesRequest{
+		NodesToUnregister: registered,
+	})
+}
+
+// hasRegisteredNodes returns true if any node is registered by RegisterNodeIDs.
+func (ch *Client) hasRegisteredNodes() bool {
+	ch.registeredNodesLock.RLock()
+	defer ch.registeredNodesLock.RUnlock()
+	return len(ch.registeredNodes) > 0
+}
+
+// ReadTime reads the DateTime value of a variable. An unspecified DateTime is returned as the zero time.
+func (ch *Client) ReadTime(ctx context.Context, nodeID ua.NodeID) (time.Time, error) {
+	res, err := ch.Read(ctx, &ua.ReadRequest{
+		NodesToRead: []ua.ReadValueID{
+			{NodeID: nodeID, AttributeID: ua.AttributeIDValue},
+		},
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(res.Results) != 1 {
+		return time.Time{}, ua.BadUnexpectedError
+	}
+	if sc := res.Results[0].StatusCode; sc.IsBad() {
+		return time.Time{}, sc
+	}
+	value, ok := res.Results[0].Value.(time.Time)
+	if !ok {
+		return time.Time{}, ua.BadTypeMismatch
+	}
+	return value, nil
+}
+
+// WriteTime writes the DateTime value of a variable. The zero time is written as an unspecified DateTime.
+func (ch *Client) WriteTime(ctx context.Context, nodeID ua.NodeID, value time.Time) error {
+	res, err := ch.Write(ctx, &ua.WriteRequest{
+		NodesToWrite: []ua.WriteValue{
+			{NodeID: nodeID, AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(value, 0, time.Time{}, 0, time.Time{}, 0)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if len(res.Results) != 1 {
+		return ua.BadUnexpectedError
+	}
+	if sc := res.Results[0]; sc.IsBad() {
+		return sc
+	}
 	return nil
 }
 
-// Close closes the session and secure channel.
-func (ch *Client) Close(ctx context.Context) error {
-	var request = &ua.CloseSessionRequest{
-		DeleteSubscriptions: true,
+// WriteValueAs writes the value of a variable, encoded as the given VariantType regardless of
+// the Go type of the value, e.g. WriteValueAs(ctx, nodeID, ua.VariantTypeInt16, 42). Returns
+// BadOutOfRange or BadTypeMismatch without contacting the server if the value cannot be stored
+// as the VariantType.
+func (ch *Client) WriteValueAs(ctx context.Context, nodeID ua.NodeID, variantType byte, value interface{}) error {
+	v, err := ua.NewVariantAs(variantType, value)
+	if err != nil {
+		return err
 	}
-	_, err := ch.closeSession(ctx, request)
+	res, err := ch.Write(ctx, &ua.WriteRequest{
+		NodesToWrite: []ua.WriteValue{
+			{NodeID: nodeID, AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(v, 0, time.Time{}, 0, time.Time{}, 0)},
+		},
+	})
 	if err != nil {
 		return err
 	}
-	return ch.channel.Close(ctx)
+	if len(res.Results) != 1 {
+		return ua.BadUnexpectedError
+	}
+	if sc := res.Results[0]; sc.IsBad() {
+		return sc
+	}
+	return nil
+}
+
+// ResolveBrowsePath returns the NodeID of the node found by following the path from the start node,
+// e.g. ResolveBrowsePath(ctx, ua.ObjectIDObjectsFolder, "/2:DeviceSet/2:Motor/2:Speed"). See
+// ua.ParseRelativePath for the syntax of the path. Returns BadNoMatch if the path cannot be resolved,
+// and BadTooManyMatches if the path resolves to more than one node.
+func (ch *Client) ResolveBrowsePath(ctx context.Context, startNodeID ua.NodeID, path string) (ua.NodeID, error) {
+	relativePath, err := ua.ParseRelativePath(path)
+	if err != nil {
+		return nil, err
+	}
+	res, err := ch.TranslateBrowsePathsToNodeIDs(ctx, &ua.TranslateBrowsePathsToNodeIDsRequest{
+		BrowsePaths: []ua.BrowsePath{
+			{StartingNode: startNodeID, RelativePath: relativePath},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Results) != 1 {
+		return nil, ua.BadUnexpectedError
+	}
+	result := res.Results[0]
+	if sc := result.StatusCode; sc.IsBad() {
+		return nil, sc
+	}
+	switch len(result.Targets) {
+	case 0:
+		return nil, ua.BadNoMatch
+	case 1:
+	default:
+		return nil, ua.BadTooManyMatches
+	}
+	target := result.Targets[0]
+	// a target on another server leaves part of the path unresolved.
+	if target.RemainingPathIndex != math.MaxUint32 || target.TargetID.ServerIndex != 0 {
+		return nil, ua.BadNoMatch
+	}
+	nodeID := ua.ToNodeID(target.TargetID, ch.secureChannel().NamespaceURIs())
+	if nodeID == nil {
+		return nil, ua.BadNodeIDUnknown
+	}
+	return nodeID, nil
+}
+
+// containsEndpoints returns true if every endpoint in want has a matching endpoint in have. Endpoints
+// match if their security policy, security mode, security level, transport and certificate are equal.
+func containsEndpoints(have, want []ua.EndpointDescription) bool {
+	for _, w := range want {
+		found := false
+		for _, h := range have {
+			if h.SecurityPolicyURI == w.SecurityPolicyURI &&
+				h.SecurityMode == w.SecurityMode &&
+				h.SecurityLevel == w.SecurityLevel &&
+				h.TransportProfileURI == w.TransportProfileURI &&
+				bytes.Equal([]byte(h.ServerCertificate), []byte(w.ServerCertificate)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
 }
 
 // Abort closes the client abruptly.
 func (ch *Client) Abort(ctx context.Context) error {
-	return ch.channel.Abort(ctx)
+	ch.stopReconnect()
+	ch.stopSubscriptionMonitor()
+	return ch.secureChannel().Abort(ctx)
+}
+
+// stopSubscriptionMonitor stops watching the subscriptions of the client.
+func (ch *Client) stopSubscriptionMonitor() {
+	if ch.subscriptionMonitor != nil {
+		ch.subscriptionMonitor.stop()
+	}
 }
@@ -19,6 +19,7 @@ import (
 	"hash"
 	"io"
 	"log"
+	"log/slog"
 	"math"
 	"net"
 	"net/url"
@@ -73,9 +74,11 @@ type clientSecureChannel struct {
 	suppressHostNameInvalid            bool
 	suppressCertificateExpired         bool
 	suppressCertificateChainIncomplete bool
+	certificateValidator               *ua.CertificateValidator
 	//
 	localCertificate           []byte
 	remoteCertificate          []byte
+	remoteApplicationURI       string
 	localPrivateKey            *rsa.PrivateKey
 	remotePublicKey            *rsa.PublicKey
 	localPrivateKeySize        int
@@ -117,6 +120,7 @@ type clientSecureChannel struct {
 	symEncryptingBlockCipher   cipher.Block
 	symDecryptingBlockCipher   cipher.Block
 	trace                      bool
+	logger                     *slog.Logger
 }
 
 // newClientSecureChannel initializes a new instance of the secure channel.
@@ -128,15 +132,18 @@ func newClientSecureChannel(
 	securityPolicyURI string,
 	securityMode ua.MessageSecurityMode,
 	remoteCertificate []byte,
+	remoteApplicationURI string,
 	connectTimeout int64,
 	trustedCertsFile string,
 	suppressHostNameInvalid bool,
 	suppressCertificateExpired bool,
 	suppressCertificateChainIncomplete bool,
+	certificateValidator *ua.CertificateValidator,
 	timeoutHint uint32,
 	diagnosticsHint uint32,
 	tokenLifetime uint32,
 	trace bool,
+	logger *slog.Logger,
 ) *clientSecureChannel {
 
 	ch := &clientSecureChannel{
@@ -147,6 +154,7 @@ func newClientSecureChannel(
 		localCertificate:                   localCertificate,
 		localPrivateKey:                    localPrivateKey,
 		remoteCertificate:                  remoteCertificate,
+		remoteApplicationURI:               remoteApplicationURI,
 		namespaceURIs:                      []string{"http://opcfoundation.org/UA/"},
 		serverURIs:                         []string{},
 		connectTimeout:                     connectTimeout,
@@ -154,10 +162,12 @@ func newClientSecureChannel(
 		suppressHostNameInvalid:            suppressHostNameInvalid,
 		suppressCertificateExpired:         suppressCertificateExpired,
 		suppressCertificateChainIncomplete: suppressCertificateChainIncomplete,
+		certificateValidator:               certificateValidator,
 		timeoutHint:                        timeoutHint,
 		diagnosticsHint:                    diagnosticsHint,
 		tokenRequestedLifetime:             tokenLifetime,
 		trace:                              trace,
+		logger:                             logger,
 	}
 	if cert, err := x509.ParseCertificate(ch.remoteCertificate); err == nil {
 		ch.remotePublicKey = cert.PublicKey.(*rsa.PublicKey)
@@ -225,7 +235,8 @@ func (ch *clientSecureChannel) SetServerURIs(value []string) {
 	ch.serverURIs = value
 }
 
-// Request sends a service request to the server and returns the response.
+// Request sends a service request to the server and returns the response. If the ServiceResult of
+// the response is not Good, the response is returned with the ServiceResult as the error.
 func (ch *clientSecureChannel) Request(ctx context.Context, req ua.ServiceRequest) (ua.ServiceResponse, error) {
 	header := req.Header()
 	header.Timestamp = time.Now()
@@ -234,8 +245,15 @@ func (ch *clientSecureChannel) Request(ctx context.Context, req ua.ServiceReques
 	if header.TimeoutHint == 0 {
 		header.TimeoutHint = defaultTimeoutHint
 	}
+	if header.ReturnDiagnostics == 0 {
+		header.ReturnDiagnostics = ch.diagnosticsHint
+	}
 	var operation = ua.NewServiceOperation(req, make(chan ua.ServiceResponse, 1))
-	ch.pendingResponseCh <- operation
+	select {
+	case ch.pendingResponseCh <- operation:
+	case <-ch.cancellation:
+		return nil, ch.errCode
+	}
 	ctx, cancel := context.WithDeadline(ctx, header.Timestamp.Add(time.Duration(header.TimeoutHint)*time.Millisecond))
 	err := ch.sendRequest(ctx, operation)
 	if err != nil {
@@ -246,7 +264,7 @@ func (ch *clientSecureChannel) Request(ctx context.Context, req ua.ServiceReques
 	case res := <-operation.ResponseCh():
 		if sr := res.Header().ServiceResult; sr != ua.Good {
 			cancel()
-			return nil, sr
+			return res, sr
 		}
 		cancel()
 		return res, nil
@@ -274,9 +292,18 @@ func (ch *clientSecureChannel) Open(ctx context.Context) error {
 		if err != nil {
 			return ua.BadSecurityChecksFailed
 		}
-		_, err = validateServerCertificate(cert, remoteURL.Hostname(), ch.trustedCertsFile, ch.suppressHostNameInvalid, ch.suppressCertificateExpired, ch.suppressCertificateChainIncomplete)
-		if err != nil {
-			return err
+		if v := ch.certificateValidator; v != nil {
+			result := v.Validate(cert, x509.ExtKeyUsageServerAuth, remoteURL.Hostname(), ch.remoteApplicationURI)
+			if err := result.Err(); err != nil {
+				ch.logger.Warn("Rejected server certificate", ua.StatusCodeAttr(err), slog.String("subject", cert.Subject.String()), slog.String("result", result.String()))
+				return err
+			}
+		} else {
+			_, err = validateServerCertificate(cert, remoteURL.Hostname(), ch.trustedCertsFile, ch.suppressHostNameInvalid, ch.suppressCertificateExpired, ch.suppressCertificateChainIncomplete)
+			if err != nil {
+				ch.logger.Warn("Rejected server certificate", ua.StatusCodeAttr(err), slog.String("subject", cert.Subject.String()))
+				return err
+			}
 		}
 	}
 
@@ -444,6 +471,7 @@ func (ch *clientSecureChannel) Open(ctx context.Context) error {
 	ch.localNonce = []byte(request.ClientNonce)
 	ch.remoteNonce = []byte(response.ServerNonce)
 	ch.tokenLock.Unlock()
+	ch.logger.Info("Opened secure channel", ua.ChannelIDAttr(ch.channelID), slog.String("securityPolicyUri", ch.securityPolicyURI), slog.String("securityMode", ch.securityMode.String()), slog.String("endpointUrl", ch.endpointURL))
 	return nil
 }
 
@@ -457,6 +485,7 @@ func (ch *clientSecureChannel) Close(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	ch.logger.Info("Closed secure channel", ua.ChannelIDAttr(ch.channelID))
 	if ch.conn != nil {
 		return ch.conn.Close()
 	}
@@ -1163,8 +1192,13 @@ func (ch *clientSecureChannel) responseWorker() {
 			if ch.errCode == ua.Good {
 				if ec, ok := err.(ua.StatusCode); ok {
 					ch.errCode = ec
+				} else {
+					ch.errCode = ua.BadConnectionClosed
 				}
 			}
+			if !ch.closing {
+				ch.logger.Warn("Lost secure channel", ua.ChannelIDAttr(ch.channelID), ua.StatusCodeAttr(ch.errCode))
+			}
 			close(ch.cancellation)
 			return
 		}
@@ -1592,6 +1626,7 @@ func (ch *clientSecureChannel) renewToken(ctx context.Context) error {
 	ch.localNonce = []byte(request.ClientNonce)
 	ch.remoteNonce = []byte(response.ServerNonce)
 	ch.tokenLock.Unlock()
+	ch.logger.Debug("Renewed secure channel", ua.ChannelIDAttr(ch.channelID), slog.Uint64("tokenId", uint64(ch.tokenID)))
 	return nil
 }
 
@@ -4,6 +4,7 @@ package client
 
 import (
 	"context"
+	"log/slog"
 
 	"github.com/awcullen/opcua/ua"
 )
@@ -42,15 +43,18 @@ func FindServers(ctx context.Context, request *ua.FindServersRequest) (*ua.FindS
 		ua.SecurityPolicyURINone,
 		ua.MessageSecurityModeNone,
 		nil,
+		"",
 		defaultConnectTimeout,
 		"",
 		false,
 		false,
 		false,
+		nil,
 		defaultTimeoutHint,
 		defaultDiagnosticsHint,
 		defaultTokenRequestedLifetime,
-		false)
+		false,
+		slog.New(ua.DiscardHandler{}))
 
 	err := ch.Open(ctx)
 	if err != nil {
@@ -83,15 +87,18 @@ func GetEndpoints(ctx context.Context, request *ua.GetEndpointsRequest) (*ua.Get
 		ua.SecurityPolicyURINone,
 		ua.MessageSecurityModeNone,
 		nil,
+		"",
 		defaultConnectTimeout,
 		"",
 		false,
 		false,
 		false,
+		nil,
 		defaultTimeoutHint,
 		defaultDiagnosticsHint,
 		defaultTokenRequestedLifetime,
-		false)
+		false,
+		slog.New(ua.DiscardHandler{}))
 
 	err := ch.Open(ctx)
 	if err != nil {
@@ -120,9 +127,9 @@ func (ch *Client) createSession(ctx context.Context, request *ua.CreateSessionRe
 	return response.(*ua.CreateSessionResponse), nil
 }
 
-// Activate a session.
+// ActivateSession activates the session again, e.g. to change the user identity.
 // See https://reference.opcfoundation.org/v104/Core/docs/Part4/5.6.3/
-func (ch *Client) activateSession(ctx context.Context, request *ua.ActivateSessionRequest) (*ua.ActivateSessionResponse, error) {
+func (ch *Client) ActivateSession(ctx context.Context, request *ua.ActivateSessionRequest) (*ua.ActivateSessionResponse, error) {
 	response, err := ch.request(ctx, request)
 	if err != nil {
 		return nil, err
@@ -240,9 +247,44 @@ func (ch *Client) UnregisterNodes(ctx context.Context, request *ua.UnregisterNod
 	return response.(*ua.UnregisterNodesResponse), nil
 }
 
-// Read returns values of Attributes of one or more Nodes.
+// QueryFirst returns the nodes of the given types that match the filter, with the requested data of each node.
+// If the filter or the node types are invalid, the response is returned with the error, so the
+// FilterResult and ParsingResults can be inspected.
+// See https://reference.opcfoundation.org/v104/Core/docs/Part4/5.9.3/
+func (ch *Client) QueryFirst(ctx context.Context, request *ua.QueryFirstRequest) (*ua.QueryFirstResponse, error) {
+	response, err := ch.request(ctx, request)
+	if err != nil {
+		if response, ok := response.(*ua.QueryFirstResponse); ok {
+			return response, err
+		}
+		return nil, err
+	}
+	return response.(*ua.QueryFirstResponse), nil
+}
+
+// QueryNext requests the next set of QueryFirst responses, when the information is too large to be sent in a single response.
+// See https://reference.opcfoundation.org/v104/Core/docs/Part4/5.9.4/
+func (ch *Client) QueryNext(ctx context.Context, request *ua.QueryNextRequest) (*ua.QueryNextResponse, error) {
+	response, err := ch.request(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	return response.(*ua.QueryNextResponse), nil
+}
+
+// Read returns values of Attributes of one or more Nodes. NodeIDs registered by RegisterNodeIDs are
+// substituted for the original NodeIDs.
 // See https://reference.opcfoundation.org/v104/Core/docs/Part4/5.10.2/
 func (ch *Client) Read(ctx context.Context, request *ua.ReadRequest) (*ua.ReadResponse, error) {
+	if ch.hasRegisteredNodes() {
+		r := *request
+		r.NodesToRead = make([]ua.ReadValueID, len(request.NodesToRead))
+		for i, n := range request.NodesToRead {
+			n.NodeID = ch.RegisteredNodeID(n.NodeID)
+			r.NodesToRead[i] = n
+		}
+		request = &r
+	}
 	response, err := ch.request(ctx, request)
 	if err != nil {
 		return nil, err
@@ -250,9 +292,19 @@ func (ch *Client) Read(ctx context.Context, request *ua.ReadRequest) (*ua.ReadRe
 	return response.(*ua.ReadResponse), nil
 }
 
-// Write sets values of Attributes of one or more Nodes
+// Write sets values of Attributes of one or more Nodes. NodeIDs registered by RegisterNodeIDs are
+// substituted for the original NodeIDs.
 // See https://reference.opcfoundation.org/v104/Core/docs/Part4/5.10.4/
 func (ch *Client) Write(ctx context.Context, request *ua.WriteRequest) (*ua.WriteResponse, error) {
+	if ch.hasRegisteredNodes() {
+		r := *request
+		r.NodesToWrite = make([]ua.WriteValue, len(request.NodesToWrite))
+		for i, n := range request.NodesToWrite {
+			n.NodeID = ch.RegisteredNodeID(n.NodeID)
+			r.NodesToWrite[i] = n
+		}
+		request = &r
+	}
 	response, err := ch.request(ctx, request)
 	if err != nil {
 		return nil, err
@@ -291,6 +343,8 @@ func (ch *Client) Call(ctx context.Context, request *ua.CallRequest) (*ua.CallRe
 }
 
 // CreateMonitoredItems creates and adds one or more MonitoredItems to a Subscription.
+// The Results hold the MonitoredItemID and the sampling interval and queue size as revised
+// by the server, in the order of the ItemsToCreate.
 // See https://reference.opcfoundation.org/v104/Core/docs/Part4/5.12.2/
 func (ch *Client) CreateMonitoredItems(ctx context.Context, request *ua.CreateMonitoredItemsRequest) (*ua.CreateMonitoredItemsResponse, error) {
 	response, err := ch.request(ctx, request)
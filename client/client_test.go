@@ -11,6 +11,7 @@ import (
 	"crypto/x509/pkix"
 	"encoding/pem"
 	"fmt"
+	"io"
 	"math/big"
 	"net"
 	"net/url"
@@ -20,6 +21,7 @@ import (
 	"time"
 
 	"github.com/awcullen/opcua/client"
+	"github.com/awcullen/opcua/server"
 	"github.com/awcullen/opcua/ua"
 
 	"github.com/pkg/errors"
@@ -135,6 +137,71 @@ func TestOpenClientWithSecurity(t *testing.T) {
 
 }
 
+// TestOpenClientWithCertificateValidator tests that a client only connects to a server with a trusted certificate.
+func TestOpenClientWithCertificateValidator(t *testing.T) {
+	ctx := context.Background()
+	validator := &ua.CertificateValidator{
+		TrustedCertsPath:                   t.TempDir(),
+		SuppressCertificateHostNameInvalid: true,
+	}
+	_, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithSecurityPolicyURI(ua.SecurityPolicyURIBasic256Sha256),
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithCertificateValidator(validator),
+	)
+	if err != ua.BadCertificateUntrusted {
+		t.Errorf("Expected %s, got %v", ua.BadCertificateUntrusted, err)
+		return
+	}
+	validator.TrustedCertsPath = "./pki/server.crt"
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithSecurityPolicyURI(ua.SecurityPolicyURIBasic256Sha256),
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithCertificateValidator(validator),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	t.Logf("Success opening client: %s", ch.EndpointURL())
+	ch.Close(ctx)
+}
+
+// TestOpenClientWithRequiredSecurityPolicy tests that a client only connects to an endpoint with the required security policy.
+func TestOpenClientWithRequiredSecurityPolicy(t *testing.T) {
+	ctx := context.Background()
+	_, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithRequiredSecurityPolicy(ua.SecurityPolicyURIBasic128Rsa15),
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+	)
+	if err != ua.BadSecurityPolicyRejected {
+		t.Errorf("Error opening client. want: %s, got: %v", ua.BadSecurityPolicyRejected, err)
+		return
+	}
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithRequiredSecurityPolicy(ua.SecurityPolicyURIBasic256Sha256),
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	if ch.SecurityPolicyURI() != ua.SecurityPolicyURIBasic256Sha256 {
+		t.Errorf("Error opening client. want: %s, got: %s", ua.SecurityPolicyURIBasic256Sha256, ch.SecurityPolicyURI())
+	}
+	ch.Close(ctx)
+}
+
 // TestReadServerStatus tests reading the server status variable.
 func TestReadServerStatus(t *testing.T) {
 	ctx := context.Background()
@@ -334,6 +401,80 @@ func TestWrite(t *testing.T) {
 	ch.Close(ctx)
 }
 
+// TestWriteReadTime tests writing and reading a DateTime value, including the unspecified DateTime.
+func TestWriteReadTime(t *testing.T) {
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	id := ua.ParseNodeID("ns=2;s=Demo.Static.Scalar.DateTime")
+	for _, in := range []time.Time{time.Date(2020, time.July, 04, 12, 0, 0, 100, time.UTC), {}} {
+		if err := ch.WriteTime(ctx, id, in); err != nil {
+			t.Error(errors.Wrap(err, "Error writing"))
+			ch.Abort(ctx)
+			return
+		}
+		out, err := ch.ReadTime(ctx, id)
+		if err != nil {
+			t.Error(errors.Wrap(err, "Error reading"))
+			ch.Abort(ctx)
+			return
+		}
+		if !out.Equal(in) {
+			t.Errorf("Expected %s, got %s", in, out)
+		}
+	}
+	ch.Close(ctx)
+}
+
+// TestWriteValueAs tests writing a Go int to an Int16 variable.
+func TestWriteValueAs(t *testing.T) {
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	id := ua.ParseNodeID("ns=2;s=Demo.Static.Scalar.Int16")
+	if err := ch.WriteValueAs(ctx, id, ua.VariantTypeInt16, 42); err != nil {
+		t.Error(errors.Wrap(err, "Error writing"))
+		return
+	}
+	res, err := ch.Read(ctx, &ua.ReadRequest{
+		NodesToRead: []ua.ReadValueID{{NodeID: id, AttributeID: ua.AttributeIDValue}},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading"))
+		return
+	}
+	if res.Results[0].Value != int16(42) {
+		t.Errorf("Error writing as Int16. want: %v, got: %v", int16(42), res.Results[0].Value)
+	}
+	// the server rejects a value of another type.
+	if err := ch.WriteValueAs(ctx, id, ua.VariantTypeInt32, 42); err != ua.BadTypeMismatch {
+		t.Errorf("Error writing as Int32. want: %s, got: %v", ua.BadTypeMismatch, err)
+	}
+	// the client rejects a value that does not fit.
+	if err := ch.WriteValueAs(ctx, id, ua.VariantTypeInt16, 40000); err != ua.BadOutOfRange {
+		t.Errorf("Error writing out of range. want: %s, got: %v", ua.BadOutOfRange, err)
+	}
+}
+
 // TestReadIndexRange tests reading the first three elements of a server array variable.
 func TestReadIndexRange(t *testing.T) {
 	ctx := context.Background()
@@ -511,8 +652,18 @@ func TestSubscribe(t *testing.T) {
 	res2, err := ch.CreateMonitoredItems(ctx, req2)
 	if err != nil {
 		t.Error(errors.Wrap(err, "Error creating item"))
+		ch.Abort(ctx)
+		return
+	}
+	// the server revises the queue size to at least 1.
+	result := res2.Results[0]
+	t.Logf("Created item: %d, revised sampling interval: %v, revised queue size: %d", result.MonitoredItemID, result.RevisedSamplingInterval, result.RevisedQueueSize)
+	if result.StatusCode.IsBad() || result.MonitoredItemID == 0 {
+		t.Errorf("Error creating item. got: %s, id: %d", result.StatusCode, result.MonitoredItemID)
+	}
+	if result.RevisedSamplingInterval != 500.0 || result.RevisedQueueSize != 1 {
+		t.Errorf("Error revising item. want: 500, 1, got: %v, %d", result.RevisedSamplingInterval, result.RevisedQueueSize)
 	}
-	_ = res2
 	// prepare an initial publish request
 	req3 := &ua.PublishRequest{
 		RequestHeader:                ua.RequestHeader{TimeoutHint: 60000},
@@ -550,6 +701,144 @@ func TestSubscribe(t *testing.T) {
 	ch.Close(ctx)
 }
 
+// TestCreateMonitoredItemsRevised tests that the server revises the parameters requested for a
+// monitored item.
+func TestCreateMonitoredItemsRevised(t *testing.T) {
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening client"))
+	}
+	defer ch.Close(ctx)
+	res, err := ch.CreateSubscription(ctx, &ua.CreateSubscriptionRequest{
+		RequestedPublishingInterval: 1000.0,
+		RequestedMaxKeepAliveCount:  30,
+		RequestedLifetimeCount:      30 * 3,
+		PublishingEnabled:           true,
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error creating subscription"))
+	}
+	res2, err := ch.CreateMonitoredItems(ctx, &ua.CreateMonitoredItemsRequest{
+		SubscriptionID:     res.SubscriptionID,
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+		ItemsToCreate: []ua.MonitoredItemCreateRequest{
+			{
+				ItemToMonitor: ua.ReadValueID{
+					AttributeID: ua.AttributeIDValue,
+					NodeID:      ua.VariableIDServerServerStatusCurrentTime,
+				},
+				MonitoringMode: ua.MonitoringModeReporting,
+				RequestedParameters: ua.MonitoringParameters{
+					ClientHandle: 42, QueueSize: 0, DiscardOldest: true, SamplingInterval: 500.0,
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error creating item"))
+	}
+	// the server revises the queue size to at least 1.
+	result := res2.Results[0]
+	if result.StatusCode.IsBad() || result.MonitoredItemID == 0 {
+		t.Errorf("Error creating item. got: %s, id: %d", result.StatusCode, result.MonitoredItemID)
+	}
+	if result.RevisedSamplingInterval != 500.0 || result.RevisedQueueSize != 1 {
+		t.Errorf("Error revising item. want: 500, 1, got: %v, %d", result.RevisedSamplingInterval, result.RevisedQueueSize)
+	}
+}
+
+// TestSubscribeMonitor tests receiving the data changes of the server's variable from a channel.
+func TestSubscribeMonitor(t *testing.T) {
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	sub, err := ch.Subscribe(ctx, 500*time.Millisecond)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating subscription"))
+		return
+	}
+	if _, err := sub.Monitor(ctx, ua.ParseNodeID("ns=2;s=Unknown"), ua.AttributeIDValue); err != ua.BadNodeIDUnknown {
+		t.Errorf("Error monitoring unknown node. want: %s, got: %v", ua.BadNodeIDUnknown, err)
+	}
+	values, err := sub.Monitor(ctx, ua.VariableIDServerServerStatusCurrentTime, ua.AttributeIDValue)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating item"))
+		return
+	}
+	// loop until 3 data changes received.
+	for i := 0; i < 3; i++ {
+		select {
+		case v := <-values:
+			t.Logf(" + CurrentTime: %s", v.Value)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout waiting for data change.")
+		}
+	}
+	if err := sub.Delete(ctx); err != nil {
+		t.Error(errors.Wrap(err, "Error deleting subscription"))
+	}
+	// the channel is closed after the values already received.
+	for range values {
+	}
+	if _, err := sub.Monitor(ctx, ua.VariableIDServerServerStatusCurrentTime, ua.AttributeIDValue); err != ua.BadSubscriptionIDInvalid {
+		t.Errorf("Error monitoring deleted subscription. want: %s, got: %v", ua.BadSubscriptionIDInvalid, err)
+	}
+}
+
+// TestSubscribeDeletedByServer tests the channels are closed if the server no longer has the subscription.
+func TestSubscribeDeletedByServer(t *testing.T) {
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	sub, err := ch.Subscribe(ctx, 500*time.Millisecond)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating subscription"))
+		return
+	}
+	values, err := sub.Monitor(ctx, ua.VariableIDServerServerStatusCurrentTime, ua.AttributeIDValue)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating item"))
+		return
+	}
+	<-values
+	// delete the subscription without telling the publish loop.
+	if _, err := ch.DeleteSubscriptions(ctx, &ua.DeleteSubscriptionsRequest{SubscriptionIDs: []uint32{sub.ID()}}); err != nil {
+		t.Fatal(errors.Wrap(err, "Error deleting subscription"))
+	}
+	timeout := time.After(30 * time.Second)
+	for open := true; open; {
+		select {
+		case _, open = <-values:
+		case <-timeout:
+			t.Fatal("Timeout waiting for the channel to close.")
+		}
+	}
+	if err := sub.Err(); err != ua.BadNoSubscription {
+		t.Errorf("Error of deleted subscription. want: %s, got: %v", ua.BadNoSubscription, err)
+	}
+}
+
 // TestSubscribeEvents tests subscribing to receive events from Area1.
 func TestSubscribeEvents(t *testing.T) {
 	ctx := context.Background()
@@ -819,6 +1108,137 @@ func TestTranslate(t *testing.T) {
 	}
 }
 
+// TestResolveBrowsePath tests resolving a NodeID from a readable path.
+func TestResolveBrowsePath(t *testing.T) {
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	id, err := ch.ResolveBrowsePath(ctx, ua.ParseNodeID("ns=2;s=Demo"), "/2:Static/2:Scalar/2:Float")
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error resolving browse path"))
+		return
+	}
+	if want := ua.ParseNodeID("ns=2;s=Demo.Static.Scalar.Float"); id != want {
+		t.Errorf("Error resolving browse path. want: %s, got: %s", want, id)
+	}
+	_, err = ch.ResolveBrowsePath(ctx, ua.ParseNodeID("ns=2;s=Demo"), "/2:Static/2:Missing")
+	if err != ua.BadNoMatch {
+		t.Errorf("Error resolving missing browse path. want: %s, got: %v", ua.BadNoMatch, err)
+	}
+}
+
+// TestRegisterNodeIDs tests reading nodes after registering them with the server.
+func TestRegisterNodeIDs(t *testing.T) {
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	ids := []ua.NodeID{
+		ua.ParseNodeID("ns=2;s=Demo.Static.Scalar.Float"),
+		ua.ParseNodeID("ns=2;s=Demo.Static.Scalar.Double"),
+	}
+	registered, err := ch.RegisterNodeIDs(ctx, ids)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error registering nodes"))
+		return
+	}
+	for i, id := range ids {
+		if got := ch.RegisteredNodeID(id); got != registered[i] {
+			t.Errorf("Error registering nodes. want: %s, got: %s", registered[i], got)
+		}
+	}
+	res, err := ch.Read(ctx, &ua.ReadRequest{
+		NodesToRead: []ua.ReadValueID{
+			{NodeID: ids[0], AttributeID: ua.AttributeIDValue},
+			{NodeID: ids[1], AttributeID: ua.AttributeIDValue},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading"))
+		return
+	}
+	for i, result := range res.Results {
+		if result.StatusCode.IsBad() {
+			t.Errorf("Error reading registered node %s: %s", ids[i], result.StatusCode)
+		}
+	}
+	if err := ch.UnregisterNodeIDs(ctx, ids); err != nil {
+		t.Error(errors.Wrap(err, "Error unregistering nodes"))
+	}
+	if got := ch.RegisteredNodeID(ids[0]); got != ids[0] {
+		t.Errorf("Error unregistering nodes. want: %s, got: %s", ids[0], got)
+	}
+}
+
+// TestOnStale tests that a subscription is reported stale only after publish responses stop arriving.
+func TestOnStale(t *testing.T) {
+	ctx := context.Background()
+	stale := make(chan uint32, 1)
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithInsecureSkipVerify(),
+		client.WithOnStale(func(subscriptionID uint32) {
+			select {
+			case stale <- subscriptionID:
+			default:
+			}
+		}),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	res, err := ch.CreateSubscription(ctx, &ua.CreateSubscriptionRequest{
+		RequestedPublishingInterval: 100.0,
+		RequestedMaxKeepAliveCount:  2,
+		RequestedLifetimeCount:      30,
+		PublishingEnabled:           true,
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating subscription"))
+		return
+	}
+	// an idle subscription delivers keep-alive messages while publish requests are outstanding.
+	for start := time.Now(); time.Since(start) < 1500*time.Millisecond; {
+		if _, err := ch.Publish(ctx, &ua.PublishRequest{}); err != nil {
+			t.Error(errors.Wrap(err, "Error publishing"))
+			return
+		}
+		select {
+		case id := <-stale:
+			t.Errorf("Error monitoring subscription. subscription %d reported stale while publishing", id)
+			return
+		default:
+		}
+	}
+	// without publish requests, the subscription falls silent.
+	select {
+	case id := <-stale:
+		if id != res.SubscriptionID {
+			t.Errorf("Error monitoring subscription. want: %d, got: %d", res.SubscriptionID, id)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("Error monitoring subscription. want: stale, got: none")
+	}
+}
+
 func createNewCertificate(appName, certFile, keyFile string) error {
 
 	// Create a keypair.
@@ -913,3 +1333,70 @@ func ensurePKI() error {
 	}
 	return nil
 }
+
+// TestServerEndpointsMismatch tests that the client rejects a session when the endpoints returned by
+// CreateSession do not match the endpoints returned by discovery.
+func TestServerEndpointsMismatch(t *testing.T) {
+	// the other server does not offer SecurityPolicyNone.
+	otherURL := "opc.tcp://127.0.0.1:46019"
+	srv, err := server.New(
+		ua.ApplicationDescription{ApplicationName: ua.NewLocalizedText("otherserver", "")},
+		"./pki/server.crt",
+		"./pki/server.key",
+		otherURL,
+		server.WithSecurityPolicyNone(false),
+		server.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error constructing server"))
+		return
+	}
+	defer srv.Close()
+	go srv.ListenAndServe()
+
+	// the proxy forwards discovery to the test server, and the session to the other server.
+	l, err := net.Listen("tcp", "127.0.0.1:46020")
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error listening"))
+		return
+	}
+	defer l.Close()
+	go func() {
+		target := "127.0.0.1:46010"
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			remote, err := net.Dial("tcp", target)
+			target = "127.0.0.1:46019"
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			go func() {
+				io.Copy(remote, conn)
+				remote.Close()
+			}()
+			go func() {
+				io.Copy(conn, remote)
+				conn.Close()
+			}()
+		}
+	}()
+	time.Sleep(500 * time.Millisecond)
+
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		"opc.tcp://127.0.0.1:46020",
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+	)
+	if err == nil {
+		ch.Close(ctx)
+	}
+	if err != ua.BadSecurityChecksFailed {
+		t.Errorf("Error opening client. want: %s, got: %v", ua.BadSecurityChecksFailed, err)
+	}
+}
@@ -5,6 +5,7 @@ package client
 import (
 	"crypto/rsa"
 	"crypto/tls"
+	"log/slog"
 
 	"github.com/awcullen/opcua/ua"
 )
@@ -20,6 +21,15 @@ func WithSecurityPolicyURI(uri string) Option {
 	}
 }
 
+// WithRequiredSecurityPolicy restricts endpoint selection to the given security policy URI. Dial fails
+// with BadSecurityPolicyRejected if the server offers no endpoint with a matching policy. (default: any policy)
+func WithRequiredSecurityPolicy(uri string) Option {
+	return func(c *Client) error {
+		c.requiredSecurityPolicyURI = uri
+		return nil
+	}
+}
+
 // WithUserNameIdentity sets the user identity to a UserNameIdentity created from a username and password. (default: AnonymousIdentity)
 func WithUserNameIdentity(userName, password string) Option {
 	return func(c *Client) error {
@@ -68,6 +78,14 @@ func WithSessionTimeout(value float64) Option {
 	}
 }
 
+// WithLocaleIDs sets the locales preferred by the client, in order of preference. (default: en)
+func WithLocaleIDs(values ...string) Option {
+	return func(c *Client) error {
+		c.localeIDs = values
+		return nil
+	}
+}
+
 // WithClientCertificate sets the client certificate and private key.
 func WithClientCertificate(cert []byte, privateKey *rsa.PrivateKey) Option {
 	return func(c *Client) error {
@@ -110,6 +128,15 @@ func WithInsecureSkipVerify() Option {
 	}
 }
 
+// WithCertificateValidator sets the validator of the server certificate. If set, it is used instead of
+// WithTrustedCertificatesFile and WithInsecureSkipVerify.
+func WithCertificateValidator(validator *ua.CertificateValidator) Option {
+	return func(c *Client) error {
+		c.certificateValidator = validator
+		return nil
+	}
+}
+
 // WithTimeoutHint sets the default number of milliseconds to wait before the ServiceRequest is cancelled. (default: 1500)
 func WithTimeoutHint(value uint32) Option {
 	return func(c *Client) error {
@@ -142,6 +169,59 @@ func WithConnectTimeout(value int64) Option {
 	}
 }
 
+// WithOnStale sets a func that is called when a subscription has not delivered a notification message
+// or keep-alive message within MaxKeepAliveCount * PublishingInterval * the stale factor. The client
+// must keep publish requests outstanding for the server to deliver keep-alive messages. (default: none)
+func WithOnStale(f StaleFunc) Option {
+	return func(c *Client) error {
+		c.onStale = f
+		return nil
+	}
+}
+
+// WithStaleFactor sets the multiple of the keep-alive period to wait before a subscription is reported
+// as stale. Must be greater than 1. (default: 1.5)
+func WithStaleFactor(value float64) Option {
+	return func(c *Client) error {
+		c.staleFactor = value
+		return nil
+	}
+}
+
+// WithAutoReconnect reconnects the client when the secure channel is lost. The client opens a new secure
+// channel and activates the session on it, or else creates a new session and transfers the subscriptions
+// created by Subscribe to it. Subscriptions that cannot be transferred are recreated with their monitored
+// items. Subscriptions created by CreateSubscription are not transferred, and are lost with the session.
+// The func is called when the connection state changes, and may be nil. (default: none)
+func WithAutoReconnect(f ReconnectFunc) Option {
+	return func(c *Client) error {
+		c.autoReconnect = true
+		c.onReconnect = f
+		return nil
+	}
+}
+
+// WithReconnectInterval sets the number of milliseconds to wait between attempts to reconnect. (default: 5000)
+func WithReconnectInterval(value int64) Option {
+	return func(c *Client) error {
+		c.reconnectInterval = value
+		return nil
+	}
+}
+
+// WithLogger sets the logger of structured logs of secure channels, sessions, service faults, and
+// rejected certificates. The records have the attributes sessionId, channelId, service, and statusCode.
+// (default: discards all records)
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Client) error {
+		if logger == nil {
+			logger = slog.New(ua.DiscardHandler{})
+		}
+		c.logger = logger
+		return nil
+	}
+}
+
 // WithTrace logs all ServiceRequests and ServiceResponses to StdOut.
 func WithTrace() Option {
 	return func(c *Client) error {
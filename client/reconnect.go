@@ -0,0 +1,294 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/awcullen/opcua/ua"
+)
+
+const (
+	// defaultReconnectInterval is the default number of milliseconds to wait between attempts to reconnect.
+	defaultReconnectInterval int64 = 5000
+)
+
+// ConnectionState is the state of the connection of a client that reconnects automatically.
+type ConnectionState int
+
+const (
+	// Connected indicates the session is active on an open secure channel.
+	Connected ConnectionState = iota
+	// Reconnecting indicates the secure channel was lost, and the client is attempting to reconnect.
+	Reconnecting
+)
+
+// String returns the name of the state.
+func (s ConnectionState) String() string {
+	switch s {
+	case Connected:
+		return "Connected"
+	case Reconnecting:
+		return "Reconnecting"
+	default:
+		return "Unknown"
+	}
+}
+
+// ReconnectFunc is called when the connection state of the client changes. When the secure channel
+// is lost and after each failed attempt to reconnect, the state is Reconnecting and err is the cause.
+// When the client has reconnected, the state is Connected and err is nil.
+type ReconnectFunc func(state ConnectionState, err error)
+
+// secureChannel gets the current secure channel of the client.
+func (ch *Client) secureChannel() *clientSecureChannel {
+	ch.channelLock.Lock()
+	defer ch.channelLock.Unlock()
+	return ch.channel
+}
+
+// stopReconnect stops the client from reconnecting, before the secure channel is closed.
+func (ch *Client) stopReconnect() {
+	ch.channelLock.Lock()
+	defer ch.channelLock.Unlock()
+	if ch.closing {
+		return
+	}
+	ch.closing = true
+	if ch.done != nil {
+		close(ch.done)
+	}
+	ch.channelCond.Broadcast()
+}
+
+// waitReconnect waits for the client to reconnect, if the secure channel was lost. Returns false if
+// the secure channel is open, or if the client was closed.
+func (ch *Client) waitReconnect(channel *clientSecureChannel) bool {
+	select {
+	case <-channel.cancellation:
+	default:
+		return false
+	}
+	ch.channelLock.Lock()
+	defer ch.channelLock.Unlock()
+	for !ch.closing && (ch.reconnecting || ch.channel == channel) {
+		ch.channelCond.Wait()
+	}
+	return !ch.closing
+}
+
+// watchChannel reconnects the client each time the secure channel is lost, until the client is closed.
+func (ch *Client) watchChannel(channel *clientSecureChannel) {
+	for {
+		<-channel.cancellation
+		ch.channelLock.Lock()
+		if ch.closing {
+			ch.channelLock.Unlock()
+			return
+		}
+		ch.reconnecting = true
+		ch.channelLock.Unlock()
+
+		var err error = channel.errCode
+		for {
+			ch.notifyReconnect(Reconnecting, err)
+			if err = ch.reconnect(context.Background()); err == nil {
+				break
+			}
+			select {
+			case <-ch.done:
+				return
+			case <-time.After(time.Duration(ch.reconnectInterval) * time.Millisecond):
+			}
+		}
+		ch.notifyReconnect(Connected, nil)
+		channel = ch.secureChannel()
+	}
+}
+
+// notifyReconnect calls the ReconnectFunc of the client, if any.
+func (ch *Client) notifyReconnect(state ConnectionState, err error) {
+	if state == Connected {
+		ch.logger.Info("Reconnected", ua.SessionIDAttr(ch.SessionID()))
+	} else {
+		ch.logger.Warn("Reconnecting", ua.StatusCodeAttr(err))
+	}
+	if ch.onReconnect != nil {
+		ch.onReconnect(state, err)
+	}
+}
+
+// reconnect opens a new secure channel and activates the session on it. If the server no longer has the
+// session, a new session is created, and the subscriptions are transferred to the new session. Finally,
+// the notification messages that were lost with the secure channel are republished.
+func (ch *Client) reconnect(ctx context.Context) error {
+	old := ch.secureChannel()
+	channel := ch.newSecureChannel()
+	if err := channel.Open(ctx); err != nil {
+		channel.Abort(ctx)
+		return err
+	}
+	channel.SetAuthenticationToken(old.authenticationToken)
+	channel.SetNamespaceURIs(old.NamespaceURIs())
+	channel.SetServerURIs(old.ServerURIs())
+	ch.channelLock.Lock()
+	ch.channel = channel
+	serverNonce := ch.serverNonce
+	ch.channelLock.Unlock()
+
+	if err := ch.activate(ctx, serverNonce); err != nil {
+		if err := ch.openSession(ctx); err != nil {
+			channel.Abort(ctx)
+			return err
+		}
+		// the nodes registered with the old session are unknown to the new session.
+		ch.registeredNodesLock.Lock()
+		ch.registeredNodes = nil
+		ch.registeredNodesLock.Unlock()
+		ch.transferPending = true
+	}
+	if ch.transferPending {
+		if err := ch.transferSubscriptions(ctx); err != nil {
+			channel.Abort(ctx)
+			return err
+		}
+		ch.transferPending = false
+	}
+
+	ch.subscriptionsLock.Lock()
+	subs := make([]*Subscription, 0, len(ch.subscriptions))
+	for _, s := range ch.subscriptions {
+		subs = append(subs, s)
+	}
+	ch.subscriptionsLock.Unlock()
+	for _, s := range subs {
+		ch.republish(ctx, s, 0)
+	}
+
+	ch.channelLock.Lock()
+	defer ch.channelLock.Unlock()
+	if ch.closing {
+		channel.Abort(ctx)
+		return ua.BadConnectionClosed
+	}
+	ch.reconnecting = false
+	ch.channelCond.Broadcast()
+	return nil
+}
+
+// transferSubscriptions transfers the subscriptions of the client to the new session. If a subscription
+// cannot be transferred, it is recreated with its monitored items. Returns an error if the secure channel
+// was lost before all subscriptions were transferred.
+func (ch *Client) transferSubscriptions(ctx context.Context) error {
+	ch.subscriptionsLock.Lock()
+	subs := make([]*Subscription, 0, len(ch.subscriptions))
+	ids := make([]uint32, 0, len(ch.subscriptions))
+	for id, s := range ch.subscriptions {
+		subs = append(subs, s)
+		ids = append(ids, id)
+	}
+	ch.subscriptionsLock.Unlock()
+	if len(subs) == 0 {
+		return nil
+	}
+
+	res, err := ch.TransferSubscriptions(ctx, &ua.TransferSubscriptionsRequest{
+		SubscriptionIDs:   ids,
+		SendInitialValues: false,
+	})
+	if err == nil && len(res.Results) != len(ids) {
+		err = ua.BadUnexpectedError
+	}
+	for i, s := range subs {
+		if err == nil && res.Results[i].StatusCode.IsGood() {
+			continue
+		}
+		if err := ch.recreateSubscription(ctx, s, ids[i]); err != nil {
+			if ch.channelLost() {
+				return err
+			}
+			// the subscription may have been created before its monitored items failed.
+			id := s.ID()
+			ch.removeSubscription(id)
+			s.close(err)
+			if id != ids[i] {
+				ch.DeleteSubscriptions(ctx, &ua.DeleteSubscriptionsRequest{SubscriptionIDs: []uint32{id}})
+			}
+		}
+	}
+	return nil
+}
+
+// recreateSubscription creates the subscription and its monitored items on the new session, using the
+// parameters and client handles of the original. Returns BadSubscriptionIDInvalid if the subscription
+// was deleted, or the client was closed, while the subscription was created.
+func (ch *Client) recreateSubscription(ctx context.Context, s *Subscription, id uint32) error {
+	s.Lock()
+	req := &ua.CreateSubscriptionRequest{
+		RequestedPublishingInterval: s.publishingInterval,
+		RequestedMaxKeepAliveCount:  s.maxKeepAliveCount,
+		RequestedLifetimeCount:      s.maxKeepAliveCount * 3,
+		PublishingEnabled:           true,
+	}
+	s.Unlock()
+	res, err := ch.CreateSubscription(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	s.id = res.SubscriptionID
+	s.publishingInterval = res.RevisedPublishingInterval
+	s.maxKeepAliveCount = res.RevisedMaxKeepAliveCount
+	s.lastSequenceNumber = 0
+	handles := make([]uint32, 0, len(s.items))
+	items := make([]ua.MonitoredItemCreateRequest, 0, len(s.items))
+	for handle, item := range s.items {
+		handles = append(handles, handle)
+		items = append(items, item.createRequest(handle))
+	}
+	s.Unlock()
+
+	ch.subscriptionsLock.Lock()
+	if _, ok := ch.subscriptions[id]; !ok {
+		ch.subscriptionsLock.Unlock()
+		return ua.BadSubscriptionIDInvalid
+	}
+	delete(ch.subscriptions, id)
+	ch.subscriptions[res.SubscriptionID] = s
+	ch.subscriptionsLock.Unlock()
+
+	if len(items) == 0 {
+		return nil
+	}
+	res2, err := ch.CreateMonitoredItems(ctx, &ua.CreateMonitoredItemsRequest{
+		SubscriptionID:     res.SubscriptionID,
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+		ItemsToCreate:      items,
+	})
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	for i, result := range res2.Results {
+		if result.StatusCode.IsBad() {
+			if item, ok := s.items[handles[i]]; ok {
+				delete(s.items, handles[i])
+				close(item.values)
+			}
+		}
+	}
+	return nil
+}
+
+// channelLost returns true if the current secure channel of the client was lost.
+func (ch *Client) channelLost() bool {
+	select {
+	case <-ch.secureChannel().cancellation:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,339 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/awcullen/opcua/ua"
+)
+
+const (
+	// subscribeMaxKeepAliveCount is the MaxKeepAliveCount of the subscriptions created by Subscribe.
+	subscribeMaxKeepAliveCount = 10
+	// subscribeLifetimeCount is the LifetimeCount of the subscriptions created by Subscribe.
+	subscribeLifetimeCount = subscribeMaxKeepAliveCount * 3
+	// monitorQueueSize is the capacity of the channels returned by Monitor.
+	monitorQueueSize = 16
+	// minPublishTimeoutHint is the minimum TimeoutHint of the publish requests, in milliseconds.
+	minPublishTimeoutHint = 10000
+)
+
+// Subscription is a subscription created by Subscribe. The client sends the publish requests of the
+// subscription and delivers the data changes of each monitored item to the channel returned by Monitor.
+// The channels are closed when the subscription is deleted, or the server or the client ends it.
+type Subscription struct {
+	sync.Mutex
+	client             *Client
+	id                 uint32
+	publishingInterval float64
+	maxKeepAliveCount  uint32
+	items              map[uint32]*monitoredItem
+	nextHandle         uint32
+	lastSequenceNumber uint32
+	closed             bool
+	err                error
+}
+
+// monitoredItem is a monitored item created by Monitor. The item is kept to recreate it on a new session.
+type monitoredItem struct {
+	itemToMonitor ua.ReadValueID
+	values        chan ua.DataValue
+}
+
+// Subscribe creates a subscription that publishes with the given interval. Use Monitor to receive the
+// data changes of nodes. Publish requests are sent by the client until the subscription is deleted.
+// While the client has subscriptions created by Subscribe, it owns the publish requests of the session.
+// Do not call Publish, nor use subscriptions created by CreateSubscription on the same client, as the
+// server may answer their publish requests with the notifications of the other.
+func (ch *Client) Subscribe(ctx context.Context, interval time.Duration) (*Subscription, error) {
+	res, err := ch.CreateSubscription(ctx, &ua.CreateSubscriptionRequest{
+		RequestedPublishingInterval: float64(interval) / float64(time.Millisecond),
+		RequestedMaxKeepAliveCount:  subscribeMaxKeepAliveCount,
+		RequestedLifetimeCount:      subscribeLifetimeCount,
+		PublishingEnabled:           true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s := &Subscription{
+		client:             ch,
+		id:                 res.SubscriptionID,
+		publishingInterval: res.RevisedPublishingInterval,
+		maxKeepAliveCount:  res.RevisedMaxKeepAliveCount,
+		items:              make(map[uint32]*monitoredItem),
+	}
+	ch.subscriptionsLock.Lock()
+	defer ch.subscriptionsLock.Unlock()
+	if ch.subscriptions == nil {
+		ch.subscriptions = make(map[uint32]*Subscription)
+	}
+	ch.subscriptions[s.id] = s
+	if !ch.publishing {
+		ch.publishing = true
+		go ch.publish()
+	}
+	return s, nil
+}
+
+// ID gets the SubscriptionID assigned by the server. The id changes if the client reconnects
+// and the subscription is recreated on a new session.
+func (s *Subscription) ID() uint32 {
+	s.Lock()
+	defer s.Unlock()
+	return s.id
+}
+
+// Err gets the status that ended the subscription, or nil if the subscription is active or was deleted.
+func (s *Subscription) Err() error {
+	s.Lock()
+	defer s.Unlock()
+	return s.err
+}
+
+// Monitor creates a monitored item of the attribute of the node and returns a channel of its data changes.
+// The item is sampled at the publishing interval of the subscription. If the receiver falls behind, the
+// oldest data changes are dropped.
+func (s *Subscription) Monitor(ctx context.Context, nodeID ua.NodeID, attributeID uint32) (<-chan ua.DataValue, error) {
+	s.Lock()
+	if s.closed {
+		s.Unlock()
+		return nil, ua.BadSubscriptionIDInvalid
+	}
+	s.nextHandle++
+	handle := s.nextHandle
+	item := &monitoredItem{
+		itemToMonitor: ua.ReadValueID{NodeID: nodeID, AttributeID: attributeID},
+		values:        make(chan ua.DataValue, monitorQueueSize),
+	}
+	s.items[handle] = item
+	id := s.id
+	s.Unlock()
+
+	res, err := s.client.CreateMonitoredItems(ctx, &ua.CreateMonitoredItemsRequest{
+		SubscriptionID:     id,
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+		ItemsToCreate:      []ua.MonitoredItemCreateRequest{item.createRequest(handle)},
+	})
+	if err == nil && res.Results[0].StatusCode.IsBad() {
+		err = res.Results[0].StatusCode
+	}
+	if err != nil {
+		s.Lock()
+		if item, ok := s.items[handle]; ok {
+			delete(s.items, handle)
+			close(item.values)
+		}
+		s.Unlock()
+		return nil, err
+	}
+	return item.values, nil
+}
+
+// createRequest returns the request to create the monitored item with the client handle.
+func (item *monitoredItem) createRequest(handle uint32) ua.MonitoredItemCreateRequest {
+	return ua.MonitoredItemCreateRequest{
+		ItemToMonitor:  item.itemToMonitor,
+		MonitoringMode: ua.MonitoringModeReporting,
+		RequestedParameters: ua.MonitoringParameters{
+			ClientHandle: handle, SamplingInterval: -1, QueueSize: 1, DiscardOldest: true,
+		},
+	}
+}
+
+// Delete deletes the subscription and closes the channels of its monitored items.
+func (s *Subscription) Delete(ctx context.Context) error {
+	id := s.ID()
+	s.client.removeSubscription(id)
+	s.close(nil)
+	res, err := s.client.DeleteSubscriptions(ctx, &ua.DeleteSubscriptionsRequest{SubscriptionIDs: []uint32{id}})
+	if err != nil {
+		return err
+	}
+	if res.Results[0].IsBad() {
+		return res.Results[0]
+	}
+	return nil
+}
+
+// deliver sends the value to the channel of the monitored item. If the channel is full, the oldest
+// value is dropped, so a slow receiver does not stall the other subscriptions of the client.
+func (s *Subscription) deliver(item ua.MonitoredItemNotification) {
+	s.Lock()
+	defer s.Unlock()
+	mi, ok := s.items[item.ClientHandle]
+	if !ok {
+		return
+	}
+	for {
+		select {
+		case mi.values <- item.Value:
+			return
+		default:
+		}
+		select {
+		case <-mi.values:
+		default:
+		}
+	}
+}
+
+// close closes the channels of the monitored items, and sets the status that ended the subscription.
+func (s *Subscription) close(err error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.err = err
+	for handle, item := range s.items {
+		delete(s.items, handle)
+		close(item.values)
+	}
+}
+
+// removeSubscription stops publishing the subscription.
+func (ch *Client) removeSubscription(id uint32) (*Subscription, bool) {
+	ch.subscriptionsLock.Lock()
+	defer ch.subscriptionsLock.Unlock()
+	s, ok := ch.subscriptions[id]
+	delete(ch.subscriptions, id)
+	return s, ok
+}
+
+// publish sends publish requests while the client has subscriptions, and delivers the notifications
+// of each response to the subscription. A publish request acknowledges the notification message of
+// the previous response, once it was delivered. Keep-alive messages carry no notifications and are not
+// acknowledged.
+func (ch *Client) publish() {
+	acks := []ua.SubscriptionAcknowledgement{}
+	for {
+		ch.subscriptionsLock.Lock()
+		if len(ch.subscriptions) == 0 {
+			ch.publishing = false
+			ch.subscriptionsLock.Unlock()
+			return
+		}
+		// the server holds a publish request until the keep-alive of the slowest subscription.
+		timeoutHint := float64(minPublishTimeoutHint)
+		ids := make([]uint32, 0, len(ch.subscriptions))
+		for id, s := range ch.subscriptions {
+			if t := 2 * s.publishingInterval * float64(s.maxKeepAliveCount+1); t > timeoutHint {
+				timeoutHint = t
+			}
+			ids = append(ids, id)
+		}
+		// the messages resent by Republish are acknowledged with the next request.
+		acks = append(acks, ch.republishedAcks...)
+		ch.republishedAcks = nil
+		ch.subscriptionsLock.Unlock()
+
+		channel := ch.secureChannel()
+		res, err := ch.Publish(context.Background(), &ua.PublishRequest{
+			RequestHeader:                ua.RequestHeader{TimeoutHint: uint32(timeoutHint)},
+			SubscriptionAcknowledgements: acks,
+		})
+		if err != nil {
+			switch err {
+			case ua.BadTimeout, ua.BadRequestTimeout:
+				continue
+			case ua.BadTooManyPublishRequests:
+				// wait for a publish request to return.
+				time.Sleep(100 * time.Millisecond)
+				continue
+			case ua.BadNoSubscription:
+				// the subscriptions of the request were deleted, or the server ended them. The loop
+				// stops when the last subscription is removed.
+				for _, id := range ids {
+					if s, ok := ch.removeSubscription(id); ok {
+						s.close(err)
+					}
+				}
+				time.Sleep(100 * time.Millisecond)
+				continue
+			default:
+				// if the secure channel was lost, continue when the client has reconnected.
+				if ch.autoReconnect && ch.waitReconnect(channel) {
+					acks = []ua.SubscriptionAcknowledgement{}
+					continue
+				}
+				ch.closeSubscriptions(err)
+				return
+			}
+		}
+		acks = []ua.SubscriptionAcknowledgement{}
+		if len(res.NotificationMessage.NotificationData) == 0 {
+			continue
+		}
+		ch.subscriptionsLock.Lock()
+		s, ok := ch.subscriptions[res.SubscriptionID]
+		ch.subscriptionsLock.Unlock()
+		if !ok {
+			continue
+		}
+		// a gap in the sequence numbers is a message sent in the response to a publish request that was lost.
+		ch.republish(context.Background(), s, res.NotificationMessage.SequenceNumber)
+		ch.handleNotificationMessage(s, res.NotificationMessage)
+		acks = append(acks, ua.SubscriptionAcknowledgement{SubscriptionID: res.SubscriptionID, SequenceNumber: res.NotificationMessage.SequenceNumber})
+	}
+}
+
+// handleNotificationMessage delivers the notifications of the message to the subscription.
+func (ch *Client) handleNotificationMessage(s *Subscription, msg ua.NotificationMessage) {
+	s.Lock()
+	if msg.SequenceNumber > s.lastSequenceNumber {
+		s.lastSequenceNumber = msg.SequenceNumber
+	}
+	s.Unlock()
+	for _, data := range msg.NotificationData {
+		switch body := data.(type) {
+		case ua.DataChangeNotification:
+			for _, item := range body.MonitoredItems {
+				s.deliver(item)
+			}
+		case ua.StatusChangeNotification:
+			// the subscription timed out, or was transferred to another session.
+			ch.removeSubscription(s.ID())
+			s.close(body.Status)
+		}
+	}
+}
+
+// republish requests the server to resend the notification messages of the subscription that follow
+// the last message received, up to the sequence number until. If until is 0, the messages are resent
+// until the server has no more. The resent messages are acknowledged by the next publish request.
+func (ch *Client) republish(ctx context.Context, s *Subscription, until uint32) {
+	s.Lock()
+	id, seq := s.id, s.lastSequenceNumber
+	s.Unlock()
+	for seq++; until == 0 || seq < until; seq++ {
+		res, err := ch.Republish(ctx, &ua.RepublishRequest{SubscriptionID: id, RetransmitSequenceNumber: seq})
+		if err != nil {
+			if until == 0 {
+				return
+			}
+			// the message was acknowledged, or discarded by the server.
+			continue
+		}
+		ch.handleNotificationMessage(s, res.NotificationMessage)
+		ch.subscriptionsLock.Lock()
+		ch.republishedAcks = append(ch.republishedAcks, ua.SubscriptionAcknowledgement{SubscriptionID: id, SequenceNumber: seq})
+		ch.subscriptionsLock.Unlock()
+	}
+}
+
+// closeSubscriptions ends all subscriptions of the client with the status.
+func (ch *Client) closeSubscriptions(err error) {
+	ch.subscriptionsLock.Lock()
+	subs := ch.subscriptions
+	ch.subscriptions = nil
+	ch.republishedAcks = nil
+	ch.publishing = false
+	ch.subscriptionsLock.Unlock()
+	for _, s := range subs {
+		s.close(err)
+	}
+}
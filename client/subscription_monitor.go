@@ -0,0 +1,114 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package client
+
+import (
+	"sync"
+	"time"
+
+	"github.com/awcullen/opcua/ua"
+)
+
+const (
+	// defaultStaleFactor is the default multiple of the keep-alive period to wait for a publish response.
+	defaultStaleFactor = 1.5
+)
+
+// StaleFunc is called when a subscription has not delivered a notification message or a
+// keep-alive message within the expected period.
+type StaleFunc func(subscriptionID uint32)
+
+// subscriptionMonitor tracks the publish responses of the subscriptions of the client and calls
+// the StaleFunc when a subscription falls silent.
+type subscriptionMonitor struct {
+	sync.Mutex
+	onStale StaleFunc
+	factor  float64
+	timers  map[uint32]*subscriptionTimer
+}
+
+// subscriptionTimer fires when the subscription's keep-alive period has passed without a publish response.
+type subscriptionTimer struct {
+	period time.Duration
+	timer  *time.Timer
+}
+
+func newSubscriptionMonitor(onStale StaleFunc, factor float64) *subscriptionMonitor {
+	if factor <= 1 {
+		factor = defaultStaleFactor
+	}
+	return &subscriptionMonitor{
+		onStale: onStale,
+		factor:  factor,
+		timers:  make(map[uint32]*subscriptionTimer),
+	}
+}
+
+// watch starts or restarts the timer of the subscription. The server sends a keep-alive message
+// after maxKeepAliveCount publishing intervals without notifications. One publishing interval is
+// added to allow for the cycle in progress.
+func (m *subscriptionMonitor) watch(subscriptionID uint32, publishingInterval float64, maxKeepAliveCount uint32) {
+	period := time.Duration(publishingInterval*float64(maxKeepAliveCount+1)*m.factor) * time.Millisecond
+	m.Lock()
+	defer m.Unlock()
+	if t, ok := m.timers[subscriptionID]; ok {
+		t.period = period
+		t.timer.Reset(period)
+		return
+	}
+	m.timers[subscriptionID] = &subscriptionTimer{
+		period: period,
+		timer:  time.AfterFunc(period, func() { m.onStale(subscriptionID) }),
+	}
+}
+
+// received restarts the timer of the subscription.
+func (m *subscriptionMonitor) received(subscriptionID uint32) {
+	m.Lock()
+	defer m.Unlock()
+	if t, ok := m.timers[subscriptionID]; ok {
+		t.timer.Reset(t.period)
+	}
+}
+
+// unwatch stops the timer of the subscription.
+func (m *subscriptionMonitor) unwatch(subscriptionID uint32) {
+	m.Lock()
+	defer m.Unlock()
+	if t, ok := m.timers[subscriptionID]; ok {
+		t.timer.Stop()
+		delete(m.timers, subscriptionID)
+	}
+}
+
+// stop stops the timers of all subscriptions.
+func (m *subscriptionMonitor) stop() {
+	m.Lock()
+	defer m.Unlock()
+	for id, t := range m.timers {
+		t.timer.Stop()
+		delete(m.timers, id)
+	}
+}
+
+// update tracks the subscriptions created, modified or deleted by the request.
+func (m *subscriptionMonitor) update(req ua.ServiceRequest, res ua.ServiceResponse) {
+	switch res := res.(type) {
+	case *ua.CreateSubscriptionResponse:
+		m.watch(res.SubscriptionID, res.RevisedPublishingInterval, res.RevisedMaxKeepAliveCount)
+	case *ua.ModifySubscriptionResponse:
+		if req, ok := req.(*ua.ModifySubscriptionRequest); ok {
+			m.watch(req.SubscriptionID, res.RevisedPublishingInterval, res.RevisedMaxKeepAliveCount)
+		}
+	case *ua.PublishResponse:
+		m.received(res.SubscriptionID)
+	case *ua.DeleteSubscriptionsResponse:
+		if req, ok := req.(*ua.DeleteSubscriptionsRequest); ok {
+			for i, id := range req.SubscriptionIDs {
+				if i < len(res.Results) && res.Results[i].IsGood() {
+					m.unwatch(id)
+				}
+			}
+		}
+	}
+}
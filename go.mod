@@ -1,6 +1,6 @@
 module github.com/awcullen/opcua
 
-go 1.19
+go 1.21
 
 require (
 	github.com/djherbis/buffer v1.2.0
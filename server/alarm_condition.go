@@ -0,0 +1,421 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/awcullen/opcua/ua"
+	"github.com/google/uuid"
+)
+
+// AlarmCondition is an instance of the AlarmConditionType. The condition keeps the EnabledState,
+// ActiveState, AckedState and ConfirmedState of an alarm of the source node, and reports each change
+// of state as an AlarmCondition event of the source. The last event is retained while the alarm is
+// active, unacknowledged or unconfirmed, so ConditionRefresh reports the alarm to late subscribers.
+// Clients call the Acknowledge, Confirm, Enable and Disable methods of the condition, or the methods
+// of the AlarmConditionType with the NodeID of the condition as ObjectID.
+type AlarmCondition struct {
+	sync.Mutex
+	nm             *NamespaceManager
+	node           *ObjectNode
+	source         *ObjectNode
+	name           string
+	severity       uint16
+	message        ua.LocalizedText
+	enabled        bool
+	active         bool
+	acked          bool
+	confirmed      bool
+	eventID        ua.ByteString
+	enabledState   twoStateVariable
+	activeState    twoStateVariable
+	ackedState     twoStateVariable
+	confirmedState twoStateVariable
+	severityNode   *VariableNode
+	messageNode    *VariableNode
+	retainNode     *VariableNode
+}
+
+// twoStateVariable is a variable of the TwoStateVariableType, with the names of the true and false states.
+type twoStateVariable struct {
+	state     *VariableNode
+	id        *VariableNode
+	trueName  string
+	falseName string
+}
+
+// set sets the value of the state and the Id property.
+func (v twoStateVariable) set(value bool, t time.Time) {
+	name := v.falseName
+	if value {
+		name = v.trueName
+	}
+	v.state.SetValue(ua.NewDataValue(ua.NewLocalizedText(name, "en"), 0, t, 0, t, 0))
+	v.id.SetValue(ua.NewDataValue(value, 0, t, 0, t, 0))
+}
+
+// acknowledgeArguments are the InputArguments of the Acknowledge and Confirm methods.
+var acknowledgeArguments = []ua.ExtensionObject{
+	ua.Argument{Name: "EventId", DataType: ua.DataTypeIDByteString, ValueRank: ua.ValueRankScalar, ArrayDimensions: []uint32{}},
+	ua.Argument{Name: "Comment", DataType: ua.DataTypeIDLocalizedText, ValueRank: ua.ValueRankScalar, ArrayDimensions: []uint32{}},
+}
+
+// AddAlarmCondition adds an alarm of the source node with the given NodeID, BrowseName and severity.
+// The Name of the BrowseName is the ConditionName of the events.
+// The condition node is linked to the source with a HasCondition reference, and has the
+// ConditionName, Message, Severity and Retain properties, the EnabledState, ActiveState,
+// AckedState and ConfirmedState variables, and the Enable, Disable, Acknowledge and Confirm methods.
+// The alarm starts enabled, inactive, acknowledged and confirmed. The source should be an event
+// notifier, or have a HasEventSource or HasNotifier reference to one.
+func (m *NamespaceManager) AddAlarmCondition(source *ObjectNode, nodeID ua.NodeID, browseName ua.QualifiedName, severity uint16) (*AlarmCondition, error) {
+	name := browseName.Name
+	node := NewObjectNode(
+		nodeID,
+		browseName,
+		ua.NewLocalizedText(name, ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.ObjectTypeIDAlarmConditionType)),
+			ua.NewReference(ua.ReferenceTypeIDHasCondition, true, ua.NewExpandedNodeID(source.NodeID())),
+		},
+		ua.EventNotifierNone,
+	)
+	a := &AlarmCondition{
+		nm:        m,
+		node:      node,
+		source:    source,
+		name:      name,
+		severity:  severity,
+		enabled:   true,
+		acked:     true,
+		confirmed: true,
+	}
+	b := alarmNodeBuilder{nodes: []Node{node}}
+	now := time.Now()
+	b.property(node, "ConditionName", ua.DataTypeIDString, name, now)
+	a.messageNode = b.property(node, "Message", ua.DataTypeIDLocalizedText, ua.LocalizedText{}, now)
+	a.severityNode = b.property(node, "Severity", ua.DataTypeIDUInt16, severity, now)
+	a.retainNode = b.property(node, "Retain", ua.DataTypeIDBoolean, false, now)
+	a.enabledState = b.twoStateVariable(node, "EnabledState", "Enabled", "Disabled", true, now)
+	a.activeState = b.twoStateVariable(node, "ActiveState", "Active", "Inactive", false, now)
+	a.ackedState = b.twoStateVariable(node, "AckedState", "Acknowledged", "Unacknowledged", true, now)
+	a.confirmedState = b.twoStateVariable(node, "ConfirmedState", "Confirmed", "Unconfirmed", true, now)
+	b.method(node, "Enable", nil, a.handleEnable)
+	b.method(node, "Disable", nil, a.handleDisable)
+	b.method(node, "Acknowledge", acknowledgeArguments, a.handleAcknowledge)
+	b.method(node, "Confirm", acknowledgeArguments, a.handleConfirm)
+	if b.err != nil {
+		return nil, b.err
+	}
+	if err := m.AddNodes(b.nodes...); err != nil {
+		return nil, err
+	}
+	m.conditionsLock.Lock()
+	m.alarms[nodeID] = a
+	m.conditionsLock.Unlock()
+	return a, nil
+}
+
+// FindAlarmCondition returns the alarm with the given NodeID.
+func (m *NamespaceManager) FindAlarmCondition(id ua.NodeID) (*AlarmCondition, bool) {
+	m.conditionsLock.Lock()
+	defer m.conditionsLock.Unlock()
+	a, ok := m.alarms[id]
+	return a, ok
+}
+
+// deleteAlarmConditions forgets the alarms of the deleted nodes, and their retained events.
+func (m *NamespaceManager) deleteAlarmConditions(deleted map[ua.NodeID]struct{}) {
+	m.conditionsLock.Lock()
+	defer m.conditionsLock.Unlock()
+	for id := range deleted {
+		if _, ok := m.alarms[id]; !ok {
+			continue
+		}
+		delete(m.alarms, id)
+		for key := range m.conditions {
+			if key.conditionID == id {
+				delete(m.conditions, key)
+			}
+		}
+	}
+}
+
+// alarmNodeBuilder creates the child nodes of an alarm, so they are added with the condition at once.
+type alarmNodeBuilder struct {
+	nodes []Node
+	err   error
+}
+
+// property creates a readable property of the parent.
+func (b *alarmNodeBuilder) property(parent Node, name string, dataType ua.NodeID, value ua.Variant, t time.Time) *VariableNode {
+	return b.variable(parent, name, ua.ReferenceTypeIDHasProperty, ua.VariableTypeIDPropertyType, dataType, value, t)
+}
+
+// twoStateVariable creates a variable of the TwoStateVariableType with its Id property.
+func (b *alarmNodeBuilder) twoStateVariable(parent Node, name, trueName, falseName string, value bool, t time.Time) twoStateVariable {
+	v := twoStateVariable{trueName: trueName, falseName: falseName}
+	text := falseName
+	if value {
+		text = trueName
+	}
+	v.state = b.variable(parent, name, ua.ReferenceTypeIDHasComponent, ua.VariableTypeIDTwoStateVariableType, ua.DataTypeIDLocalizedText, ua.NewLocalizedText(text, "en"), t)
+	if v.state != nil {
+		v.id = b.property(v.state, "Id", ua.DataTypeIDBoolean, value, t)
+	}
+	return v
+}
+
+// variable creates a readable variable of the parent.
+func (b *alarmNodeBuilder) variable(parent Node, name string, refType, typeDefinition, dataType ua.NodeID, value ua.Variant, t time.Time) *VariableNode {
+	id, err := childNodeID(parent, name)
+	if err != nil {
+		b.err = err
+		return nil
+	}
+	valueRank, arrayDimensions := ua.ValueRankScalar, []uint32{}
+	if _, ok := value.([]ua.ExtensionObject); ok {
+		valueRank, arrayDimensions = ua.ValueRankOneDimension, []uint32{0}
+	}
+	n := NewVariableNode(
+		id,
+		ua.NewQualifiedName(0, name),
+		ua.NewLocalizedText(name, ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(typeDefinition)),
+			ua.NewReference(refType, true, ua.NewExpandedNodeID(parent.NodeID())),
+		},
+		ua.NewDataValue(value, 0, t, 0, t, 0),
+		dataType,
+		valueRank,
+		arrayDimensions,
+		ua.AccessLevelsCurrentRead,
+		0,
+		false,
+		nil,
+	)
+	b.nodes = append(b.nodes, n)
+	return n
+}
+
+// method creates an executable method of the parent, with the given InputArguments.
+func (b *alarmNodeBuilder) method(parent Node, name string, args []ua.ExtensionObject, handler func(context.Context, ua.CallMethodRequest) ua.CallMethodResult) {
+	id, err := childNodeID(parent, name)
+	if err != nil {
+		b.err = err
+		return
+	}
+	n := NewMethodNode(
+		id,
+		ua.NewQualifiedName(0, name),
+		ua.NewLocalizedText(name, ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			ua.NewReference(ua.ReferenceTypeIDHasComponent, true, ua.NewExpandedNodeID(parent.NodeID())),
+		},
+		true,
+	)
+	n.SetCallMethodHandler(handler)
+	b.nodes = append(b.nodes, n)
+	if args != nil {
+		b.property(n, "InputArguments", ua.DataTypeIDArgument, args, time.Now())
+	}
+}
+
+// Node returns the condition node.
+func (a *AlarmCondition) Node() *ObjectNode {
+	return a.node
+}
+
+// EventID returns the EventId of the last event of the alarm.
+func (a *AlarmCondition) EventID() ua.ByteString {
+	a.Lock()
+	defer a.Unlock()
+	return a.eventID
+}
+
+// Retain returns true if the alarm is enabled, and is active, unacknowledged or unconfirmed.
+func (a *AlarmCondition) Retain() bool {
+	a.Lock()
+	defer a.Unlock()
+	return a.retain()
+}
+
+func (a *AlarmCondition) retain() bool {
+	return a.enabled && (a.active || !a.acked || !a.confirmed)
+}
+
+// Activate sets the alarm active, unacknowledged and unconfirmed, and reports the event with the given message.
+// Activating an active alarm has no effect. A disabled alarm changes state, but reports no events.
+func (a *AlarmCondition) Activate(message ua.LocalizedText) error {
+	a.Lock()
+	defer a.Unlock()
+	if a.active {
+		return nil
+	}
+	a.active, a.acked, a.confirmed = true, false, false
+	a.message = message
+	a.update()
+	return nil
+}
+
+// Deactivate sets the alarm inactive, and reports the event with the given message. The alarm is
+// retained until it is acknowledged and confirmed. Deactivating an inactive alarm has no effect.
+func (a *AlarmCondition) Deactivate(message ua.LocalizedText) error {
+	a.Lock()
+	defer a.Unlock()
+	if !a.active {
+		return nil
+	}
+	a.active = false
+	a.message = message
+	a.update()
+	return nil
+}
+
+// Acknowledge acknowledges the event of the alarm with the given EventId. The comment is not recorded. Returns BadEventIDUnknown
+// if the event is not the last event of the alarm, BadConditionBranchAlreadyAcked if the alarm is
+// acknowledged, or BadConditionDisabled if the alarm is disabled.
+func (a *AlarmCondition) Acknowledge(eventID ua.ByteString, comment ua.LocalizedText) error {
+	a.Lock()
+	defer a.Unlock()
+	if !a.enabled {
+		return ua.BadConditionDisabled
+	}
+	if eventID != a.eventID {
+		return ua.BadEventIDUnknown
+	}
+	if a.acked {
+		return ua.BadConditionBranchAlreadyAcked
+	}
+	a.acked = true
+	a.update()
+	return nil
+}
+
+// Confirm confirms the event of the alarm with the given EventId. The comment is not recorded. Returns BadEventIDUnknown
+// if the event is not the last event of the alarm, BadConditionBranchAlreadyConfirmed if the alarm is
+// confirmed, or BadConditionDisabled if the alarm is disabled.
+func (a *AlarmCondition) Confirm(eventID ua.ByteString, comment ua.LocalizedText) error {
+	a.Lock()
+	defer a.Unlock()
+	if !a.enabled {
+		return ua.BadConditionDisabled
+	}
+	if eventID != a.eventID {
+		return ua.BadEventIDUnknown
+	}
+	if a.confirmed {
+		return ua.BadConditionBranchAlreadyConfirmed
+	}
+	a.confirmed = true
+	a.update()
+	return nil
+}
+
+// Enable enables the alarm, and reports the current state. Returns BadConditionAlreadyEnabled if the alarm is enabled.
+func (a *AlarmCondition) Enable() error {
+	a.Lock()
+	defer a.Unlock()
+	if a.enabled {
+		return ua.BadConditionAlreadyEnabled
+	}
+	a.enabled = true
+	a.update()
+	return nil
+}
+
+// Disable disables the alarm. The last event is reported with Retain false, then no events are
+// reported until the alarm is enabled. Returns BadConditionAlreadyDisabled if the alarm is disabled.
+func (a *AlarmCondition) Disable() error {
+	a.Lock()
+	defer a.Unlock()
+	if !a.enabled {
+		return ua.BadConditionAlreadyDisabled
+	}
+	a.enabled = false
+	a.update()
+	a.raise()
+	return nil
+}
+
+// update sets the variables of the condition to the state of the alarm, and reports the event if the alarm is enabled.
+func (a *AlarmCondition) update() {
+	now := time.Now()
+	a.enabledState.set(a.enabled, now)
+	a.activeState.set(a.active, now)
+	a.ackedState.set(a.acked, now)
+	a.confirmedState.set(a.confirmed, now)
+	a.severityNode.SetValue(ua.NewDataValue(a.severity, 0, now, 0, now, 0))
+	a.messageNode.SetValue(ua.NewDataValue(a.message, 0, now, 0, now, 0))
+	a.retainNode.SetValue(ua.NewDataValue(a.retain(), 0, now, 0, now, 0))
+	if a.enabled {
+		a.raise()
+	}
+}
+
+// raise reports the state of the alarm as an event of the source.
+func (a *AlarmCondition) raise() {
+	id := uuid.New()
+	a.eventID = ua.ByteString(id[:])
+	now := time.Now()
+	a.nm.OnEvent(a.source, &ua.AlarmCondition{
+		EventID:        a.eventID,
+		EventType:      ua.ObjectTypeIDAlarmConditionType,
+		SourceNode:     a.source.NodeID(),
+		SourceName:     a.source.BrowseName().Name,
+		Time:           now,
+		ReceiveTime:    now,
+		Message:        a.message,
+		Severity:       a.severity,
+		ConditionID:    a.node.NodeID(),
+		ConditionName:  a.name,
+		Retain:         a.retain(),
+		AckedState:     a.acked,
+		ConfirmedState: a.confirmed,
+		ActiveState:    a.active,
+	})
+}
+
+// handleEnable handles calls of the Enable method.
+func (a *AlarmCondition) handleEnable(ctx context.Context, req ua.CallMethodRequest) ua.CallMethodResult {
+	return alarmCallResult(a.Enable())
+}
+
+// handleDisable handles calls of the Disable method.
+func (a *AlarmCondition) handleDisable(ctx context.Context, req ua.CallMethodRequest) ua.CallMethodResult {
+	return alarmCallResult(a.Disable())
+}
+
+// handleAcknowledge handles calls of the Acknowledge method. The InputArguments are checked by the server.
+func (a *AlarmCondition) handleAcknowledge(ctx context.Context, req ua.CallMethodRequest) ua.CallMethodResult {
+	eventID, _ := req.InputArguments[0].(ua.ByteString)
+	comment, _ := req.InputArguments[1].(ua.LocalizedText)
+	return alarmCallResult(a.Acknowledge(eventID, comment))
+}
+
+// handleConfirm handles calls of the Confirm method. The InputArguments are checked by the server.
+func (a *AlarmCondition) handleConfirm(ctx context.Context, req ua.CallMethodRequest) ua.CallMethodResult {
+	eventID, _ := req.InputArguments[0].(ua.ByteString)
+	comment, _ := req.InputArguments[1].(ua.LocalizedText)
+	return alarmCallResult(a.Confirm(eventID, comment))
+}
+
+// alarmCallResult returns the result of a method call of an alarm.
+func alarmCallResult(err error) ua.CallMethodResult {
+	if err != nil {
+		code, ok := err.(ua.StatusCode)
+		if !ok {
+			code = ua.BadInternalError
+		}
+		return ua.CallMethodResult{StatusCode: code}
+	}
+	return ua.CallMethodResult{OutputArguments: []ua.Variant{}}
+}
@@ -0,0 +1,164 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/awcullen/opcua/ua"
+	"github.com/google/uuid"
+)
+
+const (
+	auditSeverityGood = 100
+	auditSeverityBad  = 500
+)
+
+// auditRoles are the roles that may receive audit events.
+var auditRoles = []ua.NodeID{
+	ua.ObjectIDWellKnownRoleSecurityAdmin,
+}
+
+// actionTimeStampKey is the context key of the timestamp of the request that caused an audited action.
+type actionTimeStampKey struct{}
+
+// Auditing returns whether the server raises audit events.
+func (srv *Server) Auditing() bool {
+	return srv.auditing
+}
+
+// raiseAuditEvent reports the audit event from the Server object, if auditing is enabled. Only the
+// subscriptions of users with one of the auditRoles receive the event.
+func (srv *Server) raiseAuditEvent(evt ua.Event) {
+	if !srv.auditing {
+		return
+	}
+	nm := srv.NamespaceManager()
+	if n, ok := nm.FindObject(ua.ObjectIDServer); ok {
+		nm.OnEvent(n, evt)
+	}
+}
+
+// isAuditVisible returns false if the event is an audit event, and the user of the session does not have
+// one of the auditRoles.
+func (srv *Server) isAuditVisible(session *Session, evt ua.Event) bool {
+	eventType, ok := evt.GetAttribute(ua.BaseEventSelectClauses[1]).(ua.NodeID)
+	if !ok || (eventType != ua.ObjectTypeIDAuditEventType && !srv.NamespaceManager().IsSubtype(eventType, ua.ObjectTypeIDAuditEventType)) {
+		return true
+	}
+	if session == nil {
+		return false
+	}
+	for _, role := range session.UserRoles() {
+		for _, r := range auditRoles {
+			if role == r {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// auditActivateSession raises an AuditActivateSessionEvent for the activation of the session with
+// the user identity. The status is Good, or the reason the activation was rejected.
+func (srv *Server) auditActivateSession(session *Session, req *ua.ActivateSessionRequest, userIdentity interface{}, status ua.StatusCode) {
+	if !srv.auditing {
+		return
+	}
+	id := uuid.New()
+	now := time.Now()
+	evt := &ua.AuditSessionEvent{
+		EventID:            ua.ByteString(id[:]),
+		EventType:          ua.ObjectTypeIDAuditActivateSessionEventType,
+		SourceNode:         session.SessionId(),
+		SourceName:         "Session/ActivateSession",
+		Time:               now,
+		ReceiveTime:        now,
+		Message:            ua.NewLocalizedText("Session activated.", ""),
+		Severity:           auditSeverityGood,
+		ActionTimeStamp:    req.Timestamp,
+		Status:             status.IsGood(),
+		ServerID:           srv.LocalDescription().ApplicationURI,
+		ClientAuditEntryID: req.AuditEntryID,
+		ClientUserID:       clientUserID(userIdentity),
+		SessionID:          session.SessionId(),
+		StatusCodeID:       status,
+	}
+	if userIdentity == nil {
+		// the request was rejected before the user identity token was read.
+		evt.ClientUserID = ""
+	}
+	if !status.IsGood() {
+		evt.Message = ua.NewLocalizedText("Session activation rejected. "+status.Error(), "")
+		evt.Severity = auditSeverityBad
+	}
+	srv.raiseAuditEvent(evt)
+}
+
+// auditedNode returns the VariableNode, if auditing is enabled and writes to the node raise audit events.
+func (srv *Server) auditedNode(ctx context.Context, nodeID ua.NodeID) (*VariableNode, bool) {
+	if !srv.auditing {
+		return nil, false
+	}
+	n, ok := srv.findNode(ctx, nodeID)
+	if !ok {
+		return nil, false
+	}
+	n1, ok := n.(*VariableNode)
+	if !ok || !n1.Audited() {
+		return nil, false
+	}
+	return n1, true
+}
+
+// auditValue returns the current value of a writable attribute of the node.
+func auditValue(n *VariableNode, attributeID uint32) ua.Variant {
+	switch attributeID {
+	case ua.AttributeIDValue:
+		return n.Value().Value
+	case ua.AttributeIDDisplayName:
+		return n.DisplayName()
+	case ua.AttributeIDDescription:
+		return n.Description()
+	case ua.AttributeIDHistorizing:
+		return n.Historizing()
+	default:
+		return nil
+	}
+}
+
+// auditWrite raises an AuditWriteUpdateEvent for the write of the attribute of the node. The
+// ActionTimeStamp is the timestamp of the request, if the context has one.
+func (srv *Server) auditWrite(ctx context.Context, n *VariableNode, writeValue ua.WriteValue, oldValue ua.Variant, status ua.StatusCode) {
+	var userID string
+	if session, ok := ctx.Value(SessionKey).(*Session); ok && session != nil {
+		userID = clientUserID(session.UserIdentity())
+	}
+	actionTimeStamp, _ := ctx.Value(actionTimeStampKey{}).(time.Time)
+	id := uuid.New()
+	now := time.Now()
+	evt := &ua.AuditWriteUpdateEvent{
+		EventID:         ua.ByteString(id[:]),
+		EventType:       ua.ObjectTypeIDAuditWriteUpdateEventType,
+		SourceNode:      n.NodeID(),
+		SourceName:      "Attribute/Write",
+		Time:            now,
+		ReceiveTime:     now,
+		Message:         ua.NewLocalizedText("Attribute written.", ""),
+		Severity:        auditSeverityGood,
+		ActionTimeStamp: actionTimeStamp,
+		Status:          status.IsGood(),
+		ServerID:        srv.LocalDescription().ApplicationURI,
+		ClientUserID:    userID,
+		AttributeID:     writeValue.AttributeID,
+		IndexRange:      writeValue.IndexRange,
+		OldValue:        oldValue,
+		NewValue:        writeValue.Value.Value,
+	}
+	if !status.IsGood() {
+		evt.Message = ua.NewLocalizedText("Attribute write rejected. "+status.Error(), "")
+		evt.Severity = auditSeverityBad
+	}
+	srv.raiseAuditEvent(evt)
+}
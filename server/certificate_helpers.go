@@ -17,7 +17,50 @@ func validateClientCertificate(certificate *x509.Certificate, trustedCertsFile s
 	if certificate == nil {
 		return false, ua.BadCertificateInvalid
 	}
-	var intermediates, roots *x509.CertPool
+	roots, intermediates := readTrustedCertificates(trustedCertsFile)
+
+	opts := x509.VerifyOptions{
+		Intermediates: intermediates,
+		Roots:         roots,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	if suppressCertificateTimeInvalid {
+		opts.CurrentTime = certificate.NotAfter // causes test to pass
+	}
+
+	if suppressCertificateChainIncomplete {
+		if opts.Roots == nil {
+			opts.Roots = x509.NewCertPool()
+		}
+		opts.Roots.AddCert(certificate)
+	}
+
+	// build chain and verify
+	if _, err := certificate.Verify(opts); err != nil {
+		switch se := err.(type) {
+		case x509.CertificateInvalidError:
+			switch se.Reason {
+			case x509.Expired:
+				return false, ua.BadCertificateTimeInvalid
+			case x509.IncompatibleUsage:
+				return false, ua.BadCertificateUseNotAllowed
+			default:
+				return false, ua.BadSecurityChecksFailed
+			}
+		case x509.UnknownAuthorityError:
+			return false, ua.BadSecurityChecksFailed
+		default:
+			return false, ua.BadSecurityChecksFailed
+		}
+	}
+	return true, nil
+}
+
+// readTrustedCertificates reads the PEM or DER encoded certificates of the file. Self-signed
+// certificates are returned as roots, the others as intermediates. A pool is nil if it has no
+// certificates.
+func readTrustedCertificates(trustedCertsFile string) (roots, intermediates *x509.CertPool) {
 	if buf, err := os.ReadFile(trustedCertsFile); err == nil {
 		for len(buf) > 0 {
 			var block *pem.Block
@@ -62,41 +105,5 @@ func validateClientCertificate(certificate *x509.Certificate, trustedCertsFile s
 			}
 		}
 	}
-
-	opts := x509.VerifyOptions{
-		Intermediates: intermediates,
-		Roots:         roots,
-		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
-	}
-
-	if suppressCertificateTimeInvalid {
-		opts.CurrentTime = certificate.NotAfter // causes test to pass
-	}
-
-	if suppressCertificateChainIncomplete {
-		if opts.Roots == nil {
-			opts.Roots = x509.NewCertPool()
-		}
-		opts.Roots.AddCert(certificate)
-	}
-
-	// build chain and verify
-	if _, err := certificate.Verify(opts); err != nil {
-		switch se := err.(type) {
-		case x509.CertificateInvalidError:
-			switch se.Reason {
-			case x509.Expired:
-				return false, ua.BadCertificateTimeInvalid
-			case x509.IncompatibleUsage:
-				return false, ua.BadCertificateUseNotAllowed
-			default:
-				return false, ua.BadSecurityChecksFailed
-			}
-		case x509.UnknownAuthorityError:
-			return false, ua.BadSecurityChecksFailed
-		default:
-			return false, ua.BadSecurityChecksFailed
-		}
-	}
-	return true, nil
+	return roots, intermediates
 }
@@ -0,0 +1,24 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package server
+
+import "math"
+
+// ChangeTolerance is the tolerance used to detect a change of a Float or Double value, when the
+// client requests no deadband. A new value is not reported if it differs from the last reported
+// value by no more than Absolute, or by no more than Relative times the larger magnitude of the
+// two values. This suppresses the jitter of noisy sensors. A deadband requested by the client
+// replaces the tolerance.
+type ChangeTolerance struct {
+	Absolute float64
+	Relative float64
+}
+
+// within returns true if the values differ by no more than the tolerance.
+func (t ChangeTolerance) within(current, previous float64) bool {
+	if current == previous {
+		return true
+	}
+	d := math.Abs(current - previous)
+	return d <= t.Absolute || d <= t.Relative*math.Max(math.Abs(current), math.Abs(previous))
+}
@@ -0,0 +1,489 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package server
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/awcullen/opcua/ua"
+)
+
+// resolveSimpleAttributeOperand resolves the browse path of the operand, starting from the event type
+// and continuing with its supertypes. The operand keeps the event type of the client, so it selects no
+// value of an event of another type. An operand that cannot be resolved returns BadNodeIDUnknown.
+func resolveSimpleAttributeOperand(m *NamespaceManager, clause ua.SimpleAttributeOperand) (ua.SimpleAttributeOperand, ua.StatusCode) {
+	if _, ok := m.FindNode(clause.TypeDefinitionID); !ok {
+		return clause, ua.BadNodeIDUnknown
+	}
+	if len(clause.BrowsePath) == 0 {
+		// the event itself, e.g. the ConditionId.
+		if clause.AttributeID == ua.AttributeIDNodeID {
+			return clause, ua.Good
+		}
+		return clause, ua.BadNodeIDUnknown
+	}
+	for t := clause.TypeDefinitionID; t != nil; t = m.FindSuperType(t) {
+		if findInstanceDeclaration(m, t, clause.BrowsePath) {
+			return clause, ua.Good
+		}
+		if t == ua.ObjectTypeIDBaseEventType {
+			break
+		}
+	}
+	return clause, ua.BadNodeIDUnknown
+}
+
+// eventAttribute returns the value of the field of the event selected by the resolved operand, or nil
+// if the event is not of the type of the operand, or a subtype. The event provides the field by the
+// type that declares it, so the field is looked up starting from the type of the operand and continuing
+// with its supertypes.
+func eventAttribute(m *NamespaceManager, evt ua.Event, op ua.SimpleAttributeOperand) ua.Variant {
+	if !(eventFilterTarget{m, evt}).ofType(op.TypeDefinitionID) {
+		return nil
+	}
+	for t := op.TypeDefinitionID; t != nil; t = m.FindSuperType(t) {
+		op.TypeDefinitionID = t
+		if v := evt.GetAttribute(op); v != nil {
+			return v
+		}
+		if t == ua.ObjectTypeIDBaseEventType {
+			break
+		}
+	}
+	return nil
+}
+
+// resolveQueryOperand resolves the browse path of the operand of a Query filter, starting from the type
+// and continuing with its supertypes. An operand with an empty browse path selects an attribute of the
+// node itself, e.g. the BrowseName. An operand that cannot be resolved returns BadNodeIDUnknown.
+func resolveQueryOperand(m *NamespaceManager, clause ua.SimpleAttributeOperand) (ua.SimpleAttributeOperand, ua.StatusCode) {
+	if _, ok := m.FindNode(clause.TypeDefinitionID); !ok {
+		return clause, ua.BadNodeIDUnknown
+	}
+	if len(clause.BrowsePath) == 0 {
+		return clause, ua.Good
+	}
+	for t := clause.TypeDefinitionID; t != nil; t = m.FindSuperType(t) {
+		if findInstanceDeclaration(m, t, clause.BrowsePath) {
+			clause.TypeDefinitionID = t
+			return clause, ua.Good
+		}
+	}
+	return clause, ua.BadNodeIDUnknown
+}
+
+// resolveWhereClause checks the operator and operands of each element of the where clause, and
+// resolves the browse path of each SimpleAttributeOperand. Returns the resolved clause, and false
+// with a result for each element if any element is invalid.
+func resolveWhereClause(m *NamespaceManager, clause ua.ContentFilter) (ua.ContentFilter, ua.ContentFilterResult, bool) {
+	return resolveContentFilter(m, clause, resolveSimpleAttributeOperand)
+}
+
+// resolveContentFilter checks the operator and operands of each element of the filter, and resolves
+// each SimpleAttributeOperand with the given func.
+func resolveContentFilter(m *NamespaceManager, clause ua.ContentFilter, resolve func(*NamespaceManager, ua.SimpleAttributeOperand) (ua.SimpleAttributeOperand, ua.StatusCode)) (ua.ContentFilter, ua.ContentFilterResult, bool) {
+	resolved := ua.ContentFilter{Elements: make([]ua.ContentFilterElement, len(clause.Elements))}
+	results := make([]ua.ContentFilterElementResult, len(clause.Elements))
+	valid := true
+	for i, element := range clause.Elements {
+		operands := make([]ua.ExtensionObject, len(element.FilterOperands))
+		copy(operands, element.FilterOperands)
+		resolved.Elements[i] = ua.ContentFilterElement{FilterOperator: element.FilterOperator, FilterOperands: operands}
+		var lo, hi int
+		switch element.FilterOperator {
+		case ua.FilterOperatorIsNull, ua.FilterOperatorNot, ua.FilterOperatorOfType:
+			lo, hi = 1, 1
+		case ua.FilterOperatorEquals, ua.FilterOperatorGreaterThan, ua.FilterOperatorLessThan,
+			ua.FilterOperatorGreaterThanOrEqual, ua.FilterOperatorLessThanOrEqual, ua.FilterOperatorLike,
+			ua.FilterOperatorAnd, ua.FilterOperatorOr:
+			lo, hi = 2, 2
+		case ua.FilterOperatorBetween:
+			lo, hi = 3, 3
+		case ua.FilterOperatorInList:
+			lo, hi = 2, len(operands)
+		case ua.FilterOperatorCast, ua.FilterOperatorInView, ua.FilterOperatorRelatedTo,
+			ua.FilterOperatorBitwiseAnd, ua.FilterOperatorBitwiseOr:
+			results[i].StatusCode = ua.BadFilterOperatorUnsupported
+			valid = false
+			continue
+		default:
+			results[i].StatusCode = ua.BadFilterOperatorInvalid
+			valid = false
+			continue
+		}
+		if len(operands) < lo || len(operands) > hi {
+			results[i].StatusCode = ua.BadFilterOperandCountMismatch
+			valid = false
+			continue
+		}
+		codes := make([]ua.StatusCode, len(operands))
+		for j, operand := range operands {
+			switch op := operand.(type) {
+			case ua.LiteralOperand:
+				if element.FilterOperator == ua.FilterOperatorOfType {
+					if _, ok := op.Value.(ua.NodeID); !ok {
+						codes[j] = ua.BadFilterOperandInvalid
+					}
+				}
+				if element.FilterOperator == ua.FilterOperatorLike && j == 1 {
+					if pattern, ok := stringValue(op.Value); ok {
+						if _, err := regexp.Compile(likeToRegexp(pattern)); err != nil {
+							codes[j] = ua.BadFilterOperandInvalid
+						}
+					}
+				}
+			case ua.SimpleAttributeOperand:
+				operands[j], codes[j] = resolve(m, op)
+			case ua.ElementOperand:
+				// an element may only refer to the elements that follow it, so the clause has no cycles.
+				if int(op.Index) <= i || int(op.Index) >= len(clause.Elements) {
+					codes[j] = ua.BadFilterOperandInvalid
+				}
+			default:
+				codes[j] = ua.BadFilterOperandInvalid
+			}
+			if element.FilterOperator == ua.FilterOperatorOfType {
+				if _, ok := operand.(ua.LiteralOperand); !ok {
+					codes[j] = ua.BadFilterOperandInvalid
+				}
+			}
+			if codes[j] != ua.Good {
+				results[i].StatusCode = ua.BadFilterOperandInvalid
+				results[i].OperandStatusCodes = codes
+				valid = false
+			}
+		}
+	}
+	if valid {
+		return resolved, ua.ContentFilterResult{}, true
+	}
+	return resolved, ua.ContentFilterResult{ElementResults: results}, false
+}
+
+// filterTarget provides the values of the operands of a where clause, e.g. the fields of an event,
+// or the attributes of a node found by the Query service.
+type filterTarget interface {
+	// attribute returns the value of the operand, or nil if the target does not have it.
+	attribute(op ua.SimpleAttributeOperand) ua.Variant
+	// ofType returns true if the target is an instance of the type, or of a subtype.
+	ofType(typeID ua.NodeID) bool
+}
+
+// eventFilterTarget is the filterTarget of an event.
+type eventFilterTarget struct {
+	m   *NamespaceManager
+	evt ua.Event
+}
+
+func (t eventFilterTarget) attribute(op ua.SimpleAttributeOperand) ua.Variant {
+	return eventAttribute(t.m, t.evt, op)
+}
+
+func (t eventFilterTarget) ofType(typeID ua.NodeID) bool {
+	if c, ok := t.evt.GetAttribute(attributeOperandEventType).(ua.NodeID); ok {
+		return c == typeID || t.m.IsSubtype(c, typeID)
+	}
+	return false
+}
+
+// evaluate returns the result of the element of the where clause at the index. The result of the
+// logical operators is true, false, or nil if the result is unknown, e.g. when comparing a field
+// that the event does not have.
+func (mi *EventMonitoredItem) evaluate(evt ua.Event, idx int) ua.Variant {
+	return evaluateFilter(mi.whereClause, idx, eventFilterTarget{mi.srv.namespaceManager, evt}, &mi.likePatterns)
+}
+
+// evaluateFilter returns the result of the element of the where clause at the index, for the target.
+// The clause must have been resolved by resolveWhereClause.
+func evaluateFilter(clause ua.ContentFilter, idx int, target filterTarget, patterns *likePatterns) ua.Variant {
+	if idx >= len(clause.Elements) {
+		return true
+	}
+	element := clause.Elements[idx]
+	operands := make([]ua.Variant, len(element.FilterOperands))
+	if element.FilterOperator != ua.FilterOperatorOfType {
+		for i, operand := range element.FilterOperands {
+			switch op := operand.(type) {
+			case ua.LiteralOperand:
+				operands[i] = op.Value
+			case ua.SimpleAttributeOperand:
+				operands[i] = target.attribute(op)
+			case ua.ElementOperand:
+				operands[i] = evaluateFilter(clause, int(op.Index), target, patterns)
+			}
+		}
+	}
+	switch element.FilterOperator {
+
+	case ua.FilterOperatorEquals:
+		if operands[0] == nil || operands[1] == nil {
+			return nil
+		}
+		return equalVariants(operands[0], operands[1])
+
+	case ua.FilterOperatorIsNull:
+		return operands[0] == nil
+
+	case ua.FilterOperatorGreaterThan:
+		if c, ok := compareVariants(operands[0], operands[1]); ok {
+			return c > 0
+		}
+		return nil
+
+	case ua.FilterOperatorLessThan:
+		if c, ok := compareVariants(operands[0], operands[1]); ok {
+			return c < 0
+		}
+		return nil
+
+	case ua.FilterOperatorGreaterThanOrEqual:
+		if c, ok := compareVariants(operands[0], operands[1]); ok {
+			return c >= 0
+		}
+		return nil
+
+	case ua.FilterOperatorLessThanOrEqual:
+		if c, ok := compareVariants(operands[0], operands[1]); ok {
+			return c <= 0
+		}
+		return nil
+
+	case ua.FilterOperatorLike:
+		s, ok1 := stringValue(operands[0])
+		pattern, ok2 := stringValue(operands[1])
+		if !ok1 || !ok2 {
+			return nil
+		}
+		re := patterns.get(pattern)
+		if re == nil {
+			return false
+		}
+		return re.MatchString(s)
+
+	case ua.FilterOperatorNot:
+		if a, ok := operands[0].(bool); ok {
+			return !a
+		}
+		return nil
+
+	case ua.FilterOperatorBetween:
+		c1, ok1 := compareVariants(operands[0], operands[1])
+		c2, ok2 := compareVariants(operands[0], operands[2])
+		if !ok1 || !ok2 {
+			return nil
+		}
+		return c1 >= 0 && c2 <= 0
+
+	case ua.FilterOperatorInList:
+		if operands[0] == nil {
+			return nil
+		}
+		for _, b := range operands[1:] {
+			if b != nil && equalVariants(operands[0], b) {
+				return true
+			}
+		}
+		return false
+
+	case ua.FilterOperatorAnd:
+		a, ok1 := operands[0].(bool)
+		b, ok2 := operands[1].(bool)
+		if (ok1 && !a) || (ok2 && !b) {
+			return false
+		}
+		if !ok1 || !ok2 {
+			return nil
+		}
+		return true
+
+	case ua.FilterOperatorOr:
+		a, ok1 := operands[0].(bool)
+		b, ok2 := operands[1].(bool)
+		if (ok1 && a) || (ok2 && b) {
+			return true
+		}
+		if !ok1 || !ok2 {
+			return nil
+		}
+		return false
+
+	case ua.FilterOperatorOfType:
+		if a, ok := element.FilterOperands[0].(ua.LiteralOperand); ok {
+			if b, ok := a.Value.(ua.NodeID); ok {
+				return target.ofType(b)
+			}
+		}
+		return false
+
+	default:
+		return nil
+	}
+}
+
+// likePatterns caches the regular expressions of the patterns of the Like operator.
+type likePatterns map[string]*regexp.Regexp
+
+// get returns the regular expression of the pattern of the Like operator, or nil if the pattern
+// is invalid.
+func (p *likePatterns) get(pattern string) *regexp.Regexp {
+	if re, ok := (*p)[pattern]; ok {
+		return re
+	}
+	re, err := regexp.Compile(likeToRegexp(pattern))
+	if err != nil {
+		re = nil
+	}
+	if *p == nil {
+		*p = make(likePatterns)
+	}
+	(*p)[pattern] = re
+	return re
+}
+
+// likeToRegexp converts the pattern of the Like operator to a regular expression. In the pattern,
+// '%' matches any string, '_' matches any single character, '[...]' matches any single character
+// in the list, '[^...]' matches any single character not in the list, and '\' escapes the next
+// character.
+func likeToRegexp(pattern string) string {
+	var b strings.Builder
+	b.WriteString(`(?s)^`)
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case '%':
+			b.WriteString(`.*`)
+		case '_':
+			b.WriteString(`.`)
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(runes[i])))
+			} else {
+				b.WriteString(`\\`)
+			}
+		case '[':
+			j := i + 1
+			if j < len(runes) && runes[j] == '^' {
+				j++
+			}
+			if j < len(runes) && runes[j] == ']' {
+				j++
+			}
+			for j < len(runes) && runes[j] != ']' {
+				j++
+			}
+			if j >= len(runes) {
+				// unterminated list matches the character itself.
+				b.WriteString(`\[`)
+				continue
+			}
+			b.WriteString(`[`)
+			k := i + 1
+			if runes[k] == '^' {
+				b.WriteString(`^`)
+				k++
+			}
+			for ; k < j; k++ {
+				if runes[k] == '-' {
+					b.WriteRune('-')
+				} else {
+					b.WriteString(regexp.QuoteMeta(string(runes[k])))
+				}
+			}
+			b.WriteString(`]`)
+			i = j
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString(`$`)
+	return b.String()
+}
+
+// equalVariants returns true if the values are equal. Numbers of different types are compared by value.
+func equalVariants(a, b ua.Variant) bool {
+	if c, ok := compareVariants(a, b); ok {
+		return c == 0
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// compareVariants returns -1, 0 or 1 if a is less than, equal or greater than b. Returns false
+// if the values are not numbers, strings or times.
+func compareVariants(a, b ua.Variant) (int, bool) {
+	if x, ok := numericValue(a); ok {
+		if y, ok := numericValue(b); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			default:
+				return 0, true
+			}
+		}
+		return 0, false
+	}
+	if x, ok := stringValue(a); ok {
+		if y, ok := stringValue(b); ok {
+			return strings.Compare(x, y), true
+		}
+		return 0, false
+	}
+	if x, ok := a.(time.Time); ok {
+		if y, ok := b.(time.Time); ok {
+			switch {
+			case x.Before(y):
+				return -1, true
+			case x.After(y):
+				return 1, true
+			default:
+				return 0, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// numericValue returns the value of a number as a float64.
+func numericValue(v ua.Variant) (float64, bool) {
+	switch x := v.(type) {
+	case int8:
+		return float64(x), true
+	case uint8:
+		return float64(x), true
+	case int16:
+		return float64(x), true
+	case uint16:
+		return float64(x), true
+	case int32:
+		return float64(x), true
+	case uint32:
+		return float64(x), true
+	case int64:
+		return float64(x), true
+	case uint64:
+		return float64(x), true
+	case float32:
+		return float64(x), true
+	case float64:
+		return x, true
+	default:
+		return 0, false
+	}
+}
+
+// stringValue returns the value of a string, or the text of a LocalizedText.
+func stringValue(v ua.Variant) (string, bool) {
+	switch x := v.(type) {
+	case string:
+		return x, true
+	case ua.LocalizedText:
+		return x.Text, true
+	default:
+		return "", false
+	}
+}
@@ -80,10 +80,7 @@ func (n *DataTypeNode) UserRolePermissions(ctx context.Context) []ua.RolePermiss
 		return filteredPermissions
 	}
 	roles := session.UserRoles()
-	rolePermissions := n.RolePermissions()
-	if rolePermissions == nil {
-		rolePermissions = session.Server().RolePermissions()
-	}
+	rolePermissions := session.Server().effectiveRolePermissions(ctx, n, roles)
 	for _, role := range roles {
 		for _, rp := range rolePermissions {
 			if rp.RoleID == role {
@@ -114,11 +111,22 @@ func (n *DataTypeNode) IsAbstract() bool {
 	return n.isAbstract
 }
 
-// DataTypeDefinition returns the DataTypeDefinition attribute of this node.
+// DataTypeDefinition returns the DataTypeDefinition attribute of this node, a ua.StructureDefinition
+// or ua.EnumDefinition, or nil.
 func (n *DataTypeNode) DataTypeDefinition() interface{} {
+	n.RLock()
+	defer n.RUnlock()
 	return n.dataTypeDefinition
 }
 
+// SetDataTypeDefinition sets the DataTypeDefinition attribute of this node to a ua.StructureDefinition
+// or ua.EnumDefinition. Generic clients read the definition to decode the values of the DataType.
+func (n *DataTypeNode) SetDataTypeDefinition(value interface{}) {
+	n.Lock()
+	n.dataTypeDefinition = value
+	n.Unlock()
+}
+
 // IsAttributeIDValid returns true if attributeId is supported for the node.
 func (n *DataTypeNode) IsAttributeIDValid(attributeID uint32) bool {
 	switch attributeID {
@@ -5,7 +5,6 @@ package server
 import (
 	"context"
 	"math"
-	"reflect"
 	"sync/atomic"
 	"time"
 
@@ -30,6 +29,7 @@ type DataChangeMonitoredItem struct {
 	queue               deque.Deque[ua.DataValue]
 	node                Node
 	dataChangeFilter    ua.DataChangeFilter
+	euRange             *VariableNode
 	previousQueuedValue ua.DataValue
 	sub                 *Subscription
 	srv                 *Server
@@ -39,10 +39,18 @@ type DataChangeMonitoredItem struct {
 	cachedCtx           context.Context
 	triggeredItems      []MonitoredItem
 	triggered           bool
+	structureVersion    uint32
+	semanticsVersion    uint32
 }
 
 // NewDataChangeMonitoredItem constructs a new DataChangeMonitoredItem.
 func NewDataChangeMonitoredItem(ctx context.Context, sub *Subscription, node Node, itemToMonitor ua.ReadValueID, monitoringMode ua.MonitoringMode, parameters ua.MonitoringParameters, timestampsToReturn ua.TimestampsToReturn, minSamplingInterval float64) *DataChangeMonitoredItem {
+	return newDataChangeMonitoredItem(ctx, sub, node, itemToMonitor, monitoringMode, parameters, timestampsToReturn, minSamplingInterval, nil)
+}
+
+// newDataChangeMonitoredItem constructs a new DataChangeMonitoredItem. If initialValue is not nil,
+// it is queued as the first sample instead of reading the value of the itemToMonitor.
+func newDataChangeMonitoredItem(ctx context.Context, sub *Subscription, node Node, itemToMonitor ua.ReadValueID, monitoringMode ua.MonitoringMode, parameters ua.MonitoringParameters, timestampsToReturn ua.TimestampsToReturn, minSamplingInterval float64, initialValue *ua.DataValue) *DataChangeMonitoredItem {
 	mi := &DataChangeMonitoredItem{
 		sub:                 sub,
 		srv:                 sub.manager.server,
@@ -61,9 +69,12 @@ func NewDataChangeMonitoredItem(ctx context.Context, sub *Subscription, node Nod
 	mi.setQueueSize(parameters.QueueSize)
 	mi.setSamplingInterval(parameters.SamplingInterval)
 	mi.setFilter(parameters.Filter)
+	if n, ok := node.(*VariableNode); ok && itemToMonitor.AttributeID == ua.AttributeIDValue {
+		mi.structureVersion, mi.semanticsVersion = n.changeVersions()
+	}
 
 	mi.Lock()
-	mi.startMonitoring(ctx)
+	mi.startMonitoringWithValue(ctx, initialValue)
 	mi.Unlock()
 	return mi
 }
@@ -191,6 +202,7 @@ func (mi *DataChangeMonitoredItem) setQueueSize(queueSize uint32) {
 			// set overflow bit of statuscode
 			v := mi.queue.Front()
 			v.StatusCode = ua.StatusCode(uint32(v.StatusCode) | ua.InfoTypeDataValue | ua.Overflow)
+			mi.queue.Set(0, v)
 		}
 	} else {
 		for mi.queue.Len() > int(mi.queueSize) {
@@ -201,6 +213,7 @@ func (mi *DataChangeMonitoredItem) setQueueSize(queueSize uint32) {
 			// set overflow bit of statuscode
 			v := mi.queue.Back()
 			v.StatusCode = ua.StatusCode(uint32(v.StatusCode) | ua.InfoTypeDataValue | ua.Overflow)
+			mi.queue.Set(mi.queue.Len()-1, v)
 		}
 	}
 }
@@ -243,16 +256,42 @@ func (mi *DataChangeMonitoredItem) setFilter(filter interface{}) {
 	} else {
 		mi.dataChangeFilter = ua.DataChangeFilter{Trigger: ua.DataChangeTriggerStatusValue}
 	}
+	mi.euRange = nil
+	if ua.DeadbandType(mi.dataChangeFilter.DeadbandType) == ua.DeadbandTypePercent {
+		mi.euRange, _ = mi.srv.NamespaceManager().FindProperty(mi.node, ua.ParseQualifiedName("0:EURange"))
+	}
+}
+
+// percentDeadband returns the deadband of a percent deadband filter as an absolute value, that is the
+// percentage of the EURange of the node. The EURange is read on each call, so changes take effect
+// immediately. Returns false if the EURange is missing.
+func (mi *DataChangeMonitoredItem) percentDeadband() (float64, bool) {
+	if mi.euRange == nil {
+		return 0, false
+	}
+	r, ok := mi.euRange.Value().Value.(ua.Range)
+	if !ok {
+		return 0, false
+	}
+	return mi.dataChangeFilter.DeadbandValue / 100 * math.Abs(r.High-r.Low), true
 }
 
 func (mi *DataChangeMonitoredItem) startMonitoring(ctx context.Context) {
+	mi.startMonitoringWithValue(ctx, nil)
+}
+
+func (mi *DataChangeMonitoredItem) startMonitoringWithValue(ctx context.Context, initialValue *ua.DataValue) {
 	mi.cachedCtx = ctx
 	mi.ts = time.Now()
 	if mi.monitoringMode == ua.MonitoringModeDisabled {
 		return
 	}
-	v := mi.srv.readValue(ctx, mi.itemToMonitor)
-	mi.prequeue.PushBack(v)
+	if initialValue != nil {
+		mi.prequeue.PushBack(*initialValue)
+	} else {
+		v := mi.srv.sampleValue(ctx, mi.itemToMonitor, mi.ti)
+		mi.prequeue.PushBack(v)
+	}
 	mi.Unlock()
 	mi.srv.Scheduler().GetPollGroup(time.Duration(mi.samplingInterval) * time.Millisecond).Subscribe(mi)
 	mi.Lock()
@@ -265,21 +304,36 @@ func (mi *DataChangeMonitoredItem) stopMonitoring() {
 	mi.cachedCtx = nil
 }
 
-// Poll reads the value of the itemToMonitor.
+// setContext replaces the context used to sample the itemToMonitor, e.g. when the
+// subscription is transferred to another session.
+func (mi *DataChangeMonitoredItem) setContext(ctx context.Context) {
+	mi.Lock()
+	if mi.cachedCtx != nil {
+		mi.cachedCtx = ctx
+	}
+	mi.Unlock()
+}
+
+// Poll samples the value of the itemToMonitor.
 func (mi *DataChangeMonitoredItem) Poll() {
 	mi.Lock()
 	if n := mi.node; n != nil {
-		v := mi.srv.readValue(mi.cachedCtx, mi.itemToMonitor)
+		v := mi.srv.sampleValue(mi.cachedCtx, mi.itemToMonitor, mi.ti)
 		mi.prequeue.PushBack(v)
 	}
 	mi.Unlock()
 }
 
-// AddTriggeredItem adds a item to be triggered by this item.
+// AddTriggeredItem adds a item to be triggered by this item. Adding an existing link has no effect.
 func (mi *DataChangeMonitoredItem) AddTriggeredItem(item MonitoredItem) bool {
 	mi.Lock()
+	defer mi.Unlock()
+	for _, e := range mi.triggeredItems {
+		if e.ID() == item.ID() {
+			return true
+		}
+	}
 	mi.triggeredItems = append(mi.triggeredItems, item)
-	mi.Unlock()
 	return true
 }
 
@@ -312,6 +366,7 @@ func (mi *DataChangeMonitoredItem) enqueue(item ua.DataValue) {
 			// set overflow bit of statuscode
 			v := mi.queue.Front()
 			v.StatusCode = ua.StatusCode(uint32(v.StatusCode) | ua.InfoTypeDataValue | ua.Overflow)
+			mi.queue.Set(0, v)
 			mi.sub.monitoringQueueOverflowCount++
 		}
 	} else {
@@ -324,6 +379,7 @@ func (mi *DataChangeMonitoredItem) enqueue(item ua.DataValue) {
 			// set overflow bit of statuscode
 			v := mi.queue.Back()
 			v.StatusCode = ua.StatusCode(uint32(v.StatusCode) | ua.InfoTypeDataValue | ua.Overflow)
+			mi.queue.Set(mi.queue.Len()-1, v)
 			mi.sub.monitoringQueueOverflowCount++
 		}
 	}
@@ -403,9 +459,21 @@ func (mi *DataChangeMonitoredItem) notificationsAvailable(tn time.Time, late boo
 			}
 		}
 	}
+	// report a structure or semantics change once, with the latest value.
+	if bits := mi.changeBits(); bits != 0 {
+		if mi.queue.Len() > 0 {
+			v := mi.queue.Back()
+			v.StatusCode |= ua.StatusCode(bits)
+			mi.queue.Set(mi.queue.Len()-1, v)
+		} else {
+			v := mi.previousQueuedValue
+			v.StatusCode |= ua.StatusCode(bits)
+			mi.enqueue(withTimestamps(v, mi.timestampsToReturn))
+		}
+	}
 	if resend && mi.monitoringMode == ua.MonitoringModeReporting {
 		if mi.queue.Len() == 0 {
-			v := mi.srv.readValue(mi.cachedCtx, mi.itemToMonitor)
+			v := mi.srv.sampleValue(mi.cachedCtx, mi.itemToMonitor, mi.ti)
 			mi.enqueue(withTimestamps(v, mi.timestampsToReturn))
 			mi.previousQueuedValue = v
 		}
@@ -413,25 +481,53 @@ func (mi *DataChangeMonitoredItem) notificationsAvailable(tn time.Time, late boo
 	return mi.queue.Len() > 0 && (mi.monitoringMode == ua.MonitoringModeReporting || mi.triggered)
 }
 
+// changeBits returns the StructureChanged and SemanticsChanged bits of the changes reported
+// since the last call. Changes are kept pending until a value has been queued.
+func (mi *DataChangeMonitoredItem) changeBits() uint32 {
+	n, ok := mi.node.(*VariableNode)
+	if !ok || mi.itemToMonitor.AttributeID != ua.AttributeIDValue {
+		return 0
+	}
+	if mi.queue.Len() == 0 && mi.previousQueuedValue.StatusCode == ua.BadWaitingForInitialData {
+		return 0
+	}
+	structureVersion, semanticsVersion := n.changeVersions()
+	var bits uint32
+	if structureVersion != mi.structureVersion {
+		bits |= ua.StructureChanged
+		mi.structureVersion = structureVersion
+	}
+	if semanticsVersion != mi.semanticsVersion {
+		bits |= ua.SemanticsChanged
+		mi.semanticsVersion = semanticsVersion
+	}
+	return bits
+}
+
+// statusChangeMask selects the bits of a StatusCode that are compared to detect a status change. It
+// includes the limit bits, but not the overflow bit that is set by the queue.
+const statusChangeMask = ua.StatusCode(0xFFFFF000 | ua.InfoTypeMask | ua.LimitBitsMask)
+
 func (mi *DataChangeMonitoredItem) isDataChange(current, previous ua.DataValue) bool {
 	dcf := mi.dataChangeFilter
 	switch dcf.Trigger {
 	case ua.DataChangeTriggerStatus:
-		return (current.StatusCode&0xFFFFF000 != previous.StatusCode&0xFFFFF000)
+		return (current.StatusCode&statusChangeMask != previous.StatusCode&statusChangeMask)
 	case ua.DataChangeTriggerStatusValue:
-		if current.StatusCode&0xFFFFF000 != previous.StatusCode&0xFFFFF000 {
+		if current.StatusCode&statusChangeMask != previous.StatusCode&statusChangeMask {
 			return true
 		}
 		switch ua.DeadbandType(dcf.DeadbandType) {
 		case ua.DeadbandTypeNone:
-			return !reflect.DeepEqual(current.Value, previous.Value)
+			return !equalTolerance(current.Value, previous.Value, mi.changeTolerance())
 		case ua.DeadbandTypeAbsolute:
 			return !equalDeadbandAbsolute(current.Value, previous.Value, dcf.DeadbandValue)
 		case ua.DeadbandTypePercent:
-			return true
+			deadband, ok := mi.percentDeadband()
+			return !ok || !equalDeadbandAbsolute(current.Value, previous.Value, deadband)
 		}
 	case ua.DataChangeTriggerStatusValueTimestamp:
-		if current.StatusCode&0xFFFFF000 != previous.StatusCode&0xFFFFF000 {
+		if current.StatusCode&statusChangeMask != previous.StatusCode&statusChangeMask {
 			return true
 		}
 		if current.SourceTimestamp != previous.SourceTimestamp {
@@ -439,152 +535,67 @@ func (mi *DataChangeMonitoredItem) isDataChange(current, previous ua.DataValue)
 		}
 		switch ua.DeadbandType(dcf.DeadbandType) {
 		case ua.DeadbandTypeNone:
-			return !reflect.DeepEqual(current.Value, previous.Value)
+			return !equalTolerance(current.Value, previous.Value, mi.changeTolerance())
 		case ua.DeadbandTypeAbsolute:
 			return !equalDeadbandAbsolute(current.Value, previous.Value, dcf.DeadbandValue)
 		case ua.DeadbandTypePercent:
-			return true
+			deadband, ok := mi.percentDeadband()
+			return !ok || !equalDeadbandAbsolute(current.Value, previous.Value, deadband)
 		}
 	}
 	return true
 }
 
-func equalDeadbandAbsolute(current, previous ua.Variant, deadband float64) bool {
-	switch c := current.(type) {
-	case nil:
-		return previous == nil
-	case int8:
-		if p, ok := previous.(int8); ok {
-			return math.Abs(float64(c)-float64(p)) <= deadband
-		}
-	case uint8:
-		if p, ok := previous.(uint8); ok {
-			return math.Abs(float64(c)-float64(p)) <= deadband
-		}
-	case int16:
-		if p, ok := previous.(int16); ok {
-			return math.Abs(float64(c)-float64(p)) <= deadband
-		}
-	case uint16:
-		if p, ok := previous.(uint16); ok {
-			return math.Abs(float64(c)-float64(p)) <= deadband
-		}
-	case int32:
-		if p, ok := previous.(int32); ok {
-			return math.Abs(float64(c)-float64(p)) <= deadband
-		}
-	case uint32:
-		if p, ok := previous.(uint32); ok {
-			return math.Abs(float64(c)-float64(p)) <= deadband
-		}
-	case int64:
-		if p, ok := previous.(int64); ok {
-			return math.Abs(float64(c)-float64(p)) <= deadband
-		}
-	case uint64:
-		if p, ok := previous.(uint64); ok {
-			return math.Abs(float64(c)-float64(p)) <= deadband
+// changeTolerance returns the tolerance of the node, else the tolerance of the server.
+func (mi *DataChangeMonitoredItem) changeTolerance() ChangeTolerance {
+	if n, ok := mi.node.(*VariableNode); ok && mi.itemToMonitor.AttributeID == ua.AttributeIDValue {
+		if t := n.ChangeTolerance(); t != nil {
+			return *t
 		}
+	}
+	return mi.srv.changeTolerance
+}
+
+// equalTolerance returns true if Float or Double values differ by no more than the tolerance.
+// Values of other types are compared with ua.EqualVariants.
+func equalTolerance(current, previous ua.Variant, tolerance ChangeTolerance) bool {
+	if tolerance.Absolute <= 0 && tolerance.Relative <= 0 {
+		return ua.EqualVariants(current, previous)
+	}
+	switch c := current.(type) {
 	case float32:
 		if p, ok := previous.(float32); ok {
-			return math.Abs(float64(c)-float64(p)) <= deadband
+			return tolerance.within(float64(c), float64(p))
 		}
 	case float64:
 		if p, ok := previous.(float64); ok {
-			return math.Abs(float64(c)-float64(p)) <= deadband
-		}
-	case []int8:
-		if p, ok := previous.([]int8); ok {
-			for i := 0; i < len(c); i++ {
-				if math.Abs(float64(c[i])-float64(p[i])) > deadband {
-					return false
-				}
-			}
-			return true
-		}
-	case []uint8:
-		if p, ok := previous.([]uint8); ok {
-			for i := 0; i < len(c); i++ {
-				if math.Abs(float64(c[i])-float64(p[i])) > deadband {
-					return false
-				}
-			}
-			return true
-		}
-	case []int16:
-		if p, ok := previous.([]int16); ok {
-			for i := 0; i < len(c); i++ {
-				if math.Abs(float64(c[i])-float64(p[i])) > deadband {
-					return false
-				}
-			}
-			return true
-		}
-	case []uint16:
-		if p, ok := previous.([]uint16); ok {
-			for i := 0; i < len(c); i++ {
-				if math.Abs(float64(c[i])-float64(p[i])) > deadband {
-					return false
-				}
-			}
-			return true
-		}
-	case []int32:
-		if p, ok := previous.([]int32); ok {
-			for i := 0; i < len(c); i++ {
-				if math.Abs(float64(c[i])-float64(p[i])) > deadband {
-					return false
-				}
-			}
-			return true
-		}
-	case []uint32:
-		if p, ok := previous.([]uint32); ok {
-			for i := 0; i < len(c); i++ {
-				if math.Abs(float64(c[i])-float64(p[i])) > deadband {
-					return false
-				}
-			}
-			return true
-		}
-	case []int64:
-		if p, ok := previous.([]int64); ok {
-			for i := 0; i < len(c); i++ {
-				if math.Abs(float64(c[i])-float64(p[i])) > deadband {
-					return false
-				}
-			}
-			return true
-		}
-	case []uint64:
-		if p, ok := previous.([]uint64); ok {
-			for i := 0; i < len(c); i++ {
-				if math.Abs(float64(c[i])-float64(p[i])) > deadband {
-					return false
-				}
-			}
-			return true
+			return tolerance.within(c, p)
 		}
 	case []float32:
-		if p, ok := previous.([]float32); ok {
-			for i := 0; i < len(c); i++ {
-				if math.Abs(float64(c[i])-float64(p[i])) > deadband {
+		if p, ok := previous.([]float32); ok && len(p) == len(c) {
+			for i := range c {
+				if !tolerance.within(float64(c[i]), float64(p[i])) {
 					return false
 				}
 			}
 			return true
 		}
 	case []float64:
-		if p, ok := previous.([]float64); ok {
-			for i := 0; i < len(c); i++ {
-				if math.Abs(float64(c[i])-float64(p[i])) > deadband {
+		if p, ok := previous.([]float64); ok && len(p) == len(c) {
+			for i := range c {
+				if !tolerance.within(c[i], p[i]) {
 					return false
 				}
 			}
 			return true
 		}
 	}
-	return false
+	return ua.EqualVariants(current, previous)
+}
+
+// equalDeadbandAbsolute returns true if the values differ by no more than the deadband.
+func equalDeadbandAbsolute(current, previous ua.Variant, deadband float64) bool {
+	return !ua.AbsoluteDeadbandExceeded(ua.DataValue{Value: previous}, ua.DataValue{Value: current}, deadband)
 }
 
 // withTimestamps returns a new instance of DataValue with only the selected timestamps.
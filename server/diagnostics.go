@@ -0,0 +1,81 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package server
+
+import (
+	"context"
+
+	"github.com/awcullen/opcua/ua"
+)
+
+// operationDiagnosticsKey is the context key of the diagnostics of the operation in progress.
+type operationDiagnosticsKey struct{}
+
+// operationDiagnostics holds the error reported by a handler while processing an operation.
+type operationDiagnostics struct {
+	err error
+}
+
+// handlerStatusCode returns the StatusCode of an error returned by a handler. A ua.StatusCode is
+// returned unchanged. Any other error becomes BadInternalError, and the error text is kept for the
+// diagnostics of the operation.
+func handlerStatusCode(ctx context.Context, err error) ua.StatusCode {
+	if code, ok := err.(ua.StatusCode); ok {
+		return code
+	}
+	if d, ok := ctx.Value(operationDiagnosticsKey{}).(*operationDiagnostics); ok {
+		d.err = err
+	}
+	return ua.BadInternalError
+}
+
+// diagnosticsBuilder collects the diagnostics of the operations of a service call, as selected
+// by the ReturnDiagnostics mask of the request.
+type diagnosticsBuilder struct {
+	mask       uint32
+	operations []*operationDiagnostics
+}
+
+func newDiagnosticsBuilder(mask uint32, n int) *diagnosticsBuilder {
+	b := &diagnosticsBuilder{mask: mask & (ua.DiagnosticsOperationLocalizedText | ua.DiagnosticsOperationAdditionalInfo)}
+	if b.mask != 0 {
+		b.operations = make([]*operationDiagnostics, n)
+		for i := range b.operations {
+			b.operations[i] = &operationDiagnostics{}
+		}
+	}
+	return b
+}
+
+// context returns the context for the i-th operation.
+func (b *diagnosticsBuilder) context(ctx context.Context, i int) context.Context {
+	if b.mask == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, operationDiagnosticsKey{}, b.operations[i])
+}
+
+// results returns the DiagnosticInfos of the operations and the StringTable of the response. If no
+// operation reported an error, the DiagnosticInfos are empty.
+func (b *diagnosticsBuilder) results() ([]ua.DiagnosticInfo, []string) {
+	var infos []ua.DiagnosticInfo
+	var stringTable []string
+	for i, d := range b.operations {
+		if d.err == nil {
+			continue
+		}
+		if infos == nil {
+			infos = make([]ua.DiagnosticInfo, len(b.operations))
+		}
+		text := d.err.Error()
+		if b.mask&ua.DiagnosticsOperationLocalizedText != 0 {
+			index := int32(len(stringTable))
+			stringTable = append(stringTable, text)
+			infos[i].LocalizedText = &index
+		}
+		if b.mask&ua.DiagnosticsOperationAdditionalInfo != 0 {
+			infos[i].AdditionalInfo = &text
+		}
+	}
+	return infos, stringTable
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/awcullen/opcua/ua"
 	deque "github.com/gammazero/deque"
+	"github.com/google/uuid"
 )
 
 // EventMonitoredItem specifies a node that is monitored for events.
@@ -26,6 +27,11 @@ type EventMonitoredItem struct {
 	queue            deque.Deque[[]ua.Variant]
 	node             Node
 	eventFilter      ua.EventFilter
+	selectClauses    []ua.SimpleAttributeOperand
+	selectResults    []ua.StatusCode
+	whereClause      ua.ContentFilter
+	whereResult      ua.ContentFilterResult
+	likePatterns     likePatterns
 	sub              *Subscription
 	srv              *Server
 	triggeredItems   []MonitoredItem
@@ -123,7 +129,7 @@ func (mi *EventMonitoredItem) Modify(ctx context.Context, req ua.MonitoredItemMo
 	mi.setSamplingInterval(req.RequestedParameters.SamplingInterval)
 	mi.setFilter(req.RequestedParameters.Filter)
 	mi.startMonitoring(ctx)
-	return ua.MonitoredItemModifyResult{RevisedSamplingInterval: mi.samplingInterval, RevisedQueueSize: mi.queueSize}
+	return ua.MonitoredItemModifyResult{RevisedSamplingInterval: mi.samplingInterval, RevisedQueueSize: mi.queueSize, FilterResult: mi.filterResult()}
 }
 
 // Delete deletes the DataMonitoredItem.
@@ -180,6 +186,61 @@ func (mi *EventMonitoredItem) setFilter(filter interface{}) {
 	} else {
 		mi.eventFilter = ua.EventFilter{}
 	}
+	mi.selectClauses, mi.selectResults = mi.resolveSelectClauses(mi.eventFilter.SelectClauses)
+	mi.whereClause, mi.whereResult, _ = resolveWhereClause(mi.srv.NamespaceManager(), mi.eventFilter.WhereClause)
+	mi.likePatterns = nil
+}
+
+// FilterResult returns the EventFilterResult if any select clause could not be resolved, or any element
+// of the where clause is invalid, otherwise nil.
+func (mi *EventMonitoredItem) FilterResult() ua.ExtensionObject {
+	mi.RLock()
+	defer mi.RUnlock()
+	return mi.filterResult()
+}
+
+func (mi *EventMonitoredItem) filterResult() ua.ExtensionObject {
+	if len(mi.whereResult.ElementResults) > 0 {
+		return ua.EventFilterResult{SelectClauseResults: mi.selectResults, WhereClauseResult: mi.whereResult}
+	}
+	for _, result := range mi.selectResults {
+		if result != ua.Good {
+			return ua.EventFilterResult{SelectClauseResults: mi.selectResults}
+		}
+	}
+	return nil
+}
+
+// resolveSelectClauses resolves the browse path of each select clause. A clause that cannot be resolved
+// returns BadNodeIDUnknown.
+func (mi *EventMonitoredItem) resolveSelectClauses(clauses []ua.SimpleAttributeOperand) ([]ua.SimpleAttributeOperand, []ua.StatusCode) {
+	m := mi.srv.NamespaceManager()
+	resolved := make([]ua.SimpleAttributeOperand, len(clauses))
+	results := make([]ua.StatusCode, len(clauses))
+	for i, clause := range clauses {
+		resolved[i], results[i] = resolveSimpleAttributeOperand(m, clause)
+	}
+	return resolved, results
+}
+
+// findInstanceDeclaration returns true if the browse path leads from the type to a component or property.
+func findInstanceDeclaration(m *NamespaceManager, typeID ua.NodeID, browsePath []ua.QualifiedName) bool {
+	n, ok := m.FindNode(typeID)
+	if !ok {
+		return false
+	}
+	for _, name := range browsePath {
+		if n1, ok := m.FindComponent(n, name); ok {
+			n = n1
+			continue
+		}
+		if n1, ok := m.FindProperty(n, name); ok {
+			n = n1
+			continue
+		}
+		return false
+	}
+	return true
 }
 
 func (mi *EventMonitoredItem) enqueue(item []ua.Variant) {
@@ -211,71 +272,70 @@ func (mi *EventMonitoredItem) enqueue(item []ua.Variant) {
 	}
 }
 
+// OnEvent enqueues the select fields of the event, if the event satisfies the where clause.
+// An invalid where clause matches no events.
 func (mi *EventMonitoredItem) OnEvent(evt ua.Event) {
+	mi.sub.RLock()
+	session := mi.sub.session
+	mi.sub.RUnlock()
+	if !mi.srv.isAuditVisible(session, evt) {
+		return
+	}
 	mi.Lock()
-	if res, ok := mi.whereClause(evt, 0).(bool); ok && res {
-		mi.enqueue(mi.selectFields(evt))
+	if len(mi.whereResult.ElementResults) == 0 {
+		if res, ok := mi.evaluate(evt, 0).(bool); ok && res {
+			mi.enqueue(mi.selectFields(evt))
+		}
 	}
 	mi.Unlock()
 }
 
-var (
-	attributeOperandEventType = ua.SimpleAttributeOperand{TypeDefinitionID: ua.ObjectTypeIDBaseEventType, BrowsePath: ua.ParseBrowsePath("EventType"), AttributeID: ua.AttributeIDValue}
-)
-
-func (mi *EventMonitoredItem) whereClause(evt ua.Event, idx int) interface{} {
-	if idx >= len(mi.eventFilter.WhereClause.Elements) {
-		return true
+// conditionRefresh enqueues a RefreshStartEvent, the retained conditions that satisfy the where
+// clause, and a RefreshEndEvent. The where clause does not apply to the refresh events.
+func (mi *EventMonitoredItem) conditionRefresh(conditions []ua.Event) {
+	mi.Lock()
+	defer mi.Unlock()
+	if mi.monitoringMode == ua.MonitoringModeDisabled {
+		return
 	}
-	element := mi.eventFilter.WhereClause.Elements[idx]
-	switch element.FilterOperator {
-
-	case ua.FilterOperatorEquals:
-		var a, b ua.Variant
-		switch c := element.FilterOperands[0].(type) {
-		case ua.LiteralOperand:
-			a = c.Value
-		case ua.SimpleAttributeOperand:
-			a = evt.GetAttribute(c)
-		case ua.ElementOperand:
-			a = mi.whereClause(evt, int(c.Index))
-		default:
-			return false
-		}
-		switch c := element.FilterOperands[1].(type) {
-		case ua.LiteralOperand:
-			b = c.Value
-		case ua.SimpleAttributeOperand:
-			b = evt.GetAttribute(c)
-		case ua.ElementOperand:
-			b = mi.whereClause(evt, int(c.Index))
-		default:
-			return false
-		}
-		return a == b
-
-	case ua.FilterOperatorOfType:
-		if a, ok := element.FilterOperands[0].(ua.LiteralOperand); ok {
-			if b, ok := a.Value.(ua.NodeID); ok {
-				if c, ok := evt.GetAttribute(attributeOperandEventType).(ua.NodeID); ok {
-					if c == b || mi.srv.namespaceManager.IsSubtype(c, b) {
-						return true
-					}
-				}
+	mi.enqueue(mi.selectFields(newRefreshEvent(ua.ObjectTypeIDRefreshStartEventType)))
+	if len(mi.whereResult.ElementResults) == 0 {
+		for _, evt := range conditions {
+			if res, ok := mi.evaluate(evt, 0).(bool); ok && res {
+				mi.enqueue(mi.selectFields(evt))
 			}
 		}
-		return false
+	}
+	mi.enqueue(mi.selectFields(newRefreshEvent(ua.ObjectTypeIDRefreshEndEventType)))
+}
 
-	default:
-		return false
+// newRefreshEvent returns a RefreshStartEvent or RefreshEndEvent raised by the Server object.
+func newRefreshEvent(eventType ua.NodeID) ua.Event {
+	id := uuid.New()
+	now := time.Now()
+	return &ua.BaseEvent{
+		EventID:     ua.ByteString(id[:]),
+		EventType:   eventType,
+		SourceNode:  ua.ObjectIDServer,
+		SourceName:  "Server",
+		Time:        now,
+		ReceiveTime: now,
+		Severity:    100,
 	}
 }
 
+var (
+	attributeOperandEventType = ua.SimpleAttributeOperand{TypeDefinitionID: ua.ObjectTypeIDBaseEventType, BrowsePath: ua.ParseBrowsePath("EventType"), AttributeID: ua.AttributeIDValue}
+)
+
 func (mi *EventMonitoredItem) selectFields(evt ua.Event) []ua.Variant {
-	clauses := mi.eventFilter.SelectClauses
+	clauses := mi.selectClauses
 	ret := make([]ua.Variant, len(clauses))
 	for i, clause := range clauses {
-		ret[i] = evt.GetAttribute(clause)
+		if mi.selectResults[i] != ua.Good {
+			continue
+		}
+		ret[i] = eventAttribute(mi.srv.namespaceManager, evt, clause)
 	}
 	return ret
 }
@@ -326,11 +386,16 @@ func (mi *EventMonitoredItem) notificationsAvailable(tn time.Time, late bool, re
 	return mi.queue.Len() > 0 && (mi.monitoringMode == ua.MonitoringModeReporting || mi.triggered)
 }
 
-// AddTriggeredItem adds a item to be triggered by this item.
+// AddTriggeredItem adds a item to be triggered by this item. Adding an existing link has no effect.
 func (mi *EventMonitoredItem) AddTriggeredItem(item MonitoredItem) bool {
 	mi.Lock()
+	defer mi.Unlock()
+	for _, e := range mi.triggeredItems {
+		if e.ID() == item.ID() {
+			return true
+		}
+	}
 	mi.triggeredItems = append(mi.triggeredItems, item)
-	mi.Unlock()
 	return true
 }
 
@@ -4,6 +4,7 @@ package server
 
 import (
 	"context"
+	"time"
 
 	"github.com/awcullen/opcua/ua"
 )
@@ -28,6 +29,31 @@ type HistoryWriter interface {
 	WriteValue(ctx context.Context, nodeID ua.NodeID, value ua.DataValue) error
 }
 
+// HistoryDeleter provides methods to delete historical data. A HistoryReadWriter may
+// optionally implement HistoryDeleter.
+type HistoryDeleter interface {
+
+	// DeleteRawModified deletes the values of the variable from storage. Implementation deletes
+	// values with a SourceTimestamp between startTime (inclusive) and endTime (exclusive). A zero
+	// startTime or endTime leaves the range open. Implementation may check context for timeout.
+	DeleteRawModified(ctx context.Context, nodeID ua.NodeID, startTime, endTime time.Time) error
+}
+
+// HistoryUpdater provides methods to insert and replace historical data. A HistoryReadWriter may
+// optionally implement HistoryUpdater.
+type HistoryUpdater interface {
+
+	// InsertValues inserts the values of the variable into storage. Implementation returns a status
+	// for each value, GoodEntryInserted, or BadEntryExists if a value with the same SourceTimestamp
+	// is stored. Implementation may check context for timeout.
+	InsertValues(ctx context.Context, nodeID ua.NodeID, values []ua.DataValue) []ua.StatusCode
+
+	// ReplaceValues replaces the values of the variable in storage. Implementation returns a status
+	// for each value, GoodEntryReplaced, or BadNoEntryExists if no value with the same SourceTimestamp
+	// is stored. Implementation may check context for timeout.
+	ReplaceValues(ctx context.Context, nodeID ua.NodeID, values []ua.DataValue) []ua.StatusCode
+}
+
 // HistoryReader provides methods to read historical data.
 type HistoryReader interface {
 
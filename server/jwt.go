@@ -0,0 +1,204 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package server
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256" // register SHA256 for JWT signatures
+	_ "crypto/sha512" // register SHA384 and SHA512 for JWT signatures
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/awcullen/opcua/ua"
+)
+
+// IssuedTokenTypeJWT is the IssuedTokenType of a JSON Web Token.
+const IssuedTokenTypeJWT = "http://opcfoundation.org/UA/UserToken#JWT"
+
+// JWTAuthenticator authenticates an IssuedIdentity that is a JSON Web Token (RFC 7519). The token
+// must be signed by one of the Keys, have the Issuer and Audience, and be within its validity period.
+// Returns BadIdentityTokenInvalid if the token is malformed, or BadIdentityTokenRejected otherwise.
+type JWTAuthenticator struct {
+	// Issuer is the required "iss" claim. If empty, any issuer is accepted.
+	Issuer string
+	// Audience is the required "aud" claim, e.g. the ApplicationURI of the server. If empty, any audience is accepted.
+	Audience string
+	// Keys verify the signature of the token. Supported are *rsa.PublicKey for RS and PS algorithms,
+	// *ecdsa.PublicKey for ES algorithms, and []byte secrets for HS algorithms.
+	Keys []crypto.PublicKey
+	// Leeway is the allowed clock skew when checking the "exp" and "nbf" claims.
+	Leeway time.Duration
+}
+
+var _ IssuedIdentityAuthenticator = (*JWTAuthenticator)(nil)
+
+// AuthenticateIssuedIdentity returns nil if the token is valid.
+func (a *JWTAuthenticator) AuthenticateIssuedIdentity(userIdentity ua.IssuedIdentity, applicationURI string, endpointURL string) error {
+	_, err := a.verify(userIdentity)
+	return err
+}
+
+// verify returns the claims of the token, if the token is valid.
+func (a *JWTAuthenticator) verify(userIdentity ua.IssuedIdentity) (map[string]interface{}, error) {
+	token := string(userIdentity.TokenData)
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ua.BadIdentityTokenInvalid
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, ua.BadIdentityTokenInvalid
+	}
+	claims, err := JWTClaims(userIdentity.TokenData)
+	if err != nil {
+		return nil, ua.BadIdentityTokenInvalid
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ua.BadIdentityTokenInvalid
+	}
+	signed := []byte(token[:len(parts[0])+1+len(parts[1])])
+	verified := false
+	for _, key := range a.Keys {
+		if verifyJWTSignature(header.Alg, key, signed, signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, ua.BadIdentityTokenRejected
+	}
+	if a.Issuer != "" && claims["iss"] != a.Issuer {
+		return nil, ua.BadIdentityTokenRejected
+	}
+	if a.Audience != "" && !jwtAudienceContains(claims["aud"], a.Audience) {
+		return nil, ua.BadIdentityTokenRejected
+	}
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(a.Leeway)) {
+		return nil, ua.BadIdentityTokenRejected
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Before(time.Unix(int64(nbf), 0).Add(-a.Leeway)) {
+		return nil, ua.BadIdentityTokenRejected
+	}
+	return claims, nil
+}
+
+// JWTClaims returns the claims of a JSON Web Token, without verifying the token. The claims verified by
+// the JWTAuthenticator when the session was activated are returned by Session.Claims.
+func JWTClaims(tokenData ua.ByteString) (map[string]interface{}, error) {
+	parts := strings.Split(string(tokenData), ".")
+	if len(parts) != 3 {
+		return nil, ua.BadIdentityTokenInvalid
+	}
+	claims := map[string]interface{}{}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, ua.BadIdentityTokenInvalid
+	}
+	return claims, nil
+}
+
+// jwtSubject returns the "sub" claim of the token, or "" if the token is not a JSON Web Token.
+func jwtSubject(tokenData ua.ByteString) string {
+	claims, err := JWTClaims(tokenData)
+	if err != nil {
+		return ""
+	}
+	sub, _ := claims["sub"].(string)
+	return sub
+}
+
+// jwtGroups returns the "groups" claim of the verified claims.
+func jwtGroups(claims map[string]interface{}) []string {
+	groups := []string{}
+	list, _ := claims["groups"].([]interface{})
+	for _, item := range list {
+		if g, ok := item.(string); ok {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// decodeJWTPart decodes a base64url encoded JSON part of a token.
+func decodeJWTPart(part string, v interface{}) error {
+	buf, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.NewDecoder(bytes.NewReader(buf)).Decode(v)
+}
+
+// jwtAudienceContains returns true if the "aud" claim, a string or a list of strings, contains the audience.
+func jwtAudienceContains(aud interface{}, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, item := range aud {
+			if item == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// verifyJWTSignature returns true if the signature of the signed part is verified by the key with the algorithm.
+func verifyJWTSignature(alg string, key crypto.PublicKey, signed, signature []byte) bool {
+	if len(alg) != 5 {
+		return false
+	}
+	var hash crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return false
+	}
+	switch alg[:2] {
+	case "HS":
+		secret, ok := key.([]byte)
+		if !ok {
+			return false
+		}
+		mac := hmac.New(hash.New, secret)
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), signature)
+	}
+	h := hash.New()
+	h.Write(signed)
+	hashed := h.Sum(nil)
+	switch alg[:2] {
+	case "RS":
+		pub, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(pub, hash, hashed, signature) == nil
+	case "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPSS(pub, hash, hashed, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature)%2 != 0 {
+			return false
+		}
+		n := len(signature) / 2
+		r, s := new(big.Int).SetBytes(signature[:n]), new(big.Int).SetBytes(signature[n:])
+		return ecdsa.Verify(pub, hashed, r, s)
+	default:
+		return false
+	}
+}
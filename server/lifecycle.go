@@ -0,0 +1,116 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package server
+
+import (
+	"time"
+
+	"github.com/awcullen/opcua/ua"
+)
+
+// LifecycleEventType identifies the kind of a LifecycleEvent.
+type LifecycleEventType int
+
+const (
+	// LifecycleEventChannelOpened is raised when a secure channel is opened.
+	LifecycleEventChannelOpened LifecycleEventType = iota
+	// LifecycleEventChannelClosed is raised when a secure channel is closed, normally or abnormally.
+	LifecycleEventChannelClosed
+	// LifecycleEventSessionCreated is raised when a session is created.
+	LifecycleEventSessionCreated
+	// LifecycleEventSessionActivated is raised when a session is activated.
+	LifecycleEventSessionActivated
+	// LifecycleEventSessionClosed is raised when a session is closed.
+	LifecycleEventSessionClosed
+	// LifecycleEventSessionExpired is raised when a session is closed after its timeout elapsed.
+	LifecycleEventSessionExpired
+)
+
+// String returns the name of the LifecycleEventType.
+func (t LifecycleEventType) String() string {
+	switch t {
+	case LifecycleEventChannelOpened:
+		return "ChannelOpened"
+	case LifecycleEventChannelClosed:
+		return "ChannelClosed"
+	case LifecycleEventSessionCreated:
+		return "SessionCreated"
+	case LifecycleEventSessionActivated:
+		return "SessionActivated"
+	case LifecycleEventSessionClosed:
+		return "SessionClosed"
+	case LifecycleEventSessionExpired:
+		return "SessionExpired"
+	default:
+		return "Unknown"
+	}
+}
+
+// LifecycleEvent describes a change in the lifecycle of a secure channel or session.
+type LifecycleEvent struct {
+	// Type is the kind of the event.
+	Type LifecycleEventType
+	// Time is when the event was raised.
+	Time time.Time
+	// ChannelID is the id of the secure channel, or of the channel the session is bound to.
+	ChannelID uint32
+	// RemoteAddress is the network address of the client. Set for channel events only.
+	RemoteAddress string
+	// SecurityPolicyURI is the security policy of the channel. Set for channel events only.
+	SecurityPolicyURI string
+	// SessionID is the id of the session. Set for session events only.
+	SessionID ua.NodeID
+	// SessionName is the name of the session given by the client. Set for session events only.
+	SessionName string
+	// ClientDescription describes the client application of the session. Set for session events only.
+	ClientDescription ua.ApplicationDescription
+}
+
+// LifecycleHandler is called when a secure channel or session changes state.
+// The handler is called synchronously, so it should return quickly.
+type LifecycleHandler func(evt LifecycleEvent)
+
+// SetLifecycleHook sets the handler that observes secure channel and session lifecycle events.
+func (srv *Server) SetLifecycleHook(handler LifecycleHandler) {
+	srv.Lock()
+	defer srv.Unlock()
+	srv.lifecycleHook = handler
+}
+
+// raiseChannelEvent calls the lifecycle hook with an event of the secure channel.
+func (srv *Server) raiseChannelEvent(typ LifecycleEventType, ch *serverSecureChannel) {
+	srv.RLock()
+	hook := srv.lifecycleHook
+	srv.RUnlock()
+	if hook == nil {
+		return
+	}
+	evt := LifecycleEvent{
+		Type:              typ,
+		Time:              time.Now(),
+		ChannelID:         ch.ChannelID(),
+		SecurityPolicyURI: ch.SecurityPolicyURI(),
+	}
+	if ch.conn != nil {
+		evt.RemoteAddress = ch.conn.RemoteAddr().String()
+	}
+	hook(evt)
+}
+
+// raiseSessionEvent calls the lifecycle hook with an event of the session.
+func (srv *Server) raiseSessionEvent(typ LifecycleEventType, s *Session) {
+	srv.RLock()
+	hook := srv.lifecycleHook
+	srv.RUnlock()
+	if hook == nil {
+		return
+	}
+	hook(LifecycleEvent{
+		Type:              typ,
+		Time:              time.Now(),
+		ChannelID:         s.SecureChannelId(),
+		SessionID:         s.SessionId(),
+		SessionName:       s.SessionName(),
+		ClientDescription: s.ClientDescription(),
+	})
+}
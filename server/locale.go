@@ -0,0 +1,49 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package server
+
+import (
+	"context"
+	"strings"
+
+	"github.com/awcullen/opcua/ua"
+)
+
+// selectLocalizedText returns the text that best matches the preferred locales. A locale
+// matches exactly or by language (e.g. 'de' matches 'de-DE'). Returns false if none match.
+func selectLocalizedText(texts []ua.LocalizedText, localeIDs []string) (ua.LocalizedText, bool) {
+	for _, id := range localeIDs {
+		for _, t := range texts {
+			if strings.EqualFold(t.Locale, id) {
+				return t, true
+			}
+		}
+		lang := strings.SplitN(id, "-", 2)[0]
+		for _, t := range texts {
+			if strings.EqualFold(strings.SplitN(t.Locale, "-", 2)[0], lang) {
+				return t, true
+			}
+		}
+	}
+	return ua.LocalizedText{}, false
+}
+
+// TranslateFunc returns the text translated to the first supported locale of the localeIDs.
+// Returns the text unchanged if no translation is available.
+type TranslateFunc func(text ua.LocalizedText, localeIDs []string) ua.LocalizedText
+
+// translate returns the text translated to the locales, if the server has a translator.
+func (srv *Server) translate(text ua.LocalizedText, localeIDs []string) ua.LocalizedText {
+	if srv.translator == nil || len(localeIDs) == 0 {
+		return text
+	}
+	return srv.translator(text, localeIDs)
+}
+
+// translateForSession returns the text translated to the locales of the session found in the context.
+func (srv *Server) translateForSession(ctx context.Context, text ua.LocalizedText) ua.LocalizedText {
+	if session, ok := ctx.Value(SessionKey).(*Session); ok && session != nil {
+		return srv.translate(text, session.LocaleIDs())
+	}
+	return text
+}
@@ -0,0 +1,342 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package server
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/awcullen/opcua/ua"
+)
+
+const (
+	defaultHistoryCapacity               = 10000
+	maxMemoryHistorianContinuationPoints = 100
+)
+
+// memoryEvent is an event stored by the MemoryHistorian.
+type memoryEvent struct {
+	time        time.Time
+	eventFields []ua.Variant
+}
+
+// memoryContinuationPoint holds the remaining values of a read.
+type memoryContinuationPoint struct {
+	created time.Time
+	values  []ua.DataValue
+}
+
+// MemoryHistorian is a HistoryReadWriter that stores values and events in memory.
+// The oldest values and events of a node are discarded when the capacity is reached.
+type MemoryHistorian struct {
+	sync.RWMutex
+	capacity int
+	values   map[ua.NodeID][]ua.DataValue
+	events   map[ua.NodeID][]memoryEvent
+	cps      map[string]memoryContinuationPoint
+}
+
+var _ HistoryReadWriter = (*MemoryHistorian)(nil)
+var _ HistoryDeleter = (*MemoryHistorian)(nil)
+var _ HistoryUpdater = (*MemoryHistorian)(nil)
+
+// NewMemoryHistorian constructs a new MemoryHistorian that stores up to capacity values and events per node.
+func NewMemoryHistorian(capacity int) *MemoryHistorian {
+	if capacity <= 0 {
+		capacity = defaultHistoryCapacity
+	}
+	return &MemoryHistorian{
+		capacity: capacity,
+		values:   make(map[ua.NodeID][]ua.DataValue),
+		events:   make(map[ua.NodeID][]memoryEvent),
+		cps:      make(map[string]memoryContinuationPoint),
+	}
+}
+
+// WriteEvent writes the event to storage.
+func (h *MemoryHistorian) WriteEvent(ctx context.Context, nodeID ua.NodeID, eventFields []ua.Variant) error {
+	h.Lock()
+	defer h.Unlock()
+	events := append(h.events[nodeID], memoryEvent{time: time.Now(), eventFields: eventFields})
+	if len(events) > h.capacity {
+		events = events[len(events)-h.capacity:]
+	}
+	h.events[nodeID] = events
+	return nil
+}
+
+// WriteValue writes the value to storage. Values are ordered by SourceTimestamp. If the value
+// has no SourceTimestamp, then the ServerTimestamp or the current time is used.
+func (h *MemoryHistorian) WriteValue(ctx context.Context, nodeID ua.NodeID, value ua.DataValue) error {
+	if value.SourceTimestamp.IsZero() {
+		value.SourceTimestamp = value.ServerTimestamp
+		if value.SourceTimestamp.IsZero() {
+			value.SourceTimestamp = time.Now()
+		}
+	}
+	h.Lock()
+	defer h.Unlock()
+	values := h.values[nodeID]
+	i := sort.Search(len(values), func(i int) bool { return values[i].SourceTimestamp.After(value.SourceTimestamp) })
+	values = append(values, ua.DataValue{})
+	copy(values[i+1:], values[i:])
+	values[i] = value
+	if len(values) > h.capacity {
+		values = values[len(values)-h.capacity:]
+	}
+	h.values[nodeID] = values
+	return nil
+}
+
+// DeleteRawModified deletes the values of the node with a SourceTimestamp between startTime (inclusive)
+// and endTime (exclusive). A zero startTime or endTime leaves the range open.
+func (h *MemoryHistorian) DeleteRawModified(ctx context.Context, nodeID ua.NodeID, startTime, endTime time.Time) error {
+	h.Lock()
+	defer h.Unlock()
+	values := h.values[nodeID]
+	retained := make([]ua.DataValue, 0, len(values))
+	for _, v := range values {
+		if !inTimeRange(v.SourceTimestamp, startTime, endTime) {
+			retained = append(retained, v)
+		}
+	}
+	if len(retained) == 0 {
+		delete(h.values, nodeID)
+		return nil
+	}
+	h.values[nodeID] = retained
+	return nil
+}
+
+// InsertValues inserts the values of the node. A value with the SourceTimestamp of a stored value
+// returns BadEntryExists. If the capacity is reached, a value older than all stored values would be
+// discarded at once, so it returns BadOutOfRange.
+func (h *MemoryHistorian) InsertValues(ctx context.Context, nodeID ua.NodeID, values []ua.DataValue) []ua.StatusCode {
+	h.Lock()
+	defer h.Unlock()
+	results := make([]ua.StatusCode, len(values))
+	for i, value := range values {
+		stored := h.values[nodeID]
+		j := sort.Search(len(stored), func(j int) bool { return !stored[j].SourceTimestamp.Before(value.SourceTimestamp) })
+		if j < len(stored) && stored[j].SourceTimestamp.Equal(value.SourceTimestamp) {
+			results[i] = ua.BadEntryExists
+			continue
+		}
+		if j == 0 && len(stored) >= h.capacity {
+			results[i] = ua.BadOutOfRange
+			continue
+		}
+		stored = append(stored, ua.DataValue{})
+		copy(stored[j+1:], stored[j:])
+		stored[j] = value
+		if len(stored) > h.capacity {
+			stored = stored[len(stored)-h.capacity:]
+		}
+		h.values[nodeID] = stored
+		results[i] = ua.GoodEntryInserted
+	}
+	return results
+}
+
+// ReplaceValues replaces the values of the node with the same SourceTimestamp. A value without a
+// stored value at its SourceTimestamp returns BadNoEntryExists.
+func (h *MemoryHistorian) ReplaceValues(ctx context.Context, nodeID ua.NodeID, values []ua.DataValue) []ua.StatusCode {
+	h.Lock()
+	defer h.Unlock()
+	results := make([]ua.StatusCode, len(values))
+	for i, value := range values {
+		stored := h.values[nodeID]
+		j := sort.Search(len(stored), func(j int) bool { return !stored[j].SourceTimestamp.Before(value.SourceTimestamp) })
+		if j == len(stored) || !stored[j].SourceTimestamp.Equal(value.SourceTimestamp) {
+			results[i] = ua.BadNoEntryExists
+			continue
+		}
+		stored[j] = value
+		results[i] = ua.GoodEntryReplaced
+	}
+	return results
+}
+
+// ReadEvent reads the events from storage.
+func (h *MemoryHistorian) ReadEvent(ctx context.Context, nodesToRead []ua.HistoryReadValueID, details ua.ReadEventDetails,
+	timestampsToReturn ua.TimestampsToReturn, releaseContinuationPoints bool) ([]ua.HistoryReadResult, ua.StatusCode) {
+	h.RLock()
+	defer h.RUnlock()
+	results := make([]ua.HistoryReadResult, len(nodesToRead))
+	for i, n := range nodesToRead {
+		if releaseContinuationPoints {
+			continue
+		}
+		fieldLists := []ua.HistoryEventFieldList{}
+		for _, e := range h.events[n.NodeID] {
+			if inTimeRange(e.time, details.StartTime, details.EndTime) {
+				fieldLists = append(fieldLists, ua.HistoryEventFieldList{EventFields: e.eventFields})
+			}
+		}
+		if details.NumValuesPerNode > 0 && len(fieldLists) > int(details.NumValuesPerNode) {
+			fieldLists = fieldLists[:details.NumValuesPerNode]
+		}
+		results[i] = ua.HistoryReadResult{HistoryData: ua.HistoryEvent{Events: fieldLists}}
+	}
+	return results, ua.Good
+}
+
+// ReadRawModified reads the raw data values from storage. Reading modified values is not supported.
+func (h *MemoryHistorian) ReadRawModified(ctx context.Context, nodesToRead []ua.HistoryReadValueID, details ua.ReadRawModifiedDetails,
+	timestampsToReturn ua.TimestampsToReturn, releaseContinuationPoints bool) ([]ua.HistoryReadResult, ua.StatusCode) {
+	h.Lock()
+	defer h.Unlock()
+	results := make([]ua.HistoryReadResult, len(nodesToRead))
+	for i, n := range nodesToRead {
+		var values []ua.DataValue
+		if n.ContinuationPoint != "" {
+			cp, ok := h.cps[string(n.ContinuationPoint)]
+			if !ok {
+				results[i] = ua.HistoryReadResult{StatusCode: ua.BadContinuationPointInvalid}
+				continue
+			}
+			delete(h.cps, string(n.ContinuationPoint))
+			if releaseContinuationPoints {
+				continue
+			}
+			values = cp.values
+		} else {
+			if releaseContinuationPoints {
+				continue
+			}
+			if details.IsReadModified {
+				results[i] = ua.HistoryReadResult{StatusCode: ua.BadHistoryOperationUnsupported}
+				continue
+			}
+			values = h.readRaw(n.NodeID, details.StartTime, details.EndTime, details.ReturnBounds)
+		}
+		var cp ua.ByteString
+		if details.NumValuesPerNode > 0 && len(values) > int(details.NumValuesPerNode) {
+			cp = ua.ByteString(getNextNonce(16))
+			h.addContinuationPoint(cp, values[details.NumValuesPerNode:])
+			values = values[:details.NumValuesPerNode]
+		}
+		results[i] = ua.HistoryReadResult{
+			ContinuationPoint: cp,
+			HistoryData:       ua.HistoryData{DataValues: selectTimestamps(values, timestampsToReturn)},
+		}
+	}
+	return results, ua.Good
+}
+
+// addContinuationPoint stores the remaining values of a read. If too many continuation points
+// are stored, the oldest is released.
+func (h *MemoryHistorian) addContinuationPoint(cp ua.ByteString, values []ua.DataValue) {
+	if len(h.cps) >= maxMemoryHistorianContinuationPoints {
+		var oldest string
+		var created time.Time
+		for k, v := range h.cps {
+			if created.IsZero() || v.created.Before(created) {
+				oldest, created = k, v.created
+			}
+		}
+		delete(h.cps, oldest)
+	}
+	h.cps[string(cp)] = memoryContinuationPoint{created: time.Now(), values: values}
+}
+
+// readRaw returns a copy of the values within the time range. If startTime is after endTime,
+// the values are returned in reverse order. If returnBounds is true, the values are preceded by
+// the value at or before the startTime, and followed by the value at or after the endTime. A
+// bound that is not found is returned as a value with status BadBoundNotFound.
+func (h *MemoryHistorian) readRaw(nodeID ua.NodeID, startTime, endTime time.Time, returnBounds bool) []ua.DataValue {
+	reverse := !startTime.IsZero() && !endTime.IsZero() && startTime.After(endTime)
+	if reverse {
+		startTime, endTime = endTime, startTime
+	}
+	values := []ua.DataValue{}
+	var first, last *ua.DataValue
+	stored := h.values[nodeID]
+	for i, v := range stored {
+		if inTimeRange(v.SourceTimestamp, startTime, endTime) {
+			values = append(values, v)
+			continue
+		}
+		if !startTime.IsZero() && v.SourceTimestamp.Before(startTime) {
+			first = &stored[i]
+			continue
+		}
+		if last == nil && !endTime.IsZero() && !v.SourceTimestamp.Before(endTime) {
+			last = &stored[i]
+		}
+	}
+	if returnBounds {
+		if !startTime.IsZero() && (len(values) == 0 || !values[0].SourceTimestamp.Equal(startTime)) {
+			bound := ua.NewDataValue(nil, ua.BadBoundNotFound, startTime, 0, time.Time{}, 0)
+			if first != nil {
+				bound = *first
+			}
+			values = append([]ua.DataValue{bound}, values...)
+		}
+		if !endTime.IsZero() {
+			bound := ua.NewDataValue(nil, ua.BadBoundNotFound, endTime, 0, time.Time{}, 0)
+			if last != nil {
+				bound = *last
+			}
+			values = append(values, bound)
+		}
+	}
+	if reverse {
+		for i, j := 0, len(values)-1; i < j; i, j = i+1, j-1 {
+			values[i], values[j] = values[j], values[i]
+		}
+	}
+	return values
+}
+
+// ReadProcessed is not supported.
+func (h *MemoryHistorian) ReadProcessed(ctx context.Context, nodesToRead []ua.HistoryReadValueID, details ua.ReadProcessedDetails,
+	timestampsToReturn ua.TimestampsToReturn, releaseContinuationPoints bool) ([]ua.HistoryReadResult, ua.StatusCode) {
+	results := make([]ua.HistoryReadResult, len(nodesToRead))
+	for i := range nodesToRead {
+		results[i] = ua.HistoryReadResult{StatusCode: ua.BadHistoryOperationUnsupported}
+	}
+	return results, ua.Good
+}
+
+// ReadAtTime reads the values at the requested times. The value at a time is the last value
+// with a SourceTimestamp at or before that time.
+func (h *MemoryHistorian) ReadAtTime(ctx context.Context, nodesToRead []ua.HistoryReadValueID, details ua.ReadAtTimeDetails,
+	timestampsToReturn ua.TimestampsToReturn, releaseContinuationPoints bool) ([]ua.HistoryReadResult, ua.StatusCode) {
+	h.RLock()
+	defer h.RUnlock()
+	results := make([]ua.HistoryReadResult, len(nodesToRead))
+	for i, n := range nodesToRead {
+		if releaseContinuationPoints {
+			continue
+		}
+		stored := h.values[n.NodeID]
+		values := make([]ua.DataValue, len(details.ReqTimes))
+		for j, t := range details.ReqTimes {
+			k := sort.Search(len(stored), func(k int) bool { return stored[k].SourceTimestamp.After(t) })
+			if k == 0 {
+				values[j] = ua.NewDataValue(nil, ua.BadNoData, t, 0, time.Time{}, 0)
+				continue
+			}
+			v := stored[k-1]
+			v.SourceTimestamp = t
+			values[j] = v
+		}
+		results[i] = ua.HistoryReadResult{HistoryData: ua.HistoryData{DataValues: selectTimestamps(values, timestampsToReturn)}}
+	}
+	return results, ua.Good
+}
+
+// inTimeRange returns true if t is between startTime (inclusive) and endTime (exclusive).
+// A zero startTime or endTime leaves the range open.
+func inTimeRange(t, startTime, endTime time.Time) bool {
+	if !startTime.IsZero() && t.Before(startTime) {
+		return false
+	}
+	if !endTime.IsZero() && !t.Before(endTime) {
+		return false
+	}
+	return true
+}
@@ -82,10 +82,7 @@ func (n *MethodNode) UserRolePermissions(ctx context.Context) []ua.RolePermissio
 	if len(roles) == 0 {
 		return filteredPermissions
 	}
-	rolePermissions := n.RolePermissions()
-	if rolePermissions == nil {
-		rolePermissions = session.Server().RolePermissions()
-	}
+	rolePermissions := session.Server().effectiveRolePermissions(ctx, n, roles)
 	for _, rp := range rolePermissions {
 		for _, r := range roles {
 			if rp.RoleID == r {
@@ -113,12 +110,22 @@ func (n *MethodNode) SetReferences(value []ua.Reference) {
 
 // Executable returns the Executable attribute of this node.
 func (n *MethodNode) Executable() bool {
-	return n.executable
+	n.RLock()
+	ret := n.executable
+	n.RUnlock()
+	return ret
+}
+
+// SetExecutable sets the Executable attribute of this node.
+func (n *MethodNode) SetExecutable(value bool) {
+	n.Lock()
+	n.executable = value
+	n.Unlock()
 }
 
 // UserExecutable returns the UserExecutable attribute of this node.
 func (n *MethodNode) UserExecutable(ctx context.Context) bool {
-	if !n.executable {
+	if !n.Executable() {
 		return false
 	}
 	session, ok := ctx.Value(SessionKey).(*Session)
@@ -126,10 +133,7 @@ func (n *MethodNode) UserExecutable(ctx context.Context) bool {
 		return false
 	}
 	roles := session.UserRoles()
-	rolePermissions := n.RolePermissions()
-	if rolePermissions == nil {
-		rolePermissions = session.Server().RolePermissions()
-	}
+	rolePermissions := session.Server().effectiveRolePermissions(ctx, n, roles)
 	for _, role := range roles {
 		for _, rp := range rolePermissions {
 			if rp.RoleID == role && rp.Permissions&ua.PermissionTypeCall != 0 {
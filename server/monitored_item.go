@@ -18,6 +18,11 @@ var (
 	monitoredItemID = uint32(0)
 )
 
+// NotificationInterceptorFunc returns the value to send to the client in a data change notification.
+// The context holds the session, so the value may be masked or rounded based on the user's roles.
+// The func is called while publishing, so it should return quickly.
+type NotificationInterceptorFunc func(ctx context.Context, item MonitoredItem, value ua.DataValue) ua.DataValue
+
 // MonitoredItem specifies a node that is monitored
 type MonitoredItem interface {
 	ID() uint32
@@ -0,0 +1,257 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/awcullen/opcua/ua"
+)
+
+// MQTT 3.1.1 control packet types.
+// See http://docs.oasis-open.org/mqtt/mqtt/v3.1.1/os/mqtt-v3.1.1-os.html
+const (
+	mqttConnect    byte = 0x10
+	mqttConnack    byte = 0x20
+	mqttPublish    byte = 0x30
+	mqttPuback     byte = 0x40
+	mqttDisconnect byte = 0xE0
+)
+
+// MQTTBrokerConfig configures the connection of an MQTTTransport to an MQTT broker.
+type MQTTBrokerConfig struct {
+	// Address is the host and port of the broker, e.g. "broker.example.com:1883".
+	Address string
+	// ClientID identifies the client to the broker. If empty, the broker assigns one.
+	ClientID string
+	// UserName and Password authenticate the client, if UserName is not empty.
+	UserName string
+	Password string
+	// TLSConfig, if not nil, secures the connection with TLS.
+	TLSConfig *tls.Config
+	// QoS is the quality of service of the published messages, 0 (at most once) or 1 (at least once).
+	// With QoS 1, Publish waits for the broker to acknowledge the message.
+	QoS byte
+	// Retain asks the broker to keep the last message of the topic for new subscribers.
+	Retain bool
+	// KeepAlive is the keep alive interval sent to the broker, or 0 to disable it. The transport does
+	// not ping the broker, so the interval must be longer than the publishing interval.
+	KeepAlive time.Duration
+	// DialTimeout is the timeout of connecting to the broker. Defaults to 10 seconds.
+	DialTimeout time.Duration
+}
+
+// MQTTTransport is a PubSubTransport that publishes to an MQTT broker using MQTT 3.1.1. The transport
+// connects when the first message is published, and connects again after an error.
+// See https://reference.opcfoundation.org/v104/Core/docs/Part14/7.3.5/
+type MQTTTransport struct {
+	sync.Mutex
+	config   MQTTBrokerConfig
+	conn     net.Conn
+	reader   *bufio.Reader
+	packetID uint16
+}
+
+var _ PubSubTransport = (*MQTTTransport)(nil)
+
+// NewMQTTTransport constructs a new MQTTTransport to the broker.
+func NewMQTTTransport(config MQTTBrokerConfig) *MQTTTransport {
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = 10 * time.Second
+	}
+	if config.QoS > 1 {
+		config.QoS = 1
+	}
+	return &MQTTTransport{config: config}
+}
+
+// Publish sends the payload to the topic of the broker. Returns BadConnectionRejected if the broker
+// refuses the connection, or BadCommunicationError if the broker does not follow the protocol.
+func (t *MQTTTransport) Publish(ctx context.Context, topic string, payload []byte) error {
+	t.Lock()
+	defer t.Unlock()
+	if t.conn == nil {
+		if err := t.connect(ctx); err != nil {
+			return err
+		}
+	}
+	if err := t.publish(ctx, topic, payload); err != nil {
+		// close the connection, so the next message connects again.
+		t.conn.Close()
+		t.conn = nil
+		return err
+	}
+	return nil
+}
+
+// Close disconnects from the broker.
+func (t *MQTTTransport) Close() error {
+	t.Lock()
+	defer t.Unlock()
+	if t.conn == nil {
+		return nil
+	}
+	t.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	t.conn.Write([]byte{mqttDisconnect, 0})
+	err := t.conn.Close()
+	t.conn = nil
+	return err
+}
+
+// connect opens the connection to the broker, and sends the CONNECT packet. The caller must hold the lock.
+func (t *MQTTTransport) connect(ctx context.Context) error {
+	dialer := &net.Dialer{Timeout: t.config.DialTimeout}
+	var conn net.Conn
+	var err error
+	if t.config.TLSConfig != nil {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: t.config.TLSConfig}).DialContext(ctx, "tcp", t.config.Address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", t.config.Address)
+	}
+	if err != nil {
+		return err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(t.config.DialTimeout)
+	}
+	conn.SetDeadline(deadline)
+
+	flags := byte(0x02) // clean session
+	body := mqttString(nil, "MQTT")
+	body = append(body, 4) // protocol level 3.1.1
+	if t.config.UserName != "" {
+		flags |= 0x80 | 0x40
+	}
+	body = append(body, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(t.config.KeepAlive/time.Second))
+	body = mqttString(body, t.config.ClientID)
+	if t.config.UserName != "" {
+		body = mqttString(body, t.config.UserName)
+		body = mqttString(body, t.config.Password)
+	}
+	if _, err := conn.Write(mqttPacket(mqttConnect, body)); err != nil {
+		conn.Close()
+		return err
+	}
+	reader := bufio.NewReader(conn)
+	typ, ack, err := mqttReadPacket(reader)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if typ&0xF0 != mqttConnack || len(ack) != 2 {
+		conn.Close()
+		return ua.BadCommunicationError
+	}
+	if ack[1] != 0 {
+		conn.Close()
+		return ua.BadConnectionRejected
+	}
+	t.conn = conn
+	t.reader = reader
+	return nil
+}
+
+// publish sends the PUBLISH packet, and waits for the PUBACK with QoS 1. The caller must hold the lock.
+func (t *MQTTTransport) publish(ctx context.Context, topic string, payload []byte) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(t.config.DialTimeout)
+	}
+	t.conn.SetDeadline(deadline)
+	header := mqttPublish | t.config.QoS<<1
+	if t.config.Retain {
+		header |= 0x01
+	}
+	body := mqttString(nil, topic)
+	var id uint16
+	if t.config.QoS > 0 {
+		t.packetID++
+		if t.packetID == 0 {
+			t.packetID = 1
+		}
+		id = t.packetID
+		body = binary.BigEndian.AppendUint16(body, id)
+	}
+	body = append(body, payload...)
+	if _, err := t.conn.Write(mqttPacket(header, body)); err != nil {
+		return err
+	}
+	if t.config.QoS == 0 {
+		return nil
+	}
+	for {
+		typ, ack, err := mqttReadPacket(t.reader)
+		if err != nil {
+			return err
+		}
+		if typ&0xF0 != mqttPuback || len(ack) != 2 {
+			return ua.BadCommunicationError
+		}
+		if binary.BigEndian.Uint16(ack) == id {
+			return nil
+		}
+	}
+}
+
+// mqttString appends the length prefixed UTF-8 string to the buffer.
+func mqttString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// mqttPacket returns the packet with the fixed header and the body.
+func mqttPacket(header byte, body []byte) []byte {
+	b := make([]byte, 0, 5+len(body))
+	b = append(b, header)
+	// the remaining length is encoded with 7 bits per byte, least significant first.
+	n := len(body)
+	for {
+		d := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			d |= 0x80
+		}
+		b = append(b, d)
+		if n == 0 {
+			break
+		}
+	}
+	return append(b, body...)
+}
+
+// mqttReadPacket reads a packet, and returns the first byte of the fixed header and the body.
+func mqttReadPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, shift := 0, 0
+	for {
+		d, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n |= int(d&0x7F) << shift
+		if d&0x80 == 0 {
+			break
+		}
+		shift += 7
+		if shift > 21 {
+			return 0, nil, ua.BadCommunicationError
+		}
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
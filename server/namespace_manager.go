@@ -3,15 +3,20 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/xml"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/awcullen/opcua/ua"
@@ -20,7 +25,8 @@ import (
 )
 
 var (
-	hasChildandSubtypes = []ua.NodeID{ua.ReferenceTypeIDHasComponent, ua.ReferenceTypeIDHasProperty, ua.ReferenceTypeIDHasSubtype, ua.ReferenceTypeIDHasOrderedComponent}
+	hasChildandSubtypes  = []ua.NodeID{ua.ReferenceTypeIDHasComponent, ua.ReferenceTypeIDHasProperty, ua.ReferenceTypeIDHasSubtype, ua.ReferenceTypeIDHasOrderedComponent}
+	organizesandHasChild = []ua.NodeID{ua.ReferenceTypeIDOrganizes, ua.ReferenceTypeIDHasComponent, ua.ReferenceTypeIDHasProperty, ua.ReferenceTypeIDHasOrderedComponent}
 )
 
 // NamespaceManager manages the namespaces for a server.
@@ -30,6 +36,23 @@ type NamespaceManager struct {
 	namespaces     []string
 	nodes          map[ua.NodeID]Node
 	variantTypeMap map[ua.NodeID]byte
+	conditionsLock sync.Mutex
+	conditions     map[conditionKey]retainedCondition
+	alarms         map[ua.NodeID]*AlarmCondition
+	removals       atomic.Uint64
+	versionChanges []func()
+}
+
+// conditionKey identifies a branch of a condition.
+type conditionKey struct {
+	conditionID ua.NodeID
+	branchID    ua.NodeID
+}
+
+// retainedCondition is the last event of a condition with Retain set, and the notifiers that reported it.
+type retainedCondition struct {
+	evt       ua.Event
+	notifiers map[ua.NodeID]struct{}
 }
 
 // NewNamespaceManager instantiates a new NamespaceManager.
@@ -39,6 +62,8 @@ func NewNamespaceManager(server *Server) *NamespaceManager {
 		namespaces:     []string{"http://opcfoundation.org/UA/", server.LocalDescription().ApplicationURI},
 		nodes:          make(map[ua.NodeID]Node, 4096),
 		variantTypeMap: make(map[ua.NodeID]byte, 32),
+		conditions:     make(map[conditionKey]retainedCondition),
+		alarms:         make(map[ua.NodeID]*AlarmCondition),
 	}
 }
 
@@ -347,8 +372,28 @@ func toEnumValues(v []ua.ExtensionObject) []ua.EnumValueType {
 }
 
 func (m *NamespaceManager) addNodes(nodes []Node) error {
+	// reject the nodes if any NodeID is already registered, or appears twice.
+	ids := make(map[ua.NodeID]struct{}, len(nodes))
+	for _, node := range nodes {
+		id := node.NodeID()
+		if _, ok := m.nodes[id]; ok {
+			log.Printf("Error adding node: %s already exists\n", id)
+			return ua.BadNodeIDExists
+		}
+		if _, ok := ids[id]; ok {
+			log.Printf("Error adding node: %s already exists\n", id)
+			return ua.BadNodeIDExists
+		}
+		ids[id] = struct{}{}
+	}
 	for _, node := range nodes {
 		m.nodes[node.NodeID()] = node
+		switch n := node.(type) {
+		case *DataTypeNode:
+			registerDataTypeDefinition(n, m.namespaces)
+		case *ObjectNode:
+			n.setManager(m)
+		}
 	}
 	// add inverse refs of added nodes
 	for _, node := range nodes {
@@ -373,6 +418,9 @@ func (m *NamespaceManager) addNodes(nodes []Node) error {
 						IsInverse:       !r.IsInverse,
 						TargetID:        ua.NewExpandedNodeID(id)}
 					t.SetReferences(append(t.References(), inverseRef))
+					if node.BrowseName() != nodeVersionName {
+						m.incrementNodeVersion(t)
+					}
 				}
 			} else {
 				log.Printf("Error finding reference target: %s\n", r.TargetID)
@@ -384,20 +432,139 @@ func (m *NamespaceManager) addNodes(nodes []Node) error {
 
 // AddNodes adds the nodes to the namespace.
 // This method adds the inverse refs as well.
+// If the NodeID of a node is already registered, no nodes are added and BadNodeIDExists is returned.
 func (m *NamespaceManager) AddNodes(nodes ...Node) error {
 	m.Lock()
-	defer m.Unlock()
+	defer m.unlockAndNotify()
 	return m.addNodes(nodes)
 }
 
 // AddNode adds the node to the namespace.
 // This method adds the inverse refs as well.
+// If the NodeID of the node is already registered, BadNodeIDExists is returned.
 func (m *NamespaceManager) AddNode(node Node) error {
 	m.Lock()
-	defer m.Unlock()
+	defer m.unlockAndNotify()
 	return m.addNodes([]Node{node})
 }
 
+// AddProperty adds a property with the given browseName, dataType and value to the parent node.
+// The property is readable by clients, and is linked to the parent with a HasProperty reference.
+// If the parent has a string NodeID, the property's NodeID is the parent's NodeID followed by
+// '.' and the name, e.g. "ns=2;s=Demo.Level.EURange", else a new GUID in the parent's namespace.
+// If a node with the same NodeID is already registered, BadNodeIDExists is returned.
+func (m *NamespaceManager) AddProperty(parent Node, browseName ua.QualifiedName, dataType ua.NodeID, value ua.DataValue) (*VariableNode, error) {
+	id, err := childNodeID(parent, browseName.Name)
+	if err != nil {
+		return nil, err
+	}
+	valueRank, arrayDimensions := ua.ValueRankScalar, []uint32{}
+	switch value.Value.(type) {
+	case nil, ua.ByteString:
+	default:
+		if reflect.TypeOf(value.Value).Kind() == reflect.Slice {
+			valueRank, arrayDimensions = ua.ValueRankOneDimension, []uint32{0}
+		}
+	}
+	property := NewVariableNode(
+		id,
+		browseName,
+		ua.NewLocalizedText(browseName.Name, ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.VariableTypeIDPropertyType)),
+			ua.NewReference(ua.ReferenceTypeIDHasProperty, true, ua.NewExpandedNodeID(parent.NodeID())),
+		},
+		value,
+		dataType,
+		valueRank,
+		arrayDimensions,
+		ua.AccessLevelsCurrentRead,
+		0,
+		false,
+		nil,
+	)
+	if err := m.AddNode(property); err != nil {
+		return nil, err
+	}
+	return property, nil
+}
+
+// childNodeID returns the NodeID of a child of the parent. If the parent has a string NodeID, the
+// child's NodeID is the parent's NodeID followed by '.' and the name, else a new GUID in the parent's namespace.
+func childNodeID(parent Node, name string) (ua.NodeID, error) {
+	switch pid := parent.NodeID().(type) {
+	case ua.NodeIDString:
+		return ua.NewNodeIDString(pid.NamespaceIndex, pid.ID+"."+name), nil
+	case ua.NodeIDNumeric:
+		return ua.NewNodeIDGUID(pid.NamespaceIndex, uuid.New()), nil
+	case ua.NodeIDGUID:
+		return ua.NewNodeIDGUID(pid.NamespaceIndex, uuid.New()), nil
+	case ua.NodeIDOpaque:
+		return ua.NewNodeIDGUID(pid.NamespaceIndex, uuid.New()), nil
+	default:
+		return nil, ua.BadNodeIDInvalid
+	}
+}
+
+// nodeVersionName is the BrowseName of the NodeVersion property.
+var nodeVersionName = ua.NewQualifiedName(0, "NodeVersion")
+
+// AddNodeVersion adds a NodeVersion property to the node, starting at "0". The version is incremented
+// whenever AddNodes or DeleteNodes adds or removes a reference of the node, e.g. a child of a folder,
+// so clients that subscribe to the property are notified of structural changes.
+func (m *NamespaceManager) AddNodeVersion(node Node) (*VariableNode, error) {
+	return m.AddProperty(node, nodeVersionName, ua.DataTypeIDString, ua.NewDataValue("0", 0, time.Now(), 0, time.Now(), 0))
+}
+
+// NodeVersion returns the value of the NodeVersion property of the node.
+// Returns false if the node has no NodeVersion property.
+func (m *NamespaceManager) NodeVersion(node Node) (string, bool) {
+	p, ok := m.FindProperty(node, nodeVersionName)
+	if !ok {
+		return "", false
+	}
+	v, ok := p.Value().Value.(string)
+	return v, ok
+}
+
+// IncrementNodeVersion increments the NodeVersion property of the node, if present. Call this
+// after changing the references of the node with SetReferences.
+func (m *NamespaceManager) IncrementNodeVersion(node Node) {
+	m.Lock()
+	defer m.unlockAndNotify()
+	m.incrementNodeVersion(node)
+}
+
+// incrementNodeVersion increments the NodeVersion property of the node. The caller must hold the write
+// lock, so concurrent increments are not lost, and release it with unlockAndNotify.
+func (m *NamespaceManager) incrementNodeVersion(node Node) {
+	for _, r := range node.References() {
+		if !r.IsInverse && r.ReferenceTypeID == ua.ReferenceTypeIDHasProperty {
+			p, ok := m.nodes[ua.ToNodeID(r.TargetID, m.namespaces)].(*VariableNode)
+			if ok && p.BrowseName() == nodeVersionName {
+				s, _ := p.Value().Value.(string)
+				v, _ := strconv.ParseUint(s, 10, 64)
+				notify := p.storeValue(ua.NewDataValue(strconv.FormatUint(v+1, 10), 0, time.Now(), 0, time.Now(), 0))
+				m.versionChanges = append(m.versionChanges, notify)
+				return
+			}
+		}
+	}
+}
+
+// unlockAndNotify releases the write lock, then notifies the value changed handlers of the NodeVersion
+// properties that were incremented while it was held. The handlers may use the namespace manager.
+func (m *NamespaceManager) unlockAndNotify() {
+	changes := m.versionChanges
+	m.versionChanges = nil
+	m.Unlock()
+	for _, notify := range changes {
+		notify()
+	}
+}
+
 // DeleteNodes removes the nodes from the namespace.
 // This method removes the inverse refs as well.
 func (m *NamespaceManager) DeleteNodes(nodes []Node, deleteChildren bool) error {
@@ -412,7 +579,7 @@ func (m *NamespaceManager) DeleteNodes(nodes []Node, deleteChildren bool) error
 	for _, node := range nodes {
 		m.deleteNodeandInverseReferences(node, m.namespaces)
 	}
-	m.Unlock()
+	m.unlockAndNotify()
 	return nil
 }
 
@@ -433,16 +600,126 @@ func (m *NamespaceManager) deleteNodeandInverseReferences(node Node, uris []stri
 				refs = append(refs, tr)
 			}
 			t.SetReferences(refs)
+			m.incrementNodeVersion(t)
 			// log.Printf("Removing reference source: %s, target: %s, type: %s, isInverse: %t\n", t.NodeID(), id, r.ReferenceTypeID, !r.IsInverse)
 		} else {
 			log.Printf("Error finding reference target: %s\n", r.TargetID)
 		}
 	}
 	// delete node from namespace.
+	if n, ok := m.nodes[id].(*ObjectNode); ok && n == node {
+		n.setManager(nil)
+	}
 	delete(m.nodes, id)
+	m.removals.Add(1)
 	return nil
 }
 
+// removalCount returns the number of nodes removed from the namespace. A node found before the count
+// last changed may have been removed.
+func (m *NamespaceManager) removalCount() uint64 {
+	return m.removals.Load()
+}
+
+// deleteNodeItem removes the node from the namespace as requested by the DeleteNodes service.
+// If deleteTargetReferences is true, the children of the node are removed as well, and so are the
+// references of other nodes that target the node. A child that has another parent is kept, and
+// BadUserAccessDenied is returned if any child may not be deleted. Otherwise, only the node and its
+// properties are removed, and BadNoDeleteRights is returned if the node still has children.
+func (m *NamespaceManager) deleteNodeItem(node Node, deleteTargetReferences bool, permitted func(Node) bool) ua.StatusCode {
+	var children []Node
+	if deleteTargetReferences {
+		// check the permissions without holding the lock, the access policy may look up nodes.
+		m.RLock()
+		children = m.childrenToDelete(node)
+		m.RUnlock()
+		for _, child := range children {
+			if !permitted(child) {
+				return ua.BadUserAccessDenied
+			}
+		}
+	}
+	m.Lock()
+	defer m.unlockAndNotify()
+	id := node.NodeID()
+	if _, ok := m.nodes[id]; !ok {
+		return ua.BadNodeIDUnknown
+	}
+	if !deleteTargetReferences {
+		for _, r := range node.References() {
+			if !r.IsInverse && r.ReferenceTypeID != ua.ReferenceTypeIDHasProperty && Contains(organizesandHasChild, r.ReferenceTypeID) {
+				if _, ok := m.nodes[ua.ToNodeID(r.TargetID, m.namespaces)]; ok {
+					return ua.BadNoDeleteRights
+				}
+			}
+		}
+		children = m.GetChildren(node, m.namespaces, []ua.NodeID{ua.ReferenceTypeIDHasProperty})
+	}
+	deleted := map[ua.NodeID]struct{}{id: {}}
+	for _, child := range children {
+		deleted[child.NodeID()] = struct{}{}
+		m.deleteNodeandInverseReferences(child, m.namespaces)
+	}
+	m.deleteNodeandInverseReferences(node, m.namespaces)
+	m.deleteAlarmConditions(deleted)
+	if deleteTargetReferences {
+		// remove one-way references that remain in other nodes.
+		for _, n := range m.nodes {
+			refs := n.References()
+			kept := make([]ua.Reference, 0, len(refs))
+			for _, r := range refs {
+				if _, ok := deleted[ua.ToNodeID(r.TargetID, m.namespaces)]; !ok {
+					kept = append(kept, r)
+				}
+			}
+			if len(kept) < len(refs) {
+				n.SetReferences(kept)
+				m.incrementNodeVersion(n)
+			}
+		}
+	}
+	return ua.Good
+}
+
+// childrenToDelete returns the descendants of the node that are reached by HasChild references, and
+// that have no parent other than the node and its descendants. Each node is visited once, so cycles
+// end. The caller must hold the lock.
+func (m *NamespaceManager) childrenToDelete(node Node) []Node {
+	parentTypes := append([]ua.NodeID{ua.ReferenceTypeIDOrganizes}, hasChildandSubtypes...)
+	visited := map[ua.NodeID]struct{}{node.NodeID(): {}}
+	children := []Node{}
+	queue := deque.Deque[Node]{}
+	queue.PushBack(node)
+	for queue.Len() > 0 {
+		n := queue.PopFront()
+	next:
+		for _, r := range n.References() {
+			if r.IsInverse || !Contains(hasChildandSubtypes, r.ReferenceTypeID) {
+				continue
+			}
+			child, ok := m.nodes[ua.ToNodeID(r.TargetID, m.namespaces)]
+			if !ok {
+				continue
+			}
+			if _, ok := visited[child.NodeID()]; ok {
+				continue
+			}
+			// keep a child that is still organized or owned by another node.
+			for _, r2 := range child.References() {
+				if r2.IsInverse && Contains(parentTypes, r2.ReferenceTypeID) {
+					if _, ok := visited[ua.ToNodeID(r2.TargetID, m.namespaces)]; !ok {
+						continue next
+					}
+				}
+			}
+			visited[child.NodeID()] = struct{}{}
+			children = append(children, child)
+			queue.PushBack(child)
+		}
+	}
+	return children
+}
+
 // DeleteNode removes the node from the namespace.
 // This method removes the inverse refs as well.
 func (m *NamespaceManager) DeleteNode(node Node, deleteChildren bool) error {
@@ -492,29 +769,178 @@ func (m *NamespaceManager) GetChildren(node Node, uris []string, withRefTypes []
 	return children
 }
 
-// OnEvent raises the event, starting from the target node, follows HasNotifier references until the Server node.
-func (m *NamespaceManager) OnEvent(target *ObjectNode, evt ua.Event) error {
-	for target.nodeID != ua.ObjectIDServer {
-		target.OnEvent(evt)
-		found := false
-		for _, r := range target.References() {
-			if r.IsInverse && r.ReferenceTypeID == ua.ReferenceTypeIDHasNotifier {
-				if target1, ok1 := m.FindObject(ua.ToNodeID(r.TargetID, m.NamespaceUris())); ok1 {
-					found = true
-					target = target1
-					break
-				}
-				return ua.BadNodeIDUnknown
+// findInstances returns the Objects and Variables whose type definition is the type, or a subtype of
+// the type if includeSubtypes. The nodes are ordered by NodeID.
+func (m *NamespaceManager) findInstances(typeID ua.NodeID, includeSubtypes bool) []Node {
+	type instance struct {
+		node   Node
+		typeID ua.NodeID
+	}
+	m.RLock()
+	instances := []instance{}
+	for _, n := range m.nodes {
+		if nc := n.NodeClass(); nc != ua.NodeClassObject && nc != ua.NodeClassVariable {
+			continue
+		}
+		for _, r := range n.References() {
+			if !r.IsInverse && r.ReferenceTypeID == ua.ReferenceTypeIDHasTypeDefinition {
+				instances = append(instances, instance{n, ua.ToNodeID(r.TargetID, m.namespaces)})
+				break
 			}
 		}
-		if !found {
-			return nil
+	}
+	m.RUnlock()
+	matches := map[ua.NodeID]bool{typeID: true}
+	nodes := []Node{}
+	keys := []string{}
+	for _, i := range instances {
+		match, ok := matches[i.typeID]
+		if !ok {
+			match = includeSubtypes && m.IsSubtype(i.typeID, typeID)
+			matches[i.typeID] = match
+		}
+		if match {
+			nodes = append(nodes, i.node)
+			keys = append(keys, fmt.Sprint(i.node.NodeID()))
+		}
+	}
+	sort.Sort(byKey{nodes, keys})
+	return nodes
+}
+
+// byKey sorts nodes by the given keys.
+type byKey struct {
+	nodes []Node
+	keys  []string
+}
+
+func (s byKey) Len() int           { return len(s.nodes) }
+func (s byKey) Less(i, j int) bool { return s.keys[i] < s.keys[j] }
+func (s byKey) Swap(i, j int) {
+	s.nodes[i], s.nodes[j] = s.nodes[j], s.nodes[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
+
+// FilterReferences returns the references of the node that match the reference type and browse direction.
+// If refTypeID is nil, references of all types match; if includeSubtypes, references of subtypes of
+// refTypeID match too. If nodeClassMask is not zero, only references to targets of those node classes match.
+func (m *NamespaceManager) FilterReferences(node Node, refTypeID ua.NodeID, includeSubtypes bool, dir ua.BrowseDirection, nodeClassMask uint32) []ua.Reference {
+	refs := node.References()
+	matches := make([]ua.Reference, 0, len(refs))
+	uris := m.NamespaceUris()
+	for _, r := range refs {
+		switch dir {
+		case ua.BrowseDirectionForward:
+			if r.IsInverse {
+				continue
+			}
+		case ua.BrowseDirectionInverse:
+			if !r.IsInverse {
+				continue
+			}
+		case ua.BrowseDirectionBoth:
+		default:
+			continue
+		}
+		if !(refTypeID == nil || refTypeID == r.ReferenceTypeID || (includeSubtypes && m.IsSubtype(r.ReferenceTypeID, refTypeID))) {
+			continue
+		}
+		if nodeClassMask != 0 {
+			t, ok := m.FindNode(ua.ToNodeID(r.TargetID, uris))
+			if !ok || nodeClassMask&uint32(t.NodeClass()) == 0 {
+				continue
+			}
+		}
+		matches = append(matches, r)
+	}
+	return matches
+}
+
+// OnEvent raises the event from the source node. The event is reported to the source, then follows
+// inverse HasEventSource and HasNotifier references (and their subtypes) to the notifiers of the
+// source, and inverse Organizes references to objects that are event notifiers, e.g. an area
+// folder, up to the Server object. Each notifier reports the event once, even if it is reached
+// by several paths. The Server object reports all events. The last event of a condition is kept
+// while its Retain field is true, for ConditionRefresh.
+func (m *NamespaceManager) OnEvent(source *ObjectNode, evt ua.Event) error {
+	uris := m.NamespaceUris()
+	visited := map[ua.NodeID]struct{}{source.NodeID(): {}}
+	queue := deque.Deque[*ObjectNode]{}
+	queue.PushBack(source)
+	for queue.Len() > 0 {
+		n := queue.PopFront()
+		n.OnEvent(evt)
+		for _, r := range n.References() {
+			if !r.IsInverse {
+				continue
+			}
+			isOrganizes := r.ReferenceTypeID == ua.ReferenceTypeIDOrganizes
+			if !isOrganizes && r.ReferenceTypeID != ua.ReferenceTypeIDHasEventSource && r.ReferenceTypeID != ua.ReferenceTypeIDHasNotifier && !m.IsSubtype(r.ReferenceTypeID, ua.ReferenceTypeIDHasEventSource) {
+				continue
+			}
+			id := ua.ToNodeID(r.TargetID, uris)
+			if _, ok := visited[id]; ok {
+				continue
+			}
+			notifier, ok := m.FindObject(id)
+			if !ok {
+				continue
+			}
+			if isOrganizes && (notifier.EventNotifier()&ua.EventNotifierSubscribeToEvents) == 0 {
+				continue
+			}
+			visited[id] = struct{}{}
+			queue.PushBack(notifier)
 		}
 	}
-	target.OnEvent(evt)
+	if _, ok := visited[ua.ObjectIDServer]; !ok {
+		if n, ok := m.FindObject(ua.ObjectIDServer); ok {
+			n.OnEvent(evt)
+		}
+		visited[ua.ObjectIDServer] = struct{}{}
+	}
+	m.retainCondition(evt, visited)
 	return nil
 }
 
+var (
+	attributeOperandConditionID = ua.SimpleAttributeOperand{TypeDefinitionID: ua.ObjectTypeIDConditionType, BrowsePath: ua.ParseBrowsePath(""), AttributeID: ua.AttributeIDNodeID}
+	attributeOperandBranchID    = ua.SimpleAttributeOperand{TypeDefinitionID: ua.ObjectTypeIDConditionType, BrowsePath: ua.ParseBrowsePath("BranchId"), AttributeID: ua.AttributeIDValue}
+	attributeOperandRetain      = ua.SimpleAttributeOperand{TypeDefinitionID: ua.ObjectTypeIDConditionType, BrowsePath: ua.ParseBrowsePath("Retain"), AttributeID: ua.AttributeIDValue}
+)
+
+// retainCondition stores the event of a condition while its Retain field is true, so ConditionRefresh
+// can report the current state of the condition to the notifiers. Events that are not conditions are ignored.
+func (m *NamespaceManager) retainCondition(evt ua.Event, notifiers map[ua.NodeID]struct{}) {
+	conditionID, ok := evt.GetAttribute(attributeOperandConditionID).(ua.NodeID)
+	if !ok || conditionID == nil {
+		return
+	}
+	branchID, _ := evt.GetAttribute(attributeOperandBranchID).(ua.NodeID)
+	key := conditionKey{conditionID, branchID}
+	m.conditionsLock.Lock()
+	defer m.conditionsLock.Unlock()
+	if retain, _ := evt.GetAttribute(attributeOperandRetain).(bool); !retain {
+		delete(m.conditions, key)
+		return
+	}
+	m.conditions[key] = retainedCondition{evt, notifiers}
+}
+
+// RetainedConditions returns the last event of each condition with Retain set that was reported
+// by the notifier.
+func (m *NamespaceManager) RetainedConditions(notifierID ua.NodeID) []ua.Event {
+	m.conditionsLock.Lock()
+	defer m.conditionsLock.Unlock()
+	evts := []ua.Event{}
+	for _, c := range m.conditions {
+		if _, ok := c.notifiers[notifierID]; ok {
+			evts = append(evts, c.evt)
+		}
+	}
+	return evts
+}
+
 // Any returns true if the given function returns true for any of the given nodes.
 func Any(nodes []ua.NodeID, f func(n ua.NodeID) bool) bool {
 	for _, n := range nodes {
@@ -547,12 +973,28 @@ func (m *NamespaceManager) LoadNodeSetFromFile(path string) error {
 
 // LoadNodeSetFromBuffer loads the UANodeSet XML from a buffer into the namespace.
 func (m *NamespaceManager) LoadNodeSetFromBuffer(buf []byte) error {
-	set := &ua.UANodeSet{}
-	err := xml.Unmarshal(buf, &set)
+	nodes, err := m.ImportNodeSet2(bytes.NewReader(buf))
 	if err != nil {
 		log.Printf("Error decoding nodeset. %s\n", err)
 		return err
 	}
+	err = m.AddNodes(nodes...)
+	if err != nil {
+		log.Printf("Error adding nodes. %s\n", err)
+		return err
+	}
+	return nil
+}
+
+// ImportNodeSet2 reads the UANodeSet XML and returns the nodes, ready to add to the namespace.
+// The aliases are resolved, and the namespace URIs of the nodeset are mapped to the namespaces
+// of the server, adding the namespace URIs that are missing. References, DataTypeDefinitions and
+// initial values may refer to nodes that appear later in the nodeset, or to nodes of the namespace.
+func (m *NamespaceManager) ImportNodeSet2(r io.Reader) ([]Node, error) {
+	set := &ua.UANodeSet{}
+	if err := xml.NewDecoder(r).Decode(set); err != nil {
+		return nil, err
+	}
 
 	nsMap := make(map[uint16]uint16, 8)
 	ns1 := m.NamespaceUris()
@@ -573,11 +1015,24 @@ func (m *NamespaceManager) LoadNodeSetFromBuffer(buf []byte) error {
 		aliases[a.Alias] = a.NodeID
 	}
 
-	nodes := make([]Node, len(set.Nodes))
+	// first pass indexes the nodes of the set, so the second pass can resolve references to nodes that appear later.
+	imp := &nodeSetImport{m: m, nodes: make(map[ua.NodeID]*ua.UANode, len(set.Nodes)), encodings: make(map[ua.NodeID][]ua.NodeID), aliases: aliases, nsMap: nsMap}
 	for i, n := range set.Nodes {
+		id := toNodeID(n.NodeID, aliases, nsMap)
+		imp.nodes[id] = &set.Nodes[i]
+		for _, r := range toRefs(n.References, aliases, nsMap) {
+			if r.IsInverse && r.ReferenceTypeID == ua.ReferenceTypeIDHasEncoding {
+				dataType := ua.ToNodeID(r.TargetID, m.NamespaceUris())
+				imp.encodings[dataType] = append(imp.encodings[dataType], id)
+			}
+		}
+	}
+
+	nodes := make([]Node, 0, len(set.Nodes))
+	for _, n := range set.Nodes {
 		switch n.XMLName.Local {
 		case "UAObjectType":
-			nodes[i] = NewObjectTypeNode(
+			nodes = append(nodes, NewObjectTypeNode(
 				toNodeID(n.NodeID, aliases, nsMap),
 				toBrowseName(n.BrowseName, nsMap),
 				toLocalizedText(n.DisplayName),
@@ -585,23 +1040,27 @@ func (m *NamespaceManager) LoadNodeSetFromBuffer(buf []byte) error {
 				nil,
 				toRefs(n.References, aliases, nsMap),
 				n.IsAbstract,
-			)
+			))
 		case "UAVariableType":
-			nodes[i] = NewVariableTypeNode(
+			nodes = append(nodes, NewVariableTypeNode(
 				toNodeID(n.NodeID, aliases, nsMap),
 				toBrowseName(n.BrowseName, nsMap),
 				toLocalizedText(n.DisplayName),
 				toLocalizedText(n.Description),
 				nil,
 				toRefs(n.References, aliases, nsMap),
-				toDataValue(n.Value, n.DataType, aliases, nsMap, toInt32(n.ValueRank, -1), m),
-				toNodeID(n.DataType, aliases, nsMap),
+				toDataValue(n.NodeID, n.Value, n.DataType, aliases, nsMap, toInt32(n.ValueRank, -1), imp),
+				toDataTypeID(n.DataType, aliases, nsMap),
 				toInt32(n.ValueRank, -1),
 				toDims(n.ArrayDimensions, toInt32(n.ValueRank, -1)),
 				n.IsAbstract,
-			)
+			))
 		case "UADataType":
-			nodes[i] = NewDataTypeNode(
+			var definition interface{}
+			if n.Definition != nil {
+				definition = imp.toDataTypeDefinition(&n, n.Definition)
+			}
+			nodes = append(nodes, NewDataTypeNode(
 				toNodeID(n.NodeID, aliases, nsMap),
 				toBrowseName(n.BrowseName, nsMap),
 				toLocalizedText(n.DisplayName),
@@ -609,10 +1068,10 @@ func (m *NamespaceManager) LoadNodeSetFromBuffer(buf []byte) error {
 				nil,
 				toRefs(n.References, aliases, nsMap),
 				n.IsAbstract,
-				nil,
-			)
+				definition,
+			))
 		case "UAReferenceType":
-			nodes[i] = NewReferenceTypeNode(
+			nodes = append(nodes, NewReferenceTypeNode(
 				toNodeID(n.NodeID, aliases, nsMap),
 				toBrowseName(n.BrowseName, nsMap),
 				toLocalizedText(n.DisplayName),
@@ -622,9 +1081,9 @@ func (m *NamespaceManager) LoadNodeSetFromBuffer(buf []byte) error {
 				n.IsAbstract,
 				n.Symmetric,
 				ua.LocalizedText{Text: n.InverseName},
-			)
+			))
 		case "UAObject":
-			nodes[i] = NewObjectNode(
+			nodes = append(nodes, NewObjectNode(
 				toNodeID(n.NodeID, aliases, nsMap),
 				toBrowseName(n.BrowseName, nsMap),
 				toLocalizedText(n.DisplayName),
@@ -632,26 +1091,26 @@ func (m *NamespaceManager) LoadNodeSetFromBuffer(buf []byte) error {
 				nil,
 				toRefs(n.References, aliases, nsMap),
 				n.EventNotifier,
-			)
+			))
 		case "UAVariable":
-			nodes[i] = NewVariableNode(
+			nodes = append(nodes, NewVariableNode(
 				toNodeID(n.NodeID, aliases, nsMap),
 				toBrowseName(n.BrowseName, nsMap),
 				toLocalizedText(n.DisplayName),
 				toLocalizedText(n.Description),
 				nil,
 				toRefs(n.References, aliases, nsMap),
-				toDataValue(n.Value, n.DataType, aliases, nsMap, toInt32(n.ValueRank, -1), m),
-				toNodeID(n.DataType, aliases, nsMap),
+				toDataValue(n.NodeID, n.Value, n.DataType, aliases, nsMap, toInt32(n.ValueRank, -1), imp),
+				toDataTypeID(n.DataType, aliases, nsMap),
 				toInt32(n.ValueRank, -1),
 				toDims(n.ArrayDimensions, toInt32(n.ValueRank, -1)),
 				toUint8(n.AccessLevel, 1),
 				n.MinimumSamplingInterval,
 				n.Historizing,
 				m.server.historian,
-			)
+			))
 		case "UAMethod":
-			nodes[i] = NewMethodNode(
+			nodes = append(nodes, NewMethodNode(
 				toNodeID(n.NodeID, aliases, nsMap),
 				toBrowseName(n.BrowseName, nsMap),
 				toLocalizedText(n.DisplayName),
@@ -659,9 +1118,9 @@ func (m *NamespaceManager) LoadNodeSetFromBuffer(buf []byte) error {
 				nil,
 				toRefs(n.References, aliases, nsMap),
 				toBool(n.Executable, true),
-			)
+			))
 		case "UAView":
-			nodes[i] = NewViewNode(
+			nodes = append(nodes, NewViewNode(
 				toNodeID(n.NodeID, aliases, nsMap),
 				toBrowseName(n.BrowseName, nsMap),
 				toLocalizedText(n.DisplayName),
@@ -670,17 +1129,139 @@ func (m *NamespaceManager) LoadNodeSetFromBuffer(buf []byte) error {
 				toRefs(n.References, aliases, nsMap),
 				n.ContainsNoLoops,
 				n.EventNotifier,
-			)
+			))
 		}
 	}
-	err = m.AddNodes(nodes...)
-	if err != nil {
-		log.Printf("Error adding nodes. %s\n", err)
-		return err
+	return nodes, nil
+}
+
+// registerDataTypeDefinition registers the definition of the DataType with the binary encoder, so values
+// of structured DataTypes without a Go type can be encoded and decoded as a ua.Structure.
+func registerDataTypeDefinition(n *DataTypeNode, namespaceURIs []string) {
+	id := ua.ToExpandedNodeID(n.NodeID(), namespaceURIs)
+	switch def := n.DataTypeDefinition().(type) {
+	case ua.StructureDefinition:
+		ua.RegisterStructureDefinition(id, def, namespaceURIs)
+	case ua.EnumDefinition:
+		ua.RegisterEnumDefinition(id, def)
+	}
+}
+
+// nodeSetImport resolves the NodeIDs of a nodeset that is imported, first among the nodes of
+// the nodeset, then among the nodes of the namespace.
+type nodeSetImport struct {
+	m         *NamespaceManager
+	nodes     map[ua.NodeID]*ua.UANode
+	encodings map[ua.NodeID][]ua.NodeID // encodings of a DataType that only have an inverse HasEncoding reference
+	aliases   map[string]string
+	nsMap     map[uint16]uint16
+}
+
+// findReferences returns the references and browse name of the node.
+func (imp *nodeSetImport) findReferences(id ua.NodeID) ([]ua.Reference, ua.QualifiedName, bool) {
+	if n, ok := imp.nodes[id]; ok {
+		return toRefs(n.References, imp.aliases, imp.nsMap), toBrowseName(n.BrowseName, imp.nsMap), true
+	}
+	if n, ok := imp.m.FindNode(id); ok {
+		return n.References(), n.BrowseName(), true
+	}
+	return nil, ua.QualifiedName{}, false
+}
+
+// superType returns the immediate supertype for the type.
+func (imp *nodeSetImport) superType(id ua.NodeID) ua.NodeID {
+	refs, _, _ := imp.findReferences(id)
+	for _, r := range refs {
+		if r.IsInverse && ua.ReferenceTypeIDHasSubtype == r.ReferenceTypeID {
+			return ua.ToNodeID(r.TargetID, imp.m.NamespaceUris())
+		}
 	}
 	return nil
 }
 
+// isSubtype returns whether the type is a subtype of the supertype.
+func (imp *nodeSetImport) isSubtype(subtype, supertype ua.NodeID) bool {
+	id := subtype
+	for i := 0; i < 100; i++ {
+		id = imp.superType(id)
+		if id == nil {
+			return false
+		}
+		if id == supertype {
+			return true
+		}
+	}
+	log.Printf("IsSubtype() exceeded limits.\n")
+	return false
+}
+
+// toDataTypeDefinition returns the StructureDefinition of a subtype of Structure, else the EnumDefinition.
+func (imp *nodeSetImport) toDataTypeDefinition(n *ua.UANode, def *ua.UADataTypeDefinition) interface{} {
+	id := toNodeID(n.NodeID, imp.aliases, imp.nsMap)
+	if !imp.isSubtype(id, ua.DataTypeIDStructure) {
+		fields := make([]ua.EnumField, len(def.Field))
+		for i, f := range def.Field {
+			displayName := toLocalizedText(f.DisplayName)
+			if displayName.Text == "" {
+				displayName = ua.NewLocalizedText(f.Name, "")
+			}
+			fields[i] = ua.EnumField{
+				Value:       int64(f.Value),
+				DisplayName: displayName,
+				Description: ua.NewLocalizedText(strings.TrimSpace(f.Description), ""),
+				Name:        f.Name,
+			}
+		}
+		return ua.EnumDefinition{Fields: fields}
+	}
+	structureType := ua.StructureTypeStructure
+	fields := make([]ua.StructureField, len(def.Field))
+	for i, f := range def.Field {
+		if f.IsOptional {
+			structureType = ua.StructureTypeStructureWithOptionalFields
+		}
+		rank := int32(f.ValueRank)
+		fields[i] = ua.StructureField{
+			Name:            f.Name,
+			Description:     ua.NewLocalizedText(strings.TrimSpace(f.Description), ""),
+			DataType:        toDataTypeID(f.DataType, imp.aliases, imp.nsMap),
+			ValueRank:       rank,
+			ArrayDimensions: toDims(f.ArrayDimensions, rank),
+			MaxStringLength: f.MaxStringLength,
+			IsOptional:      f.IsOptional,
+		}
+	}
+	if def.IsUnion {
+		structureType = ua.StructureTypeUnion
+	}
+	encodings := imp.encodings[id]
+	for _, r := range toRefs(n.References, imp.aliases, imp.nsMap) {
+		if !r.IsInverse && r.ReferenceTypeID == ua.ReferenceTypeIDHasEncoding {
+			encodings = append(encodings, ua.ToNodeID(r.TargetID, imp.m.NamespaceUris()))
+		}
+	}
+	var defaultEncodingID ua.NodeID
+	for _, e := range encodings {
+		if _, browseName, ok := imp.findReferences(e); ok && browseName.Name == "Default Binary" {
+			defaultEncodingID = e
+		}
+	}
+	return ua.StructureDefinition{
+		DefaultEncodingID: defaultEncodingID,
+		BaseDataType:      imp.superType(id),
+		StructureType:     structureType,
+		Fields:            fields,
+	}
+}
+
+// toDataTypeID returns the DataType of a variable or variable type. The DataType defaults to BaseDataType.
+func toDataTypeID(s string, aliases map[string]string, nsMap map[uint16]uint16) ua.NodeID {
+	if s == "" {
+		return ua.DataTypeIDBaseDataType
+	}
+	return toNodeID(s, aliases, nsMap)
+}
+
 func toNodeID(s string, aliases map[string]string, nsMap map[uint16]uint16) ua.NodeID {
 	if alias, exists := aliases[s]; exists {
 		s = alias
@@ -770,6 +1351,14 @@ func toBrowseName(s string, nsMap map[uint16]uint16) ua.QualifiedName {
 	return ua.NewQualifiedName(uint16(ns), s)
 }
 
+// toNamespaceIndex returns the namespace index of the server for the namespace index of the nodeset.
+func toNamespaceIndex(ns uint16, nsMap map[uint16]uint16) uint16 {
+	if ns2, exists := nsMap[ns]; exists {
+		return ns2
+	}
+	return ns
+}
+
 func toLocalizedText(s ua.UALocalizedText) ua.LocalizedText {
 	if len(s.Text) > 0 {
 		return ua.NewLocalizedText(s.Text, s.Locale)
@@ -811,7 +1400,7 @@ func toBool(s string, def bool) bool {
 // 	return m.IsSubtype(ua.ParseNodeID(dataType), ua.DataTypeIDEnumeration)
 // }
 
-func toDataValue(s ua.UAVariant, dataType string, aliases map[string]string, nsMap map[uint16]uint16, rank int32, m *NamespaceManager) ua.DataValue {
+func toDataValue(nodeID string, s ua.UAVariant, dataType string, aliases map[string]string, nsMap map[uint16]uint16, rank int32, imp *nodeSetImport) ua.DataValue {
 	if alias, exists := aliases[dataType]; exists {
 		dataType = alias
 	}
@@ -876,9 +1465,12 @@ func toDataValue(s ua.UAVariant, dataType string, aliases map[string]string, nsM
 			case ua.DataTypeIDGUID:
 				if s.GUID != nil {
 					item := *s.GUID
-					if g, err := uuid.Parse(item.String); err == nil {
-						return ua.NewDataValue(g, 0, now, 0, now, 0)
+					g, err := uuid.Parse(item.String)
+					if err != nil {
+						log.Printf("Error decoding Guid of node %s. %s\n", nodeID, err)
+						return ua.NewDataValue(nil, ua.BadDecodingError, now, 0, now, 0)
 					}
+					return ua.NewDataValue(g, 0, now, 0, now, 0)
 				}
 			case ua.DataTypeIDByteString:
 				if s.ByteString != nil {
@@ -897,7 +1489,7 @@ func toDataValue(s ua.UAVariant, dataType string, aliases map[string]string, nsM
 			case ua.DataTypeIDQualifiedName:
 				if s.QualifiedName != nil {
 					item := *s.QualifiedName
-					return ua.NewDataValue(ua.QualifiedName{NamespaceIndex: item.NamespaceIndex, Name: strings.TrimSpace(item.Name)}, 0, now, 0, now, 0)
+					return ua.NewDataValue(ua.QualifiedName{NamespaceIndex: toNamespaceIndex(item.NamespaceIndex, nsMap), Name: strings.TrimSpace(item.Name)}, 0, now, 0, now, 0)
 				}
 			case ua.DataTypeIDDuration:
 				if s.Double != nil {
@@ -906,7 +1498,7 @@ func toDataValue(s ua.UAVariant, dataType string, aliases map[string]string, nsM
 			case ua.DataTypeIDNodeID:
 				if s.NodeID != nil {
 					item := *s.NodeID
-					return ua.NewDataValue(ua.ParseNodeID(strings.TrimSpace(item.Identifier)), 0, now, 0, now, 0)
+					return ua.NewDataValue(toNodeID(strings.TrimSpace(item.Identifier), aliases, nsMap), 0, now, 0, now, 0)
 				}
 			case ua.DataTypeIDExpandedNodeID:
 				if s.ExpandedNodeID != nil {
@@ -987,9 +1579,12 @@ func toDataValue(s ua.UAVariant, dataType string, aliases map[string]string, nsM
 				case s.DateTime != nil:
 					return ua.NewDataValue(*s.DateTime, 0, now, 0, now, 0)
 				case s.GUID != nil:
-					if g, err := uuid.Parse(s.GUID.String); err == nil {
-						return ua.NewDataValue(g, 0, now, 0, now, 0)
+					g, err := uuid.Parse(s.GUID.String)
+					if err != nil {
+						log.Printf("Error decoding Guid of node %s. %s\n", nodeID, err)
+						return ua.NewDataValue(nil, ua.BadDecodingError, now, 0, now, 0)
 					}
+					return ua.NewDataValue(g, 0, now, 0, now, 0)
 				case s.ByteString != nil:
 					return ua.NewDataValue(*s.ByteString, 0, now, 0, now, 0)
 				case s.XMLElement != nil:
@@ -999,9 +1594,9 @@ func toDataValue(s ua.UAVariant, dataType string, aliases map[string]string, nsM
 					return ua.NewDataValue(ua.LocalizedText{Text: strings.TrimSpace(item.Text), Locale: strings.TrimSpace(item.Locale)}, 0, now, 0, now, 0)
 				case s.QualifiedName != nil:
 					item := *s.QualifiedName
-					return ua.NewDataValue(ua.QualifiedName{NamespaceIndex: item.NamespaceIndex, Name: strings.TrimSpace(item.Name)}, 0, now, 0, now, 0)
+					return ua.NewDataValue(ua.QualifiedName{NamespaceIndex: toNamespaceIndex(item.NamespaceIndex, nsMap), Name: strings.TrimSpace(item.Name)}, 0, now, 0, now, 0)
 				case s.NodeID != nil:
-					return ua.NewDataValue(ua.ParseNodeID(strings.TrimSpace(s.NodeID.Identifier)), 0, now, 0, now, 0)
+					return ua.NewDataValue(toNodeID(strings.TrimSpace(s.NodeID.Identifier), aliases, nsMap), 0, now, 0, now, 0)
 				case s.ExpandedNodeID != nil:
 					return ua.NewDataValue(ua.ParseExpandedNodeID(strings.TrimSpace(s.ExpandedNodeID.Identifier)), 0, now, 0, now, 0)
 				}
@@ -1022,12 +1617,12 @@ func toDataValue(s ua.UAVariant, dataType string, aliases map[string]string, nsM
 				}
 			default:
 				n2 := toNodeID(dataType, aliases, nsMap)
-				if m.IsSubtype(n2, ua.DataTypeIDEnumeration) {
+				if imp.isSubtype(n2, ua.DataTypeIDEnumeration) {
 					if s.Int32 != nil {
 						return ua.NewDataValue(*s.Int32, 0, now, 0, now, 0)
 					}
 				}
-				return ua.NewDataValue(nil, 0, now, 0, now, 0)
+				return ua.NewDataValue(nil, ua.BadWaitingForInitialData, now, 0, now, 0)
 			}
 		case 1:
 			switch ua.ParseNodeID(dataType) {
@@ -1096,8 +1691,8 @@ func toDataValue(s ua.UAVariant, dataType string, aliases map[string]string, nsM
 					for i, item := range list {
 						item2, err := uuid.Parse(*item)
 						if err != nil {
-							log.Printf("Error decoding Guid. %s\n", err)
-							return ua.NewDataValue(nil, 0, now, 0, now, 0)
+							log.Printf("Error decoding Guid of node %s. %s\n", nodeID, err)
+							return ua.NewDataValue(nil, ua.BadDecodingError, now, 0, now, 0)
 						}
 						list2[i] = item2
 					}
@@ -1131,7 +1726,7 @@ func toDataValue(s ua.UAVariant, dataType string, aliases map[string]string, nsM
 					list := s.ListOfQualifiedName.List
 					list2 := make([]ua.QualifiedName, len(list))
 					for i, item := range list {
-						list2[i] = ua.QualifiedName{NamespaceIndex: item.NamespaceIndex, Name: strings.TrimSpace(item.Name)}
+						list2[i] = ua.QualifiedName{NamespaceIndex: toNamespaceIndex(item.NamespaceIndex, nsMap), Name: strings.TrimSpace(item.Name)}
 					}
 					return ua.NewDataValue(list2, 0, now, 0, now, 0)
 				}
@@ -1207,7 +1802,7 @@ func toDataValue(s ua.UAVariant, dataType string, aliases map[string]string, nsM
 							item := &ua.UAQualifiedName{}
 							hack := fmt.Sprintf("<uax:QualifiedName>%s</uax:QualifiedName>", src)
 							xml.Unmarshal([]byte(hack), item)
-							list2[i] = ua.QualifiedName{NamespaceIndex: item.NamespaceIndex, Name: item.Name}
+							list2[i] = ua.QualifiedName{NamespaceIndex: toNamespaceIndex(item.NamespaceIndex, nsMap), Name: item.Name}
 						case "NodeID":
 							list2[i] = ua.ParseNodeID(strings.TrimSpace(src))
 						case "ExpandedNodeID":
@@ -1255,11 +1850,11 @@ func toDataValue(s ua.UAVariant, dataType string, aliases map[string]string, nsM
 				}
 
 			default:
-				return ua.NewDataValue(nil, 0, now, 0, now, 0)
+				return ua.NewDataValue(nil, ua.BadWaitingForInitialData, now, 0, now, 0)
 			}
 		default:
-			return ua.NewDataValue(nil, 0, now, 0, now, 0)
+			return ua.NewDataValue(nil, ua.BadWaitingForInitialData, now, 0, now, 0)
 		}
 	}
-	return ua.NewDataValue(nil, 0, now, 0, now, 0)
+	return ua.NewDataValue(nil, ua.BadWaitingForInitialData, now, 0, now, 0)
 }
@@ -0,0 +1,541 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package server
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/awcullen/opcua/ua"
+	"github.com/google/uuid"
+)
+
+// typesNamespace is the namespace of the elements of the Value of a node.
+const typesNamespace = "http://opcfoundation.org/UA/2008/02/Types.xsd"
+
+// nodeSetAliases are the aliases of the common reference types and data types, in the order they are exported.
+var nodeSetAliases = []struct {
+	alias string
+	id    ua.NodeID
+}{
+	{"Boolean", ua.DataTypeIDBoolean},
+	{"SByte", ua.DataTypeIDSByte},
+	{"Byte", ua.DataTypeIDByte},
+	{"Int16", ua.DataTypeIDInt16},
+	{"UInt16", ua.DataTypeIDUInt16},
+	{"Int32", ua.DataTypeIDInt32},
+	{"UInt32", ua.DataTypeIDUInt32},
+	{"Int64", ua.DataTypeIDInt64},
+	{"UInt64", ua.DataTypeIDUInt64},
+	{"Float", ua.DataTypeIDFloat},
+	{"Double", ua.DataTypeIDDouble},
+	{"String", ua.DataTypeIDString},
+	{"DateTime", ua.DataTypeIDDateTime},
+	{"Guid", ua.DataTypeIDGUID},
+	{"ByteString", ua.DataTypeIDByteString},
+	{"XmlElement", ua.DataTypeIDXMLElement},
+	{"NodeId", ua.DataTypeIDNodeID},
+	{"ExpandedNodeId", ua.DataTypeIDExpandedNodeID},
+	{"StatusCode", ua.DataTypeIDStatusCode},
+	{"QualifiedName", ua.DataTypeIDQualifiedName},
+	{"LocalizedText", ua.DataTypeIDLocalizedText},
+	{"Structure", ua.DataTypeIDStructure},
+	{"DataValue", ua.DataTypeIDDataValue},
+	{"BaseDataType", ua.DataTypeIDBaseDataType},
+	{"DiagnosticInfo", ua.DataTypeIDDiagnosticInfo},
+	{"Number", ua.DataTypeIDNumber},
+	{"Integer", ua.DataTypeIDInteger},
+	{"UInteger", ua.DataTypeIDUInteger},
+	{"Enumeration", ua.DataTypeIDEnumeration},
+	{"Duration", ua.DataTypeIDDuration},
+	{"UtcTime", ua.DataTypeIDUtcTime},
+	{"LocaleId", ua.DataTypeIDLocaleID},
+	{"Organizes", ua.ReferenceTypeIDOrganizes},
+	{"HasEventSource", ua.ReferenceTypeIDHasEventSource},
+	{"HasModellingRule", ua.ReferenceTypeIDHasModellingRule},
+	{"HasEncoding", ua.ReferenceTypeIDHasEncoding},
+	{"HasDescription", ua.ReferenceTypeIDHasDescription},
+	{"HasTypeDefinition", ua.ReferenceTypeIDHasTypeDefinition},
+	{"GeneratesEvent", ua.ReferenceTypeIDGeneratesEvent},
+	{"HasSubtype", ua.ReferenceTypeIDHasSubtype},
+	{"HasProperty", ua.ReferenceTypeIDHasProperty},
+	{"HasComponent", ua.ReferenceTypeIDHasComponent},
+	{"HasNotifier", ua.ReferenceTypeIDHasNotifier},
+	{"HasOrderedComponent", ua.ReferenceTypeIDHasOrderedComponent},
+}
+
+// xmlNodeSet is the UANodeSet that is written by ExportNodeSet2.
+type xmlNodeSet struct {
+	XMLName       xml.Name    `xml:"http://opcfoundation.org/UA/2011/03/UANodeSet.xsd UANodeSet"`
+	NamespaceUris []string    `xml:"NamespaceUris>Uri,omitempty"`
+	Aliases       []xmlAlias  `xml:"Aliases>Alias,omitempty"`
+	Nodes         []xmlUANode `xml:",omitempty"`
+}
+
+type xmlAlias struct {
+	Alias  string `xml:"Alias,attr"`
+	NodeID string `xml:",chardata"`
+}
+
+type xmlUANode struct {
+	XMLName                 xml.Name
+	NodeID                  string            `xml:"NodeId,attr"`
+	BrowseName              string            `xml:"BrowseName,attr"`
+	DataType                string            `xml:"DataType,attr,omitempty"`
+	ValueRank               string            `xml:"ValueRank,attr,omitempty"`
+	ArrayDimensions         string            `xml:"ArrayDimensions,attr,omitempty"`
+	AccessLevel             string            `xml:"AccessLevel,attr,omitempty"`
+	MinimumSamplingInterval string            `xml:"MinimumSamplingInterval,attr,omitempty"`
+	Historizing             bool              `xml:"Historizing,attr,omitempty"`
+	IsAbstract              bool              `xml:"IsAbstract,attr,omitempty"`
+	Symmetric               bool              `xml:"Symmetric,attr,omitempty"`
+	EventNotifier           string            `xml:"EventNotifier,attr,omitempty"`
+	Executable              string            `xml:"Executable,attr,omitempty"`
+	ContainsNoLoops         bool              `xml:"ContainsNoLoops,attr,omitempty"`
+	DisplayName             xmlLocalizedText  `xml:"DisplayName"`
+	Description             *xmlLocalizedText `xml:"Description,omitempty"`
+	References              []xmlReference    `xml:"References>Reference,omitempty"`
+	InverseName             *xmlLocalizedText `xml:"InverseName,omitempty"`
+	Definition              *xmlDefinition    `xml:"Definition,omitempty"`
+	Value                   *xmlValue         `xml:"Value,omitempty"`
+}
+
+type xmlLocalizedText struct {
+	Locale string `xml:"Locale,attr,omitempty"`
+	Text   string `xml:",chardata"`
+}
+
+type xmlReference struct {
+	ReferenceType string `xml:"ReferenceType,attr"`
+	IsForward     string `xml:"IsForward,attr,omitempty"`
+	TargetNodeID  string `xml:",chardata"`
+}
+
+type xmlDefinition struct {
+	Name    string     `xml:"Name,attr"`
+	IsUnion bool       `xml:"IsUnion,attr,omitempty"`
+	Fields  []xmlField `xml:"Field"`
+}
+
+type xmlField struct {
+	Name            string            `xml:"Name,attr"`
+	DataType        string            `xml:"DataType,attr,omitempty"`
+	ValueRank       string            `xml:"ValueRank,attr,omitempty"`
+	ArrayDimensions string            `xml:"ArrayDimensions,attr,omitempty"`
+	MaxStringLength uint32            `xml:"MaxStringLength,attr,omitempty"`
+	IsOptional      bool              `xml:"IsOptional,attr,omitempty"`
+	Value           *int64            `xml:"Value,attr,omitempty"`
+	DisplayName     *xmlLocalizedText `xml:"DisplayName,omitempty"`
+	Description     *xmlLocalizedText `xml:"Description,omitempty"`
+}
+
+type xmlValue struct {
+	Element xmlElement
+}
+
+// xmlElement is an element of the Value of a node, in the Types namespace.
+type xmlElement struct {
+	XMLName  xml.Name
+	Text     string `xml:",chardata"`
+	InnerXML string `xml:",innerxml"`
+	Children []xmlElement
+}
+
+// nodeSetExport maps the namespaces of the server to the namespaces of the exported nodeset.
+type nodeSetExport struct {
+	namespaceURIs []string
+	nsMap         map[uint16]uint16
+	uris          []string
+	aliases       map[ua.NodeID]string
+	used          map[string]bool
+}
+
+// ExportNodeSet2 writes the nodes to the UANodeSet XML, with the References and the current Values.
+// The namespaces used by the nodes are written to the NamespaceUris, and the common reference types
+// and data types are written as Aliases. Values of types that are not supported by the UANodeSet
+// import, and References to other servers, are skipped.
+func (m *NamespaceManager) ExportNodeSet2(w io.Writer, nodes []Node) error {
+	e := &nodeSetExport{
+		namespaceURIs: m.NamespaceUris(),
+		nsMap:         make(map[uint16]uint16),
+		aliases:       make(map[ua.NodeID]string, len(nodeSetAliases)),
+		used:          make(map[string]bool),
+	}
+	for _, a := range nodeSetAliases {
+		e.aliases[a.id] = a.alias
+	}
+	set := xmlNodeSet{Nodes: make([]xmlUANode, 0, len(nodes))}
+	for _, n := range nodes {
+		set.Nodes = append(set.Nodes, e.node(n))
+	}
+	set.NamespaceUris = e.uris
+	for _, a := range nodeSetAliases {
+		if e.used[a.alias] {
+			set.Aliases = append(set.Aliases, xmlAlias{Alias: a.alias, NodeID: e.nodeID(a.id)})
+		}
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(set); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// namespaceIndex returns the index of the namespace in the exported nodeset, adding the namespace if missing.
+func (e *nodeSetExport) namespaceIndex(ns uint16) uint16 {
+	if ns == 0 {
+		return 0
+	}
+	if i, ok := e.nsMap[ns]; ok {
+		return i
+	}
+	uri := ""
+	if int(ns) < len(e.namespaceURIs) {
+		uri = e.namespaceURIs[ns]
+	}
+	e.uris = append(e.uris, uri)
+	i := uint16(len(e.uris))
+	e.nsMap[ns] = i
+	return i
+}
+
+// nodeID returns the NodeID in the namespaces of the exported nodeset.
+func (e *nodeSetExport) nodeID(id ua.NodeID) string {
+	switch id := id.(type) {
+	case ua.NodeIDNumeric:
+		return ua.NewNodeIDNumeric(e.namespaceIndex(id.NamespaceIndex), id.ID).String()
+	case ua.NodeIDString:
+		return ua.NewNodeIDString(e.namespaceIndex(id.NamespaceIndex), id.ID).String()
+	case ua.NodeIDGUID:
+		return ua.NewNodeIDGUID(e.namespaceIndex(id.NamespaceIndex), id.ID).String()
+	case ua.NodeIDOpaque:
+		return ua.NewNodeIDOpaque(e.namespaceIndex(id.NamespaceIndex), id.ID).String()
+	default:
+		return ""
+	}
+}
+
+// alias returns the alias of the NodeID, else the NodeID.
+func (e *nodeSetExport) alias(id ua.NodeID) string {
+	if a, ok := e.aliases[id]; ok {
+		e.used[a] = true
+		return a
+	}
+	return e.nodeID(id)
+}
+
+// browseName returns the QualifiedName in the namespaces of the exported nodeset.
+func (e *nodeSetExport) browseName(qn ua.QualifiedName) string {
+	if qn.NamespaceIndex == 0 {
+		return qn.Name
+	}
+	return strconv.Itoa(int(e.namespaceIndex(qn.NamespaceIndex))) + ":" + qn.Name
+}
+
+func toXMLLocalizedText(t ua.LocalizedText) xmlLocalizedText {
+	return xmlLocalizedText{Locale: t.Locale, Text: t.Text}
+}
+
+func toXMLDims(dims []uint32) string {
+	s := make([]string, len(dims))
+	var nonzero bool
+	for i, d := range dims {
+		s[i] = strconv.FormatUint(uint64(d), 10)
+		nonzero = nonzero || d != 0
+	}
+	if !nonzero {
+		return ""
+	}
+	return strings.Join(s, ",")
+}
+
+func toXMLValueRank(rank int32) string {
+	if rank == ua.ValueRankScalar {
+		return ""
+	}
+	return strconv.Itoa(int(rank))
+}
+
+// node returns the attributes and references of the node.
+func (e *nodeSetExport) node(n Node) xmlUANode {
+	x := xmlUANode{
+		NodeID:      e.nodeID(n.NodeID()),
+		BrowseName:  e.browseName(n.BrowseName()),
+		DisplayName: toXMLLocalizedText(n.DisplayName()),
+	}
+	if d := n.Description(); d.Text != "" {
+		t := toXMLLocalizedText(d)
+		x.Description = &t
+	}
+	for _, r := range n.References() {
+		if r.TargetID.ServerIndex != 0 {
+			continue
+		}
+		target := ua.ToNodeID(r.TargetID, e.namespaceURIs)
+		if target == nil {
+			continue
+		}
+		ref := xmlReference{ReferenceType: e.alias(r.ReferenceTypeID), TargetNodeID: e.nodeID(target)}
+		if r.IsInverse {
+			ref.IsForward = "false"
+		}
+		x.References = append(x.References, ref)
+	}
+	switch n := n.(type) {
+	case *ObjectNode:
+		x.XMLName.Local = "UAObject"
+		if n.EventNotifier() != 0 {
+			x.EventNotifier = strconv.Itoa(int(n.EventNotifier()))
+		}
+	case *VariableNode:
+		x.XMLName.Local = "UAVariable"
+		x.DataType = e.alias(n.DataType())
+		x.ValueRank = toXMLValueRank(n.ValueRank())
+		x.ArrayDimensions = toXMLDims(n.ArrayDimensions())
+		if n.AccessLevel() != ua.AccessLevelsCurrentRead {
+			x.AccessLevel = strconv.Itoa(int(n.AccessLevel()))
+		}
+		if n.MinimumSamplingInterval() != 0 {
+			x.MinimumSamplingInterval = strconv.FormatFloat(n.MinimumSamplingInterval(), 'f', -1, 64)
+		}
+		x.Historizing = n.Historizing()
+		x.Value = e.value(n.Value().Value)
+	case *VariableTypeNode:
+		x.XMLName.Local = "UAVariableType"
+		x.DataType = e.alias(n.DataType())
+		x.ValueRank = toXMLValueRank(n.ValueRank())
+		x.ArrayDimensions = toXMLDims(n.ArrayDimensions())
+		x.IsAbstract = n.IsAbstract()
+		x.Value = e.value(n.Value().Value)
+	case *ObjectTypeNode:
+		x.XMLName.Local = "UAObjectType"
+		x.IsAbstract = n.IsAbstract()
+	case *ReferenceTypeNode:
+		x.XMLName.Local = "UAReferenceType"
+		x.IsAbstract = n.IsAbstract()
+		x.Symmetric = n.Symmetric()
+		if t := n.InverseName(); t.Text != "" {
+			inverseName := toXMLLocalizedText(t)
+			x.InverseName = &inverseName
+		}
+	case *DataTypeNode:
+		x.XMLName.Local = "UADataType"
+		x.IsAbstract = n.IsAbstract()
+		x.Definition = e.definition(x.BrowseName, n.DataTypeDefinition())
+	case *MethodNode:
+		x.XMLName.Local = "UAMethod"
+		if !n.Executable() {
+			x.Executable = "false"
+		}
+	case *ViewNode:
+		x.XMLName.Local = "UAView"
+		x.ContainsNoLoops = n.ContainsNoLoops()
+		if n.EventNotifier() != 0 {
+			x.EventNotifier = strconv.Itoa(int(n.EventNotifier()))
+		}
+	}
+	return x
+}
+
+// definition returns the fields of the StructureDefinition or EnumDefinition.
+func (e *nodeSetExport) definition(name string, def interface{}) *xmlDefinition {
+	switch def := def.(type) {
+	case ua.StructureDefinition:
+		x := &xmlDefinition{Name: name, IsUnion: def.StructureType == ua.StructureTypeUnion}
+		for _, f := range def.Fields {
+			field := xmlField{
+				Name:            f.Name,
+				DataType:        e.alias(f.DataType),
+				ValueRank:       toXMLValueRank(f.ValueRank),
+				ArrayDimensions: toXMLDims(f.ArrayDimensions),
+				MaxStringLength: f.MaxStringLength,
+				IsOptional:      f.IsOptional,
+			}
+			if f.Description.Text != "" {
+				t := toXMLLocalizedText(f.Description)
+				field.Description = &t
+			}
+			x.Fields = append(x.Fields, field)
+		}
+		return x
+	case ua.EnumDefinition:
+		x := &xmlDefinition{Name: name}
+		for _, f := range def.Fields {
+			value := f.Value
+			field := xmlField{Name: f.Name, Value: &value}
+			if f.DisplayName.Text != "" && f.DisplayName.Text != f.Name {
+				t := toXMLLocalizedText(f.DisplayName)
+				field.DisplayName = &t
+			}
+			if f.Description.Text != "" {
+				t := toXMLLocalizedText(f.Description)
+				field.Description = &t
+			}
+			x.Fields = append(x.Fields, field)
+		}
+		return x
+	default:
+		return nil
+	}
+}
+
+// value returns the Value element, or nil if the value is null or of a type that is not supported.
+func (e *nodeSetExport) value(v ua.Variant) *xmlValue {
+	if v == nil {
+		return nil
+	}
+	if el, ok := e.scalar(v); ok {
+		el.XMLName.Space = typesNamespace
+		return &xmlValue{Element: el}
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return nil
+	}
+	list := xmlElement{Children: make([]xmlElement, rv.Len())}
+	for i := 0; i < rv.Len(); i++ {
+		el, ok := e.scalar(rv.Index(i).Interface())
+		if !ok {
+			return nil
+		}
+		list.Children[i] = el
+	}
+	name := ua.VariantTypeOf(v)
+	if local, ok := listNames[name]; ok {
+		list.XMLName = xml.Name{Space: typesNamespace, Local: local}
+		return &xmlValue{Element: list}
+	}
+	return nil
+}
+
+var listNames = map[byte]string{
+	ua.VariantTypeBoolean:         "ListOfBoolean",
+	ua.VariantTypeSByte:           "ListOfSByte",
+	ua.VariantTypeByte:            "ListOfByte",
+	ua.VariantTypeInt16:           "ListOfInt16",
+	ua.VariantTypeUInt16:          "ListOfUInt16",
+	ua.VariantTypeInt32:           "ListOfInt32",
+	ua.VariantTypeUInt32:          "ListOfUInt32",
+	ua.VariantTypeInt64:           "ListOfInt64",
+	ua.VariantTypeUInt64:          "ListOfUInt64",
+	ua.VariantTypeFloat:           "ListOfFloat",
+	ua.VariantTypeDouble:          "ListOfDouble",
+	ua.VariantTypeString:          "ListOfString",
+	ua.VariantTypeDateTime:        "ListOfDateTime",
+	ua.VariantTypeGUID:            "ListOfGuid",
+	ua.VariantTypeByteString:      "ListOfByteString",
+	ua.VariantTypeXMLElement:      "ListOfXmlElement",
+	ua.VariantTypeLocalizedText:   "ListOfLocalizedText",
+	ua.VariantTypeQualifiedName:   "ListOfQualifiedName",
+	ua.VariantTypeExtensionObject: "ListOfExtensionObject",
+}
+
+func textElement(name, text string) xmlElement {
+	return xmlElement{XMLName: xml.Name{Local: name}, Text: text}
+}
+
+func localizedTextElement(name string, t ua.LocalizedText) xmlElement {
+	return xmlElement{XMLName: xml.Name{Local: name}, Children: []xmlElement{
+		textElement("Locale", t.Locale),
+		textElement("Text", t.Text),
+	}}
+}
+
+// scalar returns the element of a scalar value, or false if the type is not supported.
+func (e *nodeSetExport) scalar(v interface{}) (xmlElement, bool) {
+	switch v := v.(type) {
+	case bool:
+		return textElement("Boolean", strconv.FormatBool(v)), true
+	case int8:
+		return textElement("SByte", strconv.FormatInt(int64(v), 10)), true
+	case uint8:
+		return textElement("Byte", strconv.FormatUint(uint64(v), 10)), true
+	case int16:
+		return textElement("Int16", strconv.FormatInt(int64(v), 10)), true
+	case uint16:
+		return textElement("UInt16", strconv.FormatUint(uint64(v), 10)), true
+	case int32:
+		return textElement("Int32", strconv.FormatInt(int64(v), 10)), true
+	case uint32:
+		return textElement("UInt32", strconv.FormatUint(uint64(v), 10)), true
+	case int64:
+		return textElement("Int64", strconv.FormatInt(v, 10)), true
+	case uint64:
+		return textElement("UInt64", strconv.FormatUint(v, 10)), true
+	case float32:
+		return textElement("Float", strconv.FormatFloat(float64(v), 'g', -1, 32)), true
+	case float64:
+		return textElement("Double", strconv.FormatFloat(v, 'g', -1, 64)), true
+	case string:
+		return textElement("String", v), true
+	case time.Time:
+		return textElement("DateTime", v.UTC().Format(time.RFC3339Nano)), true
+	case uuid.UUID:
+		return xmlElement{XMLName: xml.Name{Local: "Guid"}, Children: []xmlElement{textElement("String", v.String())}}, true
+	case ua.ByteString:
+		return textElement("ByteString", base64.StdEncoding.EncodeToString([]byte(v))), true
+	case ua.XMLElement:
+		return xmlElement{XMLName: xml.Name{Local: "XmlElement"}, InnerXML: string(v)}, true
+	case ua.LocalizedText:
+		return localizedTextElement("LocalizedText", v), true
+	case ua.QualifiedName:
+		return xmlElement{XMLName: xml.Name{Local: "QualifiedName"}, Children: []xmlElement{
+			textElement("NamespaceIndex", strconv.Itoa(int(e.namespaceIndex(v.NamespaceIndex)))),
+			textElement("Name", v.Name),
+		}}, true
+	case ua.NodeIDNumeric, ua.NodeIDString, ua.NodeIDGUID, ua.NodeIDOpaque:
+		return xmlElement{XMLName: xml.Name{Local: "NodeId"}, Children: []xmlElement{textElement("Identifier", e.nodeID(v.(ua.NodeID)))}}, true
+	case ua.ExpandedNodeID:
+		id := ua.ToNodeID(v, e.namespaceURIs)
+		if v.ServerIndex != 0 || id == nil {
+			return xmlElement{}, false
+		}
+		return xmlElement{XMLName: xml.Name{Local: "ExpandedNodeId"}, Children: []xmlElement{textElement("Identifier", e.nodeID(id))}}, true
+	case ua.Range:
+		return e.extensionObjectElement(ua.ObjectIDRangeEncodingDefaultXML, "Range",
+			textElement("Low", strconv.FormatFloat(v.Low, 'g', -1, 64)),
+			textElement("High", strconv.FormatFloat(v.High, 'g', -1, 64)),
+		), true
+	case ua.EUInformation:
+		return e.extensionObjectElement(ua.ObjectIDEUInformationEncodingDefaultXML, "EUInformation",
+			textElement("NamespaceUri", v.NamespaceURI),
+			textElement("UnitId", strconv.Itoa(int(v.UnitID))),
+			localizedTextElement("DisplayName", v.DisplayName),
+			localizedTextElement("Description", v.Description),
+		), true
+	case ua.Argument:
+		return e.extensionObjectElement(ua.ObjectIDArgumentEncodingDefaultXML, "Argument",
+			textElement("Name", v.Name),
+			xmlElement{XMLName: xml.Name{Local: "DataType"}, Children: []xmlElement{textElement("Identifier", e.nodeID(v.DataType))}},
+			textElement("ValueRank", strconv.Itoa(int(v.ValueRank))),
+			textElement("ArrayDimensions", toXMLDims(v.ArrayDimensions)),
+			localizedTextElement("Description", v.Description),
+		), true
+	case ua.EnumValueType:
+		return e.extensionObjectElement(ua.ObjectIDEnumValueTypeEncodingDefaultXML, "EnumValueType",
+			textElement("Value", strconv.FormatInt(v.Value, 10)),
+			localizedTextElement("DisplayName", v.DisplayName),
+			localizedTextElement("Description", v.Description),
+		), true
+	default:
+		return xmlElement{}, false
+	}
+}
+
+// extensionObjectElement returns the ExtensionObject with the XML encoding id and the body.
+func (e *nodeSetExport) extensionObjectElement(typeID ua.NodeID, name string, fields ...xmlElement) xmlElement {
+	return xmlElement{XMLName: xml.Name{Local: "ExtensionObject"}, Children: []xmlElement{
+		{XMLName: xml.Name{Local: "TypeId"}, Children: []xmlElement{textElement("Identifier", e.nodeID(typeID))}},
+		{XMLName: xml.Name{Local: "Body"}, Children: []xmlElement{{XMLName: xml.Name{Local: name}, Children: fields}}},
+	}}
+}
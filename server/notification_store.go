@@ -0,0 +1,119 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package server
+
+import (
+	"sync"
+
+	"github.com/awcullen/opcua/ua"
+)
+
+// SubscriptionKey identifies the messages of a subscription in a NotificationStore. The InstanceID
+// is unique to each server instance, so a store may be shared by several servers, or outlive the
+// server that put the messages, without mixing the messages of subscriptions with the same ID.
+type SubscriptionKey struct {
+	InstanceID     string
+	SubscriptionID uint32
+}
+
+// NotificationStore stores the notification messages that a subscription retains for
+// republishing until they are acknowledged by the client.
+type NotificationStore interface {
+
+	// Put stores the message of the subscription.
+	Put(key SubscriptionKey, message ua.NotificationMessage) error
+
+	// Get returns the message of the subscription with the sequence number. Returns
+	// BadMessageNotAvailable if not found.
+	Get(key SubscriptionKey, seqNum uint32) (ua.NotificationMessage, error)
+
+	// Ack removes the message of the subscription with the sequence number. Returns
+	// BadSequenceNumberUnknown if not found.
+	Ack(key SubscriptionKey, seqNum uint32) error
+
+	// Trim removes the oldest messages of the subscription until no more than max messages
+	// remain. If max is 0, all messages of the subscription are removed.
+	Trim(key SubscriptionKey, max int) error
+
+	// Available returns the sequence numbers of the stored messages of the subscription, oldest first.
+	Available(key SubscriptionKey) ([]uint32, error)
+}
+
+// MemoryNotificationStore is a NotificationStore that stores messages in memory.
+type MemoryNotificationStore struct {
+	sync.Mutex
+	messages map[SubscriptionKey][]ua.NotificationMessage
+}
+
+var _ NotificationStore = (*MemoryNotificationStore)(nil)
+
+// NewMemoryNotificationStore constructs a new MemoryNotificationStore.
+func NewMemoryNotificationStore() *MemoryNotificationStore {
+	return &MemoryNotificationStore{
+		messages: make(map[SubscriptionKey][]ua.NotificationMessage),
+	}
+}
+
+// Put stores the message of the subscription.
+func (s *MemoryNotificationStore) Put(key SubscriptionKey, message ua.NotificationMessage) error {
+	s.Lock()
+	defer s.Unlock()
+	s.messages[key] = append(s.messages[key], message)
+	return nil
+}
+
+// Get returns the message of the subscription with the sequence number. Returns
+// BadMessageNotAvailable if not found.
+func (s *MemoryNotificationStore) Get(key SubscriptionKey, seqNum uint32) (ua.NotificationMessage, error) {
+	s.Lock()
+	defer s.Unlock()
+	for _, nm := range s.messages[key] {
+		if nm.SequenceNumber == seqNum {
+			return nm, nil
+		}
+	}
+	return ua.NotificationMessage{}, ua.BadMessageNotAvailable
+}
+
+// Ack removes the message of the subscription with the sequence number. Returns
+// BadSequenceNumberUnknown if not found.
+func (s *MemoryNotificationStore) Ack(key SubscriptionKey, seqNum uint32) error {
+	s.Lock()
+	defer s.Unlock()
+	q := s.messages[key]
+	for i, nm := range q {
+		if nm.SequenceNumber == seqNum {
+			s.messages[key] = append(q[:i], q[i+1:]...)
+			return nil
+		}
+	}
+	return ua.BadSequenceNumberUnknown
+}
+
+// Trim removes the oldest messages of the subscription until no more than max messages
+// remain. If max is 0, all messages of the subscription are removed.
+func (s *MemoryNotificationStore) Trim(key SubscriptionKey, max int) error {
+	s.Lock()
+	defer s.Unlock()
+	q := s.messages[key]
+	if max <= 0 {
+		delete(s.messages, key)
+		return nil
+	}
+	if len(q) > max {
+		s.messages[key] = append([]ua.NotificationMessage(nil), q[len(q)-max:]...)
+	}
+	return nil
+}
+
+// Available returns the sequence numbers of the stored messages of the subscription, oldest first.
+func (s *MemoryNotificationStore) Available(key SubscriptionKey) ([]uint32, error) {
+	s.Lock()
+	defer s.Unlock()
+	q := s.messages[key]
+	avail := make([]uint32, len(q))
+	for i, nm := range q {
+		avail[i] = nm.SequenceNumber
+	}
+	return avail, nil
+}
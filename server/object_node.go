@@ -22,6 +22,7 @@ type ObjectNode struct {
 	references         []ua.Reference
 	eventNotifier      byte
 	subs               map[EventListener]struct{}
+	manager            *NamespaceManager
 }
 
 var _ Node = (*ObjectNode)(nil)
@@ -80,10 +81,7 @@ func (n *ObjectNode) UserRolePermissions(ctx context.Context) []ua.RolePermissio
 		return filteredPermissions
 	}
 	roles := session.UserRoles()
-	rolePermissions := n.RolePermissions()
-	if rolePermissions == nil {
-		rolePermissions = session.Server().RolePermissions()
-	}
+	rolePermissions := session.Server().effectiveRolePermissions(ctx, n, roles)
 	for _, role := range roles {
 		for _, rp := range rolePermissions {
 			if rp.RoleID == role {
@@ -114,8 +112,12 @@ func (n *ObjectNode) EventNotifier() byte {
 	return n.eventNotifier
 }
 
-// OnEvent raises an event from this node.
+// OnEvent reports the event to the subscribers of this node. Events are not reported if the
+// EventNotifier attribute does not have the SubscribeToEvents bit.
 func (n *ObjectNode) OnEvent(evt ua.Event) {
+	if (n.eventNotifier & ua.EventNotifierSubscribeToEvents) == 0 {
+		return
+	}
 	n.RLock()
 	defer n.RUnlock()
 	for sub := range n.subs {
@@ -123,6 +125,26 @@ func (n *ObjectNode) OnEvent(evt ua.Event) {
 	}
 }
 
+// FireEvent raises the event from this node. The event is reported to the notifiers of this node,
+// up to the Server object, as by NamespaceManager.OnEvent. Returns BadNodeIDUnknown if the node has
+// not been added to a namespace.
+func (n *ObjectNode) FireEvent(evt ua.Event) error {
+	n.RLock()
+	m := n.manager
+	n.RUnlock()
+	if m == nil {
+		return ua.BadNodeIDUnknown
+	}
+	return m.OnEvent(n, evt)
+}
+
+// setManager sets the namespace manager that holds this node, or nil when the node is deleted.
+func (n *ObjectNode) setManager(m *NamespaceManager) {
+	n.Lock()
+	n.manager = m
+	n.Unlock()
+}
+
 type EventListener interface {
 	OnEvent(ua.Event)
 }
@@ -78,10 +78,7 @@ func (n *ObjectTypeNode) UserRolePermissions(ctx context.Context) []ua.RolePermi
 		return filteredPermissions
 	}
 	roles := session.UserRoles()
-	rolePermissions := n.RolePermissions()
-	if rolePermissions == nil {
-		rolePermissions = session.Server().RolePermissions()
-	}
+	rolePermissions := session.Server().effectiveRolePermissions(ctx, n, roles)
 	for _, role := range roles {
 		for _, rp := range rolePermissions {
 			if rp.RoleID == role {
@@ -2,7 +2,11 @@
 
 package server
 
-import "github.com/awcullen/opcua/ua"
+import (
+	"log/slog"
+
+	"github.com/awcullen/opcua/ua"
+)
 
 // Option is a functional option to be applied to a server during initialization.
 type Option func(*Server) error
@@ -39,6 +43,16 @@ func WithServerCapabilities(value *ua.ServerCapabilities) Option {
 	}
 }
 
+// WithServerProfiles sets the profile URIs advertised in the ServerProfileArray, replacing the
+// profiles of the ServerCapabilities. Advertise only the profiles and facets the server
+// supports. (default: ua.ServerProfileURIStandardUA2017, ua.ServerProfileURIMethods)
+func WithServerProfiles(values ...string) Option {
+	return func(srv *Server) error {
+		srv.serverProfiles = values
+		return nil
+	}
+}
+
 // WithBuildInfo sets the BuildInfo returned by ServerStatus.
 func WithBuildInfo(value ua.BuildInfo) Option {
 	return func(srv *Server) error {
@@ -47,6 +61,44 @@ func WithBuildInfo(value ua.BuildInfo) Option {
 	}
 }
 
+// WithApplicationDescription sets the ApplicationDescription returned by discovery services and
+// CreateSession, replacing the description passed to New. An empty ApplicationURI is taken from the
+// server certificate, and empty DiscoveryURLs default to the endpointURL.
+func WithApplicationDescription(value ua.ApplicationDescription) Option {
+	return func(srv *Server) error {
+		srv.localDescription = value
+		return nil
+	}
+}
+
+// WithApplicationNames sets translations of the ApplicationName. Discovery services return
+// the translation that best matches the requested localeIds. (default: ApplicationName only)
+func WithApplicationNames(values ...ua.LocalizedText) Option {
+	return func(srv *Server) error {
+		srv.applicationNames = values
+		return nil
+	}
+}
+
+// WithTranslator sets the function that translates the DisplayName and Description of nodes
+// to the locales preferred by the session. Clients may change the locales by activating the
+// session again. (default: no translation)
+func WithTranslator(value TranslateFunc) Option {
+	return func(srv *Server) error {
+		srv.translator = value
+		return nil
+	}
+}
+
+// WithRetainHistory sets whether the history of a variable is retained when a client disables
+// Historizing. If false, the history is deleted if the historian implements HistoryDeleter. (default: true)
+func WithRetainHistory(value bool) Option {
+	return func(srv *Server) error {
+		srv.retainHistory = value
+		return nil
+	}
+}
+
 // WithInsecureSkipVerify skips verification of client certificate. Skips checking HostName, Expiration, and Authority.
 func WithInsecureSkipVerify() Option {
 	return func(srv *Server) error {
@@ -56,6 +108,25 @@ func WithInsecureSkipVerify() Option {
 	}
 }
 
+// WithCertificateValidator sets the validator of client certificates. If set, it is used instead of
+// the trusted certificates path and WithInsecureSkipVerify.
+func WithCertificateValidator(validator *ua.CertificateValidator) Option {
+	return func(srv *Server) error {
+		srv.certificateValidator = validator
+		return nil
+	}
+}
+
+// WithRejectedCertificatesPath sets the directory where the server saves the client certificates it
+// rejected, e.g. "./pki/rejected". A Global Discovery Server reads them with the GetRejectedList method
+// of the ServerConfiguration. (default: "", the rejected certificates are not saved)
+func WithRejectedCertificatesPath(path string) Option {
+	return func(srv *Server) error {
+		srv.rejectedCertsPath = path
+		return nil
+	}
+}
+
 // WithTransportLimits ...
 func WithTransportLimits(receiveBufferSize, sendBufferSize, maxMessageSize, maxChunkCount uint32) Option {
 	return func(srv *Server) error {
@@ -91,6 +162,19 @@ func WithTrace() Option {
 	}
 }
 
+// WithLogger sets the logger of structured logs of secure channels, sessions, service faults, and
+// rejected certificates. The records have the attributes sessionId, channelId, service, and statusCode.
+// (default: discards all records)
+func WithLogger(logger *slog.Logger) Option {
+	return func(srv *Server) error {
+		if logger == nil {
+			logger = slog.New(ua.DiscardHandler{})
+		}
+		srv.logger = logger
+		return nil
+	}
+}
+
 // WithAnonymousIdentity sets whether to allow anonymous identity.
 func WithAnonymousIdentity(value bool) Option {
 	return func(srv *Server) error {
@@ -99,6 +183,16 @@ func WithAnonymousIdentity(value bool) Option {
 	}
 }
 
+// WithAuditing sets whether to raise audit events, from the Server object, when a session is
+// activated or rejected, and when a client writes to a VariableNode that is audited. Only users with
+// the SecurityAdmin role receive the audit events.
+func WithAuditing(value bool) Option {
+	return func(srv *Server) error {
+		srv.auditing = value
+		return nil
+	}
+}
+
 // WithSecurityPolicyNone sets whether to allow security policy with no encryption.
 func WithSecurityPolicyNone(value bool) Option {
 	return func(srv *Server) error {
@@ -107,6 +201,18 @@ func WithSecurityPolicyNone(value bool) Option {
 	}
 }
 
+// WithSecurityLevel sets the SecurityLevel reported for the endpoint with the given security policy.
+// Clients that select the best available endpoint choose the one with the highest level.
+func WithSecurityLevel(securityPolicyURI string, level byte) Option {
+	return func(srv *Server) error {
+		if srv.securityLevels == nil {
+			srv.securityLevels = make(map[string]byte)
+		}
+		srv.securityLevels[securityPolicyURI] = level
+		return nil
+	}
+}
+
 // WithUserNameIdentityAuthenticator sets the authenticator for UserNameIdentity.
 func WithUserNameIdentityAuthenticator(authenticator UserNameIdentityAuthenticator) Option {
 	return func(srv *Server) error {
@@ -139,6 +245,32 @@ func WithAuthenticateX509IdentityFunc(f AuthenticateX509IdentityFunc) Option {
 	}
 }
 
+// WithUserCertificateValidator sets the validator of the certificates of X509Identity users. If set,
+// the certificate must chain to a trusted certificate, and the endpoints accept X509IdentityTokens.
+func WithUserCertificateValidator(validator *ua.CertificateValidator) Option {
+	return func(srv *Server) error {
+		srv.userCertificateValidator = validator
+		return nil
+	}
+}
+
+// WithIssuedIdentityAuthenticator sets the authenticator for IssuedIdentity, e.g. a JWTAuthenticator.
+// If set, the endpoints accept IssuedIdentityTokens that are JSON Web Tokens.
+func WithIssuedIdentityAuthenticator(authenticator IssuedIdentityAuthenticator) Option {
+	return func(srv *Server) error {
+		srv.issuedIdentityAuthenticator = authenticator
+		return nil
+	}
+}
+
+// WithAuthenticateIssuedIdentityFunc sets the authenticate func for IssuedIdentity.
+func WithAuthenticateIssuedIdentityFunc(f AuthenticateIssuedIdentityFunc) Option {
+	return func(srv *Server) error {
+		srv.issuedIdentityAuthenticator = f
+		return nil
+	}
+}
+
 // WithRolesProvider sets the RolesProvider.
 func WithRolesProvider(provider RolesProvider) Option {
 	return func(srv *Server) error {
@@ -155,6 +287,43 @@ func WithRolePermissions(permissions []ua.RolePermissionType) Option {
 	}
 }
 
+// WithAccessPolicy sets the AccessPolicyFunc that computes the permissions of nodes having
+// no RolePermissions of their own. (default: use the permissions set by WithRolePermissions)
+func WithAccessPolicy(policy AccessPolicyFunc) Option {
+	return func(srv *Server) error {
+		srv.accessPolicy = policy
+		return nil
+	}
+}
+
+// WithNotificationInterceptor sets a func that may replace each value before it is sent to the
+// client in a data change notification. (default: values are sent unchanged)
+func WithNotificationInterceptor(f NotificationInterceptorFunc) Option {
+	return func(srv *Server) error {
+		srv.notificationInterceptor = f
+		return nil
+	}
+}
+
+// WithNotificationStore sets the NotificationStore that retains the notification messages of
+// subscriptions for republishing. (default: NewMemoryNotificationStore())
+func WithNotificationStore(store NotificationStore) Option {
+	return func(srv *Server) error {
+		srv.notificationStore = store
+		return nil
+	}
+}
+
+// WithChangeTolerance sets the tolerance used to detect a change of Float and Double values, when
+// the client requests no deadband. Use VariableNode.SetChangeTolerance to set the tolerance of a
+// node. (default: any change is reported)
+func WithChangeTolerance(value ChangeTolerance) Option {
+	return func(srv *Server) error {
+		srv.changeTolerance = value
+		return nil
+	}
+}
+
 // WithHistorian sets the HistoryReadWriter.
 func WithHistorian(historian HistoryReadWriter) Option {
 	return func(srv *Server) error {
@@ -0,0 +1,160 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/awcullen/opcua/ua"
+	"github.com/google/uuid"
+)
+
+// PubSubTransport sends encoded NetworkMessages to a message oriented middleware, such as an MQTT broker.
+// MQTTTransport publishes to an MQTT broker.
+// See https://reference.opcfoundation.org/v104/Core/docs/Part14/7.3.4/
+type PubSubTransport interface {
+	// Publish sends the payload to the given topic (or queue) of the broker.
+	Publish(ctx context.Context, topic string, payload []byte) error
+}
+
+// PublishedVariable selects the value of a Variable node to be published as a field of a DataSet.
+type PublishedVariable struct {
+	// Name is the field name used in the payload of the DataSetMessage.
+	Name string
+	// NodeID identifies the Variable node.
+	NodeID ua.NodeID
+}
+
+// PublisherConfig configures a Publisher.
+type PublisherConfig struct {
+	// PublisherID identifies the publisher. Defaults to the ApplicationURI of the server.
+	PublisherID string
+	// DataSetWriterID identifies the DataSetWriter within the publisher.
+	DataSetWriterID uint16
+	// Topic is the broker topic (or queue name) to publish to.
+	Topic string
+	// PublishingInterval is the interval between DataSetMessages.
+	PublishingInterval time.Duration
+	// Variables are the fields of the published DataSet.
+	Variables []PublishedVariable
+}
+
+// Publisher periodically publishes the current values of a set of Variable nodes as
+// OPC UA PubSub JSON NetworkMessages.
+// See https://reference.opcfoundation.org/v104/Core/docs/Part14/7.2.3/
+type Publisher struct {
+	sync.Mutex
+	srv            *Server
+	transport      PubSubTransport
+	config         PublisherConfig
+	sequenceNumber uint32
+	pollGroup      *PollGroup
+}
+
+// jsonNetworkMessage is the JSON encoding of a NetworkMessage.
+type jsonNetworkMessage struct {
+	MessageID   string               `json:"MessageId"`
+	MessageType string               `json:"MessageType"`
+	PublisherID string               `json:"PublisherId,omitempty"`
+	Messages    []jsonDataSetMessage `json:"Messages"`
+}
+
+// jsonDataSetMessage is the JSON encoding of a DataSetMessage. The fields of the payload are
+// encoded with the reversible form of the OPC UA JSON encoding.
+type jsonDataSetMessage struct {
+	DataSetWriterID uint16                    `json:"DataSetWriterId"`
+	SequenceNumber  uint32                    `json:"SequenceNumber"`
+	Timestamp       time.Time                 `json:"Timestamp"`
+	Payload         map[string]ua.JSONVariant `json:"Payload"`
+}
+
+// NewPublisher constructs a new Publisher of the server's node values.
+func NewPublisher(srv *Server, transport PubSubTransport, config PublisherConfig) *Publisher {
+	if config.PublisherID == "" {
+		config.PublisherID = srv.LocalDescription().ApplicationURI
+	}
+	if config.PublishingInterval <= 0 {
+		config.PublishingInterval = time.Second
+	}
+	return &Publisher{
+		srv:       srv,
+		transport: transport,
+		config:    config,
+	}
+}
+
+// Start begins publishing at the configured interval. Publishing stops when the server closes.
+func (p *Publisher) Start() {
+	p.Lock()
+	defer p.Unlock()
+	if p.pollGroup != nil {
+		return
+	}
+	p.pollGroup = p.srv.Scheduler().GetPollGroup(p.config.PublishingInterval)
+	p.pollGroup.Subscribe(p)
+}
+
+// Stop ends publishing.
+func (p *Publisher) Stop() {
+	p.Lock()
+	defer p.Unlock()
+	if p.pollGroup == nil {
+		return
+	}
+	p.pollGroup.Unsubscribe(p)
+	p.pollGroup = nil
+}
+
+// Poll is called by the scheduler at the publishing interval. Errors are logged by the logger of the server.
+func (p *Publisher) Poll() {
+	ctx, cancel := context.WithTimeout(context.Background(), p.config.PublishingInterval)
+	defer cancel()
+	if err := p.Publish(ctx); err != nil {
+		p.srv.logger.Warn("Error publishing", slog.String("topic", p.config.Topic), ua.StatusCodeAttr(err))
+	}
+}
+
+// Publish sends a NetworkMessage with the current values of the variables.
+func (p *Publisher) Publish(ctx context.Context) error {
+	payload, err := p.encode()
+	if err != nil {
+		return err
+	}
+	return p.transport.Publish(ctx, p.config.Topic, payload)
+}
+
+// encode returns the JSON encoded NetworkMessage with the current values of the variables.
+func (p *Publisher) encode() ([]byte, error) {
+	p.Lock()
+	p.sequenceNumber++
+	seq := p.sequenceNumber
+	p.Unlock()
+	nm := p.srv.NamespaceManager()
+	fields := make(map[string]ua.JSONVariant, len(p.config.Variables))
+	for _, v := range p.config.Variables {
+		n, ok := nm.FindVariable(v.NodeID)
+		if !ok {
+			fields[v.Name] = ua.JSONVariant{}
+			continue
+		}
+		fields[v.Name] = ua.JSONVariant{Value: n.Value().Value}
+	}
+	msg := jsonNetworkMessage{
+		MessageID:   uuid.New().String(),
+		MessageType: "ua-data",
+		PublisherID: p.config.PublisherID,
+		Messages: []jsonDataSetMessage{
+			{
+				DataSetWriterID: p.config.DataSetWriterID,
+				SequenceNumber:  seq,
+				Timestamp:       time.Now().UTC(),
+				Payload:         fields,
+			},
+		},
+	}
+	return json.Marshal(msg)
+}
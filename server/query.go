@@ -0,0 +1,173 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package server
+
+import (
+	"context"
+	"math"
+
+	"github.com/awcullen/opcua/ua"
+)
+
+// parseNodeTypes checks the type definition and the data to return of each NodeTypeDescription of a
+// Query. Returns nil if all are valid, or a ParsingResult for each NodeTypeDescription.
+func (srv *Server) parseNodeTypes(nodeTypes []ua.NodeTypeDescription) []ua.ParsingResult {
+	m := srv.NamespaceManager()
+	results := make([]ua.ParsingResult, len(nodeTypes))
+	valid := true
+	for i, nt := range nodeTypes {
+		n, ok := m.FindNode(ua.ToNodeID(nt.TypeDefinitionNode, srv.NamespaceUris()))
+		if !ok {
+			results[i].StatusCode = ua.BadNodeIDUnknown
+			valid = false
+			continue
+		}
+		if nc := n.NodeClass(); nc != ua.NodeClassObjectType && nc != ua.NodeClassVariableType {
+			results[i].StatusCode = ua.BadNotTypeDefinition
+			valid = false
+			continue
+		}
+		codes := make([]ua.StatusCode, len(nt.DataToReturn))
+		for j, d := range nt.DataToReturn {
+			switch {
+			case d.AttributeID < ua.AttributeIDNodeID || d.AttributeID > ua.AttributeIDAccessLevelEx:
+				codes[j] = ua.BadAttributeIDInvalid
+			case d.IndexRange != "" && d.AttributeID != ua.AttributeIDValue:
+				codes[j] = ua.BadIndexRangeInvalid
+			}
+			for _, e := range d.RelativePath.Elements {
+				if e.TargetName.Name == "" {
+					codes[j] = ua.BadBrowseNameInvalid
+				}
+			}
+			if codes[j] != ua.Good {
+				results[i].StatusCode = ua.BadInvalidArgument
+				results[i].DataStatusCodes = codes
+				valid = false
+			}
+		}
+	}
+	if valid {
+		return nil
+	}
+	return results
+}
+
+// query returns a QueryDataSet for each node that is an instance of one of the NodeTypes and matches
+// the filter. The filter must have been resolved by resolveContentFilter. A node that is an instance of
+// several of the NodeTypes is returned once, with the data of the first.
+func (srv *Server) query(ctx context.Context, nodeTypes []ua.NodeTypeDescription, filter ua.ContentFilter) []ua.QueryDataSet {
+	m := srv.NamespaceManager()
+	patterns := likePatterns{}
+	visited := map[ua.NodeID]struct{}{}
+	results := []ua.QueryDataSet{}
+	for _, nt := range nodeTypes {
+		for _, n := range m.findInstances(ua.ToNodeID(nt.TypeDefinitionNode, srv.NamespaceUris()), nt.IncludeSubTypes) {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if _, ok := visited[n.NodeID()]; ok {
+				continue
+			}
+			if !IsUserPermitted(n.UserRolePermissions(ctx), ua.PermissionTypeBrowse) {
+				continue
+			}
+			target := queryFilterTarget{srv: srv, ctx: ctx, node: n, typeID: typeDefinition(m, n)}
+			if res, ok := evaluateFilter(filter, 0, target, &patterns).(bool); !ok || !res {
+				continue
+			}
+			visited[n.NodeID()] = struct{}{}
+			values := make([]ua.Variant, len(nt.DataToReturn))
+			for i, d := range nt.DataToReturn {
+				values[i] = srv.queryValue(ctx, n, d)
+			}
+			results = append(results, ua.QueryDataSet{
+				NodeID:             ua.NewExpandedNodeID(n.NodeID()),
+				TypeDefinitionNode: ua.NewExpandedNodeID(target.typeID),
+				Values:             values,
+			})
+		}
+	}
+	return results
+}
+
+// queryValue returns the attribute of the node at the end of the relative path from the node. If the
+// path ends at several nodes, the values are returned as an array. Returns nil if the path has no
+// target, or the attribute cannot be read.
+func (srv *Server) queryValue(ctx context.Context, n Node, d ua.QueryDataDescription) ua.Variant {
+	if len(d.RelativePath.Elements) == 0 {
+		return srv.queryAttribute(ctx, n.NodeID(), d.AttributeID, d.IndexRange)
+	}
+	targets, err := srv.follow(ctx, n.NodeID(), d.RelativePath.Elements)
+	if err != nil {
+		return nil
+	}
+	values := make([]ua.Variant, 0, len(targets))
+	for _, t := range targets {
+		if t.RemainingPathIndex != math.MaxUint32 {
+			continue
+		}
+		values = append(values, srv.queryAttribute(ctx, ua.ToNodeID(t.TargetID, srv.NamespaceUris()), d.AttributeID, d.IndexRange))
+	}
+	switch len(values) {
+	case 0:
+		return nil
+	case 1:
+		return values[0]
+	default:
+		return values
+	}
+}
+
+// queryAttribute reads the attribute of the node. Returns nil if the attribute cannot be read.
+func (srv *Server) queryAttribute(ctx context.Context, id ua.NodeID, attributeID uint32, indexRange string) ua.Variant {
+	v := srv.readValue(ctx, ua.ReadValueID{NodeID: id, AttributeID: attributeID, IndexRange: indexRange})
+	if v.StatusCode.IsBad() {
+		return nil
+	}
+	return v.Value
+}
+
+// typeDefinition returns the NodeID of the type definition of the node, or nil.
+func typeDefinition(m *NamespaceManager, n Node) ua.NodeID {
+	for _, r := range n.References() {
+		if !r.IsInverse && r.ReferenceTypeID == ua.ReferenceTypeIDHasTypeDefinition {
+			return ua.ToNodeID(r.TargetID, m.NamespaceUris())
+		}
+	}
+	return nil
+}
+
+// queryFilterTarget is the filterTarget of a node found by the Query service.
+type queryFilterTarget struct {
+	srv    *Server
+	ctx    context.Context
+	node   Node
+	typeID ua.NodeID
+}
+
+// attribute returns the attribute of the instance declaration at the browse path of the operand, if
+// the node is an instance of the type of the operand.
+func (t queryFilterTarget) attribute(op ua.SimpleAttributeOperand) ua.Variant {
+	if !t.ofType(op.TypeDefinitionID) {
+		return nil
+	}
+	m := t.srv.NamespaceManager()
+	n := t.node
+	for _, name := range op.BrowsePath {
+		if n1, ok := m.FindComponent(n, name); ok {
+			n = n1
+			continue
+		}
+		if n1, ok := m.FindProperty(n, name); ok {
+			n = n1
+			continue
+		}
+		return nil
+	}
+	return t.srv.queryAttribute(t.ctx, n.NodeID(), op.AttributeID, op.IndexRange)
+}
+
+func (t queryFilterTarget) ofType(typeID ua.NodeID) bool {
+	return t.typeID == typeID || t.srv.NamespaceManager().IsSubtype(t.typeID, typeID)
+}
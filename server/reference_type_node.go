@@ -80,10 +80,7 @@ func (n *ReferenceTypeNode) UserRolePermissions(ctx context.Context) []ua.RolePe
 		return filteredPermissions
 	}
 	roles := session.UserRoles()
-	rolePermissions := n.RolePermissions()
-	if rolePermissions == nil {
-		rolePermissions = session.Server().RolePermissions()
-	}
+	rolePermissions := session.Server().effectiveRolePermissions(ctx, n, roles)
 	for _, role := range roles {
 		for _, rp := range rolePermissions {
 			if rp.RoleID == role {
@@ -0,0 +1,111 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package server
+
+import (
+	"log"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/awcullen/opcua/ua"
+)
+
+const (
+	// the delay before redialing a client after the first failed attempt.
+	minReverseConnectDelay = 1 * time.Second
+	// the maximum delay before redialing a client.
+	maxReverseConnectDelay = 30 * time.Second
+)
+
+// AddReverseConnection connects the server to a client that listens at the clientEndpointURL, e.g.
+// "opc.tcp://central:4840". The server dials the client, sends a ReverseHello message, then runs
+// the secure channel over the connection as if the client had connected to the server. When the
+// connection closes, the server dials the client again, so the client always has a connection
+// ready to open the next secure channel. Failed attempts are retried with increasing delay,
+// until the server is closed. See part6 7.1.3
+func (srv *Server) AddReverseConnection(clientEndpointURL string) error {
+	u, err := url.Parse(clientEndpointURL)
+	if err != nil || u.Scheme != "opc.tcp" || u.Host == "" {
+		return ua.BadTCPEndpointURLInvalid
+	}
+	go srv.reverseConnect(u.Host)
+	return nil
+}
+
+// reverseConnect dials the client until the server is closed.
+func (srv *Server) reverseConnect(address string) {
+	var delay time.Duration
+	for {
+		select {
+		case <-srv.closing:
+			return
+		default:
+		}
+		conn, err := net.DialTimeout("tcp", address, 10*time.Second)
+		if err == nil {
+			err = srv.sendReverseHello(conn)
+			if err != nil {
+				conn.Close()
+			}
+		}
+		if err != nil {
+			if delay == 0 {
+				delay = minReverseConnectDelay
+			} else {
+				delay *= 2
+			}
+			if delay > maxReverseConnectDelay {
+				delay = maxReverseConnectDelay
+			}
+			log.Printf("Error connecting to client '%s'. %s\n", address, err)
+			select {
+			case <-srv.closing:
+				return
+			case <-time.After(delay):
+			}
+			continue
+		}
+		delay = 0
+		rc := &reverseConn{Conn: conn, done: make(chan struct{})}
+		go srv.openSecureChannel(rc)
+		// wait until the secure channel closes the connection, then dial again.
+		select {
+		case <-srv.closing:
+			rc.Close()
+			return
+		case <-rc.done:
+		}
+	}
+}
+
+// sendReverseHello sends the ReverseHello message, which tells the client the ApplicationURI and
+// EndpointURL of the server.
+func (srv *Server) sendReverseHello(conn net.Conn) error {
+	buf := *(bytesPool.Get().(*[]byte))
+	defer bytesPool.Put(&buf)
+	var writer = ua.NewWriter(buf)
+	var enc = ua.NewBinaryEncoder(writer, ua.NewEncodingContext())
+	serverURI := srv.localDescription.ApplicationURI
+	enc.WriteUInt32(ua.MessageTypeReverseHello)
+	enc.WriteUInt32(uint32(16 + len(serverURI) + len(srv.endpointURL)))
+	enc.WriteString(serverURI)
+	enc.WriteString(srv.endpointURL)
+	_, err := conn.Write(writer.Bytes())
+	return err
+}
+
+// reverseConn is a connection that signals when it is closed.
+type reverseConn struct {
+	net.Conn
+	once sync.Once
+	done chan struct{}
+}
+
+// Close closes the connection and signals done.
+func (c *reverseConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() { close(c.done) })
+	return err
+}
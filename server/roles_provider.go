@@ -1,8 +1,10 @@
 package server
 
 import (
+	"context"
 	"crypto/sha1"
 	"fmt"
+	"strings"
 
 	"github.com/awcullen/opcua/ua"
 )
@@ -15,6 +17,11 @@ type RolesProvider interface {
 	GetRoles(userIdentity interface{}, applicationURI string, endpointURL string) ([]ua.NodeID, error)
 }
 
+// AccessPolicyFunc returns the RolePermissions of a node for the given roles of the current user.
+// It is evaluated at access time for each node that has no RolePermissions of its own, so
+// permission decisions can be made centrally, e.g. by consulting an external access control list.
+type AccessPolicyFunc func(ctx context.Context, node Node, roles []ua.NodeID) []ua.RolePermissionType
+
 // IdentityMappingRule ...
 type IdentityMappingRule struct {
 	NodeID              ua.NodeID
@@ -117,9 +124,24 @@ func IsUserPermitted(userRolePermissions []ua.RolePermissionType, permissionType
 	return false
 }
 
+// UserGroupsFunc returns the groups of the user, e.g. from a directory service. The groups are
+// matched against identity mapping rules with CriteriaType GroupId.
+type UserGroupsFunc func(userIdentity interface{}) []string
+
+// UserNameGroups returns a UserGroupsFunc that returns the configured groups of a UserNameIdentity.
+func UserNameGroups(groups map[string][]string) UserGroupsFunc {
+	return func(userIdentity interface{}) []string {
+		if id, ok := userIdentity.(ua.UserNameIdentity); ok {
+			return groups[id.UserName]
+		}
+		return nil
+	}
+}
+
 // RulesBasedRolesProvider returns WellKnownRoles given server identity mapping rules.
 type RulesBasedRolesProvider struct {
 	identityMappingRules []IdentityMappingRule
+	userGroups           UserGroupsFunc
 }
 
 // NewRulesBasedRolesProvider ...
@@ -129,8 +151,48 @@ func NewRulesBasedRolesProvider(rules []IdentityMappingRule) RolesProvider {
 	}
 }
 
-// GetRoles ...
+// NewRulesBasedRolesProviderWithGroups returns a RulesBasedRolesProvider that also grants the roles
+// of rules with CriteriaType GroupId, if the user is a member of the group.
+func NewRulesBasedRolesProviderWithGroups(rules []IdentityMappingRule, userGroups UserGroupsFunc) RolesProvider {
+	return &RulesBasedRolesProvider{
+		identityMappingRules: rules,
+		userGroups:           userGroups,
+	}
+}
+
+// claimsRolesProvider is implemented by a RolesProvider that also matches the claims of a JSON Web Token
+// verified by the JWTAuthenticator.
+type claimsRolesProvider interface {
+	getRoles(userIdentity interface{}, claims map[string]interface{}, applicationURI string, endpointURL string) ([]ua.NodeID, error)
+}
+
+var _ claimsRolesProvider = (*RulesBasedRolesProvider)(nil)
+
+// GetRoles returns the role of each rule where the application and endpoint are not excluded, and
+// any identity criteria matches the user. Anonymous users match the Anonymous criteria. Authenticated
+// users match the AuthenticatedUser criteria, and the UserName, Thumbprint or GroupId criteria of
+// their identity. Returns BadUserAccessDenied if no role is granted.
 func (p *RulesBasedRolesProvider) GetRoles(userIdentity interface{}, applicationURI string, endpointURL string) ([]ua.NodeID, error) {
+	return p.getRoles(userIdentity, nil, applicationURI, endpointURL)
+}
+
+// getRoles returns the roles of the user, like GetRoles. The subject and "groups" claim of a JSON Web
+// Token verified by the JWTAuthenticator match the UserName and GroupId criteria.
+func (p *RulesBasedRolesProvider) getRoles(userIdentity interface{}, claims map[string]interface{}, applicationURI string, endpointURL string) ([]ua.NodeID, error) {
+	switch userIdentity.(type) {
+	case ua.AnonymousIdentity, ua.UserNameIdentity, ua.X509Identity, ua.IssuedIdentity:
+	default:
+		return nil, ua.BadUserAccessDenied
+	}
+	var groups []string
+	if p.userGroups != nil {
+		if _, ok := userIdentity.(ua.AnonymousIdentity); !ok {
+			groups = p.userGroups(userIdentity)
+		}
+	}
+	if _, ok := userIdentity.(ua.IssuedIdentity); ok && claims != nil {
+		groups = append(groups, jwtGroups(claims)...)
+	}
 	roles := []ua.NodeID{}
 	for _, rule := range p.identityMappingRules {
 		ok := rule.ApplicationsExclude // true means the following applications should be excluded
@@ -141,7 +203,7 @@ func (p *RulesBasedRolesProvider) GetRoles(userIdentity interface{}, application
 			}
 		}
 		if !ok {
-			break // continue with next rule
+			continue // continue with next rule
 		}
 		ok = rule.EndpointsExclude // true means the following endpoints should be excluded
 		for _, ep := range rule.Endpoints {
@@ -151,47 +213,14 @@ func (p *RulesBasedRolesProvider) GetRoles(userIdentity interface{}, application
 			}
 		}
 		if !ok {
-			break // continue with next role
+			continue // continue with next rule
 		}
 		for _, identity := range rule.Identities {
-
-			switch id := userIdentity.(type) {
-			case ua.AnonymousIdentity:
-				if identity.CriteriaType == ua.IdentityCriteriaTypeAnonymous {
+			if isIdentityMatch(identity, userIdentity, claims, groups) {
+				if !Contains(roles, rule.NodeID) {
 					roles = append(roles, rule.NodeID)
-					break // continue with next identity
 				}
-
-			case ua.UserNameIdentity:
-				if identity.CriteriaType == ua.IdentityCriteriaTypeAuthenticatedUser {
-					roles = append(roles, rule.NodeID)
-					break // continue with next identity
-				}
-				if identity.CriteriaType == ua.IdentityCriteriaTypeUserName && identity.Criteria == id.UserName {
-					roles = append(roles, rule.NodeID)
-					break // continue with next identity
-				}
-
-			case ua.X509Identity:
-				if identity.CriteriaType == ua.IdentityCriteriaTypeAuthenticatedUser {
-					roles = append(roles, rule.NodeID)
-					break // continue with next identity
-				}
-				thumbprint := fmt.Sprintf("%x", sha1.Sum([]byte(id.Certificate)))
-				if identity.CriteriaType == ua.IdentityCriteriaTypeThumbprint && identity.Criteria == thumbprint {
-					roles = append(roles, rule.NodeID)
-					break // continue with next identity
-				}
-
-			case ua.IssuedIdentity:
-				if identity.CriteriaType == ua.IdentityCriteriaTypeAuthenticatedUser {
-					roles = append(roles, rule.NodeID)
-					break // continue with next identity
-				}
-
-			default:
-				return nil, ua.BadUserAccessDenied
-
+				break // continue with next rule
 			}
 		}
 	}
@@ -200,3 +229,34 @@ func (p *RulesBasedRolesProvider) GetRoles(userIdentity interface{}, application
 	}
 	return roles, nil
 }
+
+// isIdentityMatch returns true if the user identity, its verified claims, or one of the groups of the user,
+// matches the criteria.
+func isIdentityMatch(identity ua.IdentityMappingRuleType, userIdentity interface{}, claims map[string]interface{}, groups []string) bool {
+	switch identity.CriteriaType {
+	case ua.IdentityCriteriaTypeAnonymous:
+		_, ok := userIdentity.(ua.AnonymousIdentity)
+		return ok
+	case ua.IdentityCriteriaTypeAuthenticatedUser:
+		_, ok := userIdentity.(ua.AnonymousIdentity)
+		return !ok
+	case ua.IdentityCriteriaTypeUserName:
+		switch id := userIdentity.(type) {
+		case ua.UserNameIdentity:
+			return identity.Criteria == id.UserName
+		case ua.IssuedIdentity:
+			sub, _ := claims["sub"].(string)
+			return sub != "" && identity.Criteria == sub
+		}
+	case ua.IdentityCriteriaTypeThumbprint:
+		id, ok := userIdentity.(ua.X509Identity)
+		return ok && strings.EqualFold(identity.Criteria, fmt.Sprintf("%x", sha1.Sum([]byte(id.Certificate))))
+	case ua.IdentityCriteriaTypeGroupID:
+		for _, g := range groups {
+			if identity.Criteria == g {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -22,10 +23,11 @@ type Scheduler struct {
 	cancellationCh      chan struct{}
 	tickers             map[time.Duration]*PollGroup
 	minSamplingInterval time.Duration
+	running             *int64
 }
 
 func NewScheduler(server *Server) *Scheduler {
-	s := &Scheduler{sync.Mutex{}, server.closing, make(map[time.Duration]*PollGroup), time.Duration(server.ServerCapabilities().MinSupportedSampleRate) * time.Millisecond}
+	s := &Scheduler{sync.Mutex{}, server.closing, make(map[time.Duration]*PollGroup), time.Duration(server.ServerCapabilities().MinSupportedSampleRate) * time.Millisecond, &server.goroutines.samplers}
 	return s
 }
 
@@ -38,7 +40,7 @@ func (s *Scheduler) GetPollGroup(interval time.Duration) *PollGroup {
 	if t, ok := s.tickers[interval]; ok {
 		return t
 	}
-	t := NewPollGroup(interval, s.cancellationCh)
+	t := newPollGroup(interval, s.cancellationCh, s)
 	s.tickers[interval] = t
 	return t
 }
@@ -48,21 +50,42 @@ type PollGroup struct {
 	cancellationCh chan struct{}
 	interval       time.Duration
 	subs           map[PollListener]struct{}
+	scheduler      *Scheduler
+	stop           chan struct{}
 }
 
 func NewPollGroup(interval time.Duration, cancellationCh chan struct{}) *PollGroup {
+	return newPollGroup(interval, cancellationCh, nil)
+}
+
+// newPollGroup starts a PollGroup. If the PollGroup belongs to a scheduler, it stops
+// when the last listener unsubscribes, and restarts when a listener subscribes again.
+func newPollGroup(interval time.Duration, cancellationCh chan struct{}, scheduler *Scheduler) *PollGroup {
 	b := &PollGroup{
 		Mutex:          sync.Mutex{},
 		cancellationCh: cancellationCh,
 		interval:       interval,
 		subs:           map[PollListener]struct{}{},
+		scheduler:      scheduler,
 	}
-	go b.run()
+	b.start()
 	// log.Printf("Opening PollGroup %d ms\n", b.interval.Nanoseconds()/1000000)
 	return b
 }
 
-func (b *PollGroup) run() {
+// start runs the goroutine of the PollGroup. Caller must hold the lock, or own the PollGroup.
+func (b *PollGroup) start() {
+	b.stop = make(chan struct{})
+	if b.scheduler != nil {
+		atomic.AddInt64(b.scheduler.running, 1)
+	}
+	go b.run(b.stop)
+}
+
+func (b *PollGroup) run(stop chan struct{}) {
+	if b.scheduler != nil {
+		defer atomic.AddInt64(b.scheduler.running, -1)
+	}
 	ticker := time.NewTicker(b.interval)
 	for {
 		select {
@@ -75,6 +98,9 @@ func (b *PollGroup) run() {
 			}
 			b.Unlock()
 			return
+		case <-stop:
+			ticker.Stop()
+			return
 		case <-ticker.C:
 			b.Lock()
 			listeners := make([]PollListener, len(b.subs))
@@ -92,14 +118,36 @@ func (b *PollGroup) run() {
 }
 
 func (b *PollGroup) Subscribe(listener PollListener) {
+	if s := b.scheduler; s != nil {
+		s.Lock()
+		defer s.Unlock()
+	}
 	b.Lock()
 	b.subs[listener] = struct{}{}
+	if b.stop == nil {
+		// the last listener unsubscribed after GetPollGroup returned this PollGroup.
+		b.start()
+		if _, ok := b.scheduler.tickers[b.interval]; !ok {
+			b.scheduler.tickers[b.interval] = b
+		}
+	}
 	b.Unlock()
 }
 
 func (b *PollGroup) Unsubscribe(listener PollListener) {
+	if s := b.scheduler; s != nil {
+		s.Lock()
+		defer s.Unlock()
+	}
 	b.Lock()
 	delete(b.subs, listener)
+	if b.scheduler != nil && b.stop != nil && len(b.subs) == 0 {
+		close(b.stop)
+		b.stop = nil
+		if b.scheduler.tickers[b.interval] == b {
+			delete(b.scheduler.tickers, b.interval)
+		}
+	}
 	b.Unlock()
 }
 
@@ -1,11 +1,15 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"crypto/rsa"
+	"crypto/sha1"
 	"crypto/tls"
+	"crypto/x509"
 	_ "embed"
 	"log"
+	"log/slog"
 	"net"
 	"net/url"
 	"sync"
@@ -13,6 +17,7 @@ import (
 
 	"github.com/awcullen/opcua/ua"
 	"github.com/gammazero/workerpool"
+	"github.com/google/uuid"
 )
 
 type key string
@@ -54,13 +59,17 @@ type Server struct {
 	maxSessionCount                    uint32
 	maxSubscriptionCount               uint32
 	serverCapabilities                 *ua.ServerCapabilities
+	serverProfiles                     []string
 	buildInfo                          ua.BuildInfo
+	applicationNames                   []ua.LocalizedText
+	translator                         TranslateFunc
 	certPath                           string
 	keyPath                            string
 	trustedCertsPath                   string
 	endpointURL                        string
 	suppressCertificateExpired         bool
 	suppressCertificateChainIncomplete bool
+	certificateValidator               *ua.CertificateValidator
 	receiveBufferSize                  uint32
 	sendBufferSize                     uint32
 	maxMessageSize                     uint32
@@ -68,12 +77,21 @@ type Server struct {
 	maxWorkerThreads                   int
 	serverDiagnostics                  bool
 	trace                              bool
+	logger                             *slog.Logger
 	localCertificate                   []byte
 	localPrivateKey                    *rsa.PrivateKey
+	previousCertificate                []byte
+	previousPrivateKey                 *rsa.PrivateKey
+	certificateLock                    sync.Mutex
+	pendingCertificate                 *tls.Certificate
+	regeneratedPrivateKey              *rsa.PrivateKey
+	rejectedCertsPath                  string
+	rejectedCertificates               []ua.ByteString
 	listeners                          []net.Listener
 	closed                             chan struct{}
 	closing                            chan struct{}
 	stateSemaphore                     chan struct{}
+	goroutines                         goroutineCounters
 	state                              ua.ServerState
 	secondsTillShutdown                uint32
 	shutdownReason                     ua.LocalizedText
@@ -87,13 +105,24 @@ type Server struct {
 	serverDiagnosticsSummary           *ua.ServerDiagnosticsSummaryDataType
 	scheduler                          *Scheduler
 	historian                          HistoryReadWriter
+	retainHistory                      bool
 	allowAnonymousIdentity             bool
+	auditing                           bool
 	allowSecurityPolicyNone            bool
+	securityLevels                     map[string]byte
 	userNameIdentityAuthenticator      UserNameIdentityAuthenticator
 	x509IdentityAuthenticator          X509IdentityAuthenticator
+	userCertificateValidator           *ua.CertificateValidator
 	issuedIdentityAuthenticator        IssuedIdentityAuthenticator
 	rolesProvider                      RolesProvider
 	rolePermissions                    []ua.RolePermissionType
+	accessPolicy                       AccessPolicyFunc
+	notificationInterceptor            NotificationInterceptorFunc
+	notificationStore                  NotificationStore
+	instanceID                         string
+	changeTolerance                    ChangeTolerance
+	transactionLock                    sync.RWMutex
+	lifecycleHook                      LifecycleHandler
 }
 
 // New initializes a new instance of the Server.
@@ -120,16 +149,19 @@ func New(localDescription ua.ApplicationDescription, certPath, keyPath, endpoint
 		maxWorkerThreads:                   defaultMaxWorkerThreads,
 		serverDiagnostics:                  true,
 		trace:                              false,
+		logger:                             slog.New(ua.DiscardHandler{}),
 		closed:                             make(chan struct{}),
 		closing:                            make(chan struct{}),
 		stateSemaphore:                     make(chan struct{}, 1),
 		listeners:                          make([]net.Listener, 0, 3),
-		serverUris:                         []string{localDescription.ApplicationURI},
 		state:                              ua.ServerStateUnknown,
 		startTime:                          time.Now(),
 		serverDiagnosticsSummary:           &ua.ServerDiagnosticsSummaryDataType{},
 		rolesProvider:                      NewRulesBasedRolesProvider(DefaultIdentityMappingRules),
 		rolePermissions:                    DefaultRolePermissions,
+		retainHistory:                      true,
+		notificationStore:                  NewMemoryNotificationStore(),
+		instanceID:                         uuid.New().String(),
 	}
 
 	// apply each option to the default
@@ -139,12 +171,12 @@ func New(localDescription ua.ApplicationDescription, certPath, keyPath, endpoint
 		}
 	}
 
-	srv.workerpool = workerpool.New(srv.maxWorkerThreads)
-	srv.channelManager = NewChannelManager(srv)
-	srv.sessionManager = NewSessionManager(srv)
-	srv.subscriptionManager = NewSubscriptionManager(srv)
-	srv.namespaceManager = NewNamespaceManager(srv)
-	srv.scheduler = NewScheduler(srv)
+	// copy the capabilities, so the configured profiles do not change the caller's struct.
+	if srv.serverProfiles != nil {
+		caps := *srv.serverCapabilities
+		caps.ServerProfileArray = srv.serverProfiles
+		srv.serverCapabilities = &caps
+	}
 
 	cert, err := tls.LoadX509KeyPair(srv.certPath, srv.keyPath)
 	if err != nil {
@@ -153,6 +185,21 @@ func New(localDescription ua.ApplicationDescription, certPath, keyPath, endpoint
 	}
 	srv.localCertificate = cert.Certificate[0]
 	srv.localPrivateKey, _ = cert.PrivateKey.(*rsa.PrivateKey)
+	if err := srv.completeLocalDescription(); err != nil {
+		log.Printf("Error parsing x509 certificate. %s\n", err)
+		return nil, err
+	}
+	if err := srv.loadRejectedCertificates(); err != nil {
+		log.Printf("Error loading rejected certificates. %s\n", err)
+		return nil, err
+	}
+
+	srv.workerpool = workerpool.New(srv.maxWorkerThreads)
+	srv.channelManager = NewChannelManager(srv)
+	srv.sessionManager = NewSessionManager(srv)
+	srv.subscriptionManager = NewSubscriptionManager(srv)
+	srv.namespaceManager = NewNamespaceManager(srv)
+	srv.scheduler = NewScheduler(srv)
 
 	if err := srv.initializeNamespace(); err != nil {
 		log.Printf("Error initializing namespace. %s\n", err)
@@ -161,6 +208,35 @@ func New(localDescription ua.ApplicationDescription, certPath, keyPath, endpoint
 	return srv, nil
 }
 
+// completeLocalDescription fills the empty fields of the application description from the
+// server certificate and endpointURL, and warns if the ApplicationURI does not match the
+// subjectAltName of the certificate, as clients may reject the certificate.
+func (srv *Server) completeLocalDescription() error {
+	crt, err := x509.ParseCertificate(srv.localCertificate)
+	if err != nil {
+		return err
+	}
+	desc := &srv.localDescription
+	if desc.ApplicationURI == "" && len(crt.URIs) > 0 {
+		desc.ApplicationURI = crt.URIs[0].String()
+	}
+	if len(desc.DiscoveryURLs) == 0 {
+		desc.DiscoveryURLs = []string{srv.endpointURL}
+	}
+	match := false
+	for _, u := range crt.URIs {
+		if u.String() == desc.ApplicationURI {
+			match = true
+			break
+		}
+	}
+	if !match {
+		log.Printf("Warning: ApplicationURI '%s' does not match the subjectAltName of the server certificate.\n", desc.ApplicationURI)
+	}
+	srv.serverUris = []string{desc.ApplicationURI}
+	return nil
+}
+
 // LocalDescription gets the application description.
 func (srv *Server) LocalDescription() ua.ApplicationDescription {
 	srv.RLock()
@@ -168,6 +244,17 @@ func (srv *Server) LocalDescription() ua.ApplicationDescription {
 	return srv.localDescription
 }
 
+// localizedDescription gets the application description with the ApplicationName that best matches the localeIds.
+func (srv *Server) localizedDescription(localeIDs []string) ua.ApplicationDescription {
+	srv.RLock()
+	defer srv.RUnlock()
+	desc := srv.localDescription
+	if name, ok := selectLocalizedText(srv.applicationNames, localeIDs); ok {
+		desc.ApplicationName = name
+	}
+	return desc
+}
+
 // LocalCertificate gets the certificate for the local application.
 func (srv *Server) LocalCertificate() []byte {
 	srv.RLock()
@@ -175,6 +262,53 @@ func (srv *Server) LocalCertificate() []byte {
 	return srv.localCertificate
 }
 
+// ReplaceCertificate replaces the certificate and private key of the server, e.g. before the
+// certificate expires. New secure channels use the new certificate, and GetEndpoints returns the new
+// certificate. Existing secure channels and sessions keep the previous certificate for their lifetime.
+// Clients that got the endpoints before the replacement may still open a secure channel with the
+// previous certificate, until the certificate is replaced again.
+func (srv *Server) ReplaceCertificate(cert tls.Certificate) error {
+	if len(cert.Certificate) == 0 {
+		return ua.BadCertificateInvalid
+	}
+	crt, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return ua.BadCertificateInvalid
+	}
+	key, ok := cert.PrivateKey.(*rsa.PrivateKey)
+	if !ok || !key.PublicKey.Equal(crt.PublicKey) {
+		return ua.BadCertificateInvalid
+	}
+	srv.Lock()
+	defer srv.Unlock()
+	srv.previousCertificate, srv.previousPrivateKey = srv.localCertificate, srv.localPrivateKey
+	srv.localCertificate, srv.localPrivateKey = cert.Certificate[0], key
+	srv.endpoints = nil // rebuilt with the new certificate
+	return srv.completeLocalDescription()
+}
+
+// localKeyPair gets the certificate and private key for the local application.
+func (srv *Server) localKeyPair() ([]byte, *rsa.PrivateKey) {
+	srv.RLock()
+	defer srv.RUnlock()
+	return srv.localCertificate, srv.localPrivateKey
+}
+
+// keyPairByThumbprint gets the current or previous certificate and private key with the given thumbprint.
+func (srv *Server) keyPairByThumbprint(thumbprint []byte) ([]byte, *rsa.PrivateKey, bool) {
+	srv.RLock()
+	defer srv.RUnlock()
+	if sum := sha1.Sum(srv.localCertificate); bytes.Equal(thumbprint, sum[:]) {
+		return srv.localCertificate, srv.localPrivateKey, true
+	}
+	if srv.previousCertificate != nil {
+		if sum := sha1.Sum(srv.previousCertificate); bytes.Equal(thumbprint, sum[:]) {
+			return srv.previousCertificate, srv.previousPrivateKey, true
+		}
+	}
+	return nil, nil, false
+}
+
 // EndpointURL gets the endpoint url.
 func (srv *Server) EndpointURL() string {
 	srv.RLock()
@@ -185,7 +319,13 @@ func (srv *Server) EndpointURL() string {
 // Endpoints gets the endpoint descriptions.
 func (srv *Server) Endpoints() []ua.EndpointDescription {
 	srv.RLock()
-	defer srv.RUnlock()
+	eds := srv.endpoints
+	srv.RUnlock()
+	if eds != nil {
+		return eds
+	}
+	srv.Lock()
+	defer srv.Unlock()
 	if srv.endpoints == nil {
 		srv.endpoints = srv.buildEndpointDescriptions()
 	}
@@ -212,6 +352,25 @@ func (srv *Server) setState(value ua.ServerState) {
 	srv.state = value
 }
 
+// ServiceLevel gets the ServiceLevel of the server, where 0 is out of service and 255 is healthy.
+func (srv *Server) ServiceLevel() byte {
+	if n, ok := srv.NamespaceManager().FindVariable(ua.VariableIDServerServiceLevel); ok {
+		if v, ok := n.Value().Value.(byte); ok {
+			return v
+		}
+	}
+	return 0
+}
+
+// SetServiceLevel sets the ServiceLevel of the server, where 0 is out of service and 255 is healthy.
+// Redundancy-aware clients use the ServiceLevel to choose the healthiest of the redundant servers,
+// e.g. lower the ServiceLevel when a device is not connected. (default: 255)
+func (srv *Server) SetServiceLevel(value byte) {
+	if n, ok := srv.NamespaceManager().FindVariable(ua.VariableIDServerServiceLevel); ok {
+		n.SetValue(ua.NewDataValue(value, 0, time.Now(), 0, time.Now(), 0))
+	}
+}
+
 // NamespaceUris gets the namespace uris.
 func (srv *Server) NamespaceUris() []string {
 	srv.RLock()
@@ -233,6 +392,29 @@ func (srv *Server) RolePermissions() []ua.RolePermissionType {
 	return srv.rolePermissions
 }
 
+// SetAccessPolicy sets the AccessPolicyFunc that computes the permissions of nodes having
+// no RolePermissions of their own. Set nil to use the permissions set by WithRolePermissions.
+func (srv *Server) SetAccessPolicy(policy AccessPolicyFunc) {
+	srv.Lock()
+	defer srv.Unlock()
+	srv.accessPolicy = policy
+}
+
+// effectiveRolePermissions returns the RolePermissions of the node, if set. Otherwise the
+// permissions are computed by the access policy, or are the server's default RolePermissions.
+func (srv *Server) effectiveRolePermissions(ctx context.Context, node Node, roles []ua.NodeID) []ua.RolePermissionType {
+	if rolePermissions := node.RolePermissions(); rolePermissions != nil {
+		return rolePermissions
+	}
+	srv.RLock()
+	policy, rolePermissions := srv.accessPolicy, srv.rolePermissions
+	srv.RUnlock()
+	if policy != nil {
+		return policy(ctx, node, roles)
+	}
+	return rolePermissions
+}
+
 // WorkerPool gets a pool of workers.
 func (srv *Server) WorkerPool() *workerpool.WorkerPool {
 	srv.RLock()
@@ -282,6 +464,51 @@ func (srv *Server) Historian() HistoryReadWriter {
 	return srv.historian
 }
 
+// Logger gets the logger of structured logs.
+func (srv *Server) Logger() *slog.Logger {
+	return srv.logger
+}
+
+// ResolvedReference is a reference of a node, with the attributes of the target node.
+// If the target is not in the address space, the attributes are empty.
+type ResolvedReference struct {
+	ReferenceTypeID ua.NodeID
+	IsInverse       bool
+	TargetID        ua.ExpandedNodeID
+	BrowseName      ua.QualifiedName
+	DisplayName     ua.LocalizedText
+	NodeClass       ua.NodeClass
+}
+
+// GetReferences gets the references of the node, with the BrowseName, DisplayName and NodeClass
+// of each target node. Returns BadNodeIDUnknown if the node is not in the address space.
+func (srv *Server) GetReferences(nodeID ua.NodeID) ([]ResolvedReference, error) {
+	m := srv.NamespaceManager()
+	n, ok := m.FindNode(nodeID)
+	if !ok {
+		return nil, ua.BadNodeIDUnknown
+	}
+	uris := m.NamespaceUris()
+	refs := n.References()
+	results := make([]ResolvedReference, len(refs))
+	for i, r := range refs {
+		results[i] = ResolvedReference{
+			ReferenceTypeID: r.ReferenceTypeID,
+			IsInverse:       r.IsInverse,
+			TargetID:        r.TargetID,
+		}
+		if r.TargetID.ServerIndex != 0 {
+			continue
+		}
+		if target, ok := m.FindNode(ua.ToNodeID(r.TargetID, uris)); ok {
+			results[i].BrowseName = target.BrowseName()
+			results[i].DisplayName = target.DisplayName()
+			results[i].NodeClass = target.NodeClass()
+		}
+	}
+	return results, nil
+}
+
 // MaxSessionCount gets the maximum number of sessions.
 func (srv *Server) MaxSessionCount() uint32 {
 	srv.RLock()
@@ -334,16 +561,21 @@ func (srv *Server) ListenAndServe() error {
 
 // Close server.
 func (srv *Server) Close() error {
+	return srv.shutdown(ua.NewLocalizedText("Closing", ""), 3)
+}
+
+// shutdown sets the ServerState to Shutdown, counts down the seconds till shutdown, then closes the server.
+func (srv *Server) shutdown(reason ua.LocalizedText, secondsTillShutdown uint32) error {
 	srv.stateSemaphore <- struct{}{}
-	if srv.state != ua.ServerStateRunning {
+	if srv.state != ua.ServerStateRunning && srv.state != ua.ServerStateSuspended {
 		<-srv.stateSemaphore
 		return ua.BadInternalError
 	}
 
 	// allow for clients to stop gracefully
 	srv.setState(ua.ServerStateShutdown)
-	srv.shutdownReason = ua.NewLocalizedText("Closing", "")
-	for i := 3; i > 0; i-- {
+	srv.shutdownReason = reason
+	for i := secondsTillShutdown; i > 0; i-- {
 		srv.secondsTillShutdown = uint32(i)
 		time.Sleep(time.Second)
 	}
@@ -373,7 +605,7 @@ func (srv *Server) Close() error {
 // Abort the server.
 func (srv *Server) Abort() error {
 	srv.stateSemaphore <- struct{}{}
-	if srv.state != ua.ServerStateRunning {
+	if srv.state != ua.ServerStateRunning && srv.state != ua.ServerStateSuspended {
 		<-srv.stateSemaphore
 		return ua.BadInternalError
 	}
@@ -426,22 +658,26 @@ func (srv *Server) serve(l net.Listener) error {
 			}
 		}
 		delay = 0
-		ch := newServerSecureChannel(srv, conn, srv.receiveBufferSize, srv.sendBufferSize, srv.maxMessageSize, srv.maxChunkCount, srv.trace)
-		go func(ch *serverSecureChannel) {
-			err := ch.Open()
-			if err != nil {
-				if reason, ok := err.(ua.StatusCode); ok {
-					ch.Abort(reason, reason.Error())
-					return
-				}
-				ch.Abort(ua.BadSecureChannelClosed, err.Error())
-				return
-			}
-			srv.channelManager.Add(ch)
-		}(ch)
+		go srv.openSecureChannel(conn)
 	}
 }
 
+// openSecureChannel opens a secure channel over the connection, and adds it to the channel manager.
+func (srv *Server) openSecureChannel(conn net.Conn) {
+	ch := newServerSecureChannel(srv, conn, srv.receiveBufferSize, srv.sendBufferSize, srv.maxMessageSize, srv.maxChunkCount, srv.trace)
+	err := ch.Open()
+	if err != nil {
+		if reason, ok := err.(ua.StatusCode); ok {
+			ch.Abort(reason, reason.Error())
+			return
+		}
+		ch.Abort(ua.BadSecureChannelClosed, err.Error())
+		return
+	}
+	srv.channelManager.Add(ch)
+	srv.raiseChannelEvent(LifecycleEventChannelOpened, ch)
+}
+
 func (srv *Server) handleCloseSecureChannel(ch *serverSecureChannel, requestid uint32, req *ua.CloseSecureChannelRequest) error {
 	srv.ChannelManager().Delete(ch)
 	ch.Close()
@@ -454,10 +690,7 @@ func (srv *Server) initializeNamespace() error {
 		return err
 	}
 	if n, ok := nm.FindVariable(ua.VariableIDServerAuditing); ok {
-		n.SetValue(ua.NewDataValue(false, 0, time.Now(), 0, time.Now(), 0))
-	}
-	if n, ok := nm.FindNode(ua.MethodIDServerRequestServerStateChange); ok {
-		nm.DeleteNode(n, true)
+		n.SetValue(ua.NewDataValue(srv.auditing, 0, time.Now(), 0, time.Now(), 0))
 	}
 	if n, ok := nm.FindNode(ua.MethodIDServerSetSubscriptionDurable); ok {
 		nm.DeleteNode(n, true)
@@ -749,52 +982,19 @@ func (srv *Server) initializeNamespace() error {
 			return ua.NewDataValue(srv.serverDiagnosticsSummary.SessionTimeoutCount, 0, time.Now(), 0, time.Now(), 0)
 		})
 	}
+	if n, ok := nm.FindVariable(ua.VariableIDServerServerDiagnosticsSessionsDiagnosticsSummarySessionDiagnosticsArray); ok {
+		n.rolePermissions = diagnosticsRolePermissions
+		n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
+			return srv.sessionDiagnosticsArray(ctx)
+		})
+		n.readPerSession = true
+	}
 	if n, ok := nm.FindVariable(ua.VariableIDServerServerDiagnosticsSubscriptionDiagnosticsArray); ok {
+		n.rolePermissions = diagnosticsRolePermissions
 		n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-			if !srv.serverDiagnostics {
-				return ua.NewDataValue(nil, 0, time.Now(), 0, time.Now(), 0)
-			}
-			a := make([]ua.ExtensionObject, 0, 16)
-			for _, s := range srv.SubscriptionManager().subscriptionsByID {
-				s.RLock()
-				e := ua.SubscriptionDiagnosticsDataType{
-					SessionID:                  s.sessionId,
-					SubscriptionID:             s.id,
-					Priority:                   s.priority,
-					PublishingInterval:         s.publishingInterval,
-					MaxKeepAliveCount:          s.maxKeepAliveCount,
-					MaxLifetimeCount:           s.lifetimeCount,
-					MaxNotificationsPerPublish: s.maxNotificationsPerPublish,
-					PublishingEnabled:          s.publishingEnabled,
-					ModifyCount:                s.modifyCount,
-					// EnableCount:                  uint32(0),
-					// DisableCount:                 uint32(0),
-					RepublishRequestCount:        s.republishRequestCount,
-					RepublishMessageRequestCount: s.republishMessageRequestCount,
-					RepublishMessageCount:        s.republishMessageCount,
-					// TransferRequestCount:         uint32(0),
-					// TransferredToAltClientCount:  uint32(0),
-					// TransferredToSameClientCount: uint32(0),
-					PublishRequestCount:          s.publishRequestCount,
-					DataChangeNotificationsCount: s.dataChangeNotificationsCount,
-					EventNotificationsCount:      s.eventNotificationsCount,
-					NotificationsCount:           s.notificationsCount,
-					LatePublishRequestCount:      s.latePublishRequestCount,
-					CurrentKeepAliveCount:        s.keepAliveCounter,
-					CurrentLifetimeCount:         s.lifetimeCounter,
-					UnacknowledgedMessageCount:   s.unacknowledgedMessageCount,
-					// DiscardedMessageCount:        uint32(0),
-					MonitoredItemCount:           s.monitoredItemCount,
-					DisabledMonitoredItemCount:   s.disabledMonitoredItemCount,
-					MonitoringQueueOverflowCount: s.monitoringQueueOverflowCount,
-					NextSequenceNumber:           s.seqNum,
-					// EventQueueOverFlowCount:      uint32(0),
-				}
-				s.RUnlock()
-				a = append(a, e)
-			}
-			return ua.NewDataValue(a, 0, time.Now(), 0, time.Now(), 0)
+			return srv.subscriptionDiagnosticsArray(ctx, nil)
 		})
+		n.readPerSession = true
 	}
 	if n, ok := nm.FindNode(ua.VariableIDServerServerDiagnosticsSamplingIntervalDiagnosticsArray); ok {
 		nm.DeleteNode(n, true)
@@ -872,6 +1072,77 @@ func (srv *Server) initializeNamespace() error {
 		})
 	}
 
+	if n, ok := nm.FindMethod(ua.MethodIDServerRequestServerStateChange); ok {
+		// only the ConfigureAdmin role may change the state of the server.
+		n.rolePermissions = []ua.RolePermissionType{
+			{RoleID: ua.ObjectIDWellKnownRoleAnonymous, Permissions: ua.PermissionTypeBrowse},
+			{RoleID: ua.ObjectIDWellKnownRoleAuthenticatedUser, Permissions: ua.PermissionTypeBrowse},
+			{RoleID: ua.ObjectIDWellKnownRoleConfigureAdmin, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead | ua.PermissionTypeCall},
+		}
+		n.SetCallMethodHandler(func(ctx context.Context, req ua.CallMethodRequest) ua.CallMethodResult {
+			if len(req.InputArguments) < 5 {
+				return ua.CallMethodResult{StatusCode: ua.BadArgumentsMissing}
+			}
+			if len(req.InputArguments) > 5 {
+				return ua.CallMethodResult{StatusCode: ua.BadTooManyArguments}
+			}
+			opResult := ua.Good
+			argsResults := make([]ua.StatusCode, 5)
+			state, ok := req.InputArguments[0].(int32)
+			if !ok {
+				opResult = ua.BadInvalidArgument
+				argsResults[0] = ua.BadTypeMismatch
+			}
+			estimatedReturnTime, ok := req.InputArguments[1].(time.Time)
+			if !ok {
+				opResult = ua.BadInvalidArgument
+				argsResults[1] = ua.BadTypeMismatch
+			}
+			secondsTillShutdown, ok := req.InputArguments[2].(uint32)
+			if !ok {
+				opResult = ua.BadInvalidArgument
+				argsResults[2] = ua.BadTypeMismatch
+			}
+			reason, ok := req.InputArguments[3].(ua.LocalizedText)
+			if !ok {
+				opResult = ua.BadInvalidArgument
+				argsResults[3] = ua.BadTypeMismatch
+			}
+			restart, ok := req.InputArguments[4].(bool)
+			if !ok {
+				opResult = ua.BadInvalidArgument
+				argsResults[4] = ua.BadTypeMismatch
+			}
+			if opResult == ua.BadInvalidArgument {
+				return ua.CallMethodResult{StatusCode: opResult, InputArgumentResults: argsResults}
+			}
+			// the server cannot restart itself.
+			if restart {
+				return ua.CallMethodResult{StatusCode: ua.BadNotSupported}
+			}
+			if n, ok := nm.FindVariable(ua.VariableIDServerEstimatedReturnTime); ok {
+				n.SetValue(ua.NewDataValue(estimatedReturnTime, 0, time.Now(), 0, time.Now(), 0))
+			}
+			switch ua.ServerState(state) {
+			case ua.ServerStateShutdown:
+				// shutdown after the response is sent.
+				go srv.shutdown(reason, secondsTillShutdown)
+			case ua.ServerStateRunning, ua.ServerStateSuspended:
+				srv.stateSemaphore <- struct{}{}
+				if current := srv.State(); current != ua.ServerStateRunning && current != ua.ServerStateSuspended {
+					<-srv.stateSemaphore
+					return ua.CallMethodResult{StatusCode: ua.BadInvalidState}
+				}
+				srv.setState(ua.ServerState(state))
+				<-srv.stateSemaphore
+			default:
+				argsResults[0] = ua.BadOutOfRange
+				return ua.CallMethodResult{StatusCode: ua.BadInvalidArgument, InputArgumentResults: argsResults}
+			}
+			return ua.CallMethodResult{OutputArguments: []ua.Variant{}}
+		})
+	}
+
 	if n, ok := nm.FindMethod(ua.MethodIDServerResendData); ok {
 		n.SetCallMethodHandler(func(ctx context.Context, req ua.CallMethodRequest) ua.CallMethodResult {
 			if len(req.InputArguments) < 1 {
@@ -902,6 +1173,111 @@ func (srv *Server) initializeNamespace() error {
 			return ua.CallMethodResult{OutputArguments: []ua.Variant{}}
 		})
 	}
+
+	// ConditionRefresh only affects the subscriptions of the caller, so every role that may
+	// receive events may call it.
+	conditionRefreshPermissions := []ua.RolePermissionType{}
+	for _, rp := range srv.rolePermissions {
+		if rp.Permissions&ua.PermissionTypeReceiveEvents != 0 {
+			conditionRefreshPermissions = append(conditionRefreshPermissions, ua.RolePermissionType{RoleID: rp.RoleID, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead | ua.PermissionTypeCall})
+		}
+	}
+
+	if n, ok := nm.FindMethod(ua.MethodIDConditionTypeConditionRefresh); ok {
+		n.rolePermissions = conditionRefreshPermissions
+		n.SetCallMethodHandler(func(ctx context.Context, req ua.CallMethodRequest) ua.CallMethodResult {
+			if len(req.InputArguments) < 1 {
+				return ua.CallMethodResult{StatusCode: ua.BadArgumentsMissing}
+			}
+			if len(req.InputArguments) > 1 {
+				return ua.CallMethodResult{StatusCode: ua.BadTooManyArguments}
+			}
+			subscriptionID, ok := req.InputArguments[0].(uint32)
+			if !ok {
+				return ua.CallMethodResult{StatusCode: ua.BadInvalidArgument, InputArgumentResults: []ua.StatusCode{ua.BadTypeMismatch}}
+			}
+			sub, ok := srv.SubscriptionManager().Get(subscriptionID)
+			if !ok {
+				return ua.CallMethodResult{StatusCode: ua.BadSubscriptionIDInvalid}
+			}
+			session, ok := ctx.Value(SessionKey).(*Session)
+			if !ok || sub.session != session {
+				return ua.CallMethodResult{StatusCode: ua.BadUserAccessDenied}
+			}
+			for _, item := range sub.Items() {
+				if mi, ok := item.(*EventMonitoredItem); ok {
+					mi.conditionRefresh(nm.RetainedConditions(mi.Node().NodeID()))
+				}
+			}
+			return ua.CallMethodResult{OutputArguments: []ua.Variant{}}
+		})
+	}
+
+	if n, ok := nm.FindMethod(ua.MethodIDConditionTypeConditionRefresh2); ok {
+		n.rolePermissions = conditionRefreshPermissions
+		n.SetCallMethodHandler(func(ctx context.Context, req ua.CallMethodRequest) ua.CallMethodResult {
+			if len(req.InputArguments) < 2 {
+				return ua.CallMethodResult{StatusCode: ua.BadArgumentsMissing}
+			}
+			if len(req.InputArguments) > 2 {
+				return ua.CallMethodResult{StatusCode: ua.BadTooManyArguments}
+			}
+			opResult := ua.Good
+			argsResults := make([]ua.StatusCode, 2)
+			subscriptionID, ok := req.InputArguments[0].(uint32)
+			if !ok {
+				opResult = ua.BadInvalidArgument
+				argsResults[0] = ua.BadTypeMismatch
+			}
+			monitoredItemID, ok := req.InputArguments[1].(uint32)
+			if !ok {
+				opResult = ua.BadInvalidArgument
+				argsResults[1] = ua.BadTypeMismatch
+			}
+			if opResult == ua.BadInvalidArgument {
+				return ua.CallMethodResult{StatusCode: opResult, InputArgumentResults: argsResults}
+			}
+			sub, ok := srv.SubscriptionManager().Get(subscriptionID)
+			if !ok {
+				return ua.CallMethodResult{StatusCode: ua.BadSubscriptionIDInvalid}
+			}
+			session, ok := ctx.Value(SessionKey).(*Session)
+			if !ok || sub.session != session {
+				return ua.CallMethodResult{StatusCode: ua.BadUserAccessDenied}
+			}
+			for _, item := range sub.Items() {
+				if item.ID() == monitoredItemID {
+					if mi, ok := item.(*EventMonitoredItem); ok {
+						mi.conditionRefresh(nm.RetainedConditions(mi.Node().NodeID()))
+						return ua.CallMethodResult{OutputArguments: []ua.Variant{}}
+					}
+				}
+			}
+			return ua.CallMethodResult{StatusCode: ua.BadMonitoredItemIDInvalid}
+		})
+	}
+
+	// the methods of the condition types call the alarm given by the ObjectID.
+	alarmMethods := map[ua.NodeID]func(*AlarmCondition, context.Context, ua.CallMethodRequest) ua.CallMethodResult{
+		ua.MethodIDConditionTypeEnable:                     (*AlarmCondition).handleEnable,
+		ua.MethodIDConditionTypeDisable:                    (*AlarmCondition).handleDisable,
+		ua.MethodIDAcknowledgeableConditionTypeAcknowledge: (*AlarmCondition).handleAcknowledge,
+		ua.MethodIDAcknowledgeableConditionTypeConfirm:     (*AlarmCondition).handleConfirm,
+	}
+	for id, f := range alarmMethods {
+		if n, ok := nm.FindMethod(id); ok {
+			f := f
+			n.SetCallMethodHandler(func(ctx context.Context, req ua.CallMethodRequest) ua.CallMethodResult {
+				a, ok := nm.FindAlarmCondition(req.ObjectID)
+				if !ok {
+					return ua.CallMethodResult{StatusCode: ua.BadMethodInvalid}
+				}
+				return f(a, ctx, req)
+			})
+		}
+	}
+
+	srv.initializeServerConfiguration()
 	return nil
 }
 
@@ -921,14 +1297,15 @@ func (srv *Server) buildEndpointDescriptions() []ua.EndpointDescription {
 			TokenType:         ua.UserTokenTypeUserName,
 			SecurityPolicyURI: ua.SecurityPolicyURIBasic256Sha256,
 		})
+		toks = append(toks, srv.identityTokenPolicies(ua.SecurityPolicyURIBasic256Sha256)...)
 		eds = append(eds, ua.EndpointDescription{
 			EndpointURL:         srv.endpointURL,
 			Server:              srv.localDescription,
-			ServerCertificate:   ua.ByteString(srv.LocalCertificate()),
+			ServerCertificate:   ua.ByteString(srv.localCertificate),
 			SecurityMode:        ua.MessageSecurityModeNone,
 			SecurityPolicyURI:   ua.SecurityPolicyURINone,
 			TransportProfileURI: ua.TransportProfileURIUaTcpTransport,
-			SecurityLevel:       byte(len(eds)),
+			SecurityLevel:       srv.securityLevel(ua.SecurityPolicyURINone),
 			UserIdentityTokens:  toks,
 		})
 	}
@@ -952,17 +1329,58 @@ func (srv *Server) buildEndpointDescriptions() []ua.EndpointDescription {
 			TokenType:         ua.UserTokenTypeUserName,
 			SecurityPolicyURI: uri,
 		})
+		toks = append(toks, srv.identityTokenPolicies(uri)...)
 
 		eds = append(eds, ua.EndpointDescription{
 			EndpointURL:         srv.endpointURL,
 			Server:              srv.localDescription,
-			ServerCertificate:   ua.ByteString(srv.LocalCertificate()),
+			ServerCertificate:   ua.ByteString(srv.localCertificate),
 			SecurityMode:        ua.MessageSecurityModeSignAndEncrypt,
 			SecurityPolicyURI:   uri,
 			TransportProfileURI: ua.TransportProfileURIUaTcpTransport,
-			SecurityLevel:       byte(len(eds)),
+			SecurityLevel:       srv.securityLevel(uri),
 			UserIdentityTokens:  toks,
 		})
 	}
 	return eds
 }
+
+// identityTokenPolicies returns the policies of the X509IdentityTokens and IssuedIdentityTokens that
+// the server is configured to authenticate, with the given security policy.
+func (srv *Server) identityTokenPolicies(securityPolicyURI string) []ua.UserTokenPolicy {
+	toks := []ua.UserTokenPolicy{}
+	if srv.x509IdentityAuthenticator != nil || srv.userCertificateValidator != nil {
+		toks = append(toks, ua.UserTokenPolicy{
+			PolicyID:          ua.UserTokenTypeCertificate.String(),
+			TokenType:         ua.UserTokenTypeCertificate,
+			SecurityPolicyURI: securityPolicyURI,
+		})
+	}
+	if srv.issuedIdentityAuthenticator != nil {
+		toks = append(toks, ua.UserTokenPolicy{
+			PolicyID:          ua.UserTokenTypeIssuedToken.String(),
+			TokenType:         ua.UserTokenTypeIssuedToken,
+			IssuedTokenType:   IssuedTokenTypeJWT,
+			SecurityPolicyURI: securityPolicyURI,
+		})
+	}
+	return toks
+}
+
+// securityLevel returns the SecurityLevel reported for the endpoint with the given security policy.
+// Levels set with WithSecurityLevel take precedence, otherwise stronger policies rank higher than None.
+func (srv *Server) securityLevel(securityPolicyURI string) byte {
+	if level, ok := srv.securityLevels[securityPolicyURI]; ok {
+		return level
+	}
+	switch securityPolicyURI {
+	case ua.SecurityPolicyURIBasic256Sha256:
+		return 1
+	case ua.SecurityPolicyURIAes128Sha256RsaOaep:
+		return 2
+	case ua.SecurityPolicyURIAes256Sha256RsaPss:
+		return 3
+	default:
+		return 0
+	}
+}
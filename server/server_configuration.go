@@ -0,0 +1,517 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/awcullen/opcua/ua"
+)
+
+const (
+	// maxRejectedCertificates is the number of rejected certificates the server keeps.
+	maxRejectedCertificates = 100
+	// minSigningRequestNonceLength is the minimum length of the Nonce of CreateSigningRequest,
+	// if the private key is regenerated.
+	minSigningRequestNonceLength = 32
+)
+
+var (
+	// serverConfigurationRolePermissions are the RolePermissions of the methods of the ServerConfiguration.
+	// Only the SecurityAdmin may call them.
+	serverConfigurationRolePermissions = []ua.RolePermissionType{
+		{RoleID: ua.ObjectIDWellKnownRoleAnonymous, Permissions: ua.PermissionTypeBrowse},
+		{RoleID: ua.ObjectIDWellKnownRoleAuthenticatedUser, Permissions: ua.PermissionTypeBrowse},
+		{RoleID: ua.ObjectIDWellKnownRoleSecurityAdmin, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead | ua.PermissionTypeCall},
+	}
+	// oidDomainComponent is the object identifier of the DC attribute of a distinguished name.
+	oidDomainComponent = asn1.ObjectIdentifier{0, 9, 2342, 19200300, 100, 1, 25}
+)
+
+// initializeServerConfiguration sets the handlers of the methods of the ServerConfiguration, which
+// a Global Discovery Server calls to push a new application instance certificate to the server.
+func (srv *Server) initializeServerConfiguration() {
+	nm := srv.namespaceManager
+	if n, ok := nm.FindVariable(ua.VariableIDServerConfigurationSupportedPrivateKeyFormats); ok {
+		n.SetValue(ua.NewDataValue([]string{"PEM"}, 0, time.Now(), 0, time.Now(), 0))
+	}
+	if n, ok := nm.FindVariable(ua.VariableIDServerConfigurationCertificateGroupsDefaultApplicationGroupCertificateTypes); ok {
+		n.SetValue(ua.NewDataValue([]ua.NodeID{ua.ObjectTypeIDRsaSha256ApplicationCertificateType}, 0, time.Now(), 0, time.Now(), 0))
+	}
+	methods := map[ua.NodeID]func(context.Context, ua.CallMethodRequest) ua.CallMethodResult{
+		ua.MethodIDServerConfigurationCreateSigningRequest: srv.handleCreateSigningRequest,
+		ua.MethodIDServerConfigurationUpdateCertificate:    srv.handleUpdateCertificate,
+		ua.MethodIDServerConfigurationGetRejectedList:      srv.handleGetRejectedList,
+		ua.MethodIDServerConfigurationApplyChanges:         srv.handleApplyChanges,
+	}
+	for id, f := range methods {
+		if n, ok := nm.FindMethod(id); ok {
+			f := f
+			n.rolePermissions = serverConfigurationRolePermissions
+			n.SetCallMethodHandler(func(ctx context.Context, req ua.CallMethodRequest) ua.CallMethodResult {
+				if status := srv.checkSecurityAdminChannel(ctx); status != ua.Good {
+					return ua.CallMethodResult{StatusCode: status}
+				}
+				return f(ctx, req)
+			})
+		}
+	}
+}
+
+// checkSecurityAdminChannel returns Good if the session of the request communicates over an encrypted
+// secure channel, as the methods of the ServerConfiguration transfer private keys.
+func (srv *Server) checkSecurityAdminChannel(ctx context.Context) ua.StatusCode {
+	session, ok := ctx.Value(SessionKey).(*Session)
+	if !ok {
+		return ua.BadUserAccessDenied
+	}
+	ch, ok := srv.ChannelManager().Get(session.SecureChannelId())
+	if !ok || ch.SecurityMode() != ua.MessageSecurityModeSignAndEncrypt {
+		return ua.BadSecurityModeInsufficient
+	}
+	return ua.Good
+}
+
+// handleCreateSigningRequest returns a PKCS #10 certificate signing request for the application
+// instance certificate. The request has the subject of the current certificate, unless the SubjectName
+// is given, and the subjectAltNames of the current certificate. If RegeneratePrivateKey is true, the
+// request is signed with a new private key, which UpdateCertificate uses if no PrivateKey is given.
+func (srv *Server) handleCreateSigningRequest(ctx context.Context, req ua.CallMethodRequest) ua.CallMethodResult {
+	if status := checkCertificateGroup(req.InputArguments[0], req.InputArguments[1]); status != ua.Good {
+		return ua.CallMethodResult{StatusCode: status}
+	}
+	subjectName, _ := req.InputArguments[2].(string)
+	regenerate, _ := req.InputArguments[3].(bool)
+	nonce, _ := req.InputArguments[4].(ua.ByteString)
+	cert, key := srv.localKeyPair()
+	crt, err := x509.ParseCertificate(cert)
+	if err != nil {
+		return ua.CallMethodResult{StatusCode: ua.BadInternalError}
+	}
+	subject := crt.Subject
+	if subjectName != "" {
+		if subject, err = parseSubjectName(subjectName); err != nil {
+			return ua.CallMethodResult{StatusCode: ua.BadInvalidArgument, InputArgumentResults: []ua.StatusCode{ua.Good, ua.Good, ua.BadInvalidArgument, ua.Good, ua.Good}}
+		}
+	}
+	if regenerate {
+		// the nonce was meant to add entropy, crypto/rand needs none.
+		if len(nonce) < minSigningRequestNonceLength {
+			return ua.CallMethodResult{StatusCode: ua.BadInvalidArgument, InputArgumentResults: []ua.StatusCode{ua.Good, ua.Good, ua.Good, ua.Good, ua.BadInvalidArgument}}
+		}
+		if key, err = rsa.GenerateKey(rand.Reader, key.N.BitLen()); err != nil {
+			return ua.CallMethodResult{StatusCode: ua.BadInternalError}
+		}
+	}
+	// the new certificate must contain the ApplicationURI, see UpdateCertificate.
+	uris := crt.URIs
+	if u, err := url.Parse(srv.LocalDescription().ApplicationURI); err == nil && u.String() != "" {
+		uris = []*url.URL{u}
+	}
+	template := &x509.CertificateRequest{
+		Subject:            subject,
+		DNSNames:           crt.DNSNames,
+		IPAddresses:        crt.IPAddresses,
+		URIs:               uris,
+		SignatureAlgorithm: x509.SHA256WithRSA,
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return ua.CallMethodResult{StatusCode: ua.BadInternalError}
+	}
+	if regenerate {
+		srv.certificateLock.Lock()
+		srv.regeneratedPrivateKey = key
+		srv.certificateLock.Unlock()
+	}
+	return ua.CallMethodResult{OutputArguments: []ua.Variant{ua.ByteString(csr)}}
+}
+
+// handleUpdateCertificate validates the new application instance certificate and its issuers, and
+// stages it until ApplyChanges is called. The certificate must contain the ApplicationURI of the
+// server, and chain to the issuers, or to the trust list if none are given. The private key is the PEM encoded PrivateKey if given,
+// otherwise the key created by CreateSigningRequest, or the current key of the server.
+func (srv *Server) handleUpdateCertificate(ctx context.Context, req ua.CallMethodRequest) ua.CallMethodResult {
+	if status := checkCertificateGroup(req.InputArguments[0], req.InputArguments[1]); status != ua.Good {
+		return ua.CallMethodResult{StatusCode: status}
+	}
+	certificate, _ := req.InputArguments[2].(ua.ByteString)
+	issuers, _ := req.InputArguments[3].([]ua.ByteString)
+	format, _ := req.InputArguments[4].(string)
+	privateKey, _ := req.InputArguments[5].(ua.ByteString)
+	crt, err := x509.ParseCertificate([]byte(certificate))
+	if err != nil {
+		return ua.CallMethodResult{StatusCode: ua.BadCertificateInvalid}
+	}
+	now := time.Now()
+	if now.Before(crt.NotBefore) || now.After(crt.NotAfter) {
+		return ua.CallMethodResult{StatusCode: ua.BadCertificateTimeInvalid}
+	}
+	if !hasURI(crt, srv.LocalDescription().ApplicationURI) {
+		return ua.CallMethodResult{StatusCode: ua.BadCertificateURIInvalid}
+	}
+	if status := srv.verifyIssuers(crt, issuers); status != ua.Good {
+		return ua.CallMethodResult{StatusCode: status}
+	}
+
+	var key *rsa.PrivateKey
+	switch format {
+	case "":
+		if len(privateKey) > 0 {
+			return ua.CallMethodResult{StatusCode: ua.BadInvalidArgument}
+		}
+		_, current := srv.localKeyPair()
+		srv.certificateLock.Lock()
+		for _, k := range []*rsa.PrivateKey{srv.regeneratedPrivateKey, current} {
+			if k != nil && k.PublicKey.Equal(crt.PublicKey) {
+				key = k
+				break
+			}
+		}
+		srv.certificateLock.Unlock()
+	case "PEM":
+		if key, err = parsePrivateKeyPEM([]byte(privateKey)); err != nil {
+			return ua.CallMethodResult{StatusCode: ua.BadInvalidArgument}
+		}
+	default:
+		return ua.CallMethodResult{StatusCode: ua.BadNotSupported}
+	}
+	if key == nil || !key.PublicKey.Equal(crt.PublicKey) {
+		return ua.CallMethodResult{StatusCode: ua.BadSecurityChecksFailed}
+	}
+
+	chain := [][]byte{[]byte(certificate)}
+	for _, issuer := range issuers {
+		chain = append(chain, []byte(issuer))
+	}
+	srv.certificateLock.Lock()
+	srv.pendingCertificate = &tls.Certificate{Certificate: chain, PrivateKey: key}
+	srv.certificateLock.Unlock()
+	return ua.CallMethodResult{OutputArguments: []ua.Variant{true}}
+}
+
+// handleApplyChanges activates the certificate staged by UpdateCertificate, and writes it to the
+// certificate and key files of the server. Existing secure channels keep the previous certificate.
+func (srv *Server) handleApplyChanges(ctx context.Context, req ua.CallMethodRequest) ua.CallMethodResult {
+	srv.certificateLock.Lock()
+	pending := srv.pendingCertificate
+	srv.pendingCertificate = nil
+	srv.regeneratedPrivateKey = nil
+	srv.certificateLock.Unlock()
+	if pending == nil {
+		return ua.CallMethodResult{OutputArguments: []ua.Variant{}}
+	}
+	if err := srv.saveKeyPair(*pending); err != nil {
+		srv.logger.Error("Error saving x509 key pair", ua.StatusCodeAttr(err))
+		return ua.CallMethodResult{StatusCode: ua.BadInternalError}
+	}
+	if err := srv.ReplaceCertificate(*pending); err != nil {
+		return ua.CallMethodResult{StatusCode: ua.BadCertificateInvalid}
+	}
+	return ua.CallMethodResult{OutputArguments: []ua.Variant{}}
+}
+
+// handleGetRejectedList returns the client certificates that were rejected by the server.
+func (srv *Server) handleGetRejectedList(ctx context.Context, req ua.CallMethodRequest) ua.CallMethodResult {
+	return ua.CallMethodResult{OutputArguments: []ua.Variant{srv.RejectedCertificates()}}
+}
+
+// RejectedCertificates gets the client certificates that were rejected by the server, oldest first.
+func (srv *Server) RejectedCertificates() []ua.ByteString {
+	srv.certificateLock.Lock()
+	defer srv.certificateLock.Unlock()
+	list := make([]ua.ByteString, len(srv.rejectedCertificates))
+	copy(list, srv.rejectedCertificates)
+	return list
+}
+
+// addRejectedCertificate adds the certificate to the rejected list, and writes it to the rejected
+// certificates path, if set. The oldest certificate is removed if the list is full.
+func (srv *Server) addRejectedCertificate(certificate []byte) {
+	srv.certificateLock.Lock()
+	defer srv.certificateLock.Unlock()
+	for _, c := range srv.rejectedCertificates {
+		if bytes.Equal([]byte(c), certificate) {
+			return
+		}
+	}
+	if len(srv.rejectedCertificates) == maxRejectedCertificates {
+		if srv.rejectedCertsPath != "" {
+			os.Remove(rejectedCertificateFile(srv.rejectedCertsPath, []byte(srv.rejectedCertificates[0])))
+		}
+		srv.rejectedCertificates = srv.rejectedCertificates[1:]
+	}
+	srv.rejectedCertificates = append(srv.rejectedCertificates, ua.ByteString(certificate))
+	if srv.rejectedCertsPath != "" {
+		if err := os.MkdirAll(srv.rejectedCertsPath, os.ModeDir|0755); err != nil {
+			srv.logger.Warn("Error saving rejected certificate", ua.StatusCodeAttr(err))
+			return
+		}
+		if err := os.WriteFile(rejectedCertificateFile(srv.rejectedCertsPath, certificate), certificate, 0644); err != nil {
+			srv.logger.Warn("Error saving rejected certificate", ua.StatusCodeAttr(err))
+		}
+	}
+}
+
+// loadRejectedCertificates reads the rejected certificates from the rejected certificates path.
+func (srv *Server) loadRejectedCertificates() error {
+	if srv.rejectedCertsPath == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(srv.rejectedCertsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".der" {
+			continue
+		}
+		buf, err := os.ReadFile(filepath.Join(srv.rejectedCertsPath, entry.Name()))
+		if err != nil {
+			continue
+		}
+		if _, err := x509.ParseCertificate(buf); err != nil {
+			continue
+		}
+		if len(srv.rejectedCertificates) < maxRejectedCertificates {
+			srv.rejectedCertificates = append(srv.rejectedCertificates, ua.ByteString(buf))
+		}
+	}
+	return nil
+}
+
+// rejectedCertificateFile returns the file name of the rejected certificate, named by its thumbprint.
+func rejectedCertificateFile(path string, certificate []byte) string {
+	return filepath.Join(path, fmt.Sprintf("%X.der", sha1.Sum(certificate)))
+}
+
+// saveKeyPair writes the certificate chain and private key to the certificate and key files of the server.
+// Both are written to temporary files first, then renamed, so a failed write leaves the files unchanged.
+func (srv *Server) saveKeyPair(cert tls.Certificate) error {
+	key, ok := cert.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return ua.BadCertificateInvalid
+	}
+	var certPEM bytes.Buffer
+	for _, c := range cert.Certificate {
+		if err := pem.Encode(&certPEM, &pem.Block{Type: "CERTIFICATE", Bytes: c}); err != nil {
+			return err
+		}
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	keyTemp, err := writeTempFile(srv.keyPath, keyPEM, 0600)
+	if err != nil {
+		return err
+	}
+	certTemp, err := writeTempFile(srv.certPath, certPEM.Bytes(), 0644)
+	if err != nil {
+		os.Remove(keyTemp)
+		return err
+	}
+	if err := os.Rename(keyTemp, srv.keyPath); err != nil {
+		os.Remove(keyTemp)
+		os.Remove(certTemp)
+		return err
+	}
+	if err := os.Rename(certTemp, srv.certPath); err != nil {
+		os.Remove(certTemp)
+		return err
+	}
+	return nil
+}
+
+// writeTempFile writes the data to a new temporary file in the directory of the path, and returns
+// the name of the temporary file.
+func writeTempFile(path string, data []byte, perm os.FileMode) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	name := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(name)
+		return "", err
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		os.Remove(name)
+		return "", err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(name)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(name)
+		return "", err
+	}
+	return name, nil
+}
+
+// checkCertificateGroup returns Good if the CertificateGroupId and CertificateTypeId are null or
+// name the DefaultApplicationGroup and its RSA certificate types, the only ones the server supports.
+func checkCertificateGroup(group, certificateType ua.Variant) ua.StatusCode {
+	if !isNullNodeID(group) && group != ua.ObjectIDServerConfigurationCertificateGroupsDefaultApplicationGroup {
+		return ua.BadInvalidArgument
+	}
+	switch certificateType {
+	case ua.ObjectTypeIDApplicationCertificateType, ua.ObjectTypeIDRsaMinApplicationCertificateType, ua.ObjectTypeIDRsaSha256ApplicationCertificateType:
+		return ua.Good
+	}
+	if !isNullNodeID(certificateType) {
+		return ua.BadInvalidArgument
+	}
+	return ua.Good
+}
+
+// isNullNodeID returns true if the argument is missing or the null NodeID.
+func isNullNodeID(v ua.Variant) bool {
+	switch v := v.(type) {
+	case nil, ua.Null:
+		return true
+	case ua.NodeIDNumeric:
+		return v == ua.NodeIDNumeric{}
+	}
+	return false
+}
+
+// hasURI returns true if the subjectAltName of the certificate contains the URI.
+func hasURI(crt *x509.Certificate, uri string) bool {
+	for _, u := range crt.URIs {
+		if u.String() == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyIssuers returns Good if the certificate chains to the issuer certificates. If there are no
+// issuers, the certificate must be self-signed, or chain to the trust list of the server.
+func (srv *Server) verifyIssuers(crt *x509.Certificate, issuers []ua.ByteString) ua.StatusCode {
+	if len(issuers) == 0 {
+		if bytes.Equal(crt.RawIssuer, crt.RawSubject) && crt.CheckSignatureFrom(crt) == nil {
+			return ua.Good
+		}
+		return srv.verifyTrustList(crt)
+	}
+	roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+	for _, issuer := range issuers {
+		c, err := x509.ParseCertificate([]byte(issuer))
+		if err != nil {
+			return ua.BadCertificateInvalid
+		}
+		if bytes.Equal(c.RawIssuer, c.RawSubject) {
+			roots.AddCert(c)
+		} else {
+			intermediates.AddCert(c)
+		}
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	if _, err := crt.Verify(opts); err != nil {
+		return ua.BadSecurityChecksFailed
+	}
+	return ua.Good
+}
+
+// verifyTrustList returns Good if the certificate chains to the trust list of the certificate
+// validator, or to the trusted certificates file if no validator is set.
+func (srv *Server) verifyTrustList(crt *x509.Certificate) ua.StatusCode {
+	if v := srv.certificateValidator; v != nil {
+		for _, c := range v.Validate(crt, x509.ExtKeyUsageServerAuth, "", "").Checks {
+			if c.Check == ua.CertificateCheckChain && c.StatusCode.IsBad() {
+				return ua.BadCertificateChainIncomplete
+			}
+		}
+		return ua.Good
+	}
+	roots, intermediates := readTrustedCertificates(srv.trustedCertsPath)
+	if roots == nil {
+		return ua.BadCertificateChainIncomplete
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	if _, err := crt.Verify(opts); err != nil {
+		return ua.BadCertificateChainIncomplete
+	}
+	return ua.Good
+}
+
+// parseSubjectName parses a subject name such as "CN=Server/O=Org/DC=host" or "CN=Server,O=Org".
+func parseSubjectName(s string) (pkix.Name, error) {
+	name := pkix.Name{}
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == '/' || r == ',' }) {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return name, ua.BadInvalidArgument
+		}
+		switch strings.ToUpper(kv[0]) {
+		case "CN":
+			name.CommonName = kv[1]
+		case "O":
+			name.Organization = append(name.Organization, kv[1])
+		case "OU":
+			name.OrganizationalUnit = append(name.OrganizationalUnit, kv[1])
+		case "L":
+			name.Locality = append(name.Locality, kv[1])
+		case "ST", "S":
+			name.Province = append(name.Province, kv[1])
+		case "C":
+			name.Country = append(name.Country, kv[1])
+		case "DC":
+			name.ExtraNames = append(name.ExtraNames, pkix.AttributeTypeAndValue{Type: oidDomainComponent, Value: kv[1]})
+		default:
+			return name, ua.BadInvalidArgument
+		}
+	}
+	if name.CommonName == "" {
+		return name, ua.BadInvalidArgument
+	}
+	return name, nil
+}
+
+// parsePrivateKeyPEM parses a PEM encoded PKCS #1 or PKCS #8 RSA private key.
+func parsePrivateKeyPEM(buf []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(buf)
+	if block == nil {
+		return nil, ua.BadInvalidArgument
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := k.(*rsa.PrivateKey)
+	if !ok {
+		return nil, ua.BadNotSupported
+	}
+	return key, nil
+}
@@ -0,0 +1,218 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/awcullen/opcua/ua"
+)
+
+var (
+	// diagnosticsRolePermissions are the RolePermissions of the session and subscription diagnostics.
+	// Anonymous users may browse the diagnostics, authenticated users may read them too.
+	diagnosticsRolePermissions = []ua.RolePermissionType{
+		{RoleID: ua.ObjectIDWellKnownRoleAnonymous, Permissions: ua.PermissionTypeBrowse},
+		{RoleID: ua.ObjectIDWellKnownRoleAuthenticatedUser, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead},
+	}
+	// diagnosticsAdminRoles are the roles that may read the diagnostics of the sessions of other users.
+	diagnosticsAdminRoles = []ua.NodeID{
+		ua.ObjectIDWellKnownRoleSupervisor,
+		ua.ObjectIDWellKnownRoleConfigureAdmin,
+		ua.ObjectIDWellKnownRoleSecurityAdmin,
+	}
+)
+
+// setDiagnosticsRolePermissions sets the RolePermissions of the diagnostics nodes.
+func setDiagnosticsRolePermissions(nodes []Node) {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *ObjectNode:
+			n.rolePermissions = diagnosticsRolePermissions
+		case *VariableNode:
+			n.rolePermissions = diagnosticsRolePermissions
+		}
+	}
+}
+
+// setDiagnosticsVisibility wraps the ReadValueHandlers of the diagnostics nodes of a session, so that
+// reading a value returns BadUserAccessDenied unless the diagnostics of the session are visible to the
+// session of the request. The session is returned by a func, because subscriptions may be transferred.
+// The values are not cached for reads with a MaxAge.
+func setDiagnosticsVisibility(nodes []Node, session func() *Session) {
+	for _, n := range nodes {
+		n, ok := n.(*VariableNode)
+		if !ok || n.readValueHandler == nil {
+			continue
+		}
+		f := n.readValueHandler
+		n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
+			if !isDiagnosticsVisible(ctx, session()) {
+				return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Time{}, 0, time.Now(), 0)
+			}
+			return f(ctx, req)
+		})
+		n.readPerSession = true
+	}
+}
+
+// isDiagnosticsVisible returns true if the diagnostics of the session are visible to the session of the
+// request. A session sees its own diagnostics. Sessions with one of the diagnosticsAdminRoles see all.
+func isDiagnosticsVisible(ctx context.Context, session *Session) bool {
+	caller, ok := ctx.Value(SessionKey).(*Session)
+	if !ok || caller == nil {
+		return false
+	}
+	if caller == session {
+		return true
+	}
+	for _, role := range caller.UserRoles() {
+		for _, r := range diagnosticsAdminRoles {
+			if role == r {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sessionDiagnosticsArray returns the diagnostics of the sessions that are visible to the session of the request.
+func (srv *Server) sessionDiagnosticsArray(ctx context.Context) ua.DataValue {
+	if !srv.serverDiagnostics {
+		return ua.NewDataValue(nil, 0, time.Now(), 0, time.Now(), 0)
+	}
+	m := srv.SessionManager()
+	m.RLock()
+	sessions := make([]*Session, 0, len(m.sessionsByToken))
+	for _, s := range m.sessionsByToken {
+		sessions = append(sessions, s)
+	}
+	m.RUnlock()
+	a := make([]ua.ExtensionObject, 0, len(sessions))
+	for _, s := range sessions {
+		if isDiagnosticsVisible(ctx, s) {
+			a = append(a, s.diagnostics())
+		}
+	}
+	return ua.NewDataValue(a, 0, time.Now(), 0, time.Now(), 0)
+}
+
+// subscriptionDiagnosticsArray returns the diagnostics of the subscriptions that are visible to the session
+// of the request. If session is not nil, only the subscriptions of the session are returned.
+func (srv *Server) subscriptionDiagnosticsArray(ctx context.Context, session *Session) ua.DataValue {
+	if !srv.serverDiagnostics {
+		return ua.NewDataValue(nil, 0, time.Now(), 0, time.Now(), 0)
+	}
+	m := srv.SubscriptionManager()
+	m.RLock()
+	subs := make([]*Subscription, 0, len(m.subscriptionsByID))
+	for _, s := range m.subscriptionsByID {
+		if session == nil || s.session == session {
+			subs = append(subs, s)
+		}
+	}
+	m.RUnlock()
+	a := make([]ua.ExtensionObject, 0, len(subs))
+	for _, s := range subs {
+		if isDiagnosticsVisible(ctx, s.session) {
+			a = append(a, s.diagnostics())
+		}
+	}
+	return ua.NewDataValue(a, 0, time.Now(), 0, time.Now(), 0)
+}
+
+// diagnostics returns the SessionDiagnosticsDataType of the session.
+func (s *Session) diagnostics() ua.SessionDiagnosticsDataType {
+	subs := s.server.SubscriptionManager().GetBySession(s)
+	itemCount := 0
+	for _, sub := range subs {
+		sub.RLock()
+		itemCount += len(sub.items)
+		sub.RUnlock()
+	}
+	return ua.SessionDiagnosticsDataType{
+		SessionID:                          s.sessionId,
+		SessionName:                        s.sessionName,
+		ClientDescription:                  s.clientDescription,
+		ServerURI:                          s.serverUri,
+		EndpointURL:                        s.endpointUrl,
+		LocaleIDs:                          s.localeIds,
+		ActualSessionTimeout:               float64(s.timeout.Nanoseconds() / 1000000),
+		MaxResponseMessageSize:             s.maxResponseMessageSize,
+		ClientConnectionTime:               s.timeCreated,
+		ClientLastContactTime:              s.lastAccess,
+		CurrentSubscriptionsCount:          uint32(len(subs)),
+		CurrentMonitoredItemsCount:         uint32(itemCount),
+		CurrentPublishRequestsInQueue:      uint32(len(s.publishRequests)),
+		TotalRequestCount:                  ua.ServiceCounterDataType{TotalCount: s.requestCount, ErrorCount: s.errorCount},
+		UnauthorizedRequestCount:           s.unauthorizedRequestCount,
+		ReadCount:                          ua.ServiceCounterDataType{TotalCount: s.readCount, ErrorCount: s.readErrorCount},
+		HistoryReadCount:                   ua.ServiceCounterDataType{TotalCount: s.historyReadCount, ErrorCount: s.historyReadErrorCount},
+		WriteCount:                         ua.ServiceCounterDataType{TotalCount: s.writeCount, ErrorCount: s.writeErrorCount},
+		HistoryUpdateCount:                 ua.ServiceCounterDataType{TotalCount: s.historyUpdateCount, ErrorCount: s.historyUpdateErrorCount},
+		CallCount:                          ua.ServiceCounterDataType{TotalCount: s.callCount, ErrorCount: s.callErrorCount},
+		CreateMonitoredItemsCount:          ua.ServiceCounterDataType{TotalCount: s.createMonitoredItemsCount, ErrorCount: s.createMonitoredItemsErrorCount},
+		ModifyMonitoredItemsCount:          ua.ServiceCounterDataType{TotalCount: s.modifyMonitoredItemsCount, ErrorCount: s.modifyMonitoredItemsErrorCount},
+		SetMonitoringModeCount:             ua.ServiceCounterDataType{TotalCount: s.setMonitoringModeCount, ErrorCount: s.setMonitoringModeErrorCount},
+		SetTriggeringCount:                 ua.ServiceCounterDataType{TotalCount: s.setTriggeringCount, ErrorCount: s.setTriggeringErrorCount},
+		DeleteMonitoredItemsCount:          ua.ServiceCounterDataType{TotalCount: s.deleteMonitoredItemsCount, ErrorCount: s.deleteMonitoredItemsErrorCount},
+		CreateSubscriptionCount:            ua.ServiceCounterDataType{TotalCount: s.createSubscriptionCount, ErrorCount: s.createSubscriptionErrorCount},
+		ModifySubscriptionCount:            ua.ServiceCounterDataType{TotalCount: s.modifySubscriptionCount, ErrorCount: s.modifySubscriptionErrorCount},
+		SetPublishingModeCount:             ua.ServiceCounterDataType{TotalCount: s.setPublishingModeCount, ErrorCount: s.setPublishingModeErrorCount},
+		PublishCount:                       ua.ServiceCounterDataType{TotalCount: s.publishCount, ErrorCount: s.publishErrorCount},
+		RepublishCount:                     ua.ServiceCounterDataType{TotalCount: s.republishCount, ErrorCount: s.republishErrorCount},
+		TransferSubscriptionsCount:         ua.ServiceCounterDataType{TotalCount: s.transferSubscriptionsCount, ErrorCount: s.transferSubscriptionsErrorCount},
+		DeleteSubscriptionsCount:           ua.ServiceCounterDataType{TotalCount: s.deleteSubscriptionsCount, ErrorCount: s.deleteSubscriptionsErrorCount},
+		AddNodesCount:                      ua.ServiceCounterDataType{TotalCount: s.addNodesCount, ErrorCount: s.addNodesErrorCount},
+		AddReferencesCount:                 ua.ServiceCounterDataType{TotalCount: s.addReferencesCount, ErrorCount: s.addReferencesErrorCount},
+		DeleteNodesCount:                   ua.ServiceCounterDataType{TotalCount: s.deleteNodesCount, ErrorCount: s.deleteNodesErrorCount},
+		DeleteReferencesCount:              ua.ServiceCounterDataType{TotalCount: s.deleteReferencesCount, ErrorCount: s.deleteReferencesErrorCount},
+		BrowseCount:                        ua.ServiceCounterDataType{TotalCount: s.browseCount, ErrorCount: s.browseErrorCount},
+		BrowseNextCount:                    ua.ServiceCounterDataType{TotalCount: s.browseNextCount, ErrorCount: s.browseNextErrorCount},
+		TranslateBrowsePathsToNodeIDsCount: ua.ServiceCounterDataType{TotalCount: s.translateBrowsePathsToNodeIdsCount, ErrorCount: s.translateBrowsePathsToNodeIdsErrorCount},
+		QueryFirstCount:                    ua.ServiceCounterDataType{TotalCount: s.queryFirstCount, ErrorCount: s.queryFirstErrorCount},
+		QueryNextCount:                     ua.ServiceCounterDataType{TotalCount: s.queryNextCount, ErrorCount: s.queryNextErrorCount},
+		RegisterNodesCount:                 ua.ServiceCounterDataType{TotalCount: s.registerNodesCount, ErrorCount: s.registerNodesErrorCount},
+		UnregisterNodesCount:               ua.ServiceCounterDataType{TotalCount: s.unregisterNodesCount, ErrorCount: s.unregisterNodesErrorCount},
+	}
+}
+
+// diagnostics returns the SubscriptionDiagnosticsDataType of the subscription.
+func (s *Subscription) diagnostics() ua.SubscriptionDiagnosticsDataType {
+	s.RLock()
+	defer s.RUnlock()
+	return ua.SubscriptionDiagnosticsDataType{
+		SessionID:                  s.sessionId,
+		SubscriptionID:             s.id,
+		Priority:                   s.priority,
+		PublishingInterval:         s.publishingInterval,
+		MaxKeepAliveCount:          s.maxKeepAliveCount,
+		MaxLifetimeCount:           s.lifetimeCount,
+		MaxNotificationsPerPublish: s.maxNotificationsPerPublish,
+		PublishingEnabled:          s.publishingEnabled,
+		ModifyCount:                s.modifyCount,
+		// EnableCount:                  uint32(0),
+		// DisableCount:                 uint32(0),
+		RepublishRequestCount:        s.republishRequestCount,
+		RepublishMessageRequestCount: s.republishMessageRequestCount,
+		RepublishMessageCount:        s.republishMessageCount,
+		// TransferRequestCount:         uint32(0),
+		// TransferredToAltClientCount:  uint32(0),
+		// TransferredToSameClientCount: uint32(0),
+		PublishRequestCount:          s.publishRequestCount,
+		DataChangeNotificationsCount: s.dataChangeNotificationsCount,
+		EventNotificationsCount:      s.eventNotificationsCount,
+		NotificationsCount:           s.notificationsCount,
+		LatePublishRequestCount:      s.latePublishRequestCount,
+		CurrentKeepAliveCount:        s.keepAliveCounter,
+		CurrentLifetimeCount:         s.lifetimeCounter,
+		UnacknowledgedMessageCount:   s.unacknowledgedMessageCount,
+		// DiscardedMessageCount:        uint32(0),
+		MonitoredItemCount:           s.monitoredItemCount,
+		DisabledMonitoredItemCount:   s.disabledMonitoredItemCount,
+		MonitoringQueueOverflowCount: s.monitoringQueueOverflowCount,
+		NextSequenceNumber:           s.seqNum,
+		// EventQueueOverFlowCount:      uint32(0),
+	}
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/hmac"
@@ -15,6 +16,7 @@ import (
 	"hash"
 	"io"
 	"log"
+	"log/slog"
 	"math"
 	rand2 "math/rand"
 	"net"
@@ -41,6 +43,8 @@ var (
 type serverSecureChannel struct {
 	sync.RWMutex
 	srv                         *Server
+	logger                      *slog.Logger
+	services                    sync.Map
 	localCertificate            []byte
 	remoteCertificate           []byte
 	localPrivateKey             *rsa.PrivateKey
@@ -92,6 +96,8 @@ type serverSecureChannel struct {
 	endpointURL       string
 	conn              net.Conn
 	closed            bool
+	// opened is set while the channel is open, so the ChannelClosed event is raised once.
+	opened atomic.Bool
 }
 
 // newServerSecureChannel initializes a new instance of the UaTcpSecureChannel.
@@ -107,9 +113,9 @@ func newServerSecureChannel(srv *Server, conn net.Conn, receiveBufferSize, sendB
 		channelID:         getNextServerChannelID(),
 		securityPolicyURI: ua.SecurityPolicyURINone,
 		securityPolicy:    new(ua.SecurityPolicyNone),
-		localCertificate:  srv.localCertificate,
-		localPrivateKey:   srv.localPrivateKey,
 	}
+	ch.localCertificate, ch.localPrivateKey = srv.localKeyPair()
+	ch.logger = srv.logger.With(ua.ChannelIDAttr(ch.channelID))
 	return ch
 }
 
@@ -209,6 +215,7 @@ func (ch *serverSecureChannel) Open() error {
 
 // Close the secure channel.
 func (ch *serverSecureChannel) Close() error {
+	defer ch.raiseClosed()
 	ch.Lock()
 	defer ch.Unlock()
 	if err := ch.onClosing(); err != nil {
@@ -223,6 +230,7 @@ func (ch *serverSecureChannel) Close() error {
 
 // Abort the secure channel.
 func (ch *serverSecureChannel) Abort(reason ua.StatusCode, message string) error {
+	defer ch.raiseClosed()
 	ch.Lock()
 	defer ch.Unlock()
 	if err := ch.onClosing(); err != nil {
@@ -241,17 +249,44 @@ func (ch *serverSecureChannel) Write(res ua.ServiceResponse, id uint32) error {
 		b, _ := json.MarshalIndent(res, "", " ")
 		log.Printf("%s%s", reflect.TypeOf(res).Elem().Name(), b)
 	}
+	if service, ok := ch.services.LoadAndDelete(id); ok {
+		if fault, ok := res.(*ua.ServiceFault); ok {
+			level := slog.LevelWarn
+			switch fault.ServiceResult {
+			case ua.BadTimeout, ua.BadNoSubscription, ua.BadTooManyPublishRequests:
+				// expected in the normal course of publishing.
+				level = slog.LevelDebug
+			}
+			ch.logger.Log(context.Background(), level, "Service fault", slog.String(ua.LogKeyService, service.(string)), ua.StatusCodeAttr(fault.ServiceResult))
+		}
+	}
 	switch res1 := res.(type) {
 	case *ua.OpenSecureChannelResponse:
 		err := ch.sendOpenSecureChannelResponse(res1, id)
 		if err != nil {
-			log.Printf("Error sending OpenSecureChannelResponse. %s\n", err)
+			ch.logger.Warn("Error sending OpenSecureChannelResponse", ua.StatusCodeAttr(err))
 		}
 		return err
 	default:
 		err := ch.sendServiceResponse(res1, id)
+		if err == ua.BadEncodingLimitsExceeded {
+			// the response exceeds the limits negotiated for this channel, so nothing was sent.
+			// report the fault to the client, rather than leave the request to time out.
+			if _, ok := res1.(*ua.ServiceFault); !ok {
+				err = ch.sendServiceResponse(
+					&ua.ServiceFault{
+						ResponseHeader: ua.ResponseHeader{
+							Timestamp:     time.Now(),
+							RequestHandle: res1.Header().RequestHandle,
+							ServiceResult: ua.BadResponseTooLarge,
+						},
+					},
+					id,
+				)
+			}
+		}
 		if err != nil {
-			log.Printf("Error sending service response. %s\n", err)
+			ch.logger.Warn("Error sending service response", ua.StatusCodeAttr(err))
 		}
 		return err
 	}
@@ -363,13 +398,13 @@ func (ch *serverSecureChannel) onOpen() error {
 	}, 32)
 
 	// read first request, which must be an OpenSecureChannelRequest
-	log.Println("Waiting for OpenSecureChannelRequest")
+	ch.logger.Debug("Waiting for OpenSecureChannelRequest")
 	req, rid, err := ch.readRequest()
 	if err != nil {
-		log.Printf("Error receiving OpenSecureChannelRequest. %s\n", err)
+		ch.logger.Warn("Error receiving OpenSecureChannelRequest", ua.StatusCodeAttr(err))
 		return err
 	}
-	log.Println("Processing OpenSecureChannelRequest")
+	ch.logger.Debug("Processing OpenSecureChannelRequest")
 	oscr, ok := req.(*ua.OpenSecureChannelRequest)
 	if !ok {
 		return ua.BadDecodingError
@@ -386,7 +421,7 @@ func (ch *serverSecureChannel) onOpen() error {
 		}
 	}(ch)
 	ch.remoteNonce = []byte(oscr.ClientNonce)
-	log.Println("Identifying server endpoint")
+	ch.logger.Debug("Identifying server endpoint")
 	for _, ep := range ch.srv.Endpoints() {
 		if ep.TransportProfileURI == ua.TransportProfileURIUaTcpTransport && ep.SecurityPolicyURI == ch.securityPolicyURI && ep.SecurityMode == ch.securityMode {
 			ch.localEndpoint = ep
@@ -422,9 +457,20 @@ func (ch *serverSecureChannel) onOpen() error {
 		if err != nil {
 			return ua.BadSecurityChecksFailed
 		}
-		valid, err := validateClientCertificate(cert, ch.srv.trustedCertsPath, ch.srv.suppressCertificateExpired, ch.srv.suppressCertificateChainIncomplete)
-		if !valid {
-			return err
+		if v := ch.srv.certificateValidator; v != nil {
+			result := v.Validate(cert, x509.ExtKeyUsageClientAuth, "", "")
+			if err := result.Err(); err != nil {
+				ch.logger.Warn("Rejected client certificate", ua.StatusCodeAttr(err), slog.String("subject", cert.Subject.String()), slog.String("result", result.String()))
+				ch.srv.addRejectedCertificate(ch.remoteCertificate)
+				return err
+			}
+		} else {
+			valid, err := validateClientCertificate(cert, ch.srv.trustedCertsPath, ch.srv.suppressCertificateExpired, ch.srv.suppressCertificateChainIncomplete)
+			if !valid {
+				ch.logger.Warn("Rejected client certificate", ua.StatusCodeAttr(err), slog.String("subject", cert.Subject.String()))
+				ch.srv.addRejectedCertificate(ch.remoteCertificate)
+				return err
+			}
 		}
 		ch.remotePublicKey = cert.PublicKey.(*rsa.PublicKey)
 		if len(cert.URIs) > 0 {
@@ -445,16 +491,27 @@ func (ch *serverSecureChannel) onOpen() error {
 		},
 		ServerNonce: ua.ByteString(ch.localNonce),
 	}
-	log.Println("Sending OpenSecureChannelResponse")
+	ch.logger.Debug("Sending OpenSecureChannelResponse")
 	ch.Write(res, rid)
+	ch.logger.Info("Opened secure channel", slog.String("securityPolicyUri", ch.securityPolicyURI), slog.String("securityMode", ch.securityMode.String()), slog.String("remoteAddress", ch.conn.RemoteAddr().String()))
 
 	// log.Printf("Issued security token. %d , lifetime: %d\n", res.SecurityToken.TokenID, res.SecurityToken.RevisedLifetime)
 
+	ch.opened.Store(true)
+	atomic.AddInt64(&ch.srv.goroutines.channels, 1)
 	go ch.requestWorker()
 
 	return nil
 }
 
+// raiseClosed raises the ChannelClosed lifecycle event, if the channel was opened and the event was
+// not raised yet. Must be called without holding the lock of the channel.
+func (ch *serverSecureChannel) raiseClosed() {
+	if ch.opened.CompareAndSwap(true, false) {
+		ch.srv.raiseChannelEvent(LifecycleEventChannelClosed, ch)
+	}
+}
+
 func (ch *serverSecureChannel) onOpened() error {
 	// log.Printf("onOpened secure channel.\n")
 	return nil
@@ -1002,6 +1059,21 @@ func (ch *serverSecureChannel) sendServiceResponse(response ua.ServiceResponse,
 	var signatureSize = ch.securityPolicy.SymSignatureSize()
 	var encryptionBlockSize = ch.securityPolicy.SymEncryptionBlockSize()
 
+	// check the chunk count before sending, so a response that is too large is not partially sent.
+	if i := int(ch.maxChunkCount); i > 0 {
+		maxBodySize := int(ch.sendBufferSize) - 16 - sequenceHeaderSize
+		if ch.securityMode == ua.MessageSecurityModeSignAndEncrypt {
+			paddingHeaderSize := 1
+			if encryptionBlockSize > 256 {
+				paddingHeaderSize = 2
+			}
+			maxBodySize = (((int(ch.sendBufferSize) - 16) / encryptionBlockSize) * encryptionBlockSize) - sequenceHeaderSize - paddingHeaderSize - signatureSize
+		}
+		if maxBodySize <= 0 || (bodyCount+maxBodySize-1)/maxBodySize > i {
+			return ua.BadEncodingLimitsExceeded
+		}
+	}
+
 	for bodyCount > 0 {
 		chunkCount++
 		if i := int(ch.maxChunkCount); i > 0 && chunkCount > i {
@@ -1133,6 +1205,12 @@ func (ch *serverSecureChannel) readRequest() (ua.ServiceRequest, uint32, error)
 	var bodyStream = buffer.NewPartitionAt(bufferPool)
 	defer bodyStream.Reset()
 	var bodyDecoder = ua.NewBinaryDecoder(bodyStream, ch)
+	caps := ch.srv.serverCapabilities
+	bodyDecoder.SetLimits(ua.EncodingLimits{
+		MaxStringLength:     caps.MaxStringLength,
+		MaxByteStringLength: caps.MaxByteStringLength,
+		MaxArrayLength:      caps.MaxArrayLength,
+	})
 
 	// read chunks
 	var chunkCount int32
@@ -1264,6 +1342,14 @@ func (ch *serverSecureChannel) readRequest() (ua.ServiceRequest, uint32, error)
 			}
 			plainHeaderSize = count - stream.Len()
 
+			// select the certificate the client encrypted with, which is the previous certificate
+			// if the client got the endpoints before the server certificate was replaced.
+			if len(ch.remoteCertificateThumbprint) > 0 {
+				if crt, key, ok := ch.srv.keyPairByThumbprint(ch.remoteCertificateThumbprint); ok && !bytes.Equal(crt, ch.localCertificate) {
+					ch.localCertificate, ch.localPrivateKey = crt, key
+				}
+			}
+
 			// setSecurityPolicy
 			switch ch.securityPolicyURI {
 			case ua.SecurityPolicyURINone:
@@ -1499,6 +1585,10 @@ func (ch *serverSecureChannel) readRequest() (ua.ServiceRequest, uint32, error)
 
 	// decode fields from message stream
 	if err := bodyDecoder.Decode(temp); err != nil {
+		if err == ua.BadEncodingLimitsExceeded {
+			// the message was read completely, return the request header decoded so far.
+			return temp.(ua.ServiceRequest), id, err
+		}
 		return nil, 0, ua.BadDecodingError
 	}
 	req = temp.(ua.ServiceRequest)
@@ -1563,19 +1653,45 @@ func (ch *serverSecureChannel) setupNewToken(tokenID uint32) error {
 
 // requestWorker starts a task to receive service requests from transport channel.
 func (ch *serverSecureChannel) requestWorker() {
+	defer atomic.AddInt64(&ch.srv.goroutines.channels, -1)
 	ch.wg.Add(1)
 	for {
 		req, id, err := ch.readRequest()
+		if err == ua.BadEncodingLimitsExceeded && req != nil {
+			// the framing of the message is intact, so reject the request and keep the channel.
+			ch.logger.Warn("Error decoding request", ua.ServiceAttr(req), ua.StatusCodeAttr(err))
+			ch.Write(
+				&ua.ServiceFault{
+					ResponseHeader: ua.ResponseHeader{
+						Timestamp:     time.Now(),
+						RequestHandle: req.Header().RequestHandle,
+						ServiceResult: ua.BadEncodingLimitsExceeded,
+					},
+				},
+				id,
+			)
+			continue
+		}
 		if err != nil {
 			if err != ua.BadSecureChannelClosed {
-				log.Printf("Error receiving request. %s\n", err)
+				ch.logger.Warn("Error receiving request", ua.StatusCodeAttr(err))
+			}
+			// reject a malformed message by closing the channel.
+			if err == ua.BadEncodingLimitsExceeded || err == ua.BadDecodingError {
+				ch.Abort(err.(ua.StatusCode), "")
 			}
+			ch.logger.Info("Closed secure channel")
+			ch.raiseClosed()
 			ch.wg.Done()
 			return
 		}
+		if ch.logger.Enabled(context.Background(), slog.LevelWarn) {
+			// remember the service of the request, to log a ServiceFault.
+			ch.services.Store(id, ua.ServiceName(req))
+		}
 		err = ch.handleRequest(req, id)
 		if err != nil {
-			log.Printf("Error handling request. %s\n", err)
+			ch.logger.Error("Error handling request", ua.ServiceAttr(req), ua.StatusCodeAttr(err))
 		}
 	}
 }
@@ -1599,6 +1715,10 @@ func (ch *serverSecureChannel) handleRequest(req ua.ServiceRequest, requestid ui
 		return ch.srv.handleBrowseNext(ch, requestid, req)
 	case *ua.TranslateBrowsePathsToNodeIDsRequest:
 		return ch.srv.handleTranslateBrowsePathsToNodeIds(ch, requestid, req)
+	case *ua.QueryFirstRequest:
+		return ch.srv.handleQueryFirst(ch, requestid, req)
+	case *ua.QueryNextRequest:
+		return ch.srv.handleQueryNext(ch, requestid, req)
 	case *ua.CreateSubscriptionRequest:
 		return ch.srv.handleCreateSubscription(ch, requestid, req)
 	case *ua.ModifySubscriptionRequest:
@@ -1607,6 +1727,8 @@ func (ch *serverSecureChannel) handleRequest(req ua.ServiceRequest, requestid ui
 		return ch.srv.handleSetPublishingMode(ch, requestid, req)
 	case *ua.DeleteSubscriptionsRequest:
 		return ch.srv.handleDeleteSubscriptions(ch, requestid, req)
+	case *ua.TransferSubscriptionsRequest:
+		return ch.srv.handleTransferSubscriptions(ch, requestid, req)
 	case *ua.CreateMonitoredItemsRequest:
 		return ch.srv.handleCreateMonitoredItems(ch, requestid, req)
 	case *ua.ModifyMonitoredItemsRequest:
@@ -1617,6 +1739,8 @@ func (ch *serverSecureChannel) handleRequest(req ua.ServiceRequest, requestid ui
 		return ch.srv.handleDeleteMonitoredItems(ch, requestid, req)
 	case *ua.HistoryReadRequest:
 		return ch.srv.handleHistoryRead(ch, requestid, req)
+	case *ua.HistoryUpdateRequest:
+		return ch.srv.handleHistoryUpdate(ch, requestid, req)
 	case *ua.CreateSessionRequest:
 		return ch.srv.handleCreateSession(ch, requestid, req)
 	case *ua.ActivateSessionRequest:
@@ -1635,6 +1759,10 @@ func (ch *serverSecureChannel) handleRequest(req ua.ServiceRequest, requestid ui
 		return ch.srv.handleRegisterNodes(ch, requestid, req)
 	case *ua.UnregisterNodesRequest:
 		return ch.srv.handleUnregisterNodes(ch, requestid, req)
+	case *ua.AddNodesRequest:
+		return ch.srv.handleAddNodes(ch, requestid, req)
+	case *ua.DeleteNodesRequest:
+		return ch.srv.handleDeleteNodes(ch, requestid, req)
 	case *ua.SetTriggeringRequest:
 		return ch.srv.handleSetTriggering(ch, requestid, req)
 	case *ua.CancelRequest:
@@ -1684,7 +1812,7 @@ func (ch *serverSecureChannel) handleOpenSecureChannel(requestid uint32, req *ua
 		ServerNonce: ua.ByteString(ch.localNonce),
 	}
 	ch.Write(res, requestid)
-	// log.Printf("Renewed security token. %d , lifetime: %d\n", res.SecurityToken.TokenId, res.SecurityToken.RevisedLifetime)
+	ch.logger.Debug("Renewed secure channel", slog.Uint64("tokenId", uint64(ch.tokenID)))
 
 	return nil
 }
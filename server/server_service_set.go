@@ -3,6 +3,7 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"crypto"
 	"crypto/rand"
@@ -11,8 +12,10 @@ import (
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/binary"
+	"log/slog"
 	"math"
 	"net/url"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
@@ -20,14 +23,13 @@ import (
 	"time"
 
 	"github.com/awcullen/opcua/ua"
-	"github.com/djherbis/buffer"
 	"github.com/google/uuid"
 )
 
 // FindServers returns the Servers known to a Server or Discovery Server.
 func (srv *Server) findServers(ch *serverSecureChannel, requestid uint32, req *ua.FindServersRequest) error {
 	srvs := make([]ua.ApplicationDescription, 0, 1)
-	for _, s := range []ua.ApplicationDescription{srv.LocalDescription()} {
+	for _, s := range []ua.ApplicationDescription{srv.localizedDescription(req.LocaleIDs)} {
 		if len(req.ServerURIs) > 0 {
 			for _, su := range req.ServerURIs {
 				if s.ApplicationURI == su {
@@ -55,7 +57,9 @@ func (srv *Server) findServers(ch *serverSecureChannel, requestid uint32, req *u
 // GetEndpoints returns the endpoint descriptions supported by the server.
 func (srv *Server) getEndpoints(ch *serverSecureChannel, requestid uint32, req *ua.GetEndpointsRequest) error {
 	eps := make([]ua.EndpointDescription, 0, len(srv.Endpoints()))
+	desc := srv.localizedDescription(req.LocaleIDs)
 	for _, ep := range srv.Endpoints() {
+		ep.Server = desc
 		if len(req.ProfileURIs) > 0 {
 			for _, pu := range req.ProfileURIs {
 				if ep.TransportProfileURI == pu {
@@ -89,7 +93,7 @@ func (srv *Server) handleCreateSession(ch *serverSecureChannel, requestid uint32
 	}
 	// check endpointurl hostname matches one of the certificate hostnames
 	valid := false
-	if crt, err := x509.ParseCertificate(srv.LocalCertificate()); err == nil {
+	if crt, err := x509.ParseCertificate(ch.localCertificate); err == nil {
 		if remoteURL, err := url.Parse(req.EndpointURL); err == nil {
 			hostname := remoteURL.Host
 			i := strings.Index(hostname, ":")
@@ -119,10 +123,15 @@ func (srv *Server) handleCreateSession(ch *serverSecureChannel, requestid uint32
 	case ua.SecurityPolicyURIBasic128Rsa15, ua.SecurityPolicyURIBasic256, ua.SecurityPolicyURIBasic256Sha256,
 		ua.SecurityPolicyURIAes128Sha256RsaOaep, ua.SecurityPolicyURIAes256Sha256RsaPss:
 
-		// check client application uri matches one of the client certificate's san.
+		// check client application uri matches one of the client certificate's san. The certificate
+		// validator checked the rest of the certificate when the secure channel was opened, before the
+		// client description was known, so only the uri is checked here.
 		valid := false
 		if appuri := req.ClientDescription.ApplicationURI; appuri != "" {
 			if crt, err := x509.ParseCertificate([]byte(req.ClientCertificate)); err == nil {
+				if v := srv.certificateValidator; v != nil && v.SuppressCertificateURIInvalid {
+					valid = true
+				}
 				for _, crturi := range crt.URIs {
 					if crturi.String() == appuri {
 						valid = true
@@ -167,7 +176,7 @@ func (srv *Server) handleCreateSession(ch *serverSecureChannel, requestid uint32
 		hash.Write([]byte(req.ClientCertificate))
 		hash.Write([]byte(req.ClientNonce))
 		hashed := hash.Sum(nil)
-		signature, err := rsa.SignPKCS1v15(rand.Reader, srv.localPrivateKey, crypto.SHA1, hashed)
+		signature, err := rsa.SignPKCS1v15(rand.Reader, ch.localPrivateKey, crypto.SHA1, hashed)
 		if err != nil {
 			return err
 		}
@@ -181,7 +190,7 @@ func (srv *Server) handleCreateSession(ch *serverSecureChannel, requestid uint32
 		hash.Write([]byte(req.ClientCertificate))
 		hash.Write([]byte(req.ClientNonce))
 		hashed := hash.Sum(nil)
-		signature, err := rsa.SignPKCS1v15(rand.Reader, srv.localPrivateKey, crypto.SHA256, hashed)
+		signature, err := rsa.SignPKCS1v15(rand.Reader, ch.localPrivateKey, crypto.SHA256, hashed)
 		if err != nil {
 			return err
 		}
@@ -195,7 +204,7 @@ func (srv *Server) handleCreateSession(ch *serverSecureChannel, requestid uint32
 		hash.Write([]byte(req.ClientCertificate))
 		hash.Write([]byte(req.ClientNonce))
 		hashed := hash.Sum(nil)
-		signature, err := rsa.SignPSS(rand.Reader, srv.localPrivateKey, crypto.SHA256, hashed, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		signature, err := rsa.SignPSS(rand.Reader, ch.localPrivateKey, crypto.SHA256, hashed, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
 		if err != nil {
 			return err
 		}
@@ -239,7 +248,7 @@ func (srv *Server) handleCreateSession(ch *serverSecureChannel, requestid uint32
 		)
 		return nil
 	}
-	// log.Printf("Created session '%s'.\n", req.SessionName)
+	ch.logger.Info("Created session", ua.SessionIDAttr(session.sessionId), slog.String("sessionName", req.SessionName))
 
 	ch.Write(
 		&ua.CreateSessionResponse{
@@ -251,7 +260,7 @@ func (srv *Server) handleCreateSession(ch *serverSecureChannel, requestid uint32
 			AuthenticationToken:        session.authenticationToken,
 			RevisedSessionTimeout:      req.RequestedSessionTimeout,
 			ServerNonce:                session.sessionNonce,
-			ServerCertificate:          ua.ByteString(srv.LocalCertificate()),
+			ServerCertificate:          ua.ByteString(ch.localCertificate),
 			ServerEndpoints:            srv.Endpoints(),
 			ServerSoftwareCertificates: nil,
 			ServerSignature:            serverSignature,
@@ -273,6 +282,7 @@ func (srv *Server) handleActivateSession(ch *serverSecureChannel, requestid uint
 	m := srv.sessionManager
 	session, ok := m.Get(req.AuthenticationToken)
 	if !ok {
+		ch.logger.Warn("Rejected session activation", ua.StatusCodeAttr(ua.BadSessionIDInvalid))
 		ch.Write(
 			&ua.ServiceFault{
 				ResponseHeader: ua.ResponseHeader{
@@ -286,72 +296,70 @@ func (srv *Server) handleActivateSession(ch *serverSecureChannel, requestid uint
 		return nil
 	}
 
+	// the user identity of the audit events, until the token is validated.
+	var userIdentity interface{}
+
 	// verify the client's signature.
 	var err error
 	switch ch.SecurityPolicyURI() {
 	case ua.SecurityPolicyURIBasic128Rsa15, ua.SecurityPolicyURIBasic256:
 		hash := crypto.SHA1.New()
-		hash.Write(srv.LocalCertificate())
+		hash.Write(ch.localCertificate)
 		hash.Write([]byte(session.SessionNonce()))
 		hashed := hash.Sum(nil)
 		err = rsa.VerifyPKCS1v15(ch.RemotePublicKey(), crypto.SHA1, hashed, []byte(req.ClientSignature.Signature))
 
 	case ua.SecurityPolicyURIBasic256Sha256, ua.SecurityPolicyURIAes128Sha256RsaOaep:
 		hash := crypto.SHA256.New()
-		hash.Write(srv.LocalCertificate())
+		hash.Write(ch.localCertificate)
 		hash.Write([]byte(session.SessionNonce()))
 		hashed := hash.Sum(nil)
 		err = rsa.VerifyPKCS1v15(ch.RemotePublicKey(), crypto.SHA256, hashed, []byte(req.ClientSignature.Signature))
 
 	case ua.SecurityPolicyURIAes256Sha256RsaPss:
 		hash := crypto.SHA256.New()
-		hash.Write(srv.LocalCertificate())
+		hash.Write(ch.localCertificate)
 		hash.Write([]byte(session.SessionNonce()))
 		hashed := hash.Sum(nil)
 		err = rsa.VerifyPSS(ch.RemotePublicKey(), crypto.SHA256, hashed, []byte(req.ClientSignature.Signature), &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
 	}
 	if err != nil {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadApplicationSignatureInvalid,
-				},
-			},
-			requestid,
-		)
+		srv.rejectActivateSession(ch, requestid, req, session, userIdentity, ua.BadApplicationSignatureInvalid)
 		return nil
 	}
 
 	// validate identity and store
-	var userIdentity interface{}
 	switch userIdentityToken := req.UserIdentityToken.(type) {
 	case ua.IssuedIdentityToken:
+		userIdentity = ua.IssuedIdentity{}
 		var tokenPolicy *ua.UserTokenPolicy
 		for _, t := range ch.LocalEndpoint().UserIdentityTokens {
-			if t.TokenType == ua.UserTokenTypeCertificate && t.PolicyID == userIdentityToken.PolicyID {
+			if t.TokenType == ua.UserTokenTypeIssuedToken && t.PolicyID == userIdentityToken.PolicyID {
 				tokenPolicy = &t
 				break
 			}
 		}
-		if tokenPolicy == nil {
-			ch.Write(
-				&ua.ServiceFault{
-					ResponseHeader: ua.ResponseHeader{
-						Timestamp:     time.Now(),
-						RequestHandle: req.RequestHandle,
-						ServiceResult: ua.BadIdentityTokenInvalid,
-					},
-				},
-				requestid,
-			)
+		if tokenPolicy == nil || len(userIdentityToken.TokenData) == 0 {
+			srv.rejectActivateSession(ch, requestid, req, session, userIdentity, ua.BadIdentityTokenInvalid)
 			return nil
 		}
-		// TODO: validate IssuedIdentity
-		userIdentity = ua.IssuedIdentity{TokenData: userIdentityToken.TokenData}
+		tokenData := []byte(userIdentityToken.TokenData)
+		if userIdentityToken.EncryptionAlgorithm != "" {
+			secPolicyURI := tokenPolicy.SecurityPolicyURI
+			if secPolicyURI == "" {
+				secPolicyURI = ch.LocalEndpoint().SecurityPolicyURI
+			}
+			var status ua.StatusCode
+			tokenData, status = srv.decryptTokenSecret(ch.localPrivateKey, secPolicyURI, userIdentityToken.EncryptionAlgorithm, tokenData, []byte(session.SessionNonce()))
+			if status != ua.Good {
+				srv.rejectActivateSession(ch, requestid, req, session, userIdentity, status)
+				return nil
+			}
+		}
+		userIdentity = ua.IssuedIdentity{TokenData: ua.ByteString(tokenData)}
 
 	case ua.X509IdentityToken:
+		userIdentity = ua.X509Identity{Certificate: userIdentityToken.CertificateData}
 		var tokenPolicy *ua.UserTokenPolicy
 		for _, t := range ch.LocalEndpoint().UserIdentityTokens {
 			if t.TokenType == ua.UserTokenTypeCertificate && t.PolicyID == userIdentityToken.PolicyID {
@@ -360,16 +368,7 @@ func (srv *Server) handleActivateSession(ch *serverSecureChannel, requestid uint
 			}
 		}
 		if tokenPolicy == nil {
-			ch.Write(
-				&ua.ServiceFault{
-					ResponseHeader: ua.ResponseHeader{
-						Timestamp:     time.Now(),
-						RequestHandle: req.RequestHandle,
-						ServiceResult: ua.BadIdentityTokenInvalid,
-					},
-				},
-				requestid,
-			)
+			srv.rejectActivateSession(ch, requestid, req, session, userIdentity, ua.BadIdentityTokenInvalid)
 			return nil
 		}
 		secPolicyURI := tokenPolicy.SecurityPolicyURI
@@ -378,71 +377,57 @@ func (srv *Server) handleActivateSession(ch *serverSecureChannel, requestid uint
 		}
 		userCert, err := x509.ParseCertificate([]byte(userIdentityToken.CertificateData))
 		if err != nil {
-			ch.Write(
-				&ua.ServiceFault{
-					ResponseHeader: ua.ResponseHeader{
-						Timestamp:     time.Now(),
-						RequestHandle: req.RequestHandle,
-						ServiceResult: ua.BadIdentityTokenInvalid,
-					},
-				},
-				requestid,
-			)
+			srv.rejectActivateSession(ch, requestid, req, session, userIdentity, ua.BadIdentityTokenInvalid)
 			return nil
 		}
 		userKey, ok := userCert.PublicKey.(*rsa.PublicKey)
 		if !ok {
-			ch.Write(
-				&ua.ServiceFault{
-					ResponseHeader: ua.ResponseHeader{
-						Timestamp:     time.Now(),
-						RequestHandle: req.RequestHandle,
-						ServiceResult: ua.BadIdentityTokenInvalid,
-					},
-				},
-				requestid,
-			)
+			srv.rejectActivateSession(ch, requestid, req, session, userIdentity, ua.BadIdentityTokenInvalid)
 			return nil
 		}
 
 		switch secPolicyURI {
 		case ua.SecurityPolicyURIBasic128Rsa15, ua.SecurityPolicyURIBasic256:
 			hash := crypto.SHA1.New()
-			hash.Write(srv.LocalCertificate())
+			hash.Write(ch.localCertificate)
 			hash.Write([]byte(session.SessionNonce()))
 			hashed := hash.Sum(nil)
 			err = rsa.VerifyPKCS1v15(userKey, crypto.SHA1, hashed, []byte(req.UserTokenSignature.Signature))
 
 		case ua.SecurityPolicyURIBasic256Sha256, ua.SecurityPolicyURIAes128Sha256RsaOaep:
 			hash := crypto.SHA256.New()
-			hash.Write(srv.LocalCertificate())
+			hash.Write(ch.localCertificate)
 			hash.Write([]byte(session.SessionNonce()))
 			hashed := hash.Sum(nil)
 			err = rsa.VerifyPKCS1v15(userKey, crypto.SHA256, hashed, []byte(req.UserTokenSignature.Signature))
 
 		case ua.SecurityPolicyURIAes256Sha256RsaPss:
 			hash := crypto.SHA256.New()
-			hash.Write(srv.LocalCertificate())
+			hash.Write(ch.localCertificate)
 			hash.Write([]byte(session.SessionNonce()))
 			hashed := hash.Sum(nil)
 			err = rsa.VerifyPSS(userKey, crypto.SHA256, hashed, []byte(req.UserTokenSignature.Signature), &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+
+		default:
+			// the user must prove possession of the private key.
+			err = ua.BadSecurityPolicyRejected
 		}
 		if err != nil {
-			ch.Write(
-				&ua.ServiceFault{
-					ResponseHeader: ua.ResponseHeader{
-						Timestamp:     time.Now(),
-						RequestHandle: req.RequestHandle,
-						ServiceResult: ua.BadIdentityTokenRejected,
-					},
-				},
-				requestid,
-			)
+			srv.rejectActivateSession(ch, requestid, req, session, userIdentity, ua.BadUserSignatureInvalid)
 			return nil
 		}
+		if v := srv.userCertificateValidator; v != nil {
+			result := v.Validate(userCert, x509.ExtKeyUsageClientAuth, "", "")
+			if err := result.Err(); err != nil {
+				ch.logger.Warn("Error validating user certificate", slog.String("result", result.String()), ua.StatusCodeAttr(err))
+				srv.rejectActivateSession(ch, requestid, req, session, userIdentity, ua.BadIdentityTokenRejected)
+				return nil
+			}
+		}
 		userIdentity = ua.X509Identity{Certificate: userIdentityToken.CertificateData}
 
 	case ua.UserNameIdentityToken:
+		userIdentity = ua.UserNameIdentity{UserName: userIdentityToken.UserName}
 		var tokenPolicy *ua.UserTokenPolicy
 		for _, t := range ch.LocalEndpoint().UserIdentityTokens {
 			if t.TokenType == ua.UserTokenTypeUserName && t.PolicyID == userIdentityToken.PolicyID {
@@ -451,29 +436,11 @@ func (srv *Server) handleActivateSession(ch *serverSecureChannel, requestid uint
 			}
 		}
 		if tokenPolicy == nil {
-			ch.Write(
-				&ua.ServiceFault{
-					ResponseHeader: ua.ResponseHeader{
-						Timestamp:     time.Now(),
-						RequestHandle: req.RequestHandle,
-						ServiceResult: ua.BadIdentityTokenInvalid,
-					},
-				},
-				requestid,
-			)
+			srv.rejectActivateSession(ch, requestid, req, session, userIdentity, ua.BadIdentityTokenInvalid)
 			return nil
 		}
 		if userIdentityToken.UserName == "" {
-			ch.Write(
-				&ua.ServiceFault{
-					ResponseHeader: ua.ResponseHeader{
-						Timestamp:     time.Now(),
-						RequestHandle: req.RequestHandle,
-						ServiceResult: ua.BadIdentityTokenInvalid,
-					},
-				},
-				requestid,
-			)
+			srv.rejectActivateSession(ch, requestid, req, session, userIdentity, ua.BadIdentityTokenInvalid)
 			return nil
 		}
 		cipherBytes := []byte(userIdentityToken.Password)
@@ -483,154 +450,12 @@ func (srv *Server) handleActivateSession(ch *serverSecureChannel, requestid uint
 		}
 
 		switch secPolicyURI {
-		case ua.SecurityPolicyURIBasic128Rsa15:
-			if userIdentityToken.EncryptionAlgorithm != ua.RsaV15KeyWrap {
-				ch.Write(
-					&ua.ServiceFault{
-						ResponseHeader: ua.ResponseHeader{
-							Timestamp:     time.Now(),
-							RequestHandle: req.RequestHandle,
-							ServiceResult: ua.BadIdentityTokenInvalid,
-						},
-					},
-					requestid,
-				)
-				return nil
-			}
-			plainBuf := buffer.NewPartitionAt(bufferPool)
-			cipherBuf := buffer.NewPartitionAt(bufferPool)
-			cipherBuf.Write(cipherBytes)
-			cipherText := make([]byte, int32(len(srv.localPrivateKey.D.Bytes())))
-			for cipherBuf.Len() > 0 {
-				cipherBuf.Read(cipherText)
-				// decrypt with local private key.
-				plainText, err := rsa.DecryptPKCS1v15(rand.Reader, srv.localPrivateKey, cipherText)
-				if err != nil {
-					return err
-				}
-				plainBuf.Write(plainText)
-			}
-			plainLength := uint32(0)
-			if plainBuf.Len() > 0 {
-				binary.Read(plainBuf, binary.LittleEndian, &plainLength)
-			}
-			if plainLength < 32 || plainLength > 96 {
-				ch.Write(
-					&ua.ServiceFault{
-						ResponseHeader: ua.ResponseHeader{
-							Timestamp:     time.Now(),
-							RequestHandle: req.RequestHandle,
-							ServiceResult: ua.BadIdentityTokenRejected,
-						},
-					},
-					requestid,
-				)
-				return nil
-			}
-			passwordBytes := make([]byte, plainLength-32)
-			plainBuf.Read(passwordBytes)
-			cipherBuf.Reset()
-			plainBuf.Reset()
-			userIdentity = ua.UserNameIdentity{UserName: userIdentityToken.UserName, Password: string(passwordBytes)}
-
-		case ua.SecurityPolicyURIBasic256, ua.SecurityPolicyURIBasic256Sha256, ua.SecurityPolicyURIAes128Sha256RsaOaep:
-			if userIdentityToken.EncryptionAlgorithm != ua.RsaOaepKeyWrap {
-				ch.Write(
-					&ua.ServiceFault{
-						ResponseHeader: ua.ResponseHeader{
-							Timestamp:     time.Now(),
-							RequestHandle: req.RequestHandle,
-							ServiceResult: ua.BadIdentityTokenInvalid,
-						},
-					},
-					requestid,
-				)
-				return nil
-			}
-			plainBuf := buffer.NewPartitionAt(bufferPool)
-			cipherBuf := buffer.NewPartitionAt(bufferPool)
-			cipherBuf.Write(cipherBytes)
-			cipherText := make([]byte, int32(len(srv.localPrivateKey.D.Bytes())))
-			for cipherBuf.Len() > 0 {
-				cipherBuf.Read(cipherText)
-				// decrypt with local private key.
-				plainText, err := rsa.DecryptOAEP(sha1.New(), rand.Reader, srv.localPrivateKey, cipherText, []byte{})
-				if err != nil {
-					return err
-				}
-				plainBuf.Write(plainText)
-			}
-			plainLength := uint32(0)
-			if plainBuf.Len() > 0 {
-				binary.Read(plainBuf, binary.LittleEndian, &plainLength)
-			}
-			if plainLength < 32 || plainLength > 96 {
-				ch.Write(
-					&ua.ServiceFault{
-						ResponseHeader: ua.ResponseHeader{
-							Timestamp:     time.Now(),
-							RequestHandle: req.RequestHandle,
-							ServiceResult: ua.BadIdentityTokenRejected,
-						},
-					},
-					requestid,
-				)
-				return nil
-			}
-			passwordBytes := make([]byte, plainLength-32)
-			plainBuf.Read(passwordBytes)
-			cipherBuf.Reset()
-			plainBuf.Reset()
-			userIdentity = ua.UserNameIdentity{UserName: userIdentityToken.UserName, Password: string(passwordBytes)}
-
-		case ua.SecurityPolicyURIAes256Sha256RsaPss:
-			if userIdentityToken.EncryptionAlgorithm != ua.RsaOaepSha256KeyWrap {
-				ch.Write(
-					&ua.ServiceFault{
-						ResponseHeader: ua.ResponseHeader{
-							Timestamp:     time.Now(),
-							RequestHandle: req.RequestHandle,
-							ServiceResult: ua.BadIdentityTokenInvalid,
-						},
-					},
-					requestid,
-				)
-				return nil
-			}
-			plainBuf := buffer.NewPartitionAt(bufferPool)
-			cipherBuf := buffer.NewPartitionAt(bufferPool)
-			cipherBuf.Write(cipherBytes)
-			cipherText := make([]byte, int32(len(srv.localPrivateKey.D.Bytes())))
-			for cipherBuf.Len() > 0 {
-				cipherBuf.Read(cipherText)
-				// decrypt with local private key.
-				plainText, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, srv.localPrivateKey, cipherText, []byte{})
-				if err != nil {
-					return err
-				}
-				plainBuf.Write(plainText)
-			}
-			plainLength := uint32(0)
-			if plainBuf.Len() > 0 {
-				binary.Read(plainBuf, binary.LittleEndian, &plainLength)
-			}
-			if plainLength < 32 || plainLength > 96 {
-				ch.Write(
-					&ua.ServiceFault{
-						ResponseHeader: ua.ResponseHeader{
-							Timestamp:     time.Now(),
-							RequestHandle: req.RequestHandle,
-							ServiceResult: ua.BadIdentityTokenRejected,
-						},
-					},
-					requestid,
-				)
+		case ua.SecurityPolicyURIBasic128Rsa15, ua.SecurityPolicyURIBasic256, ua.SecurityPolicyURIBasic256Sha256, ua.SecurityPolicyURIAes128Sha256RsaOaep, ua.SecurityPolicyURIAes256Sha256RsaPss:
+			passwordBytes, status := srv.decryptTokenSecret(ch.localPrivateKey, secPolicyURI, userIdentityToken.EncryptionAlgorithm, cipherBytes, []byte(session.SessionNonce()))
+			if status != ua.Good {
+				srv.rejectActivateSession(ch, requestid, req, session, userIdentity, status)
 				return nil
 			}
-			passwordBytes := make([]byte, plainLength-32)
-			plainBuf.Read(passwordBytes)
-			cipherBuf.Reset()
-			plainBuf.Reset()
 			userIdentity = ua.UserNameIdentity{UserName: userIdentityToken.UserName, Password: string(passwordBytes)}
 
 		default:
@@ -639,6 +464,7 @@ func (srv *Server) handleActivateSession(ch *serverSecureChannel, requestid uint
 		}
 
 	case ua.AnonymousIdentityToken:
+		userIdentity = ua.AnonymousIdentity{}
 		var tokenPolicy *ua.UserTokenPolicy
 		for _, t := range ch.LocalEndpoint().UserIdentityTokens {
 			if t.TokenType == ua.UserTokenTypeAnonymous && t.PolicyID == userIdentityToken.PolicyID {
@@ -647,16 +473,7 @@ func (srv *Server) handleActivateSession(ch *serverSecureChannel, requestid uint
 			}
 		}
 		if tokenPolicy == nil {
-			ch.Write(
-				&ua.ServiceFault{
-					ResponseHeader: ua.ResponseHeader{
-						Timestamp:     time.Now(),
-						RequestHandle: req.RequestHandle,
-						ServiceResult: ua.BadIdentityTokenInvalid,
-					},
-				},
-				requestid,
-			)
+			srv.rejectActivateSession(ch, requestid, req, session, userIdentity, ua.BadIdentityTokenInvalid)
 			return nil
 		}
 		userIdentity = ua.AnonymousIdentity{}
@@ -664,6 +481,7 @@ func (srv *Server) handleActivateSession(ch *serverSecureChannel, requestid uint
 	}
 
 	// authenticate user
+	var claims map[string]interface{}
 	switch id := userIdentity.(type) {
 	case ua.AnonymousIdentity:
 		if srv.allowAnonymousIdentity {
@@ -682,12 +500,18 @@ func (srv *Server) handleActivateSession(ch *serverSecureChannel, requestid uint
 	case ua.X509Identity:
 		if auth := srv.x509IdentityAuthenticator; auth != nil {
 			err = auth.AuthenticateX509Identity(id, ch.remoteApplicationURI, ch.localEndpoint.EndpointURL)
+		} else if srv.userCertificateValidator != nil {
+			// the certificate is trusted by the validator.
+			err = nil
 		} else {
 			err = ua.BadUserAccessDenied
 		}
 
 	case ua.IssuedIdentity:
-		if auth := srv.issuedIdentityAuthenticator; auth != nil {
+		if auth, ok := srv.issuedIdentityAuthenticator.(*JWTAuthenticator); ok {
+			// only the claims of a verified token are used to grant roles.
+			claims, err = auth.verify(id)
+		} else if auth := srv.issuedIdentityAuthenticator; auth != nil {
 			err = auth.AuthenticateIssuedIdentity(id, ch.remoteApplicationURI, ch.localEndpoint.EndpointURL)
 		} else {
 			err = ua.BadUserAccessDenied
@@ -698,12 +522,22 @@ func (srv *Server) handleActivateSession(ch *serverSecureChannel, requestid uint
 
 	}
 	if err != nil {
+		status, ok := err.(ua.StatusCode)
+		if !ok {
+			status = ua.BadUserAccessDenied
+		}
+		srv.auditActivateSession(session, req, userIdentity, status)
+		ch.logger.Warn("Rejected session activation", ua.SessionIDAttr(session.sessionId), slog.String("user", clientUserID(userIdentity)), ua.StatusCodeAttr(status))
+		// the authenticator may reject a token, else the user is denied.
+		if status != ua.BadIdentityTokenInvalid && status != ua.BadIdentityTokenRejected {
+			status = ua.BadUserAccessDenied
+		}
 		ch.Write(
 			&ua.ServiceFault{
 				ResponseHeader: ua.ResponseHeader{
 					Timestamp:     time.Now(),
 					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadUserAccessDenied,
+					ServiceResult: status,
 				},
 			},
 			requestid,
@@ -712,26 +546,26 @@ func (srv *Server) handleActivateSession(ch *serverSecureChannel, requestid uint
 	}
 
 	// get roles
-	userRoles, err := srv.rolesProvider.GetRoles(userIdentity, ch.remoteApplicationURI, ch.localEndpoint.EndpointURL)
+	var userRoles []ua.NodeID
+	if p, ok := srv.rolesProvider.(claimsRolesProvider); ok {
+		userRoles, err = p.getRoles(userIdentity, claims, ch.remoteApplicationURI, ch.localEndpoint.EndpointURL)
+	} else {
+		userRoles, err = srv.rolesProvider.GetRoles(userIdentity, ch.remoteApplicationURI, ch.localEndpoint.EndpointURL)
+	}
 	if err != nil {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadUserAccessDenied,
-				},
-			},
-			requestid,
-		)
+		srv.rejectActivateSession(ch, requestid, req, session, userIdentity, ua.BadUserAccessDenied)
 		return nil
 	}
 
 	session.SetUserIdentity(userIdentity)
+	session.setClaims(claims)
 	session.SetUserRoles(userRoles)
 	session.SetSessionNonce(ua.ByteString(getNextNonce(nonceLength)))
 	session.SetSecureChannelId(ch.ChannelID())
-	session.localeIds = req.LocaleIDs
+	session.SetLocaleIDs(req.LocaleIDs)
+	srv.raiseSessionEvent(LifecycleEventSessionActivated, session)
+	srv.auditActivateSession(session, req, userIdentity, ua.Good)
+	ch.logger.Info("Activated session", ua.SessionIDAttr(session.sessionId), slog.String("user", clientUserID(userIdentity)))
 
 	ch.Write(
 		&ua.ActivateSessionResponse{
@@ -748,6 +582,73 @@ func (srv *Server) handleActivateSession(ch *serverSecureChannel, requestid uint
 	return nil
 }
 
+// rejectActivateSession raises the audit event of the rejected ActivateSession request, logs the
+// rejection and returns the status to the client.
+func (srv *Server) rejectActivateSession(ch *serverSecureChannel, requestid uint32, req *ua.ActivateSessionRequest, session *Session, userIdentity interface{}, status ua.StatusCode) {
+	srv.auditActivateSession(session, req, userIdentity, status)
+	ch.logger.Warn("Rejected session activation", ua.SessionIDAttr(session.sessionId), slog.String("user", clientUserID(userIdentity)), ua.StatusCodeAttr(status))
+	ch.Write(
+		&ua.ServiceFault{
+			ResponseHeader: ua.ResponseHeader{
+				Timestamp:     time.Now(),
+				RequestHandle: req.RequestHandle,
+				ServiceResult: status,
+			},
+		},
+		requestid,
+	)
+}
+
+// decryptTokenSecret decrypts the secret of a UserIdentityToken with the private key of the secure channel.
+// The secret is encrypted with the algorithm of the security policy, and prefixed by the length of
+// the secret and nonce. Returns BadIdentityTokenInvalid if the secret cannot be decrypted, or
+// BadNonceInvalid if it was not encrypted with the given server nonce, e.g. if the token is replayed.
+func (srv *Server) decryptTokenSecret(key *rsa.PrivateKey, secPolicyURI, algorithm string, cipherBytes, nonce []byte) ([]byte, ua.StatusCode) {
+	var decrypt func(cipherText []byte) ([]byte, error)
+	switch {
+	case secPolicyURI == ua.SecurityPolicyURIBasic128Rsa15 && algorithm == ua.RsaV15KeyWrap:
+		decrypt = func(cipherText []byte) ([]byte, error) {
+			return rsa.DecryptPKCS1v15(rand.Reader, key, cipherText)
+		}
+	case (secPolicyURI == ua.SecurityPolicyURIBasic256 || secPolicyURI == ua.SecurityPolicyURIBasic256Sha256 || secPolicyURI == ua.SecurityPolicyURIAes128Sha256RsaOaep) && algorithm == ua.RsaOaepKeyWrap:
+		decrypt = func(cipherText []byte) ([]byte, error) {
+			return rsa.DecryptOAEP(sha1.New(), rand.Reader, key, cipherText, []byte{})
+		}
+	case secPolicyURI == ua.SecurityPolicyURIAes256Sha256RsaPss && algorithm == ua.RsaOaepSha256KeyWrap:
+		decrypt = func(cipherText []byte) ([]byte, error) {
+			return rsa.DecryptOAEP(sha256.New(), rand.Reader, key, cipherText, []byte{})
+		}
+	default:
+		return nil, ua.BadIdentityTokenInvalid
+	}
+	size := key.Size()
+	if len(cipherBytes)%size != 0 {
+		return nil, ua.BadIdentityTokenInvalid
+	}
+	plainBytes := []byte{}
+	for i := 0; i < len(cipherBytes); i += size {
+		plainText, err := decrypt(cipherBytes[i : i+size])
+		if err != nil {
+			return nil, ua.BadIdentityTokenInvalid
+		}
+		plainBytes = append(plainBytes, plainText...)
+	}
+	if len(plainBytes) < 4 {
+		return nil, ua.BadIdentityTokenInvalid
+	}
+	// the last block may be padded.
+	plainLength := int(binary.LittleEndian.Uint32(plainBytes))
+	if plainLength < len(nonce) || plainLength > len(plainBytes)-4 {
+		return nil, ua.BadIdentityTokenInvalid
+	}
+	secret := plainBytes[4 : 4+plainLength-len(nonce)]
+	// the secret must be encrypted with the last server nonce, else it is replayed.
+	if !bytes.Equal(plainBytes[4+plainLength-len(nonce):4+plainLength], nonce) {
+		return nil, ua.BadNonceInvalid
+	}
+	return secret, ua.Good
+}
+
 // closeSession closes a session.
 func (srv *Server) handleCloseSession(ch *serverSecureChannel, requestid uint32, req *ua.CloseSessionRequest) error {
 	// discovery only?
@@ -800,19 +701,21 @@ func (srv *Server) handleCloseSession(ch *serverSecureChannel, requestid uint32,
 		return nil
 	}
 
-	// delete subscriptions if requested
-	if req.DeleteSubscriptions {
-		sm := srv.SubscriptionManager()
-		for _, s := range sm.GetBySession(session) {
+	// delete subscriptions if requested, else retain them for transfer to another session.
+	sm := srv.SubscriptionManager()
+	for _, s := range sm.GetBySession(session) {
+		if req.DeleteSubscriptions {
 			sm.Delete(s)
 			s.Delete()
+			continue
 		}
+		s.orphan()
 	}
 
 	// delete session
 	srv.sessionManager.Delete(session)
 
-	// log.Printf("Deleted session '%s'.\n", session.SessionName())
+	ch.logger.Info("Closed session", ua.SessionIDAttr(session.sessionId), slog.Bool("deleteSubscriptions", req.DeleteSubscriptions))
 
 	ch.Write(
 		&ua.CloseSessionResponse{
@@ -878,12 +781,14 @@ func (srv *Server) handleCancel(ch *serverSecureChannel, requestid uint32, req *
 		return nil
 	}
 
+	count := session.cancelRequest(req.RequestHandle)
 	ch.Write(
 		&ua.CancelResponse{
 			ResponseHeader: ua.ResponseHeader{
 				Timestamp:     time.Now(),
 				RequestHandle: req.RequestHeader.RequestHandle,
 			},
+			CancelCount: count,
 		},
 		requestid,
 	)
@@ -1004,7 +909,7 @@ func (srv *Server) handleBrowse(ch *serverSecureChannel, requestid uint32, req *
 		return nil
 	}
 	// check too many operations
-	if l > int(srv.serverCapabilities.OperationLimits.MaxNodesPerBrowse) {
+	if exceedsOperationLimit(l, srv.serverCapabilities.OperationLimits.MaxNodesPerBrowse) {
 		ch.Write(
 			&ua.ServiceFault{
 				ResponseHeader: ua.ResponseHeader{
@@ -1022,6 +927,7 @@ func (srv *Server) handleBrowse(ch *serverSecureChannel, requestid uint32, req *
 	results := make([]ua.BrowseResult, l)
 	ctx := context.Background()
 	ctx = context.WithValue(ctx, SessionKey, session)
+	ctx, done := session.beginRequest(ctx, req.RequestHandle)
 
 	// handle requests in parallel using server thread pool.
 	wp := srv.WorkerPool()
@@ -1031,6 +937,10 @@ func (srv *Server) handleBrowse(ch *serverSecureChannel, requestid uint32, req *
 	for ii := 0; ii < l; ii++ {
 		i := ii
 		wp.Submit(func() {
+			if ctx.Err() != nil {
+				wg.Done()
+				return
+			}
 			d := req.NodesToBrowse[i]
 			if d.BrowseDirection < ua.BrowseDirectionForward || d.BrowseDirection > ua.BrowseDirectionBoth {
 				results[i] = ua.BrowseResult{StatusCode: ua.BadBrowseDirectionInvalid}
@@ -1038,7 +948,7 @@ func (srv *Server) handleBrowse(ch *serverSecureChannel, requestid uint32, req *
 				return
 			}
 			m := srv.NamespaceManager()
-			node, ok := m.FindNode(d.NodeID)
+			node, ok := srv.findNode(ctx, d.NodeID)
 			if !ok {
 				results[i] = ua.BrowseResult{StatusCode: ua.BadNodeIDUnknown}
 				wg.Done()
@@ -1050,11 +960,8 @@ func (srv *Server) handleBrowse(ch *serverSecureChannel, requestid uint32, req *
 				wg.Done()
 				return
 			}
-			both := d.BrowseDirection == ua.BrowseDirectionBoth
-			isInverse := d.BrowseDirection == ua.BrowseDirectionInverse
-			allTypes := d.ReferenceTypeID == nil
 			allClasses := d.NodeClassMask == 0
-			if !allTypes {
+			if d.ReferenceTypeID != nil {
 				rt, ok := m.FindNode(d.ReferenceTypeID)
 				if !ok {
 					results[i] = ua.BrowseResult{StatusCode: ua.BadReferenceTypeIDInvalid}
@@ -1067,15 +974,9 @@ func (srv *Server) handleBrowse(ch *serverSecureChannel, requestid uint32, req *
 					return
 				}
 			}
-			refs := node.References()
+			refs := m.FilterReferences(node, d.ReferenceTypeID, d.IncludeSubtypes, d.BrowseDirection, 0)
 			rds := make([]ua.ReferenceDescription, 0, len(refs))
 			for _, r := range refs {
-				if !(both || r.IsInverse == isInverse) {
-					continue
-				}
-				if !(allTypes || d.ReferenceTypeID == r.ReferenceTypeID || (d.IncludeSubtypes && m.IsSubtype(r.ReferenceTypeID, d.ReferenceTypeID))) {
-					continue
-				}
 				t, ok := m.FindNode(ua.ToNodeID(r.TargetID, srv.NamespaceUris()))
 				if !ok {
 					results[i] = ua.BrowseResult{StatusCode: ua.BadNodeIDUnknown}
@@ -1107,7 +1008,7 @@ func (srv *Server) handleBrowse(ch *serverSecureChannel, requestid uint32, req *
 				}
 				dn := ua.LocalizedText{}
 				if d.ResultMask&uint32(ua.BrowseResultMaskDisplayName) != 0 {
-					dn = t.DisplayName()
+					dn = srv.translate(t.DisplayName(), session.LocaleIDs())
 				}
 				var td ua.ExpandedNodeID
 				if d.ResultMask&uint32(ua.BrowseResultMaskTypeDefinition) != 0 {
@@ -1156,9 +1057,23 @@ func (srv *Server) handleBrowse(ch *serverSecureChannel, requestid uint32, req *
 		})
 	}
 
-	go func() {
+	srv.goSession(func() {
 		// wait until all tasks are done
 		wg.Wait()
+		defer done()
+		if ctx.Err() != nil {
+			ch.Write(
+				&ua.ServiceFault{
+					ResponseHeader: ua.ResponseHeader{
+						Timestamp:     time.Now(),
+						RequestHandle: req.RequestHandle,
+						ServiceResult: ua.BadRequestCancelledByClient,
+					},
+				},
+				requestid,
+			)
+			return
+		}
 		ch.Write(
 			&ua.BrowseResponse{
 				ResponseHeader: ua.ResponseHeader{
@@ -1169,7 +1084,7 @@ func (srv *Server) handleBrowse(ch *serverSecureChannel, requestid uint32, req *
 			},
 			requestid,
 		)
-	}()
+	})
 	return nil
 }
 
@@ -1247,7 +1162,7 @@ func (srv *Server) handleBrowseNext(ch *serverSecureChannel, requestid uint32, r
 		return nil
 	}
 	// check too many operations
-	if l > int(srv.serverCapabilities.OperationLimits.MaxNodesPerBrowse) {
+	if exceedsOperationLimit(l, srv.serverCapabilities.OperationLimits.MaxNodesPerBrowse) {
 		ch.Write(
 			&ua.ServiceFault{
 				ResponseHeader: ua.ResponseHeader{
@@ -1318,7 +1233,7 @@ func (srv *Server) handleBrowseNext(ch *serverSecureChannel, requestid uint32, r
 		})
 	}
 
-	go func() {
+	srv.goSession(func() {
 		// wait until all tasks are done
 		wg.Wait()
 		ch.Write(
@@ -1331,7 +1246,7 @@ func (srv *Server) handleBrowseNext(ch *serverSecureChannel, requestid uint32, r
 			},
 			requestid,
 		)
-	}()
+	})
 	return nil
 }
 
@@ -1409,7 +1324,7 @@ func (srv *Server) handleTranslateBrowsePathsToNodeIds(ch *serverSecureChannel,
 		return nil
 	}
 	// check too many operations
-	if l > int(srv.serverCapabilities.OperationLimits.MaxNodesPerTranslateBrowsePathsToNodeIds) {
+	if exceedsOperationLimit(l, srv.serverCapabilities.OperationLimits.MaxNodesPerTranslateBrowsePathsToNodeIds) {
 		ch.Write(
 			&ua.ServiceFault{
 				ResponseHeader: ua.ResponseHeader{
@@ -1425,6 +1340,8 @@ func (srv *Server) handleTranslateBrowsePathsToNodeIds(ch *serverSecureChannel,
 		return nil
 	}
 	results := make([]ua.BrowsePathResult, l)
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, SessionKey, session)
 
 	// handle requests in parallel using server thread pool.
 	wp := srv.WorkerPool()
@@ -1440,45 +1357,26 @@ func (srv *Server) handleTranslateBrowsePathsToNodeIds(ch *serverSecureChannel,
 				wg.Done()
 				return
 			}
-			for _, element := range d.RelativePath.Elements {
+			// only the last element may have an empty TargetName.
+			for _, element := range d.RelativePath.Elements[:len(d.RelativePath.Elements)-1] {
 				if element.TargetName.Name == "" {
 					results[i] = ua.BrowsePathResult{StatusCode: ua.BadBrowseNameInvalid, Targets: []ua.BrowsePathTarget{}}
 					wg.Done()
 					return
 				}
 			}
-			targets, err1 := srv.follow(d.StartingNode, d.RelativePath.Elements)
-			if err1 == ua.BadNodeIDUnknown {
-				results[i] = ua.BrowsePathResult{StatusCode: ua.BadNodeIDUnknown, Targets: []ua.BrowsePathTarget{}}
-				wg.Done()
-				return
-			}
-			if err1 == ua.BadNothingToDo {
-				results[i] = ua.BrowsePathResult{StatusCode: ua.BadNothingToDo, Targets: []ua.BrowsePathTarget{}}
-				wg.Done()
-				return
-			}
-			if err1 == ua.BadNoMatch {
-				results[i] = ua.BrowsePathResult{StatusCode: ua.BadNoMatch, Targets: []ua.BrowsePathTarget{}}
+			targets, err1 := srv.follow(ctx, d.StartingNode, d.RelativePath.Elements)
+			if err1 != nil {
+				results[i] = ua.BrowsePathResult{StatusCode: err1.(ua.StatusCode), Targets: []ua.BrowsePathTarget{}}
 				wg.Done()
 				return
 			}
-			if targets != nil {
-				if len(targets) > 0 {
-					results[i] = ua.BrowsePathResult{StatusCode: ua.Good, Targets: targets}
-					wg.Done()
-					return
-				}
-				results[i] = ua.BrowsePathResult{StatusCode: ua.BadNoMatch, Targets: targets}
-				wg.Done()
-				return
-			}
-			results[i] = ua.BrowsePathResult{StatusCode: ua.BadNoMatch, Targets: []ua.BrowsePathTarget{}}
+			results[i] = ua.BrowsePathResult{StatusCode: ua.Good, Targets: targets}
 			wg.Done()
 		})
 	}
 
-	go func() {
+	srv.goSession(func() {
 		// wait until all tasks are done
 		wg.Wait()
 		ch.Write(
@@ -1491,7 +1389,7 @@ func (srv *Server) handleTranslateBrowsePathsToNodeIds(ch *serverSecureChannel,
 			},
 			requestid,
 		)
-	}()
+	})
 	return nil
 }
 
@@ -1569,7 +1467,7 @@ func (srv *Server) handleRegisterNodes(ch *serverSecureChannel, requestid uint32
 		return nil
 	}
 	// check too many operations
-	if l > int(srv.serverCapabilities.OperationLimits.MaxNodesPerRegisterNodes) {
+	if exceedsOperationLimit(l, srv.serverCapabilities.OperationLimits.MaxNodesPerRegisterNodes) {
 		ch.Write(
 			&ua.ServiceFault{
 				ResponseHeader: ua.ResponseHeader{
@@ -1585,9 +1483,16 @@ func (srv *Server) handleRegisterNodes(ch *serverSecureChannel, requestid uint32
 		return nil
 	}
 	results := make([]ua.NodeID, l)
-
+	m := srv.NamespaceManager()
+	// read the removal count before the nodes are found, so a node removed meanwhile is found again.
+	removals := m.removalCount()
 	for ii := 0; ii < l; ii++ {
-		results[ii] = req.NodesToRegister[ii]
+		// return unknown nodes unchanged, the services that use them will report BadNodeIDUnknown.
+		if n, ok := m.FindNode(req.NodesToRegister[ii]); ok {
+			results[ii] = session.registerNode(n, removals)
+		} else {
+			results[ii] = req.NodesToRegister[ii]
+		}
 	}
 
 	ch.Write(
@@ -1596,14 +1501,818 @@ func (srv *Server) handleRegisterNodes(ch *serverSecureChannel, requestid uint32
 				Timestamp:     time.Now(),
 				RequestHandle: req.RequestHeader.RequestHandle,
 			},
-			RegisteredNodeIDs: results,
-		},
-		requestid,
-	)
+			RegisteredNodeIDs: results,
+		},
+		requestid,
+	)
+	return nil
+}
+
+func (srv *Server) handleUnregisterNodes(ch *serverSecureChannel, requestid uint32, req *ua.UnregisterNodesRequest) error {
+	// discovery only?
+	if ch.discoveryOnly {
+		ch.Abort(ua.BadSecurityPolicyRejected, "")
+		return nil
+	}
+	// get session
+	session, ok := srv.SessionManager().Get(req.AuthenticationToken)
+	if !ok {
+		ch.Write(
+			&ua.ServiceFault{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadSessionIDInvalid,
+				},
+			},
+			requestid,
+		)
+		return nil
+	}
+	session.unregisterNodesCount++
+	session.requestCount++
+	// check channelId
+	id := session.SecureChannelId()
+	if id == 0 {
+		srv.SessionManager().Delete(session)
+		ch.Write(
+			&ua.ServiceFault{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadSessionNotActivated,
+				},
+			},
+			requestid,
+		)
+		session.unregisterNodesErrorCount++
+		session.errorCount++
+		return nil
+	}
+	if id != ch.ChannelID() {
+		ch.Write(
+			&ua.ServiceFault{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadSecureChannelIDInvalid,
+				},
+			},
+			requestid,
+		)
+		session.unregisterNodesErrorCount++
+		session.errorCount++
+		return nil
+	}
+
+	l := len(req.NodesToUnregister)
+	if l == 0 {
+		ch.Write(
+			&ua.ServiceFault{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadNothingToDo,
+				},
+			},
+			requestid,
+		)
+		session.unregisterNodesErrorCount++
+		session.errorCount++
+		return nil
+	}
+	// check too many operations
+	if exceedsOperationLimit(l, srv.serverCapabilities.OperationLimits.MaxNodesPerRegisterNodes) {
+		ch.Write(
+			&ua.ServiceFault{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadTooManyOperations,
+				},
+			},
+			requestid,
+		)
+		session.unregisterNodesErrorCount++
+		session.errorCount++
+		return nil
+	}
+	for _, id := range req.NodesToUnregister {
+		session.unregisterNode(id)
+	}
+
+	ch.Write(
+		&ua.UnregisterNodesResponse{
+			ResponseHeader: ua.ResponseHeader{
+				Timestamp:     time.Now(),
+				RequestHandle: req.RequestHeader.RequestHandle,
+			},
+		},
+		requestid,
+	)
+	return nil
+}
+
+// findNode returns the node with the given NodeID, which may be a NodeID returned by RegisterNodes
+// to the session of the context. A registered node that was deleted is not found, and one that was
+// replaced resolves to the node that currently has its NodeID.
+func (srv *Server) findNode(ctx context.Context, id ua.NodeID) (Node, bool) {
+	if session, ok := ctx.Value(SessionKey).(*Session); ok && session != nil {
+		if n, ok := session.registeredNode(id); ok {
+			return n, n != nil
+		}
+	}
+	return srv.NamespaceManager().FindNode(id)
+}
+
+// resolveNodeID returns the NodeID of the node registered for a NodeID returned by RegisterNodes to
+// the session of the context, or the NodeID unchanged.
+func (srv *Server) resolveNodeID(ctx context.Context, id ua.NodeID) ua.NodeID {
+	if session, ok := ctx.Value(SessionKey).(*Session); ok && session != nil {
+		if n, ok := session.registeredNode(id); ok && n != nil {
+			return n.NodeID()
+		}
+	}
+	return id
+}
+
+func (srv *Server) handleAddNodes(ch *serverSecureChannel, requestid uint32, req *ua.AddNodesRequest) error {
+	// discovery only?
+	if ch.discoveryOnly {
+		ch.Abort(ua.BadSecurityPolicyRejected, "")
+		return nil
+	}
+	// get session
+	session, ok := srv.SessionManager().Get(req.AuthenticationToken)
+	if !ok {
+		ch.Write(
+			&ua.ServiceFault{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadSessionIDInvalid,
+				},
+			},
+			requestid,
+		)
+		return nil
+	}
+	session.addNodesCount++
+	session.requestCount++
+	// check channelId
+	id := session.SecureChannelId()
+	if id == 0 {
+		srv.SessionManager().Delete(session)
+		ch.Write(
+			&ua.ServiceFault{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadSessionNotActivated,
+				},
+			},
+			requestid,
+		)
+		session.addNodesErrorCount++
+		session.errorCount++
+		return nil
+	}
+	if id != ch.ChannelID() {
+		ch.Write(
+			&ua.ServiceFault{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadSecureChannelIDInvalid,
+				},
+			},
+			requestid,
+		)
+		session.addNodesErrorCount++
+		session.errorCount++
+		return nil
+	}
+
+	l := len(req.NodesToAdd)
+	if l == 0 {
+		ch.Write(
+			&ua.ServiceFault{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadNothingToDo,
+				},
+			},
+			requestid,
+		)
+		session.addNodesErrorCount++
+		session.errorCount++
+		return nil
+	}
+	// check too many operations
+	if exceedsOperationLimit(l, srv.serverCapabilities.OperationLimits.MaxNodesPerNodeManagement) {
+		ch.Write(
+			&ua.ServiceFault{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadTooManyOperations,
+				},
+			},
+			requestid,
+		)
+		session.addNodesErrorCount++
+		session.errorCount++
+		return nil
+	}
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, SessionKey, session)
+
+	// handle requests in order, so an item may add a child of a node added by a previous item.
+	results := make([]ua.AddNodesResult, l)
+	for i, item := range req.NodesToAdd {
+		results[i] = srv.addNode(ctx, item)
+	}
+
+	ch.Write(
+		&ua.AddNodesResponse{
+			ResponseHeader: ua.ResponseHeader{
+				Timestamp:     time.Now(),
+				RequestHandle: req.RequestHeader.RequestHandle,
+			},
+			Results: results,
+		},
+		requestid,
+	)
+	return nil
+}
+
+// addNode creates an object, variable or method node from the item and adds it to the namespace,
+// with a reference of the requested type from the parent node.
+func (srv *Server) addNode(ctx context.Context, item ua.AddNodesItem) ua.AddNodesResult {
+	m := srv.NamespaceManager()
+	uris := srv.NamespaceUris()
+	if item.ParentNodeID.ServerIndex != 0 {
+		return ua.AddNodesResult{StatusCode: ua.BadParentNodeIDInvalid}
+	}
+	parent, ok := m.FindNode(ua.ToNodeID(item.ParentNodeID, uris))
+	if !ok {
+		return ua.AddNodesResult{StatusCode: ua.BadParentNodeIDInvalid}
+	}
+	rp := parent.UserRolePermissions(ctx)
+	if !IsUserPermitted(rp, ua.PermissionTypeBrowse) {
+		return ua.AddNodesResult{StatusCode: ua.BadParentNodeIDInvalid}
+	}
+	if !IsUserPermitted(rp, ua.PermissionTypeAddNode) {
+		return ua.AddNodesResult{StatusCode: ua.BadUserAccessDenied}
+	}
+	if item.ReferenceTypeID == nil || !m.IsSubtype(item.ReferenceTypeID, ua.ReferenceTypeIDHierarchicalReferences) {
+		return ua.AddNodesResult{StatusCode: ua.BadReferenceTypeIDInvalid}
+	}
+	if item.BrowseName.Name == "" {
+		return ua.AddNodesResult{StatusCode: ua.BadBrowseNameInvalid}
+	}
+	// use the requested NodeID, else a new GUID in the parent's namespace.
+	var id ua.NodeID
+	if item.RequestedNewNodeID.NodeID != nil {
+		if item.RequestedNewNodeID.ServerIndex != 0 {
+			return ua.AddNodesResult{StatusCode: ua.BadNodeIDRejected}
+		}
+		id = ua.ToNodeID(item.RequestedNewNodeID, uris)
+		if id == nil {
+			return ua.AddNodesResult{StatusCode: ua.BadNodeIDRejected}
+		}
+		if _, ok := m.FindNode(id); ok {
+			return ua.AddNodesResult{StatusCode: ua.BadNodeIDExists}
+		}
+	} else {
+		ns := uint16(0)
+		switch pid := parent.NodeID().(type) {
+		case ua.NodeIDNumeric:
+			ns = pid.NamespaceIndex
+		case ua.NodeIDString:
+			ns = pid.NamespaceIndex
+		case ua.NodeIDGUID:
+			ns = pid.NamespaceIndex
+		case ua.NodeIDOpaque:
+			ns = pid.NamespaceIndex
+		}
+		if ns == 0 {
+			return ua.AddNodesResult{StatusCode: ua.BadNodeIDRejected}
+		}
+		id = ua.NewNodeIDGUID(ns, uuid.New())
+	}
+	// objects and variables require a type definition; methods have none.
+	var typeDefinitionID ua.NodeID
+	switch item.NodeClass {
+	case ua.NodeClassObject, ua.NodeClassVariable:
+		if item.TypeDefinition.NodeID == nil || item.TypeDefinition.ServerIndex != 0 {
+			return ua.AddNodesResult{StatusCode: ua.BadTypeDefinitionInvalid}
+		}
+		typeDefinitionID = ua.ToNodeID(item.TypeDefinition, uris)
+		t, ok := m.FindNode(typeDefinitionID)
+		if !ok {
+			return ua.AddNodesResult{StatusCode: ua.BadTypeDefinitionInvalid}
+		}
+		if (item.NodeClass == ua.NodeClassObject && t.NodeClass() != ua.NodeClassObjectType) ||
+			(item.NodeClass == ua.NodeClassVariable && t.NodeClass() != ua.NodeClassVariableType) {
+			return ua.AddNodesResult{StatusCode: ua.BadTypeDefinitionInvalid}
+		}
+	case ua.NodeClassMethod:
+		if item.TypeDefinition.NodeID != nil {
+			return ua.AddNodesResult{StatusCode: ua.BadTypeDefinitionInvalid}
+		}
+	default:
+		return ua.AddNodesResult{StatusCode: ua.BadNodeClassInvalid}
+	}
+	refs := []ua.Reference{ua.NewReference(item.ReferenceTypeID, true, ua.NewExpandedNodeID(parent.NodeID()))}
+	if typeDefinitionID != nil {
+		refs = append(refs, ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(typeDefinitionID)))
+	}
+	// the new node has the same role permissions as the parent.
+	rolePermissions := parent.RolePermissions()
+	displayName := ua.NewLocalizedText(item.BrowseName.Name, "")
+	description := ua.NewLocalizedText("", "")
+	var node Node
+	switch item.NodeClass {
+	case ua.NodeClassObject:
+		attrs, ok := item.NodeAttributes.(ua.ObjectAttributes)
+		if !ok {
+			return ua.AddNodesResult{StatusCode: ua.BadNodeAttributesInvalid}
+		}
+		if attrs.SpecifiedAttributes&uint32(ua.NodeAttributesMaskDisplayName) != 0 {
+			displayName = attrs.DisplayName
+		}
+		if attrs.SpecifiedAttributes&uint32(ua.NodeAttributesMaskDescription) != 0 {
+			description = attrs.Description
+		}
+		node = NewObjectNode(id, item.BrowseName, displayName, description, rolePermissions, refs, attrs.EventNotifier)
+	case ua.NodeClassVariable:
+		attrs, ok := item.NodeAttributes.(ua.VariableAttributes)
+		if !ok {
+			return ua.AddNodesResult{StatusCode: ua.BadNodeAttributesInvalid}
+		}
+		if attrs.SpecifiedAttributes&uint32(ua.NodeAttributesMaskDisplayName) != 0 {
+			displayName = attrs.DisplayName
+		}
+		if attrs.SpecifiedAttributes&uint32(ua.NodeAttributesMaskDescription) != 0 {
+			description = attrs.Description
+		}
+		dataType := ua.DataTypeIDBaseDataType
+		if attrs.SpecifiedAttributes&uint32(ua.NodeAttributesMaskDataType) != 0 && attrs.DataType != nil {
+			if _, ok := m.FindNode(attrs.DataType); !ok {
+				return ua.AddNodesResult{StatusCode: ua.BadNodeAttributesInvalid}
+			}
+			dataType = attrs.DataType
+		}
+		valueRank := ua.ValueRankAny
+		if attrs.SpecifiedAttributes&uint32(ua.NodeAttributesMaskValueRank) != 0 {
+			valueRank = attrs.ValueRank
+		}
+		arrayDimensions := []uint32{}
+		if attrs.SpecifiedAttributes&uint32(ua.NodeAttributesMaskArrayDimensions) != 0 && attrs.ArrayDimensions != nil {
+			arrayDimensions = attrs.ArrayDimensions
+		}
+		accessLevel := ua.AccessLevelsCurrentRead
+		if attrs.SpecifiedAttributes&uint32(ua.NodeAttributesMaskAccessLevel) != 0 {
+			accessLevel = attrs.AccessLevel
+		}
+		var value interface{}
+		if attrs.SpecifiedAttributes&uint32(ua.NodeAttributesMaskValue) != 0 {
+			value = attrs.Value
+		}
+		n1 := NewVariableNode(id, item.BrowseName, displayName, description, rolePermissions, refs,
+			ua.NewDataValue(value, 0, time.Now(), 0, time.Now(), 0),
+			dataType, valueRank, arrayDimensions, accessLevel, attrs.MinimumSamplingInterval, false, nil)
+		if attrs.SpecifiedAttributes&uint32(ua.NodeAttributesMaskWriteMask) != 0 {
+			n1.SetWriteMask(attrs.WriteMask)
+		}
+		node = n1
+	case ua.NodeClassMethod:
+		attrs, ok := item.NodeAttributes.(ua.MethodAttributes)
+		if !ok {
+			return ua.AddNodesResult{StatusCode: ua.BadNodeAttributesInvalid}
+		}
+		if attrs.SpecifiedAttributes&uint32(ua.NodeAttributesMaskDisplayName) != 0 {
+			displayName = attrs.DisplayName
+		}
+		if attrs.SpecifiedAttributes&uint32(ua.NodeAttributesMaskDescription) != 0 {
+			description = attrs.Description
+		}
+		node = NewMethodNode(id, item.BrowseName, displayName, description, rolePermissions, refs, attrs.Executable)
+	}
+	if err := m.AddNode(node); err != nil {
+		if code, ok := err.(ua.StatusCode); ok {
+			return ua.AddNodesResult{StatusCode: code}
+		}
+		return ua.AddNodesResult{StatusCode: ua.BadInternalError}
+	}
+	return ua.AddNodesResult{StatusCode: ua.Good, AddedNodeID: id}
+}
+
+func (srv *Server) handleDeleteNodes(ch *serverSecureChannel, requestid uint32, req *ua.DeleteNodesRequest) error {
+	// discovery only?
+	if ch.discoveryOnly {
+		ch.Abort(ua.BadSecurityPolicyRejected, "")
+		return nil
+	}
+	// get session
+	session, ok := srv.SessionManager().Get(req.AuthenticationToken)
+	if !ok {
+		ch.Write(
+			&ua.ServiceFault{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadSessionIDInvalid,
+				},
+			},
+			requestid,
+		)
+		return nil
+	}
+	session.deleteNodesCount++
+	session.requestCount++
+	// check channelId
+	id := session.SecureChannelId()
+	if id == 0 {
+		srv.SessionManager().Delete(session)
+		ch.Write(
+			&ua.ServiceFault{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadSessionNotActivated,
+				},
+			},
+			requestid,
+		)
+		session.deleteNodesErrorCount++
+		session.errorCount++
+		return nil
+	}
+	if id != ch.ChannelID() {
+		ch.Write(
+			&ua.ServiceFault{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadSecureChannelIDInvalid,
+				},
+			},
+			requestid,
+		)
+		session.deleteNodesErrorCount++
+		session.errorCount++
+		return nil
+	}
+
+	l := len(req.NodesToDelete)
+	if l == 0 {
+		ch.Write(
+			&ua.ServiceFault{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadNothingToDo,
+				},
+			},
+			requestid,
+		)
+		session.deleteNodesErrorCount++
+		session.errorCount++
+		return nil
+	}
+	// check too many operations
+	if exceedsOperationLimit(l, srv.serverCapabilities.OperationLimits.MaxNodesPerNodeManagement) {
+		ch.Write(
+			&ua.ServiceFault{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadTooManyOperations,
+				},
+			},
+			requestid,
+		)
+		session.deleteNodesErrorCount++
+		session.errorCount++
+		return nil
+	}
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, SessionKey, session)
+
+	m := srv.NamespaceManager()
+	results := make([]ua.StatusCode, l)
+	for i, item := range req.NodesToDelete {
+		n, ok := m.FindNode(item.NodeID)
+		if !ok {
+			results[i] = ua.BadNodeIDUnknown
+			continue
+		}
+		rp := n.UserRolePermissions(ctx)
+		if !IsUserPermitted(rp, ua.PermissionTypeBrowse) {
+			results[i] = ua.BadNodeIDUnknown
+			continue
+		}
+		if !IsUserPermitted(rp, ua.PermissionTypeDeleteNode) {
+			results[i] = ua.BadUserAccessDenied
+			continue
+		}
+		results[i] = m.deleteNodeItem(n, item.DeleteTargetReferences, func(child Node) bool {
+			return IsUserPermitted(child.UserRolePermissions(ctx), ua.PermissionTypeDeleteNode)
+		})
+	}
+
+	ch.Write(
+		&ua.DeleteNodesResponse{
+			ResponseHeader: ua.ResponseHeader{
+				Timestamp:     time.Now(),
+				RequestHandle: req.RequestHeader.RequestHandle,
+			},
+			Results: results,
+		},
+		requestid,
+	)
+	return nil
+}
+
+// maxBrowsePathTargets is the maximum number of targets a BrowsePath may resolve to.
+const maxBrowsePathTargets = 1000
+
+// follow returns the targets of the elements of a relative path from the starting node. Each element is
+// followed from every target of the previous element. A target in another server ends its path, with
+// the RemainingPathIndex of the element whose TargetName was not checked.
+func (srv *Server) follow(ctx context.Context, nodeID ua.NodeID, elements []ua.RelativePathElement) ([]ua.BrowsePathTarget, error) {
+	if len(elements) == 0 {
+		return nil, ua.BadNothingToDo
+	}
+	node, ok := srv.findNode(ctx, nodeID)
+	if !ok || !IsUserPermitted(node.UserRolePermissions(ctx), ua.PermissionTypeBrowse) {
+		return nil, ua.BadNodeIDUnknown
+	}
+	targets := []ua.BrowsePathTarget{}
+	nodes := []Node{node}
+	for i, element := range elements {
+		next := []Node{}
+		visited := map[ua.NodeID]struct{}{}
+		for _, n := range nodes {
+			for _, r := range srv.target(ctx, n, element) {
+				if r.TargetID.ServerIndex != 0 {
+					targets = append(targets, ua.BrowsePathTarget{TargetID: r.TargetID, RemainingPathIndex: uint32(i)})
+					continue
+				}
+				t, ok := srv.NamespaceManager().FindNode(ua.ToNodeID(r.TargetID, srv.NamespaceUris()))
+				if !ok {
+					continue
+				}
+				if _, ok := visited[t.NodeID()]; ok {
+					continue
+				}
+				visited[t.NodeID()] = struct{}{}
+				next = append(next, t)
+			}
+		}
+		if len(targets)+len(next) > maxBrowsePathTargets {
+			return nil, ua.BadTooManyMatches
+		}
+		nodes = next
+	}
+	for _, n := range nodes {
+		targets = append(targets, ua.BrowsePathTarget{TargetID: ua.NewExpandedNodeID(n.NodeID()), RemainingPathIndex: math.MaxUint32})
+	}
+	if len(targets) == 0 {
+		return nil, ua.BadNoMatch
+	}
+	return targets, nil
+}
+
+// target returns the references of the node that match the given RelativePathElement. A null ReferenceTypeID
+// matches references of any type, and an empty TargetName matches targets of any name. References to nodes
+// in another server are returned without checking the TargetName.
+func (srv *Server) target(ctx context.Context, node Node, element ua.RelativePathElement) []ua.Reference {
+	m := srv.NamespaceManager()
+	dir := ua.BrowseDirectionForward
+	if element.IsInverse {
+		dir = ua.BrowseDirectionInverse
+	}
+	refs := m.FilterReferences(node, element.ReferenceTypeID, element.IncludeSubtypes, dir, 0)
+	matches := make([]ua.Reference, 0, len(refs))
+	for _, r := range refs {
+		if r.TargetID.ServerIndex != 0 {
+			matches = append(matches, r)
+			continue
+		}
+		t, ok := m.FindNode(ua.ToNodeID(r.TargetID, srv.NamespaceUris()))
+		if !ok {
+			continue
+		}
+		if !IsUserPermitted(t.UserRolePermissions(ctx), ua.PermissionTypeBrowse) {
+			continue
+		}
+		if element.TargetName.Name != "" && element.TargetName != t.BrowseName() {
+			continue
+		}
+		matches = append(matches, r)
+	}
+	return matches
+}
+
+// maxQueryDataSets is the maximum number of data sets of a QueryFirst or QueryNext response.
+const maxQueryDataSets = 1000
+
+// QueryFirst returns the nodes of the given types that match the filter.
+func (srv *Server) handleQueryFirst(ch *serverSecureChannel, requestid uint32, req *ua.QueryFirstRequest) error {
+	// discovery only?
+	if ch.discoveryOnly {
+		ch.Abort(ua.BadSecurityPolicyRejected, "")
+		return nil
+	}
+	// get session
+	session, ok := srv.SessionManager().Get(req.AuthenticationToken)
+	if !ok {
+		ch.Write(
+			&ua.ServiceFault{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadSessionIDInvalid,
+				},
+			},
+			requestid,
+		)
+		return nil
+	}
+	session.queryFirstCount++
+	session.requestCount++
+	// check channelId
+	id := session.SecureChannelId()
+	if id == 0 {
+		srv.SessionManager().Delete(session)
+		ch.Write(
+			&ua.ServiceFault{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadSessionNotActivated,
+				},
+			},
+			requestid,
+		)
+		session.queryFirstErrorCount++
+		session.errorCount++
+		return nil
+	}
+	if id != ch.ChannelID() {
+		ch.Write(
+			&ua.ServiceFault{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadSecureChannelIDInvalid,
+				},
+			},
+			requestid,
+		)
+		session.queryFirstErrorCount++
+		session.errorCount++
+		return nil
+	}
+
+	// the query searches the whole address space, a view is not supported.
+	if req.View.ViewID != nil {
+		result := ua.BadServiceUnsupported
+		if n, ok := srv.NamespaceManager().FindNode(req.View.ViewID); !ok || n.NodeClass() != ua.NodeClassView {
+			result = ua.BadViewIDUnknown
+		}
+		ch.Write(
+			&ua.ServiceFault{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+					ServiceResult: result,
+				},
+			},
+			requestid,
+		)
+		session.queryFirstErrorCount++
+		session.errorCount++
+		return nil
+	}
+
+	if len(req.NodeTypes) == 0 {
+		ch.Write(
+			&ua.ServiceFault{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadNothingToDo,
+				},
+			},
+			requestid,
+		)
+		session.queryFirstErrorCount++
+		session.errorCount++
+		return nil
+	}
+
+	// check the node types and the filter. The results are returned with the Bad ServiceResult.
+	if parsingResults := srv.parseNodeTypes(req.NodeTypes); parsingResults != nil {
+		ch.Write(
+			&ua.QueryFirstResponse{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadInvalidArgument,
+				},
+				ParsingResults: parsingResults,
+			},
+			requestid,
+		)
+		session.queryFirstErrorCount++
+		session.errorCount++
+		return nil
+	}
+	filter, filterResult, ok := resolveContentFilter(srv.NamespaceManager(), req.Filter, resolveQueryOperand)
+	if !ok {
+		ch.Write(
+			&ua.QueryFirstResponse{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadContentFilterInvalid,
+				},
+				FilterResult: filterResult,
+			},
+			requestid,
+		)
+		session.queryFirstErrorCount++
+		session.errorCount++
+		return nil
+	}
+
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, SessionKey, session)
+	ctx, done := session.beginRequest(ctx, req.RequestHandle)
+
+	srv.goSession(func() {
+		defer done()
+		results := srv.query(ctx, req.NodeTypes, filter)
+		if ctx.Err() != nil {
+			ch.Write(
+				&ua.ServiceFault{
+					ResponseHeader: ua.ResponseHeader{
+						Timestamp:     time.Now(),
+						RequestHandle: req.RequestHandle,
+						ServiceResult: ua.BadRequestCancelledByClient,
+					},
+				},
+				requestid,
+			)
+			return
+		}
+		var cp []byte
+		max := int(req.MaxDataSetsToReturn)
+		if max == 0 || max > maxQueryDataSets {
+			max = maxQueryDataSets
+		}
+		if len(results) > max {
+			var err error
+			cp, err = session.addQueryContinuationPoint(results[max:], max)
+			if err != nil {
+				ch.Write(
+					&ua.ServiceFault{
+						ResponseHeader: ua.ResponseHeader{
+							Timestamp:     time.Now(),
+							RequestHandle: req.RequestHandle,
+							ServiceResult: ua.BadNoContinuationPoints,
+						},
+					},
+					requestid,
+				)
+				session.queryFirstErrorCount++
+				session.errorCount++
+				return
+			}
+			results = results[:max]
+		}
+		ch.Write(
+			&ua.QueryFirstResponse{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+				},
+				QueryDataSets:     results,
+				ContinuationPoint: ua.ByteString(cp),
+			},
+			requestid,
+		)
+	})
 	return nil
 }
 
-func (srv *Server) handleUnregisterNodes(ch *serverSecureChannel, requestid uint32, req *ua.UnregisterNodesRequest) error {
+// QueryNext returns the next data sets of a QueryFirst response that was too large.
+func (srv *Server) handleQueryNext(ch *serverSecureChannel, requestid uint32, req *ua.QueryNextRequest) error {
 	// discovery only?
 	if ch.discoveryOnly {
 		ch.Abort(ua.BadSecurityPolicyRejected, "")
@@ -1624,7 +2333,7 @@ func (srv *Server) handleUnregisterNodes(ch *serverSecureChannel, requestid uint
 		)
 		return nil
 	}
-	session.unregisterNodesCount++
+	session.queryNextCount++
 	session.requestCount++
 	// check channelId
 	id := session.SecureChannelId()
@@ -1640,7 +2349,7 @@ func (srv *Server) handleUnregisterNodes(ch *serverSecureChannel, requestid uint
 			},
 			requestid,
 		)
-		session.unregisterNodesErrorCount++
+		session.queryNextErrorCount++
 		session.errorCount++
 		return nil
 	}
@@ -1655,131 +2364,65 @@ func (srv *Server) handleUnregisterNodes(ch *serverSecureChannel, requestid uint
 			},
 			requestid,
 		)
-		session.unregisterNodesErrorCount++
+		session.queryNextErrorCount++
 		session.errorCount++
 		return nil
 	}
 
-	l := len(req.NodesToUnregister)
-	if l == 0 {
+	results, max, ok := session.removeQueryContinuationPoint([]byte(req.ContinuationPoint))
+	if !ok {
 		ch.Write(
 			&ua.ServiceFault{
 				ResponseHeader: ua.ResponseHeader{
 					Timestamp:     time.Now(),
 					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadNothingToDo,
+					ServiceResult: ua.BadContinuationPointInvalid,
 				},
 			},
 			requestid,
 		)
-		session.unregisterNodesErrorCount++
+		session.queryNextErrorCount++
 		session.errorCount++
 		return nil
 	}
-	// check too many operations
-	if l > int(srv.serverCapabilities.OperationLimits.MaxNodesPerRegisterNodes) {
-		ch.Write(
-			&ua.ServiceFault{
-				ResponseHeader: ua.ResponseHeader{
-					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadTooManyOperations,
+	if req.ReleaseContinuationPoint {
+		results = nil
+	}
+	var cp []byte
+	if len(results) > max {
+		var err error
+		cp, err = session.addQueryContinuationPoint(results[max:], max)
+		if err != nil {
+			ch.Write(
+				&ua.ServiceFault{
+					ResponseHeader: ua.ResponseHeader{
+						Timestamp:     time.Now(),
+						RequestHandle: req.RequestHandle,
+						ServiceResult: ua.BadNoContinuationPoints,
+					},
 				},
-			},
-			requestid,
-		)
-		session.unregisterNodesErrorCount++
-		session.errorCount++
-		return nil
+				requestid,
+			)
+			session.queryNextErrorCount++
+			session.errorCount++
+			return nil
+		}
+		results = results[:max]
 	}
-
 	ch.Write(
-		&ua.UnregisterNodesResponse{
+		&ua.QueryNextResponse{
 			ResponseHeader: ua.ResponseHeader{
 				Timestamp:     time.Now(),
-				RequestHandle: req.RequestHeader.RequestHandle,
+				RequestHandle: req.RequestHandle,
 			},
+			QueryDataSets:            results,
+			RevisedContinuationPoint: ua.ByteString(cp),
 		},
 		requestid,
 	)
 	return nil
 }
 
-func (srv *Server) follow(nodeID ua.NodeID, elements []ua.RelativePathElement) ([]ua.BrowsePathTarget, error) {
-	if len(elements) == 0 {
-		return nil, ua.BadNothingToDo
-	} else if len(elements) == 1 {
-		ns, err2 := srv.target(nodeID, elements[0])
-		if err2 != nil {
-			return nil, err2
-		}
-		targets := make([]ua.BrowsePathTarget, len(ns))
-		for i, n := range ns {
-			targets[i] = ua.BrowsePathTarget{TargetID: n, RemainingPathIndex: math.MaxUint32}
-		}
-		return targets, nil
-	} else {
-		e := elements[0]
-		ns2, err3 := srv.target(nodeID, e)
-		if err3 != nil {
-			return nil, err3
-		}
-		var nextID ua.ExpandedNodeID
-		if len(ns2) > 0 {
-			nextID = ns2[0]
-		}
-		nextElements := make([]ua.RelativePathElement, len(elements)-1)
-		copy(nextElements, elements[1:])
-		nextNode, ok := srv.NamespaceManager().FindNode(ua.ToNodeID(nextID, srv.NamespaceUris()))
-		if ok {
-			return srv.follow(nextNode.NodeID(), nextElements)
-		}
-		if len(nextElements) == 0 {
-			return []ua.BrowsePathTarget{
-				{TargetID: nextID, RemainingPathIndex: math.MaxUint32},
-			}, nil
-		}
-		return []ua.BrowsePathTarget{
-			{TargetID: nextID, RemainingPathIndex: uint32(len(nextElements))},
-		}, nil
-	}
-}
-
-// target returns a slice of target nodeid's that match the given RelativePathElement
-func (srv *Server) target(nodeID ua.NodeID, element ua.RelativePathElement) ([]ua.ExpandedNodeID, error) {
-	referenceTypeID := element.ReferenceTypeID
-	includeSubtypes := element.IncludeSubtypes
-	isInverse := element.IsInverse
-	targetName := element.TargetName
-	m := srv.NamespaceManager()
-	node, ok := m.FindNode(nodeID)
-	if !ok {
-		return nil, ua.BadNodeIDUnknown
-	}
-	refs := node.References()
-	targets := make([]ua.ExpandedNodeID, 0, 4)
-	for _, r := range refs {
-		if !(r.IsInverse == isInverse) {
-			continue
-		}
-		if !(referenceTypeID == nil || r.ReferenceTypeID == referenceTypeID || (includeSubtypes && m.IsSubtype(r.ReferenceTypeID, referenceTypeID))) {
-			continue
-		}
-		t, ok := m.FindNode(ua.ToNodeID(r.TargetID, srv.NamespaceUris()))
-		if !ok {
-			continue
-		}
-		if !(targetName == t.BrowseName()) {
-			continue
-		}
-		targets = append(targets, r.TargetID)
-	}
-	if len(targets) == 0 {
-		return nil, ua.BadNoMatch
-	}
-	return targets, nil
-}
-
 // Read returns a list of Node attributes.
 func (srv *Server) handleRead(ch *serverSecureChannel, requestid uint32, req *ua.ReadRequest) error {
 	// discovery only?
@@ -1890,7 +2533,7 @@ func (srv *Server) handleRead(ch *serverSecureChannel, requestid uint32, req *ua
 		return nil
 	}
 	// check too many operations
-	if l > int(srv.serverCapabilities.OperationLimits.MaxNodesPerRead) {
+	if exceedsOperationLimit(l, srv.serverCapabilities.OperationLimits.MaxNodesPerRead) {
 		ch.Write(
 			&ua.ServiceFault{
 				ResponseHeader: ua.ResponseHeader{
@@ -1907,6 +2550,7 @@ func (srv *Server) handleRead(ch *serverSecureChannel, requestid uint32, req *ua
 	}
 
 	results := make([]ua.DataValue, l)
+	diagnostics := newDiagnosticsBuilder(req.ReturnDiagnostics, l)
 	wp := srv.WorkerPool()
 	wg := sync.WaitGroup{}
 	wg.Add(l)
@@ -1915,24 +2559,27 @@ func (srv *Server) handleRead(ch *serverSecureChannel, requestid uint32, req *ua
 		i := ii
 		wp.Submit(func() {
 			n := req.NodesToRead[i]
-			results[i] = srv.readValue(ctx, n)
+			results[i] = srv.readValueMaxAge(diagnostics.context(ctx, i), n, req.MaxAge)
 			wg.Done()
 		})
 	}
-	go func() {
+	srv.goSession(func() {
 		// wait until all tasks are done
 		wg.Wait()
+		diagnosticInfos, stringTable := diagnostics.results()
 		ch.Write(
 			&ua.ReadResponse{
 				ResponseHeader: ua.ResponseHeader{
 					Timestamp:     time.Now(),
 					RequestHandle: req.RequestHandle,
+					StringTable:   stringTable,
 				},
-				Results: selectTimestamps(results, req.TimestampsToReturn),
+				Results:         selectTimestamps(results, req.TimestampsToReturn),
+				DiagnosticInfos: diagnosticInfos,
 			},
 			requestid,
 		)
-	}()
+	})
 	return nil
 }
 
@@ -1995,6 +2642,7 @@ func (srv *Server) handleWrite(ch *serverSecureChannel, requestid uint32, req *u
 	}
 	ctx := context.Background()
 	ctx = context.WithValue(ctx, SessionKey, session)
+	ctx = context.WithValue(ctx, actionTimeStampKey{}, req.Timestamp)
 
 	// check nothing to do
 	l := len(req.NodesToWrite)
@@ -2014,7 +2662,7 @@ func (srv *Server) handleWrite(ch *serverSecureChannel, requestid uint32, req *u
 		return nil
 	}
 	// check too many operations
-	if l > int(srv.serverCapabilities.OperationLimits.MaxNodesPerWrite) {
+	if exceedsOperationLimit(l, srv.serverCapabilities.OperationLimits.MaxNodesPerWrite) {
 		ch.Write(
 			&ua.ServiceFault{
 				ResponseHeader: ua.ResponseHeader{
@@ -2031,6 +2679,26 @@ func (srv *Server) handleWrite(ch *serverSecureChannel, requestid uint32, req *u
 	}
 
 	results := make([]ua.StatusCode, l)
+	diagnostics := newDiagnosticsBuilder(req.ReturnDiagnostics, l)
+
+	// write all values or none, if requested.
+	if v, ok := req.AdditionalParameter(ua.AdditionalParameterTransactional); ok && v == true {
+		results = srv.writeValues(ctx, req.NodesToWrite, diagnostics)
+		diagnosticInfos, stringTable := diagnostics.results()
+		ch.Write(
+			&ua.WriteResponse{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now().UTC(),
+					RequestHandle: req.RequestHeader.RequestHandle,
+					StringTable:   stringTable,
+				},
+				Results:         results,
+				DiagnosticInfos: diagnosticInfos,
+			},
+			requestid,
+		)
+		return nil
+	}
 
 	// handle requests in parallel using server thread pool.
 	wp := srv.WorkerPool()
@@ -2041,25 +2709,31 @@ func (srv *Server) handleWrite(ch *serverSecureChannel, requestid uint32, req *u
 		i := ii
 		wp.Submit(func() {
 			n := req.NodesToWrite[i]
-			results[i] = srv.writeValue(ctx, n)
+			// a transactional write may restore the values it replaced, so it excludes other writes.
+			srv.transactionLock.RLock()
+			results[i] = srv.writeValue(diagnostics.context(ctx, i), n)
+			srv.transactionLock.RUnlock()
 			wg.Done()
 		})
 	}
-	go func() {
+	srv.goSession(func() {
 		// wait until all tasks are done
 		wg.Wait()
+		diagnosticInfos, stringTable := diagnostics.results()
 		ch.Write(
 			&ua.WriteResponse{
 				ResponseHeader: ua.ResponseHeader{
 					Timestamp:     time.Now().UTC(),
 					RequestHandle: req.RequestHeader.RequestHandle,
+					StringTable:   stringTable,
 				},
-				Results: results,
+				Results:         results,
+				DiagnosticInfos: diagnosticInfos,
 			},
 			requestid,
 		)
 
-	}()
+	})
 	return nil
 }
 
@@ -2124,7 +2798,23 @@ func (srv *Server) handleHistoryRead(ch *serverSecureChannel, requestid uint32,
 	ctx = context.WithValue(ctx, SessionKey, session)
 
 	// check TimestampsToReturn
-	if req.TimestampsToReturn < ua.TimestampsToReturnSource || req.TimestampsToReturn > ua.TimestampsToReturnBoth {
+	if req.TimestampsToReturn < ua.TimestampsToReturnSource || req.TimestampsToReturn > ua.TimestampsToReturnNeither {
+		ch.Write(
+			&ua.ServiceFault{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadTimestampsToReturnInvalid,
+				},
+			},
+			requestid,
+		)
+		// session.readErrorCount++
+		// session.errorCount++
+		return nil
+	}
+	// history must be read with timestamps.
+	if req.TimestampsToReturn == ua.TimestampsToReturnNeither {
 		ch.Write(
 			&ua.ServiceFault{
 				ResponseHeader: ua.ResponseHeader{
@@ -2157,7 +2847,11 @@ func (srv *Server) handleHistoryRead(ch *serverSecureChannel, requestid uint32,
 		return nil
 	}
 	// check too many operations
-	if l > int(srv.serverCapabilities.OperationLimits.MaxNodesPerHistoryReadData) {
+	limit := srv.serverCapabilities.OperationLimits.MaxNodesPerHistoryReadData
+	if _, ok := req.HistoryReadDetails.(ua.ReadEventDetails); ok {
+		limit = srv.serverCapabilities.OperationLimits.MaxNodesPerHistoryReadEvents
+	}
+	if exceedsOperationLimit(l, limit) {
 		ch.Write(
 			&ua.ServiceFault{
 				ResponseHeader: ua.ResponseHeader{
@@ -2189,24 +2883,78 @@ func (srv *Server) handleHistoryRead(ch *serverSecureChannel, requestid uint32,
 		return nil
 	}
 
-	switch details := req.HistoryReadDetails.(type) {
-	case ua.ReadEventDetails:
-		results, status := h.ReadEvent(ctx, req.NodesToRead, details, req.TimestampsToReturn, req.ReleaseContinuationPoints)
+	// check details
+	switch req.HistoryReadDetails.(type) {
+	case ua.ReadEventDetails, ua.ReadRawModifiedDetails, ua.ReadProcessedDetails, ua.ReadAtTimeDetails:
+	default:
 		ch.Write(
-			&ua.HistoryReadResponse{
+			&ua.ServiceFault{
 				ResponseHeader: ua.ResponseHeader{
 					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHeader.RequestHandle,
-					ServiceResult: status,
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadHistoryOperationInvalid,
 				},
-				Results: results,
 			},
 			requestid,
 		)
 		return nil
+	}
 
-	case ua.ReadRawModifiedDetails:
-		results, status := h.ReadRawModified(ctx, req.NodesToRead, details, req.TimestampsToReturn, req.ReleaseContinuationPoints)
+	// check each node, and pass only the readable nodes to the historian.
+	_, events := req.HistoryReadDetails.(ua.ReadEventDetails)
+	results := make([]ua.HistoryReadResult, l)
+	nodesToRead := make([]ua.HistoryReadValueID, 0, l)
+	indexes := make([]int, 0, l)
+	for i, n := range req.NodesToRead {
+		// the historian receives the NodeID of the node, not the NodeID returned by RegisterNodes.
+		n.NodeID = srv.resolveNodeID(ctx, n.NodeID)
+		if sc := srv.checkHistoryRead(ctx, n.NodeID, events); sc != ua.Good {
+			results[i] = ua.HistoryReadResult{StatusCode: sc}
+			continue
+		}
+		nodesToRead = append(nodesToRead, n)
+		indexes = append(indexes, i)
+	}
+
+	// run the read in the background, so the request may be canceled by the client.
+	ctx, done := session.beginRequest(ctx, req.RequestHandle)
+	srv.goSession(func() {
+		defer done()
+		var results2 []ua.HistoryReadResult
+		var status ua.StatusCode = ua.Good
+		if len(nodesToRead) > 0 {
+			switch details := req.HistoryReadDetails.(type) {
+			case ua.ReadEventDetails:
+				results2, status = h.ReadEvent(ctx, nodesToRead, details, req.TimestampsToReturn, req.ReleaseContinuationPoints)
+			case ua.ReadRawModifiedDetails:
+				results2, status = h.ReadRawModified(ctx, nodesToRead, details, req.TimestampsToReturn, req.ReleaseContinuationPoints)
+			case ua.ReadProcessedDetails:
+				results2, status = h.ReadProcessed(ctx, nodesToRead, details, req.TimestampsToReturn, req.ReleaseContinuationPoints)
+			case ua.ReadAtTimeDetails:
+				results2, status = h.ReadAtTime(ctx, nodesToRead, details, req.TimestampsToReturn, req.ReleaseContinuationPoints)
+			}
+		}
+		if status.IsBad() {
+			results = nil
+		}
+		for j, result := range results2 {
+			if j < len(indexes) && results != nil {
+				results[indexes[j]] = result
+			}
+		}
+		if ctx.Err() != nil {
+			ch.Write(
+				&ua.ServiceFault{
+					ResponseHeader: ua.ResponseHeader{
+						Timestamp:     time.Now(),
+						RequestHandle: req.RequestHandle,
+						ServiceResult: ua.BadRequestCancelledByClient,
+					},
+				},
+				requestid,
+			)
+			return
+		}
 		ch.Write(
 			&ua.HistoryReadResponse{
 				ResponseHeader: ua.ResponseHeader{
@@ -2218,50 +2966,280 @@ func (srv *Server) handleHistoryRead(ch *serverSecureChannel, requestid uint32,
 			},
 			requestid,
 		)
-		return nil
+	})
+	return nil
+}
 
-	case ua.ReadProcessedDetails:
-		results, status := h.ReadProcessed(ctx, req.NodesToRead, details, req.TimestampsToReturn, req.ReleaseContinuationPoints)
+// handleHistoryUpdate inserts, replaces or deletes the history of nodes.
+func (srv *Server) handleHistoryUpdate(ch *serverSecureChannel, requestid uint32, req *ua.HistoryUpdateRequest) error {
+	// discovery only?
+	if ch.discoveryOnly {
+		ch.Abort(ua.BadSecurityPolicyRejected, "")
+		return nil
+	}
+	// get session
+	session, ok := srv.SessionManager().Get(req.AuthenticationToken)
+	if !ok {
 		ch.Write(
-			&ua.HistoryReadResponse{
+			&ua.ServiceFault{
 				ResponseHeader: ua.ResponseHeader{
 					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHeader.RequestHandle,
-					ServiceResult: status,
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadSessionIDInvalid,
 				},
-				Results: results,
 			},
 			requestid,
 		)
 		return nil
-
-	case ua.ReadAtTimeDetails:
-		results, status := h.ReadAtTime(ctx, req.NodesToRead, details, req.TimestampsToReturn, req.ReleaseContinuationPoints)
+	}
+	session.historyUpdateCount++
+	session.requestCount++
+	// check channelId
+	id := session.SecureChannelId()
+	if id == 0 {
+		srv.SessionManager().Delete(session)
 		ch.Write(
-			&ua.HistoryReadResponse{
+			&ua.ServiceFault{
 				ResponseHeader: ua.ResponseHeader{
 					Timestamp:     time.Now(),
-					RequestHandle: req.RequestHeader.RequestHandle,
-					ServiceResult: status,
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadSessionNotActivated,
+				},
+			},
+			requestid,
+		)
+		session.historyUpdateErrorCount++
+		session.errorCount++
+		return nil
+	}
+	if id != ch.ChannelID() {
+		ch.Write(
+			&ua.ServiceFault{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadSecureChannelIDInvalid,
+				},
+			},
+			requestid,
+		)
+		session.historyUpdateErrorCount++
+		session.errorCount++
+		return nil
+	}
+	// check nothing to do
+	l := len(req.HistoryUpdateDetails)
+	if l == 0 {
+		ch.Write(
+			&ua.ServiceFault{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadNothingToDo,
+				},
+			},
+			requestid,
+		)
+		session.historyUpdateErrorCount++
+		session.errorCount++
+		return nil
+	}
+	// check too many operations
+	if exceedsOperationLimit(l, srv.serverCapabilities.OperationLimits.MaxNodesPerHistoryUpdateData) {
+		ch.Write(
+			&ua.ServiceFault{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadTooManyOperations,
 				},
-				Results: results,
 			},
 			requestid,
 		)
+		session.historyUpdateErrorCount++
+		session.errorCount++
 		return nil
 	}
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, SessionKey, session)
+
+	results := make([]ua.HistoryUpdateResult, l)
+	for i, details := range req.HistoryUpdateDetails {
+		switch d := details.(type) {
+		case ua.UpdateDataDetails:
+			results[i] = srv.updateData(ctx, d)
+		case ua.DeleteRawModifiedDetails:
+			results[i] = srv.deleteRawModified(ctx, d)
+		case ua.UpdateStructureDataDetails, ua.UpdateEventDetails, ua.DeleteAtTimeDetails, ua.DeleteEventDetails:
+			results[i] = ua.HistoryUpdateResult{StatusCode: ua.BadHistoryOperationUnsupported}
+		default:
+			results[i] = ua.HistoryUpdateResult{StatusCode: ua.BadHistoryOperationInvalid}
+		}
+	}
+
+	ch.Write(
+		&ua.HistoryUpdateResponse{
+			ResponseHeader: ua.ResponseHeader{
+				Timestamp:     time.Now(),
+				RequestHandle: req.RequestHeader.RequestHandle,
+			},
+			Results: results,
+		},
+		requestid,
+	)
+	return nil
+}
+
+// checkHistoryUpdate returns the VariableNode, if the user has each of the permissions to update the
+// history of the node. The node must be Historizing, have the HistoryWrite bit of its AccessLevel,
+// and have a historian.
+func (srv *Server) checkHistoryUpdate(ctx context.Context, nodeID ua.NodeID, permissions ua.PermissionType) (*VariableNode, ua.StatusCode) {
+	n, ok := srv.NamespaceManager().FindNode(nodeID)
+	if !ok {
+		return nil, ua.BadNodeIDUnknown
+	}
+	rp := n.UserRolePermissions(ctx)
+	if !IsUserPermitted(rp, ua.PermissionTypeBrowse) {
+		return nil, ua.BadNodeIDUnknown
+	}
+	n1, ok := n.(*VariableNode)
+	if !ok || !n1.Historizing() || n1.Historian() == nil {
+		return nil, ua.BadHistoryOperationUnsupported
+	}
+	if n1.AccessLevel()&ua.AccessLevelsHistoryWrite == 0 {
+		return nil, ua.BadNotWritable
+	}
+	// each of the permissions is required, e.g. both InsertHistory and ModifyHistory to update.
+	for p := ua.PermissionType(1); p != 0 && p <= permissions; p <<= 1 {
+		if permissions&p != 0 && !IsUserPermitted(rp, p) {
+			return nil, ua.BadUserAccessDenied
+		}
+	}
+	return n1, ua.Good
+}
+
+// updateData inserts or replaces the values of a node in the historian.
+func (srv *Server) updateData(ctx context.Context, details ua.UpdateDataDetails) ua.HistoryUpdateResult {
+	var permissions ua.PermissionType
+	switch details.PerformInsertReplace {
+	case ua.PerformUpdateTypeInsert:
+		permissions = ua.PermissionTypeInsertHistory
+	case ua.PerformUpdateTypeReplace:
+		permissions = ua.PermissionTypeModifyHistory
+	case ua.PerformUpdateTypeUpdate:
+		permissions = ua.PermissionTypeInsertHistory | ua.PermissionTypeModifyHistory
+	default:
+		return ua.HistoryUpdateResult{StatusCode: ua.BadHistoryOperationInvalid}
+	}
+	n, sc := srv.checkHistoryUpdate(ctx, details.NodeID, permissions)
+	if sc != ua.Good {
+		return ua.HistoryUpdateResult{StatusCode: sc}
+	}
+	h, ok := n.Historian().(HistoryUpdater)
+	if !ok {
+		return ua.HistoryUpdateResult{StatusCode: ua.BadHistoryOperationUnsupported}
+	}
+	// check each value, and pass only the values with a SourceTimestamp to the historian.
+	results := make([]ua.StatusCode, len(details.UpdateValues))
+	values := make([]ua.DataValue, 0, len(details.UpdateValues))
+	indexes := make([]int, 0, len(details.UpdateValues))
+	for i, v := range details.UpdateValues {
+		if v.SourceTimestamp.IsZero() {
+			results[i] = ua.BadInvalidTimestamp
+			continue
+		}
+		values = append(values, v)
+		indexes = append(indexes, i)
+	}
+	var results2 []ua.StatusCode
+	switch details.PerformInsertReplace {
+	case ua.PerformUpdateTypeInsert:
+		results2 = h.InsertValues(ctx, n.NodeID(), values)
+	case ua.PerformUpdateTypeReplace:
+		results2 = h.ReplaceValues(ctx, n.NodeID(), values)
+	case ua.PerformUpdateTypeUpdate:
+		// replace the stored values, and insert the others.
+		results2 = h.ReplaceValues(ctx, n.NodeID(), values)
+		for j, sc := range results2 {
+			if sc == ua.BadNoEntryExists {
+				results2[j] = h.InsertValues(ctx, n.NodeID(), values[j:j+1])[0]
+			}
+		}
+	}
+	for j, sc := range results2 {
+		if j < len(indexes) {
+			results[indexes[j]] = sc
+		}
+	}
+	return ua.HistoryUpdateResult{OperationResults: results}
+}
 
-	ch.Write(
-		&ua.ServiceFault{
-			ResponseHeader: ua.ResponseHeader{
-				Timestamp:     time.Now(),
-				RequestHandle: req.RequestHandle,
-				ServiceResult: ua.BadHistoryOperationInvalid,
-			},
-		},
-		requestid,
-	)
-	return nil
+// deleteRawModified deletes the values of a node in the historian.
+func (srv *Server) deleteRawModified(ctx context.Context, details ua.DeleteRawModifiedDetails) ua.HistoryUpdateResult {
+	n, sc := srv.checkHistoryUpdate(ctx, details.NodeID, ua.PermissionTypeDeleteHistory)
+	if sc != ua.Good {
+		return ua.HistoryUpdateResult{StatusCode: sc}
+	}
+	if details.IsDeleteModified {
+		return ua.HistoryUpdateResult{StatusCode: ua.BadHistoryOperationUnsupported}
+	}
+	if details.StartTime.IsZero() && details.EndTime.IsZero() {
+		return ua.HistoryUpdateResult{StatusCode: ua.BadInvalidTimestampArgument}
+	}
+	d, ok := n.Historian().(HistoryDeleter)
+	if !ok {
+		return ua.HistoryUpdateResult{StatusCode: ua.BadHistoryOperationUnsupported}
+	}
+	startTime, endTime := details.StartTime, details.EndTime
+	if !startTime.IsZero() && !endTime.IsZero() && startTime.After(endTime) {
+		startTime, endTime = endTime, startTime
+	}
+	if err := d.DeleteRawModified(ctx, n.NodeID(), startTime, endTime); err != nil {
+		return ua.HistoryUpdateResult{StatusCode: ua.BadHistoryOperationInvalid}
+	}
+	return ua.HistoryUpdateResult{}
+}
+
+// checkHistoryRead returns Good if the user may read the history of the node. The history of values
+// is read from a VariableNode with a historian and the HistoryRead bit of its AccessLevel and
+// UserAccessLevel, and the history of events from an ObjectNode with the HistoryRead bit of its
+// EventNotifier. The user requires the ReadHistory permission.
+func (srv *Server) checkHistoryRead(ctx context.Context, nodeID ua.NodeID, events bool) ua.StatusCode {
+	n, ok := srv.findNode(ctx, nodeID)
+	if !ok {
+		return ua.BadNodeIDUnknown
+	}
+	rp := n.UserRolePermissions(ctx)
+	if !IsUserPermitted(rp, ua.PermissionTypeBrowse) {
+		return ua.BadNodeIDUnknown
+	}
+	if events {
+		n1, ok := n.(*ObjectNode)
+		if !ok {
+			return ua.BadHistoryOperationUnsupported
+		}
+		if n1.EventNotifier()&ua.EventNotifierHistoryRead == 0 {
+			return ua.BadNotReadable
+		}
+		if !IsUserPermitted(rp, ua.PermissionTypeReadHistory) {
+			return ua.BadUserAccessDenied
+		}
+		return ua.Good
+	}
+	n1, ok := n.(*VariableNode)
+	if !ok {
+		return ua.BadHistoryOperationUnsupported
+	}
+	if n1.Historian() == nil {
+		return ua.BadHistoryOperationUnsupported
+	}
+	if n1.AccessLevel()&ua.AccessLevelsHistoryRead == 0 {
+		return ua.BadNotReadable
+	}
+	if n1.UserAccessLevel(ctx)&ua.AccessLevelsHistoryRead == 0 {
+		return ua.BadUserAccessDenied
+	}
+	return ua.Good
 }
 
 // readRange returns slice of value specified by IndexRange
@@ -2271,6 +3249,24 @@ func readRange(source ua.DataValue, indexRange string) ua.DataValue {
 	}
 	ranges := strings.Split(indexRange, ",")
 	switch src := source.Value.(type) {
+	case ua.Matrix:
+		// a matrix needs a range for each dimension, and the result is a matrix.
+		if src.Validate() != nil || len(ranges) != len(src.Dimensions) {
+			return ua.NewDataValue(nil, ua.BadIndexRangeNoData, source.SourceTimestamp, 0, source.ServerTimestamp, 0)
+		}
+		dims := make([]int, len(src.Dimensions))
+		for k, d := range src.Dimensions {
+			dims[k] = int(d)
+		}
+		dst, counts, status := selectRanges(reflect.ValueOf(src.Elements), dims, ranges)
+		if status.IsBad() {
+			return ua.NewDataValue(nil, status, source.SourceTimestamp, 0, source.ServerTimestamp, 0)
+		}
+		dimensions := make([]int32, len(counts))
+		for k, c := range counts {
+			dimensions[k] = int32(c)
+		}
+		return ua.NewDataValue(ua.Matrix{Elements: dst.Interface(), Dimensions: dimensions}, source.StatusCode, source.SourceTimestamp, 0, source.ServerTimestamp, 0)
 	case string:
 		if len(ranges) > 1 {
 			return ua.NewDataValue(nil, ua.BadIndexRangeNoData, source.SourceTimestamp, 0, source.ServerTimestamp, 0)
@@ -2598,13 +3594,144 @@ func readRange(source ua.DataValue, indexRange string) ua.DataValue {
 	}
 }
 
+// readRangeDims returns slice of value specified by IndexRange. If the IndexRange has a range for
+// each of the array dimensions, the value is a flattened array in row-major order and the result is
+// the flattened sub-array selected by the ranges. A Matrix carries its own dimensions.
+func readRangeDims(source ua.DataValue, indexRange string, dims []uint32) ua.DataValue {
+	ranges := strings.Split(indexRange, ",")
+	if _, ok := source.Value.(ua.Matrix); ok || len(ranges) < 2 || len(ranges) != len(dims) {
+		return readRange(source, indexRange)
+	}
+	src := reflect.ValueOf(source.Value)
+	if src.Kind() != reflect.Slice {
+		return readRange(source, indexRange)
+	}
+	d := make([]int, len(dims))
+	for k, n := range dims {
+		d[k] = int(n)
+	}
+	dst, _, status := selectRanges(src, d, ranges)
+	if status.IsBad() {
+		return ua.NewDataValue(nil, status, source.SourceTimestamp, 0, source.ServerTimestamp, 0)
+	}
+	return ua.NewDataValue(dst.Interface(), source.StatusCode, source.SourceTimestamp, 0, source.ServerTimestamp, 0)
+}
+
+// selectRanges returns the elements of the flattened array with the dimensions that are selected by
+// a range for each dimension, and the number of elements selected in each dimension.
+func selectRanges(src reflect.Value, dims []int, ranges []string) (reflect.Value, []int, ua.StatusCode) {
+	lo, hi, status := parseRanges(src, dims, ranges)
+	if status.IsBad() {
+		return reflect.Value{}, nil, status
+	}
+	counts := make([]int, len(dims))
+	count := 1
+	for k := range dims {
+		counts[k] = hi[k] - lo[k]
+		count *= counts[k]
+	}
+	dst := reflect.MakeSlice(src.Type(), 0, count)
+	eachRow(dims, lo, hi, func(offset, n int) {
+		dst = reflect.AppendSlice(dst, src.Slice(offset, offset+n))
+	})
+	return dst, counts, ua.Good
+}
+
+// parseRanges checks the length of the flattened array against the dimensions, and returns the
+// bounds of the range of each dimension.
+func parseRanges(src reflect.Value, dims []int, ranges []string) ([]int, []int, ua.StatusCode) {
+	length := 1
+	for _, d := range dims {
+		length *= d
+	}
+	if length == 0 || src.Kind() != reflect.Slice || src.Len() != length {
+		return nil, nil, ua.BadIndexRangeNoData
+	}
+	lo := make([]int, len(dims))
+	hi := make([]int, len(dims))
+	for k, r := range ranges {
+		i, j, status := parseBounds(r, dims[k])
+		if status.IsBad() {
+			return nil, nil, status
+		}
+		lo[k], hi[k] = i, j
+	}
+	return lo, hi, ua.Good
+}
+
+// eachRow calls f with the offset and length of each run of the flattened array that is selected by
+// the bounds. The last dimension varies fastest, so each run is a part of a row of the last dimension.
+func eachRow(dims, lo, hi []int, f func(offset, n int)) {
+	strides := make([]int, len(dims))
+	strides[len(dims)-1] = 1
+	for k := len(dims) - 2; k >= 0; k-- {
+		strides[k] = strides[k+1] * dims[k+1]
+	}
+	var row func(k, offset int)
+	row = func(k, offset int) {
+		if k == len(dims)-1 {
+			f(offset+lo[k], hi[k]-lo[k])
+			return
+		}
+		for i := lo[k]; i < hi[k]; i++ {
+			row(k+1, offset+i*strides[k])
+		}
+	}
+	row(0, 0)
+}
+
 // writeRange sets subset of value specified by IndexRange
 func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.DataValue, ua.StatusCode) {
+	// keep the timestamps of the value, or stamp the current time.
+	sourceTimestamp, serverTimestamp := value.SourceTimestamp, value.ServerTimestamp
+	if sourceTimestamp.IsZero() {
+		sourceTimestamp = time.Now()
+	}
+	if serverTimestamp.IsZero() {
+		serverTimestamp = time.Now()
+	}
 	if indexRange == "" {
-		return ua.NewDataValue(value.Value, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(value.Value, value.StatusCode, sourceTimestamp, value.SourcePicoseconds, serverTimestamp, value.ServerPicoseconds), ua.Good
 	}
 	ranges := strings.Split(indexRange, ",")
 	switch src := source.Value.(type) {
+	case ua.Matrix:
+		// the value is a matrix with the size of the ranges.
+		if src.Validate() != nil || len(ranges) != len(src.Dimensions) {
+			return ua.NilDataValue, ua.BadIndexRangeNoData
+		}
+		v2, ok := value.Value.(ua.Matrix)
+		if !ok || v2.Validate() != nil || reflect.TypeOf(v2.Elements) != reflect.TypeOf(src.Elements) {
+			return ua.NilDataValue, ua.BadTypeMismatch
+		}
+		dims := make([]int, len(src.Dimensions))
+		for k, d := range src.Dimensions {
+			dims[k] = int(d)
+		}
+		elements := reflect.ValueOf(src.Elements)
+		lo, hi, status := parseRanges(elements, dims, ranges)
+		if status.IsBad() {
+			return ua.NilDataValue, status
+		}
+		if len(v2.Dimensions) != len(dims) {
+			return ua.NilDataValue, ua.BadIndexRangeInvalid
+		}
+		for k := range dims {
+			if int(v2.Dimensions[k]) != hi[k]-lo[k] {
+				return ua.NilDataValue, ua.BadIndexRangeInvalid
+			}
+		}
+		dst := reflect.MakeSlice(elements.Type(), elements.Len(), elements.Len())
+		reflect.Copy(dst, elements)
+		v2Elements := reflect.ValueOf(v2.Elements)
+		pos := 0
+		eachRow(dims, lo, hi, func(offset, n int) {
+			reflect.Copy(dst.Slice(offset, offset+n), v2Elements.Slice(pos, pos+n))
+			pos += n
+		})
+		dimensions := make([]int32, len(src.Dimensions))
+		copy(dimensions, src.Dimensions)
+		return ua.NewDataValue(ua.Matrix{Elements: dst.Interface(), Dimensions: dimensions}, value.StatusCode, sourceTimestamp, value.SourcePicoseconds, serverTimestamp, value.ServerPicoseconds), ua.Good
 	case string:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2614,14 +3741,18 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		if status.IsBad() {
 			return ua.NilDataValue, status
 		}
-		v2 := []rune(value.Value.(string))
+		str, ok := value.Value.(string)
+		if !ok {
+			return ua.NilDataValue, ua.BadTypeMismatch
+		}
+		v2 := []rune(str)
 		if j-i != len(v2) {
-			return ua.NilDataValue, ua.BadIndexRangeNoData
+			return ua.NilDataValue, ua.BadIndexRangeInvalid
 		}
 		dst := make([]rune, len(v1))
 		copy(dst, v1)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(string(dst), value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(string(dst), value.StatusCode, sourceTimestamp, value.SourcePicoseconds, serverTimestamp, value.ServerPicoseconds), ua.Good
 	case ua.ByteString:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2630,14 +3761,17 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		if status.IsBad() {
 			return ua.NilDataValue, status
 		}
-		v2 := value.Value.(ua.ByteString)
+		v2, ok := value.Value.(ua.ByteString)
+		if !ok {
+			return ua.NilDataValue, ua.BadTypeMismatch
+		}
 		if j-i != len(v2) {
-			return ua.NilDataValue, ua.BadIndexRangeNoData
+			return ua.NilDataValue, ua.BadIndexRangeInvalid
 		}
 		dst := make([]byte, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(ua.ByteString(dst), value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(ua.ByteString(dst), value.StatusCode, sourceTimestamp, value.SourcePicoseconds, serverTimestamp, value.ServerPicoseconds), ua.Good
 	case []bool:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2646,14 +3780,17 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		if status.IsBad() {
 			return ua.NilDataValue, status
 		}
-		v2 := value.Value.([]bool)
+		v2, ok := value.Value.([]bool)
+		if !ok {
+			return ua.NilDataValue, ua.BadTypeMismatch
+		}
 		if j-i != len(v2) {
-			return ua.NilDataValue, ua.BadIndexRangeNoData
+			return ua.NilDataValue, ua.BadIndexRangeInvalid
 		}
 		dst := make([]bool, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, sourceTimestamp, value.SourcePicoseconds, serverTimestamp, value.ServerPicoseconds), ua.Good
 	case []int8:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2662,14 +3799,17 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		if status.IsBad() {
 			return ua.NilDataValue, status
 		}
-		v2 := value.Value.([]int8)
+		v2, ok := value.Value.([]int8)
+		if !ok {
+			return ua.NilDataValue, ua.BadTypeMismatch
+		}
 		if j-i != len(v2) {
-			return ua.NilDataValue, ua.BadIndexRangeNoData
+			return ua.NilDataValue, ua.BadIndexRangeInvalid
 		}
 		dst := make([]int8, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, sourceTimestamp, value.SourcePicoseconds, serverTimestamp, value.ServerPicoseconds), ua.Good
 	case []byte:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2678,14 +3818,17 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		if status.IsBad() {
 			return ua.NilDataValue, status
 		}
-		v2 := value.Value.([]byte)
+		v2, ok := value.Value.([]byte)
+		if !ok {
+			return ua.NilDataValue, ua.BadTypeMismatch
+		}
 		if j-i != len(v2) {
-			return ua.NilDataValue, ua.BadIndexRangeNoData
+			return ua.NilDataValue, ua.BadIndexRangeInvalid
 		}
 		dst := make([]byte, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, sourceTimestamp, value.SourcePicoseconds, serverTimestamp, value.ServerPicoseconds), ua.Good
 	case []int16:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2694,14 +3837,17 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		if status.IsBad() {
 			return ua.NilDataValue, status
 		}
-		v2 := value.Value.([]int16)
+		v2, ok := value.Value.([]int16)
+		if !ok {
+			return ua.NilDataValue, ua.BadTypeMismatch
+		}
 		if j-i != len(v2) {
-			return ua.NilDataValue, ua.BadIndexRangeNoData
+			return ua.NilDataValue, ua.BadIndexRangeInvalid
 		}
 		dst := make([]int16, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, sourceTimestamp, value.SourcePicoseconds, serverTimestamp, value.ServerPicoseconds), ua.Good
 	case []uint16:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2710,14 +3856,17 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		if status.IsBad() {
 			return ua.NilDataValue, status
 		}
-		v2 := value.Value.([]uint16)
+		v2, ok := value.Value.([]uint16)
+		if !ok {
+			return ua.NilDataValue, ua.BadTypeMismatch
+		}
 		if j-i != len(v2) {
-			return ua.NilDataValue, ua.BadIndexRangeNoData
+			return ua.NilDataValue, ua.BadIndexRangeInvalid
 		}
 		dst := make([]uint16, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, sourceTimestamp, value.SourcePicoseconds, serverTimestamp, value.ServerPicoseconds), ua.Good
 	case []int32:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2726,14 +3875,17 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		if status.IsBad() {
 			return ua.NilDataValue, status
 		}
-		v2 := value.Value.([]int32)
+		v2, ok := value.Value.([]int32)
+		if !ok {
+			return ua.NilDataValue, ua.BadTypeMismatch
+		}
 		if j-i != len(v2) {
-			return ua.NilDataValue, ua.BadIndexRangeNoData
+			return ua.NilDataValue, ua.BadIndexRangeInvalid
 		}
 		dst := make([]int32, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, sourceTimestamp, value.SourcePicoseconds, serverTimestamp, value.ServerPicoseconds), ua.Good
 	case []uint32:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2742,14 +3894,17 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		if status.IsBad() {
 			return ua.NilDataValue, status
 		}
-		v2 := value.Value.([]uint32)
+		v2, ok := value.Value.([]uint32)
+		if !ok {
+			return ua.NilDataValue, ua.BadTypeMismatch
+		}
 		if j-i != len(v2) {
-			return ua.NilDataValue, ua.BadIndexRangeNoData
+			return ua.NilDataValue, ua.BadIndexRangeInvalid
 		}
 		dst := make([]uint32, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, sourceTimestamp, value.SourcePicoseconds, serverTimestamp, value.ServerPicoseconds), ua.Good
 	case []int64:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2758,14 +3913,17 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		if status.IsBad() {
 			return ua.NilDataValue, status
 		}
-		v2 := value.Value.([]int64)
+		v2, ok := value.Value.([]int64)
+		if !ok {
+			return ua.NilDataValue, ua.BadTypeMismatch
+		}
 		if j-i != len(v2) {
-			return ua.NilDataValue, ua.BadIndexRangeNoData
+			return ua.NilDataValue, ua.BadIndexRangeInvalid
 		}
 		dst := make([]int64, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, sourceTimestamp, value.SourcePicoseconds, serverTimestamp, value.ServerPicoseconds), ua.Good
 	case []uint64:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2774,14 +3932,17 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		if status.IsBad() {
 			return ua.NilDataValue, status
 		}
-		v2 := value.Value.([]uint64)
+		v2, ok := value.Value.([]uint64)
+		if !ok {
+			return ua.NilDataValue, ua.BadTypeMismatch
+		}
 		if j-i != len(v2) {
-			return ua.NilDataValue, ua.BadIndexRangeNoData
+			return ua.NilDataValue, ua.BadIndexRangeInvalid
 		}
 		dst := make([]uint64, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, sourceTimestamp, value.SourcePicoseconds, serverTimestamp, value.ServerPicoseconds), ua.Good
 	case []float32:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2790,14 +3951,17 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		if status.IsBad() {
 			return ua.NilDataValue, status
 		}
-		v2 := value.Value.([]float32)
+		v2, ok := value.Value.([]float32)
+		if !ok {
+			return ua.NilDataValue, ua.BadTypeMismatch
+		}
 		if j-i != len(v2) {
-			return ua.NilDataValue, ua.BadIndexRangeNoData
+			return ua.NilDataValue, ua.BadIndexRangeInvalid
 		}
 		dst := make([]float32, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, sourceTimestamp, value.SourcePicoseconds, serverTimestamp, value.ServerPicoseconds), ua.Good
 	case []float64:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2806,14 +3970,17 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		if status.IsBad() {
 			return ua.NilDataValue, status
 		}
-		v2 := value.Value.([]float64)
+		v2, ok := value.Value.([]float64)
+		if !ok {
+			return ua.NilDataValue, ua.BadTypeMismatch
+		}
 		if j-i != len(v2) {
-			return ua.NilDataValue, ua.BadIndexRangeNoData
+			return ua.NilDataValue, ua.BadIndexRangeInvalid
 		}
 		dst := make([]float64, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, sourceTimestamp, value.SourcePicoseconds, serverTimestamp, value.ServerPicoseconds), ua.Good
 	case []string:
 		if len(ranges) > 2 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2822,14 +3989,17 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		if status.IsBad() {
 			return ua.NilDataValue, status
 		}
-		v2 := value.Value.([]string)
+		v2, ok := value.Value.([]string)
+		if !ok {
+			return ua.NilDataValue, ua.BadTypeMismatch
+		}
 		if j-i != len(v2) {
-			return ua.NilDataValue, ua.BadIndexRangeNoData
+			return ua.NilDataValue, ua.BadIndexRangeInvalid
 		}
 		dst := make([]string, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, sourceTimestamp, value.SourcePicoseconds, serverTimestamp, value.ServerPicoseconds), ua.Good
 	case []time.Time:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2838,14 +4008,17 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		if status.IsBad() {
 			return ua.NilDataValue, status
 		}
-		v2 := value.Value.([]time.Time)
+		v2, ok := value.Value.([]time.Time)
+		if !ok {
+			return ua.NilDataValue, ua.BadTypeMismatch
+		}
 		if j-i != len(v2) {
-			return ua.NilDataValue, ua.BadIndexRangeNoData
+			return ua.NilDataValue, ua.BadIndexRangeInvalid
 		}
 		dst := make([]time.Time, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, sourceTimestamp, value.SourcePicoseconds, serverTimestamp, value.ServerPicoseconds), ua.Good
 	case []uuid.UUID:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2854,14 +4027,17 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		if status.IsBad() {
 			return ua.NilDataValue, status
 		}
-		v2 := value.Value.([]uuid.UUID)
+		v2, ok := value.Value.([]uuid.UUID)
+		if !ok {
+			return ua.NilDataValue, ua.BadTypeMismatch
+		}
 		if j-i != len(v2) {
-			return ua.NilDataValue, ua.BadIndexRangeNoData
+			return ua.NilDataValue, ua.BadIndexRangeInvalid
 		}
 		dst := make([]uuid.UUID, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, sourceTimestamp, value.SourcePicoseconds, serverTimestamp, value.ServerPicoseconds), ua.Good
 	case []ua.ByteString:
 		if len(ranges) > 2 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2870,14 +4046,17 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		if status.IsBad() {
 			return ua.NilDataValue, status
 		}
-		v2 := value.Value.([]ua.ByteString)
+		v2, ok := value.Value.([]ua.ByteString)
+		if !ok {
+			return ua.NilDataValue, ua.BadTypeMismatch
+		}
 		if j-i != len(v2) {
-			return ua.NilDataValue, ua.BadIndexRangeNoData
+			return ua.NilDataValue, ua.BadIndexRangeInvalid
 		}
 		dst := make([]ua.ByteString, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, sourceTimestamp, value.SourcePicoseconds, serverTimestamp, value.ServerPicoseconds), ua.Good
 	case []ua.XMLElement:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2886,14 +4065,17 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		if status.IsBad() {
 			return ua.NilDataValue, status
 		}
-		v2 := value.Value.([]ua.XMLElement)
+		v2, ok := value.Value.([]ua.XMLElement)
+		if !ok {
+			return ua.NilDataValue, ua.BadTypeMismatch
+		}
 		if j-i != len(v2) {
-			return ua.NilDataValue, ua.BadIndexRangeNoData
+			return ua.NilDataValue, ua.BadIndexRangeInvalid
 		}
 		dst := make([]ua.XMLElement, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, sourceTimestamp, value.SourcePicoseconds, serverTimestamp, value.ServerPicoseconds), ua.Good
 	case []ua.NodeID:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2902,14 +4084,17 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		if status.IsBad() {
 			return ua.NilDataValue, status
 		}
-		v2 := value.Value.([]ua.NodeID)
+		v2, ok := value.Value.([]ua.NodeID)
+		if !ok {
+			return ua.NilDataValue, ua.BadTypeMismatch
+		}
 		if j-i != len(v2) {
-			return ua.NilDataValue, ua.BadIndexRangeNoData
+			return ua.NilDataValue, ua.BadIndexRangeInvalid
 		}
 		dst := make([]ua.NodeID, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, sourceTimestamp, value.SourcePicoseconds, serverTimestamp, value.ServerPicoseconds), ua.Good
 	case []ua.ExpandedNodeID:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2918,14 +4103,17 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		if status.IsBad() {
 			return ua.NilDataValue, status
 		}
-		v2 := value.Value.([]ua.ExpandedNodeID)
+		v2, ok := value.Value.([]ua.ExpandedNodeID)
+		if !ok {
+			return ua.NilDataValue, ua.BadTypeMismatch
+		}
 		if j-i != len(v2) {
-			return ua.NilDataValue, ua.BadIndexRangeNoData
+			return ua.NilDataValue, ua.BadIndexRangeInvalid
 		}
 		dst := make([]ua.ExpandedNodeID, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, sourceTimestamp, value.SourcePicoseconds, serverTimestamp, value.ServerPicoseconds), ua.Good
 	case []ua.StatusCode:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2934,14 +4122,17 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		if status.IsBad() {
 			return ua.NilDataValue, status
 		}
-		v2 := value.Value.([]ua.StatusCode)
+		v2, ok := value.Value.([]ua.StatusCode)
+		if !ok {
+			return ua.NilDataValue, ua.BadTypeMismatch
+		}
 		if j-i != len(v2) {
-			return ua.NilDataValue, ua.BadIndexRangeNoData
+			return ua.NilDataValue, ua.BadIndexRangeInvalid
 		}
 		dst := make([]ua.StatusCode, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, sourceTimestamp, value.SourcePicoseconds, serverTimestamp, value.ServerPicoseconds), ua.Good
 	case []ua.QualifiedName:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2950,14 +4141,17 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		if status.IsBad() {
 			return ua.NilDataValue, status
 		}
-		v2 := value.Value.([]ua.QualifiedName)
+		v2, ok := value.Value.([]ua.QualifiedName)
+		if !ok {
+			return ua.NilDataValue, ua.BadTypeMismatch
+		}
 		if j-i != len(v2) {
-			return ua.NilDataValue, ua.BadIndexRangeNoData
+			return ua.NilDataValue, ua.BadIndexRangeInvalid
 		}
 		dst := make([]ua.QualifiedName, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, sourceTimestamp, value.SourcePicoseconds, serverTimestamp, value.ServerPicoseconds), ua.Good
 	case []ua.LocalizedText:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2966,14 +4160,17 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		if status.IsBad() {
 			return ua.NilDataValue, status
 		}
-		v2 := value.Value.([]ua.LocalizedText)
+		v2, ok := value.Value.([]ua.LocalizedText)
+		if !ok {
+			return ua.NilDataValue, ua.BadTypeMismatch
+		}
 		if j-i != len(v2) {
-			return ua.NilDataValue, ua.BadIndexRangeNoData
+			return ua.NilDataValue, ua.BadIndexRangeInvalid
 		}
 		dst := make([]ua.LocalizedText, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, sourceTimestamp, value.SourcePicoseconds, serverTimestamp, value.ServerPicoseconds), ua.Good
 	case []ua.ExtensionObject:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2982,14 +4179,17 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		if status.IsBad() {
 			return ua.NilDataValue, status
 		}
-		v2 := value.Value.([]ua.ExtensionObject)
+		v2, ok := value.Value.([]ua.ExtensionObject)
+		if !ok {
+			return ua.NilDataValue, ua.BadTypeMismatch
+		}
 		if j-i != len(v2) {
-			return ua.NilDataValue, ua.BadIndexRangeNoData
+			return ua.NilDataValue, ua.BadIndexRangeInvalid
 		}
 		dst := make([]ua.ExtensionObject, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, sourceTimestamp, value.SourcePicoseconds, serverTimestamp, value.ServerPicoseconds), ua.Good
 	case []ua.DataValue:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -2998,14 +4198,17 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		if status.IsBad() {
 			return ua.NilDataValue, status
 		}
-		v2 := value.Value.([]ua.DataValue)
+		v2, ok := value.Value.([]ua.DataValue)
+		if !ok {
+			return ua.NilDataValue, ua.BadTypeMismatch
+		}
 		if j-i != len(v2) {
-			return ua.NilDataValue, ua.BadIndexRangeNoData
+			return ua.NilDataValue, ua.BadIndexRangeInvalid
 		}
 		dst := make([]ua.DataValue, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, sourceTimestamp, value.SourcePicoseconds, serverTimestamp, value.ServerPicoseconds), ua.Good
 	case []ua.Variant:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -3014,14 +4217,17 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		if status.IsBad() {
 			return ua.NilDataValue, status
 		}
-		v2 := value.Value.([]ua.Variant)
+		v2, ok := value.Value.([]ua.Variant)
+		if !ok {
+			return ua.NilDataValue, ua.BadTypeMismatch
+		}
 		if j-i != len(v2) {
-			return ua.NilDataValue, ua.BadIndexRangeNoData
+			return ua.NilDataValue, ua.BadIndexRangeInvalid
 		}
 		dst := make([]ua.Variant, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, sourceTimestamp, value.SourcePicoseconds, serverTimestamp, value.ServerPicoseconds), ua.Good
 	case []ua.DiagnosticInfo:
 		if len(ranges) > 1 {
 			return ua.NilDataValue, ua.BadIndexRangeNoData
@@ -3030,14 +4236,17 @@ func writeRange(source ua.DataValue, value ua.DataValue, indexRange string) (ua.
 		if status.IsBad() {
 			return ua.NilDataValue, status
 		}
-		v2 := value.Value.([]ua.DiagnosticInfo)
+		v2, ok := value.Value.([]ua.DiagnosticInfo)
+		if !ok {
+			return ua.NilDataValue, ua.BadTypeMismatch
+		}
 		if j-i != len(v2) {
-			return ua.NilDataValue, ua.BadIndexRangeNoData
+			return ua.NilDataValue, ua.BadIndexRangeInvalid
 		}
 		dst := make([]ua.DiagnosticInfo, len(src))
 		copy(dst, src)
 		copy(dst[i:j], v2)
-		return ua.NewDataValue(dst, value.StatusCode, time.Now(), 0, time.Now(), 0), ua.Good
+		return ua.NewDataValue(dst, value.StatusCode, sourceTimestamp, value.SourcePicoseconds, serverTimestamp, value.ServerPicoseconds), ua.Good
 	default:
 		return ua.NilDataValue, ua.BadIndexRangeNoData
 	}
@@ -3199,7 +4408,7 @@ func (srv *Server) handleCall(ch *serverSecureChannel, requestid uint32, req *ua
 		return nil
 	}
 	// check too many operations
-	if l > int(srv.serverCapabilities.OperationLimits.MaxNodesPerMethodCall) {
+	if exceedsOperationLimit(l, srv.serverCapabilities.OperationLimits.MaxNodesPerMethodCall) {
 		ch.Write(
 			&ua.ServiceFault{
 				ResponseHeader: ua.ResponseHeader{
@@ -3226,8 +4435,7 @@ func (srv *Server) handleCall(ch *serverSecureChannel, requestid uint32, req *ua
 		i := ii
 		wp.Submit(func() {
 			n := req.MethodsToCall[i]
-			m := srv.NamespaceManager()
-			n1, ok := m.FindNode(n.ObjectID)
+			n1, ok := srv.findNode(ctx, n.ObjectID)
 			if !ok {
 				results[i] = ua.CallMethodResult{StatusCode: ua.BadNodeIDUnknown}
 				wg.Done()
@@ -3247,7 +4455,7 @@ func (srv *Server) handleCall(ch *serverSecureChannel, requestid uint32, req *ua
 				wg.Done()
 				return
 			}
-			n2, ok := m.FindNode(n.MethodID)
+			n2, ok := srv.findNode(ctx, n.MethodID)
 			if !ok {
 				results[i] = ua.CallMethodResult{StatusCode: ua.BadNodeIDUnknown}
 				wg.Done()
@@ -3260,15 +4468,22 @@ func (srv *Server) handleCall(ch *serverSecureChannel, requestid uint32, req *ua
 				return
 			}
 			// TODO: check if method is hasComponent of object or objectType
+			// pass the NodeIDs of the nodes to the handler, not the registered NodeIDs.
+			n.ObjectID, n.MethodID = n1.NodeID(), n2.NodeID()
 			switch n3 := n2.(type) {
 			case *MethodNode:
 				if !n3.UserExecutable(ctx) {
-					results[i] = ua.CallMethodResult{StatusCode: ua.BadUserAccessDenied}
+					results[i] = ua.CallMethodResult{StatusCode: ua.BadNotExecutable}
 				} else {
-					if n3.callMethodHandler != nil {
-						results[i] = n3.callMethodHandler(ctx, n)
-					} else {
+					n3.RLock()
+					f := n3.callMethodHandler
+					n3.RUnlock()
+					if f == nil {
 						results[i] = ua.CallMethodResult{StatusCode: ua.BadNotImplemented}
+					} else if status, argsResults := srv.checkInputArguments(n3, n.InputArguments); status != ua.Good {
+						results[i] = ua.CallMethodResult{StatusCode: status, InputArgumentResults: argsResults}
+					} else {
+						results[i] = f(ctx, n)
 					}
 				}
 			default:
@@ -3277,7 +4492,7 @@ func (srv *Server) handleCall(ch *serverSecureChannel, requestid uint32, req *ua
 			wg.Done()
 		})
 	}
-	go func() {
+	srv.goSession(func() {
 		// wait until all tasks are done
 		wg.Wait()
 		ch.Write(
@@ -3290,10 +4505,205 @@ func (srv *Server) handleCall(ch *serverSecureChannel, requestid uint32, req *ua
 			},
 			requestid,
 		)
-	}()
+	})
 	return nil
 }
 
+// checkInputArguments checks the number and types of the input arguments against the InputArguments
+// property of the method. Returns BadArgumentsMissing or BadTooManyArguments if the number differs,
+// or BadInvalidArgument and the status of each argument if any type differs. A Null value is only
+// accepted for an optional argument, i.e. one referenced by HasOptionalInputArgumentDescription.
+// A method without an InputArguments property is not checked.
+func (srv *Server) checkInputArguments(method *MethodNode, values []ua.Variant) (ua.StatusCode, []ua.StatusCode) {
+	m := srv.NamespaceManager()
+	prop, ok := m.FindProperty(method, ua.ParseQualifiedName("0:InputArguments"))
+	if !ok {
+		return ua.Good, nil
+	}
+	args := []ua.Argument{}
+	if list, ok := prop.Value().Value.([]ua.ExtensionObject); ok {
+		for _, item := range list {
+			if arg, ok := item.(ua.Argument); ok {
+				args = append(args, arg)
+			}
+		}
+	}
+	optional := map[string]bool{}
+	for _, r := range method.References() {
+		if !r.IsInverse && r.ReferenceTypeID == ua.ReferenceTypeIDHasOptionalInputArgumentDescription {
+			if t, ok := m.FindNode(ua.ToNodeID(r.TargetID, srv.NamespaceUris())); ok {
+				optional[t.BrowseName().Name] = true
+			}
+		}
+	}
+	if len(values) < len(args) {
+		return ua.BadArgumentsMissing, nil
+	}
+	if len(values) > len(args) {
+		return ua.BadTooManyArguments, nil
+	}
+	opResult := ua.Good
+	argsResults := make([]ua.StatusCode, len(values))
+	for i, arg := range args {
+		if ua.IsNull(values[i]) && !optional[arg.Name] {
+			opResult = ua.BadInvalidArgument
+			argsResults[i] = ua.BadTypeMismatch
+			continue
+		}
+		if !isArgumentMatch(values[i], m.FindVariantType(arg.DataType), arg.ValueRank) {
+			opResult = ua.BadInvalidArgument
+			argsResults[i] = ua.BadTypeMismatch
+		}
+	}
+	if opResult != ua.Good {
+		return opResult, argsResults
+	}
+	return ua.Good, nil
+}
+
+// isArgumentMatch returns true if the value has the variant type and value rank of the argument.
+func isArgumentMatch(value ua.Variant, destType byte, destRank int32) bool {
+	var vt byte
+	isArray := false
+	switch value.(type) {
+	case nil, ua.Null:
+		return true
+	case bool:
+		vt = ua.VariantTypeBoolean
+	case int8:
+		vt = ua.VariantTypeSByte
+	case uint8:
+		vt = ua.VariantTypeByte
+	case int16:
+		vt = ua.VariantTypeInt16
+	case uint16:
+		vt = ua.VariantTypeUInt16
+	case int32:
+		vt = ua.VariantTypeInt32
+	case uint32:
+		vt = ua.VariantTypeUInt32
+	case int64:
+		vt = ua.VariantTypeInt64
+	case uint64:
+		vt = ua.VariantTypeUInt64
+	case float32:
+		vt = ua.VariantTypeFloat
+	case float64:
+		vt = ua.VariantTypeDouble
+	case string:
+		vt = ua.VariantTypeString
+	case time.Time:
+		vt = ua.VariantTypeDateTime
+	case uuid.UUID:
+		vt = ua.VariantTypeGUID
+	case ua.ByteString:
+		vt = ua.VariantTypeByteString
+	case ua.XMLElement:
+		vt = ua.VariantTypeXMLElement
+	case ua.NodeID:
+		vt = ua.VariantTypeNodeID
+	case ua.ExpandedNodeID:
+		vt = ua.VariantTypeExpandedNodeID
+	case ua.StatusCode:
+		vt = ua.VariantTypeStatusCode
+	case ua.QualifiedName:
+		vt = ua.VariantTypeQualifiedName
+	case ua.LocalizedText:
+		vt = ua.VariantTypeLocalizedText
+	case ua.DataValue:
+		vt = ua.VariantTypeDataValue
+	case []bool:
+		vt, isArray = ua.VariantTypeBoolean, true
+	case []int8:
+		vt, isArray = ua.VariantTypeSByte, true
+	case []uint8:
+		vt, isArray = ua.VariantTypeByte, true
+	case []int16:
+		vt, isArray = ua.VariantTypeInt16, true
+	case []uint16:
+		vt, isArray = ua.VariantTypeUInt16, true
+	case []int32:
+		vt, isArray = ua.VariantTypeInt32, true
+	case []uint32:
+		vt, isArray = ua.VariantTypeUInt32, true
+	case []int64:
+		vt, isArray = ua.VariantTypeInt64, true
+	case []uint64:
+		vt, isArray = ua.VariantTypeUInt64, true
+	case []float32:
+		vt, isArray = ua.VariantTypeFloat, true
+	case []float64:
+		vt, isArray = ua.VariantTypeDouble, true
+	case []string:
+		vt, isArray = ua.VariantTypeString, true
+	case []time.Time:
+		vt, isArray = ua.VariantTypeDateTime, true
+	case []uuid.UUID:
+		vt, isArray = ua.VariantTypeGUID, true
+	case []ua.ByteString:
+		vt, isArray = ua.VariantTypeByteString, true
+	case []ua.XMLElement:
+		vt, isArray = ua.VariantTypeXMLElement, true
+	case []ua.NodeID:
+		vt, isArray = ua.VariantTypeNodeID, true
+	case []ua.ExpandedNodeID:
+		vt, isArray = ua.VariantTypeExpandedNodeID, true
+	case []ua.StatusCode:
+		vt, isArray = ua.VariantTypeStatusCode, true
+	case []ua.QualifiedName:
+		vt, isArray = ua.VariantTypeQualifiedName, true
+	case []ua.LocalizedText:
+		vt, isArray = ua.VariantTypeLocalizedText, true
+	case []ua.ExtensionObject:
+		vt, isArray = ua.VariantTypeExtensionObject, true
+	case []ua.DataValue:
+		vt, isArray = ua.VariantTypeDataValue, true
+	case []ua.Variant:
+		vt, isArray = ua.VariantTypeVariant, true
+	default:
+		vt = ua.VariantTypeExtensionObject
+	}
+	if destType != vt && destType != ua.VariantTypeVariant {
+		return false
+	}
+	switch destRank {
+	case ua.ValueRankScalar:
+		return !isArray
+	case ua.ValueRankAny, ua.ValueRankScalarOrOneDimension:
+		return true
+	default:
+		return isArray
+	}
+}
+
+// checkDeadband returns BadDeadbandFilterInvalid if the deadband of the filter is negative, or if a
+// percent deadband exceeds 100 or is requested for a variable without an EURange property.
+func (srv *Server) checkDeadband(n *VariableNode, dcf ua.DataChangeFilter) ua.StatusCode {
+	switch ua.DeadbandType(dcf.DeadbandType) {
+	case ua.DeadbandTypeNone:
+		return ua.Good
+	case ua.DeadbandTypeAbsolute:
+		if dcf.DeadbandValue < 0 {
+			return ua.BadDeadbandFilterInvalid
+		}
+		return ua.Good
+	case ua.DeadbandTypePercent:
+		if dcf.DeadbandValue < 0 || dcf.DeadbandValue > 100 {
+			return ua.BadDeadbandFilterInvalid
+		}
+		p, ok := srv.NamespaceManager().FindProperty(n, ua.ParseQualifiedName("0:EURange"))
+		if !ok {
+			return ua.BadDeadbandFilterInvalid
+		}
+		if _, ok := p.Value().Value.(ua.Range); !ok {
+			return ua.BadDeadbandFilterInvalid
+		}
+		return ua.Good
+	default:
+		return ua.BadDeadbandFilterInvalid
+	}
+}
+
 // CreateMonitoredItems creates and adds one or more MonitoredItems to a Subscription.
 func (srv *Server) handleCreateMonitoredItems(ch *serverSecureChannel, requestid uint32, req *ua.CreateMonitoredItemsRequest) error {
 	// discovery only?
@@ -3408,7 +4818,7 @@ func (srv *Server) handleCreateMonitoredItems(ch *serverSecureChannel, requestid
 		return nil
 	}
 	// check too many operations
-	if l > int(srv.serverCapabilities.OperationLimits.MaxMonitoredItemsPerCall) {
+	if exceedsOperationLimit(l, srv.serverCapabilities.OperationLimits.MaxMonitoredItemsPerCall) {
 		ch.Write(
 			&ua.ServiceFault{
 				ResponseHeader: ua.ResponseHeader{
@@ -3426,8 +4836,15 @@ func (srv *Server) handleCreateMonitoredItems(ch *serverSecureChannel, requestid
 
 	results := make([]ua.MonitoredItemCreateResult, l)
 	minSupportedSampleRate := srv.ServerCapabilities().MinSupportedSampleRate
+	// the monitored items keep the NodeID of the node, so they outlive the NodeIDs returned by RegisterNodes.
+	items := make([]ua.MonitoredItemCreateRequest, l)
 	for i, item := range req.ItemsToCreate {
-		n, ok := srv.NamespaceManager().FindNode(item.ItemToMonitor.NodeID)
+		item.ItemToMonitor.NodeID = srv.resolveNodeID(ctx, item.ItemToMonitor.NodeID)
+		items[i] = item
+	}
+	initialValues := srv.readInitialValues(ctx, items)
+	for i, item := range items {
+		n, ok := srv.findNode(ctx, item.ItemToMonitor.NodeID)
 		if !ok {
 			results[i] = ua.MonitoredItemCreateResult{StatusCode: ua.BadNodeIDUnknown}
 			continue
@@ -3477,7 +4894,11 @@ func (srv *Server) handleCreateMonitoredItems(ch *serverSecureChannel, requestid
 					continue
 				}
 			}
-			mi := NewDataChangeMonitoredItem(ctx, sub, n, item.ItemToMonitor, item.MonitoringMode, item.RequestedParameters, req.TimestampsToReturn, minSupportedSampleRate)
+			if sc := srv.checkDeadband(n2, dcf); sc != ua.Good {
+				results[i] = ua.MonitoredItemCreateResult{StatusCode: sc}
+				continue
+			}
+			mi := newDataChangeMonitoredItem(ctx, sub, n, item.ItemToMonitor, item.MonitoringMode, item.RequestedParameters, req.TimestampsToReturn, minSupportedSampleRate, &initialValues[i])
 			sub.AppendItem(mi)
 			results[i] = ua.MonitoredItemCreateResult{
 				MonitoredItemID:         mi.ID(),
@@ -3501,17 +4922,22 @@ func (srv *Server) handleCreateMonitoredItems(ch *serverSecureChannel, requestid
 				results[i] = ua.MonitoredItemCreateResult{StatusCode: ua.BadUserAccessDenied}
 				continue
 			}
-			_, ok = item.RequestedParameters.Filter.(ua.EventFilter)
+			ef, ok := item.RequestedParameters.Filter.(ua.EventFilter)
 			if !ok {
 				results[i] = ua.MonitoredItemCreateResult{StatusCode: ua.BadFilterNotAllowed}
 				continue
 			}
+			if _, wr, ok := resolveWhereClause(srv.NamespaceManager(), ef.WhereClause); !ok {
+				results[i] = ua.MonitoredItemCreateResult{StatusCode: ua.BadEventFilterInvalid, FilterResult: ua.EventFilterResult{WhereClauseResult: wr}}
+				continue
+			}
 			mi := NewEventMonitoredItem(ctx, sub, n, item.ItemToMonitor, item.MonitoringMode, item.RequestedParameters)
 			sub.AppendItem(mi)
 			results[i] = ua.MonitoredItemCreateResult{
 				MonitoredItemID:         mi.ID(),
 				RevisedSamplingInterval: mi.SamplingInterval(),
 				RevisedQueueSize:        mi.QueueSize(),
+				FilterResult:            mi.FilterResult(),
 			}
 			continue
 		default:
@@ -3524,7 +4950,7 @@ func (srv *Server) handleCreateMonitoredItems(ch *serverSecureChannel, requestid
 				results[i] = ua.MonitoredItemCreateResult{StatusCode: ua.BadFilterNotAllowed}
 				continue
 			}
-			mi := NewDataChangeMonitoredItem(ctx, sub, n, item.ItemToMonitor, item.MonitoringMode, item.RequestedParameters, req.TimestampsToReturn, minSupportedSampleRate)
+			mi := newDataChangeMonitoredItem(ctx, sub, n, item.ItemToMonitor, item.MonitoringMode, item.RequestedParameters, req.TimestampsToReturn, minSupportedSampleRate, &initialValues[i])
 			sub.AppendItem(mi)
 			results[i] = ua.MonitoredItemCreateResult{
 				MonitoredItemID:         mi.ID(),
@@ -3662,7 +5088,7 @@ func (srv *Server) handleModifyMonitoredItems(ch *serverSecureChannel, requestid
 		return nil
 	}
 	// check too many operations
-	if l > int(srv.serverCapabilities.OperationLimits.MaxMonitoredItemsPerCall) {
+	if exceedsOperationLimit(l, srv.serverCapabilities.OperationLimits.MaxMonitoredItemsPerCall) {
 		ch.Write(
 			&ua.ServiceFault{
 				ResponseHeader: ua.ResponseHeader{
@@ -3705,17 +5131,25 @@ func (srv *Server) handleModifyMonitoredItems(ch *serverSecureChannel, requestid
 						continue
 					}
 				}
+				if sc := srv.checkDeadband(item.Node().(*VariableNode), dcf); sc != ua.Good {
+					results[i] = ua.MonitoredItemModifyResult{StatusCode: sc}
+					continue
+				}
 				results[i] = item.Modify(ctx, modifyReq)
 				continue
 			case attr == ua.AttributeIDEventNotifier:
 				if modifyReq.RequestedParameters.Filter == nil {
 					modifyReq.RequestedParameters.Filter = ua.EventFilter{} // TODO: get EventBase select clause
 				}
-				_, ok := modifyReq.RequestedParameters.Filter.(ua.EventFilter)
+				ef, ok := modifyReq.RequestedParameters.Filter.(ua.EventFilter)
 				if !ok {
 					results[i] = ua.MonitoredItemModifyResult{StatusCode: ua.BadFilterNotAllowed}
 					continue
 				}
+				if _, wr, ok := resolveWhereClause(srv.NamespaceManager(), ef.WhereClause); !ok {
+					results[i] = ua.MonitoredItemModifyResult{StatusCode: ua.BadEventFilterInvalid, FilterResult: ua.EventFilterResult{WhereClauseResult: wr}}
+					continue
+				}
 				results[i] = item.Modify(ctx, modifyReq)
 				continue
 			default:
@@ -3842,7 +5276,7 @@ func (srv *Server) handleSetMonitoringMode(ch *serverSecureChannel, requestid ui
 		return nil
 	}
 	// check too many operations
-	if l > int(srv.serverCapabilities.OperationLimits.MaxMonitoredItemsPerCall) {
+	if exceedsOperationLimit(l, srv.serverCapabilities.OperationLimits.MaxMonitoredItemsPerCall) {
 		ch.Write(
 			&ua.ServiceFault{
 				ResponseHeader: ua.ResponseHeader{
@@ -3948,7 +5382,26 @@ func (srv *Server) handleSetTriggering(ch *serverSecureChannel, requestid uint32
 				ResponseHeader: ua.ResponseHeader{
 					Timestamp:     time.Now(),
 					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadSubscriptionIDInvalid,
+					ServiceResult: ua.BadSubscriptionIDInvalid,
+				},
+			},
+			requestid,
+		)
+		session.setTriggeringErrorCount++
+		session.errorCount++
+		return nil
+	}
+	sub.Lock()
+	sub.lifetimeCounter = 0
+	sub.Unlock()
+
+	if len(req.LinksToRemove) == 0 && len(req.LinksToAdd) == 0 {
+		ch.Write(
+			&ua.ServiceFault{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadNothingToDo,
 				},
 			},
 			requestid,
@@ -3957,17 +5410,14 @@ func (srv *Server) handleSetTriggering(ch *serverSecureChannel, requestid uint32
 		session.errorCount++
 		return nil
 	}
-	sub.Lock()
-	sub.lifetimeCounter = 0
-	sub.Unlock()
-
-	if len(req.LinksToRemove) == 0 && len(req.LinksToAdd) == 0 {
+	// check too many operations
+	if max := srv.serverCapabilities.OperationLimits.MaxMonitoredItemsPerCall; exceedsOperationLimit(len(req.LinksToRemove), max) || exceedsOperationLimit(len(req.LinksToAdd), max) {
 		ch.Write(
 			&ua.ServiceFault{
 				ResponseHeader: ua.ResponseHeader{
 					Timestamp:     time.Now(),
 					RequestHandle: req.RequestHandle,
-					ServiceResult: ua.BadNothingToDo,
+					ServiceResult: ua.BadTooManyOperations,
 				},
 			},
 			requestid,
@@ -4134,7 +5584,7 @@ func (srv *Server) handleDeleteMonitoredItems(ch *serverSecureChannel, requestid
 		return nil
 	}
 	// check too many operations
-	if l > int(srv.serverCapabilities.OperationLimits.MaxMonitoredItemsPerCall) {
+	if exceedsOperationLimit(l, srv.serverCapabilities.OperationLimits.MaxMonitoredItemsPerCall) {
 		ch.Write(
 			&ua.ServiceFault{
 				ResponseHeader: ua.ResponseHeader{
@@ -4408,7 +5858,11 @@ func (srv *Server) handleModifySubscription(ch *serverSecureChannel, requestid u
 		return nil
 	}
 
+	// the new publishing interval takes effect on the next cycle. queued notifications are retained.
 	sub.Modify(req.RequestedPublishingInterval, req.RequestedLifetimeCount, req.RequestedMaxKeepAliveCount, req.MaxNotificationsPerPublish, req.Priority)
+	sub.RLock()
+	publishingInterval, lifetimeCount, maxKeepAliveCount := sub.publishingInterval, sub.lifetimeCount, sub.maxKeepAliveCount
+	sub.RUnlock()
 
 	ch.Write(
 		&ua.ModifySubscriptionResponse{
@@ -4416,9 +5870,9 @@ func (srv *Server) handleModifySubscription(ch *serverSecureChannel, requestid u
 				Timestamp:     time.Now(),
 				RequestHandle: req.RequestHeader.RequestHandle,
 			},
-			RevisedPublishingInterval: sub.publishingInterval,
-			RevisedLifetimeCount:      sub.lifetimeCount,
-			RevisedMaxKeepAliveCount:  sub.maxKeepAliveCount,
+			RevisedPublishingInterval: publishingInterval,
+			RevisedLifetimeCount:      lifetimeCount,
+			RevisedMaxKeepAliveCount:  maxKeepAliveCount,
 		},
 		requestid,
 	)
@@ -4508,6 +5962,110 @@ func (srv *Server) handleSetPublishingMode(ch *serverSecureChannel, requestid ui
 }
 
 // TransferSubscriptions transfers a Subscription and its MonitoredItems from one Session to another.
+func (srv *Server) handleTransferSubscriptions(ch *serverSecureChannel, requestid uint32, req *ua.TransferSubscriptionsRequest) error {
+	// discovery only?
+	if ch.discoveryOnly {
+		ch.Abort(ua.BadSecurityPolicyRejected, "")
+		return nil
+	}
+	// get session
+	session, ok := srv.SessionManager().Get(req.AuthenticationToken)
+	if !ok {
+		ch.Write(
+			&ua.ServiceFault{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadSessionIDInvalid,
+				},
+			},
+			requestid,
+		)
+		return nil
+	}
+	session.transferSubscriptionsCount++
+	session.requestCount++
+	// check channelId
+	id := session.SecureChannelId()
+	if id == 0 {
+		srv.SessionManager().Delete(session)
+		ch.Write(
+			&ua.ServiceFault{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadSessionNotActivated,
+				},
+			},
+			requestid,
+		)
+		session.transferSubscriptionsErrorCount++
+		session.errorCount++
+		return nil
+	}
+	if id != ch.ChannelID() {
+		ch.Write(
+			&ua.ServiceFault{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadSecureChannelIDInvalid,
+				},
+			},
+			requestid,
+		)
+		session.transferSubscriptionsErrorCount++
+		session.errorCount++
+		return nil
+	}
+
+	l := len(req.SubscriptionIDs)
+	if l == 0 {
+		ch.Write(
+			&ua.ServiceFault{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHandle,
+					ServiceResult: ua.BadNothingToDo,
+				},
+			},
+			requestid,
+		)
+		session.transferSubscriptionsErrorCount++
+		session.errorCount++
+		return nil
+	}
+
+	results := make([]ua.TransferResult, l)
+	sm := srv.SubscriptionManager()
+	for i, id := range req.SubscriptionIDs {
+		s, ok := sm.Get(id)
+		if !ok {
+			results[i] = ua.TransferResult{StatusCode: ua.BadSubscriptionIDInvalid}
+			continue
+		}
+		// only the user that created the subscription may transfer it.
+		if !s.isOwner(session) {
+			results[i] = ua.TransferResult{StatusCode: ua.BadUserAccessDenied}
+			continue
+		}
+		results[i] = ua.TransferResult{
+			StatusCode:               ua.Good,
+			AvailableSequenceNumbers: sm.Transfer(s, session, req.SendInitialValues),
+		}
+	}
+	ch.Write(
+		&ua.TransferSubscriptionsResponse{
+			ResponseHeader: ua.ResponseHeader{
+				Timestamp:     time.Now(),
+				RequestHandle: req.RequestHeader.RequestHandle,
+			},
+			Results: results,
+		},
+		requestid,
+	)
+	return nil
+}
 
 // DeleteSubscriptions deletes one or more Subscriptions.
 func (srv *Server) handleDeleteSubscriptions(ch *serverSecureChannel, requestid uint32, req *ua.DeleteSubscriptionsRequest) error {
@@ -4690,11 +6248,7 @@ func (srv *Server) handlePublish(ch *serverSecureChannel, requestid uint32, req
 	results := make([]ua.StatusCode, len(req.SubscriptionAcknowledgements))
 	for i, sa := range req.SubscriptionAcknowledgements {
 		if sub, ok := sm.Get(sa.SubscriptionID); ok {
-			if sub.acknowledge(sa.SequenceNumber) {
-				results[i] = ua.Good
-			} else {
-				results[i] = ua.BadSequenceNumberUnknown
-			}
+			results[i] = sub.acknowledge(sa.SequenceNumber)
 		} else {
 			results[i] = ua.BadSubscriptionIDInvalid
 		}
@@ -4703,18 +6257,6 @@ func (srv *Server) handlePublish(ch *serverSecureChannel, requestid uint32, req
 	// process status changes
 	select {
 	case op := <-session.stateChanges:
-		// q := s.retransmissionQueue
-		// for e := q.Front(); e != nil && q.Len() >= maxRetransmissionQueueLength; e = e.Next() {
-		// 	q.Remove(e)
-		// }
-		// nm := op.message
-		// q.PushBack(nm)
-		// avail := make([]uint32, 0, 4)
-		// for e := q.Front(); e != nil; e = e.Next() {
-		// 	if nm, ok := e.Value.(*NotificationMessage); ok {
-		// 		avail = append(avail, nm.SequenceNumber)
-		// 	}
-		// }
 		ch.Write(
 			&ua.PublishResponse{
 				ResponseHeader: ua.ResponseHeader{
@@ -4846,26 +6388,26 @@ func (srv *Server) handleRepublish(ch *serverSecureChannel, requestid uint32, re
 
 	s.republishRequestCount++
 	s.republishMessageRequestCount++
-	q := s.retransmissionQueue
-	for e := q.Front(); e != nil; e = e.Next() {
-		if nm, ok := e.Value.(ua.NotificationMessage); ok {
-			if req.RetransmitSequenceNumber == nm.SequenceNumber {
-				ch.Write(
-					&ua.RepublishResponse{
-						ResponseHeader: ua.ResponseHeader{
-							Timestamp:     time.Now(),
-							RequestHandle: req.RequestHeader.RequestHandle,
-						},
-						NotificationMessage: nm,
-					},
-					requestid,
-				)
-				s.republishMessageCount++
-				q.Remove(e)
-				e.Value = nil
-				return nil
-			}
+	nm, err := s.notificationStore.Get(s.key, req.RetransmitSequenceNumber)
+	if err == nil {
+		ch.Write(
+			&ua.RepublishResponse{
+				ResponseHeader: ua.ResponseHeader{
+					Timestamp:     time.Now(),
+					RequestHandle: req.RequestHeader.RequestHandle,
+				},
+				NotificationMessage: nm,
+			},
+			requestid,
+		)
+		s.republishMessageCount++
+		if err := s.notificationStore.Ack(s.key, req.RetransmitSequenceNumber); err != nil {
+			ch.logger.Error("Error acknowledging notification message", ua.SubscriptionIDAttr(s.id), ua.StatusCodeAttr(err))
 		}
+		return nil
+	}
+	if code, ok := err.(ua.StatusCode); !ok || code != ua.BadMessageNotAvailable {
+		ch.logger.Error("Error reading notification message", ua.SubscriptionIDAttr(s.id), ua.StatusCodeAttr(err))
 	}
 	ch.Write(
 		&ua.ServiceFault{
@@ -4882,28 +6424,173 @@ func (srv *Server) handleRepublish(ch *serverSecureChannel, requestid uint32, re
 	return nil
 }
 
-// WriteValue writes the value of the attribute.
+// writeValue writes the value of the attribute.
 func (srv *Server) writeValue(ctx context.Context, writeValue ua.WriteValue) ua.StatusCode {
-	n, ok := srv.NamespaceManager().FindNode(writeValue.NodeID)
+	n, audited := srv.auditedNode(ctx, writeValue.NodeID)
+	var oldValue ua.Variant
+	if audited {
+		oldValue = auditValue(n, writeValue.AttributeID)
+	}
+	writeValue, status := srv.checkWriteValue(ctx, writeValue)
+	if status == ua.Good {
+		status = srv.applyWriteValue(ctx, writeValue)
+	}
+	if audited {
+		srv.auditWrite(ctx, n, writeValue, oldValue, status)
+	}
+	return status
+}
+
+// writeValues writes the values transactionally. The values are written only if every value passes
+// the checks of the node, otherwise no value is written and the operations that passed return
+// BadOperationAbandoned. If a write fails after the checks, the values already written are restored,
+// without notifying the handlers, historian and monitored items again. The side effects of a custom
+// write handler are not undone. Other writes by clients wait until the transaction completes.
+func (srv *Server) writeValues(ctx context.Context, nodesToWrite []ua.WriteValue, diagnostics *diagnosticsBuilder) []ua.StatusCode {
+	srv.transactionLock.Lock()
+	defer srv.transactionLock.Unlock()
+	results := make([]ua.StatusCode, len(nodesToWrite))
+	checked := make([]ua.WriteValue, len(nodesToWrite))
+	audited := make([]*VariableNode, len(nodesToWrite))
+	oldValues := make([]ua.Variant, len(nodesToWrite))
+	failed := false
+	for i, n := range nodesToWrite {
+		if n1, ok := srv.auditedNode(ctx, n.NodeID); ok {
+			audited[i], oldValues[i] = n1, auditValue(n1, n.AttributeID)
+		}
+		checked[i], results[i] = srv.checkWriteValue(diagnostics.context(ctx, i), n)
+		failed = failed || results[i] != ua.Good
+	}
+	if !failed {
+		undo := make([]func(), 0, len(checked))
+		for i, n := range checked {
+			restore := srv.restoreFunc(n)
+			if results[i] = srv.applyWriteValue(diagnostics.context(ctx, i), n); results[i] != ua.Good {
+				failed = true
+				break
+			}
+			undo = append(undo, restore)
+		}
+		if failed {
+			for i := len(undo) - 1; i >= 0; i-- {
+				undo[i]()
+			}
+		}
+	}
+	if failed {
+		for i, result := range results {
+			if result == ua.Good {
+				results[i] = ua.BadOperationAbandoned
+			}
+		}
+	}
+	for i, n := range audited {
+		if n != nil {
+			srv.auditWrite(diagnostics.context(ctx, i), n, checked[i], oldValues[i], results[i])
+		}
+	}
+	return results
+}
+
+// restoreFunc returns a func that restores the current value of the attribute.
+func (srv *Server) restoreFunc(writeValue ua.WriteValue) func() {
+	n, ok := srv.NamespaceManager().FindVariable(writeValue.NodeID)
+	if !ok {
+		return func() {}
+	}
+	switch writeValue.AttributeID {
+	case ua.AttributeIDValue:
+		n.RLock()
+		v, valueSet := n.value, n.valueSet
+		n.RUnlock()
+		return func() { n.restoreValue(v, valueSet) }
+	case ua.AttributeIDHistorizing:
+		v := n.Historizing()
+		return func() { n.SetHistorizing(v) }
+	case ua.AttributeIDDisplayName:
+		v := n.DisplayName()
+		return func() { n.SetDisplayName(v) }
+	case ua.AttributeIDDescription:
+		v := n.Description()
+		return func() { n.SetDescription(v) }
+	default:
+		return func() {}
+	}
+}
+
+// applyWriteValue writes the value of the attribute. The value must have passed checkWriteValue.
+func (srv *Server) applyWriteValue(ctx context.Context, writeValue ua.WriteValue) ua.StatusCode {
+	n1, ok := srv.NamespaceManager().FindVariable(writeValue.NodeID)
 	if !ok {
 		return ua.BadNodeIDUnknown
 	}
+	switch writeValue.AttributeID {
+	case ua.AttributeIDValue:
+		if f := n1.writeValueHandler; f != nil {
+			result, status := f(ctx, writeValue)
+			n1.clearReadCache()
+			if status == ua.Good {
+				n1.SetValue(result)
+			}
+			return status
+		}
+		return n1.SetValueRange(writeValue.Value, writeValue.IndexRange)
+	case ua.AttributeIDHistorizing:
+		v, _ := writeValue.Value.Value.(bool)
+		if n1.Historizing() && !v && !srv.retainHistory {
+			if d, ok := n1.Historian().(HistoryDeleter); ok {
+				if err := d.DeleteRawModified(ctx, n1.NodeID(), time.Time{}, time.Time{}); err != nil {
+					return ua.BadHistoryOperationInvalid
+				}
+			}
+		}
+		n1.SetHistorizing(v)
+		return ua.Good
+	case ua.AttributeIDDisplayName:
+		v, _ := writeValue.Value.Value.(ua.LocalizedText)
+		n1.SetDisplayName(v)
+		return ua.Good
+	case ua.AttributeIDDescription:
+		v, _ := writeValue.Value.Value.(ua.LocalizedText)
+		n1.SetDescription(v)
+		return ua.Good
+	default:
+		return ua.BadAttributeIDInvalid
+	}
+}
+
+// checkWriteValue checks that the value may be written to the attribute. Returns the value,
+// converted to the data type of the variable if needed.
+func (srv *Server) checkWriteValue(ctx context.Context, writeValue ua.WriteValue) (ua.WriteValue, ua.StatusCode) {
+	n, ok := srv.findNode(ctx, writeValue.NodeID)
+	if !ok {
+		return writeValue, ua.BadNodeIDUnknown
+	}
+	writeValue.NodeID = n.NodeID()
 	rp := n.UserRolePermissions(ctx)
 	if !IsUserPermitted(rp, ua.PermissionTypeBrowse) {
-		return ua.BadNodeIDUnknown
+		return writeValue, ua.BadNodeIDUnknown
 	}
 	switch writeValue.AttributeID {
 	case ua.AttributeIDValue:
 		switch n1 := n.(type) {
 		case *VariableNode:
-			// if writeValue.Value.StatusCode != Good || !time.Time.IsZero(writeValue.Value.ServerTimestamp) || !time.Time.IsZero(writeValue.Value.SourceTimestamp) {
-			// 	return ua.BadWriteNotSupported
-			// }
+			// check access level before any custom write handler is invoked.
 			if (n1.AccessLevel() & ua.AccessLevelsCurrentWrite) == 0 {
-				return ua.BadNotWritable
+				return writeValue, ua.BadNotWritable
 			}
 			if (n1.UserAccessLevel(ctx) & ua.AccessLevelsCurrentWrite) == 0 {
-				return ua.BadUserAccessDenied
+				return writeValue, ua.BadUserAccessDenied
+			}
+			// a status or timestamps may only be written if the access level allows it.
+			if writeValue.Value.StatusCode != ua.Good && n1.AccessLevel()&ua.AccessLevelsStatusWrite == 0 {
+				return writeValue, ua.BadWriteNotSupported
+			}
+			if (!writeValue.Value.SourceTimestamp.IsZero() || !writeValue.Value.ServerTimestamp.IsZero()) && n1.AccessLevel()&ua.AccessLevelsTimestampWrite == 0 {
+				return writeValue, ua.BadWriteNotSupported
+			}
+			if writeValue.IndexRange != "" && n1.AccessLevelEx()&uint32(ua.AccessLevelExTypeWriteFullArrayOnly) != 0 {
+				return writeValue, ua.BadWriteNotSupported
 			}
 			// check data type
 			destType := srv.NamespaceManager().FindVariantType(n1.DataType())
@@ -4921,459 +6608,604 @@ func (srv *Server) writeValue(ctx context.Context, writeValue ua.WriteValue) ua.
 				}
 			}
 			switch v2 := writeValue.Value.Value.(type) {
-			case nil:
+			case nil, ua.Null:
 			case bool:
 				if destType != ua.VariantTypeBoolean && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankScalar && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case int8:
 				if destType != ua.VariantTypeSByte && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankScalar && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case uint8:
 				if destType != ua.VariantTypeByte && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankScalar && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case int16:
 				if destType != ua.VariantTypeInt16 && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankScalar && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case uint16:
 				if destType != ua.VariantTypeUInt16 && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankScalar && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case int32:
 				if destType != ua.VariantTypeInt32 && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankScalar && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case uint32:
 				if destType != ua.VariantTypeUInt32 && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankScalar && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case int64:
 				if destType != ua.VariantTypeInt64 && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankScalar && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case uint64:
 				if destType != ua.VariantTypeUInt64 && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankScalar && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case float32:
 				if destType != ua.VariantTypeFloat && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankScalar && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case float64:
 				if destType != ua.VariantTypeDouble && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankScalar && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case string:
-				if len(v2) > int(srv.serverCapabilities.MaxStringLength) {
-					return ua.BadOutOfRange
+				if n := srv.serverCapabilities.MaxStringLength; n > 0 && len(v2) > int(n) {
+					return writeValue, ua.BadOutOfRange
 				}
 				if destType != ua.VariantTypeString && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankScalar && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case time.Time:
 				if destType != ua.VariantTypeDateTime && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankScalar && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case uuid.UUID:
 				if destType != ua.VariantTypeGUID && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankScalar && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case ua.ByteString:
-				if len(v2) > int(srv.serverCapabilities.MaxByteStringLength) {
-					return ua.BadOutOfRange
+				if n := srv.serverCapabilities.MaxByteStringLength; n > 0 && len(v2) > int(n) {
+					return writeValue, ua.BadOutOfRange
 				}
 				if destType != ua.VariantTypeByteString && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankScalar && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case ua.XMLElement:
 				if destType != ua.VariantTypeXMLElement && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankScalar && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case ua.NodeID:
 				if destType != ua.VariantTypeNodeID && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankScalar && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case ua.ExpandedNodeID:
 				if destType != ua.VariantTypeExpandedNodeID && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankScalar && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case ua.StatusCode:
 				if destType != ua.VariantTypeStatusCode && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankScalar && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case ua.QualifiedName:
 				if destType != ua.VariantTypeQualifiedName && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankScalar && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case ua.LocalizedText:
 				if destType != ua.VariantTypeLocalizedText && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankScalar && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case []bool:
-				if len(v2) > int(srv.serverCapabilities.MaxArrayLength) {
-					return ua.BadOutOfRange
+				if n := srv.serverCapabilities.MaxArrayLength; n > 0 && len(v2) > int(n) {
+					return writeValue, ua.BadOutOfRange
 				}
 				if destType != ua.VariantTypeBoolean && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankOneDimension && destRank != ua.ValueRankOneOrMoreDimensions && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case []int8:
-				if len(v2) > int(srv.serverCapabilities.MaxArrayLength) {
-					return ua.BadOutOfRange
+				if n := srv.serverCapabilities.MaxArrayLength; n > 0 && len(v2) > int(n) {
+					return writeValue, ua.BadOutOfRange
 				}
 				if destType != ua.VariantTypeSByte && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankOneDimension && destRank != ua.ValueRankOneOrMoreDimensions && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case []uint8:
-				if len(v2) > int(srv.serverCapabilities.MaxArrayLength) {
-					return ua.BadOutOfRange
+				if n := srv.serverCapabilities.MaxArrayLength; n > 0 && len(v2) > int(n) {
+					return writeValue, ua.BadOutOfRange
 				}
 				if destType != ua.VariantTypeByte && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankOneDimension && destRank != ua.ValueRankOneOrMoreDimensions && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case []int16:
-				if len(v2) > int(srv.serverCapabilities.MaxArrayLength) {
-					return ua.BadOutOfRange
+				if n := srv.serverCapabilities.MaxArrayLength; n > 0 && len(v2) > int(n) {
+					return writeValue, ua.BadOutOfRange
 				}
 				if destType != ua.VariantTypeInt16 && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankOneDimension && destRank != ua.ValueRankOneOrMoreDimensions && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case []uint16:
-				if len(v2) > int(srv.serverCapabilities.MaxArrayLength) {
-					return ua.BadOutOfRange
+				if n := srv.serverCapabilities.MaxArrayLength; n > 0 && len(v2) > int(n) {
+					return writeValue, ua.BadOutOfRange
 				}
 				if destType != ua.VariantTypeUInt16 && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankOneDimension && destRank != ua.ValueRankOneOrMoreDimensions && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case []int32:
-				if len(v2) > int(srv.serverCapabilities.MaxArrayLength) {
-					return ua.BadOutOfRange
+				if n := srv.serverCapabilities.MaxArrayLength; n > 0 && len(v2) > int(n) {
+					return writeValue, ua.BadOutOfRange
 				}
 				if destType != ua.VariantTypeInt32 && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankOneDimension && destRank != ua.ValueRankOneOrMoreDimensions && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case []uint32:
-				if len(v2) > int(srv.serverCapabilities.MaxArrayLength) {
-					return ua.BadOutOfRange
+				if n := srv.serverCapabilities.MaxArrayLength; n > 0 && len(v2) > int(n) {
+					return writeValue, ua.BadOutOfRange
 				}
 				if destType != ua.VariantTypeUInt32 && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankOneDimension && destRank != ua.ValueRankOneOrMoreDimensions && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case []int64:
-				if len(v2) > int(srv.serverCapabilities.MaxArrayLength) {
-					return ua.BadOutOfRange
+				if n := srv.serverCapabilities.MaxArrayLength; n > 0 && len(v2) > int(n) {
+					return writeValue, ua.BadOutOfRange
 				}
 				if destType != ua.VariantTypeInt64 && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankOneDimension && destRank != ua.ValueRankOneOrMoreDimensions && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case []uint64:
-				if len(v2) > int(srv.serverCapabilities.MaxArrayLength) {
-					return ua.BadOutOfRange
+				if n := srv.serverCapabilities.MaxArrayLength; n > 0 && len(v2) > int(n) {
+					return writeValue, ua.BadOutOfRange
 				}
 				if destType != ua.VariantTypeUInt64 && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankOneDimension && destRank != ua.ValueRankOneOrMoreDimensions && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case []float32:
-				if len(v2) > int(srv.serverCapabilities.MaxArrayLength) {
-					return ua.BadOutOfRange
+				if n := srv.serverCapabilities.MaxArrayLength; n > 0 && len(v2) > int(n) {
+					return writeValue, ua.BadOutOfRange
 				}
 				if destType != ua.VariantTypeFloat && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankOneDimension && destRank != ua.ValueRankOneOrMoreDimensions && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case []float64:
-				if len(v2) > int(srv.serverCapabilities.MaxArrayLength) {
-					return ua.BadOutOfRange
+				if n := srv.serverCapabilities.MaxArrayLength; n > 0 && len(v2) > int(n) {
+					return writeValue, ua.BadOutOfRange
 				}
 				if destType != ua.VariantTypeDouble && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankOneDimension && destRank != ua.ValueRankOneOrMoreDimensions && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case []string:
-				if len(v2) > int(srv.serverCapabilities.MaxArrayLength) {
-					return ua.BadOutOfRange
+				if n := srv.serverCapabilities.MaxArrayLength; n > 0 && len(v2) > int(n) {
+					return writeValue, ua.BadOutOfRange
 				}
 				if destType != ua.VariantTypeString && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankOneDimension && destRank != ua.ValueRankOneOrMoreDimensions && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case []time.Time:
-				if len(v2) > int(srv.serverCapabilities.MaxArrayLength) {
-					return ua.BadOutOfRange
+				if n := srv.serverCapabilities.MaxArrayLength; n > 0 && len(v2) > int(n) {
+					return writeValue, ua.BadOutOfRange
 				}
 				if destType != ua.VariantTypeDateTime && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankOneDimension && destRank != ua.ValueRankOneOrMoreDimensions && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case []uuid.UUID:
-				if len(v2) > int(srv.serverCapabilities.MaxArrayLength) {
-					return ua.BadOutOfRange
+				if n := srv.serverCapabilities.MaxArrayLength; n > 0 && len(v2) > int(n) {
+					return writeValue, ua.BadOutOfRange
 				}
 				if destType != ua.VariantTypeGUID && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankOneDimension && destRank != ua.ValueRankOneOrMoreDimensions && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case []ua.ByteString:
-				if len(v2) > int(srv.serverCapabilities.MaxArrayLength) {
-					return ua.BadOutOfRange
+				if n := srv.serverCapabilities.MaxArrayLength; n > 0 && len(v2) > int(n) {
+					return writeValue, ua.BadOutOfRange
 				}
 				if destType != ua.VariantTypeByteString && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankOneDimension && destRank != ua.ValueRankOneOrMoreDimensions && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case []ua.XMLElement:
-				if len(v2) > int(srv.serverCapabilities.MaxArrayLength) {
-					return ua.BadOutOfRange
+				if n := srv.serverCapabilities.MaxArrayLength; n > 0 && len(v2) > int(n) {
+					return writeValue, ua.BadOutOfRange
 				}
 				if destType != ua.VariantTypeXMLElement && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankOneDimension && destRank != ua.ValueRankOneOrMoreDimensions && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case []ua.NodeID:
-				if len(v2) > int(srv.serverCapabilities.MaxArrayLength) {
-					return ua.BadOutOfRange
+				if n := srv.serverCapabilities.MaxArrayLength; n > 0 && len(v2) > int(n) {
+					return writeValue, ua.BadOutOfRange
 				}
 				if destType != ua.VariantTypeNodeID && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankOneDimension && destRank != ua.ValueRankOneOrMoreDimensions && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case []ua.ExpandedNodeID:
-				if len(v2) > int(srv.serverCapabilities.MaxArrayLength) {
-					return ua.BadOutOfRange
+				if n := srv.serverCapabilities.MaxArrayLength; n > 0 && len(v2) > int(n) {
+					return writeValue, ua.BadOutOfRange
 				}
 				if destType != ua.VariantTypeExpandedNodeID && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankOneDimension && destRank != ua.ValueRankOneOrMoreDimensions && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case []ua.StatusCode:
-				if len(v2) > int(srv.serverCapabilities.MaxArrayLength) {
-					return ua.BadOutOfRange
+				if n := srv.serverCapabilities.MaxArrayLength; n > 0 && len(v2) > int(n) {
+					return writeValue, ua.BadOutOfRange
 				}
 				if destType != ua.VariantTypeStatusCode && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankOneDimension && destRank != ua.ValueRankOneOrMoreDimensions && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case []ua.QualifiedName:
-				if len(v2) > int(srv.serverCapabilities.MaxArrayLength) {
-					return ua.BadOutOfRange
+				if n := srv.serverCapabilities.MaxArrayLength; n > 0 && len(v2) > int(n) {
+					return writeValue, ua.BadOutOfRange
 				}
 				if destType != ua.VariantTypeQualifiedName && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankOneDimension && destRank != ua.ValueRankOneOrMoreDimensions && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case []ua.LocalizedText:
-				if len(v2) > int(srv.serverCapabilities.MaxArrayLength) {
-					return ua.BadOutOfRange
+				if n := srv.serverCapabilities.MaxArrayLength; n > 0 && len(v2) > int(n) {
+					return writeValue, ua.BadOutOfRange
 				}
 				if destType != ua.VariantTypeLocalizedText && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankOneDimension && destRank != ua.ValueRankOneOrMoreDimensions && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case []ua.ExtensionObject:
-				if len(v2) > int(srv.serverCapabilities.MaxArrayLength) {
-					return ua.BadOutOfRange
+				if n := srv.serverCapabilities.MaxArrayLength; n > 0 && len(v2) > int(n) {
+					return writeValue, ua.BadOutOfRange
 				}
 				if destType != ua.VariantTypeExtensionObject && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankOneDimension && destRank != ua.ValueRankOneOrMoreDimensions && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case []ua.DataValue:
-				if len(v2) > int(srv.serverCapabilities.MaxArrayLength) {
-					return ua.BadOutOfRange
+				if n := srv.serverCapabilities.MaxArrayLength; n > 0 && len(v2) > int(n) {
+					return writeValue, ua.BadOutOfRange
 				}
 				if destType != ua.VariantTypeDataValue && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankOneDimension && destRank != ua.ValueRankOneOrMoreDimensions && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			case []ua.Variant:
-				if len(v2) > int(srv.serverCapabilities.MaxArrayLength) {
-					return ua.BadOutOfRange
+				if n := srv.serverCapabilities.MaxArrayLength; n > 0 && len(v2) > int(n) {
+					return writeValue, ua.BadOutOfRange
 				}
 				if destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankOneDimension && destRank != ua.ValueRankOneOrMoreDimensions && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
+				}
+			case ua.Matrix:
+				if v2.Validate() != nil {
+					return writeValue, ua.BadTypeMismatch
+				}
+				if n := srv.serverCapabilities.MaxArrayLength; n > 0 && v2.Len() > int(n) {
+					return writeValue, ua.BadOutOfRange
+				}
+				if vt := ua.VariantTypeOf(v2.Elements); vt != destType && destType != ua.VariantTypeVariant {
+					return writeValue, ua.BadTypeMismatch
+				}
+				if destRank != int32(len(v2.Dimensions)) && destRank != ua.ValueRankOneOrMoreDimensions && destRank != ua.ValueRankAny {
+					return writeValue, ua.BadTypeMismatch
 				}
 			default:
 				// case ua.ExtensionObject:
 				if destType != ua.VariantTypeExtensionObject && destType != ua.VariantTypeVariant {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 				if destRank != ua.ValueRankScalar && destRank != ua.ValueRankScalarOrOneDimension && destRank != ua.ValueRankAny {
-					return ua.BadTypeMismatch
+					return writeValue, ua.BadTypeMismatch
 				}
 			}
-
-			if f := n1.writeValueHandler; f != nil {
-				result, status := f(ctx, writeValue)
-				if status == ua.Good {
-					n1.SetValue(result)
+			// check array length against fixed array dimensions
+			if writeValue.IndexRange == "" {
+				if status := checkArrayDimensions(writeValue.Value.Value, n1.ArrayDimensions()); status != ua.Good {
+					return writeValue, status
 				}
-				return status
-			} else {
-				result, status := writeRange(n1.Value(), writeValue.Value, writeValue.IndexRange)
-				if status == ua.Good {
-					n1.SetValue(result)
+			}
+			// check content with custom validator
+			if f := n1.WriteValidator(); f != nil {
+				if status := f(writeValue.Value.Value); status != ua.Good {
+					return writeValue, status
 				}
-				return status
 			}
+			writeValue.Value = n1.normalizeWriteValue(writeValue.Value)
+			return writeValue, ua.Good
+		default:
+			return writeValue, ua.BadAttributeIDInvalid
+		}
+	case ua.AttributeIDDisplayName, ua.AttributeIDDescription:
+		switch n1 := n.(type) {
+		case *VariableNode:
+			mask := ua.AttributeWriteMaskDisplayName
+			if writeValue.AttributeID == ua.AttributeIDDescription {
+				mask = ua.AttributeWriteMaskDescription
+			}
+			if n1.WriteMask()&uint32(mask) == 0 {
+				return writeValue, ua.BadNotWritable
+			}
+			// check for PermissionTypeWriteAttribute
+			if !IsUserPermitted(rp, ua.PermissionTypeWriteAttribute) {
+				return writeValue, ua.BadUserAccessDenied
+			}
+			if _, ok := writeValue.Value.Value.(ua.LocalizedText); !ok {
+				return writeValue, ua.BadTypeMismatch
+			}
+			return writeValue, ua.Good
 		default:
-			return ua.BadAttributeIDInvalid
+			return writeValue, ua.BadAttributeIDInvalid
 		}
 	case ua.AttributeIDHistorizing:
 		switch n1 := n.(type) {
 		case *VariableNode:
+			if n1.WriteMask()&uint32(ua.AttributeWriteMaskHistorizing) == 0 {
+				return writeValue, ua.BadNotWritable
+			}
 			// check for PermissionTypeWriteHistorizing
 			if !IsUserPermitted(rp, ua.PermissionTypeWriteHistorizing) {
-				return ua.BadUserAccessDenied
+				return writeValue, ua.BadUserAccessDenied
 			}
-			v, ok := writeValue.Value.Value.(bool)
-			if !ok {
-				return ua.BadTypeMismatch
+			if _, ok := writeValue.Value.Value.(bool); !ok {
+				return writeValue, ua.BadTypeMismatch
 			}
-			n1.SetHistorizing(v)
-			return ua.Good
+			if n1.Historian() == nil {
+				return writeValue, ua.BadHistoryOperationUnsupported
+			}
+			return writeValue, ua.Good
 		default:
-			return ua.BadAttributeIDInvalid
+			return writeValue, ua.BadAttributeIDInvalid
 		}
 	default:
-		return ua.BadAttributeIDInvalid
+		return writeValue, ua.BadAttributeIDInvalid
+	}
+}
+
+// checkArrayDimensions returns BadTypeMismatch if the length of an array value does not match the
+// product of the ArrayDimensions of the variable, or the dimensions of a Matrix do not match the
+// ArrayDimensions. A dimension of zero accepts any length.
+func checkArrayDimensions(value ua.Variant, dims []uint32) ua.StatusCode {
+	if m, ok := value.(ua.Matrix); ok {
+		if len(dims) == 0 {
+			return ua.Good
+		}
+		if len(dims) != len(m.Dimensions) {
+			return ua.BadTypeMismatch
+		}
+		for i, d := range dims {
+			if d != 0 && int32(d) != m.Dimensions[i] {
+				return ua.BadTypeMismatch
+			}
+		}
+		return ua.Good
+	}
+	if len(dims) == 0 {
+		return ua.Good
+	}
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice {
+		return ua.Good
+	}
+	length := 1
+	for _, d := range dims {
+		if d == 0 {
+			return ua.Good
+		}
+		length *= int(d)
+	}
+	if v.Len() != length {
+		return ua.BadTypeMismatch
+	}
+	return ua.Good
+}
+
+// readInitialValues returns a snapshot of the values of the items to monitor, taken in one pass
+// before the items are created. Each attribute of a node is read once, then the index range of each
+// item is applied to the shared value. Items that are disabled or monitor events are not read, and
+// items of unknown nodes return BadNodeIDUnknown.
+func (srv *Server) readInitialValues(ctx context.Context, itemsToCreate []ua.MonitoredItemCreateRequest) []ua.DataValue {
+	m := srv.NamespaceManager()
+	results := make([]ua.DataValue, len(itemsToCreate))
+	snapshot := make(map[ua.ReadValueID]ua.DataValue, len(itemsToCreate))
+	for i, item := range itemsToCreate {
+		if item.MonitoringMode == ua.MonitoringModeDisabled || item.ItemToMonitor.AttributeID == ua.AttributeIDEventNotifier {
+			continue
+		}
+		key := item.ItemToMonitor
+		n, ok := m.FindNode(key.NodeID)
+		if !ok {
+			results[i] = ua.NewDataValue(nil, ua.BadNodeIDUnknown, time.Time{}, 0, time.Now(), 0)
+			continue
+		}
+		// a custom read handler receives the index range, so only share values read from the node.
+		var dims []uint32
+		if key.AttributeID == ua.AttributeIDValue && key.IndexRange != "" {
+			if n, ok := n.(*VariableNode); ok && n.readValueHandler == nil {
+				key.IndexRange = ""
+				dims = n.ArrayDimensions()
+			}
+		}
+		v, ok := snapshot[key]
+		if !ok {
+			v = srv.sampleValue(ctx, key, 0)
+			snapshot[key] = v
+		}
+		if key.IndexRange != item.ItemToMonitor.IndexRange && v.StatusCode.IsGood() {
+			v = readRangeDims(v, item.ItemToMonitor.IndexRange, dims)
+		}
+		results[i] = v
+	}
+	return results
+}
+
+// sampleValue reads the value of the itemToMonitor of a MonitoredItem. If the node has a sampling
+// function, the value is computed by the function instead.
+func (srv *Server) sampleValue(ctx context.Context, readValueId ua.ReadValueID, interval time.Duration) ua.DataValue {
+	if readValueId.AttributeID == ua.AttributeIDValue && readValueId.DataEncoding.Name == "" {
+		if n, ok := srv.NamespaceManager().FindVariable(readValueId.NodeID); ok {
+			if f := n.SamplingFunction(); f != nil {
+				rp := n.UserRolePermissions(ctx)
+				if !IsUserPermitted(rp, ua.PermissionTypeBrowse) {
+					return ua.NewDataValue(nil, ua.BadNodeIDUnknown, time.Time{}, 0, time.Now(), 0)
+				}
+				if (n.AccessLevel() & ua.AccessLevelsCurrentRead) == 0 {
+					return ua.NewDataValue(nil, ua.BadNotReadable, time.Time{}, 0, time.Now(), 0)
+				}
+				if (n.UserAccessLevel(ctx) & ua.AccessLevelsCurrentRead) == 0 {
+					return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Time{}, 0, time.Now(), 0)
+				}
+				return readRangeDims(n.sampleValue(ctx, f, interval), readValueId.IndexRange, n.ArrayDimensions())
+			}
+		}
 	}
+	return srv.readValue(ctx, readValueId)
 }
 
-// readValue returns the value of the attribute.
+// readValue returns the value of the attribute. The ReadValueHandler of a variable is always called.
 func (srv *Server) readValue(ctx context.Context, readValueId ua.ReadValueID) ua.DataValue {
+	return srv.readValueMaxAge(ctx, readValueId, 0)
+}
+
+// readValueMaxAge returns the value of the attribute. The ReadValueHandler of a variable is called
+// only if the value it last returned is older than maxAge milliseconds.
+func (srv *Server) readValueMaxAge(ctx context.Context, readValueId ua.ReadValueID, maxAge float64) ua.DataValue {
 	if readValueId.DataEncoding.Name != "" {
 		return ua.NewDataValue(nil, ua.BadDataEncodingInvalid, time.Time{}, 0, time.Now(), 0)
 	}
 	if readValueId.IndexRange != "" && readValueId.AttributeID != ua.AttributeIDValue {
 		return ua.NewDataValue(nil, ua.BadIndexRangeNoData, time.Time{}, 0, time.Now(), 0)
 	}
-	n, ok := srv.NamespaceManager().FindNode(readValueId.NodeID)
+	n, ok := srv.findNode(ctx, readValueId.NodeID)
 	if !ok {
 		return ua.NewDataValue(nil, ua.BadNodeIDUnknown, time.Time{}, 0, time.Now(), 0)
 	}
+	readValueId.NodeID = n.NodeID()
 	rp := n.UserRolePermissions(ctx)
 	if !IsUserPermitted(rp, ua.PermissionTypeBrowse) {
 		return ua.NewDataValue(nil, ua.BadNodeIDUnknown, time.Time{}, 0, time.Now(), 0)
@@ -5390,9 +7222,10 @@ func (srv *Server) readValue(ctx context.Context, readValueId ua.ReadValueID) ua
 				return ua.NewDataValue(nil, ua.BadUserAccessDenied, time.Time{}, 0, time.Now(), 0)
 			}
 			if f := n1.readValueHandler; f != nil {
-				return f(ctx, readValueId)
+				return n1.readValue(ctx, f, readValueId, maxAge)
 			}
-			return readRange(n1.Value(), readValueId.IndexRange)
+			n1.initializeValue(ctx)
+			return readRangeDims(n1.Value(), readValueId.IndexRange, n1.ArrayDimensions())
 		default:
 			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, time.Now(), 0)
 		}
@@ -5403,9 +7236,9 @@ func (srv *Server) readValue(ctx context.Context, readValueId ua.ReadValueID) ua
 	case ua.AttributeIDBrowseName:
 		return ua.NewDataValue(n.BrowseName(), ua.Good, time.Time{}, 0, time.Now(), 0)
 	case ua.AttributeIDDisplayName:
-		return ua.NewDataValue(n.DisplayName(), ua.Good, time.Time{}, 0, time.Now(), 0)
+		return ua.NewDataValue(srv.translateForSession(ctx, n.DisplayName()), ua.Good, time.Time{}, 0, time.Now(), 0)
 	case ua.AttributeIDDescription:
-		return ua.NewDataValue(n.Description(), ua.Good, time.Time{}, 0, time.Now(), 0)
+		return ua.NewDataValue(srv.translateForSession(ctx, n.Description()), ua.Good, time.Time{}, 0, time.Now(), 0)
 	case ua.AttributeIDIsAbstract:
 		switch n1 := n.(type) {
 		case *DataTypeNode:
@@ -5490,6 +7323,27 @@ func (srv *Server) readValue(ctx context.Context, readValueId ua.ReadValueID) ua
 		default:
 			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, time.Now(), 0)
 		}
+	case ua.AttributeIDAccessLevelEx:
+		switch n1 := n.(type) {
+		case *VariableNode:
+			return ua.NewDataValue(n1.AccessLevelEx(), ua.Good, time.Time{}, 0, time.Now(), 0)
+		default:
+			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, time.Now(), 0)
+		}
+	case ua.AttributeIDWriteMask:
+		switch n1 := n.(type) {
+		case *VariableNode:
+			return ua.NewDataValue(n1.WriteMask(), ua.Good, time.Time{}, 0, time.Now(), 0)
+		default:
+			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, time.Now(), 0)
+		}
+	case ua.AttributeIDUserWriteMask:
+		switch n1 := n.(type) {
+		case *VariableNode:
+			return ua.NewDataValue(n1.UserWriteMask(ctx), ua.Good, time.Time{}, 0, time.Now(), 0)
+		default:
+			return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, time.Now(), 0)
+		}
 	case ua.AttributeIDMinimumSamplingInterval:
 		switch n1 := n.(type) {
 		case *VariableNode:
@@ -5549,3 +7403,8 @@ func (srv *Server) readValue(ctx context.Context, readValueId ua.ReadValueID) ua
 		return ua.NewDataValue(nil, ua.BadAttributeIDInvalid, time.Time{}, 0, time.Now(), 0)
 	}
 }
+
+// exceedsOperationLimit returns true if the number of operations exceeds the limit. A limit of 0 means no limit.
+func exceedsOperationLimit(n int, limit uint32) bool {
+	return limit > 0 && n > int(limit)
+}
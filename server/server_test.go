@@ -4,21 +4,36 @@ package server_test
 
 import (
 	"context"
+	"crypto"
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"io"
+	"log/slog"
+	"math"
 	"math/big"
+	"net"
 	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/awcullen/opcua/client"
+	"github.com/awcullen/opcua/server"
 	"github.com/awcullen/opcua/ua"
 
 	"github.com/pkg/errors"
@@ -26,6 +41,7 @@ import (
 
 var (
 	endpointURL = "opc.tcp://127.0.0.1:46010" // our testserver
+	testServer  *server.Server                // started by TestMain, or nil if a server was already listening
 )
 
 // TestMain is run at the start of client testing. If an opcua server is not already running,
@@ -44,6 +60,7 @@ func TestMain(m *testing.M) {
 			fmt.Println(errors.Wrap(err, "Error constructing server"))
 			os.Exit(2)
 		}
+		testServer = srv
 		defer srv.Close()
 		go func() {
 			if err := srv.ListenAndServe(); err != ua.BadServerHalted {
@@ -86,6 +103,97 @@ func TestDiscoveryClient(t *testing.T) {
 	}
 }
 
+// TestGetEndpointsFiltered tests filtering the endpoints by transport profile and localizing the server name.
+func TestGetEndpointsFiltered(t *testing.T) {
+	res, err := client.GetEndpoints(context.Background(), &ua.GetEndpointsRequest{
+		EndpointURL: endpointURL,
+		LocaleIDs:   []string{"de-DE"},
+		ProfileURIs: []string{ua.TransportProfileURIUaTcpTransport},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error calling GetEndpoints"))
+		return
+	}
+	if len(res.Endpoints) == 0 {
+		t.Error(errors.New("Error calling GetEndpoints. want: endpoints, got: none"))
+		return
+	}
+	for _, e := range res.Endpoints {
+		if e.TransportProfileURI != ua.TransportProfileURIUaTcpTransport {
+			t.Errorf("Error filtering endpoints. got: %s", e.TransportProfileURI)
+		}
+		if e.Server.ApplicationName.Locale != "de" {
+			t.Errorf("Error localizing endpoints. got: %s", e.Server.ApplicationName)
+		}
+	}
+	res, err = client.GetEndpoints(context.Background(), &ua.GetEndpointsRequest{
+		EndpointURL: endpointURL,
+		ProfileURIs: []string{ua.TransportProfileURIHttpsBinaryTransport},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error calling GetEndpoints"))
+		return
+	}
+	if len(res.Endpoints) != 0 {
+		t.Errorf("Error filtering endpoints. want: none, got: %d", len(res.Endpoints))
+	}
+}
+
+// TestApplicationDescription tests the description returned by the discovery services of a server
+// configured with WithApplicationDescription. The ApplicationURI is taken from the server certificate.
+func TestApplicationDescription(t *testing.T) {
+	url := "opc.tcp://127.0.0.1:46011"
+	srv, err := server.New(
+		ua.ApplicationDescription{},
+		"./pki/server.crt",
+		"./pki/server.key",
+		url,
+		server.WithApplicationDescription(ua.ApplicationDescription{
+			ProductURI:      "http://github.com/awcullen/opcua",
+			ApplicationName: ua.LocalizedText{Text: "describedserver", Locale: "en"},
+			ApplicationType: ua.ApplicationTypeServer,
+		}),
+		server.WithSecurityPolicyNone(true),
+		server.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error constructing server"))
+		return
+	}
+	defer srv.Close()
+	go srv.ListenAndServe()
+	time.Sleep(100 * time.Millisecond)
+
+	want := fmt.Sprintf("urn:%s:testserver", host)
+	res, err := client.FindServers(context.Background(), &ua.FindServersRequest{EndpointURL: url})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error calling FindServers"))
+		return
+	}
+	if len(res.Servers) != 1 {
+		t.Errorf("Error calling FindServers. want: 1 server, got: %d", len(res.Servers))
+		return
+	}
+	if a := res.Servers[0]; a.ApplicationURI != want || a.ApplicationName.Text != "describedserver" ||
+		a.ProductURI != "http://github.com/awcullen/opcua" || !reflect.DeepEqual(a.DiscoveryURLs, []string{url}) {
+		t.Errorf("Error calling FindServers. got: %+v", a)
+	}
+	res2, err := client.GetEndpoints(context.Background(), &ua.GetEndpointsRequest{EndpointURL: url})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error calling GetEndpoints"))
+		return
+	}
+	if len(res2.Endpoints) == 0 {
+		t.Error(errors.New("Error calling GetEndpoints. want: endpoints, got: none"))
+		return
+	}
+	for _, e := range res2.Endpoints {
+		if e.Server.ApplicationURI != want || e.Server.ApplicationName.Text != "describedserver" {
+			t.Errorf("Error calling GetEndpoints. got: %+v", e.Server)
+		}
+	}
+}
+
 // TestOpenClientlWithoutSecurity tests opening a connection with a server using no security.
 func TestOpenClientlWithoutSecurity(t *testing.T) {
 	ctx := context.Background()
@@ -177,6 +285,60 @@ func TestReadServerStatus(t *testing.T) {
 	t.Logf("  CurrentTime: %s", status.CurrentTime)
 }
 
+// TestReadBuildInfo tests reading the BuildInfo structure and its child variables.
+func TestReadBuildInfo(t *testing.T) {
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	t.Logf("Success opening client: %s", ch.EndpointURL())
+	res, err := ch.Read(ctx, &ua.ReadRequest{
+		NodesToRead: []ua.ReadValueID{
+			{NodeID: ua.VariableIDServerServerStatusBuildInfo, AttributeID: ua.AttributeIDValue},
+			{NodeID: ua.VariableIDServerServerStatusBuildInfoSoftwareVersion, AttributeID: ua.AttributeIDValue},
+			{NodeID: ua.VariableIDServerServerStatusBuildInfoBuildNumber, AttributeID: ua.AttributeIDValue},
+			{NodeID: ua.VariableIDServerServerStatusBuildInfoBuildDate, AttributeID: ua.AttributeIDValue},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading"))
+		ch.Abort(ctx)
+		return
+	}
+	ch.Close(ctx)
+	for _, result := range res.Results {
+		if result.StatusCode.IsBad() {
+			t.Error(errors.Wrap(result.StatusCode, "Error reading BuildInfo"))
+			return
+		}
+	}
+	info, ok := res.Results[0].Value.(ua.BuildInfo)
+	if !ok {
+		t.Error(errors.New("Error decoding BuildInfo"))
+		return
+	}
+	if info.SoftwareVersion != SoftwareVersion || info.BuildNumber != BuildNumber || !info.BuildDate.Equal(BuildDate) {
+		t.Errorf("Error reading BuildInfo. got: %+v", info)
+	}
+	if v, ok := res.Results[1].Value.(string); !ok || v != SoftwareVersion {
+		t.Errorf("Error reading SoftwareVersion. want: %s, got: %v", SoftwareVersion, res.Results[1].Value)
+	}
+	if v, ok := res.Results[2].Value.(string); !ok || v != BuildNumber {
+		t.Errorf("Error reading BuildNumber. want: %s, got: %v", BuildNumber, res.Results[2].Value)
+	}
+	if v, ok := res.Results[3].Value.(time.Time); !ok || !v.Equal(BuildDate) {
+		t.Errorf("Error reading BuildDate. want: %s, got: %v", BuildDate, res.Results[3].Value)
+	}
+}
+
 // TestReadBuiltinTypes tests reading the server variables to demonstrate the built-in types available.
 func TestReadBuiltinTypes(t *testing.T) {
 	ctx := context.Background()
@@ -247,6 +409,67 @@ func TestReadBuiltinTypes(t *testing.T) {
 	}
 }
 
+// TestReadUninitialized tests reading a variable that was never written.
+func TestReadUninitialized(t *testing.T) {
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	t.Logf("Success opening client: %s", ch.EndpointURL())
+	res, err := ch.Read(ctx, &ua.ReadRequest{
+		NodesToRead: []ua.ReadValueID{
+			{NodeID: ua.ParseNodeID("ns=2;i=15187"), AttributeID: ua.AttributeIDValue},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading"))
+		ch.Abort(ctx)
+		return
+	}
+	ch.Close(ctx)
+	if !ua.IsNull(res.Results[0].Value) {
+		t.Errorf("Error reading. want: null, got: %v", res.Results[0].Value)
+	}
+	if res.Results[0].StatusCode != ua.BadWaitingForInitialData {
+		t.Errorf("Error reading. want: %s, got: %s", ua.BadWaitingForInitialData, res.Results[0].StatusCode)
+	}
+}
+
+// TestReadInvalidGuid tests reading a variable whose Guid value in the nodeset cannot be decoded.
+func TestReadInvalidGuid(t *testing.T) {
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening client"))
+	}
+	defer ch.Close(ctx)
+	res, err := ch.Read(ctx, &ua.ReadRequest{
+		NodesToRead: []ua.ReadValueID{
+			{NodeID: ua.ParseNodeID("ns=2;s=Demo.InvalidGuid"), AttributeID: ua.AttributeIDValue},
+		},
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error reading"))
+	}
+	if res.Results[0].StatusCode != ua.BadDecodingError {
+		t.Errorf("Error reading. want: %s, got: %s", ua.BadDecodingError, res.Results[0].StatusCode)
+	}
+}
+
 // TestReadAttributes tests reading various attributes of a server object.
 func TestReadAttributes(t *testing.T) {
 	ctx := context.Background()
@@ -333,6 +556,140 @@ func TestWrite(t *testing.T) {
 	ch.Close(ctx)
 }
 
+// TestWriteReadOnly tests that a write to a node lacking CurrentWrite access is rejected.
+func TestWriteReadOnly(t *testing.T) {
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	t.Logf("Success opening client: %s", ch.EndpointURL())
+	req := &ua.WriteRequest{
+		NodesToWrite: []ua.WriteValue{
+			{
+				NodeID:      ua.VariableIDServerServerStatusCurrentTime,
+				AttributeID: ua.AttributeIDValue,
+				Value:       ua.NewDataValue(time.Now().UTC(), 0, time.Time{}, 0, time.Time{}, 0),
+			},
+		},
+	}
+	res, err := ch.Write(ctx, req)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error writing"))
+		ch.Abort(ctx)
+		return
+	}
+	if res.Results[0] != ua.BadNotWritable {
+		t.Errorf("Error writing. want: %s, got: %s", ua.BadNotWritable, res.Results[0])
+		ch.Abort(ctx)
+		return
+	}
+	t.Logf("%s: %s", req.NodesToWrite[0].NodeID, res.Results[0])
+	ch.Close(ctx)
+}
+
+// TestWriteHistorizing tests enabling historizing of a variable and reading the captured values.
+func TestWriteHistorizing(t *testing.T) {
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	t.Logf("Success opening client: %s", ch.EndpointURL())
+	nodeID := ua.ParseNodeID("ns=2;s=Demo.Static.Scalar.Float")
+	start := time.Now()
+	values := []float32{1.0, 2.0, 3.0}
+	for _, historizing := range []bool{true, false} {
+		res, err := ch.Write(ctx, &ua.WriteRequest{
+			NodesToWrite: []ua.WriteValue{
+				{
+					NodeID:      nodeID,
+					AttributeID: ua.AttributeIDHistorizing,
+					Value:       ua.NewDataValue(historizing, 0, time.Time{}, 0, time.Time{}, 0),
+				},
+			},
+		})
+		if err != nil {
+			t.Error(errors.Wrap(err, "Error writing"))
+			ch.Abort(ctx)
+			return
+		}
+		if res.Results[0].IsBad() {
+			t.Error(errors.Wrap(res.Results[0], "Error writing Historizing"))
+			ch.Abort(ctx)
+			return
+		}
+		if !historizing {
+			break
+		}
+		for _, v := range values {
+			res, err := ch.Write(ctx, &ua.WriteRequest{
+				NodesToWrite: []ua.WriteValue{
+					{
+						NodeID:      nodeID,
+						AttributeID: ua.AttributeIDValue,
+						Value:       ua.NewDataValue(v, 0, time.Time{}, 0, time.Time{}, 0),
+					},
+				},
+			})
+			if err != nil {
+				t.Error(errors.Wrap(err, "Error writing"))
+				ch.Abort(ctx)
+				return
+			}
+			if res.Results[0].IsBad() {
+				t.Error(errors.Wrap(res.Results[0], "Error writing"))
+				ch.Abort(ctx)
+				return
+			}
+		}
+	}
+	res, err := ch.HistoryRead(ctx, &ua.HistoryReadRequest{
+		HistoryReadDetails: ua.ReadRawModifiedDetails{
+			StartTime: start,
+			EndTime:   time.Now().Add(time.Second),
+		},
+		TimestampsToReturn: ua.TimestampsToReturnSource,
+		NodesToRead: []ua.HistoryReadValueID{
+			{NodeID: nodeID},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading history"))
+		ch.Abort(ctx)
+		return
+	}
+	ch.Close(ctx)
+	if res.Results[0].StatusCode.IsBad() {
+		t.Error(errors.Wrap(res.Results[0].StatusCode, "Error reading history"))
+		return
+	}
+	historyData, ok := res.Results[0].HistoryData.(ua.HistoryData)
+	if !ok || len(historyData.DataValues) != len(values) {
+		t.Errorf("Error reading history. want: %d values, got: %v", len(values), res.Results[0].HistoryData)
+		return
+	}
+	for i, result := range historyData.DataValues {
+		if result.Value != values[i] {
+			t.Errorf("Error reading history. want: %v, got: %v", values[i], result.Value)
+		}
+	}
+}
+
 // TestReadIndexRange tests reading the first three elements of a server array variable.
 func TestReadIndexRange(t *testing.T) {
 	ctx := context.Background()
@@ -424,6 +781,65 @@ func TestWriteIndexRange(t *testing.T) {
 	ch.Close(ctx)
 }
 
+// TestWriteArrayDimensions tests writing arrays to variables with fixed and variable array dimensions.
+func TestWriteArrayDimensions(t *testing.T) {
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	t.Logf("Success opening client: %s", ch.EndpointURL())
+	req := &ua.WriteRequest{
+		NodesToWrite: []ua.WriteValue{
+			{
+				NodeID:      ua.ParseNodeID("ns=2;s=Demo.Static.Arrays.FixedInt32"),
+				AttributeID: ua.AttributeIDValue,
+				Value:       ua.NewDataValue([]int32{1, 2, 3}, 0, time.Time{}, 0, time.Time{}, 0),
+			},
+			{
+				NodeID:      ua.ParseNodeID("ns=2;s=Demo.Static.Arrays.FixedInt32"),
+				AttributeID: ua.AttributeIDValue,
+				Value:       ua.NewDataValue([]int32{4, 3, 2, 1}, 0, time.Time{}, 0, time.Time{}, 0),
+			},
+			{
+				NodeID:      ua.ParseNodeID("ns=2;s=Demo.Static.Arrays.Int32"),
+				AttributeID: ua.AttributeIDValue,
+				Value:       ua.NewDataValue([]int32{1, 2, 3}, 0, time.Time{}, 0, time.Time{}, 0),
+			},
+			{
+				NodeID:      ua.ParseNodeID("ns=2;s=Demo.Static.Arrays.FixedInt32Matrix"),
+				AttributeID: ua.AttributeIDValue,
+				Value:       ua.NewDataValue([]int32{1, 2}, 0, time.Time{}, 0, time.Time{}, 0),
+			},
+			{
+				NodeID:      ua.ParseNodeID("ns=2;s=Demo.Static.Arrays.FixedInt32Matrix"),
+				AttributeID: ua.AttributeIDValue,
+				Value:       ua.NewDataValue([]int32{1, 2, 3, 4, 5, 6}, 0, time.Time{}, 0, time.Time{}, 0),
+			},
+		},
+	}
+	res, err := ch.Write(ctx, req)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error writing"))
+		ch.Abort(ctx)
+		return
+	}
+	want := []ua.StatusCode{ua.BadTypeMismatch, ua.Good, ua.Good, ua.BadTypeMismatch, ua.Good}
+	for i, result := range res.Results {
+		if result != want[i] {
+			t.Errorf("Error writing %s. want: %s, got: %s", req.NodesToWrite[i].NodeID, want[i], result)
+		}
+	}
+	ch.Close(ctx)
+}
+
 // TestBrowse tests browsing the top-level objects folder.
 func TestBrowse(t *testing.T) {
 	ctx := context.Background()
@@ -549,322 +965,8957 @@ func TestSubscribe(t *testing.T) {
 	ch.Close(ctx)
 }
 
-// TestCallMethod tests calling a method of the server and passing Aurguments.
-func TestCallMethod(t *testing.T) {
+// TestSubscribeInitialValues tests the initial values of items that monitor ranges of the same array.
+func TestSubscribeInitialValues(t *testing.T) {
 	ctx := context.Background()
 	ch, err := client.Dial(
 		ctx,
 		endpointURL,
-		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
 		client.WithInsecureSkipVerify(),
-		client.WithUserNameIdentity("root", "secret"),
 	)
 	if err != nil {
 		t.Error(errors.Wrap(err, "Error opening client"))
 		return
 	}
-	t.Logf("Success opening client: %s", ch.EndpointURL())
-
-	req := &ua.CallRequest{
-		MethodsToCall: []ua.CallMethodRequest{{
-			ObjectID:       ua.ParseNodeID("ns=2;s=Demo.Methods"), // parent node
-			MethodID:       ua.ParseNodeID("ns=2;s=Demo.Methods.MethodIO"),
-			InputArguments: []ua.Variant{uint32(uint32(6)), uint32(uint32(7))}},
-		},
+	req := &ua.CreateSubscriptionRequest{
+		RequestedPublishingInterval: 1000.0,
+		RequestedMaxKeepAliveCount:  30,
+		RequestedLifetimeCount:      30 * 3,
+		PublishingEnabled:           true,
 	}
-	res, err := ch.Call(ctx, req)
+	res, err := ch.CreateSubscription(ctx, req)
 	if err != nil {
-		t.Error(errors.Wrap(err, "Error calling method"))
+		t.Error(errors.Wrap(err, "Error creating subscription"))
 		ch.Abort(ctx)
 		return
 	}
-	if res.Results[0].StatusCode.IsBad() {
-		t.Error(errors.Wrap(res.Results[0].StatusCode, "Error calling method"))
+	id := ua.ParseNodeID("ns=2;s=Demo.Static.Arrays.Double")
+	ranges := []string{"", "0:1", "2"}
+	items := make([]ua.MonitoredItemCreateRequest, len(ranges))
+	for i, r := range ranges {
+		items[i] = ua.MonitoredItemCreateRequest{
+			ItemToMonitor: ua.ReadValueID{
+				AttributeID: ua.AttributeIDValue,
+				NodeID:      id,
+				IndexRange:  r,
+			},
+			MonitoringMode: ua.MonitoringModeReporting,
+			RequestedParameters: ua.MonitoringParameters{
+				ClientHandle: uint32(i), QueueSize: 1, DiscardOldest: true, SamplingInterval: 500.0,
+			},
+		}
+	}
+	res2, err := ch.CreateMonitoredItems(ctx, &ua.CreateMonitoredItemsRequest{
+		SubscriptionID:     res.SubscriptionID,
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+		ItemsToCreate:      items,
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating items"))
+		ch.Abort(ctx)
+		return
+	}
+	for i, result := range res2.Results {
+		if result.StatusCode.IsBad() {
+			t.Errorf("Error creating item with range '%s'. %s", ranges[i], result.StatusCode)
+		}
+	}
+	// the first publish returns the initial values.
+	res3, err := ch.Publish(ctx, &ua.PublishRequest{
+		RequestHeader:                ua.RequestHeader{TimeoutHint: 60000},
+		SubscriptionAcknowledgements: []ua.SubscriptionAcknowledgement{},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error publishing"))
 		ch.Abort(ctx)
 		return
 	}
 	ch.Close(ctx)
-	t.Logf("  %6d", req.MethodsToCall[0].InputArguments[0])
-	t.Logf("+ %6d", req.MethodsToCall[0].InputArguments[1])
-	t.Logf("--------")
-	t.Logf("  %6d", res.Results[0].OutputArguments[0])
+	values := make(map[uint32]ua.Variant)
+	for _, data := range res3.NotificationMessage.NotificationData {
+		if body, ok := data.(ua.DataChangeNotification); ok {
+			for _, z := range body.MonitoredItems {
+				values[z.ClientHandle] = z.Value.Value
+			}
+		}
+	}
+	if len(values) != len(ranges) {
+		t.Errorf("Expected %d initial values, got %d", len(ranges), len(values))
+		return
+	}
+	all, ok := values[0].([]float64)
+	if !ok || len(all) < 3 {
+		t.Errorf("Expected array of at least 3 elements, got %v", values[0])
+		return
+	}
+	if !reflect.DeepEqual(values[1], all[0:2]) {
+		t.Errorf("Expected %v, got %v", all[0:2], values[1])
+	}
+	if !reflect.DeepEqual(values[2], all[2:3]) {
+		t.Errorf("Expected %v, got %v", all[2:3], values[2])
+	}
 }
 
-// TestTranslate tests finding a node in the namespace, given a starting nodeID and a BrowsePath.
-func TestTranslate(t *testing.T) {
+// TestModifySubscription tests changing the publishing interval of a subscription at runtime.
+func TestModifySubscription(t *testing.T) {
 	ctx := context.Background()
 	ch, err := client.Dial(
 		ctx,
 		endpointURL,
-		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
 		client.WithInsecureSkipVerify(),
-		client.WithUserNameIdentity("root", "secret"),
 	)
 	if err != nil {
 		t.Error(errors.Wrap(err, "Error opening client"))
 		return
 	}
-	t.Logf("Success opening client: %s", ch.EndpointURL())
-	req := &ua.TranslateBrowsePathsToNodeIDsRequest{
-		BrowsePaths: []ua.BrowsePath{
+	res, err := ch.CreateSubscription(ctx, &ua.CreateSubscriptionRequest{
+		RequestedPublishingInterval: 250.0,
+		RequestedMaxKeepAliveCount:  10,
+		RequestedLifetimeCount:      30,
+		PublishingEnabled:           true,
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating subscription"))
+		ch.Abort(ctx)
+		return
+	}
+	// the current time changes on every sample, so every publishing cycle sends a notification.
+	_, err = ch.CreateMonitoredItems(ctx, &ua.CreateMonitoredItemsRequest{
+		SubscriptionID:     res.SubscriptionID,
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+		ItemsToCreate: []ua.MonitoredItemCreateRequest{
 			{
-				StartingNode: ua.ParseNodeID("ns=2;s=Demo"),
-				RelativePath: ua.RelativePath{
-					Elements: []ua.RelativePathElement{
-						{TargetName: ua.ParseQualifiedName("2:Static")},
-						{TargetName: ua.ParseQualifiedName("2:Scalar")},
-						{TargetName: ua.ParseQualifiedName("2:Float")},
-					},
+				ItemToMonitor: ua.ReadValueID{
+					AttributeID: ua.AttributeIDValue,
+					NodeID:      ua.VariableIDServerServerStatusCurrentTime,
+				},
+				MonitoringMode: ua.MonitoringModeReporting,
+				RequestedParameters: ua.MonitoringParameters{
+					ClientHandle: 42, QueueSize: 1, DiscardOldest: true, SamplingInterval: 100.0,
 				},
 			},
 		},
-	}
-	res, err := ch.TranslateBrowsePathsToNodeIDs(ctx, req)
+	})
 	if err != nil {
-		t.Error(errors.Wrap(err, "Error TranslateBrowsePathsToNodeIDs"))
+		t.Error(errors.Wrap(err, "Error creating item"))
 		ch.Abort(ctx)
 		return
 	}
-	ch.Close(ctx)
-	t.Logf("Results:")
-	for i, r := range res.Results {
-		if r.StatusCode.IsGood() {
-			t.Logf("%s: %d", req.BrowsePaths[i].StartingNode, len(r.Targets))
-			for _, target := range r.Targets {
-				t.Logf("  %s: %d", target.TargetID, target.RemainingPathIndex)
+	// returns the time between two notification messages.
+	cadence := func() (time.Duration, error) {
+		var last time.Time
+		for i := 0; i < 3; i++ {
+			if _, err := ch.Publish(ctx, &ua.PublishRequest{
+				RequestHeader:                ua.RequestHeader{TimeoutHint: 60000},
+				SubscriptionAcknowledgements: []ua.SubscriptionAcknowledgement{},
+			}); err != nil {
+				return 0, err
 			}
-		} else {
-			t.Logf("code: %s", r.StatusCode)
-			t.Logf("%s: %d", req.BrowsePaths[i].StartingNode, len(r.Targets))
-			for _, target := range r.Targets {
-				t.Logf("  %s: %d", target.TargetID, target.RemainingPathIndex)
+			if i == 2 {
+				return time.Since(last), nil
 			}
-			t.Error("Error TranslateBrowsePath")
+			last = time.Now()
 		}
+		return 0, nil
+	}
+	d, err := cadence()
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error publishing"))
+		ch.Abort(ctx)
+		return
+	}
+	if d > 750*time.Millisecond {
+		t.Errorf("Error publishing. want: 250ms, got: %s", d)
+	}
+	res2, err := ch.ModifySubscription(ctx, &ua.ModifySubscriptionRequest{
+		SubscriptionID:              res.SubscriptionID,
+		RequestedPublishingInterval: 2000.0,
+		RequestedMaxKeepAliveCount:  10,
+		RequestedLifetimeCount:      30,
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error modifying subscription"))
+		ch.Abort(ctx)
+		return
+	}
+	if res2.RevisedPublishingInterval != 2000.0 || res2.RevisedMaxKeepAliveCount != 10 || res2.RevisedLifetimeCount != 30 {
+		t.Errorf("Error modifying subscription. got: %+v", res2)
 	}
+	d, err = cadence()
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error publishing"))
+		ch.Abort(ctx)
+		return
+	}
+	if d < 1500*time.Millisecond || d > 3000*time.Millisecond {
+		t.Errorf("Error publishing. want: 2000ms, got: %s", d)
+	}
+	ch.Close(ctx)
 }
 
-/*
-// TestReadHistory demonstrates reading history from the UaCPPServer available from https://www.unified-automation.com/
-func TestReadHistory(t *testing.T) {
-	if testing.Short() {
-		t.Skip("skipping long running test")
-	}
+// TestTransferSubscription tests closing a session without deleting its subscription, then
+// transferring the subscription to a new session.
+func TestTransferSubscription(t *testing.T) {
 	ctx := context.Background()
 	ch, err := client.Dial(
 		ctx,
-		"opc.tcp://localhost:48010",
+		endpointURL,
 		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
-		client.WithInsecureSkipVerify(), // skips verification of server certificate
+		client.WithInsecureSkipVerify(),
 		client.WithUserNameIdentity("root", "secret"),
 	)
 	if err != nil {
 		t.Error(errors.Wrap(err, "Error opening client"))
 		return
 	}
-	t.Logf("Success opening client: %s", ch.EndpointURL())
-
-	t.Logf("Start logging of data...")
-	req := &ua.CallRequest{
-		MethodsToCall: []ua.CallMethodRequest{
-			{
-				ObjectID:       ua.ParseNodeID("ns=2;s=Demo.History"), // parent node
-				MethodID:       ua.ParseNodeID("ns=2;s=Demo.History.StartLogging"),
-				InputArguments: []ua.Variant{},
-			},
-		},
-	}
-
-	res, err := ch.Call(ctx, req)
+	res, err := ch.CreateSubscription(ctx, &ua.CreateSubscriptionRequest{
+		RequestedPublishingInterval: 500.0,
+		RequestedMaxKeepAliveCount:  30,
+		RequestedLifetimeCount:      30 * 3,
+		PublishingEnabled:           true,
+	})
 	if err != nil {
-		t.Error(errors.Wrap(err, "Error calling method"))
+		t.Error(errors.Wrap(err, "Error creating subscription"))
 		ch.Abort(ctx)
 		return
 	}
-	_ = res
-
-	t.Logf("Collecting 10 seconds of data...")
-	time.Sleep(10 * time.Second)
-
-	t.Log("Reading history for last 10 seconds")
-	var cp ua.ByteString
-	for {
-		req2 := &ua.HistoryReadRequest{
-			HistoryReadDetails: ua.ReadRawModifiedDetails{
-				StartTime:        time.Now().Add(-1 * time.Minute),
-				EndTime:          time.Now(),
-				NumValuesPerNode: 100,
-				ReturnBounds:     false,
-			},
-			TimestampsToReturn:        ua.TimestampsToReturnBoth,
-			ReleaseContinuationPoints: false,
-			NodesToRead: []ua.HistoryReadValueID{
-				{NodeID: ua.ParseNodeID("ns=2;s=Demo.History.DoubleWithHistory"), ContinuationPoint: cp},
+	_, err = ch.CreateMonitoredItems(ctx, &ua.CreateMonitoredItemsRequest{
+		SubscriptionID:     res.SubscriptionID,
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+		ItemsToCreate: []ua.MonitoredItemCreateRequest{
+			{
+				ItemToMonitor: ua.ReadValueID{
+					AttributeID: ua.AttributeIDValue,
+					NodeID:      ua.VariableIDServerServerStatusCurrentTime,
+				},
+				MonitoringMode: ua.MonitoringModeReporting,
+				RequestedParameters: ua.MonitoringParameters{
+					ClientHandle: 42, QueueSize: 1, DiscardOldest: true, SamplingInterval: 500.0,
+				},
 			},
-		}
-
-		res2, err := ch.HistoryRead(ctx, req2)
-		if err != nil {
-			t.Error(errors.Wrap(err, "Error reading"))
-			ch.Abort(ctx)
-			return
-		}
-
-		if res2.Results[0].StatusCode.IsBad() {
-			t.Errorf("Error reading values for node '%s'. %s", req2.NodesToRead[0].NodeID, res2.Results[0].StatusCode)
-			ch.Abort(ctx)
-			return
-		}
-
-		if historyData, ok := res2.Results[0].HistoryData.(ua.HistoryData); ok {
-			t.Logf("Found %d value(s) for node '%s':", len(historyData.DataValues), req2.NodesToRead[0].NodeID)
-			for _, result := range historyData.DataValues {
-				t.Logf("Read %v, q: %#X, ts: %s", result.Value, uint32(result.StatusCode), result.SourceTimestamp)
-			}
-		}
-
-		cp = res2.Results[0].ContinuationPoint
-		if cp == "" {
-			break
-		}
-	}
-	t.Log("Now read the 1 sec average of the last 10 seconds...")
-
-	req3 := &ua.HistoryReadRequest{
-		HistoryReadDetails: ua.ReadProcessedDetails{
-			StartTime:          time.Now().Add(-10 * time.Second),
-			EndTime:            time.Now(),
-			ProcessingInterval: 1000.0,
-			AggregateType:      []ua.NodeID{ua.ObjectIDAggregateFunctionAverage},
-		},
-		TimestampsToReturn:        ua.TimestampsToReturnBoth,
-		ReleaseContinuationPoints: false,
-		NodesToRead: []ua.HistoryReadValueID{
-			{NodeID: ua.ParseNodeID("ns=2;s=Demo.History.DoubleWithHistory")},
 		},
-	}
-
-	res3, err := ch.HistoryRead(ctx, req3)
+	})
 	if err != nil {
-		t.Error(errors.Wrap(err, "Error reading"))
+		t.Error(errors.Wrap(err, "Error creating item"))
 		ch.Abort(ctx)
 		return
 	}
-
-	if res3.Results[0].StatusCode.IsBad() {
-		t.Errorf("Error reading values for node '%s'. %s", req3.NodesToRead[0].NodeID, res3.Results[0].StatusCode)
-		ch.Abort(ctx)
+	// close the session, but retain the subscription.
+	if err := ch.CloseRetainSubscriptions(ctx); err != nil {
+		t.Error(errors.Wrap(err, "Error closing client"))
 		return
 	}
 
-	if historyData, ok := res3.Results[0].HistoryData.(ua.HistoryData); ok {
-		t.Logf("Found %d average value(s) for node '%s':", len(historyData.DataValues), req3.NodesToRead[0].NodeID)
-		for _, result := range historyData.DataValues {
-			t.Logf("Read %v, q: %#X, ts: %s", result.Value, uint32(result.StatusCode), result.SourceTimestamp)
-		}
+	// another user may not transfer the subscription.
+	ch2, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
 	}
-
-	t.Logf("Stop logging of data...")
-	req4 := &ua.CallRequest{
-		MethodsToCall: []ua.CallMethodRequest{{
-			ObjectID:       ua.ParseNodeID("ns=2;s=Demo.History"), // parent node
-			MethodID:       ua.ParseNodeID("ns=2;s=Demo.History.StopLogging"),
-			InputArguments: []ua.Variant{}},
-		},
+	res2, err := ch2.TransferSubscriptions(ctx, &ua.TransferSubscriptionsRequest{
+		SubscriptionIDs: []uint32{res.SubscriptionID},
+	})
+	ch2.Close(ctx)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error transferring subscription"))
+		return
+	}
+	if sc := res2.Results[0].StatusCode; sc != ua.BadUserAccessDenied {
+		t.Errorf("Expected %s, got %s", ua.BadUserAccessDenied, sc)
 	}
 
-	res4, err := ch.Call(ctx, req4)
+	// the same user may transfer the subscription.
+	ch3, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
 	if err != nil {
-		t.Error(errors.Wrap(err, "Error calling method"))
-		ch.Abort(ctx)
+		t.Error(errors.Wrap(err, "Error opening client"))
 		return
 	}
-	_ = res4
+	res3, err := ch3.TransferSubscriptions(ctx, &ua.TransferSubscriptionsRequest{
+		SubscriptionIDs:   []uint32{res.SubscriptionID},
+		SendInitialValues: true,
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error transferring subscription"))
+		ch3.Abort(ctx)
+		return
+	}
+	if sc := res3.Results[0].StatusCode; sc != ua.Good {
+		t.Errorf("Expected %s, got %s", ua.Good, sc)
+		ch3.Abort(ctx)
+		return
+	}
+	res4, err := ch3.Publish(ctx, &ua.PublishRequest{
+		RequestHeader:                ua.RequestHeader{TimeoutHint: 60000},
+		SubscriptionAcknowledgements: []ua.SubscriptionAcknowledgement{},
+	})
+	ch3.Close(ctx)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error publishing"))
+		return
+	}
+	if res4.SubscriptionID != res.SubscriptionID {
+		t.Errorf("Expected subscription %d, got %d", res.SubscriptionID, res4.SubscriptionID)
+	}
+}
+
+// TestTransferSubscriptionAnonymous tests that a subscription created by an anonymous user may not be
+// transferred by another anonymous session.
+func TestTransferSubscriptionAnonymous(t *testing.T) {
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	res, err := ch.CreateSubscription(ctx, &ua.CreateSubscriptionRequest{
+		RequestedPublishingInterval: 500.0,
+		RequestedMaxKeepAliveCount:  30,
+		RequestedLifetimeCount:      30 * 3,
+		PublishingEnabled:           true,
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating subscription"))
+		ch.Abort(ctx)
+		return
+	}
+	// close the session, but retain the subscription.
+	if err := ch.CloseRetainSubscriptions(ctx); err != nil {
+		t.Error(errors.Wrap(err, "Error closing client"))
+		return
+	}
+
+	ch2, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch2.Close(ctx)
+	res2, err := ch2.TransferSubscriptions(ctx, &ua.TransferSubscriptionsRequest{
+		SubscriptionIDs: []uint32{res.SubscriptionID},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error transferring subscription"))
+		return
+	}
+	if sc := res2.Results[0].StatusCode; sc != ua.BadUserAccessDenied {
+		t.Errorf("Expected %s, got %s", ua.BadUserAccessDenied, sc)
+	}
+}
+
+// TestReportStructureChanged tests that the StructureChanged bit is delivered once after the change is reported.
+func TestReportStructureChanged(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	id := ua.ParseNodeID("ns=2;s=Demo.Static.Scalar.UInt16")
+	n, ok := testServer.NamespaceManager().FindVariable(id)
+	if !ok {
+		t.Fatalf("Variable '%s' not found", id)
+	}
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	res, err := ch.CreateSubscription(ctx, &ua.CreateSubscriptionRequest{
+		RequestedPublishingInterval: 250.0,
+		RequestedMaxKeepAliveCount:  30,
+		RequestedLifetimeCount:      30 * 3,
+		PublishingEnabled:           true,
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating subscription"))
+		return
+	}
+	_, err = ch.CreateMonitoredItems(ctx, &ua.CreateMonitoredItemsRequest{
+		SubscriptionID:     res.SubscriptionID,
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+		ItemsToCreate: []ua.MonitoredItemCreateRequest{
+			{
+				ItemToMonitor:  ua.ReadValueID{AttributeID: ua.AttributeIDValue, NodeID: id},
+				MonitoringMode: ua.MonitoringModeReporting,
+				RequestedParameters: ua.MonitoringParameters{
+					ClientHandle: 42, QueueSize: 1, DiscardOldest: true, SamplingInterval: 100.0,
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating item"))
+		return
+	}
+	// nextStatusCode returns the status of the next data change notification.
+	var seqNum uint32
+	nextStatusCode := func() (ua.StatusCode, error) {
+		for {
+			req := &ua.PublishRequest{RequestHeader: ua.RequestHeader{TimeoutHint: 60000}}
+			if seqNum != 0 {
+				req.SubscriptionAcknowledgements = []ua.SubscriptionAcknowledgement{{SequenceNumber: seqNum, SubscriptionID: res.SubscriptionID}}
+			}
+			res, err := ch.Publish(ctx, req)
+			if err != nil {
+				return 0, err
+			}
+			if len(res.NotificationMessage.NotificationData) == 0 {
+				continue
+			}
+			seqNum = res.NotificationMessage.SequenceNumber
+			for _, data := range res.NotificationMessage.NotificationData {
+				if body, ok := data.(ua.DataChangeNotification); ok {
+					for _, z := range body.MonitoredItems {
+						return z.Value.StatusCode, nil
+					}
+				}
+			}
+		}
+	}
+	// initial value
+	sc, err := nextStatusCode()
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error publishing"))
+		return
+	}
+	if sc.IsStructureChanged() {
+		t.Error("Initial value has StructureChanged bit")
+	}
+	n.ReportStructureChanged()
+	sc, err = nextStatusCode()
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error publishing"))
+		return
+	}
+	if !sc.IsStructureChanged() {
+		t.Error("Value after change is missing StructureChanged bit")
+	}
+	// the next value change does not carry the bit.
+	n.SetValue(ua.NewDataValue(uint16(n.Value().Value.(uint16)+1), ua.Good, time.Now(), 0, time.Now(), 0))
+	sc, err = nextStatusCode()
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error publishing"))
+		return
+	}
+	if sc.IsStructureChanged() {
+		t.Error("Subsequent value has StructureChanged bit")
+	}
+}
+
+// BenchmarkCreateMonitoredItems benchmarks creating 1000 monitored items on 1000 distinct nodes,
+// including the initial values of the items.
+func BenchmarkCreateMonitoredItems(b *testing.B) {
+	if testServer == nil {
+		b.Skip("Benchmark requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	nodes := make([]server.Node, 1000)
+	items := make([]ua.MonitoredItemCreateRequest, len(nodes))
+	for i := range nodes {
+		n := server.NewVariableNode(
+			ua.NewNodeIDString(2, fmt.Sprintf("Bench.%d", i)),
+			ua.NewQualifiedName(2, fmt.Sprintf("Bench%d", i)),
+			ua.NewLocalizedText(fmt.Sprintf("Bench%d", i), ""),
+			ua.NewLocalizedText("", ""),
+			nil,
+			[]ua.Reference{
+				{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+			},
+			ua.NewDataValue(float64(i), 0, time.Now(), 0, time.Now(), 0),
+			ua.DataTypeIDDouble,
+			ua.ValueRankScalar,
+			[]uint32{},
+			ua.AccessLevelsCurrentRead,
+			0,
+			false,
+			nil,
+		)
+		nodes[i] = n
+		items[i] = ua.MonitoredItemCreateRequest{
+			ItemToMonitor:  ua.ReadValueID{AttributeID: ua.AttributeIDValue, NodeID: n.NodeID()},
+			MonitoringMode: ua.MonitoringModeReporting,
+			RequestedParameters: ua.MonitoringParameters{
+				ClientHandle: uint32(i), QueueSize: 1, DiscardOldest: true, SamplingInterval: 1000.0,
+			},
+		}
+	}
+	if err := nm.AddNodes(nodes...); err != nil {
+		b.Fatal(errors.Wrap(err, "Error adding nodes"))
+	}
+	defer nm.DeleteNodes(nodes, false)
+
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		b.Fatal(errors.Wrap(err, "Error opening client"))
+	}
+	defer ch.Close(ctx)
+	res, err := ch.CreateSubscription(ctx, &ua.CreateSubscriptionRequest{
+		RequestedPublishingInterval: 1000.0,
+		RequestedMaxKeepAliveCount:  30,
+		RequestedLifetimeCount:      30 * 3,
+		PublishingEnabled:           true,
+	})
+	if err != nil {
+		b.Fatal(errors.Wrap(err, "Error creating subscription"))
+	}
+	ids := make([]uint32, len(items))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		res2, err := ch.CreateMonitoredItems(ctx, &ua.CreateMonitoredItemsRequest{
+			SubscriptionID:     res.SubscriptionID,
+			TimestampsToReturn: ua.TimestampsToReturnBoth,
+			ItemsToCreate:      items,
+		})
+		if err != nil {
+			b.Fatal(errors.Wrap(err, "Error creating items"))
+		}
+		b.StopTimer()
+		for j, result := range res2.Results {
+			if result.StatusCode.IsBad() {
+				b.Fatalf("Error creating item %d. %s", j, result.StatusCode)
+			}
+			ids[j] = result.MonitoredItemID
+		}
+		if _, err := ch.DeleteMonitoredItems(ctx, &ua.DeleteMonitoredItemsRequest{SubscriptionID: res.SubscriptionID, MonitoredItemIDs: ids}); err != nil {
+			b.Fatal(errors.Wrap(err, "Error deleting items"))
+		}
+		b.StartTimer()
+	}
+}
+
+// TestCallMethod tests calling a method of the server and passing Aurguments.
+func TestCallMethod(t *testing.T) {
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	t.Logf("Success opening client: %s", ch.EndpointURL())
+
+	req := &ua.CallRequest{
+		MethodsToCall: []ua.CallMethodRequest{{
+			ObjectID:       ua.ParseNodeID("ns=2;s=Demo.Methods"), // parent node
+			MethodID:       ua.ParseNodeID("ns=2;s=Demo.Methods.MethodIO"),
+			InputArguments: []ua.Variant{uint32(uint32(6)), uint32(uint32(7))}},
+		},
+	}
+	res, err := ch.Call(ctx, req)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error calling method"))
+		ch.Abort(ctx)
+		return
+	}
+	if res.Results[0].StatusCode.IsBad() {
+		t.Error(errors.Wrap(res.Results[0].StatusCode, "Error calling method"))
+		ch.Abort(ctx)
+		return
+	}
+	ch.Close(ctx)
+	t.Logf("  %6d", req.MethodsToCall[0].InputArguments[0])
+	t.Logf("+ %6d", req.MethodsToCall[0].InputArguments[1])
+	t.Logf("--------")
+	t.Logf("  %6d", res.Results[0].OutputArguments[0])
+}
+
+// TestTranslate tests finding a node in the namespace, given a starting nodeID and a BrowsePath.
+func TestTranslate(t *testing.T) {
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	t.Logf("Success opening client: %s", ch.EndpointURL())
+	req := &ua.TranslateBrowsePathsToNodeIDsRequest{
+		BrowsePaths: []ua.BrowsePath{
+			{
+				StartingNode: ua.ParseNodeID("ns=2;s=Demo"),
+				RelativePath: ua.RelativePath{
+					Elements: []ua.RelativePathElement{
+						{TargetName: ua.ParseQualifiedName("2:Static")},
+						{TargetName: ua.ParseQualifiedName("2:Scalar")},
+						{TargetName: ua.ParseQualifiedName("2:Float")},
+					},
+				},
+			},
+		},
+	}
+	res, err := ch.TranslateBrowsePathsToNodeIDs(ctx, req)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error TranslateBrowsePathsToNodeIDs"))
+		ch.Abort(ctx)
+		return
+	}
+	ch.Close(ctx)
+	t.Logf("Results:")
+	for i, r := range res.Results {
+		if r.StatusCode.IsGood() {
+			t.Logf("%s: %d", req.BrowsePaths[i].StartingNode, len(r.Targets))
+			for _, target := range r.Targets {
+				t.Logf("  %s: %d", target.TargetID, target.RemainingPathIndex)
+			}
+		} else {
+			t.Logf("code: %s", r.StatusCode)
+			t.Logf("%s: %d", req.BrowsePaths[i].StartingNode, len(r.Targets))
+			for _, target := range r.Targets {
+				t.Logf("  %s: %d", target.TargetID, target.RemainingPathIndex)
+			}
+			t.Error("Error TranslateBrowsePath")
+		}
+	}
+}
+
+// TestTranslateBrowsePaths tests paths with several elements, several targets, inverse references and
+// any reference type, and the status codes of paths that do not resolve.
+func TestTranslateBrowsePaths(t *testing.T) {
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening client"))
+	}
+	defer ch.Close(ctx)
+	folders, err := ua.ParseRelativePath("/2:Demo/2:Paths/2:folder1/2:folder2")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error parsing relative path"))
+	}
+	req := &ua.TranslateBrowsePathsToNodeIDsRequest{
+		BrowsePaths: []ua.BrowsePath{
+			{
+				StartingNode: ua.ObjectIDObjectsFolder,
+				RelativePath: folders,
+			},
+			{
+				StartingNode: ua.ParseNodeID("ns=2;s=Demo.Static.Scalar"),
+				RelativePath: ua.RelativePath{
+					Elements: []ua.RelativePathElement{
+						{ReferenceTypeID: ua.ReferenceTypeIDOrganizes},
+					},
+				},
+			},
+			{
+				StartingNode: ua.ParseNodeID("ns=2;s=Demo.Static.Scalar.Float"),
+				RelativePath: ua.RelativePath{
+					Elements: []ua.RelativePathElement{
+						{IsInverse: true, TargetName: ua.ParseQualifiedName("2:Scalar")},
+						{IsInverse: true, TargetName: ua.ParseQualifiedName("2:Static")},
+					},
+				},
+			},
+			{
+				StartingNode: ua.ParseNodeID("ns=2;s=Demo"),
+				RelativePath: ua.RelativePath{
+					Elements: []ua.RelativePathElement{
+						{ReferenceTypeID: ua.ReferenceTypeIDHierarchicalReferences, IncludeSubtypes: true, TargetName: ua.ParseQualifiedName("2:Missing")},
+					},
+				},
+			},
+			{
+				StartingNode: ua.ParseNodeID("ns=2;s=Demo"),
+				RelativePath: ua.RelativePath{
+					Elements: []ua.RelativePathElement{
+						{ReferenceTypeID: ua.ReferenceTypeIDOrganizes},
+						{ReferenceTypeID: ua.ReferenceTypeIDOrganizes, TargetName: ua.ParseQualifiedName("2:Scalar")},
+					},
+				},
+			},
+			{
+				StartingNode: ua.ParseNodeID("ns=2;s=Unknown"),
+				RelativePath: folders,
+			},
+		},
+	}
+	res, err := ch.TranslateBrowsePathsToNodeIDs(ctx, req)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error TranslateBrowsePathsToNodeIDs"))
+	}
+	want := []struct {
+		status  ua.StatusCode
+		targets int
+		target  ua.NodeID
+	}{
+		{ua.Good, 1, ua.ParseNodeID("ns=2;s=Demo.Paths.folder1.folder2")},
+		{ua.Good, 21, nil},
+		{ua.Good, 1, ua.ParseNodeID("ns=2;s=Demo.Static")},
+		{ua.BadNoMatch, 0, nil},
+		{ua.BadBrowseNameInvalid, 0, nil},
+		{ua.BadNodeIDUnknown, 0, nil},
+	}
+	for i, r := range res.Results {
+		if r.StatusCode != want[i].status || len(r.Targets) != want[i].targets {
+			t.Errorf("Error translating path %d. want: %s %d, got: %s %d", i, want[i].status, want[i].targets, r.StatusCode, len(r.Targets))
+			continue
+		}
+		for _, target := range r.Targets {
+			if target.RemainingPathIndex != math.MaxUint32 {
+				t.Errorf("Error translating path %d. got RemainingPathIndex: %d", i, target.RemainingPathIndex)
+			}
+		}
+		if want[i].target != nil && ua.ToNodeID(r.Targets[0].TargetID, nil) != want[i].target {
+			t.Errorf("Error translating path %d. want: %s, got: %s", i, want[i].target, r.Targets[0].TargetID)
+		}
+	}
+}
+
+/*
+// TestReadHistory demonstrates reading history from the UaCPPServer available from https://www.unified-automation.com/
+func TestReadHistory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping long running test")
+	}
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		"opc.tcp://localhost:48010",
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(), // skips verification of server certificate
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	t.Logf("Success opening client: %s", ch.EndpointURL())
+
+	t.Logf("Start logging of data...")
+	req := &ua.CallRequest{
+		MethodsToCall: []ua.CallMethodRequest{
+			{
+				ObjectID:       ua.ParseNodeID("ns=2;s=Demo.History"), // parent node
+				MethodID:       ua.ParseNodeID("ns=2;s=Demo.History.StartLogging"),
+				InputArguments: []ua.Variant{},
+			},
+		},
+	}
+
+	res, err := ch.Call(ctx, req)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error calling method"))
+		ch.Abort(ctx)
+		return
+	}
+	_ = res
+
+	t.Logf("Collecting 10 seconds of data...")
+	time.Sleep(10 * time.Second)
+
+	t.Log("Reading history for last 10 seconds")
+	var cp ua.ByteString
+	for {
+		req2 := &ua.HistoryReadRequest{
+			HistoryReadDetails: ua.ReadRawModifiedDetails{
+				StartTime:        time.Now().Add(-1 * time.Minute),
+				EndTime:          time.Now(),
+				NumValuesPerNode: 100,
+				ReturnBounds:     false,
+			},
+			TimestampsToReturn:        ua.TimestampsToReturnBoth,
+			ReleaseContinuationPoints: false,
+			NodesToRead: []ua.HistoryReadValueID{
+				{NodeID: ua.ParseNodeID("ns=2;s=Demo.History.DoubleWithHistory"), ContinuationPoint: cp},
+			},
+		}
+
+		res2, err := ch.HistoryRead(ctx, req2)
+		if err != nil {
+			t.Error(errors.Wrap(err, "Error reading"))
+			ch.Abort(ctx)
+			return
+		}
+
+		if res2.Results[0].StatusCode.IsBad() {
+			t.Errorf("Error reading values for node '%s'. %s", req2.NodesToRead[0].NodeID, res2.Results[0].StatusCode)
+			ch.Abort(ctx)
+			return
+		}
+
+		if historyData, ok := res2.Results[0].HistoryData.(ua.HistoryData); ok {
+			t.Logf("Found %d value(s) for node '%s':", len(historyData.DataValues), req2.NodesToRead[0].NodeID)
+			for _, result := range historyData.DataValues {
+				t.Logf("Read %v, q: %#X, ts: %s", result.Value, uint32(result.StatusCode), result.SourceTimestamp)
+			}
+		}
+
+		cp = res2.Results[0].ContinuationPoint
+		if cp == "" {
+			break
+		}
+	}
+	t.Log("Now read the 1 sec average of the last 10 seconds...")
+
+	req3 := &ua.HistoryReadRequest{
+		HistoryReadDetails: ua.ReadProcessedDetails{
+			StartTime:          time.Now().Add(-10 * time.Second),
+			EndTime:            time.Now(),
+			ProcessingInterval: 1000.0,
+			AggregateType:      []ua.NodeID{ua.ObjectIDAggregateFunctionAverage},
+		},
+		TimestampsToReturn:        ua.TimestampsToReturnBoth,
+		ReleaseContinuationPoints: false,
+		NodesToRead: []ua.HistoryReadValueID{
+			{NodeID: ua.ParseNodeID("ns=2;s=Demo.History.DoubleWithHistory")},
+		},
+	}
+
+	res3, err := ch.HistoryRead(ctx, req3)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading"))
+		ch.Abort(ctx)
+		return
+	}
+
+	if res3.Results[0].StatusCode.IsBad() {
+		t.Errorf("Error reading values for node '%s'. %s", req3.NodesToRead[0].NodeID, res3.Results[0].StatusCode)
+		ch.Abort(ctx)
+		return
+	}
+
+	if historyData, ok := res3.Results[0].HistoryData.(ua.HistoryData); ok {
+		t.Logf("Found %d average value(s) for node '%s':", len(historyData.DataValues), req3.NodesToRead[0].NodeID)
+		for _, result := range historyData.DataValues {
+			t.Logf("Read %v, q: %#X, ts: %s", result.Value, uint32(result.StatusCode), result.SourceTimestamp)
+		}
+	}
+
+	t.Logf("Stop logging of data...")
+	req4 := &ua.CallRequest{
+		MethodsToCall: []ua.CallMethodRequest{{
+			ObjectID:       ua.ParseNodeID("ns=2;s=Demo.History"), // parent node
+			MethodID:       ua.ParseNodeID("ns=2;s=Demo.History.StopLogging"),
+			InputArguments: []ua.Variant{}},
+		},
+	}
+
+	res4, err := ch.Call(ctx, req4)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error calling method"))
+		ch.Abort(ctx)
+		return
+	}
+	_ = res4
+
+	ch.Close(ctx)
+}
+*/
+
+func createNewCertificate(appName, certFile, keyFile string) error {
+
+	// Create a keypair.
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return ua.BadCertificateInvalid
+	}
+
+	// Create a certificate.
+	host, _ := os.Hostname()
+	applicationURI, _ := url.Parse(fmt.Sprintf("urn:%s:%s", host, appName))
+	serialNumber, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	subjectKeyHash := sha1.New()
+	subjectKeyHash.Write(key.PublicKey.N.Bytes())
+	subjectKeyId := subjectKeyHash.Sum(nil)
+
+	template := x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: appName},
+		SubjectKeyId:          subjectKeyId,
+		AuthorityKeyId:        subjectKeyId,
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment | x509.KeyUsageKeyEncipherment | x509.KeyUsageDataEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{host},
+		URIs:                  []*url.URL{applicationURI},
+	}
+
+	rawcrt, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return ua.BadCertificateInvalid
+	}
+
+	if f, err := os.Create(certFile); err == nil {
+		block := &pem.Block{Type: "CERTIFICATE", Bytes: rawcrt}
+		if err := pem.Encode(f, block); err != nil {
+			f.Close()
+			return err
+		}
+		f.Close()
+	} else {
+		return err
+	}
+
+	if f, err := os.Create(keyFile); err == nil {
+		block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+		if err := pem.Encode(f, block); err != nil {
+			f.Close()
+			return err
+		}
+		f.Close()
+	} else {
+		return err
+	}
+
+	return nil
+}
+
+func ensurePKI() error {
+
+	// check if ./pki already exists
+	if _, err := os.Stat("./pki"); !os.IsNotExist(err) {
+		return nil
+	}
+
+	// make a pki directory, if not exist
+	if err := os.MkdirAll("./pki", os.ModeDir|0755); err != nil {
+		return err
+	}
+
+	// create a client cert in ./pki
+	if err := createNewCertificate("test-client", "./pki/client.crt", "./pki/client.key"); err != nil {
+		return err
+	}
+
+	// create a server cert in ./pki
+	if err := createNewCertificate("testserver", "./pki/server.crt", "./pki/server.key"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// TestAddDuplicateNode tests that a node is not added if its NodeID is already registered.
+func TestAddDuplicateNode(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	newNode := func(id ua.NodeID, name string) *server.ObjectNode {
+		return server.NewObjectNode(
+			id,
+			ua.NewQualifiedName(2, name),
+			ua.NewLocalizedText(name, ""),
+			ua.NewLocalizedText("", ""),
+			nil,
+			[]ua.Reference{
+				{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.ObjectTypeIDBaseObjectType)},
+			},
+			0,
+		)
+	}
+	id := ua.ParseNodeID("ns=2;s=Test.Duplicate")
+	first := newNode(id, "First")
+	if err := nm.AddNode(first); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(first, false)
+	if err := nm.AddNode(newNode(id, "Second")); err != ua.BadNodeIDExists {
+		t.Errorf("Error adding node. want: %s, got: %v", ua.BadNodeIDExists, err)
+	}
+	if n, _ := nm.FindNode(id); n != first {
+		t.Error("Error adding node. The registered node was replaced.")
+	}
+	// a batch with a duplicate NodeID is rejected as a whole.
+	other := ua.ParseNodeID("ns=2;s=Test.Duplicate2")
+	if err := nm.AddNodes(newNode(other, "Third"), newNode(other, "Fourth")); err != ua.BadNodeIDExists {
+		t.Errorf("Error adding nodes. want: %s, got: %v", ua.BadNodeIDExists, err)
+	}
+	if _, ok := nm.FindNode(other); ok {
+		t.Error("Error adding nodes. The batch was partially added.")
+	}
+}
+
+// TestAccessPolicy tests computing the permissions of a node by an access policy.
+func TestAccessPolicy(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	id := ua.ParseNodeID("ns=2;s=Test.AccessPolicy")
+	n := server.NewVariableNode(
+		id,
+		ua.NewQualifiedName(2, "AccessPolicy"),
+		ua.NewLocalizedText("AccessPolicy", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+		},
+		ua.NewDataValue(int32(42), 0, time.Now(), 0, time.Now(), 0),
+		ua.DataTypeIDInt32,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentRead,
+		250,
+		false,
+		nil,
+	)
+	nm := testServer.NamespaceManager()
+	if err := nm.AddNode(n); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(n, false)
+	// anonymous users may browse, but not read the node.
+	testServer.SetAccessPolicy(func(ctx context.Context, node server.Node, roles []ua.NodeID) []ua.RolePermissionType {
+		if node.NodeID() != id {
+			return server.DefaultRolePermissions
+		}
+		return []ua.RolePermissionType{
+			{RoleID: ua.ObjectIDWellKnownRoleAnonymous, Permissions: ua.PermissionTypeBrowse},
+			{RoleID: ua.ObjectIDWellKnownRoleAuthenticatedUser, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead},
+		}
+	})
+	defer testServer.SetAccessPolicy(nil)
+
+	read := func(opts ...client.Option) (ua.StatusCode, error) {
+		ctx := context.Background()
+		ch, err := client.Dial(ctx, endpointURL, append(opts, client.WithInsecureSkipVerify())...)
+		if err != nil {
+			return 0, err
+		}
+		defer ch.Close(ctx)
+		res, err := ch.Read(ctx, &ua.ReadRequest{
+			NodesToRead: []ua.ReadValueID{{NodeID: id, AttributeID: ua.AttributeIDValue}},
+		})
+		if err != nil {
+			return 0, err
+		}
+		return res.Results[0].StatusCode, nil
+	}
+	sc, err := read()
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading"))
+		return
+	}
+	if sc != ua.BadUserAccessDenied {
+		t.Errorf("Error reading as anonymous. want: %s, got: %s", ua.BadUserAccessDenied, sc)
+	}
+	sc, err = read(client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"), client.WithUserNameIdentity("root", "secret"))
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading"))
+		return
+	}
+	if sc != ua.Good {
+		t.Errorf("Error reading as user. want: %s, got: %s", ua.Good, sc)
+	}
+}
+
+// TestOperationLimits tests that a read of more nodes than MaxNodesPerRead is rejected.
+func TestOperationLimits(t *testing.T) {
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	res, err := ch.Read(ctx, &ua.ReadRequest{
+		NodesToRead: []ua.ReadValueID{
+			{NodeID: ua.VariableIDServerServerCapabilitiesOperationLimitsMaxNodesPerRead, AttributeID: ua.AttributeIDValue},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading"))
+		return
+	}
+	max, ok := res.Results[0].Value.(uint32)
+	if !ok || max != 1000 {
+		t.Errorf("Error reading MaxNodesPerRead. want: 1000, got: %v", res.Results[0].Value)
+		return
+	}
+	nodesToRead := make([]ua.ReadValueID, max)
+	for i := range nodesToRead {
+		nodesToRead[i] = ua.ReadValueID{NodeID: ua.VariableIDServerServerStatusCurrentTime, AttributeID: ua.AttributeIDValue}
+	}
+	if _, err = ch.Read(ctx, &ua.ReadRequest{NodesToRead: nodesToRead}); err != nil {
+		t.Error(errors.Wrap(err, "Error reading"))
+		return
+	}
+	nodesToRead = append(nodesToRead, nodesToRead[0])
+	_, err = ch.Read(ctx, &ua.ReadRequest{NodesToRead: nodesToRead})
+	if err != ua.BadTooManyOperations {
+		t.Errorf("Error reading. want: %s, got: %v", ua.BadTooManyOperations, err)
+	}
+}
+
+// TestActivateSessionStaleNonce tests that a user token encrypted with a server nonce the server did not
+// issue, or with a nonce that was already used, is rejected.
+func TestActivateSessionStaleNonce(t *testing.T) {
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	res, err := client.GetEndpoints(ctx, &ua.GetEndpointsRequest{EndpointURL: endpointURL})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error calling GetEndpoints"))
+		return
+	}
+	crt, err := x509.ParseCertificate([]byte(res.Endpoints[0].ServerCertificate))
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error parsing server certificate"))
+		return
+	}
+	// newRequest encrypts the password as the client would, with the given server nonce.
+	newRequest := func(nonce []byte) (*ua.ActivateSessionRequest, error) {
+		password := []byte("secret")
+		plainText := make([]byte, 4, 4+len(password)+len(nonce))
+		plainText[0] = byte(len(password) + len(nonce))
+		plainText = append(append(plainText, password...), nonce...)
+		cipherText, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, crt.PublicKey.(*rsa.PublicKey), plainText, []byte{})
+		if err != nil {
+			return nil, err
+		}
+		return &ua.ActivateSessionRequest{
+			LocaleIDs: []string{"en"},
+			UserIdentityToken: ua.UserNameIdentityToken{
+				UserName:            "root",
+				Password:            ua.ByteString(cipherText),
+				EncryptionAlgorithm: ua.RsaOaepKeyWrap,
+				PolicyID:            ua.UserTokenTypeUserName.String(),
+			},
+		}, nil
+	}
+
+	// a nonce the server did not issue.
+	staleNonce := make([]byte, 32)
+	rand.Read(staleNonce)
+	req, err := newRequest(staleNonce)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error encrypting password"))
+	}
+	if _, err = ch.ActivateSession(ctx, req); err != ua.BadNonceInvalid {
+		t.Errorf("Error activating session. want: %s, got: %v", ua.BadNonceInvalid, err)
+	}
+
+	// the last nonce issued to the session is accepted once, then the request is replayed.
+	res2, err := ch.ActivateSession(ctx, &ua.ActivateSessionRequest{
+		LocaleIDs:         []string{"en"},
+		UserIdentityToken: ua.AnonymousIdentityToken{PolicyID: ua.UserTokenTypeAnonymous.String()},
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error activating session"))
+	}
+	req, err = newRequest([]byte(res2.ServerNonce))
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error encrypting password"))
+	}
+	if _, err = ch.ActivateSession(ctx, req); err != nil {
+		t.Fatal(errors.Wrap(err, "Error activating session"))
+	}
+	if _, err = ch.ActivateSession(ctx, req); err != ua.BadNonceInvalid {
+		t.Errorf("Error replaying session activation. want: %s, got: %v", ua.BadNonceInvalid, err)
+	}
+}
+
+// TestRequestServerStateChange tests changing the state of a server by calling the RequestServerStateChange method.
+func TestRequestServerStateChange(t *testing.T) {
+	url := "opc.tcp://127.0.0.1:46012"
+	rules := append([]server.IdentityMappingRule{}, server.DefaultIdentityMappingRules...)
+	rules = append(rules, server.IdentityMappingRule{
+		NodeID: ua.ObjectIDWellKnownRoleConfigureAdmin,
+		Identities: []ua.IdentityMappingRuleType{
+			{CriteriaType: ua.IdentityCriteriaTypeUserName, Criteria: "admin"},
+		},
+		ApplicationsExclude: true,
+		EndpointsExclude:    true,
+	})
+	srv, err := server.New(
+		ua.ApplicationDescription{ApplicationName: ua.NewLocalizedText("statechangeserver", "")},
+		"./pki/server.crt",
+		"./pki/server.key",
+		url,
+		server.WithAuthenticateUserNameIdentityFunc(func(userIdentity ua.UserNameIdentity, applicationURI string, endpointURL string) error {
+			if userIdentity.Password != "secret" {
+				return ua.BadUserAccessDenied
+			}
+			return nil
+		}),
+		server.WithRolesProvider(server.NewRulesBasedRolesProvider(rules)),
+		server.WithSecurityPolicyNone(true),
+		server.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error constructing server"))
+		return
+	}
+	halted := make(chan error, 1)
+	go func() { halted <- srv.ListenAndServe() }()
+	time.Sleep(100 * time.Millisecond)
+
+	ctx := context.Background()
+	call := func(userName string, state ua.ServerState) (ua.StatusCode, error) {
+		ch, err := client.Dial(ctx, url, client.WithInsecureSkipVerify(), client.WithUserNameIdentity(userName, "secret"))
+		if err != nil {
+			return 0, err
+		}
+		defer ch.Close(ctx)
+		res, err := ch.Call(ctx, &ua.CallRequest{
+			MethodsToCall: []ua.CallMethodRequest{{
+				ObjectID: ua.ObjectIDServer,
+				MethodID: ua.MethodIDServerRequestServerStateChange,
+				InputArguments: []ua.Variant{
+					int32(state), time.Time{}, uint32(1), ua.NewLocalizedText("Maintenance", ""), false,
+				},
+			}},
+		})
+		if err != nil {
+			return 0, err
+		}
+		return res.Results[0].StatusCode, nil
+	}
+	if sc, err := call("user", ua.ServerStateSuspended); err != nil || sc != ua.BadNotExecutable {
+		t.Errorf("Error calling method as user. want: %s, got: %s, %v", ua.BadNotExecutable, sc, err)
+	}
+	if sc, err := call("admin", ua.ServerStateSuspended); err != nil || sc != ua.Good {
+		t.Errorf("Error calling method as admin. want: %s, got: %s, %v", ua.Good, sc, err)
+	}
+	if state := srv.State(); state != ua.ServerStateSuspended {
+		t.Errorf("Error changing server state. want: %s, got: %s", ua.ServerStateSuspended, state)
+	}
+	if sc, err := call("admin", ua.ServerStateShutdown); err != nil || sc != ua.Good {
+		t.Errorf("Error calling method as admin. want: %s, got: %s, %v", ua.Good, sc, err)
+	}
+	select {
+	case err := <-halted:
+		if err != ua.BadServerHalted {
+			t.Errorf("Error shutting down server. want: %s, got: %v", ua.BadServerHalted, err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Error("Error shutting down server. The server is still running.")
+		srv.Close()
+	}
+}
+
+// TestRolesProviderGroups tests that the roles of a user are granted by the rules that match the
+// user name or the groups of the user.
+func TestRolesProviderGroups(t *testing.T) {
+	url := "opc.tcp://127.0.0.1:46029"
+	rules := []server.IdentityMappingRule{
+		{
+			NodeID:              ua.ObjectIDWellKnownRoleAnonymous,
+			Identities:          []ua.IdentityMappingRuleType{{CriteriaType: ua.IdentityCriteriaTypeAnonymous}},
+			ApplicationsExclude: true,
+			EndpointsExclude:    true,
+		},
+		// this rule only applies to another endpoint, so it is skipped.
+		{
+			NodeID:              ua.ObjectIDWellKnownRoleSecurityAdmin,
+			Identities:          []ua.IdentityMappingRuleType{{CriteriaType: ua.IdentityCriteriaTypeAuthenticatedUser}},
+			ApplicationsExclude: true,
+			Endpoints: []struct {
+				EndpointUrl         string
+				SecurityMode        string
+				SecurityPolicyURI   string
+				TransportProfileUri string
+			}{{EndpointUrl: "opc.tcp://127.0.0.1:46999"}},
+		},
+		{
+			NodeID:              ua.ObjectIDWellKnownRoleAuthenticatedUser,
+			Identities:          []ua.IdentityMappingRuleType{{CriteriaType: ua.IdentityCriteriaTypeAuthenticatedUser}},
+			ApplicationsExclude: true,
+			EndpointsExclude:    true,
+		},
+		{
+			NodeID: ua.ObjectIDWellKnownRoleEngineer,
+			Identities: []ua.IdentityMappingRuleType{
+				{CriteriaType: ua.IdentityCriteriaTypeGroupID, Criteria: "engineers"},
+				{CriteriaType: ua.IdentityCriteriaTypeGroupID, Criteria: "maintenance"},
+			},
+			ApplicationsExclude: true,
+			EndpointsExclude:    true,
+		},
+		{
+			NodeID:              ua.ObjectIDWellKnownRoleSupervisor,
+			Identities:          []ua.IdentityMappingRuleType{{CriteriaType: ua.IdentityCriteriaTypeUserName, Criteria: "carol"}},
+			ApplicationsExclude: true,
+			EndpointsExclude:    true,
+		},
+	}
+	groups := server.UserNameGroups(map[string][]string{
+		"alice": {"engineers", "maintenance"},
+		"carol": {"operators"},
+	})
+	srv, err := server.New(
+		ua.ApplicationDescription{ApplicationName: ua.NewLocalizedText("rolesserver", "")},
+		"./pki/server.crt",
+		"./pki/server.key",
+		url,
+		server.WithAuthenticateUserNameIdentityFunc(func(userIdentity ua.UserNameIdentity, applicationURI string, endpointURL string) error {
+			if userIdentity.Password != "secret" {
+				return ua.BadUserAccessDenied
+			}
+			return nil
+		}),
+		server.WithRolesProvider(server.NewRulesBasedRolesProviderWithGroups(rules, groups)),
+		server.WithAnonymousIdentity(true),
+		server.WithSecurityPolicyNone(true),
+		server.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error constructing server"))
+		return
+	}
+	defer srv.Close()
+	go srv.ListenAndServe()
+	time.Sleep(100 * time.Millisecond)
+
+	ctx := context.Background()
+	// roles returns the roles of the user, read from the UserRolePermissions of the Server object.
+	roles := func(opts ...client.Option) ([]ua.NodeID, error) {
+		ch, err := client.Dial(ctx, url, append([]client.Option{client.WithInsecureSkipVerify()}, opts...)...)
+		if err != nil {
+			return nil, err
+		}
+		defer ch.Close(ctx)
+		res, err := ch.Read(ctx, &ua.ReadRequest{
+			NodesToRead: []ua.ReadValueID{{NodeID: ua.ObjectIDServer, AttributeID: ua.AttributeIDUserRolePermissions}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		roles := []ua.NodeID{}
+		list, _ := res.Results[0].Value.([]ua.ExtensionObject)
+		for _, item := range list {
+			if rp, ok := item.(ua.RolePermissionType); ok {
+				roles = append(roles, rp.RoleID)
+			}
+		}
+		return roles, nil
+	}
+	cases := []struct {
+		user string
+		want []ua.NodeID
+	}{
+		{"", []ua.NodeID{ua.ObjectIDWellKnownRoleAnonymous}},
+		{"alice", []ua.NodeID{ua.ObjectIDWellKnownRoleAuthenticatedUser, ua.ObjectIDWellKnownRoleEngineer}},
+		{"bob", []ua.NodeID{ua.ObjectIDWellKnownRoleAuthenticatedUser}},
+		{"carol", []ua.NodeID{ua.ObjectIDWellKnownRoleAuthenticatedUser, ua.ObjectIDWellKnownRoleSupervisor}},
+	}
+	for _, c := range cases {
+		opts := []client.Option{}
+		if c.user != "" {
+			opts = append(opts, client.WithUserNameIdentity(c.user, "secret"))
+		}
+		got, err := roles(opts...)
+		if err != nil {
+			t.Error(errors.Wrapf(err, "Error reading roles of '%s'", c.user))
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Error mapping roles of '%s'. want: %v, got: %v", c.user, c.want, got)
+		}
+	}
+}
+
+// TestActivateSessionIssuedAndX509Identity tests activating sessions with JSON Web Tokens and user certificates.
+func TestActivateSessionIssuedAndX509Identity(t *testing.T) {
+	url := "opc.tcp://127.0.0.1:46030"
+	secret := []byte("secret")
+	sign := func(key []byte, claims map[string]interface{}) ua.ByteString {
+		body, _ := json.Marshal(claims)
+		signed := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + base64.RawURLEncoding.EncodeToString(body)
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signed))
+		return ua.ByteString(signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)))
+	}
+	rules := []server.IdentityMappingRule{
+		{
+			NodeID:              ua.ObjectIDWellKnownRoleAuthenticatedUser,
+			Identities:          []ua.IdentityMappingRuleType{{CriteriaType: ua.IdentityCriteriaTypeAuthenticatedUser}},
+			ApplicationsExclude: true,
+			EndpointsExclude:    true,
+		},
+		{
+			NodeID:              ua.ObjectIDWellKnownRoleEngineer,
+			Identities:          []ua.IdentityMappingRuleType{{CriteriaType: ua.IdentityCriteriaTypeGroupID, Criteria: "engineers"}},
+			ApplicationsExclude: true,
+			EndpointsExclude:    true,
+		},
+		{
+			NodeID:              ua.ObjectIDWellKnownRoleSupervisor,
+			Identities:          []ua.IdentityMappingRuleType{{CriteriaType: ua.IdentityCriteriaTypeUserName, Criteria: "alice"}},
+			ApplicationsExclude: true,
+			EndpointsExclude:    true,
+		},
+	}
+	srv, err := server.New(
+		ua.ApplicationDescription{ApplicationURI: "urn:127.0.0.1:identityserver", ApplicationName: ua.NewLocalizedText("identityserver", "")},
+		"./pki/server.crt",
+		"./pki/server.key",
+		url,
+		server.WithIssuedIdentityAuthenticator(&server.JWTAuthenticator{
+			Issuer:   "https://idp.example.com",
+			Audience: "urn:127.0.0.1:identityserver",
+			Keys:     []crypto.PublicKey{secret},
+		}),
+		server.WithUserCertificateValidator(&ua.CertificateValidator{TrustedCertsPath: "./pki/client.crt"}),
+		server.WithRolesProvider(server.NewRulesBasedRolesProvider(rules)),
+		server.WithSecurityPolicyNone(true),
+		server.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error constructing server"))
+		return
+	}
+	defer srv.Close()
+	go srv.ListenAndServe()
+	time.Sleep(100 * time.Millisecond)
+
+	ctx := context.Background()
+	// roles returns the roles of the user, read from the UserRolePermissions of the Server object.
+	roles := func(opt client.Option) ([]ua.NodeID, error) {
+		ch, err := client.Dial(ctx, url, client.WithInsecureSkipVerify(), opt)
+		if err != nil {
+			return nil, err
+		}
+		defer ch.Close(ctx)
+		res, err := ch.Read(ctx, &ua.ReadRequest{
+			NodesToRead: []ua.ReadValueID{{NodeID: ua.ObjectIDServer, AttributeID: ua.AttributeIDUserRolePermissions}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		roles := []ua.NodeID{}
+		list, _ := res.Results[0].Value.([]ua.ExtensionObject)
+		for _, item := range list {
+			if rp, ok := item.(ua.RolePermissionType); ok {
+				roles = append(roles, rp.RoleID)
+			}
+		}
+		return roles, nil
+	}
+
+	exp := float64(time.Now().Add(time.Hour).Unix())
+	got, err := roles(client.WithIssuedIdentity(sign(secret, map[string]interface{}{
+		"iss": "https://idp.example.com", "aud": "urn:127.0.0.1:identityserver", "sub": "alice", "exp": exp, "groups": []string{"engineers"},
+	})))
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error activating session with token"))
+	} else if want := []ua.NodeID{ua.ObjectIDWellKnownRoleAuthenticatedUser, ua.ObjectIDWellKnownRoleEngineer, ua.ObjectIDWellKnownRoleSupervisor}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Error mapping roles of token. want: %v, got: %v", want, got)
+	}
+	cases := []struct {
+		name  string
+		token ua.ByteString
+		want  ua.StatusCode
+	}{
+		{"expired", sign(secret, map[string]interface{}{"iss": "https://idp.example.com", "aud": "urn:127.0.0.1:identityserver", "sub": "alice", "exp": float64(time.Now().Add(-time.Hour).Unix())}), ua.BadIdentityTokenRejected},
+		{"audience", sign(secret, map[string]interface{}{"iss": "https://idp.example.com", "aud": "urn:other", "sub": "alice", "exp": exp}), ua.BadIdentityTokenRejected},
+		{"issuer", sign(secret, map[string]interface{}{"iss": "https://other.example.com", "aud": "urn:127.0.0.1:identityserver", "sub": "alice", "exp": exp}), ua.BadIdentityTokenRejected},
+		{"signature", sign([]byte("other"), map[string]interface{}{"iss": "https://idp.example.com", "aud": "urn:127.0.0.1:identityserver", "sub": "alice", "exp": exp}), ua.BadIdentityTokenRejected},
+		{"malformed", ua.ByteString("not a token"), ua.BadIdentityTokenInvalid},
+	}
+	for _, c := range cases {
+		if _, err := roles(client.WithIssuedIdentity(c.token)); errors.Cause(err) != c.want {
+			t.Errorf("Error activating session with %s token. want: %s, got: %v", c.name, c.want, err)
+		}
+	}
+
+	// the user certificate must be trusted, and the user must sign with the private key.
+	loadIdentity := func(certFile, keyFile string) client.Option {
+		crt, err := os.ReadFile(certFile)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "Error reading certificate"))
+		}
+		block, _ := pem.Decode(crt)
+		buf, err := os.ReadFile(keyFile)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "Error reading key"))
+		}
+		keyBlock, _ := pem.Decode(buf)
+		key, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "Error parsing key"))
+		}
+		return client.WithX509Identity(ua.ByteString(block.Bytes), key)
+	}
+	got, err = roles(loadIdentity("./pki/client.crt", "./pki/client.key"))
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error activating session with certificate"))
+	} else if want := []ua.NodeID{ua.ObjectIDWellKnownRoleAuthenticatedUser}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Error mapping roles of certificate. want: %v, got: %v", want, got)
+	}
+	if _, err := roles(loadIdentity("./pki/server.crt", "./pki/server.key")); errors.Cause(err) != ua.BadIdentityTokenRejected {
+		t.Errorf("Error activating session with untrusted certificate. want: %s, got: %v", ua.BadIdentityTokenRejected, err)
+	}
+}
+
+// TestActivateSessionUnverifiedClaims tests that the claims of a token accepted by an authenticator
+// other than the JWTAuthenticator do not grant roles.
+func TestActivateSessionUnverifiedClaims(t *testing.T) {
+	url := "opc.tcp://127.0.0.1:46037"
+	rules := []server.IdentityMappingRule{
+		{
+			NodeID:              ua.ObjectIDWellKnownRoleAuthenticatedUser,
+			Identities:          []ua.IdentityMappingRuleType{{CriteriaType: ua.IdentityCriteriaTypeAuthenticatedUser}},
+			ApplicationsExclude: true,
+			EndpointsExclude:    true,
+		},
+		{
+			NodeID:              ua.ObjectIDWellKnownRoleEngineer,
+			Identities:          []ua.IdentityMappingRuleType{{CriteriaType: ua.IdentityCriteriaTypeGroupID, Criteria: "engineers"}},
+			ApplicationsExclude: true,
+			EndpointsExclude:    true,
+		},
+		{
+			NodeID:              ua.ObjectIDWellKnownRoleSupervisor,
+			Identities:          []ua.IdentityMappingRuleType{{CriteriaType: ua.IdentityCriteriaTypeUserName, Criteria: "alice"}},
+			ApplicationsExclude: true,
+			EndpointsExclude:    true,
+		},
+	}
+	srv, err := server.New(
+		ua.ApplicationDescription{ApplicationURI: "urn:127.0.0.1:claimsserver", ApplicationName: ua.NewLocalizedText("claimsserver", "")},
+		"./pki/server.crt",
+		"./pki/server.key",
+		url,
+		server.WithIssuedIdentityAuthenticator(server.AuthenticateIssuedIdentityFunc(func(userIdentity ua.IssuedIdentity, applicationURI string, endpointURL string) error {
+			return nil
+		})),
+		server.WithRolesProvider(server.NewRulesBasedRolesProvider(rules)),
+		server.WithSecurityPolicyNone(true),
+		server.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error constructing server"))
+		return
+	}
+	defer srv.Close()
+	go srv.ListenAndServe()
+	time.Sleep(100 * time.Millisecond)
+
+	// an unsigned token claiming the subject and group of privileged rules.
+	body, _ := json.Marshal(map[string]interface{}{"sub": "alice", "groups": []string{"engineers"}})
+	token := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`)) + "." + base64.RawURLEncoding.EncodeToString(body) + "."
+
+	ctx := context.Background()
+	ch, err := client.Dial(ctx, url, client.WithInsecureSkipVerify(), client.WithIssuedIdentity(ua.ByteString(token)))
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error activating session with token"))
+		return
+	}
+	defer ch.Close(ctx)
+	res, err := ch.Read(ctx, &ua.ReadRequest{
+		NodesToRead: []ua.ReadValueID{{NodeID: ua.ObjectIDServer, AttributeID: ua.AttributeIDUserRolePermissions}},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading"))
+		return
+	}
+	got := []ua.NodeID{}
+	list, _ := res.Results[0].Value.([]ua.ExtensionObject)
+	for _, item := range list {
+		if rp, ok := item.(ua.RolePermissionType); ok {
+			got = append(got, rp.RoleID)
+		}
+	}
+	if want := []ua.NodeID{ua.ObjectIDWellKnownRoleAuthenticatedUser}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Error mapping roles of unverified token. want: %v, got: %v", want, got)
+	}
+}
+
+// TestLimitBits tests that a change of the limit bits of a value is reported, even if the value is unchanged.
+func TestLimitBits(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	id := ua.ParseNodeID("ns=2;s=Test.LimitBits")
+	n := server.NewVariableNode(
+		id,
+		ua.NewQualifiedName(2, "LimitBits"),
+		ua.NewLocalizedText("LimitBits", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+		},
+		ua.GoodDataValue(float64(100)),
+		ua.DataTypeIDDouble,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentRead,
+		100,
+		false,
+		nil,
+	)
+	nm := testServer.NamespaceManager()
+	if err := nm.AddNode(n); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(n, false)
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	res, err := ch.CreateSubscription(ctx, &ua.CreateSubscriptionRequest{
+		RequestedPublishingInterval: 250.0,
+		RequestedMaxKeepAliveCount:  30,
+		RequestedLifetimeCount:      30 * 3,
+		PublishingEnabled:           true,
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating subscription"))
+		return
+	}
+	_, err = ch.CreateMonitoredItems(ctx, &ua.CreateMonitoredItemsRequest{
+		SubscriptionID:     res.SubscriptionID,
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+		ItemsToCreate: []ua.MonitoredItemCreateRequest{
+			{
+				ItemToMonitor:  ua.ReadValueID{AttributeID: ua.AttributeIDValue, NodeID: id},
+				MonitoringMode: ua.MonitoringModeReporting,
+				RequestedParameters: ua.MonitoringParameters{
+					ClientHandle: 42, QueueSize: 1, DiscardOldest: true, SamplingInterval: 100.0,
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating item"))
+		return
+	}
+	// nextStatusCode returns the status of the next data change notification.
+	var seqNum uint32
+	nextStatusCode := func() (ua.StatusCode, error) {
+		for {
+			req := &ua.PublishRequest{RequestHeader: ua.RequestHeader{TimeoutHint: 60000}}
+			if seqNum != 0 {
+				req.SubscriptionAcknowledgements = []ua.SubscriptionAcknowledgement{{SequenceNumber: seqNum, SubscriptionID: res.SubscriptionID}}
+			}
+			res, err := ch.Publish(ctx, req)
+			if err != nil {
+				return 0, err
+			}
+			if len(res.NotificationMessage.NotificationData) == 0 {
+				continue
+			}
+			seqNum = res.NotificationMessage.SequenceNumber
+			for _, data := range res.NotificationMessage.NotificationData {
+				if body, ok := data.(ua.DataChangeNotification); ok {
+					for _, z := range body.MonitoredItems {
+						return z.Value.StatusCode, nil
+					}
+				}
+			}
+		}
+	}
+	// initial value
+	sc, err := nextStatusCode()
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error publishing"))
+		return
+	}
+	if sc.Limit() != ua.LimitBitsNone {
+		t.Errorf("Initial value has limit bits. got: 0x%08X", uint32(sc))
+	}
+	// the sensor is pegged at its maximum.
+	n.SetValue(ua.DataValueWithStatus(float64(100), ua.Good.WithLimit(ua.LimitBitsHigh)))
+	sc, err = nextStatusCode()
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error publishing"))
+		return
+	}
+	if !sc.IsLimitHigh() {
+		t.Errorf("Value is missing high limit bits. got: 0x%08X", uint32(sc))
+	}
+}
+
+// TestNotificationInterceptor tests masking the values sent to anonymous users.
+func TestNotificationInterceptor(t *testing.T) {
+	url := "opc.tcp://127.0.0.1:46013"
+	srv, err := server.New(
+		ua.ApplicationDescription{ApplicationName: ua.NewLocalizedText("interceptorserver", "")},
+		"./pki/server.crt",
+		"./pki/server.key",
+		url,
+		server.WithNotificationInterceptor(func(ctx context.Context, item server.MonitoredItem, value ua.DataValue) ua.DataValue {
+			session, ok := ctx.Value(server.SessionKey).(*server.Session)
+			if !ok {
+				return value
+			}
+			for _, role := range session.UserRoles() {
+				if role == ua.ObjectIDWellKnownRoleAnonymous {
+					return ua.DataValueWithStatus(nil, ua.BadUserAccessDenied)
+				}
+			}
+			return value
+		}),
+		server.WithAnonymousIdentity(true),
+		server.WithSecurityPolicyNone(true),
+		server.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error constructing server"))
+		return
+	}
+	defer srv.Close()
+	go srv.ListenAndServe()
+	time.Sleep(100 * time.Millisecond)
+
+	ctx := context.Background()
+	ch, err := client.Dial(ctx, url, client.WithInsecureSkipVerify())
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	res, err := ch.CreateSubscription(ctx, &ua.CreateSubscriptionRequest{
+		RequestedPublishingInterval: 250.0,
+		RequestedMaxKeepAliveCount:  30,
+		RequestedLifetimeCount:      30 * 3,
+		PublishingEnabled:           true,
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating subscription"))
+		return
+	}
+	_, err = ch.CreateMonitoredItems(ctx, &ua.CreateMonitoredItemsRequest{
+		SubscriptionID:     res.SubscriptionID,
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+		ItemsToCreate: []ua.MonitoredItemCreateRequest{
+			{
+				ItemToMonitor:  ua.ReadValueID{AttributeID: ua.AttributeIDValue, NodeID: ua.VariableIDServerServerStatusCurrentTime},
+				MonitoringMode: ua.MonitoringModeReporting,
+				RequestedParameters: ua.MonitoringParameters{
+					ClientHandle: 42, QueueSize: 1, DiscardOldest: true, SamplingInterval: 100.0,
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating item"))
+		return
+	}
+	res2, err := ch.Publish(ctx, &ua.PublishRequest{RequestHeader: ua.RequestHeader{TimeoutHint: 60000}})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error publishing"))
+		return
+	}
+	for _, data := range res2.NotificationMessage.NotificationData {
+		if body, ok := data.(ua.DataChangeNotification); ok {
+			for _, z := range body.MonitoredItems {
+				if z.Value.StatusCode != ua.BadUserAccessDenied || z.Value.Value != nil {
+					t.Errorf("Error masking value. got: %v, %s", z.Value.Value, z.Value.StatusCode)
+				}
+				return
+			}
+		}
+	}
+	t.Error("Error publishing. want: data change, got: none")
+}
+
+// TestTimestampsToReturnInvalid tests that services reject an out of range TimestampsToReturn.
+func TestTimestampsToReturnInvalid(t *testing.T) {
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	nodesToRead := []ua.ReadValueID{{NodeID: ua.VariableIDServerServerStatusCurrentTime, AttributeID: ua.AttributeIDValue}}
+	_, err = ch.Read(ctx, &ua.ReadRequest{NodesToRead: nodesToRead, TimestampsToReturn: ua.TimestampsToReturnInvalid})
+	if err != ua.BadTimestampsToReturnInvalid {
+		t.Errorf("Error reading. want: %s, got: %v", ua.BadTimestampsToReturnInvalid, err)
+	}
+	historyRead := func(timestampsToReturn ua.TimestampsToReturn) error {
+		_, err := ch.HistoryRead(ctx, &ua.HistoryReadRequest{
+			HistoryReadDetails: ua.ReadRawModifiedDetails{StartTime: time.Now().Add(-time.Minute), EndTime: time.Now()},
+			TimestampsToReturn: timestampsToReturn,
+			NodesToRead:        []ua.HistoryReadValueID{{NodeID: ua.VariableIDServerServerStatusCurrentTime}},
+		})
+		return err
+	}
+	if err := historyRead(ua.TimestampsToReturnInvalid); err != ua.BadTimestampsToReturnInvalid {
+		t.Errorf("Error reading history. want: %s, got: %v", ua.BadTimestampsToReturnInvalid, err)
+	}
+	if err := historyRead(ua.TimestampsToReturnNeither); err != ua.BadInvalidTimestampArgument {
+		t.Errorf("Error reading history. want: %s, got: %v", ua.BadInvalidTimestampArgument, err)
+	}
+	res, err := ch.CreateSubscription(ctx, &ua.CreateSubscriptionRequest{
+		RequestedPublishingInterval: 1000.0,
+		RequestedMaxKeepAliveCount:  30,
+		RequestedLifetimeCount:      30 * 3,
+		PublishingEnabled:           true,
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating subscription"))
+		return
+	}
+	_, err = ch.CreateMonitoredItems(ctx, &ua.CreateMonitoredItemsRequest{
+		SubscriptionID:     res.SubscriptionID,
+		TimestampsToReturn: ua.TimestampsToReturn(-1),
+		ItemsToCreate: []ua.MonitoredItemCreateRequest{
+			{
+				ItemToMonitor:       ua.ReadValueID{AttributeID: ua.AttributeIDValue, NodeID: ua.VariableIDServerServerStatusCurrentTime},
+				MonitoringMode:      ua.MonitoringModeReporting,
+				RequestedParameters: ua.MonitoringParameters{ClientHandle: 42, QueueSize: 1, DiscardOldest: true, SamplingInterval: 1000.0},
+			},
+		},
+	})
+	if err != ua.BadTimestampsToReturnInvalid {
+		t.Errorf("Error creating item. want: %s, got: %v", ua.BadTimestampsToReturnInvalid, err)
+	}
+}
+
+// countingNotificationStore counts the messages put in the store, and records the last key.
+type countingNotificationStore struct {
+	*server.MemoryNotificationStore
+	sync.Mutex
+	puts int32
+	key  server.SubscriptionKey
+}
+
+func (s *countingNotificationStore) Put(key server.SubscriptionKey, message ua.NotificationMessage) error {
+	atomic.AddInt32(&s.puts, 1)
+	s.Lock()
+	s.key = key
+	s.Unlock()
+	return s.MemoryNotificationStore.Put(key, message)
+}
+
+func (s *countingNotificationStore) lastKey() server.SubscriptionKey {
+	s.Lock()
+	defer s.Unlock()
+	return s.key
+}
+
+// TestNotificationStore tests that published messages are retained in the NotificationStore
+// for Republish until they are acknowledged.
+func TestNotificationStore(t *testing.T) {
+	url := "opc.tcp://127.0.0.1:46014"
+	store := &countingNotificationStore{MemoryNotificationStore: server.NewMemoryNotificationStore()}
+	srv, err := server.New(
+		ua.ApplicationDescription{ApplicationName: ua.NewLocalizedText("storeserver", "")},
+		"./pki/server.crt",
+		"./pki/server.key",
+		url,
+		server.WithNotificationStore(store),
+		server.WithAnonymousIdentity(true),
+		server.WithSecurityPolicyNone(true),
+		server.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error constructing server"))
+		return
+	}
+	defer srv.Close()
+	go srv.ListenAndServe()
+	time.Sleep(100 * time.Millisecond)
+
+	ctx := context.Background()
+	ch, err := client.Dial(ctx, url, client.WithInsecureSkipVerify())
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	res, err := ch.CreateSubscription(ctx, &ua.CreateSubscriptionRequest{
+		RequestedPublishingInterval: 250.0,
+		RequestedMaxKeepAliveCount:  30,
+		RequestedLifetimeCount:      30 * 3,
+		PublishingEnabled:           true,
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating subscription"))
+		return
+	}
+	_, err = ch.CreateMonitoredItems(ctx, &ua.CreateMonitoredItemsRequest{
+		SubscriptionID:     res.SubscriptionID,
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+		ItemsToCreate: []ua.MonitoredItemCreateRequest{
+			{
+				ItemToMonitor:  ua.ReadValueID{AttributeID: ua.AttributeIDValue, NodeID: ua.VariableIDServerServerStatusCurrentTime},
+				MonitoringMode: ua.MonitoringModeReporting,
+				RequestedParameters: ua.MonitoringParameters{
+					ClientHandle: 42, QueueSize: 1, DiscardOldest: true, SamplingInterval: 100.0,
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating item"))
+		return
+	}
+	res2, err := ch.Publish(ctx, &ua.PublishRequest{RequestHeader: ua.RequestHeader{TimeoutHint: 60000}})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error publishing"))
+		return
+	}
+	seqNum := res2.NotificationMessage.SequenceNumber
+	if atomic.LoadInt32(&store.puts) == 0 {
+		t.Error("Error publishing. want: message put in store, got: none")
+		return
+	}
+	res3, err := ch.Republish(ctx, &ua.RepublishRequest{SubscriptionID: res.SubscriptionID, RetransmitSequenceNumber: seqNum})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error republishing"))
+		return
+	}
+	if res3.NotificationMessage.SequenceNumber != seqNum {
+		t.Errorf("Error republishing. want: %d, got: %d", seqNum, res3.NotificationMessage.SequenceNumber)
+		return
+	}
+	key := store.lastKey()
+	if key.SubscriptionID != res.SubscriptionID || key.InstanceID == "" {
+		t.Errorf("Error publishing. want: key of subscription %d, got: %+v", res.SubscriptionID, key)
+		return
+	}
+	if _, err := store.Get(key, seqNum); err != ua.BadMessageNotAvailable {
+		t.Errorf("Error republishing. want: message removed from store, got: %v", err)
+	}
+	store.Put(key, res2.NotificationMessage)
+	res4, err := ch.Publish(ctx, &ua.PublishRequest{
+		RequestHeader:                ua.RequestHeader{TimeoutHint: 60000},
+		SubscriptionAcknowledgements: []ua.SubscriptionAcknowledgement{{SubscriptionID: res.SubscriptionID, SequenceNumber: seqNum}},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error publishing"))
+		return
+	}
+	if len(res4.Results) != 1 || res4.Results[0] != ua.Good {
+		t.Errorf("Error acknowledging. want: Good, got: %v", res4.Results)
+	}
+	_, err = ch.Republish(ctx, &ua.RepublishRequest{SubscriptionID: res.SubscriptionID, RetransmitSequenceNumber: seqNum})
+	if err != ua.BadMessageNotAvailable {
+		t.Errorf("Error republishing acknowledged message. want: %s, got: %v", ua.BadMessageNotAvailable, err)
+	}
+}
+
+// TestWriteTransactional tests that a transactional write applies no value if any value is invalid.
+func TestWriteTransactional(t *testing.T) {
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	int64ID := ua.ParseNodeID("ns=2;s=Demo.Static.Scalar.Int64")
+	uint64ID := ua.ParseNodeID("ns=2;s=Demo.Static.Scalar.UInt64")
+	write := func(transactional bool, values ...ua.WriteValue) ([]ua.StatusCode, error) {
+		req := &ua.WriteRequest{NodesToWrite: values}
+		if transactional {
+			req.AdditionalHeader = ua.AdditionalParametersType{
+				Parameters: []ua.KeyValuePair{{Key: ua.QualifiedName{Name: ua.AdditionalParameterTransactional}, Value: true}},
+			}
+		}
+		res, err := ch.Write(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return res.Results, nil
+	}
+	read := func() (ua.Variant, ua.Variant, error) {
+		res, err := ch.Read(ctx, &ua.ReadRequest{
+			NodesToRead: []ua.ReadValueID{
+				{NodeID: int64ID, AttributeID: ua.AttributeIDValue},
+				{NodeID: uint64ID, AttributeID: ua.AttributeIDValue},
+			},
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return res.Results[0].Value, res.Results[1].Value, nil
+	}
+	if _, err := write(false,
+		ua.WriteValue{NodeID: int64ID, AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(int64(1), 0, time.Time{}, 0, time.Time{}, 0)},
+		ua.WriteValue{NodeID: uint64ID, AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(uint64(2), 0, time.Time{}, 0, time.Time{}, 0)},
+	); err != nil {
+		t.Error(errors.Wrap(err, "Error writing"))
+		return
+	}
+
+	// an invalid value rolls back the valid ones.
+	results, err := write(true,
+		ua.WriteValue{NodeID: int64ID, AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(int64(10), 0, time.Time{}, 0, time.Time{}, 0)},
+		ua.WriteValue{NodeID: uint64ID, AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(uint64(20), 0, time.Time{}, 0, time.Time{}, 0)},
+		ua.WriteValue{NodeID: int64ID, AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue("invalid", 0, time.Time{}, 0, time.Time{}, 0)},
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error writing"))
+		return
+	}
+	want := []ua.StatusCode{ua.BadOperationAbandoned, ua.BadOperationAbandoned, ua.BadTypeMismatch}
+	for i := range want {
+		if results[i] != want[i] {
+			t.Errorf("Error writing transactionally. want: %s, got: %s", want[i], results[i])
+		}
+	}
+	v1, v2, err := read()
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading"))
+		return
+	}
+	if v1 != int64(1) || v2 != uint64(2) {
+		t.Errorf("Error writing transactionally. want: 1, 2, got: %v, %v", v1, v2)
+	}
+
+	// valid values are all applied.
+	results, err = write(true,
+		ua.WriteValue{NodeID: int64ID, AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(int64(10), 0, time.Time{}, 0, time.Time{}, 0)},
+		ua.WriteValue{NodeID: uint64ID, AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(uint64(20), 0, time.Time{}, 0, time.Time{}, 0)},
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error writing"))
+		return
+	}
+	for _, result := range results {
+		if result != ua.Good {
+			t.Errorf("Error writing transactionally. want: Good, got: %s", result)
+		}
+	}
+	v1, v2, err = read()
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading"))
+		return
+	}
+	if v1 != int64(10) || v2 != uint64(20) {
+		t.Errorf("Error writing transactionally. want: 10, 20, got: %v, %v", v1, v2)
+	}
+}
+
+// TestWriteTransactionalRollback tests that a transactional write restores the values written before
+// a write failed, without notifying the value-changed handlers again, and returns diagnostics.
+func TestWriteTransactionalRollback(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	newNode := func(name string) *server.VariableNode {
+		return server.NewVariableNode(
+			ua.NewNodeIDString(2, "Test."+name),
+			ua.NewQualifiedName(2, name),
+			ua.NewLocalizedText(name, ""),
+			ua.NewLocalizedText("", ""),
+			nil,
+			[]ua.Reference{
+				{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+			},
+			ua.NewDataValue(1.0, 0, time.Now(), 0, time.Now(), 0),
+			ua.DataTypeIDDouble,
+			ua.ValueRankScalar,
+			[]uint32{},
+			ua.AccessLevelsCurrentRead|ua.AccessLevelsCurrentWrite,
+			0,
+			false,
+			nil,
+		)
+	}
+	node := newNode("Rollback")
+	var changes int32
+	node.AddValueChangedHandler(func(oldValue, newValue ua.DataValue) {
+		atomic.AddInt32(&changes, 1)
+	})
+	device := newNode("RollbackDevice")
+	device.SetWriteValueErrorHandler(func(ctx context.Context, req ua.WriteValue) (ua.DataValue, error) {
+		return ua.DataValue{}, fmt.Errorf("device busy")
+	})
+	if err := nm.AddNodes(node, device); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding nodes"))
+	}
+	defer nm.DeleteNodes([]server.Node{node, device}, false)
+
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+		client.WithDiagnosticsHint(ua.DiagnosticsOperationAdditionalInfo),
+	)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening client"))
+	}
+	defer ch.Close(ctx)
+	res, err := ch.Write(ctx, &ua.WriteRequest{
+		RequestHeader: ua.RequestHeader{
+			AdditionalHeader: ua.AdditionalParametersType{
+				Parameters: []ua.KeyValuePair{{Key: ua.QualifiedName{Name: ua.AdditionalParameterTransactional}, Value: true}},
+			},
+		},
+		NodesToWrite: []ua.WriteValue{
+			{NodeID: node.NodeID(), AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(2.0, 0, time.Time{}, 0, time.Time{}, 0)},
+			{NodeID: device.NodeID(), AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(2.0, 0, time.Time{}, 0, time.Time{}, 0)},
+		},
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error writing"))
+	}
+	if res.Results[0] != ua.BadOperationAbandoned || res.Results[1] != ua.BadInternalError {
+		t.Errorf("Error writing transactionally. want: [%s %s], got: %v", ua.BadOperationAbandoned, ua.BadInternalError, res.Results)
+	}
+	if len(res.DiagnosticInfos) != 2 || res.DiagnosticInfos[1].AdditionalInfo == nil || *res.DiagnosticInfos[1].AdditionalInfo != "device busy" {
+		t.Errorf("Error writing diagnostics. got: %+v", res.DiagnosticInfos)
+	}
+	if v := node.Value().Value; v != 1.0 {
+		t.Errorf("Error rolling back. want: %v, got: %v", 1.0, v)
+	}
+	// the handler observed the write, but not the rollback.
+	if got := atomic.LoadInt32(&changes); got != 1 {
+		t.Errorf("Error rolling back. want: 1 value change, got: %d", got)
+	}
+}
+
+// TestGetReferences tests resolving the targets of the references of a node.
+func TestGetReferences(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	if _, err := testServer.GetReferences(ua.ParseNodeID("ns=2;s=Test.Unknown")); err != ua.BadNodeIDUnknown {
+		t.Errorf("Error getting references. want: %s, got: %v", ua.BadNodeIDUnknown, err)
+	}
+	external := ua.ExpandedNodeID{ServerIndex: 1, NodeID: ua.ParseNodeID("ns=1;s=Remote")}
+	node := server.NewObjectNode(
+		ua.ParseNodeID("ns=2;s=Test.References"),
+		ua.NewQualifiedName(2, "References"),
+		ua.NewLocalizedText("References", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.ObjectTypeIDBaseObjectType)},
+			{ReferenceTypeID: ua.ReferenceTypeIDOrganizes, IsInverse: true, TargetID: ua.NewExpandedNodeID(ua.ObjectIDObjectsFolder)},
+			{ReferenceTypeID: ua.ReferenceTypeIDOrganizes, TargetID: external},
+		},
+		0,
+	)
+	nm := testServer.NamespaceManager()
+	if err := nm.AddNode(node); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(node, false)
+	refs, err := testServer.GetReferences(node.NodeID())
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error getting references"))
+	}
+	if len(refs) != 3 {
+		t.Fatalf("Error getting references. want: 3, got: %d", len(refs))
+	}
+	if refs[0].BrowseName.Name != "BaseObjectType" || refs[0].NodeClass != ua.NodeClassObjectType {
+		t.Errorf("Error resolving type definition. got: %s, %d", refs[0].BrowseName, refs[0].NodeClass)
+	}
+	if !refs[1].IsInverse || refs[1].DisplayName.Text != "Objects" || refs[1].NodeClass != ua.NodeClassObject {
+		t.Errorf("Error resolving parent. got: %s, %d", refs[1].DisplayName, refs[1].NodeClass)
+	}
+	if refs[2].TargetID != external || refs[2].BrowseName.Name != "" || refs[2].NodeClass != 0 {
+		t.Errorf("Error resolving external reference. got: %s, %s, %d", refs[2].TargetID, refs[2].BrowseName, refs[2].NodeClass)
+	}
+}
+
+// setpointCondition is a condition with a custom property.
+type setpointCondition struct {
+	ua.Condition
+	Setpoint float64
+}
+
+var (
+	setpointConditionTypeID       = ua.ParseNodeID("ns=2;s=Test.SetpointConditionType")
+	setpointConditionSelectClause = ua.SimpleAttributeOperand{TypeDefinitionID: setpointConditionTypeID, BrowsePath: ua.ParseBrowsePath("2:Setpoint"), AttributeID: ua.AttributeIDValue}
+)
+
+func (e *setpointCondition) GetAttribute(clause ua.SimpleAttributeOperand) ua.Variant {
+	if ua.EqualSimpleAttributeOperand(clause, setpointConditionSelectClause) {
+		return e.Setpoint
+	}
+	return e.Condition.GetAttribute(clause)
+}
+
+// TestEventSelectClauses tests resolving the browse paths of the select clauses of an EventFilter.
+func TestEventSelectClauses(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	setpointID := ua.ParseNodeID("ns=2;s=Test.SetpointConditionType.Setpoint")
+	typeNode := server.NewObjectTypeNode(
+		setpointConditionTypeID,
+		ua.NewQualifiedName(2, "SetpointConditionType"),
+		ua.NewLocalizedText("SetpointConditionType", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasSubtype, IsInverse: true, TargetID: ua.NewExpandedNodeID(ua.ObjectTypeIDConditionType)},
+			{ReferenceTypeID: ua.ReferenceTypeIDHasProperty, TargetID: ua.NewExpandedNodeID(setpointID)},
+		},
+		false,
+	)
+	propertyNode := server.NewVariableNode(
+		setpointID,
+		ua.NewQualifiedName(2, "Setpoint"),
+		ua.NewLocalizedText("Setpoint", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDPropertyType)},
+		},
+		ua.NewDataValue(float64(0), 0, time.Now(), 0, time.Now(), 0),
+		ua.DataTypeIDDouble,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentRead,
+		0,
+		false,
+		nil,
+	)
+	if err := nm.AddNodes(typeNode, propertyNode); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding nodes"))
+	}
+	defer nm.DeleteNodes([]server.Node{typeNode, propertyNode}, false)
+
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	res, err := ch.CreateSubscription(ctx, &ua.CreateSubscriptionRequest{
+		RequestedPublishingInterval: 100.0,
+		RequestedMaxKeepAliveCount:  30,
+		RequestedLifetimeCount:      30 * 3,
+		PublishingEnabled:           true,
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating subscription"))
+		return
+	}
+	res2, err := ch.CreateMonitoredItems(ctx, &ua.CreateMonitoredItemsRequest{
+		SubscriptionID:     res.SubscriptionID,
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+		ItemsToCreate: []ua.MonitoredItemCreateRequest{
+			{
+				ItemToMonitor:  ua.ReadValueID{AttributeID: ua.AttributeIDEventNotifier, NodeID: ua.ObjectIDServer},
+				MonitoringMode: ua.MonitoringModeReporting,
+				RequestedParameters: ua.MonitoringParameters{
+					ClientHandle: 42, QueueSize: 10, DiscardOldest: true,
+					Filter: ua.EventFilter{
+						SelectClauses: []ua.SimpleAttributeOperand{
+							setpointConditionSelectClause,
+							{TypeDefinitionID: setpointConditionTypeID, BrowsePath: ua.ParseBrowsePath("Severity"), AttributeID: ua.AttributeIDValue},
+							{TypeDefinitionID: setpointConditionTypeID, BrowsePath: ua.ParseBrowsePath("ConditionName"), AttributeID: ua.AttributeIDValue},
+							{TypeDefinitionID: ua.ObjectTypeIDBaseEventType, BrowsePath: ua.ParseBrowsePath("Unknown"), AttributeID: ua.AttributeIDValue},
+							// the event is not an AlarmCondition, so the field is not selected.
+							{TypeDefinitionID: ua.ObjectTypeIDAlarmConditionType, BrowsePath: ua.ParseBrowsePath("Severity"), AttributeID: ua.AttributeIDValue},
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating item"))
+		return
+	}
+	result, ok := res2.Results[0].FilterResult.(ua.EventFilterResult)
+	if !ok {
+		t.Fatalf("Error creating item. want: EventFilterResult, got: %v", res2.Results[0].FilterResult)
+	}
+	want := []ua.StatusCode{ua.Good, ua.Good, ua.Good, ua.BadNodeIDUnknown, ua.Good}
+	for i := range want {
+		if result.SelectClauseResults[i] != want[i] {
+			t.Errorf("Error resolving select clause %d. want: %s, got: %s", i, want[i], result.SelectClauseResults[i])
+		}
+	}
+
+	srvNode, _ := nm.FindObject(ua.ObjectIDServer)
+	nm.OnEvent(srvNode, &setpointCondition{
+		Condition: ua.Condition{
+			EventID:       ua.ByteString("setpoint"),
+			EventType:     setpointConditionTypeID,
+			SourceNode:    ua.ObjectIDServer,
+			Time:          time.Now(),
+			Severity:      500,
+			ConditionName: "Overheat",
+		},
+		Setpoint: 42.0,
+	})
+	for i := 0; i < 3; i++ {
+		res3, err := ch.Publish(ctx, &ua.PublishRequest{RequestHeader: ua.RequestHeader{TimeoutHint: 60000}})
+		if err != nil {
+			t.Error(errors.Wrap(err, "Error publishing"))
+			return
+		}
+		for _, data := range res3.NotificationMessage.NotificationData {
+			if body, ok := data.(ua.EventNotificationList); ok {
+				for _, e := range body.Events {
+					if id, _ := e.EventFields[2].(string); id != "Overheat" {
+						continue
+					}
+					if e.EventFields[0] != 42.0 || e.EventFields[1] != uint16(500) || e.EventFields[3] != nil || e.EventFields[4] != nil {
+						t.Errorf("Error selecting fields. got: %v", e.EventFields)
+					}
+					return
+				}
+			}
+		}
+	}
+	t.Error("Error publishing. want: event, got: none")
+}
+
+// TestInitialValueHandler tests seeding the value of a node on first access.
+func TestInitialValueHandler(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	id := ua.ParseNodeID("ns=2;s=Test.InitialValue")
+	node := server.NewVariableNode(
+		id,
+		ua.NewQualifiedName(2, "InitialValue"),
+		ua.NewLocalizedText("InitialValue", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+		},
+		ua.DataValue{},
+		ua.DataTypeIDDouble,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentRead,
+		0,
+		false,
+		nil,
+	)
+	var calls int32
+	node.SetInitialValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(100 * time.Millisecond) // a slow device
+		return ua.GoodDataValue(42.0)
+	})
+	if err := nm.AddNode(node); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(node, false)
+
+	ctx := context.Background()
+	ch, err := client.Dial(ctx, endpointURL, client.WithInsecureSkipVerify())
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	res, err := ch.CreateSubscription(ctx, &ua.CreateSubscriptionRequest{
+		RequestedPublishingInterval: 100.0,
+		RequestedMaxKeepAliveCount:  30,
+		RequestedLifetimeCount:      30 * 3,
+		PublishingEnabled:           true,
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating subscription"))
+		return
+	}
+	// reads race the subscriber for the first access.
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := ch.Read(ctx, &ua.ReadRequest{NodesToRead: []ua.ReadValueID{{NodeID: id, AttributeID: ua.AttributeIDValue}}})
+			if err != nil {
+				t.Error(errors.Wrap(err, "Error reading"))
+				return
+			}
+			if res.Results[0].Value != 42.0 {
+				t.Errorf("Error reading. want: 42, got: %v", res.Results[0].Value)
+			}
+		}()
+	}
+	_, err = ch.CreateMonitoredItems(ctx, &ua.CreateMonitoredItemsRequest{
+		SubscriptionID:     res.SubscriptionID,
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+		ItemsToCreate: []ua.MonitoredItemCreateRequest{
+			{
+				ItemToMonitor:  ua.ReadValueID{AttributeID: ua.AttributeIDValue, NodeID: id},
+				MonitoringMode: ua.MonitoringModeReporting,
+				RequestedParameters: ua.MonitoringParameters{
+					ClientHandle: 42, QueueSize: 1, DiscardOldest: true, SamplingInterval: 100.0,
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating item"))
+		return
+	}
+	wg.Wait()
+	res2, err := ch.Publish(ctx, &ua.PublishRequest{RequestHeader: ua.RequestHeader{TimeoutHint: 60000}})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error publishing"))
+		return
+	}
+	found := false
+	for _, data := range res2.NotificationMessage.NotificationData {
+		if body, ok := data.(ua.DataChangeNotification); ok {
+			for _, z := range body.MonitoredItems {
+				found = true
+				if z.Value.Value != 42.0 {
+					t.Errorf("Error publishing initial value. want: 42, got: %v", z.Value.Value)
+				}
+			}
+		}
+	}
+	if !found {
+		t.Error("Error publishing. want: data change, got: none")
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("Error seeding value. want: 1 call, got: %d", n)
+	}
+
+	// a value set while the handler is called is not overwritten by the seed.
+	node2 := server.NewVariableNode(
+		ua.ParseNodeID("ns=2;s=Test.InitialValue2"),
+		ua.NewQualifiedName(2, "InitialValue2"),
+		ua.NewLocalizedText("InitialValue2", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+		},
+		ua.DataValue{},
+		ua.DataTypeIDDouble,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentRead,
+		0,
+		false,
+		nil,
+	)
+	node2.SetInitialValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
+		node2.SetValue(ua.GoodDataValue(7.0))
+		return ua.GoodDataValue(42.0)
+	})
+	if v := node2.Update(func(old ua.DataValue) ua.DataValue { return old }); v.Value != 7.0 {
+		t.Errorf("Error seeding value. want: 7, got: %v", v.Value)
+	}
+
+	// a write of a range is merged into the seeded value.
+	node3 := server.NewVariableNode(
+		ua.ParseNodeID("ns=2;s=Test.InitialValue3"),
+		ua.NewQualifiedName(2, "InitialValue3"),
+		ua.NewLocalizedText("InitialValue3", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+		},
+		ua.DataValue{},
+		ua.DataTypeIDInt32,
+		ua.ValueRankOneDimension,
+		[]uint32{0},
+		ua.AccessLevelsCurrentRead,
+		0,
+		false,
+		nil,
+	)
+	seeded := false
+	node3.SetInitialValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
+		if !seeded {
+			return ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Time{}, 0, time.Now(), 0)
+		}
+		return ua.GoodDataValue([]int32{1, 2, 3})
+	})
+	if status := node3.SetValueRange(ua.GoodDataValue([]int32{9}), "1"); status != ua.BadIndexRangeNoData {
+		t.Errorf("Error writing range of unseeded value. want: %s, got: %s", ua.BadIndexRangeNoData, status)
+	}
+	seeded = true
+	if status := node3.SetValueRange(ua.GoodDataValue([]int32{9}), "1"); status != ua.Good {
+		t.Errorf("Error writing range. want: %s, got: %s", ua.Good, status)
+	}
+	if v := node3.Value().Value; !reflect.DeepEqual(v, []int32{1, 9, 3}) {
+		t.Errorf("Error writing range. want: %v, got: %v", []int32{1, 9, 3}, v)
+	}
+}
+
+// TestValidate tests finding dangling references and missing type information in the address space.
+func TestValidate(t *testing.T) {
+	srv, err := server.New(
+		ua.ApplicationDescription{ApplicationName: ua.NewLocalizedText("validateserver", "")},
+		"./pki/server.crt",
+		"./pki/server.key",
+		"opc.tcp://127.0.0.1:46015",
+	)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error constructing server"))
+	}
+	if issues := srv.Validate(); len(issues) != 0 {
+		t.Errorf("Error validating standard address space. got: %v", issues)
+	}
+	objectID := ua.ParseNodeID("ns=1;s=Validate.Object")
+	variableID := ua.ParseNodeID("ns=1;s=Validate.Variable")
+	missingID := ua.ParseNodeID("ns=1;s=Validate.Missing")
+	err = srv.NamespaceManager().AddNodes(
+		server.NewObjectNode(
+			objectID,
+			ua.NewQualifiedName(1, "Object"),
+			ua.NewLocalizedText("Object", ""),
+			ua.NewLocalizedText("", ""),
+			nil,
+			[]ua.Reference{
+				{ReferenceTypeID: ua.ReferenceTypeIDHasComponent, TargetID: ua.NewExpandedNodeID(variableID)},
+				{ReferenceTypeID: ua.ReferenceTypeIDOrganizes, TargetID: ua.NewExpandedNodeID(missingID)},
+			},
+			0,
+		),
+		server.NewVariableNode(
+			variableID,
+			ua.NewQualifiedName(1, "Variable"),
+			ua.NewLocalizedText("Variable", ""),
+			ua.NewLocalizedText("", ""),
+			nil,
+			[]ua.Reference{
+				{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+			},
+			ua.DataValue{},
+			ua.ParseNodeID("ns=1;s=Validate.DataType"),
+			ua.ValueRankScalar,
+			[]uint32{},
+			ua.AccessLevelsCurrentRead,
+			0,
+			false,
+			nil,
+		),
+	)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding nodes"))
+	}
+	issues := srv.Validate()
+	want := []string{
+		"ns=1;s=Validate.Object: missing HasTypeDefinition",
+		"ns=1;s=Validate.Object: unknown target ns=1;s=Validate.Missing",
+		"ns=1;s=Validate.Variable: unknown DataType ns=1;s=Validate.DataType",
+	}
+	if len(issues) != len(want) {
+		t.Fatalf("Error validating. want: %v, got: %v", want, issues)
+	}
+	for i := range want {
+		if issues[i].String() != want[i] {
+			t.Errorf("Error validating. want: %s, got: %s", want[i], issues[i])
+		}
+	}
+}
+
+// TestActivateSessionLocale tests that activating the session again with different locales
+// changes the language of the DisplayName, and keeps the subscriptions of the session.
+func TestActivateSessionLocale(t *testing.T) {
+	url := "opc.tcp://127.0.0.1:46016"
+	translations := map[string]ua.LocalizedText{
+		"Server": ua.NewLocalizedText("Der Server", "de"),
+	}
+	srv, err := server.New(
+		ua.ApplicationDescription{ApplicationName: ua.NewLocalizedText("localeserver", "")},
+		"./pki/server.crt",
+		"./pki/server.key",
+		url,
+		server.WithTranslator(func(text ua.LocalizedText, localeIDs []string) ua.LocalizedText {
+			if localeIDs[0] == "de" {
+				if t, ok := translations[text.Text]; ok {
+					return t
+				}
+			}
+			return text
+		}),
+		server.WithAnonymousIdentity(true),
+		server.WithSecurityPolicyNone(true),
+		server.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error constructing server"))
+		return
+	}
+	defer srv.Close()
+	go srv.ListenAndServe()
+	time.Sleep(500 * time.Millisecond)
+
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		url,
+		client.WithSecurityPolicyURI(ua.SecurityPolicyURINone),
+		client.WithLocaleIDs("en"),
+		client.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	res, err := ch.CreateSubscription(ctx, &ua.CreateSubscriptionRequest{
+		RequestedPublishingInterval: 250.0,
+		RequestedMaxKeepAliveCount:  30,
+		RequestedLifetimeCount:      30 * 3,
+		PublishingEnabled:           true,
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating subscription"))
+		return
+	}
+	readDisplayName := func() (string, error) {
+		res, err := ch.Read(ctx, &ua.ReadRequest{
+			NodesToRead: []ua.ReadValueID{
+				{NodeID: ua.ObjectIDServer, AttributeID: ua.AttributeIDDisplayName},
+			},
+		})
+		if err != nil {
+			return "", err
+		}
+		return res.Results[0].Value.(ua.LocalizedText).Text, nil
+	}
+	name, err := readDisplayName()
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading"))
+		return
+	}
+	if name != "Server" {
+		t.Errorf("Error reading DisplayName. want: %s, got: %s", "Server", name)
+	}
+	_, err = ch.ActivateSession(ctx, &ua.ActivateSessionRequest{
+		LocaleIDs:         []string{"de"},
+		UserIdentityToken: ua.AnonymousIdentityToken{PolicyID: ua.UserTokenTypeAnonymous.String()},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error activating session"))
+		return
+	}
+	name, err = readDisplayName()
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading"))
+		return
+	}
+	if name != "Der Server" {
+		t.Errorf("Error reading DisplayName. want: %s, got: %s", "Der Server", name)
+	}
+	res2, err := ch.ModifySubscription(ctx, &ua.ModifySubscriptionRequest{
+		SubscriptionID:              res.SubscriptionID,
+		RequestedPublishingInterval: 500.0,
+		RequestedMaxKeepAliveCount:  30,
+		RequestedLifetimeCount:      30 * 3,
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error modifying subscription after activating session"))
+		return
+	}
+	if res2.RevisedPublishingInterval != 500.0 {
+		t.Errorf("Error modifying subscription. want: %v, got: %v", 500.0, res2.RevisedPublishingInterval)
+	}
+}
+
+// TestSetTriggering tests that an item in sampling mode reports only when its triggering item reports.
+func TestSetTriggering(t *testing.T) {
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	triggerID := ua.ParseNodeID("ns=2;s=Demo.Static.Scalar.UInt32")
+	res, err := ch.CreateSubscription(ctx, &ua.CreateSubscriptionRequest{
+		RequestedPublishingInterval: 100.0,
+		RequestedMaxKeepAliveCount:  10,
+		RequestedLifetimeCount:      10 * 3,
+		PublishingEnabled:           true,
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating subscription"))
+		return
+	}
+	res2, err := ch.CreateMonitoredItems(ctx, &ua.CreateMonitoredItemsRequest{
+		SubscriptionID:     res.SubscriptionID,
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+		ItemsToCreate: []ua.MonitoredItemCreateRequest{
+			{
+				ItemToMonitor:  ua.ReadValueID{AttributeID: ua.AttributeIDValue, NodeID: triggerID},
+				MonitoringMode: ua.MonitoringModeReporting,
+				RequestedParameters: ua.MonitoringParameters{
+					ClientHandle: 1, QueueSize: 1, DiscardOldest: true, SamplingInterval: 100.0,
+				},
+			},
+			{
+				ItemToMonitor:  ua.ReadValueID{AttributeID: ua.AttributeIDValue, NodeID: ua.VariableIDServerServerStatusCurrentTime},
+				MonitoringMode: ua.MonitoringModeSampling,
+				RequestedParameters: ua.MonitoringParameters{
+					ClientHandle: 2, QueueSize: 1, DiscardOldest: true, SamplingInterval: 100.0,
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating items"))
+		return
+	}
+	res3, err := ch.SetTriggering(ctx, &ua.SetTriggeringRequest{
+		SubscriptionID:   res.SubscriptionID,
+		TriggeringItemID: res2.Results[0].MonitoredItemID,
+		LinksToAdd:       []uint32{res2.Results[1].MonitoredItemID, res2.Results[1].MonitoredItemID},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error setting triggering"))
+		return
+	}
+	for _, result := range res3.AddResults {
+		if result != ua.Good {
+			t.Errorf("Error adding link. want: %s, got: %s", ua.Good, result)
+		}
+	}
+	// publish returns the handles reported in the next notification message.
+	var acks []ua.SubscriptionAcknowledgement
+	publish := func() (map[uint32]int, error) {
+		res, err := ch.Publish(ctx, &ua.PublishRequest{
+			RequestHeader:                ua.RequestHeader{TimeoutHint: 60000},
+			SubscriptionAcknowledgements: acks,
+		})
+		if err != nil {
+			return nil, err
+		}
+		acks = []ua.SubscriptionAcknowledgement{}
+		if len(res.NotificationMessage.NotificationData) > 0 {
+			acks = append(acks, ua.SubscriptionAcknowledgement{SequenceNumber: res.NotificationMessage.SequenceNumber, SubscriptionID: res.SubscriptionID})
+		}
+		handles := map[uint32]int{}
+		for _, data := range res.NotificationMessage.NotificationData {
+			if body, ok := data.(ua.DataChangeNotification); ok {
+				for _, z := range body.MonitoredItems {
+					handles[z.ClientHandle]++
+				}
+			}
+		}
+		return handles, nil
+	}
+	// the initial value of the triggering item releases the triggered item.
+	handles, err := publish()
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error publishing"))
+		return
+	}
+	if handles[1] != 1 || handles[2] != 1 {
+		t.Errorf("Error publishing initial values. want: map[1:1 2:1], got: %v", handles)
+	}
+	// without a change of the triggering item, the server sends a keep-alive message.
+	handles, err = publish()
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error publishing"))
+		return
+	}
+	if len(handles) != 0 {
+		t.Errorf("Error publishing keep-alive. want: map[], got: %v", handles)
+	}
+	// a change of the triggering item releases the triggered item again.
+	_, err = ch.Write(ctx, &ua.WriteRequest{
+		NodesToWrite: []ua.WriteValue{{
+			NodeID:      triggerID,
+			AttributeID: ua.AttributeIDValue,
+			Value:       ua.NewDataValue(uint32(time.Now().Unix()), 0, time.Time{}, 0, time.Time{}, 0),
+		}},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error writing"))
+		return
+	}
+	handles, err = publish()
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error publishing"))
+		return
+	}
+	if handles[1] != 1 || handles[2] != 1 {
+		t.Errorf("Error publishing triggered values. want: map[1:1 2:1], got: %v", handles)
+	}
+	// deleting the triggered item removes the link.
+	var trigger, triggered server.MonitoredItem
+	if testServer != nil {
+		if sub, ok := testServer.SubscriptionManager().Get(res.SubscriptionID); ok {
+			trigger, _ = sub.FindItem(res2.Results[0].MonitoredItemID)
+			triggered, _ = sub.FindItem(res2.Results[1].MonitoredItemID)
+		}
+	}
+	_, err = ch.DeleteMonitoredItems(ctx, &ua.DeleteMonitoredItemsRequest{
+		SubscriptionID:   res.SubscriptionID,
+		MonitoredItemIDs: []uint32{res2.Results[1].MonitoredItemID},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error deleting item"))
+		return
+	}
+	if trigger != nil && triggered != nil && trigger.RemoveTriggeredItem(triggered) {
+		t.Error("Error deleting item. want: link removed, got: link to the deleted item")
+	}
+	res4, err := ch.SetTriggering(ctx, &ua.SetTriggeringRequest{
+		SubscriptionID:   res.SubscriptionID,
+		TriggeringItemID: res2.Results[0].MonitoredItemID,
+		LinksToRemove:    []uint32{res2.Results[1].MonitoredItemID},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error setting triggering"))
+		return
+	}
+	if res4.RemoveResults[0] != ua.BadMonitoredItemIDInvalid {
+		t.Errorf("Error removing link. want: %s, got: %s", ua.BadMonitoredItemIDInvalid, res4.RemoveResults[0])
+	}
+}
+
+// TestHandlerErrorDiagnostics tests that the text of an error returned by a handler is returned as diagnostics.
+func TestHandlerErrorDiagnostics(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	id := ua.ParseNodeID("ns=2;s=Test.HandlerError")
+	node := server.NewVariableNode(
+		id,
+		ua.NewQualifiedName(2, "HandlerError"),
+		ua.NewLocalizedText("HandlerError", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+		},
+		ua.DataValue{},
+		ua.DataTypeIDDouble,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentRead|ua.AccessLevelsCurrentWrite,
+		0,
+		false,
+		nil,
+	)
+	node.SetReadValueErrorHandler(func(ctx context.Context, req ua.ReadValueID) (ua.DataValue, error) {
+		return ua.DataValue{}, fmt.Errorf("device offline")
+	})
+	node.SetWriteValueErrorHandler(func(ctx context.Context, req ua.WriteValue) (ua.DataValue, error) {
+		if v, ok := req.Value.Value.(float64); ok && v < 0 {
+			return ua.DataValue{}, ua.BadOutOfRange
+		}
+		return ua.DataValue{}, fmt.Errorf("device busy")
+	})
+	if err := nm.AddNode(node); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(node, false)
+
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+		client.WithDiagnosticsHint(ua.DiagnosticsOperationLocalizedText|ua.DiagnosticsOperationAdditionalInfo),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	res, err := ch.Read(ctx, &ua.ReadRequest{
+		NodesToRead: []ua.ReadValueID{
+			{NodeID: ua.VariableIDServerServerStatusState, AttributeID: ua.AttributeIDValue},
+			{NodeID: id, AttributeID: ua.AttributeIDValue},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading"))
+		return
+	}
+	if res.Results[1].StatusCode != ua.BadInternalError {
+		t.Errorf("Error reading. want: %s, got: %s", ua.BadInternalError, res.Results[1].StatusCode)
+	}
+	if len(res.DiagnosticInfos) != 2 || res.DiagnosticInfos[1].AdditionalInfo == nil || res.DiagnosticInfos[0].AdditionalInfo != nil {
+		t.Fatalf("Error reading diagnostics. got: %+v", res.DiagnosticInfos)
+	}
+	if s := *res.DiagnosticInfos[1].AdditionalInfo; s != "device offline" {
+		t.Errorf("Error reading AdditionalInfo. want: %s, got: %s", "device offline", s)
+	}
+	if i := res.DiagnosticInfos[1].LocalizedText; i == nil || res.StringTable[*i] != "device offline" {
+		t.Errorf("Error reading LocalizedText. want: %s, got: %v", "device offline", res.StringTable)
+	}
+	res2, err := ch.Write(ctx, &ua.WriteRequest{
+		NodesToWrite: []ua.WriteValue{
+			{NodeID: id, AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(-1.0, 0, time.Time{}, 0, time.Time{}, 0)},
+			{NodeID: id, AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(1.0, 0, time.Time{}, 0, time.Time{}, 0)},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error writing"))
+		return
+	}
+	if res2.Results[0] != ua.BadOutOfRange || res2.Results[1] != ua.BadInternalError {
+		t.Errorf("Error writing. want: [%s %s], got: %v", ua.BadOutOfRange, ua.BadInternalError, res2.Results)
+	}
+	if len(res2.DiagnosticInfos) != 2 || res2.DiagnosticInfos[1].AdditionalInfo == nil || *res2.DiagnosticInfos[1].AdditionalInfo != "device busy" {
+		t.Errorf("Error writing diagnostics. got: %+v", res2.DiagnosticInfos)
+	}
+}
+
+// TestServiceLevel tests that subscribed clients see changes of the ServiceLevel.
+func TestServiceLevel(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	defer testServer.SetServiceLevel(255)
+	ctx := context.Background()
+	ch, err := client.Dial(ctx, endpointURL, client.WithInsecureSkipVerify())
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	res, err := ch.CreateSubscription(ctx, &ua.CreateSubscriptionRequest{
+		RequestedPublishingInterval: 100.0,
+		RequestedMaxKeepAliveCount:  30,
+		RequestedLifetimeCount:      30 * 3,
+		PublishingEnabled:           true,
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating subscription"))
+		return
+	}
+	_, err = ch.CreateMonitoredItems(ctx, &ua.CreateMonitoredItemsRequest{
+		SubscriptionID:     res.SubscriptionID,
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+		ItemsToCreate: []ua.MonitoredItemCreateRequest{
+			{
+				ItemToMonitor:  ua.ReadValueID{AttributeID: ua.AttributeIDValue, NodeID: ua.VariableIDServerServiceLevel},
+				MonitoringMode: ua.MonitoringModeReporting,
+				RequestedParameters: ua.MonitoringParameters{
+					ClientHandle: 42, QueueSize: 1, DiscardOldest: true, SamplingInterval: 100.0,
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating item"))
+		return
+	}
+	// next returns the next ServiceLevel reported to the client.
+	var acks []ua.SubscriptionAcknowledgement
+	next := func() (byte, error) {
+		for {
+			res, err := ch.Publish(ctx, &ua.PublishRequest{
+				RequestHeader:                ua.RequestHeader{TimeoutHint: 60000},
+				SubscriptionAcknowledgements: acks,
+			})
+			if err != nil {
+				return 0, err
+			}
+			acks = []ua.SubscriptionAcknowledgement{{SequenceNumber: res.NotificationMessage.SequenceNumber, SubscriptionID: res.SubscriptionID}}
+			for _, data := range res.NotificationMessage.NotificationData {
+				if body, ok := data.(ua.DataChangeNotification); ok {
+					for _, z := range body.MonitoredItems {
+						if z.ClientHandle == 42 {
+							return z.Value.Value.(byte), nil
+						}
+					}
+				}
+			}
+		}
+	}
+	level, err := next()
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error publishing"))
+		return
+	}
+	if level != 255 {
+		t.Errorf("Error reading ServiceLevel. want: %d, got: %d", 255, level)
+	}
+	testServer.SetServiceLevel(100)
+	level, err = next()
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error publishing"))
+		return
+	}
+	if level != 100 || testServer.ServiceLevel() != 100 {
+		t.Errorf("Error changing ServiceLevel. want: %d, got: %d", 100, level)
+	}
+}
+
+// TestEncodingLimits tests that a request with an array longer than MaxArrayLength is rejected,
+// and the channel remains open.
+func TestEncodingLimits(t *testing.T) {
+	url := "opc.tcp://127.0.0.1:46017"
+	caps := ua.NewServerCapabilities()
+	caps.MaxArrayLength = 10
+	srv, err := server.New(
+		ua.ApplicationDescription{ApplicationName: ua.NewLocalizedText("limitsserver", "")},
+		"./pki/server.crt",
+		"./pki/server.key",
+		url,
+		server.WithServerCapabilities(caps),
+		server.WithAnonymousIdentity(true),
+		server.WithSecurityPolicyNone(true),
+		server.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error constructing server"))
+		return
+	}
+	defer srv.Close()
+	go srv.ListenAndServe()
+	time.Sleep(500 * time.Millisecond)
+
+	ctx := context.Background()
+	ch, err := client.Dial(ctx, url, client.WithInsecureSkipVerify())
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Abort(ctx)
+	nodes := make([]ua.ReadValueID, 11)
+	for i := range nodes {
+		nodes[i] = ua.ReadValueID{NodeID: ua.VariableIDServerServerStatusState, AttributeID: ua.AttributeIDValue}
+	}
+	_, err = ch.Read(ctx, &ua.ReadRequest{NodesToRead: nodes[:10]})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading"))
+		return
+	}
+	_, err = ch.Read(ctx, &ua.ReadRequest{NodesToRead: nodes})
+	if err != ua.BadEncodingLimitsExceeded {
+		t.Errorf("Error reading. want: %s, got: %v", ua.BadEncodingLimitsExceeded, err)
+	}
+	// the channel remains open.
+	_, err = ch.Read(ctx, &ua.ReadRequest{NodesToRead: nodes[:10]})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading after the limit was exceeded"))
+	}
+}
+
+// TestAddProperty tests that a property added to a variable is browsable and readable.
+func TestAddProperty(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	id := ua.ParseNodeID("ns=2;s=Test.Level")
+	node := server.NewVariableNode(
+		id,
+		ua.NewQualifiedName(2, "Level"),
+		ua.NewLocalizedText("Level", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+		},
+		ua.NewDataValue(42.0, 0, time.Now(), 0, time.Now(), 0),
+		ua.DataTypeIDDouble,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentRead,
+		0,
+		false,
+		nil,
+	)
+	if err := nm.AddNode(node); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(node, true)
+	euRange, err := nm.AddProperty(node, ua.NewQualifiedName(0, "EURange"), ua.DataTypeIDRange, ua.NewDataValue(ua.Range{Low: 0, High: 100}, 0, time.Now(), 0, time.Now(), 0))
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding property"))
+	}
+	if euRange.NodeID() != ua.ParseNodeID("ns=2;s=Test.Level.EURange") {
+		t.Errorf("Error adding property. want: %s, got: %s", "ns=2;s=Test.Level.EURange", euRange.NodeID())
+	}
+	if _, err = nm.AddProperty(node, ua.NewQualifiedName(0, "EURange"), ua.DataTypeIDRange, ua.DataValue{}); err != ua.BadNodeIDExists {
+		t.Errorf("Error adding property twice. want: %s, got: %v", ua.BadNodeIDExists, err)
+	}
+	if p, ok := nm.FindProperty(node, ua.NewQualifiedName(0, "EURange")); !ok || p != euRange {
+		t.Errorf("Error finding property.")
+	}
+
+	ctx := context.Background()
+	ch, err := client.Dial(ctx, endpointURL, client.WithInsecureSkipVerify())
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	res, err := ch.Browse(ctx, &ua.BrowseRequest{
+		NodesToBrowse: []ua.BrowseDescription{{
+			NodeID:          id,
+			BrowseDirection: ua.BrowseDirectionForward,
+			ReferenceTypeID: ua.ReferenceTypeIDHasProperty,
+			IncludeSubtypes: true,
+			ResultMask:      uint32(ua.BrowseResultMaskAll),
+		}},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error browsing"))
+		return
+	}
+	if refs := res.Results[0].References; len(refs) != 1 || refs[0].BrowseName.Name != "EURange" {
+		t.Errorf("Error browsing properties. got: %v", refs)
+	}
+	res2, err := ch.Read(ctx, &ua.ReadRequest{
+		NodesToRead: []ua.ReadValueID{{NodeID: euRange.NodeID(), AttributeID: ua.AttributeIDValue}},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading"))
+		return
+	}
+	if v, ok := res2.Results[0].Value.(ua.Range); !ok || v.High != 100 {
+		t.Errorf("Error reading property. want: %v, got: %v", ua.Range{Low: 0, High: 100}, res2.Results[0].Value)
+	}
+}
+
+// TestDataTypeDefinition tests reading the DataTypeDefinition of standard and custom DataTypes.
+func TestDataTypeDefinition(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	id := ua.ParseNodeID("ns=2;s=Test.Setpoint")
+	definition := ua.StructureDefinition{
+		DefaultEncodingID: ua.ParseNodeID("ns=2;s=Test.Setpoint.DefaultBinary"),
+		BaseDataType:      ua.DataTypeIDStructure,
+		StructureType:     ua.StructureTypeStructure,
+		Fields: []ua.StructureField{
+			{Name: "Value", DataType: ua.DataTypeIDDouble, ValueRank: ua.ValueRankScalar},
+			{Name: "Unit", DataType: ua.DataTypeIDString, ValueRank: ua.ValueRankScalar},
+		},
+	}
+	node := server.NewDataTypeNode(
+		id,
+		ua.NewQualifiedName(2, "Setpoint"),
+		ua.NewLocalizedText("Setpoint", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasSubtype, IsInverse: true, TargetID: ua.NewExpandedNodeID(ua.DataTypeIDStructure)},
+		},
+		false,
+		nil,
+	)
+	node.SetDataTypeDefinition(definition)
+	if err := nm.AddNode(node); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(node, false)
+	// values of the DataType are encoded using the registered definition.
+	dataTypeID := ua.ToExpandedNodeID(id, nm.NamespaceUris())
+	value := ua.Structure{DataTypeID: dataTypeID, Fields: []ua.Variant{21.5, "degC"}}
+	variableID := ua.ParseNodeID("ns=2;s=Test.SetpointValue")
+	variable := server.NewVariableNode(
+		variableID,
+		ua.NewQualifiedName(2, "SetpointValue"),
+		ua.NewLocalizedText("SetpointValue", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+		},
+		ua.NewDataValue(value, 0, time.Now(), 0, time.Now(), 0),
+		id,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentRead|ua.AccessLevelsCurrentWrite,
+		250,
+		false,
+		nil,
+	)
+	if err := nm.AddNode(variable); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(variable, false)
+
+	ctx := context.Background()
+	ch, err := client.Dial(ctx, endpointURL, client.WithInsecureSkipVerify(), client.WithUserNameIdentity("root", "secret"))
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	res3, err := ch.Read(ctx, &ua.ReadRequest{
+		NodesToRead: []ua.ReadValueID{{NodeID: variableID, AttributeID: ua.AttributeIDValue}},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading"))
+		return
+	}
+	if !reflect.DeepEqual(res3.Results[0].Value, value) {
+		t.Errorf("Error reading structure value. want: %v, got: %v", value, res3.Results[0].Value)
+	}
+	value2 := ua.Structure{DataTypeID: dataTypeID, Fields: []ua.Variant{19.0, "degC"}}
+	res4, err := ch.Write(ctx, &ua.WriteRequest{
+		NodesToWrite: []ua.WriteValue{{NodeID: variableID, AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(value2, 0, time.Time{}, 0, time.Time{}, 0)}},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error writing"))
+		return
+	}
+	if res4.Results[0] != ua.Good || !reflect.DeepEqual(variable.Value().Value, value2) {
+		t.Errorf("Error writing structure value. want: %v, got: %s, %v", value2, res4.Results[0], variable.Value().Value)
+	}
+
+	res, err := ch.Read(ctx, &ua.ReadRequest{
+		NodesToRead: []ua.ReadValueID{
+			{NodeID: ua.DataTypeIDRange, AttributeID: ua.AttributeIDDataTypeDefinition},
+			{NodeID: ua.DataTypeIDServerState, AttributeID: ua.AttributeIDDataTypeDefinition},
+			{NodeID: id, AttributeID: ua.AttributeIDDataTypeDefinition},
+			{NodeID: ua.DataTypeIDDouble, AttributeID: ua.AttributeIDDataTypeDefinition},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading"))
+		return
+	}
+	if def, ok := res.Results[0].Value.(ua.StructureDefinition); !ok || def.DefaultEncodingID != ua.ObjectIDRangeEncodingDefaultBinary || def.BaseDataType != ua.DataTypeIDStructure ||
+		len(def.Fields) != 2 || def.Fields[0].Name != "Low" || def.Fields[0].DataType != ua.DataTypeIDDouble || def.Fields[0].ValueRank != ua.ValueRankScalar {
+		t.Errorf("Error reading Range definition. got: %+v", res.Results[0].Value)
+	}
+	if def, ok := res.Results[1].Value.(ua.EnumDefinition); !ok || len(def.Fields) == 0 || def.Fields[0].Name != "Running" || def.Fields[0].Value != 0 {
+		t.Errorf("Error reading ServerState definition. got: %+v", res.Results[1].Value)
+	}
+	if def, ok := res.Results[2].Value.(ua.StructureDefinition); !ok || !reflect.DeepEqual(def.Fields, definition.Fields) {
+		t.Errorf("Error reading custom definition. want: %+v, got: %+v", definition, res.Results[2].Value)
+	}
+	if res.Results[3].StatusCode != ua.BadAttributeIDInvalid {
+		t.Errorf("Error reading Double definition. want: %s, got: %s", ua.BadAttributeIDInvalid, res.Results[3].StatusCode)
+	}
+}
+
+// importNodeSet is a nodeset whose nodes refer to nodes that appear later in the nodeset.
+const importNodeSet = `<?xml version="1.0" encoding="utf-8"?>
+<UANodeSet xmlns="http://opcfoundation.org/UA/2011/03/UANodeSet.xsd">
+  <NamespaceUris>
+    <Uri>http://github.com/awcullen/opcua/importtest/</Uri>
+  </NamespaceUris>
+  <Aliases>
+    <Alias Alias="Organizes">i=35</Alias>
+    <Alias Alias="HasSubtype">i=45</Alias>
+    <Alias Alias="HasEncoding">i=38</Alias>
+    <Alias Alias="HasTypeDefinition">i=40</Alias>
+    <Alias Alias="Mode">ns=1;s=Import.Mode</Alias>
+  </Aliases>
+  <UAVariable NodeId="ns=1;s=Import.Folder.Mode" BrowseName="1:Mode" DataType="Mode" AccessLevel="3">
+    <DisplayName>Mode</DisplayName>
+    <References>
+      <Reference ReferenceType="HasTypeDefinition">i=63</Reference>
+      <Reference ReferenceType="Organizes" IsForward="false">ns=1;s=Import.Folder</Reference>
+    </References>
+    <Value>
+      <Int32 xmlns="http://opcfoundation.org/UA/2008/02/Types.xsd">2</Int32>
+    </Value>
+  </UAVariable>
+  <UADataType NodeId="ns=1;s=Import.Mode" BrowseName="1:Mode">
+    <DisplayName>Mode</DisplayName>
+    <References>
+      <Reference ReferenceType="HasSubtype" IsForward="false">i=29</Reference>
+    </References>
+    <Definition Name="1:Mode">
+      <Field Name="Off" Value="0" />
+      <Field Name="Manual" Value="1" />
+      <Field Name="Auto" Value="2" />
+    </Definition>
+  </UADataType>
+  <UADataType NodeId="ns=1;s=Import.Point" BrowseName="1:Point">
+    <DisplayName>Point</DisplayName>
+    <References>
+      <Reference ReferenceType="HasEncoding">ns=1;s=Import.Point.DefaultBinary</Reference>
+      <Reference ReferenceType="HasSubtype" IsForward="false">ns=1;s=Import.BasePoint</Reference>
+    </References>
+    <Definition Name="1:Point">
+      <Field Name="X" DataType="i=11" />
+      <Field Name="Y" DataType="i=11" />
+    </Definition>
+  </UADataType>
+  <UADataType NodeId="ns=1;s=Import.BasePoint" BrowseName="1:BasePoint" IsAbstract="true">
+    <DisplayName>BasePoint</DisplayName>
+    <References>
+      <Reference ReferenceType="HasSubtype" IsForward="false">i=22</Reference>
+    </References>
+  </UADataType>
+  <UAObject NodeId="ns=1;s=Import.Point.DefaultBinary" BrowseName="Default Binary">
+    <DisplayName>Default Binary</DisplayName>
+    <References>
+      <Reference ReferenceType="HasTypeDefinition">i=76</Reference>
+    </References>
+  </UAObject>
+  <UAObject NodeId="ns=1;s=Import.Folder" BrowseName="1:Folder">
+    <DisplayName>Folder</DisplayName>
+    <References>
+      <Reference ReferenceType="HasTypeDefinition">i=61</Reference>
+      <Reference ReferenceType="Organizes" IsForward="false">i=85</Reference>
+    </References>
+  </UAObject>
+</UANodeSet>`
+
+// TestImportNodeSet2 tests importing a nodeset whose nodes refer to nodes that appear later.
+func TestImportNodeSet2(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	nodes, err := nm.ImportNodeSet2(strings.NewReader(importNodeSet))
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error importing nodeset"))
+	}
+	if len(nodes) != 6 {
+		t.Fatalf("Error importing nodeset. want: 6 nodes, got: %d", len(nodes))
+	}
+	ns := uint16(0)
+	for i, nsu := range nm.NamespaceUris() {
+		if nsu == "http://github.com/awcullen/opcua/importtest/" {
+			ns = uint16(i)
+		}
+	}
+	if ns == 0 {
+		t.Fatal("Error importing nodeset. namespace not added")
+	}
+	if v, ok := nodes[0].(*server.VariableNode); !ok || v.Value().Value != int32(2) || v.DataType() != ua.NewNodeIDString(ns, "Import.Mode") {
+		t.Errorf("Error importing variable. got: %+v", nodes[0])
+	}
+	if n, ok := nodes[1].(*server.DataTypeNode); !ok {
+		t.Errorf("Error importing enumeration. got: %+v", nodes[1])
+	} else if def, ok := n.DataTypeDefinition().(ua.EnumDefinition); !ok || len(def.Fields) != 3 || def.Fields[2].Name != "Auto" {
+		t.Errorf("Error importing enumeration. got: %+v", n.DataTypeDefinition())
+	}
+	if n, ok := nodes[2].(*server.DataTypeNode); !ok {
+		t.Errorf("Error importing structure. got: %+v", nodes[2])
+	} else if def, ok := n.DataTypeDefinition().(ua.StructureDefinition); !ok || def.DefaultEncodingID != ua.NewNodeIDString(ns, "Import.Point.DefaultBinary") ||
+		def.BaseDataType != ua.NewNodeIDString(ns, "Import.BasePoint") || len(def.Fields) != 2 {
+		t.Errorf("Error importing structure. got: %+v", n.DataTypeDefinition())
+	}
+	if _, ok := nm.FindNode(nodes[0].NodeID()); ok {
+		t.Error("Error importing nodeset. nodes should not be added")
+	}
+
+	if err := nm.AddNodes(nodes...); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding nodes"))
+	}
+	defer nm.DeleteNodes(nodes, false)
+	ctx := context.Background()
+	ch, err := client.Dial(ctx, endpointURL, client.WithInsecureSkipVerify())
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	res, err := ch.Browse(ctx, &ua.BrowseRequest{
+		NodesToBrowse: []ua.BrowseDescription{{
+			NodeID:          ua.NewNodeIDString(ns, "Import.Folder"),
+			BrowseDirection: ua.BrowseDirectionForward,
+			ReferenceTypeID: ua.ReferenceTypeIDOrganizes,
+			ResultMask:      uint32(ua.BrowseResultMaskAll),
+		}},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error browsing"))
+		return
+	}
+	if refs := res.Results[0].References; len(refs) != 1 || refs[0].BrowseName.Name != "Mode" {
+		t.Errorf("Error browsing imported folder. got: %v", refs)
+	}
+}
+
+// TestExportNodeSet2 tests that exported nodes are imported with the same attributes, references and values.
+func TestExportNodeSet2(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	nodes, err := nm.ImportNodeSet2(strings.NewReader(importNodeSet))
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error importing nodeset"))
+	}
+	now := time.Date(2021, 6, 1, 12, 30, 15, 0, time.UTC)
+	values := []struct {
+		value     ua.Variant
+		dataType  ua.NodeID
+		valueRank int32
+	}{
+		{3.5, ua.DataTypeIDDouble, ua.ValueRankScalar},
+		{[]int32{1, 2, 3}, ua.DataTypeIDInt32, ua.ValueRankOneDimension},
+		{now, ua.DataTypeIDDateTime, ua.ValueRankScalar},
+		{ua.NewLocalizedText("Hallo", "de"), ua.DataTypeIDLocalizedText, ua.ValueRankScalar},
+		{ua.NewQualifiedName(2, "Demo"), ua.DataTypeIDQualifiedName, ua.ValueRankScalar},
+		{ua.NewNodeIDString(2, "Demo"), ua.DataTypeIDNodeID, ua.ValueRankScalar},
+		{ua.Range{Low: 0, High: 100}, ua.DataTypeIDRange, ua.ValueRankScalar},
+		{[]ua.ExtensionObject{ua.Argument{Name: "Offset", DataType: ua.DataTypeIDDouble, ValueRank: ua.ValueRankScalar, ArrayDimensions: []uint32{}, Description: ua.NewLocalizedText("offset", "en")}},
+			ua.DataTypeIDArgument, ua.ValueRankOneDimension},
+	}
+	for i, v := range values {
+		dims := []uint32{}
+		if v.valueRank == ua.ValueRankOneDimension {
+			dims = []uint32{0}
+		}
+		nodes = append(nodes, server.NewVariableNode(
+			ua.NewNodeIDString(2, fmt.Sprintf("Test.Export.%d", i)),
+			ua.NewQualifiedName(2, fmt.Sprintf("Export%d", i)),
+			ua.NewLocalizedText(fmt.Sprintf("Export%d", i), ""),
+			ua.NewLocalizedText("", ""),
+			nil,
+			[]ua.Reference{
+				{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+				{ReferenceTypeID: ua.ReferenceTypeIDOrganizes, IsInverse: true, TargetID: ua.NewExpandedNodeID(ua.ObjectIDObjectsFolder)},
+			},
+			ua.NewDataValue(v.value, 0, now, 0, now, 0),
+			v.dataType,
+			v.valueRank,
+			dims,
+			ua.AccessLevelsCurrentRead|ua.AccessLevelsCurrentWrite,
+			250,
+			false,
+			nil,
+		))
+	}
+
+	buf := &strings.Builder{}
+	if err := nm.ExportNodeSet2(buf, nodes); err != nil {
+		t.Fatal(errors.Wrap(err, "Error exporting nodeset"))
+	}
+	xml := buf.String()
+	for _, s := range []string{"<Uri>http://github.com/awcullen/opcua/importtest/</Uri>", `<Alias Alias="HasTypeDefinition">i=40</Alias>`, `DataType="Double"`} {
+		if !strings.Contains(xml, s) {
+			t.Errorf("Error exporting nodeset. missing: %s", s)
+		}
+	}
+	nodes2, err := nm.ImportNodeSet2(strings.NewReader(xml))
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error importing exported nodeset"))
+	}
+	if len(nodes2) != len(nodes) {
+		t.Fatalf("Error importing exported nodeset. want: %d nodes, got: %d", len(nodes), len(nodes2))
+	}
+	for i, n := range nodes {
+		n2 := nodes2[i]
+		if n2.NodeID() != n.NodeID() || n2.NodeClass() != n.NodeClass() || n2.BrowseName() != n.BrowseName() || n2.DisplayName().Text != n.DisplayName().Text ||
+			!reflect.DeepEqual(n2.References(), n.References()) {
+			t.Errorf("Error importing exported node. want: %+v, got: %+v", n, n2)
+			continue
+		}
+		switch n := n.(type) {
+		case *server.VariableNode:
+			v2 := n2.(*server.VariableNode)
+			if v2.DataType() != n.DataType() || v2.ValueRank() != n.ValueRank() || v2.AccessLevel() != n.AccessLevel() || !reflect.DeepEqual(v2.Value().Value, n.Value().Value) {
+				t.Errorf("Error importing exported variable %s. want: %v, got: %v", n.NodeID(), n.Value().Value, v2.Value().Value)
+			}
+		case *server.DataTypeNode:
+			if d2 := n2.(*server.DataTypeNode).DataTypeDefinition(); !reflect.DeepEqual(d2, n.DataTypeDefinition()) {
+				t.Errorf("Error importing exported definition %s. want: %+v, got: %+v", n.NodeID(), n.DataTypeDefinition(), d2)
+			}
+		}
+	}
+}
+
+// slowHistorian blocks ReadRawModified until the request is canceled.
+type slowHistorian struct {
+	*server.MemoryHistorian
+	started chan struct{}
+}
+
+func (h *slowHistorian) ReadRawModified(ctx context.Context, nodesToRead []ua.HistoryReadValueID, details ua.ReadRawModifiedDetails,
+	timestampsToReturn ua.TimestampsToReturn, releaseContinuationPoints bool) ([]ua.HistoryReadResult, ua.StatusCode) {
+	close(h.started)
+	select {
+	case <-ctx.Done():
+	case <-time.After(10 * time.Second):
+	}
+	return h.MemoryHistorian.ReadRawModified(ctx, nodesToRead, details, timestampsToReturn, releaseContinuationPoints)
+}
+
+// TestCancel tests that a Cancel request aborts a pending HistoryRead.
+func TestCancel(t *testing.T) {
+	url := "opc.tcp://127.0.0.1:46018"
+	h := &slowHistorian{MemoryHistorian: server.NewMemoryHistorian(100), started: make(chan struct{})}
+	srv, err := server.New(
+		ua.ApplicationDescription{ApplicationName: ua.NewLocalizedText("cancelserver", "")},
+		"./pki/server.crt",
+		"./pki/server.key",
+		url,
+		server.WithHistorian(h),
+		server.WithAnonymousIdentity(true),
+		server.WithSecurityPolicyNone(true),
+		server.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error constructing server"))
+		return
+	}
+	defer srv.Close()
+	go srv.ListenAndServe()
+	time.Sleep(500 * time.Millisecond)
+	node := server.NewVariableNode(
+		ua.ParseNodeID("ns=1;s=Slow"),
+		ua.NewQualifiedName(1, "Slow"),
+		ua.NewLocalizedText("Slow", ""),
+		ua.NewLocalizedText("", ""),
+		[]ua.RolePermissionType{
+			{RoleID: ua.ObjectIDWellKnownRoleAnonymous, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead | ua.PermissionTypeReadHistory},
+		},
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+		},
+		ua.DataValue{},
+		ua.DataTypeIDDouble,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentRead|ua.AccessLevelsHistoryRead,
+		0,
+		true,
+		h,
+	)
+	if err := srv.NamespaceManager().AddNode(node); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+
+	ctx := context.Background()
+	ch, err := client.Dial(ctx, url, client.WithInsecureSkipVerify())
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Abort(ctx)
+
+	req := &ua.HistoryReadRequest{
+		HistoryReadDetails: ua.ReadRawModifiedDetails{
+			StartTime:        time.Now().Add(-1 * time.Minute),
+			EndTime:          time.Now(),
+			NumValuesPerNode: 100,
+		},
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+		NodesToRead: []ua.HistoryReadValueID{
+			{NodeID: node.NodeID()},
+		},
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := ch.HistoryRead(ctx, req)
+		errCh <- err
+	}()
+	select {
+	case <-h.started:
+	case <-time.After(5 * time.Second):
+		t.Error("Error waiting for HistoryRead to start")
+		return
+	}
+	res, err := ch.Cancel(ctx, &ua.CancelRequest{RequestHandle: req.RequestHandle})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error canceling"))
+		return
+	}
+	if res.CancelCount != 1 {
+		t.Errorf("Error canceling. want: 1, got: %d", res.CancelCount)
+	}
+	select {
+	case err = <-errCh:
+		if err != ua.BadRequestCancelledByClient {
+			t.Errorf("Error reading history. want: %s, got: %v", ua.BadRequestCancelledByClient, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Error waiting for HistoryRead to be canceled")
+	}
+}
+
+// TestServerProfiles tests that the configured profiles are advertised in the ServerProfileArray.
+func TestServerProfiles(t *testing.T) {
+	caps := ua.NewServerCapabilities()
+	srv, err := server.New(
+		ua.ApplicationDescription{ApplicationName: ua.NewLocalizedText("profileserver", "")},
+		"./pki/server.crt",
+		"./pki/server.key",
+		"opc.tcp://127.0.0.1:46021",
+		server.WithServerCapabilities(caps),
+		server.WithServerProfiles(ua.ServerProfileURIStandardUA2017, ua.ServerProfileURIMethods, ua.ServerProfileURIHistoricalRawData),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error constructing server"))
+		return
+	}
+	defer srv.Close()
+	n, ok := srv.NamespaceManager().FindVariable(ua.VariableIDServerServerCapabilitiesServerProfileArray)
+	if !ok {
+		t.Error("Error finding ServerProfileArray")
+		return
+	}
+	want := []string{ua.ServerProfileURIStandardUA2017, ua.ServerProfileURIMethods, ua.ServerProfileURIHistoricalRawData}
+	if got := n.Value().Value; !reflect.DeepEqual(got, want) {
+		t.Errorf("Error reading ServerProfileArray. want: %v, got: %v", want, got)
+	}
+	if len(caps.ServerProfileArray) != 2 {
+		t.Errorf("Error configuring profiles. the caller's capabilities were changed: %v", caps.ServerProfileArray)
+	}
+}
+
+// TestWriteValidator tests that a write validator rejects malformed content before it is stored.
+func TestWriteValidator(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	id := ua.ParseNodeID("ns=2;s=Test.Certificate")
+	node := server.NewVariableNode(
+		id,
+		ua.NewQualifiedName(2, "Certificate"),
+		ua.NewLocalizedText("Certificate", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+		},
+		ua.NewDataValue(ua.ByteString(""), 0, time.Now(), 0, time.Now(), 0),
+		ua.DataTypeIDByteString,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentRead|ua.AccessLevelsCurrentWrite,
+		0,
+		false,
+		nil,
+	)
+	node.SetWriteValidator(func(value ua.Variant) ua.StatusCode {
+		b, _ := value.(ua.ByteString)
+		if _, err := x509.ParseCertificate([]byte(b)); err != nil {
+			return ua.BadInvalidArgument
+		}
+		return ua.Good
+	})
+	if err := nm.AddNode(node); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(node, false)
+
+	crt, err := os.ReadFile("./pki/server.crt")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error reading certificate"))
+	}
+	block, _ := pem.Decode(crt)
+	if block == nil {
+		t.Fatal("Error decoding certificate")
+	}
+
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	res, err := ch.Write(ctx, &ua.WriteRequest{
+		NodesToWrite: []ua.WriteValue{
+			{NodeID: id, AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(ua.ByteString("\x89PNG"), 0, time.Time{}, 0, time.Time{}, 0)},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error writing"))
+		return
+	}
+	if res.Results[0] != ua.BadInvalidArgument {
+		t.Errorf("Error writing malformed certificate. want: %s, got: %s", ua.BadInvalidArgument, res.Results[0])
+	}
+	if v, _ := node.Value().Value.(ua.ByteString); v != "" {
+		t.Errorf("Error writing malformed certificate. the value was stored")
+	}
+	res, err = ch.Write(ctx, &ua.WriteRequest{
+		NodesToWrite: []ua.WriteValue{
+			{NodeID: id, AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(ua.ByteString(block.Bytes), 0, time.Time{}, 0, time.Time{}, 0)},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error writing"))
+		return
+	}
+	if res.Results[0] != ua.Good {
+		t.Errorf("Error writing certificate. want: %s, got: %s", ua.Good, res.Results[0])
+	}
+	if v, _ := node.Value().Value.(ua.ByteString); v != ua.ByteString(block.Bytes) {
+		t.Errorf("Error writing certificate. the value was not stored")
+	}
+}
+
+// TestQueueOverflow tests that a full queue discards values as requested and sets the Overflow bit.
+func TestQueueOverflow(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	id := ua.ParseNodeID("ns=2;s=Test.Overflow")
+	node := server.NewVariableNode(
+		id,
+		ua.NewQualifiedName(2, "Overflow"),
+		ua.NewLocalizedText("Overflow", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+		},
+		ua.NewDataValue(float64(0), 0, time.Now(), 0, time.Now(), 0),
+		ua.DataTypeIDDouble,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentRead,
+		0,
+		false,
+		nil,
+	)
+	if err := nm.AddNode(node); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(node, false)
+
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	res, err := ch.CreateSubscription(ctx, &ua.CreateSubscriptionRequest{
+		RequestedPublishingInterval: 2000.0,
+		RequestedMaxKeepAliveCount:  10,
+		RequestedLifetimeCount:      10 * 3,
+		PublishingEnabled:           true,
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating subscription"))
+		return
+	}
+	_, err = ch.CreateMonitoredItems(ctx, &ua.CreateMonitoredItemsRequest{
+		SubscriptionID:     res.SubscriptionID,
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+		ItemsToCreate: []ua.MonitoredItemCreateRequest{
+			{
+				ItemToMonitor:  ua.ReadValueID{AttributeID: ua.AttributeIDValue, NodeID: id},
+				MonitoringMode: ua.MonitoringModeReporting,
+				RequestedParameters: ua.MonitoringParameters{
+					ClientHandle: 1, QueueSize: 2, DiscardOldest: true, SamplingInterval: 100.0,
+				},
+			},
+			{
+				ItemToMonitor:  ua.ReadValueID{AttributeID: ua.AttributeIDValue, NodeID: id},
+				MonitoringMode: ua.MonitoringModeReporting,
+				RequestedParameters: ua.MonitoringParameters{
+					ClientHandle: 2, QueueSize: 2, DiscardOldest: false, SamplingInterval: 100.0,
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating items"))
+		return
+	}
+	// change the value 5 times before the first publishing interval ends.
+	for i := 1; i <= 5; i++ {
+		time.Sleep(250 * time.Millisecond)
+		node.SetValue(ua.NewDataValue(float64(i), 0, time.Now(), 0, time.Now(), 0))
+	}
+	res2, err := ch.Publish(ctx, &ua.PublishRequest{
+		RequestHeader:                ua.RequestHeader{TimeoutHint: 60000},
+		SubscriptionAcknowledgements: []ua.SubscriptionAcknowledgement{},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error publishing"))
+		return
+	}
+	values := map[uint32][]ua.DataValue{}
+	for _, data := range res2.NotificationMessage.NotificationData {
+		if body, ok := data.(ua.DataChangeNotification); ok {
+			for _, z := range body.MonitoredItems {
+				values[z.ClientHandle] = append(values[z.ClientHandle], z.Value)
+			}
+		}
+	}
+	// discardOldest keeps the newest values, and sets the overflow bit of the oldest.
+	if v := values[1]; len(v) != 2 || v[0].Value != float64(4) || v[1].Value != float64(5) || !v[0].StatusCode.IsOverflow() || v[1].StatusCode.IsOverflow() {
+		t.Errorf("Error publishing with discardOldest. want: [4 (overflow) 5], got: %v", v)
+	}
+	// otherwise the newest value replaces the last value, and has the overflow bit set.
+	if v := values[2]; len(v) != 2 || v[0].Value != float64(0) || v[1].Value != float64(5) || v[0].StatusCode.IsOverflow() || !v[1].StatusCode.IsOverflow() {
+		t.Errorf("Error publishing without discardOldest. want: [0 5 (overflow)], got: %v", v)
+	}
+}
+
+// TestReadMatrixRange tests reading a multi-dimensional IndexRange of a matrix.
+func TestReadMatrixRange(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	id := ua.ParseNodeID("ns=2;s=Test.Matrix")
+	// a 3x4 matrix, flattened in row-major order.
+	node := server.NewVariableNode(
+		id,
+		ua.NewQualifiedName(2, "Matrix"),
+		ua.NewLocalizedText("Matrix", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+		},
+		ua.NewDataValue([]int32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}, 0, time.Now(), 0, time.Now(), 0),
+		ua.DataTypeIDInt32,
+		2,
+		[]uint32{3, 4},
+		ua.AccessLevelsCurrentRead,
+		0,
+		false,
+		nil,
+	)
+	if err := nm.AddNode(node); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(node, false)
+
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	res, err := ch.Read(ctx, &ua.ReadRequest{
+		NodesToRead: []ua.ReadValueID{
+			{NodeID: id, AttributeID: ua.AttributeIDValue, IndexRange: "1:2,0:1"},
+			{NodeID: id, AttributeID: ua.AttributeIDValue, IndexRange: "2,3"},
+			{NodeID: id, AttributeID: ua.AttributeIDValue, IndexRange: "3:4,0"},
+			{NodeID: id, AttributeID: ua.AttributeIDValue, IndexRange: "1:x,0"},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading"))
+		return
+	}
+	if v := res.Results[0].Value; !reflect.DeepEqual(v, []int32{4, 5, 8, 9}) {
+		t.Errorf("Error reading range '1:2,0:1'. want: %v, got: %v", []int32{4, 5, 8, 9}, v)
+	}
+	if v := res.Results[1].Value; !reflect.DeepEqual(v, []int32{11}) {
+		t.Errorf("Error reading range '2,3'. want: %v, got: %v", []int32{11}, v)
+	}
+	if sc := res.Results[2].StatusCode; sc != ua.BadIndexRangeNoData {
+		t.Errorf("Error reading range '3:4,0'. want: %s, got: %s", ua.BadIndexRangeNoData, sc)
+	}
+	if sc := res.Results[3].StatusCode; sc != ua.BadIndexRangeInvalid {
+		t.Errorf("Error reading range '1:x,0'. want: %s, got: %s", ua.BadIndexRangeInvalid, sc)
+	}
+}
+
+// TestMatrixIndexRange tests reading and writing ranges of a Matrix value.
+func TestMatrixIndexRange(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	id := ua.ParseNodeID("ns=2;s=Test.MatrixValue")
+	node := server.NewVariableNode(
+		id,
+		ua.NewQualifiedName(2, "MatrixValue"),
+		ua.NewLocalizedText("MatrixValue", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+		},
+		ua.NewDataValue(ua.Matrix{Elements: []int32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}, Dimensions: []int32{3, 4}}, 0, time.Now(), 0, time.Now(), 0),
+		ua.DataTypeIDInt32,
+		2,
+		[]uint32{3, 4},
+		ua.AccessLevelsCurrentRead|ua.AccessLevelsCurrentWrite,
+		0,
+		false,
+		nil,
+	)
+	if err := nm.AddNode(node); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(node, false)
+
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening client"))
+	}
+	defer ch.Close(ctx)
+	res, err := ch.Read(ctx, &ua.ReadRequest{
+		NodesToRead: []ua.ReadValueID{
+			{NodeID: id, AttributeID: ua.AttributeIDValue, IndexRange: "1:2,0:1"},
+			{NodeID: id, AttributeID: ua.AttributeIDValue, IndexRange: "1"},
+		},
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error reading"))
+	}
+	want := ua.Matrix{Elements: []int32{4, 5, 8, 9}, Dimensions: []int32{2, 2}}
+	if v := res.Results[0].Value; !reflect.DeepEqual(v, want) {
+		t.Errorf("Error reading range '1:2,0:1'. want: %v, got: %v", want, v)
+	}
+	if sc := res.Results[1].StatusCode; sc != ua.BadIndexRangeNoData {
+		t.Errorf("Error reading range '1'. want: %s, got: %s", ua.BadIndexRangeNoData, sc)
+	}
+
+	res2, err := ch.Write(ctx, &ua.WriteRequest{
+		NodesToWrite: []ua.WriteValue{
+			{NodeID: id, AttributeID: ua.AttributeIDValue, IndexRange: "0:1,2", Value: ua.NewDataValue(ua.Matrix{Elements: []int32{20, 60}, Dimensions: []int32{2, 1}}, 0, time.Time{}, 0, time.Time{}, 0)},
+			{NodeID: id, AttributeID: ua.AttributeIDValue, IndexRange: "0:1,2", Value: ua.NewDataValue(ua.Matrix{Elements: []int32{20, 60}, Dimensions: []int32{1, 2}}, 0, time.Time{}, 0, time.Time{}, 0)},
+			{NodeID: id, AttributeID: ua.AttributeIDValue, IndexRange: "0:1,2", Value: ua.NewDataValue([]int32{20, 60}, 0, time.Time{}, 0, time.Time{}, 0)},
+		},
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error writing"))
+	}
+	if res2.Results[0] != ua.Good {
+		t.Errorf("Error writing range. want: %s, got: %s", ua.Good, res2.Results[0])
+	}
+	if res2.Results[1] != ua.BadIndexRangeInvalid {
+		t.Errorf("Error writing range of wrong dimensions. want: %s, got: %s", ua.BadIndexRangeInvalid, res2.Results[1])
+	}
+	if res2.Results[2] != ua.BadTypeMismatch {
+		t.Errorf("Error writing array to matrix range. want: %s, got: %s", ua.BadTypeMismatch, res2.Results[2])
+	}
+	want = ua.Matrix{Elements: []int32{0, 1, 20, 3, 4, 5, 60, 7, 8, 9, 10, 11}, Dimensions: []int32{3, 4}}
+	if v := node.Value().Value; !reflect.DeepEqual(v, want) {
+		t.Errorf("Error writing range. want: %v, got: %v", want, v)
+	}
+}
+
+// TestWriteIndexRangeMismatch tests writing a range with too few elements, or elements of the wrong type.
+func TestWriteIndexRangeMismatch(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	id := ua.ParseNodeID("ns=2;s=Test.Setpoints")
+	node := server.NewVariableNode(
+		id,
+		ua.NewQualifiedName(2, "Setpoints"),
+		ua.NewLocalizedText("Setpoints", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+		},
+		ua.NewDataValue([]int32{0, 1, 2, 3, 4}, 0, time.Now(), 0, time.Now(), 0),
+		ua.DataTypeIDInt32,
+		ua.ValueRankOneDimension,
+		[]uint32{0},
+		ua.AccessLevelsCurrentRead|ua.AccessLevelsCurrentWrite,
+		0,
+		false,
+		nil,
+	)
+	if err := nm.AddNode(node); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(node, false)
+
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	res, err := ch.Write(ctx, &ua.WriteRequest{
+		NodesToWrite: []ua.WriteValue{
+			{NodeID: id, AttributeID: ua.AttributeIDValue, IndexRange: "1:2", Value: ua.NewDataValue([]int32{10, 20}, 0, time.Time{}, 0, time.Time{}, 0)},
+			{NodeID: id, AttributeID: ua.AttributeIDValue, IndexRange: "1:3", Value: ua.NewDataValue([]int32{7, 8}, 0, time.Time{}, 0, time.Time{}, 0)},
+			{NodeID: id, AttributeID: ua.AttributeIDValue, IndexRange: "1:2", Value: ua.NewDataValue([]float64{7, 8}, 0, time.Time{}, 0, time.Time{}, 0)},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error writing"))
+		return
+	}
+	if res.Results[0] != ua.Good {
+		t.Errorf("Error writing range. want: %s, got: %s", ua.Good, res.Results[0])
+	}
+	if res.Results[1] != ua.BadIndexRangeInvalid {
+		t.Errorf("Error writing range of wrong length. want: %s, got: %s", ua.BadIndexRangeInvalid, res.Results[1])
+	}
+	if res.Results[2] != ua.BadTypeMismatch {
+		t.Errorf("Error writing range of wrong type. want: %s, got: %s", ua.BadTypeMismatch, res.Results[2])
+	}
+	v, _ := node.Value().Value.([]int32)
+	if !reflect.DeepEqual(v, []int32{0, 10, 20, 3, 4}) {
+		t.Errorf("Error writing range. want: %v, got: %v", []int32{0, 10, 20, 3, 4}, v)
+	}
+}
+
+// TestCallMethodArguments tests that the server checks the input arguments before calling the method.
+func TestCallMethodArguments(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	objectID := ua.ParseNodeID("ns=2;s=Demo.Methods")
+	methodID := ua.ParseNodeID("ns=2;s=Test.Calibrate")
+	argsID := ua.ParseNodeID("ns=2;s=Test.Calibrate.InputArguments")
+	pointsID := ua.ParseNodeID("ns=2;s=Test.Calibrate.Points")
+	method := server.NewMethodNode(
+		methodID,
+		ua.NewQualifiedName(2, "Calibrate"),
+		ua.NewLocalizedText("Calibrate", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasComponent, IsInverse: true, TargetID: ua.NewExpandedNodeID(objectID)},
+			{ReferenceTypeID: ua.ReferenceTypeIDHasProperty, TargetID: ua.NewExpandedNodeID(argsID)},
+			{ReferenceTypeID: ua.ReferenceTypeIDHasOptionalInputArgumentDescription, TargetID: ua.NewExpandedNodeID(pointsID)},
+		},
+		true,
+	)
+	// the Points argument is optional.
+	points := server.NewVariableNode(
+		pointsID,
+		ua.NewQualifiedName(2, "Points"),
+		ua.NewLocalizedText("Points", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+		},
+		ua.NewDataValue([]int32{}, 0, time.Now(), 0, time.Now(), 0),
+		ua.DataTypeIDInt32,
+		ua.ValueRankOneDimension,
+		[]uint32{0},
+		ua.AccessLevelsCurrentRead,
+		0,
+		false,
+		nil,
+	)
+	// the Reset method does not declare its arguments.
+	resetID := ua.ParseNodeID("ns=2;s=Test.Reset")
+	reset := server.NewMethodNode(
+		resetID,
+		ua.NewQualifiedName(2, "Reset"),
+		ua.NewLocalizedText("Reset", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasComponent, IsInverse: true, TargetID: ua.NewExpandedNodeID(objectID)},
+		},
+		true,
+	)
+	args := server.NewVariableNode(
+		argsID,
+		ua.NewQualifiedName(0, "InputArguments"),
+		ua.NewLocalizedText("InputArguments", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDPropertyType)},
+		},
+		ua.NewDataValue([]ua.ExtensionObject{
+			ua.Argument{Name: "Offset", DataType: ua.DataTypeIDDouble, ValueRank: ua.ValueRankScalar},
+			ua.Argument{Name: "Points", DataType: ua.DataTypeIDInt32, ValueRank: ua.ValueRankOneDimension, ArrayDimensions: []uint32{0}},
+		}, 0, time.Now(), 0, time.Now(), 0),
+		ua.DataTypeIDArgument,
+		ua.ValueRankOneDimension,
+		[]uint32{0},
+		ua.AccessLevelsCurrentRead,
+		0,
+		false,
+		nil,
+	)
+	var called int32
+	method.SetCallMethodHandler(func(ctx context.Context, req ua.CallMethodRequest) ua.CallMethodResult {
+		atomic.AddInt32(&called, 1)
+		return ua.CallMethodResult{}
+	})
+	reset.SetCallMethodHandler(func(ctx context.Context, req ua.CallMethodRequest) ua.CallMethodResult {
+		atomic.AddInt32(&called, 1)
+		return ua.CallMethodResult{}
+	})
+	if err := nm.AddNodes(method, args, points, reset); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding nodes"))
+	}
+	defer nm.DeleteNodes([]server.Node{method, args, points, reset}, false)
+
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	res, err := ch.Call(ctx, &ua.CallRequest{
+		MethodsToCall: []ua.CallMethodRequest{
+			{ObjectID: objectID, MethodID: methodID, InputArguments: []ua.Variant{float64(0.5)}},
+			{ObjectID: objectID, MethodID: methodID, InputArguments: []ua.Variant{float64(0.5), []int32{1, 2}, true}},
+			{ObjectID: objectID, MethodID: methodID, InputArguments: []ua.Variant{float64(0.5), int32(1)}},
+			{ObjectID: objectID, MethodID: methodID, InputArguments: []ua.Variant{float64(0.5), []int32{1, 2}}},
+			{ObjectID: objectID, MethodID: methodID, InputArguments: []ua.Variant{nil, []int32{1, 2}}},
+			{ObjectID: objectID, MethodID: methodID, InputArguments: []ua.Variant{float64(0.5), nil}},
+			{ObjectID: objectID, MethodID: resetID, InputArguments: []ua.Variant{true}},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error calling method"))
+		return
+	}
+	if res.Results[0].StatusCode != ua.BadArgumentsMissing {
+		t.Errorf("Error calling method with too few arguments. want: %s, got: %s", ua.BadArgumentsMissing, res.Results[0].StatusCode)
+	}
+	if res.Results[1].StatusCode != ua.BadTooManyArguments {
+		t.Errorf("Error calling method with too many arguments. want: %s, got: %s", ua.BadTooManyArguments, res.Results[1].StatusCode)
+	}
+	if res.Results[2].StatusCode != ua.BadInvalidArgument {
+		t.Errorf("Error calling method with scalar for array. want: %s, got: %s", ua.BadInvalidArgument, res.Results[2].StatusCode)
+	}
+	if !reflect.DeepEqual(res.Results[2].InputArgumentResults, []ua.StatusCode{ua.Good, ua.BadTypeMismatch}) {
+		t.Errorf("Error calling method with scalar for array. got: %v", res.Results[2].InputArgumentResults)
+	}
+	if res.Results[3].StatusCode != ua.Good {
+		t.Errorf("Error calling method. want: %s, got: %s", ua.Good, res.Results[3].StatusCode)
+	}
+	if res.Results[4].StatusCode != ua.BadInvalidArgument {
+		t.Errorf("Error calling method with null for required argument. want: %s, got: %s", ua.BadInvalidArgument, res.Results[4].StatusCode)
+	}
+	if !reflect.DeepEqual(res.Results[4].InputArgumentResults, []ua.StatusCode{ua.BadTypeMismatch, ua.Good}) {
+		t.Errorf("Error calling method with null for required argument. got: %v", res.Results[4].InputArgumentResults)
+	}
+	if res.Results[5].StatusCode != ua.Good {
+		t.Errorf("Error calling method with null for optional argument. want: %s, got: %s", ua.Good, res.Results[5].StatusCode)
+	}
+	if res.Results[6].StatusCode != ua.Good {
+		t.Errorf("Error calling method without InputArguments. want: %s, got: %s", ua.Good, res.Results[6].StatusCode)
+	}
+	if called := atomic.LoadInt32(&called); called != 3 {
+		t.Errorf("Error calling method. want handler called 3 times, got: %d", called)
+	}
+}
+
+// TestNodeVersion tests that the NodeVersion of a folder is incremented when a child is added or deleted.
+func TestNodeVersion(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	folder := server.NewObjectNode(
+		ua.ParseNodeID("ns=2;s=Test.Devices"),
+		ua.NewQualifiedName(2, "Devices"),
+		ua.NewLocalizedText("Devices", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.ObjectTypeIDFolderType)},
+		},
+		0,
+	)
+	if err := nm.AddNode(folder); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(folder, true)
+	nodeVersion, err := nm.AddNodeVersion(folder)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding NodeVersion"))
+	}
+	if v, ok := nm.NodeVersion(folder); !ok || v != "0" {
+		t.Errorf("Error reading NodeVersion. want: %s, got: %s", "0", v)
+	}
+	child := server.NewObjectNode(
+		ua.ParseNodeID("ns=2;s=Test.Devices.Pump"),
+		ua.NewQualifiedName(2, "Pump"),
+		ua.NewLocalizedText("Pump", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.ObjectTypeIDBaseObjectType)},
+			{ReferenceTypeID: ua.ReferenceTypeIDOrganizes, IsInverse: true, TargetID: ua.NewExpandedNodeID(folder.NodeID())},
+		},
+		0,
+	)
+	if err := nm.AddNode(child); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	if v, ok := nm.NodeVersion(folder); !ok || v != "1" {
+		t.Errorf("Error adding child. want NodeVersion: %s, got: %s", "1", v)
+	}
+
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	res, err := ch.Read(ctx, &ua.ReadRequest{
+		NodesToRead: []ua.ReadValueID{
+			{NodeID: nodeVersion.NodeID(), AttributeID: ua.AttributeIDValue},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading"))
+		return
+	}
+	if v, _ := res.Results[0].Value.(string); v != "1" {
+		t.Errorf("Error reading NodeVersion. want: %s, got: %v", "1", res.Results[0].Value)
+	}
+
+	nm.DeleteNode(child, false)
+	if v, ok := nm.NodeVersion(folder); !ok || v != "2" {
+		t.Errorf("Error deleting child. want NodeVersion: %s, got: %s", "2", v)
+	}
+
+	// concurrent increments are not lost, and the handlers are notified after the lock is released,
+	// so they may use the namespace manager.
+	var changes int32
+	nodeVersion.AddValueChangedHandler(func(oldValue, newValue ua.DataValue) {
+		// Add takes the write lock of the namespace manager.
+		nm.Add(nm.NamespaceUris()[1])
+		atomic.AddInt32(&changes, 1)
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			nm.IncrementNodeVersion(folder)
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Error incrementing NodeVersion. want: done, got: timeout")
+	}
+	if v, ok := nm.NodeVersion(folder); !ok || v != "102" {
+		t.Errorf("Error incrementing NodeVersion. want: %s, got: %s", "102", v)
+	}
+	if n := atomic.LoadInt32(&changes); n != 100 {
+		t.Errorf("Error notifying NodeVersion changes. want: %d, got: %d", 100, n)
+	}
+}
+
+// TestWriteDisplayName tests relabeling a variable, which requires the WriteAttribute permission.
+func TestWriteDisplayName(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	id := ua.ParseNodeID("ns=2;s=Test.Tag1")
+	node := server.NewVariableNode(
+		id,
+		ua.NewQualifiedName(2, "Tag1"),
+		ua.NewLocalizedText("Tag1", ""),
+		ua.NewLocalizedText("", ""),
+		[]ua.RolePermissionType{
+			{RoleID: ua.ObjectIDWellKnownRoleAnonymous, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead},
+			{RoleID: ua.ObjectIDWellKnownRoleEngineer, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead | ua.PermissionTypeWriteAttribute},
+		},
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+		},
+		ua.NewDataValue(42.0, 0, time.Now(), 0, time.Now(), 0),
+		ua.DataTypeIDDouble,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentRead,
+		0,
+		false,
+		nil,
+	)
+	if err := nm.AddNode(node); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(node, false)
+
+	ctx := context.Background()
+	anonymous, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer anonymous.Close(ctx)
+	res, err := anonymous.Write(ctx, &ua.WriteRequest{
+		NodesToWrite: []ua.WriteValue{
+			{NodeID: id, AttributeID: ua.AttributeIDDisplayName, Value: ua.NewDataValue(ua.NewLocalizedText("Tank Level", "en"), 0, time.Time{}, 0, time.Time{}, 0)},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error writing"))
+		return
+	}
+	if res.Results[0] != ua.BadUserAccessDenied {
+		t.Errorf("Error writing DisplayName without permission. want: %s, got: %s", ua.BadUserAccessDenied, res.Results[0])
+	}
+
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	res, err = ch.Write(ctx, &ua.WriteRequest{
+		NodesToWrite: []ua.WriteValue{
+			{NodeID: id, AttributeID: ua.AttributeIDDisplayName, Value: ua.NewDataValue(ua.NewLocalizedText("Tank Level", "en"), 0, time.Time{}, 0, time.Time{}, 0)},
+			{NodeID: id, AttributeID: ua.AttributeIDDescription, Value: ua.NewDataValue(ua.NewLocalizedText("Level of the tank", "en"), 0, time.Time{}, 0, time.Time{}, 0)},
+			{NodeID: id, AttributeID: ua.AttributeIDDescription, Value: ua.NewDataValue("Level of the tank", 0, time.Time{}, 0, time.Time{}, 0)},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error writing"))
+		return
+	}
+	if res.Results[0] != ua.Good || res.Results[1] != ua.Good {
+		t.Errorf("Error writing DisplayName and Description. want: %s, got: %s, %s", ua.Good, res.Results[0], res.Results[1])
+	}
+	if res.Results[2] != ua.BadTypeMismatch {
+		t.Errorf("Error writing Description as string. want: %s, got: %s", ua.BadTypeMismatch, res.Results[2])
+	}
+	res2, err := ch.Read(ctx, &ua.ReadRequest{
+		NodesToRead: []ua.ReadValueID{
+			{NodeID: id, AttributeID: ua.AttributeIDDisplayName},
+			{NodeID: id, AttributeID: ua.AttributeIDDescription},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading"))
+		return
+	}
+	if v, _ := res2.Results[0].Value.(ua.LocalizedText); v.Text != "Tank Level" {
+		t.Errorf("Error reading DisplayName. want: %s, got: %v", "Tank Level", res2.Results[0].Value)
+	}
+	if v, _ := res2.Results[1].Value.(ua.LocalizedText); v.Text != "Level of the tank" {
+		t.Errorf("Error reading Description. want: %s, got: %v", "Level of the tank", res2.Results[1].Value)
+	}
+}
+
+// TestPercentDeadband tests that changes within a percentage of the EURange are not reported.
+func TestPercentDeadband(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	newNode := func(name string) *server.VariableNode {
+		return server.NewVariableNode(
+			ua.ParseNodeID("ns=2;s=Test."+name),
+			ua.NewQualifiedName(2, name),
+			ua.NewLocalizedText(name, ""),
+			ua.NewLocalizedText("", ""),
+			nil,
+			[]ua.Reference{
+				{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDAnalogItemType)},
+			},
+			ua.NewDataValue(float64(0), 0, time.Now(), 0, time.Now(), 0),
+			ua.DataTypeIDDouble,
+			ua.ValueRankScalar,
+			[]uint32{},
+			ua.AccessLevelsCurrentRead,
+			0,
+			false,
+			nil,
+		)
+	}
+	node := newNode("Pressure")
+	other := newNode("Flow")
+	if err := nm.AddNodes(node, other); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding nodes"))
+	}
+	defer nm.DeleteNodes([]server.Node{node, other}, true)
+	if _, err := nm.AddProperty(node, ua.NewQualifiedName(0, "EURange"), ua.DataTypeIDRange, ua.NewDataValue(ua.Range{Low: 0, High: 200}, 0, time.Now(), 0, time.Now(), 0)); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding property"))
+	}
+
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	res, err := ch.CreateSubscription(ctx, &ua.CreateSubscriptionRequest{
+		RequestedPublishingInterval: 2000.0,
+		RequestedMaxKeepAliveCount:  10,
+		RequestedLifetimeCount:      10 * 3,
+		PublishingEnabled:           true,
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating subscription"))
+		return
+	}
+	percent := func(value float64) ua.DataChangeFilter {
+		return ua.DataChangeFilter{Trigger: ua.DataChangeTriggerStatusValue, DeadbandType: uint32(ua.DeadbandTypePercent), DeadbandValue: value}
+	}
+	res1, err := ch.CreateMonitoredItems(ctx, &ua.CreateMonitoredItemsRequest{
+		SubscriptionID:     res.SubscriptionID,
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+		ItemsToCreate: []ua.MonitoredItemCreateRequest{
+			{
+				ItemToMonitor:  ua.ReadValueID{AttributeID: ua.AttributeIDValue, NodeID: node.NodeID()},
+				MonitoringMode: ua.MonitoringModeReporting,
+				RequestedParameters: ua.MonitoringParameters{
+					ClientHandle: 1, QueueSize: 10, DiscardOldest: true, SamplingInterval: 100.0, Filter: percent(5),
+				},
+			},
+			{
+				ItemToMonitor:  ua.ReadValueID{AttributeID: ua.AttributeIDValue, NodeID: other.NodeID()},
+				MonitoringMode: ua.MonitoringModeReporting,
+				RequestedParameters: ua.MonitoringParameters{
+					ClientHandle: 2, QueueSize: 10, DiscardOldest: true, SamplingInterval: 100.0, Filter: percent(5),
+				},
+			},
+			{
+				ItemToMonitor:  ua.ReadValueID{AttributeID: ua.AttributeIDValue, NodeID: node.NodeID()},
+				MonitoringMode: ua.MonitoringModeReporting,
+				RequestedParameters: ua.MonitoringParameters{
+					ClientHandle: 3, QueueSize: 10, DiscardOldest: true, SamplingInterval: 100.0, Filter: percent(150),
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating items"))
+		return
+	}
+	if sc := res1.Results[0].StatusCode; sc != ua.Good {
+		t.Errorf("Error creating item with percent deadband. want: %s, got: %s", ua.Good, sc)
+	}
+	if sc := res1.Results[1].StatusCode; sc != ua.BadDeadbandFilterInvalid {
+		t.Errorf("Error creating item with percent deadband without EURange. want: %s, got: %s", ua.BadDeadbandFilterInvalid, sc)
+	}
+	if sc := res1.Results[2].StatusCode; sc != ua.BadDeadbandFilterInvalid {
+		t.Errorf("Error creating item with percent deadband over 100. want: %s, got: %s", ua.BadDeadbandFilterInvalid, sc)
+	}
+	// the deadband is 5% of 200. only changes of more than 10 from the last reported value are reported.
+	for _, v := range []float64{4, 8, 15, 20, 26} {
+		time.Sleep(250 * time.Millisecond)
+		node.SetValue(ua.NewDataValue(v, 0, time.Now(), 0, time.Now(), 0))
+	}
+	res2, err := ch.Publish(ctx, &ua.PublishRequest{
+		RequestHeader:                ua.RequestHeader{TimeoutHint: 60000},
+		SubscriptionAcknowledgements: []ua.SubscriptionAcknowledgement{},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error publishing"))
+		return
+	}
+	values := []ua.Variant{}
+	for _, data := range res2.NotificationMessage.NotificationData {
+		if body, ok := data.(ua.DataChangeNotification); ok {
+			for _, z := range body.MonitoredItems {
+				values = append(values, z.Value.Value)
+			}
+		}
+	}
+	if !reflect.DeepEqual(values, []ua.Variant{float64(0), float64(15), float64(26)}) {
+		t.Errorf("Error publishing with percent deadband. want: [0 15 26], got: %v", values)
+	}
+}
+
+// TestReverseConnection tests a client that listens for the server to connect.
+func TestReverseConnection(t *testing.T) {
+	srv, err := server.New(
+		ua.ApplicationDescription{ApplicationURI: "urn:127.0.0.1:fielddevice", ApplicationName: ua.NewLocalizedText("fielddevice", "")},
+		"./pki/server.crt",
+		"./pki/server.key",
+		"opc.tcp://127.0.0.1:46022",
+		server.WithAnonymousIdentity(true),
+		server.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error constructing server"))
+		return
+	}
+	defer srv.Close()
+	go srv.ListenAndServe()
+
+	// the client side listens for the server, and reads the ReverseHello of each connection.
+	rl, err := net.Listen("tcp", "127.0.0.1:46023")
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error listening"))
+		return
+	}
+	defer rl.Close()
+	conns := make(chan net.Conn, 1)
+	hellos := make(chan string, 8)
+	go func() {
+		for {
+			conn, err := rl.Accept()
+			if err != nil {
+				return
+			}
+			buf := make([]byte, 1024)
+			n, err := conn.Read(buf)
+			if err != nil || n < 8 || string(buf[:4]) != "RHEF" {
+				conn.Close()
+				continue
+			}
+			hellos <- string(buf[8:n])
+			conns <- conn
+		}
+	}()
+	// the client dials a local port, which is forwarded to the connections from the server.
+	l, err := net.Listen("tcp", "127.0.0.1:46024")
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error listening"))
+		return
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			var remote net.Conn
+			select {
+			case remote = <-conns:
+			case <-time.After(5 * time.Second):
+				conn.Close()
+				continue
+			}
+			go func() {
+				io.Copy(remote, conn)
+				remote.Close()
+			}()
+			go func() {
+				io.Copy(conn, remote)
+				conn.Close()
+			}()
+		}
+	}()
+	time.Sleep(500 * time.Millisecond)
+
+	if err := srv.AddReverseConnection("http://127.0.0.1:46023"); err != ua.BadTCPEndpointURLInvalid {
+		t.Errorf("Error adding reverse connection. want: %s, got: %v", ua.BadTCPEndpointURLInvalid, err)
+	}
+	if err := srv.AddReverseConnection("opc.tcp://127.0.0.1:46023"); err != nil {
+		t.Error(errors.Wrap(err, "Error adding reverse connection"))
+		return
+	}
+
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		"opc.tcp://127.0.0.1:46024",
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	res, err := ch.Read(ctx, &ua.ReadRequest{
+		NodesToRead: []ua.ReadValueID{
+			{NodeID: ua.VariableIDServerServerStatusState, AttributeID: ua.AttributeIDValue},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading"))
+		return
+	}
+	if v, _ := res.Results[0].Value.(int32); ua.ServerState(v) != ua.ServerStateRunning {
+		t.Errorf("Error reading ServerState. want: %d, got: %v", ua.ServerStateRunning, res.Results[0].Value)
+	}
+	if hello := <-hellos; !strings.Contains(hello, "urn:127.0.0.1:fielddevice") || !strings.Contains(hello, "opc.tcp://127.0.0.1:46022") {
+		t.Errorf("Error reading ReverseHello. got: %q", hello)
+	}
+}
+
+func TestAddDeleteNodes(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	parentID := ua.ParseNodeID("ns=2;s=Test.Dynamic")
+	parent := server.NewObjectNode(
+		parentID,
+		ua.NewQualifiedName(2, "Dynamic"),
+		ua.NewLocalizedText("Dynamic", ""),
+		ua.NewLocalizedText("", ""),
+		[]ua.RolePermissionType{
+			{RoleID: ua.ObjectIDWellKnownRoleAnonymous, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead},
+			{RoleID: ua.ObjectIDWellKnownRoleEngineer, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead | ua.PermissionTypeAddNode | ua.PermissionTypeDeleteNode},
+		},
+		[]ua.Reference{
+			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.ObjectTypeIDFolderType)),
+			ua.NewReference(ua.ReferenceTypeIDOrganizes, true, ua.NewExpandedNodeID(ua.ObjectIDObjectsFolder)),
+		},
+		0,
+	)
+	if err := nm.AddNode(parent); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(parent, false)
+
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+
+	pumpID := ua.ParseNodeID("ns=2;s=Test.Dynamic.Pump")
+	speedID := ua.ParseNodeID("ns=2;s=Test.Dynamic.Pump.Speed")
+	res, err := ch.AddNodes(ctx, &ua.AddNodesRequest{
+		NodesToAdd: []ua.AddNodesItem{
+			{
+				ParentNodeID:       ua.NewExpandedNodeID(parentID),
+				ReferenceTypeID:    ua.ReferenceTypeIDOrganizes,
+				RequestedNewNodeID: ua.NewExpandedNodeID(pumpID),
+				BrowseName:         ua.NewQualifiedName(2, "Pump"),
+				NodeClass:          ua.NodeClassObject,
+				NodeAttributes: ua.ObjectAttributes{
+					SpecifiedAttributes: uint32(ua.NodeAttributesMaskDisplayName),
+					DisplayName:         ua.NewLocalizedText("Pump", "en"),
+				},
+				TypeDefinition: ua.NewExpandedNodeID(ua.ObjectTypeIDBaseObjectType),
+			},
+			{
+				ParentNodeID:       ua.NewExpandedNodeID(pumpID),
+				ReferenceTypeID:    ua.ReferenceTypeIDHasComponent,
+				RequestedNewNodeID: ua.NewExpandedNodeID(speedID),
+				BrowseName:         ua.NewQualifiedName(2, "Speed"),
+				NodeClass:          ua.NodeClassVariable,
+				NodeAttributes: ua.VariableAttributes{
+					SpecifiedAttributes: uint32(ua.NodeAttributesMaskValue | ua.NodeAttributesMaskDataType | ua.NodeAttributesMaskValueRank | ua.NodeAttributesMaskAccessLevel),
+					Value:               1500.0,
+					DataType:            ua.DataTypeIDDouble,
+					ValueRank:           ua.ValueRankScalar,
+					AccessLevel:         ua.AccessLevelsCurrentRead,
+				},
+				TypeDefinition: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType),
+			},
+			{
+				ParentNodeID:       ua.NewExpandedNodeID(parentID),
+				ReferenceTypeID:    ua.ReferenceTypeIDOrganizes,
+				RequestedNewNodeID: ua.NewExpandedNodeID(pumpID),
+				BrowseName:         ua.NewQualifiedName(2, "Pump"),
+				NodeClass:          ua.NodeClassObject,
+				NodeAttributes:     ua.ObjectAttributes{},
+				TypeDefinition:     ua.NewExpandedNodeID(ua.ObjectTypeIDBaseObjectType),
+			},
+			{
+				ParentNodeID:    ua.NewExpandedNodeID(ua.ParseNodeID("ns=2;s=Test.Unknown")),
+				ReferenceTypeID: ua.ReferenceTypeIDOrganizes,
+				BrowseName:      ua.NewQualifiedName(2, "Valve"),
+				NodeClass:       ua.NodeClassObject,
+				NodeAttributes:  ua.ObjectAttributes{},
+				TypeDefinition:  ua.NewExpandedNodeID(ua.ObjectTypeIDBaseObjectType),
+			},
+			{
+				ParentNodeID:    ua.NewExpandedNodeID(parentID),
+				ReferenceTypeID: ua.ReferenceTypeIDOrganizes,
+				BrowseName:      ua.NewQualifiedName(2, "Flow"),
+				NodeClass:       ua.NodeClassVariable,
+				NodeAttributes:  ua.ObjectAttributes{},
+				TypeDefinition:  ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType),
+			},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error adding nodes"))
+		return
+	}
+	want := []ua.StatusCode{ua.Good, ua.Good, ua.BadNodeIDExists, ua.BadParentNodeIDInvalid, ua.BadNodeAttributesInvalid}
+	for i, r := range res.Results {
+		if r.StatusCode != want[i] {
+			t.Errorf("Error adding node %d. want: %s, got: %s", i, want[i], r.StatusCode)
+		}
+	}
+	if res.Results[1].AddedNodeID != speedID {
+		t.Errorf("Error adding node. want: %s, got: %s", speedID, res.Results[1].AddedNodeID)
+	}
+
+	res2, err := ch.Read(ctx, &ua.ReadRequest{
+		NodesToRead: []ua.ReadValueID{
+			{NodeID: speedID, AttributeID: ua.AttributeIDValue},
+			{NodeID: pumpID, AttributeID: ua.AttributeIDDisplayName},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading"))
+		return
+	}
+	if v, ok := res2.Results[0].Value.(float64); !ok || v != 1500.0 {
+		t.Errorf("Error reading Speed. want: %v, got: %v", 1500.0, res2.Results[0].Value)
+	}
+	if v, ok := res2.Results[1].Value.(ua.LocalizedText); !ok || v.Text != "Pump" {
+		t.Errorf("Error reading DisplayName. want: %s, got: %v", "Pump", res2.Results[1].Value)
+	}
+
+	res3, err := ch.DeleteNodes(ctx, &ua.DeleteNodesRequest{
+		NodesToDelete: []ua.DeleteNodesItem{
+			{NodeID: pumpID, DeleteTargetReferences: false},
+			{NodeID: pumpID, DeleteTargetReferences: true},
+			{NodeID: pumpID, DeleteTargetReferences: true},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error deleting nodes"))
+		return
+	}
+	want = []ua.StatusCode{ua.BadNoDeleteRights, ua.Good, ua.BadNodeIDUnknown}
+	for i, r := range res3.Results {
+		if r != want[i] {
+			t.Errorf("Error deleting node %d. want: %s, got: %s", i, want[i], r)
+		}
+	}
+	if _, ok := nm.FindNode(speedID); ok {
+		t.Errorf("Error deleting node. Child %s was not deleted", speedID)
+	}
+	for _, r := range parent.References() {
+		if ua.ToNodeID(r.TargetID, nm.NamespaceUris()) == pumpID {
+			t.Errorf("Error deleting node. Reference to %s was not deleted", pumpID)
+		}
+	}
+}
+
+// TestDeleteNodesChildren tests deleting the children of a node that are part of a cycle, have another
+// parent, or may not be deleted by the user.
+func TestDeleteNodesChildren(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	deletable := []ua.RolePermissionType{
+		{RoleID: ua.ObjectIDWellKnownRoleAnonymous, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead},
+		{RoleID: ua.ObjectIDWellKnownRoleEngineer, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead | ua.PermissionTypeDeleteNode},
+	}
+	locked := []ua.RolePermissionType{
+		{RoleID: ua.ObjectIDWellKnownRoleAnonymous, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead},
+		{RoleID: ua.ObjectIDWellKnownRoleEngineer, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead},
+	}
+	newObject := func(name string, rolePermissions []ua.RolePermissionType, references ...ua.Reference) server.Node {
+		return server.NewObjectNode(
+			ua.ParseNodeID("ns=2;s=Test."+name),
+			ua.NewQualifiedName(2, name),
+			ua.NewLocalizedText(name, ""),
+			ua.NewLocalizedText("", ""),
+			rolePermissions,
+			append(references, ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.ObjectTypeIDBaseObjectType))),
+			0,
+		)
+	}
+	ref := func(referenceTypeID ua.NodeID, name string) ua.Reference {
+		return ua.NewReference(referenceTypeID, false, ua.NewExpandedNodeID(ua.ParseNodeID("ns=2;s=Test."+name)))
+	}
+	objects := ua.NewReference(ua.ReferenceTypeIDOrganizes, true, ua.NewExpandedNodeID(ua.ObjectIDObjectsFolder))
+	// Area -> Line -> Area is a cycle. Shared is a component of Line, and is organized by the Objects folder.
+	// Tank -> Valve, and the user may not delete the Valve.
+	nodes := []server.Node{
+		newObject("Shared", deletable, objects),
+		newObject("Line", deletable, ref(ua.ReferenceTypeIDHasComponent, "Shared")),
+		newObject("Area", deletable, objects, ref(ua.ReferenceTypeIDHasComponent, "Line")),
+		newObject("Valve", locked),
+		newObject("Tank", deletable, objects, ref(ua.ReferenceTypeIDHasComponent, "Valve")),
+	}
+	if err := nm.AddNodes(nodes...); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding nodes"))
+	}
+	line, _ := nm.FindNode(ua.ParseNodeID("ns=2;s=Test.Line"))
+	line.SetReferences(append(line.References(), ref(ua.ReferenceTypeIDHasComponent, "Area")))
+	defer func() {
+		for _, n := range nodes {
+			if _, ok := nm.FindNode(n.NodeID()); ok {
+				nm.DeleteNode(n, false)
+			}
+		}
+	}()
+
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening client"))
+	}
+	defer ch.Close(ctx)
+	res, err := ch.DeleteNodes(ctx, &ua.DeleteNodesRequest{
+		NodesToDelete: []ua.DeleteNodesItem{
+			{NodeID: ua.ParseNodeID("ns=2;s=Test.Area"), DeleteTargetReferences: true},
+			{NodeID: ua.ParseNodeID("ns=2;s=Test.Tank"), DeleteTargetReferences: true},
+		},
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error deleting nodes"))
+	}
+	want := []ua.StatusCode{ua.Good, ua.BadUserAccessDenied}
+	for i, r := range res.Results {
+		if r != want[i] {
+			t.Errorf("Error deleting node %d. want: %s, got: %s", i, want[i], r)
+		}
+	}
+	for name, exists := range map[string]bool{"Area": false, "Line": false, "Shared": true, "Tank": true, "Valve": true} {
+		if _, ok := nm.FindNode(ua.ParseNodeID("ns=2;s=Test." + name)); ok != exists {
+			t.Errorf("Error deleting nodes. %s exists: want: %t, got: %t", name, exists, ok)
+		}
+	}
+}
+
+func TestChangeTolerance(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	node := server.NewVariableNode(
+		ua.ParseNodeID("ns=2;s=Test.Temperature"),
+		ua.NewQualifiedName(2, "Temperature"),
+		ua.NewLocalizedText("Temperature", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+		},
+		ua.NewDataValue(float64(20), 0, time.Now(), 0, time.Now(), 0),
+		ua.DataTypeIDDouble,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentRead,
+		0,
+		false,
+		nil,
+	)
+	node.SetChangeTolerance(&server.ChangeTolerance{Absolute: 0.001})
+	if err := nm.AddNode(node); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(node, false)
+
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	res, err := ch.CreateSubscription(ctx, &ua.CreateSubscriptionRequest{
+		RequestedPublishingInterval: 2000.0,
+		RequestedMaxKeepAliveCount:  10,
+		RequestedLifetimeCount:      10 * 3,
+		PublishingEnabled:           true,
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating subscription"))
+		return
+	}
+	res1, err := ch.CreateMonitoredItems(ctx, &ua.CreateMonitoredItemsRequest{
+		SubscriptionID:     res.SubscriptionID,
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+		ItemsToCreate: []ua.MonitoredItemCreateRequest{
+			{
+				ItemToMonitor:  ua.ReadValueID{AttributeID: ua.AttributeIDValue, NodeID: node.NodeID()},
+				MonitoringMode: ua.MonitoringModeReporting,
+				RequestedParameters: ua.MonitoringParameters{
+					ClientHandle: 1, QueueSize: 10, DiscardOldest: true, SamplingInterval: 100.0,
+				},
+			},
+			{
+				ItemToMonitor:  ua.ReadValueID{AttributeID: ua.AttributeIDValue, NodeID: node.NodeID()},
+				MonitoringMode: ua.MonitoringModeReporting,
+				RequestedParameters: ua.MonitoringParameters{
+					ClientHandle: 2, QueueSize: 10, DiscardOldest: true, SamplingInterval: 100.0,
+					Filter: ua.DataChangeFilter{Trigger: ua.DataChangeTriggerStatusValue, DeadbandType: uint32(ua.DeadbandTypeAbsolute), DeadbandValue: 0},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating items"))
+		return
+	}
+	for i, r := range res1.Results {
+		if r.StatusCode != ua.Good {
+			t.Errorf("Error creating item %d. want: %s, got: %s", i, ua.Good, r.StatusCode)
+		}
+	}
+	// the jitter below 0.001 is not reported, unless the client requests a deadband.
+	for _, v := range []float64{20.0005, 20.0009, 20.01, 20.0105} {
+		time.Sleep(250 * time.Millisecond)
+		node.SetValue(ua.NewDataValue(v, 0, time.Now(), 0, time.Now(), 0))
+	}
+	res2, err := ch.Publish(ctx, &ua.PublishRequest{
+		RequestHeader:                ua.RequestHeader{TimeoutHint: 60000},
+		SubscriptionAcknowledgements: []ua.SubscriptionAcknowledgement{},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error publishing"))
+		return
+	}
+	values := map[uint32][]ua.Variant{}
+	for _, data := range res2.NotificationMessage.NotificationData {
+		if body, ok := data.(ua.DataChangeNotification); ok {
+			for _, z := range body.MonitoredItems {
+				values[z.ClientHandle] = append(values[z.ClientHandle], z.Value.Value)
+			}
+		}
+	}
+	if want := []ua.Variant{float64(20), float64(20.01)}; !reflect.DeepEqual(values[1], want) {
+		t.Errorf("Error publishing with change tolerance. want: %v, got: %v", want, values[1])
+	}
+	if want := []ua.Variant{float64(20), float64(20.0005), float64(20.0009), float64(20.01), float64(20.0105)}; !reflect.DeepEqual(values[2], want) {
+		t.Errorf("Error publishing with deadband. want: %v, got: %v", want, values[2])
+	}
+}
+
+func TestReadWriteOnly(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	node := server.NewVariableNode(
+		ua.ParseNodeID("ns=2;s=Test.Reset"),
+		ua.NewQualifiedName(2, "Reset"),
+		ua.NewLocalizedText("Reset", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+		},
+		ua.NewDataValue(false, 0, time.Now(), 0, time.Now(), 0),
+		ua.DataTypeIDBoolean,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentWrite,
+		0,
+		false,
+		nil,
+	)
+	if err := nm.AddNode(node); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(node, false)
+
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	res, err := ch.Write(ctx, &ua.WriteRequest{
+		NodesToWrite: []ua.WriteValue{
+			{NodeID: node.NodeID(), AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(true, 0, time.Time{}, 0, time.Time{}, 0)},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error writing"))
+		return
+	}
+	if res.Results[0] != ua.Good {
+		t.Errorf("Error writing write-only node. want: %s, got: %s", ua.Good, res.Results[0])
+	}
+	res2, err := ch.Read(ctx, &ua.ReadRequest{
+		NodesToRead: []ua.ReadValueID{
+			{NodeID: node.NodeID(), AttributeID: ua.AttributeIDValue},
+			{NodeID: node.NodeID(), AttributeID: ua.AttributeIDDisplayName},
+			{NodeID: node.NodeID(), AttributeID: ua.AttributeIDAccessLevel},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading"))
+		return
+	}
+	if sc := res2.Results[0].StatusCode; sc != ua.BadNotReadable || res2.Results[0].Value != nil {
+		t.Errorf("Error reading Value of write-only node. want: %s, got: %s %v", ua.BadNotReadable, sc, res2.Results[0].Value)
+	}
+	if sc := res2.Results[1].StatusCode; sc != ua.Good {
+		t.Errorf("Error reading DisplayName of write-only node. want: %s, got: %s", ua.Good, sc)
+	}
+	if v, ok := res2.Results[2].Value.(uint8); !ok || v != ua.AccessLevelsCurrentWrite {
+		t.Errorf("Error reading AccessLevel of write-only node. want: %d, got: %v", ua.AccessLevelsCurrentWrite, res2.Results[2].Value)
+	}
+	res3, err := ch.CreateSubscription(ctx, &ua.CreateSubscriptionRequest{
+		RequestedPublishingInterval: 1000.0,
+		RequestedMaxKeepAliveCount:  30,
+		RequestedLifetimeCount:      30 * 3,
+		PublishingEnabled:           true,
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating subscription"))
+		return
+	}
+	res4, err := ch.CreateMonitoredItems(ctx, &ua.CreateMonitoredItemsRequest{
+		SubscriptionID:     res3.SubscriptionID,
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+		ItemsToCreate: []ua.MonitoredItemCreateRequest{
+			{
+				ItemToMonitor:  ua.ReadValueID{AttributeID: ua.AttributeIDValue, NodeID: node.NodeID()},
+				MonitoringMode: ua.MonitoringModeReporting,
+				RequestedParameters: ua.MonitoringParameters{
+					ClientHandle: 1, QueueSize: 1, DiscardOldest: true, SamplingInterval: 500.0,
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating items"))
+		return
+	}
+	if sc := res4.Results[0].StatusCode; sc != ua.BadNotReadable {
+		t.Errorf("Error monitoring write-only node. want: %s, got: %s", ua.BadNotReadable, sc)
+	}
+}
+
+func TestMatrixValue(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	node := server.NewVariableNode(
+		ua.ParseNodeID("ns=2;s=Test.Grid"),
+		ua.NewQualifiedName(2, "Grid"),
+		ua.NewLocalizedText("Grid", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+		},
+		ua.NewDataValue(ua.Matrix{Elements: []float64{1, 2, 3, 4, 5, 6}, Dimensions: []int32{2, 3}}, 0, time.Now(), 0, time.Now(), 0),
+		ua.DataTypeIDDouble,
+		2,
+		[]uint32{2, 3},
+		ua.AccessLevelsCurrentRead|ua.AccessLevelsCurrentWrite,
+		0,
+		false,
+		nil,
+	)
+	if err := nm.AddNode(node); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(node, false)
+
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	res, err := ch.Read(ctx, &ua.ReadRequest{
+		NodesToRead: []ua.ReadValueID{
+			{NodeID: node.NodeID(), AttributeID: ua.AttributeIDValue},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading"))
+		return
+	}
+	if want := (ua.Matrix{Elements: []float64{1, 2, 3, 4, 5, 6}, Dimensions: []int32{2, 3}}); !reflect.DeepEqual(res.Results[0].Value, want) {
+		t.Errorf("Error reading matrix. want: %v, got: %v", want, res.Results[0].Value)
+	}
+	res2, err := ch.Write(ctx, &ua.WriteRequest{
+		NodesToWrite: []ua.WriteValue{
+			{NodeID: node.NodeID(), AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(ua.Matrix{Elements: []float64{6, 5, 4, 3, 2, 1}, Dimensions: []int32{2, 3}}, 0, time.Time{}, 0, time.Time{}, 0)},
+			{NodeID: node.NodeID(), AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(ua.Matrix{Elements: []float64{6, 5, 4, 3, 2, 1}, Dimensions: []int32{3, 2}}, 0, time.Time{}, 0, time.Time{}, 0)},
+			{NodeID: node.NodeID(), AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue([]float64{6, 5, 4, 3, 2, 1}, 0, time.Time{}, 0, time.Time{}, 0)},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error writing"))
+		return
+	}
+	want := []ua.StatusCode{ua.Good, ua.BadTypeMismatch, ua.BadTypeMismatch}
+	for i, r := range res2.Results {
+		if r != want[i] {
+			t.Errorf("Error writing matrix %d. want: %s, got: %s", i, want[i], r)
+		}
+	}
+	if want := (ua.Matrix{Elements: []float64{6, 5, 4, 3, 2, 1}, Dimensions: []int32{2, 3}}); !reflect.DeepEqual(node.Value().Value, want) {
+		t.Errorf("Error writing matrix. want: %v, got: %v", want, node.Value().Value)
+	}
+}
+
+func TestUpdateValue(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	node := server.NewVariableNode(
+		ua.ParseNodeID("ns=2;s=Test.OperationCount"),
+		ua.NewQualifiedName(2, "OperationCount"),
+		ua.NewLocalizedText("OperationCount", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+		},
+		ua.NewDataValue(uint32(0), 0, time.Now(), 0, time.Now(), 0),
+		ua.DataTypeIDUInt32,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentRead,
+		0,
+		false,
+		nil,
+	)
+	if err := nm.AddNode(node); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(node, false)
+
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+
+	// increment the counter from many goroutines while a client reads it.
+	increment := func(old ua.DataValue) ua.DataValue {
+		v, _ := old.Value.(uint32)
+		return ua.NewDataValue(v+1, 0, time.Now(), 0, time.Now(), 0)
+	}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				node.Update(increment)
+			}
+		}()
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := ch.Read(ctx, &ua.ReadRequest{NodesToRead: []ua.ReadValueID{{NodeID: node.NodeID(), AttributeID: ua.AttributeIDValue}}}); err != nil {
+			t.Error(errors.Wrap(err, "Error reading"))
+		}
+	}
+	wg.Wait()
+	res, err := ch.Read(ctx, &ua.ReadRequest{
+		NodesToRead: []ua.ReadValueID{
+			{NodeID: node.NodeID(), AttributeID: ua.AttributeIDValue},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading"))
+		return
+	}
+	if v, ok := res.Results[0].Value.(uint32); !ok || v != 1000 {
+		t.Errorf("Error updating value. want: %d, got: %v", 1000, res.Results[0].Value)
+	}
+}
+
+// eventCounter counts the events reported by an ObjectNode.
+type eventCounter struct {
+	count int32
+}
+
+func (c *eventCounter) OnEvent(evt ua.Event) {
+	atomic.AddInt32(&c.count, 1)
+}
+
+// TestEventPropagation tests reporting an event to the notifiers of the source.
+func TestEventPropagation(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	plantID := ua.ParseNodeID("ns=2;s=Test.Plant")
+	areaID := ua.ParseNodeID("ns=2;s=Test.Plant.Area")
+	pumpID := ua.ParseNodeID("ns=2;s=Test.Plant.Area.Pump")
+	plant := server.NewObjectNode(
+		plantID,
+		ua.NewQualifiedName(2, "Plant"),
+		ua.NewLocalizedText("Plant", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.ObjectTypeIDFolderType)),
+			ua.NewReference(ua.ReferenceTypeIDHasNotifier, true, ua.NewExpandedNodeID(ua.ObjectIDServer)),
+		},
+		ua.EventNotifierSubscribeToEvents,
+	)
+	area := server.NewObjectNode(
+		areaID,
+		ua.NewQualifiedName(2, "Area"),
+		ua.NewLocalizedText("Area", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.ObjectTypeIDFolderType)),
+			ua.NewReference(ua.ReferenceTypeIDOrganizes, true, ua.NewExpandedNodeID(plantID)),
+		},
+		ua.EventNotifierSubscribeToEvents,
+	)
+	// the pump is not a notifier, but a source of events for the area and the plant.
+	pump := server.NewObjectNode(
+		pumpID,
+		ua.NewQualifiedName(2, "Pump"),
+		ua.NewLocalizedText("Pump", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.ObjectTypeIDBaseObjectType)),
+			ua.NewReference(ua.ReferenceTypeIDHasEventSource, true, ua.NewExpandedNodeID(areaID)),
+			ua.NewReference(ua.ReferenceTypeIDHasEventSource, true, ua.NewExpandedNodeID(plantID)),
+		},
+		0,
+	)
+	if err := nm.AddNodes(plant, area, pump); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding nodes"))
+	}
+	defer nm.DeleteNodes([]server.Node{pump, area, plant}, false)
+	srvNode, _ := nm.FindObject(ua.ObjectIDServer)
+	counters := map[string]*eventCounter{}
+	for name, n := range map[string]*server.ObjectNode{"plant": plant, "area": area, "pump": pump, "server": srvNode} {
+		c := &eventCounter{}
+		n.AddEventListener(c)
+		defer n.RemoveEventListener(c)
+		counters[name] = c
+	}
+
+	if err := nm.OnEvent(pump, &ua.BaseEvent{
+		EventID:    ua.ByteString("pump"),
+		EventType:  ua.ObjectTypeIDBaseEventType,
+		SourceNode: pumpID,
+		Time:       time.Now(),
+		Severity:   500,
+	}); err != nil {
+		t.Fatal(errors.Wrap(err, "Error raising event"))
+	}
+	want := map[string]int32{"plant": 1, "area": 1, "pump": 0, "server": 1}
+	for name, c := range counters {
+		if got := atomic.LoadInt32(&c.count); got != want[name] {
+			t.Errorf("Error reporting event to %s. want: %d, got: %d", name, want[name], got)
+		}
+	}
+
+	// the node raises the event through its namespace manager.
+	if err := area.FireEvent(&ua.BaseEvent{
+		EventID:    ua.ByteString("area"),
+		EventType:  ua.ObjectTypeIDBaseEventType,
+		SourceNode: areaID,
+		Time:       time.Now(),
+		Severity:   500,
+	}); err != nil {
+		t.Fatal(errors.Wrap(err, "Error firing event"))
+	}
+	want = map[string]int32{"plant": 2, "area": 2, "pump": 0, "server": 2}
+	for name, c := range counters {
+		if got := atomic.LoadInt32(&c.count); got != want[name] {
+			t.Errorf("Error firing event to %s. want: %d, got: %d", name, want[name], got)
+		}
+	}
+	orphan := server.NewObjectNode(ua.ParseNodeID("ns=2;s=Test.Orphan"), ua.NewQualifiedName(2, "Orphan"), ua.NewLocalizedText("Orphan", ""), ua.NewLocalizedText("", ""), nil, nil, ua.EventNotifierSubscribeToEvents)
+	if err := orphan.FireEvent(&ua.BaseEvent{EventType: ua.ObjectTypeIDBaseEventType}); err != ua.BadNodeIDUnknown {
+		t.Errorf("Error firing event from node not in a namespace. want: %s, got: %v", ua.BadNodeIDUnknown, err)
+	}
+}
+
+// TestResponseTooLarge tests a response that exceeds the limits negotiated for the channel.
+func TestResponseTooLarge(t *testing.T) {
+	srv, err := server.New(
+		ua.ApplicationDescription{ApplicationURI: "urn:127.0.0.1:testserver", ApplicationName: ua.NewLocalizedText("testserver", "")},
+		"./pki/server.crt",
+		"./pki/server.key",
+		"opc.tcp://127.0.0.1:46025",
+		server.WithAnonymousIdentity(true),
+		server.WithInsecureSkipVerify(),
+		server.WithTransportLimits(8192, 8192, 32*1024, 4),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error constructing server"))
+		return
+	}
+	defer srv.Close()
+	go srv.ListenAndServe()
+	time.Sleep(500 * time.Millisecond)
+
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		"opc.tcp://127.0.0.1:46025",
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+
+	// the response needs more than the 4 chunks negotiated for the channel.
+	nodes := make([]ua.ReadValueID, 1000)
+	for i := range nodes {
+		nodes[i] = ua.ReadValueID{NodeID: ua.VariableIDServerNamespaceArray, AttributeID: ua.AttributeIDValue}
+	}
+	_, err = ch.Read(ctx, &ua.ReadRequest{NodesToRead: nodes})
+	if err != ua.BadResponseTooLarge {
+		t.Errorf("Error reading too many values. want: %s, got: %v", ua.BadResponseTooLarge, err)
+	}
+
+	// the channel remains open for smaller responses.
+	res, err := ch.Read(ctx, &ua.ReadRequest{NodesToRead: nodes[:2]})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading"))
+		return
+	}
+	if len(res.Results) != 2 || res.Results[0].StatusCode != ua.Good {
+		t.Errorf("Error reading NamespaceArray. got: %v", res.Results)
+	}
+}
+
+// TestEventWhereClause tests filtering events with the where clause of an EventFilter.
+func TestEventWhereClause(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	res, err := ch.CreateSubscription(ctx, &ua.CreateSubscriptionRequest{
+		RequestedPublishingInterval: 100.0,
+		RequestedMaxKeepAliveCount:  30,
+		RequestedLifetimeCount:      30 * 3,
+		PublishingEnabled:           true,
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating subscription"))
+		return
+	}
+	severity := ua.SimpleAttributeOperand{TypeDefinitionID: ua.ObjectTypeIDBaseEventType, BrowsePath: ua.ParseBrowsePath("Severity"), AttributeID: ua.AttributeIDValue}
+	// the SourceName is declared by the BaseEventType, a supertype of the SystemEventType.
+	sourceName := ua.SimpleAttributeOperand{TypeDefinitionID: ua.ObjectTypeIDSystemEventType, BrowsePath: ua.ParseBrowsePath("SourceName"), AttributeID: ua.AttributeIDValue}
+	res2, err := ch.CreateMonitoredItems(ctx, &ua.CreateMonitoredItemsRequest{
+		SubscriptionID:     res.SubscriptionID,
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+		ItemsToCreate: []ua.MonitoredItemCreateRequest{
+			{
+				ItemToMonitor:  ua.ReadValueID{AttributeID: ua.AttributeIDEventNotifier, NodeID: ua.ObjectIDServer},
+				MonitoringMode: ua.MonitoringModeReporting,
+				RequestedParameters: ua.MonitoringParameters{
+					ClientHandle: 42, QueueSize: 10, DiscardOldest: true,
+					Filter: ua.EventFilter{
+						SelectClauses: []ua.SimpleAttributeOperand{sourceName, severity},
+						// Severity >= 500 AND (SourceName LIKE 'Pump_' OR NOT OfType BaseEventType)
+						WhereClause: ua.ContentFilter{
+							Elements: []ua.ContentFilterElement{
+								{FilterOperator: ua.FilterOperatorAnd, FilterOperands: []ua.ExtensionObject{ua.ElementOperand{Index: 1}, ua.ElementOperand{Index: 2}}},
+								{FilterOperator: ua.FilterOperatorGreaterThanOrEqual, FilterOperands: []ua.ExtensionObject{severity, ua.LiteralOperand{Value: int32(500)}}},
+								{FilterOperator: ua.FilterOperatorOr, FilterOperands: []ua.ExtensionObject{ua.ElementOperand{Index: 3}, ua.ElementOperand{Index: 4}}},
+								{FilterOperator: ua.FilterOperatorLike, FilterOperands: []ua.ExtensionObject{sourceName, ua.LiteralOperand{Value: "Pump_"}}},
+								{FilterOperator: ua.FilterOperatorNot, FilterOperands: []ua.ExtensionObject{ua.ElementOperand{Index: 5}}},
+								{FilterOperator: ua.FilterOperatorOfType, FilterOperands: []ua.ExtensionObject{ua.LiteralOperand{Value: ua.ObjectTypeIDBaseEventType}}},
+							},
+						},
+					},
+				},
+			},
+			{
+				ItemToMonitor:  ua.ReadValueID{AttributeID: ua.AttributeIDEventNotifier, NodeID: ua.ObjectIDServer},
+				MonitoringMode: ua.MonitoringModeReporting,
+				RequestedParameters: ua.MonitoringParameters{
+					ClientHandle: 43, QueueSize: 10, DiscardOldest: true,
+					Filter: ua.EventFilter{
+						SelectClauses: []ua.SimpleAttributeOperand{severity},
+						WhereClause: ua.ContentFilter{
+							Elements: []ua.ContentFilterElement{
+								{FilterOperator: ua.FilterOperatorEquals, FilterOperands: []ua.ExtensionObject{severity}},
+								{FilterOperator: ua.FilterOperatorOfType, FilterOperands: []ua.ExtensionObject{ua.LiteralOperand{Value: "BaseEventType"}}},
+								{FilterOperator: ua.FilterOperatorCast, FilterOperands: []ua.ExtensionObject{severity, ua.LiteralOperand{Value: ua.DataTypeIDString}}},
+								{FilterOperator: ua.FilterOperatorAnd, FilterOperands: []ua.ExtensionObject{ua.ElementOperand{Index: 0}, ua.LiteralOperand{Value: true}}},
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating items"))
+		return
+	}
+	if res2.Results[0].StatusCode != ua.Good || res2.Results[0].FilterResult != nil {
+		t.Errorf("Error creating item. want: %s, got: %s, %v", ua.Good, res2.Results[0].StatusCode, res2.Results[0].FilterResult)
+	}
+	if res2.Results[1].StatusCode != ua.BadEventFilterInvalid {
+		t.Errorf("Error creating item. want: %s, got: %s", ua.BadEventFilterInvalid, res2.Results[1].StatusCode)
+	}
+	result, ok := res2.Results[1].FilterResult.(ua.EventFilterResult)
+	if !ok || len(result.WhereClauseResult.ElementResults) != 4 {
+		t.Fatalf("Error creating item. want: EventFilterResult, got: %v", res2.Results[1].FilterResult)
+	}
+	want := []ua.StatusCode{ua.BadFilterOperandCountMismatch, ua.BadFilterOperandInvalid, ua.BadFilterOperatorUnsupported, ua.BadFilterOperandInvalid}
+	for i, r := range result.WhereClauseResult.ElementResults {
+		if r.StatusCode != want[i] {
+			t.Errorf("Error checking element %d. want: %s, got: %s", i, want[i], r.StatusCode)
+		}
+	}
+	if codes := result.WhereClauseResult.ElementResults[3].OperandStatusCodes; len(codes) != 2 || codes[0] != ua.BadFilterOperandInvalid || codes[1] != ua.Good {
+		t.Errorf("Error checking operands of element 3. got: %v", codes)
+	}
+
+	nm := testServer.NamespaceManager()
+	srvNode, _ := nm.FindObject(ua.ObjectIDServer)
+	events := []struct {
+		name     string
+		severity uint16
+	}{
+		{"Pump1", 600},
+		{"Pump1", 100},
+		{"Valve", 900},
+		{"Pump12", 700},
+		{"Pump2", 500},
+	}
+	for i, e := range events {
+		nm.OnEvent(srvNode, &ua.BaseEvent{
+			EventID:    ua.ByteString(fmt.Sprintf("where-%d", i)),
+			EventType:  ua.ObjectTypeIDSystemEventType,
+			SourceNode: ua.ObjectIDServer,
+			SourceName: e.name,
+			Time:       time.Now(),
+			Severity:   e.severity,
+		})
+	}
+	got := []string{}
+	for i := 0; i < 3 && len(got) < 2; i++ {
+		res3, err := ch.Publish(ctx, &ua.PublishRequest{RequestHeader: ua.RequestHeader{TimeoutHint: 60000}})
+		if err != nil {
+			t.Error(errors.Wrap(err, "Error publishing"))
+			return
+		}
+		for _, data := range res3.NotificationMessage.NotificationData {
+			if body, ok := data.(ua.EventNotificationList); ok {
+				for _, e := range body.Events {
+					if e.ClientHandle == 42 {
+						got = append(got, fmt.Sprintf("%v:%v", e.EventFields[0], e.EventFields[1]))
+					}
+				}
+			}
+		}
+	}
+	if !reflect.DeepEqual(got, []string{"Pump1:600", "Pump2:500"}) {
+		t.Errorf("Error filtering events. want: [Pump1:600 Pump2:500], got: %v", got)
+	}
+}
+
+// TestHistoryReadRaw tests reading the raw history of a node from the historian of the server.
+func TestHistoryReadRaw(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	newNode := func(name string, rolePermissions []ua.RolePermissionType, historian server.HistoryReadWriter) *server.VariableNode {
+		return server.NewVariableNode(
+			ua.ParseNodeID("ns=2;s=Test.History."+name),
+			ua.NewQualifiedName(2, name),
+			ua.NewLocalizedText(name, ""),
+			ua.NewLocalizedText("", ""),
+			rolePermissions,
+			[]ua.Reference{
+				{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+			},
+			ua.DataValue{},
+			ua.DataTypeIDDouble,
+			ua.ValueRankScalar,
+			[]uint32{},
+			ua.AccessLevelsCurrentRead|ua.AccessLevelsHistoryRead,
+			0,
+			historian != nil,
+			historian,
+		)
+	}
+	node := newNode("Raw", nil, testServer.Historian())
+	current := newNode("Current", nil, nil)
+	denied := newNode("Denied", []ua.RolePermissionType{
+		{RoleID: ua.ObjectIDWellKnownRoleEngineer, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead},
+	}, testServer.Historian())
+	if err := nm.AddNodes(node, current, denied); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding nodes"))
+	}
+	defer nm.DeleteNodes([]server.Node{node, current, denied}, false)
+	start := time.Now().Add(-time.Minute).Truncate(time.Second)
+	for i := 0; i < 6; i++ {
+		ts := start.Add(time.Duration(i) * time.Second)
+		node.SetValue(ua.NewDataValue(float64(i), 0, ts, 0, ts, 0))
+	}
+
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+
+	// read the values between 1s and 5s, three at a time.
+	got := []ua.Variant{}
+	var cp ua.ByteString
+	for i := 0; i < 3; i++ {
+		res, err := ch.HistoryRead(ctx, &ua.HistoryReadRequest{
+			HistoryReadDetails: ua.ReadRawModifiedDetails{
+				StartTime:        start.Add(1 * time.Second),
+				EndTime:          start.Add(5 * time.Second),
+				NumValuesPerNode: 3,
+			},
+			TimestampsToReturn: ua.TimestampsToReturnBoth,
+			NodesToRead: []ua.HistoryReadValueID{
+				{NodeID: node.NodeID(), ContinuationPoint: cp},
+				{NodeID: current.NodeID()},
+				{NodeID: denied.NodeID()},
+				{NodeID: ua.ParseNodeID("ns=2;s=Test.History.Unknown")},
+				{NodeID: ua.ObjectIDServer},
+			},
+		})
+		if err != nil {
+			t.Error(errors.Wrap(err, "Error reading history"))
+			return
+		}
+		want := []ua.StatusCode{ua.Good, ua.BadHistoryOperationUnsupported, ua.BadUserAccessDenied, ua.BadNodeIDUnknown, ua.BadHistoryOperationUnsupported}
+		for j := range want {
+			if res.Results[j].StatusCode != want[j] {
+				t.Errorf("Error reading history of node %d. want: %s, got: %s", j, want[j], res.Results[j].StatusCode)
+			}
+		}
+		if data, ok := res.Results[0].HistoryData.(ua.HistoryData); ok {
+			for _, v := range data.DataValues {
+				got = append(got, v.Value)
+			}
+		}
+		cp = res.Results[0].ContinuationPoint
+		if cp == "" {
+			break
+		}
+	}
+	if !reflect.DeepEqual(got, []ua.Variant{1.0, 2.0, 3.0, 4.0}) {
+		t.Errorf("Error reading raw history. want: [1 2 3 4], got: %v", got)
+	}
+
+	// read the values with the bounds, before the first value and after the last value.
+	res, err := ch.HistoryRead(ctx, &ua.HistoryReadRequest{
+		HistoryReadDetails: ua.ReadRawModifiedDetails{
+			StartTime:    start.Add(1500 * time.Millisecond),
+			EndTime:      start.Add(10 * time.Second),
+			ReturnBounds: true,
+		},
+		TimestampsToReturn: ua.TimestampsToReturnSource,
+		NodesToRead:        []ua.HistoryReadValueID{{NodeID: node.NodeID()}},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading history"))
+		return
+	}
+	data, _ := res.Results[0].HistoryData.(ua.HistoryData)
+	if n := len(data.DataValues); n != 6 {
+		t.Fatalf("Error reading history with bounds. want: 6 values, got: %d", n)
+	}
+	if v := data.DataValues[0]; v.Value != 1.0 {
+		t.Errorf("Error reading start bound. want: 1, got: %v", v.Value)
+	}
+	if v := data.DataValues[5]; v.StatusCode != ua.BadBoundNotFound || !v.SourceTimestamp.Equal(start.Add(10*time.Second)) {
+		t.Errorf("Error reading end bound. want: %s, got: %s %s", ua.BadBoundNotFound, v.StatusCode, v.SourceTimestamp)
+	}
+}
+
+// TestSamplingFunction tests computing the value of a node for monitored items at sample time.
+func TestSamplingFunction(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	id := ua.ParseNodeID("ns=2;s=Test.SamplingFunction")
+	node := server.NewVariableNode(
+		id,
+		ua.NewQualifiedName(2, "SamplingFunction"),
+		ua.NewLocalizedText("SamplingFunction", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+		},
+		ua.NewDataValue(float64(-1), 0, time.Now(), 0, time.Now(), 0),
+		ua.DataTypeIDDouble,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentRead,
+		0,
+		false,
+		nil,
+	)
+	var calls int32
+	node.SetSamplingFunction(func(ctx context.Context) ua.DataValue {
+		return ua.GoodDataValue(float64(atomic.AddInt32(&calls, 1)))
+	})
+	if err := nm.AddNode(node); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(node, false)
+
+	ctx := context.Background()
+	ch, err := client.Dial(ctx, endpointURL, client.WithInsecureSkipVerify())
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	res, err := ch.CreateSubscription(ctx, &ua.CreateSubscriptionRequest{
+		RequestedPublishingInterval: 500.0,
+		RequestedMaxKeepAliveCount:  30,
+		RequestedLifetimeCount:      30 * 3,
+		PublishingEnabled:           true,
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating subscription"))
+		return
+	}
+	items := make([]ua.MonitoredItemCreateRequest, 2)
+	for i := range items {
+		items[i] = ua.MonitoredItemCreateRequest{
+			ItemToMonitor:  ua.ReadValueID{AttributeID: ua.AttributeIDValue, NodeID: id},
+			MonitoringMode: ua.MonitoringModeReporting,
+			RequestedParameters: ua.MonitoringParameters{
+				ClientHandle: uint32(i), QueueSize: 100, DiscardOldest: true, SamplingInterval: 100.0,
+			},
+		}
+	}
+	_, err = ch.CreateMonitoredItems(ctx, &ua.CreateMonitoredItemsRequest{
+		SubscriptionID:     res.SubscriptionID,
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+		ItemsToCreate:      items,
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating items"))
+		return
+	}
+	samples := [2][]ua.Variant{}
+	for i := 0; i < 3; i++ {
+		res2, err := ch.Publish(ctx, &ua.PublishRequest{RequestHeader: ua.RequestHeader{TimeoutHint: 60000}})
+		if err != nil {
+			t.Error(errors.Wrap(err, "Error publishing"))
+			return
+		}
+		for _, data := range res2.NotificationMessage.NotificationData {
+			if body, ok := data.(ua.DataChangeNotification); ok {
+				for _, z := range body.MonitoredItems {
+					samples[z.ClientHandle] = append(samples[z.ClientHandle], z.Value.Value)
+				}
+			}
+		}
+	}
+	// both items report the same computed values, since the function is called once per tick.
+	if len(samples[0]) < 5 || samples[0][0] == -1.0 {
+		t.Errorf("Error sampling. want: at least 5 computed values, got: %v", samples[0])
+	}
+	n := len(samples[0])
+	if len(samples[1]) < n {
+		n = len(samples[1])
+	}
+	common := 0
+	for _, a := range samples[0][:n] {
+		for _, b := range samples[1][:n] {
+			if a == b {
+				common++
+				break
+			}
+		}
+	}
+	if common < n-2 {
+		t.Errorf("Error sharing samples. got: %v and %v", samples[0], samples[1])
+	}
+
+	// the Read service returns the stored value.
+	res3, err := ch.Read(ctx, &ua.ReadRequest{NodesToRead: []ua.ReadValueID{{NodeID: id, AttributeID: ua.AttributeIDValue}}})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading"))
+		return
+	}
+	if res3.Results[0].Value != -1.0 {
+		t.Errorf("Error reading. want: -1, got: %v", res3.Results[0].Value)
+	}
+}
+
+// TestHistoryUpdate tests inserting, replacing and deleting the history of a node.
+func TestHistoryUpdate(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	historyWrite := ua.PermissionTypeInsertHistory | ua.PermissionTypeModifyHistory | ua.PermissionTypeDeleteHistory
+	newNode := func(name string, accessLevel byte, historizing bool, permissions ua.PermissionType) *server.VariableNode {
+		return server.NewVariableNode(
+			ua.ParseNodeID("ns=2;s=Test.HistoryUpdate."+name),
+			ua.NewQualifiedName(2, name),
+			ua.NewLocalizedText(name, ""),
+			ua.NewLocalizedText("", ""),
+			[]ua.RolePermissionType{
+				{RoleID: ua.ObjectIDWellKnownRoleEngineer, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead | ua.PermissionTypeReadHistory | permissions},
+				{RoleID: ua.ObjectIDWellKnownRoleAnonymous, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead | ua.PermissionTypeReadHistory},
+			},
+			[]ua.Reference{
+				{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+			},
+			ua.DataValue{},
+			ua.DataTypeIDDouble,
+			ua.ValueRankScalar,
+			[]uint32{},
+			accessLevel,
+			0,
+			historizing,
+			testServer.Historian(),
+		)
+	}
+	node := newNode("Lab", ua.AccessLevelsCurrentRead|ua.AccessLevelsHistoryRead|ua.AccessLevelsHistoryWrite, true, historyWrite)
+	readOnly := newNode("ReadOnly", ua.AccessLevelsCurrentRead|ua.AccessLevelsHistoryRead, true, historyWrite)
+	current := newNode("Current", ua.AccessLevelsCurrentRead|ua.AccessLevelsHistoryWrite, false, historyWrite)
+	insertOnly := newNode("InsertOnly", ua.AccessLevelsCurrentRead|ua.AccessLevelsHistoryRead|ua.AccessLevelsHistoryWrite, true, ua.PermissionTypeInsertHistory)
+	if err := nm.AddNodes(node, readOnly, current, insertOnly); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding nodes"))
+	}
+	defer nm.DeleteNodes([]server.Node{node, readOnly, current, insertOnly}, false)
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	at := func(i int) time.Time { return start.Add(time.Duration(i) * time.Minute) }
+	for i := 0; i < 3; i++ {
+		node.SetValue(ua.NewDataValue(float64(i), 0, at(i), 0, at(i), 0))
+	}
+
+	read := func(ch *client.Client) []ua.Variant {
+		res, err := ch.HistoryRead(context.Background(), &ua.HistoryReadRequest{
+			HistoryReadDetails: ua.ReadRawModifiedDetails{StartTime: start, EndTime: at(10)},
+			TimestampsToReturn: ua.TimestampsToReturnSource,
+			NodesToRead:        []ua.HistoryReadValueID{{NodeID: node.NodeID()}},
+		})
+		if err != nil {
+			t.Error(errors.Wrap(err, "Error reading history"))
+			return nil
+		}
+		values := []ua.Variant{}
+		if data, ok := res.Results[0].HistoryData.(ua.HistoryData); ok {
+			for _, v := range data.DataValues {
+				values = append(values, v.Value)
+			}
+		}
+		return values
+	}
+
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	res, err := ch.HistoryUpdate(ctx, &ua.HistoryUpdateRequest{
+		HistoryUpdateDetails: []ua.ExtensionObject{
+			ua.UpdateDataDetails{
+				NodeID:               node.NodeID(),
+				PerformInsertReplace: ua.PerformUpdateTypeInsert,
+				UpdateValues: []ua.DataValue{
+					ua.NewDataValue(1.5, 0, at(1), 0, time.Time{}, 0),
+					ua.NewDataValue(10.0, 0, at(1).Add(30*time.Second), 0, time.Time{}, 0),
+					ua.NewDataValue(11.0, 0, time.Time{}, 0, time.Time{}, 0),
+				},
+			},
+			ua.UpdateDataDetails{
+				NodeID:               node.NodeID(),
+				PerformInsertReplace: ua.PerformUpdateTypeReplace,
+				UpdateValues: []ua.DataValue{
+					ua.NewDataValue(20.0, 0, at(2), 0, time.Time{}, 0),
+					ua.NewDataValue(21.0, 0, at(5), 0, time.Time{}, 0),
+				},
+			},
+			ua.UpdateDataDetails{
+				NodeID:               node.NodeID(),
+				PerformInsertReplace: ua.PerformUpdateTypeUpdate,
+				UpdateValues: []ua.DataValue{
+					ua.NewDataValue(30.0, 0, at(0), 0, time.Time{}, 0),
+					ua.NewDataValue(33.0, 0, at(3), 0, time.Time{}, 0),
+				},
+			},
+			ua.UpdateDataDetails{NodeID: readOnly.NodeID(), PerformInsertReplace: ua.PerformUpdateTypeInsert},
+			ua.UpdateDataDetails{NodeID: current.NodeID(), PerformInsertReplace: ua.PerformUpdateTypeInsert},
+			ua.DeleteAtTimeDetails{NodeID: node.NodeID()},
+			// an update requires both the InsertHistory and the ModifyHistory permission.
+			ua.UpdateDataDetails{NodeID: insertOnly.NodeID(), PerformInsertReplace: ua.PerformUpdateTypeUpdate},
+			ua.UpdateDataDetails{NodeID: insertOnly.NodeID(), PerformInsertReplace: ua.PerformUpdateTypeInsert},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error updating history"))
+		return
+	}
+	want := []struct {
+		status     ua.StatusCode
+		operations []ua.StatusCode
+	}{
+		{ua.Good, []ua.StatusCode{ua.BadEntryExists, ua.GoodEntryInserted, ua.BadInvalidTimestamp}},
+		{ua.Good, []ua.StatusCode{ua.GoodEntryReplaced, ua.BadNoEntryExists}},
+		{ua.Good, []ua.StatusCode{ua.GoodEntryReplaced, ua.GoodEntryInserted}},
+		{ua.BadNotWritable, nil},
+		{ua.BadHistoryOperationUnsupported, nil},
+		{ua.BadHistoryOperationUnsupported, nil},
+		{ua.BadUserAccessDenied, nil},
+		{ua.Good, nil},
+	}
+	for i, w := range want {
+		r := res.Results[i]
+		if r.StatusCode != w.status || !reflect.DeepEqual(r.OperationResults, w.operations) {
+			t.Errorf("Error updating history %d. want: %s %v, got: %s %v", i, w.status, w.operations, r.StatusCode, r.OperationResults)
+		}
+	}
+	if got := read(ch); !reflect.DeepEqual(got, []ua.Variant{30.0, 1.0, 10.0, 20.0, 33.0}) {
+		t.Errorf("Error reading updated history. want: [30 1 10 20 33], got: %v", got)
+	}
+
+	// delete the values from 1m (inclusive) to 3m (exclusive).
+	res, err = ch.HistoryUpdate(ctx, &ua.HistoryUpdateRequest{
+		HistoryUpdateDetails: []ua.ExtensionObject{
+			ua.DeleteRawModifiedDetails{NodeID: node.NodeID(), StartTime: at(1), EndTime: at(3)},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error deleting history"))
+		return
+	}
+	if res.Results[0].StatusCode != ua.Good {
+		t.Errorf("Error deleting history. want: %s, got: %s", ua.Good, res.Results[0].StatusCode)
+	}
+	if got := read(ch); !reflect.DeepEqual(got, []ua.Variant{30.0, 33.0}) {
+		t.Errorf("Error reading history after delete. want: [30 33], got: %v", got)
+	}
+
+	// an anonymous user may read, but not update the history.
+	ch2, err := client.Dial(ctx, endpointURL, client.WithInsecureSkipVerify())
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch2.Close(ctx)
+	res, err = ch2.HistoryUpdate(ctx, &ua.HistoryUpdateRequest{
+		HistoryUpdateDetails: []ua.ExtensionObject{
+			ua.DeleteRawModifiedDetails{NodeID: node.NodeID(), StartTime: start, EndTime: at(10)},
+		},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error deleting history"))
+		return
+	}
+	if res.Results[0].StatusCode != ua.BadUserAccessDenied {
+		t.Errorf("Error deleting history. want: %s, got: %s", ua.BadUserAccessDenied, res.Results[0].StatusCode)
+	}
+	if got := read(ch2); len(got) != 2 {
+		t.Errorf("Error reading history. want: 2 values, got: %v", got)
+	}
+
+	// the history of a node without the HistoryRead bit of its AccessLevel is not readable.
+	res2, err := ch.HistoryRead(ctx, &ua.HistoryReadRequest{
+		HistoryReadDetails: ua.ReadRawModifiedDetails{StartTime: start, EndTime: at(10)},
+		TimestampsToReturn: ua.TimestampsToReturnSource,
+		NodesToRead:        []ua.HistoryReadValueID{{NodeID: current.NodeID()}},
+	})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error reading history"))
+		return
+	}
+	if res2.Results[0].StatusCode != ua.BadNotReadable {
+		t.Errorf("Error reading history. want: %s, got: %s", ua.BadNotReadable, res2.Results[0].StatusCode)
+	}
+}
+
+// TestMethodExecutable tests that the Call service rejects methods that are not executable for the session.
+func TestMethodExecutable(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	objectID := ua.ParseNodeID("ns=2;s=Demo.Methods")
+	methodID := ua.ParseNodeID("ns=2;s=Test.Start")
+	method := server.NewMethodNode(
+		methodID,
+		ua.NewQualifiedName(2, "Start"),
+		ua.NewLocalizedText("Start", ""),
+		ua.NewLocalizedText("", ""),
+		[]ua.RolePermissionType{
+			{RoleID: ua.ObjectIDWellKnownRoleAnonymous, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead},
+			{RoleID: ua.ObjectIDWellKnownRoleEngineer, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead | ua.PermissionTypeCall},
+		},
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasComponent, IsInverse: true, TargetID: ua.NewExpandedNodeID(objectID)},
+		},
+		true,
+	)
+	method.SetCallMethodHandler(func(ctx context.Context, req ua.CallMethodRequest) ua.CallMethodResult {
+		return ua.CallMethodResult{}
+	})
+	if err := nm.AddNode(method); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(method, false)
+
+	ctx := context.Background()
+	call := func(ch *client.Client) (bool, bool, ua.StatusCode, error) {
+		res, err := ch.Read(ctx, &ua.ReadRequest{
+			NodesToRead: []ua.ReadValueID{
+				{NodeID: methodID, AttributeID: ua.AttributeIDExecutable},
+				{NodeID: methodID, AttributeID: ua.AttributeIDUserExecutable},
+			},
+		})
+		if err != nil {
+			return false, false, 0, err
+		}
+		executable, _ := res.Results[0].Value.(bool)
+		userExecutable, _ := res.Results[1].Value.(bool)
+		res2, err := ch.Call(ctx, &ua.CallRequest{
+			MethodsToCall: []ua.CallMethodRequest{{ObjectID: objectID, MethodID: methodID}},
+		})
+		if err != nil {
+			return false, false, 0, err
+		}
+		return executable, userExecutable, res2.Results[0].StatusCode, nil
+	}
+
+	anonymous, err := client.Dial(ctx, endpointURL, client.WithInsecureSkipVerify())
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening client"))
+	}
+	defer anonymous.Close(ctx)
+	engineer, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening client"))
+	}
+	defer engineer.Close(ctx)
+
+	// the anonymous role lacks the Call permission.
+	if e, ue, sc, err := call(anonymous); err != nil || !e || ue || sc != ua.BadNotExecutable {
+		t.Errorf("Error calling method as anonymous. want: true, false, %s, got: %t, %t, %s, %v", ua.BadNotExecutable, e, ue, sc, err)
+	}
+	if e, ue, sc, err := call(engineer); err != nil || !e || !ue || sc != ua.Good {
+		t.Errorf("Error calling method as engineer. want: true, true, %s, got: %t, %t, %s, %v", ua.Good, e, ue, sc, err)
+	}
+
+	// a method disabled by the application is not executable for any role.
+	method.SetExecutable(false)
+	if e, ue, sc, err := call(engineer); err != nil || e || ue || sc != ua.BadNotExecutable {
+		t.Errorf("Error calling disabled method as engineer. want: false, false, %s, got: %t, %t, %s, %v", ua.BadNotExecutable, e, ue, sc, err)
+	}
+}
+
+// TestSecurityLevel tests that clients select the endpoint with the highest configured SecurityLevel.
+func TestSecurityLevel(t *testing.T) {
+	url := "opc.tcp://127.0.0.1:46026"
+	srv, err := server.New(
+		ua.ApplicationDescription{ApplicationURI: "urn:127.0.0.1:testserver", ApplicationName: ua.NewLocalizedText("testserver", "")},
+		"./pki/server.crt",
+		"./pki/server.key",
+		url,
+		server.WithAnonymousIdentity(true),
+		server.WithSecurityPolicyNone(true),
+		server.WithInsecureSkipVerify(),
+		server.WithSecurityLevel(ua.SecurityPolicyURIBasic256Sha256, 100),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error constructing server"))
+		return
+	}
+	defer srv.Close()
+	go srv.ListenAndServe()
+	time.Sleep(500 * time.Millisecond)
+
+	ctx := context.Background()
+	res, err := client.GetEndpoints(ctx, &ua.GetEndpointsRequest{EndpointURL: url})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error getting endpoints"))
+		return
+	}
+	want := map[string]byte{
+		ua.SecurityPolicyURINone:                0,
+		ua.SecurityPolicyURIBasic256Sha256:      100,
+		ua.SecurityPolicyURIAes128Sha256RsaOaep: 2,
+		ua.SecurityPolicyURIAes256Sha256RsaPss:  3,
+	}
+	for _, e := range res.Endpoints {
+		if e.SecurityLevel != want[e.SecurityPolicyURI] {
+			t.Errorf("Error getting SecurityLevel of %s. want: %d, got: %d", e.SecurityPolicyURI, want[e.SecurityPolicyURI], e.SecurityLevel)
+		}
+	}
+
+	ch, err := client.Dial(
+		ctx,
+		url,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer ch.Close(ctx)
+	if uri := ch.SecurityPolicyURI(); uri != ua.SecurityPolicyURIBasic256Sha256 {
+		t.Errorf("Error selecting endpoint. want: %s, got: %s", ua.SecurityPolicyURIBasic256Sha256, uri)
+	}
+}
+
+// TestBrowseContinuationPoints tests paging the references of a node with Browse and BrowseNext.
+func TestBrowseContinuationPoints(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	ctx := context.Background()
+	ch, err := client.Dial(ctx, endpointURL, client.WithInsecureSkipVerify())
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening client"))
+	}
+	defer ch.Close(ctx)
+	desc := ua.BrowseDescription{
+		NodeID:          ua.ObjectIDServer,
+		BrowseDirection: ua.BrowseDirectionForward,
+		ReferenceTypeID: ua.ReferenceTypeIDHierarchicalReferences,
+		IncludeSubtypes: true,
+		ResultMask:      uint32(ua.BrowseResultMaskAll),
+	}
+	res, err := ch.Browse(ctx, &ua.BrowseRequest{NodesToBrowse: []ua.BrowseDescription{desc}})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error browsing"))
+	}
+	want := res.Results[0].References
+	if len(want) < 5 {
+		t.Fatalf("Error browsing. want more than 5 references, got: %d", len(want))
+	}
+
+	// page through the references, three at a time.
+	res, err = ch.Browse(ctx, &ua.BrowseRequest{NodesToBrowse: []ua.BrowseDescription{desc}, RequestedMaxReferencesPerNode: 3})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error browsing"))
+	}
+	got := res.Results[0].References
+	cp := res.Results[0].ContinuationPoint
+	for cp != "" {
+		if n := len(res.Results[0].References); n != 3 {
+			t.Errorf("Error browsing. want: 3 references, got: %d", n)
+		}
+		res2, err := ch.BrowseNext(ctx, &ua.BrowseNextRequest{ContinuationPoints: []ua.ByteString{cp}})
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "Error browsing next"))
+		}
+		got = append(got, res2.Results[0].References...)
+		cp = res2.Results[0].ContinuationPoint
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Error browsing next. want: %d references, got: %d", len(want), len(got))
+	}
+
+	// a released continuation point may not be used again.
+	res, err = ch.Browse(ctx, &ua.BrowseRequest{NodesToBrowse: []ua.BrowseDescription{desc}, RequestedMaxReferencesPerNode: 1})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error browsing"))
+	}
+	cp = res.Results[0].ContinuationPoint
+	res2, err := ch.BrowseNext(ctx, &ua.BrowseNextRequest{ContinuationPoints: []ua.ByteString{cp}, ReleaseContinuationPoints: true})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error releasing"))
+	}
+	if sc := res2.Results[0].StatusCode; sc != ua.Good || len(res2.Results[0].References) != 0 {
+		t.Errorf("Error releasing. want: %s, got: %s", ua.Good, sc)
+	}
+	res2, err = ch.BrowseNext(ctx, &ua.BrowseNextRequest{ContinuationPoints: []ua.ByteString{cp, "\x01"}})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error browsing next"))
+	}
+	for i, r := range res2.Results {
+		if r.StatusCode != ua.BadContinuationPointInvalid {
+			t.Errorf("Error browsing next %d. want: %s, got: %s", i, ua.BadContinuationPointInvalid, r.StatusCode)
+		}
+	}
+
+	// the session holds at most MaxBrowseContinuationPoints.
+	max := int(testServer.ServerCapabilities().MaxBrowseContinuationPoints)
+	descs := make([]ua.BrowseDescription, max+1)
+	for i := range descs {
+		descs[i] = desc
+	}
+	res, err = ch.Browse(ctx, &ua.BrowseRequest{NodesToBrowse: descs, RequestedMaxReferencesPerNode: 1})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error browsing"))
+	}
+	cps := []ua.ByteString{}
+	failed := 0
+	for _, r := range res.Results {
+		switch r.StatusCode {
+		case ua.Good:
+			cps = append(cps, r.ContinuationPoint)
+		case ua.BadNoContinuationPoints:
+			failed++
+		default:
+			t.Errorf("Error browsing. want: %s or %s, got: %s", ua.Good, ua.BadNoContinuationPoints, r.StatusCode)
+		}
+	}
+	if len(cps) != max || failed != 1 {
+		t.Errorf("Error browsing. want: %d continuation points and 1 failure, got: %d and %d", max, len(cps), failed)
+	}
+	if _, err := ch.BrowseNext(ctx, &ua.BrowseNextRequest{ContinuationPoints: cps, ReleaseContinuationPoints: true}); err != nil {
+		t.Error(errors.Wrap(err, "Error releasing"))
+	}
+}
+
+// TestConditionRefresh tests that ConditionRefresh reports the retained conditions of a notifier.
+func TestConditionRefresh(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	alarmsID := ua.ParseNodeID("ns=2;s=Test.Alarms")
+	alarms := server.NewObjectNode(
+		alarmsID,
+		ua.NewQualifiedName(2, "Alarms"),
+		ua.NewLocalizedText("Alarms", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.ObjectTypeIDFolderType)),
+			ua.NewReference(ua.ReferenceTypeIDHasNotifier, true, ua.NewExpandedNodeID(ua.ObjectIDServer)),
+		},
+		ua.EventNotifierSubscribeToEvents,
+	)
+	if err := nm.AddNode(alarms); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(alarms, false)
+	raise := func(name string, retain bool) {
+		nm.OnEvent(alarms, &ua.AlarmCondition{
+			EventID:       ua.ByteString(fmt.Sprintf("%s-%t", name, retain)),
+			EventType:     ua.ObjectTypeIDAlarmConditionType,
+			SourceNode:    alarmsID,
+			SourceName:    "Alarms",
+			Time:          time.Now(),
+			Severity:      500,
+			ConditionID:   ua.ParseNodeID("ns=2;s=Test.Alarms." + name),
+			ConditionName: name,
+			Retain:        retain,
+			ActiveState:   retain,
+		})
+	}
+	// the high level alarm is cleared before the client connects.
+	raise("HighLevel", true)
+	raise("LowFlow", true)
+	raise("Overheat", true)
+	raise("HighLevel", false)
+	defer raise("LowFlow", false)
+	defer raise("Overheat", false)
+
+	ctx := context.Background()
+	ch, err := client.Dial(ctx, endpointURL, client.WithInsecureSkipVerify())
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening client"))
+	}
+	defer ch.Close(ctx)
+	res, err := ch.CreateSubscription(ctx, &ua.CreateSubscriptionRequest{
+		RequestedPublishingInterval: 100.0,
+		RequestedMaxKeepAliveCount:  30,
+		RequestedLifetimeCount:      30 * 3,
+		PublishingEnabled:           true,
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error creating subscription"))
+	}
+	res2, err := ch.CreateMonitoredItems(ctx, &ua.CreateMonitoredItemsRequest{
+		SubscriptionID:     res.SubscriptionID,
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+		ItemsToCreate: []ua.MonitoredItemCreateRequest{
+			{
+				ItemToMonitor:  ua.ReadValueID{AttributeID: ua.AttributeIDEventNotifier, NodeID: alarmsID},
+				MonitoringMode: ua.MonitoringModeReporting,
+				RequestedParameters: ua.MonitoringParameters{
+					ClientHandle: 42, QueueSize: 10, DiscardOldest: true,
+					Filter: ua.EventFilter{
+						SelectClauses: []ua.SimpleAttributeOperand{ua.ConditionSelectClauses[1], ua.ConditionSelectClauses[9]},
+					},
+				},
+			},
+		},
+	})
+	if err != nil || res2.Results[0].StatusCode != ua.Good {
+		t.Fatal(errors.Wrap(err, "Error creating item"))
+	}
+	res3, err := ch.Call(ctx, &ua.CallRequest{
+		MethodsToCall: []ua.CallMethodRequest{
+			{ObjectID: ua.ObjectTypeIDConditionType, MethodID: ua.MethodIDConditionTypeConditionRefresh, InputArguments: []ua.Variant{res.SubscriptionID}},
+			{ObjectID: ua.ObjectTypeIDConditionType, MethodID: ua.MethodIDConditionTypeConditionRefresh, InputArguments: []ua.Variant{res.SubscriptionID + 1000}},
+		},
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error calling ConditionRefresh"))
+	}
+	if sc := res3.Results[0].StatusCode; sc != ua.Good {
+		t.Errorf("Error calling ConditionRefresh. want: %s, got: %s", ua.Good, sc)
+	}
+	if sc := res3.Results[1].StatusCode; sc != ua.BadSubscriptionIDInvalid {
+		t.Errorf("Error calling ConditionRefresh of unknown subscription. want: %s, got: %s", ua.BadSubscriptionIDInvalid, sc)
+	}
+
+	got := []string{}
+	for i := 0; i < 3 && len(got) < 4; i++ {
+		res4, err := ch.Publish(ctx, &ua.PublishRequest{RequestHeader: ua.RequestHeader{TimeoutHint: 60000}})
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "Error publishing"))
+		}
+		for _, data := range res4.NotificationMessage.NotificationData {
+			if body, ok := data.(ua.EventNotificationList); ok {
+				for _, e := range body.Events {
+					switch e.EventFields[0] {
+					case ua.ObjectTypeIDRefreshStartEventType:
+						got = append(got, "start")
+					case ua.ObjectTypeIDRefreshEndEventType:
+						got = append(got, "end")
+					default:
+						got = append(got, fmt.Sprint(e.EventFields[1]))
+					}
+				}
+			}
+		}
+	}
+	// the retained conditions are reported in any order between the refresh events.
+	if len(got) == 4 && got[1] > got[2] {
+		got[1], got[2] = got[2], got[1]
+	}
+	if !reflect.DeepEqual(got, []string{"start", "LowFlow", "Overheat", "end"}) {
+		t.Errorf("Error refreshing conditions. want: [start LowFlow Overheat end], got: %v", got)
+	}
+}
+
+// TestAlarmCondition tests that an alarm reports its state changes as events, that clients
+// acknowledge and confirm the alarm by calling its methods, and that ConditionRefresh reports
+// the alarm while it is retained.
+func TestAlarmCondition(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	tankID := ua.ParseNodeID("ns=2;s=Test.Tank")
+	tank := server.NewObjectNode(
+		tankID,
+		ua.NewQualifiedName(2, "Tank"),
+		ua.NewLocalizedText("Tank", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			ua.NewReference(ua.ReferenceTypeIDHasTypeDefinition, false, ua.NewExpandedNodeID(ua.ObjectTypeIDBaseObjectType)),
+			ua.NewReference(ua.ReferenceTypeIDHasNotifier, true, ua.NewExpandedNodeID(ua.ObjectIDServer)),
+		},
+		ua.EventNotifierSubscribeToEvents,
+	)
+	if err := nm.AddNode(tank); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(tank, false)
+	alarmID := ua.ParseNodeID("ns=2;s=Test.Tank.HighLevel")
+	alarm, err := nm.AddAlarmCondition(tank, alarmID, ua.NewQualifiedName(2, "HighLevel"), 700)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding alarm"))
+	}
+	defer nm.DeleteNode(alarm.Node(), true)
+	if _, err := nm.AddAlarmCondition(tank, alarmID, ua.NewQualifiedName(2, "HighLevel"), 700); err != ua.BadNodeIDExists {
+		t.Errorf("Error adding alarm twice. want: %s, got: %v", ua.BadNodeIDExists, err)
+	}
+	// the alarm is raised before the client subscribes.
+	alarm.Activate(ua.NewLocalizedText("Level is high", "en"))
+
+	ctx := context.Background()
+	ch, err := client.Dial(ctx, endpointURL, client.WithInsecureSkipVerify(), client.WithUserNameIdentity("root", "secret"))
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening client"))
+	}
+	defer ch.Close(ctx)
+	res, err := ch.CreateSubscription(ctx, &ua.CreateSubscriptionRequest{
+		RequestedPublishingInterval: 100.0,
+		RequestedMaxKeepAliveCount:  30,
+		RequestedLifetimeCount:      30 * 3,
+		PublishingEnabled:           true,
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error creating subscription"))
+	}
+	res2, err := ch.CreateMonitoredItems(ctx, &ua.CreateMonitoredItemsRequest{
+		SubscriptionID:     res.SubscriptionID,
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+		ItemsToCreate: []ua.MonitoredItemCreateRequest{
+			{
+				ItemToMonitor:  ua.ReadValueID{AttributeID: ua.AttributeIDEventNotifier, NodeID: tankID},
+				MonitoringMode: ua.MonitoringModeReporting,
+				RequestedParameters: ua.MonitoringParameters{
+					ClientHandle: 42, QueueSize: 10, DiscardOldest: true,
+					Filter: ua.EventFilter{
+						SelectClauses: []ua.SimpleAttributeOperand{
+							ua.AlarmConditionSelectClauses[1],
+							ua.AlarmConditionSelectClauses[0],
+							ua.AlarmConditionSelectClauses[11],
+							ua.AlarmConditionSelectClauses[14],
+							ua.AlarmConditionSelectClauses[12],
+							ua.AlarmConditionSelectClauses[13],
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil || res2.Results[0].StatusCode != ua.Good {
+		t.Fatal(errors.Wrap(err, "Error creating item"))
+	}
+	// publish returns the events as "Retain/Active/Acked/Confirmed", and the EventId of the last event of the alarm.
+	var eventID ua.ByteString
+	publish := func(n int) []string {
+		got := []string{}
+		for i := 0; i < 3 && len(got) < n; i++ {
+			res, err := ch.Publish(ctx, &ua.PublishRequest{RequestHeader: ua.RequestHeader{TimeoutHint: 60000}})
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "Error publishing"))
+			}
+			for _, data := range res.NotificationMessage.NotificationData {
+				if body, ok := data.(ua.EventNotificationList); ok {
+					for _, e := range body.Events {
+						switch e.EventFields[0] {
+						case ua.ObjectTypeIDRefreshStartEventType:
+							got = append(got, "start")
+						case ua.ObjectTypeIDRefreshEndEventType:
+							got = append(got, "end")
+						default:
+							eventID, _ = e.EventFields[1].(ua.ByteString)
+							got = append(got, fmt.Sprintf("%v/%v/%v/%v", e.EventFields[2], e.EventFields[3], e.EventFields[4], e.EventFields[5]))
+						}
+					}
+				}
+			}
+		}
+		return got
+	}
+
+	res3, err := ch.Call(ctx, &ua.CallRequest{
+		MethodsToCall: []ua.CallMethodRequest{
+			{ObjectID: ua.ObjectTypeIDConditionType, MethodID: ua.MethodIDConditionTypeConditionRefresh, InputArguments: []ua.Variant{res.SubscriptionID}},
+		},
+	})
+	if err != nil || res3.Results[0].StatusCode != ua.Good {
+		t.Fatal(errors.Wrap(err, "Error calling ConditionRefresh"))
+	}
+	if got, want := publish(3), []string{"start", "true/true/false/false", "end"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Error refreshing alarm. want: %v, got: %v", want, got)
+	}
+
+	// acknowledge the alarm with the method of the type, then with the method of the condition.
+	res4, err := ch.Call(ctx, &ua.CallRequest{
+		MethodsToCall: []ua.CallMethodRequest{
+			{ObjectID: alarmID, MethodID: ua.MethodIDAcknowledgeableConditionTypeAcknowledge, InputArguments: []ua.Variant{ua.ByteString("unknown"), ua.NewLocalizedText("", "")}},
+			{ObjectID: alarmID, MethodID: ua.MethodIDAcknowledgeableConditionTypeAcknowledge, InputArguments: []ua.Variant{eventID, ua.NewLocalizedText("Seen", "en")}},
+			{ObjectID: tankID, MethodID: ua.MethodIDAcknowledgeableConditionTypeAcknowledge, InputArguments: []ua.Variant{eventID, ua.NewLocalizedText("", "")}},
+		},
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error calling Acknowledge"))
+	}
+	for i, want := range []ua.StatusCode{ua.BadEventIDUnknown, ua.Good, ua.BadMethodInvalid} {
+		if sc := res4.Results[i].StatusCode; sc != want {
+			t.Errorf("Error calling Acknowledge #%d. want: %s, got: %s", i, want, sc)
+		}
+	}
+	res5, err := ch.Call(ctx, &ua.CallRequest{
+		MethodsToCall: []ua.CallMethodRequest{
+			{ObjectID: alarmID, MethodID: ua.ParseNodeID("ns=2;s=Test.Tank.HighLevel.Acknowledge"), InputArguments: []ua.Variant{alarm.EventID(), ua.NewLocalizedText("", "")}},
+		},
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error calling Acknowledge"))
+	}
+	if sc := res5.Results[0].StatusCode; sc != ua.BadConditionBranchAlreadyAcked {
+		t.Errorf("Error calling Acknowledge of acknowledged alarm. want: %s, got: %s", ua.BadConditionBranchAlreadyAcked, sc)
+	}
+	res6, err := ch.Read(ctx, &ua.ReadRequest{
+		NodesToRead: []ua.ReadValueID{
+			{NodeID: ua.ParseNodeID("ns=2;s=Test.Tank.HighLevel.AckedState.Id"), AttributeID: ua.AttributeIDValue},
+			{NodeID: ua.ParseNodeID("ns=2;s=Test.Tank.HighLevel.ActiveState"), AttributeID: ua.AttributeIDValue},
+			{NodeID: ua.ParseNodeID("ns=2;s=Test.Tank.HighLevel.Retain"), AttributeID: ua.AttributeIDValue},
+		},
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error reading"))
+	}
+	if v := res6.Results[0].Value; v != true {
+		t.Errorf("Error reading AckedState. want: true, got: %v", v)
+	}
+	if v := res6.Results[1].Value; v != ua.NewLocalizedText("Active", "en") {
+		t.Errorf("Error reading ActiveState. want: Active, got: %v", v)
+	}
+	if v := res6.Results[2].Value; v != true {
+		t.Errorf("Error reading Retain. want: true, got: %v", v)
+	}
+
+	// the alarm is retained until it is inactive and confirmed.
+	alarm.Deactivate(ua.NewLocalizedText("Level is normal", "en"))
+	res7, err := ch.Call(ctx, &ua.CallRequest{
+		MethodsToCall: []ua.CallMethodRequest{
+			{ObjectID: alarmID, MethodID: ua.ParseNodeID("ns=2;s=Test.Tank.HighLevel.Confirm"), InputArguments: []ua.Variant{alarm.EventID(), ua.NewLocalizedText("", "")}},
+		},
+	})
+	if err != nil || res7.Results[0].StatusCode != ua.Good {
+		t.Fatal(errors.Wrap(err, "Error calling Confirm"))
+	}
+	want := []string{"true/true/true/false", "true/false/true/false", "false/false/true/true"}
+	if got := publish(3); !reflect.DeepEqual(got, want) {
+		t.Errorf("Error reporting alarm. want: %v, got: %v", want, got)
+	}
+	if alarm.Retain() || len(nm.RetainedConditions(tankID)) != 0 {
+		t.Errorf("Error retaining alarm. want: false, got: %t", alarm.Retain())
+	}
+
+	// a disabled alarm reports no events.
+	if err := alarm.Disable(); err != nil {
+		t.Error(errors.Wrap(err, "Error disabling alarm"))
+	}
+	if err := alarm.Disable(); err != ua.BadConditionAlreadyDisabled {
+		t.Errorf("Error disabling alarm twice. want: %s, got: %v", ua.BadConditionAlreadyDisabled, err)
+	}
+	alarm.Activate(ua.NewLocalizedText("Level is high", "en"))
+	if err := alarm.Acknowledge(alarm.EventID(), ua.NewLocalizedText("", "")); err != ua.BadConditionDisabled {
+		t.Errorf("Error acknowledging disabled alarm. want: %s, got: %v", ua.BadConditionDisabled, err)
+	}
+	if err := alarm.Enable(); err != nil {
+		t.Error(errors.Wrap(err, "Error enabling alarm"))
+	}
+	want = []string{"false/false/true/true", "true/true/false/false"}
+	if got := publish(2); !reflect.DeepEqual(got, want) {
+		t.Errorf("Error reporting disabled alarm. want: %v, got: %v", want, got)
+	}
+}
+
+// TestGoroutineStats tests that the goroutines of channels, sessions, subscriptions and samplers
+// return to baseline after the clients disconnect.
+func TestGoroutineStats(t *testing.T) {
+	url := "opc.tcp://127.0.0.1:46027"
+	srv, err := server.New(
+		ua.ApplicationDescription{ApplicationURI: "urn:127.0.0.1:testserver", ApplicationName: ua.NewLocalizedText("testserver", "")},
+		"./pki/server.crt",
+		"./pki/server.key",
+		url,
+		server.WithAnonymousIdentity(true),
+		server.WithSecurityPolicyNone(true),
+		server.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error constructing server"))
+		return
+	}
+	defer srv.Close()
+	go srv.ListenAndServe()
+	time.Sleep(500 * time.Millisecond)
+
+	baseline := srv.Stats()
+	ctx := context.Background()
+	const n = 3
+	clients := make([]*client.Client, 0, n)
+	defer func() {
+		for _, ch := range clients {
+			ch.Abort(ctx)
+		}
+	}()
+	for i := 0; i < n; i++ {
+		ch, err := client.Dial(ctx, url, client.WithInsecureSkipVerify())
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "Error opening client"))
+		}
+		clients = append(clients, ch)
+		res, err := ch.CreateSubscription(ctx, &ua.CreateSubscriptionRequest{
+			RequestedPublishingInterval: 100.0,
+			RequestedMaxKeepAliveCount:  30,
+			RequestedLifetimeCount:      30 * 3,
+			PublishingEnabled:           true,
+		})
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "Error creating subscription"))
+		}
+		res2, err := ch.CreateMonitoredItems(ctx, &ua.CreateMonitoredItemsRequest{
+			SubscriptionID:     res.SubscriptionID,
+			TimestampsToReturn: ua.TimestampsToReturnBoth,
+			ItemsToCreate: []ua.MonitoredItemCreateRequest{
+				{
+					ItemToMonitor:  ua.ReadValueID{AttributeID: ua.AttributeIDValue, NodeID: ua.VariableIDServerServerStatusCurrentTime},
+					MonitoringMode: ua.MonitoringModeReporting,
+					RequestedParameters: ua.MonitoringParameters{
+						ClientHandle: 42, QueueSize: 1, DiscardOldest: true, SamplingInterval: 500.0 + float64(i),
+					},
+				},
+			},
+		})
+		if err != nil || res2.Results[0].StatusCode != ua.Good {
+			t.Fatal(errors.Wrap(err, "Error creating item"))
+		}
+	}
+
+	stats := srv.Stats()
+	if stats.Channels < baseline.Channels+n {
+		t.Errorf("Error counting channel goroutines. want: >= %d, got: %d", baseline.Channels+n, stats.Channels)
+	}
+	if stats.Subscriptions != baseline.Subscriptions+n {
+		t.Errorf("Error counting subscription goroutines. want: %d, got: %d", baseline.Subscriptions+n, stats.Subscriptions)
+	}
+	if stats.Subscriptions != int64(stats.SubscriptionCount) {
+		t.Errorf("Error counting subscription goroutines. want: %d (subscription count), got: %d", stats.SubscriptionCount, stats.Subscriptions)
+	}
+	if stats.Samplers <= baseline.Samplers {
+		t.Errorf("Error counting sampler goroutines. want: > %d, got: %d", baseline.Samplers, stats.Samplers)
+	}
+
+	for _, ch := range clients {
+		if err := ch.Close(ctx); err != nil {
+			t.Error(errors.Wrap(err, "Error closing client"))
+		}
+	}
+	clients = nil
+
+	// the goroutines exit asynchronously, so wait for the counts to return to baseline.
+	deadline := time.Now().Add(5 * time.Second)
+	for stats = srv.Stats(); stats != baseline && time.Now().Before(deadline); stats = srv.Stats() {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if stats != baseline {
+		t.Errorf("Error returning goroutines to baseline. want: %+v, got: %+v", baseline, stats)
+	}
+}
+
+// TestFilterReferences tests filtering the references of the Server object by type, direction and node class.
+func TestFilterReferences(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	m := testServer.NamespaceManager()
+	n, ok := m.FindNode(ua.ObjectIDServer)
+	if !ok {
+		t.Fatal("Error finding Server object")
+	}
+	refs := m.FilterReferences(n, ua.ReferenceTypeIDHasComponent, false, ua.BrowseDirectionForward, 0)
+	if len(refs) == 0 {
+		t.Error("Error filtering HasComponent references. want: > 0, got: 0")
+	}
+	for _, r := range refs {
+		if r.ReferenceTypeID != ua.ReferenceTypeIDHasComponent || r.IsInverse {
+			t.Errorf("Error filtering HasComponent references. got: %s, inverse: %t", r.ReferenceTypeID, r.IsInverse)
+		}
+	}
+	refs = m.FilterReferences(n, ua.ReferenceTypeIDHierarchicalReferences, true, ua.BrowseDirectionForward, uint32(ua.NodeClassVariable))
+	hasProperty := false
+	for _, r := range refs {
+		if r.ReferenceTypeID == ua.ReferenceTypeIDHasProperty {
+			hasProperty = true
+		}
+		if r.ReferenceTypeID == ua.ReferenceTypeIDHasTypeDefinition || r.IsInverse {
+			t.Errorf("Error filtering hierarchical references. got: %s, inverse: %t", r.ReferenceTypeID, r.IsInverse)
+		}
+		if target, ok := m.FindNode(ua.ToNodeID(r.TargetID, m.NamespaceUris())); !ok || target.NodeClass() != ua.NodeClassVariable {
+			t.Errorf("Error filtering references by node class. got: %s", r.TargetID)
+		}
+	}
+	if !hasProperty {
+		t.Error("Error filtering hierarchical references. want: HasProperty subtype, got: none")
+	}
+	refs = m.FilterReferences(n, ua.ReferenceTypeIDOrganizes, false, ua.BrowseDirectionInverse, 0)
+	if len(refs) != 1 || ua.ToNodeID(refs[0].TargetID, m.NamespaceUris()) != ua.ObjectIDObjectsFolder {
+		t.Errorf("Error filtering inverse Organizes references. want: %s, got: %v", ua.ObjectIDObjectsFolder, refs)
+	}
+	if refs = m.FilterReferences(n, nil, false, ua.BrowseDirectionBoth, 0); len(refs) != len(n.References()) {
+		t.Errorf("Error filtering all references. want: %d, got: %d", len(n.References()), len(refs))
+	}
+}
+
+// TestMemoryHistorianInsertValues tests backfilling the values of a MemoryHistorian that is at capacity.
+func TestMemoryHistorianInsertValues(t *testing.T) {
+	ctx := context.Background()
+	h := server.NewMemoryHistorian(3)
+	id := ua.NewNodeIDString(2, "Backfill")
+	start := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	at := func(i int) time.Time { return start.Add(time.Duration(i) * time.Minute) }
+	for i := 1; i < 4; i++ {
+		h.WriteValue(ctx, id, ua.NewDataValue(float64(i), 0, at(i*2), 0, time.Time{}, 0))
+	}
+	got := h.InsertValues(ctx, id, []ua.DataValue{
+		ua.NewDataValue(0.0, 0, at(0), 0, time.Time{}, 0),
+		ua.NewDataValue(2.5, 0, at(5), 0, time.Time{}, 0),
+		ua.NewDataValue(3.0, 0, at(6), 0, time.Time{}, 0),
+	})
+	want := []ua.StatusCode{ua.BadOutOfRange, ua.GoodEntryInserted, ua.BadEntryExists}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Error inserting values. want: %v, got: %v", want, got)
+	}
+	res, _ := h.ReadRawModified(ctx, []ua.HistoryReadValueID{{NodeID: id}}, ua.ReadRawModifiedDetails{StartTime: start, EndTime: at(10)}, ua.TimestampsToReturnSource, false)
+	values := []ua.Variant{}
+	if data, ok := res[0].HistoryData.(ua.HistoryData); ok {
+		for _, v := range data.DataValues {
+			values = append(values, v.Value)
+		}
+	}
+	if !reflect.DeepEqual(values, []ua.Variant{2.0, 2.5, 3.0}) {
+		t.Errorf("Error reading inserted values. want: [2 2.5 3], got: %v", values)
+	}
+}
+
+// TestRegisterNodes tests that the Read, Write and Call services accept the NodeIDs returned by
+// RegisterNodes, until the nodes are unregistered, and only in the session that registered them.
+func TestRegisterNodes(t *testing.T) {
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening client"))
+	}
+	defer ch.Close(ctx)
+	unknownID := ua.NewNodeIDString(2, "Unknown")
+	res, err := ch.RegisterNodes(ctx, &ua.RegisterNodesRequest{
+		NodesToRegister: []ua.NodeID{ua.VariableIDServerServerStatusCurrentTime, ua.ObjectIDServer, ua.MethodIDServerGetMonitoredItems, unknownID},
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error registering nodes"))
+	}
+	ids := res.RegisteredNodeIDs
+	if len(ids) != 4 || ids[0] == ua.VariableIDServerServerStatusCurrentTime || ids[3] != unknownID {
+		t.Fatalf("Error registering nodes. got: %v", ids)
+	}
+
+	res2, err := ch.Read(ctx, &ua.ReadRequest{
+		NodesToRead: []ua.ReadValueID{{NodeID: ids[0], AttributeID: ua.AttributeIDValue}},
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error reading"))
+	}
+	if _, ok := res2.Results[0].Value.(time.Time); !ok || res2.Results[0].StatusCode != ua.Good {
+		t.Errorf("Error reading registered node. got: %v %s", res2.Results[0].Value, res2.Results[0].StatusCode)
+	}
+	res3, err := ch.Write(ctx, &ua.WriteRequest{
+		NodesToWrite: []ua.WriteValue{{NodeID: ids[0], AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(time.Now(), 0, time.Time{}, 0, time.Time{}, 0)}},
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error writing"))
+	}
+	if res3.Results[0] != ua.BadNotWritable {
+		t.Errorf("Error writing registered node. want: %s, got: %s", ua.BadNotWritable, res3.Results[0])
+	}
+	res4, err := ch.Call(ctx, &ua.CallRequest{
+		MethodsToCall: []ua.CallMethodRequest{{ObjectID: ids[1], MethodID: ids[2], InputArguments: []ua.Variant{uint32(0)}}},
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error calling"))
+	}
+	if res4.Results[0].StatusCode != ua.BadSubscriptionIDInvalid {
+		t.Errorf("Error calling registered method. want: %s, got: %s", ua.BadSubscriptionIDInvalid, res4.Results[0].StatusCode)
+	}
+
+	res5, err := ch.Browse(ctx, &ua.BrowseRequest{
+		NodesToBrowse: []ua.BrowseDescription{{NodeID: ids[1], BrowseDirection: ua.BrowseDirectionForward, ReferenceTypeID: ua.ReferenceTypeIDHierarchicalReferences, IncludeSubtypes: true, ResultMask: uint32(ua.BrowseResultMaskAll)}},
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error browsing"))
+	}
+	if res5.Results[0].StatusCode != ua.Good || len(res5.Results[0].References) == 0 {
+		t.Errorf("Error browsing registered node. got: %s, %d references", res5.Results[0].StatusCode, len(res5.Results[0].References))
+	}
+
+	// another session does not resolve the registered NodeIDs.
+	ch2, err := client.Dial(ctx, endpointURL, client.WithInsecureSkipVerify())
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening client"))
+	}
+	defer ch2.Close(ctx)
+	res2, err = ch2.Read(ctx, &ua.ReadRequest{
+		NodesToRead: []ua.ReadValueID{{NodeID: ids[0], AttributeID: ua.AttributeIDValue}},
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error reading"))
+	}
+	if res2.Results[0].StatusCode != ua.BadNodeIDUnknown {
+		t.Errorf("Error reading node registered by another session. want: %s, got: %s", ua.BadNodeIDUnknown, res2.Results[0].StatusCode)
+	}
+
+	_, err = ch.UnregisterNodes(ctx, &ua.UnregisterNodesRequest{NodesToUnregister: ids})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error unregistering nodes"))
+	}
+	res2, err = ch.Read(ctx, &ua.ReadRequest{
+		NodesToRead: []ua.ReadValueID{{NodeID: ids[0], AttributeID: ua.AttributeIDValue}},
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error reading"))
+	}
+	if res2.Results[0].StatusCode != ua.BadNodeIDUnknown {
+		t.Errorf("Error reading unregistered node. want: %s, got: %s", ua.BadNodeIDUnknown, res2.Results[0].StatusCode)
+	}
+}
+
+// TestRegisterNodesReplaced tests that a NodeID returned by RegisterNodes resolves to the node that
+// currently has the NodeID, that a session registers at most 1000 nodes, and that the NodeID of a
+// deleted node is unknown.
+func TestRegisterNodesReplaced(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	newNode := func(value int32) *server.VariableNode {
+		return server.NewVariableNode(
+			ua.ParseNodeID("ns=2;s=Test.Registered"),
+			ua.NewQualifiedName(2, "Registered"),
+			ua.NewLocalizedText("Registered", ""),
+			ua.NewLocalizedText("", ""),
+			nil,
+			[]ua.Reference{
+				{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+			},
+			ua.NewDataValue(value, 0, time.Now(), 0, time.Now(), 0),
+			ua.DataTypeIDInt32,
+			ua.ValueRankScalar,
+			[]uint32{},
+			ua.AccessLevelsCurrentRead,
+			0,
+			false,
+			nil,
+		)
+	}
+	node := newNode(1)
+	if err := nm.AddNode(node); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+
+	ctx := context.Background()
+	ch, err := client.Dial(ctx, endpointURL, client.WithInsecureSkipVerify())
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening client"))
+	}
+	defer ch.Close(ctx)
+	res, err := ch.RegisterNodes(ctx, &ua.RegisterNodesRequest{NodesToRegister: []ua.NodeID{node.NodeID()}})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error registering nodes"))
+	}
+	id := res.RegisteredNodeIDs[0]
+
+	// replace the node after it was registered.
+	if err := nm.DeleteNode(node, false); err != nil {
+		t.Fatal(errors.Wrap(err, "Error deleting node"))
+	}
+	node = newNode(2)
+	if err := nm.AddNode(node); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(node, false)
+	res2, err := ch.Read(ctx, &ua.ReadRequest{
+		NodesToRead: []ua.ReadValueID{{NodeID: id, AttributeID: ua.AttributeIDValue}},
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error reading"))
+	}
+	if res2.Results[0].Value != int32(2) {
+		t.Errorf("Error reading replaced node. want: %d, got: %v %s", 2, res2.Results[0].Value, res2.Results[0].StatusCode)
+	}
+
+	// the session already holds one registered node, so only 999 more are registered.
+	nodes := make([]ua.NodeID, 1000)
+	for i := range nodes {
+		nodes[i] = node.NodeID()
+	}
+	res, err = ch.RegisterNodes(ctx, &ua.RegisterNodesRequest{NodesToRegister: nodes})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error registering nodes"))
+	}
+	if got := res.RegisteredNodeIDs[998]; got == node.NodeID() {
+		t.Errorf("Error registering node 999. got: %s", got)
+	}
+	if got := res.RegisteredNodeIDs[999]; got != node.NodeID() {
+		t.Errorf("Error registering node beyond the limit. want: %s, got: %s", node.NodeID(), got)
+	}
+
+	// delete the node after it was registered.
+	if err := nm.DeleteNode(node, false); err != nil {
+		t.Fatal(errors.Wrap(err, "Error deleting node"))
+	}
+	res3, err := ch.Read(ctx, &ua.ReadRequest{
+		NodesToRead: []ua.ReadValueID{{NodeID: id, AttributeID: ua.AttributeIDValue}, {NodeID: res.RegisteredNodeIDs[0], AttributeID: ua.AttributeIDValue}},
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error reading"))
+	}
+	for i, r := range res3.Results {
+		if r.StatusCode != ua.BadNodeIDUnknown {
+			t.Errorf("Error reading deleted node %d. want: %s, got: %s", i, ua.BadNodeIDUnknown, r.StatusCode)
+		}
+	}
+}
+
+// TestAccessLevelExAndWriteMask tests that the Write service enforces the WriteFullArrayOnly bit of
+// AccessLevelEx and the WriteMask of a variable.
+func TestAccessLevelExAndWriteMask(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	node := server.NewVariableNode(
+		ua.ParseNodeID("ns=2;s=Test.WriteMask"),
+		ua.NewQualifiedName(2, "WriteMask"),
+		ua.NewLocalizedText("WriteMask", ""),
+		ua.NewLocalizedText("", ""),
+		[]ua.RolePermissionType{
+			{RoleID: ua.ObjectIDWellKnownRoleEngineer, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead | ua.PermissionTypeWrite | ua.PermissionTypeWriteAttribute},
+			{RoleID: ua.ObjectIDWellKnownRoleAnonymous, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead},
+		},
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+		},
+		ua.NewDataValue([]int32{1, 2, 3}, 0, time.Now(), 0, time.Now(), 0),
+		ua.DataTypeIDInt32,
+		ua.ValueRankOneDimension,
+		[]uint32{0},
+		ua.AccessLevelsCurrentRead|ua.AccessLevelsCurrentWrite,
+		0,
+		false,
+		nil,
+	)
+	if err := nm.AddNode(node); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(node, false)
+
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening client"))
+	}
+	defer ch.Close(ctx)
+	write := func(nodesToWrite ...ua.WriteValue) []ua.StatusCode {
+		res, err := ch.Write(ctx, &ua.WriteRequest{NodesToWrite: nodesToWrite})
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "Error writing"))
+		}
+		return res.Results
+	}
+	element := ua.WriteValue{NodeID: node.NodeID(), AttributeID: ua.AttributeIDValue, IndexRange: "1", Value: ua.NewDataValue([]int32{20}, 0, time.Time{}, 0, time.Time{}, 0)}
+	array := ua.WriteValue{NodeID: node.NodeID(), AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue([]int32{4, 5, 6}, 0, time.Time{}, 0, time.Time{}, 0)}
+	displayName := ua.WriteValue{NodeID: node.NodeID(), AttributeID: ua.AttributeIDDisplayName, Value: ua.NewDataValue(ua.NewLocalizedText("Renamed", ""), 0, time.Time{}, 0, time.Time{}, 0)}
+
+	if got := write(element); got[0] != ua.Good {
+		t.Errorf("Error writing element. want: %s, got: %s", ua.Good, got[0])
+	}
+	node.SetAccessLevelEx(uint32(ua.AccessLevelsCurrentRead|ua.AccessLevelsCurrentWrite) | uint32(ua.AccessLevelExTypeWriteFullArrayOnly))
+	if got := write(element); got[0] != ua.BadWriteNotSupported {
+		t.Errorf("Error writing element of WriteFullArrayOnly node. want: %s, got: %s", ua.BadWriteNotSupported, got[0])
+	}
+	if got := write(array); got[0] != ua.Good {
+		t.Errorf("Error writing array of WriteFullArrayOnly node. want: %s, got: %s", ua.Good, got[0])
+	}
+	if got := write(displayName); got[0] != ua.Good {
+		t.Errorf("Error writing DisplayName. want: %s, got: %s", ua.Good, got[0])
+	}
+	node.SetWriteMask(uint32(ua.AttributeWriteMaskDescription))
+	if got := write(displayName); got[0] != ua.BadNotWritable {
+		t.Errorf("Error writing DisplayName without WriteMask bit. want: %s, got: %s", ua.BadNotWritable, got[0])
+	}
+
+	res, err := ch.Read(ctx, &ua.ReadRequest{
+		NodesToRead: []ua.ReadValueID{
+			{NodeID: node.NodeID(), AttributeID: ua.AttributeIDAccessLevelEx},
+			{NodeID: node.NodeID(), AttributeID: ua.AttributeIDWriteMask},
+			{NodeID: node.NodeID(), AttributeID: ua.AttributeIDUserWriteMask},
+			{NodeID: node.NodeID(), AttributeID: ua.AttributeIDValue},
+		},
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error reading"))
+	}
+	want := []ua.Variant{uint32(0x403), uint32(ua.AttributeWriteMaskDescription), uint32(ua.AttributeWriteMaskDescription), []int32{4, 5, 6}}
+	for i, w := range want {
+		if got := res.Results[i].Value; !reflect.DeepEqual(got, w) {
+			t.Errorf("Error reading attribute %d. want: %v, got: %v", i, w, got)
+		}
+	}
+
+	// an anonymous user may not write attributes.
+	ch2, err := client.Dial(ctx, endpointURL, client.WithInsecureSkipVerify())
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening client"))
+	}
+	defer ch2.Close(ctx)
+	res, err = ch2.Read(ctx, &ua.ReadRequest{
+		NodesToRead: []ua.ReadValueID{{NodeID: node.NodeID(), AttributeID: ua.AttributeIDUserWriteMask}},
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error reading"))
+	}
+	if got := res.Results[0].Value; got != uint32(0) {
+		t.Errorf("Error reading UserWriteMask of anonymous user. want: 0, got: %v", got)
+	}
+}
+
+// TestAuditEvents tests that the server raises audit events for rejected and activated sessions,
+// and for writes to audited nodes.
+func TestAuditEvents(t *testing.T) {
+	url := "opc.tcp://127.0.0.1:46028"
+	rules := append([]server.IdentityMappingRule{}, server.DefaultIdentityMappingRules...)
+	rules = append(rules, server.IdentityMappingRule{
+		NodeID: ua.ObjectIDWellKnownRoleSecurityAdmin,
+		Identities: []ua.IdentityMappingRuleType{
+			{CriteriaType: ua.IdentityCriteriaTypeUserName, Criteria: "admin"},
+		},
+		ApplicationsExclude: true,
+		EndpointsExclude:    true,
+	})
+	srv, err := server.New(
+		ua.ApplicationDescription{ApplicationURI: "urn:127.0.0.1:testserver", ApplicationName: ua.NewLocalizedText("testserver", "")},
+		"./pki/server.crt",
+		"./pki/server.key",
+		url,
+		server.WithAuthenticateUserNameIdentityFunc(func(userIdentity ua.UserNameIdentity, applicationURI string, endpointURL string) error {
+			if userIdentity.Password != "secret" {
+				return ua.BadUserAccessDenied
+			}
+			return nil
+		}),
+		server.WithRolesProvider(server.NewRulesBasedRolesProvider(rules)),
+		server.WithAnonymousIdentity(true),
+		server.WithSecurityPolicyNone(true),
+		server.WithInsecureSkipVerify(),
+		server.WithAuditing(true),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error constructing server"))
+		return
+	}
+	defer srv.Close()
+	go srv.ListenAndServe()
+	time.Sleep(500 * time.Millisecond)
+
+	nm := srv.NamespaceManager()
+	node := server.NewVariableNode(
+		ua.ParseNodeID("ns=1;s=Audited"),
+		ua.NewQualifiedName(1, "Audited"),
+		ua.NewLocalizedText("Audited", ""),
+		ua.NewLocalizedText("", ""),
+		[]ua.RolePermissionType{
+			{RoleID: ua.ObjectIDWellKnownRoleAuthenticatedUser, Permissions: ua.PermissionTypeBrowse | ua.PermissionTypeRead | ua.PermissionTypeWrite},
+		},
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+		},
+		ua.NewDataValue(float64(1), 0, time.Now(), 0, time.Now(), 0),
+		ua.DataTypeIDDouble,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentRead|ua.AccessLevelsCurrentWrite,
+		0,
+		false,
+		nil,
+	)
+	node.SetAudited(true)
+	if err := nm.AddNode(node); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+
+	ctx := context.Background()
+	ch, err := client.Dial(ctx, url, client.WithInsecureSkipVerify(), client.WithUserNameIdentity("admin", "secret"))
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening client"))
+	}
+	defer ch.Close(ctx)
+	// an anonymous user does not receive audit events.
+	anon, err := client.Dial(ctx, url, client.WithInsecureSkipVerify())
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening client"))
+	}
+	defer anon.Close(ctx)
+	res, err := ch.Read(ctx, &ua.ReadRequest{
+		NodesToRead: []ua.ReadValueID{{NodeID: ua.VariableIDServerAuditing, AttributeID: ua.AttributeIDValue}},
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error reading"))
+	}
+	if res.Results[0].Value != true {
+		t.Errorf("Error reading Server_Auditing. want: true, got: %v", res.Results[0].Value)
+	}
+	subscribe := func(ch *client.Client) {
+		res2, err := ch.CreateSubscription(ctx, &ua.CreateSubscriptionRequest{
+			RequestedPublishingInterval: 100.0,
+			RequestedMaxKeepAliveCount:  30,
+			RequestedLifetimeCount:      30 * 3,
+			PublishingEnabled:           true,
+		})
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "Error creating subscription"))
+		}
+		res3, err := ch.CreateMonitoredItems(ctx, &ua.CreateMonitoredItemsRequest{
+			SubscriptionID:     res2.SubscriptionID,
+			TimestampsToReturn: ua.TimestampsToReturnBoth,
+			ItemsToCreate: []ua.MonitoredItemCreateRequest{
+				{
+					ItemToMonitor:  ua.ReadValueID{AttributeID: ua.AttributeIDEventNotifier, NodeID: ua.ObjectIDServer},
+					MonitoringMode: ua.MonitoringModeReporting,
+					RequestedParameters: ua.MonitoringParameters{
+						ClientHandle: 42, QueueSize: 10, DiscardOldest: true,
+						Filter: ua.EventFilter{
+							SelectClauses: []ua.SimpleAttributeOperand{
+								ua.AuditWriteUpdateEventSelectClauses[1],  // EventType
+								ua.AuditWriteUpdateEventSelectClauses[9],  // Status
+								ua.AuditWriteUpdateEventSelectClauses[12], // ClientUserId
+								ua.AuditSessionEventSelectClauses[14],     // StatusCodeId
+								ua.AuditWriteUpdateEventSelectClauses[15], // OldValue
+								ua.AuditWriteUpdateEventSelectClauses[16], // NewValue
+								ua.AuditWriteUpdateEventSelectClauses[8],  // ActionTimeStamp
+								ua.AuditWriteUpdateEventSelectClauses[4],  // Time
+							},
+							WhereClause: ua.ContentFilter{
+								Elements: []ua.ContentFilterElement{
+									{FilterOperator: ua.FilterOperatorOfType, FilterOperands: []ua.ExtensionObject{ua.LiteralOperand{Value: ua.ObjectTypeIDAuditEventType}}},
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+		if err != nil || res3.Results[0].StatusCode != ua.Good {
+			t.Fatal(errors.Wrap(err, "Error creating item"))
+		}
+	}
+	subscribe(ch)
+	subscribe(anon)
+
+	// a rejected login, an accepted login, and a write.
+	if ch2, err := client.Dial(ctx, url, client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"), client.WithInsecureSkipVerify(), client.WithUserNameIdentity("root", "wrong")); err == nil {
+		ch2.Close(ctx)
+		t.Error("Error opening client with wrong password. want: error, got: nil")
+	}
+	ch3, err := client.Dial(ctx, url, client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"), client.WithInsecureSkipVerify(), client.WithUserNameIdentity("root", "secret"))
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening client"))
+	}
+	ch3.Close(ctx)
+	start := time.Now()
+	res4, err := ch.Write(ctx, &ua.WriteRequest{
+		NodesToWrite: []ua.WriteValue{{NodeID: node.NodeID(), AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(float64(2), 0, time.Time{}, 0, time.Time{}, 0)}},
+	})
+	if err != nil || res4.Results[0] != ua.Good {
+		t.Fatal(errors.Wrap(err, "Error writing"))
+	}
+
+	// the activation of the session of ch was raised before the item was created.
+	want := [][]ua.Variant{
+		{ua.ObjectTypeIDAuditActivateSessionEventType, false, "root", ua.BadUserAccessDenied, nil, nil},
+		{ua.ObjectTypeIDAuditActivateSessionEventType, true, "root", ua.Good, nil, nil},
+		{ua.ObjectTypeIDAuditWriteUpdateEventType, true, "admin", nil, float64(1), float64(2)},
+	}
+	events := func(ch *client.Client, n int) [][]ua.Variant {
+		got := [][]ua.Variant{}
+		for i := 0; i < n && len(got) < len(want); i++ {
+			res5, err := ch.Publish(ctx, &ua.PublishRequest{RequestHeader: ua.RequestHeader{TimeoutHint: 60000}})
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "Error publishing"))
+			}
+			for _, data := range res5.NotificationMessage.NotificationData {
+				if body, ok := data.(ua.EventNotificationList); ok {
+					for _, e := range body.Events {
+						got = append(got, e.EventFields)
+					}
+				}
+			}
+		}
+		return got
+	}
+	got := events(ch, 5)
+	// the ActionTimeStamp of the write is the timestamp of the request, sent before the event was raised.
+	if len(got) == len(want) {
+		ts, _ := got[2][6].(time.Time)
+		raised, _ := got[2][7].(time.Time)
+		if ts.Before(start) || !ts.Before(raised) {
+			t.Errorf("Error receiving ActionTimeStamp of write. want: request timestamp, got: %v, event time: %v", got[2][6], got[2][7])
+		}
+	}
+	for i := range got {
+		got[i] = got[i][:6]
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Error receiving audit events. want: %v, got: %v", want, got)
+	}
+	if got := events(anon, 1); len(got) != 0 {
+		t.Errorf("Error receiving audit events anonymously. want: [], got: %v", got)
+	}
+}
+
+// TestSessionDiagnostics tests reading the SessionDiagnosticsArray and SubscriptionDiagnosticsArray of the server.
+// A session sees the diagnostics of its own session and subscriptions, and anonymous users may not read them.
+func TestSessionDiagnostics(t *testing.T) {
+	ctx := context.Background()
+	dial := func(opts ...client.Option) *client.Client {
+		opts = append(opts, client.WithInsecureSkipVerify())
+		ch, err := client.Dial(ctx, endpointURL, opts...)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "Error opening client"))
+		}
+		return ch
+	}
+	read := func(ch *client.Client, id ua.NodeID) ua.DataValue {
+		// a MaxAge must not return the value read by another session.
+		res, err := ch.Read(ctx, &ua.ReadRequest{
+			MaxAge:      60000,
+			NodesToRead: []ua.ReadValueID{{NodeID: id, AttributeID: ua.AttributeIDValue}},
+		})
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "Error reading"))
+		}
+		return res.Results[0]
+	}
+	subscriptionIDs := func(ch *client.Client) []uint32 {
+		dv := read(ch, ua.VariableIDServerServerDiagnosticsSubscriptionDiagnosticsArray)
+		a, _ := dv.Value.([]ua.ExtensionObject)
+		ids := []uint32{}
+		for _, e := range a {
+			if d, ok := e.(ua.SubscriptionDiagnosticsDataType); ok {
+				ids = append(ids, d.SubscriptionID)
+			}
+		}
+		return ids
+	}
+
+	ch1 := dial(client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"), client.WithUserNameIdentity("root", "secret"))
+	defer ch1.Close(ctx)
+	ch2 := dial(client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"), client.WithUserNameIdentity("root", "secret"))
+	defer ch2.Close(ctx)
+
+	dv := read(ch2, ua.VariableIDServerServerDiagnosticsSessionsDiagnosticsSummarySessionDiagnosticsArray)
+	a, _ := dv.Value.([]ua.ExtensionObject)
+	if len(a) != 1 {
+		t.Fatalf("Error reading SessionDiagnosticsArray. want: 1 session, got: %v %s", dv.Value, dv.StatusCode)
+	}
+	if d, ok := a[0].(ua.SessionDiagnosticsDataType); !ok || d.SessionID != ch2.SessionID() {
+		t.Errorf("Error reading SessionDiagnosticsArray. want: %s, got: %v", ch2.SessionID(), a[0])
+	}
+
+	res, err := ch1.CreateSubscription(ctx, &ua.CreateSubscriptionRequest{
+		RequestedPublishingInterval: 1000.0,
+		RequestedMaxKeepAliveCount:  30,
+		RequestedLifetimeCount:      30 * 3,
+		PublishingEnabled:           true,
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error creating subscription"))
+	}
+	if ids := subscriptionIDs(ch1); len(ids) != 1 || ids[0] != res.SubscriptionID {
+		t.Errorf("Error reading SubscriptionDiagnosticsArray. want: [%d], got: %v", res.SubscriptionID, ids)
+	}
+	if ids := subscriptionIDs(ch2); len(ids) != 0 {
+		t.Errorf("Error reading SubscriptionDiagnosticsArray of other session. want: [], got: %v", ids)
+	}
+	if testServer != nil {
+		nm := testServer.NamespaceManager()
+		session, ok := nm.FindNode(ch1.SessionID())
+		if !ok {
+			t.Fatal("Error finding session diagnostics object")
+		}
+		sessionDiagnostics, _ := nm.FindComponent(session, ua.NewQualifiedName(0, "SessionDiagnostics"))
+		subscriptionDiagnosticsArray, _ := nm.FindComponent(session, ua.NewQualifiedName(0, "SubscriptionDiagnosticsArray"))
+		subscriptionDiagnostics, ok := nm.FindComponent(subscriptionDiagnosticsArray, ua.NewQualifiedName(1, fmt.Sprint(res.SubscriptionID)))
+		if !ok {
+			t.Fatal("Error finding subscription diagnostics variable")
+		}
+		for _, id := range []ua.NodeID{sessionDiagnostics.NodeID(), subscriptionDiagnostics.NodeID()} {
+			if sc := read(ch1, id).StatusCode; sc != ua.Good {
+				t.Errorf("Error reading diagnostics of own session. want: %s, got: %s", ua.Good, sc)
+			}
+			if sc := read(ch2, id).StatusCode; sc != ua.BadUserAccessDenied {
+				t.Errorf("Error reading diagnostics of other session. want: %s, got: %s", ua.BadUserAccessDenied, sc)
+			}
+		}
+	}
+	_, err = ch1.DeleteSubscriptions(ctx, &ua.DeleteSubscriptionsRequest{
+		SubscriptionIDs: []uint32{res.SubscriptionID},
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error deleting subscription"))
+	}
+	if ids := subscriptionIDs(ch1); len(ids) != 0 {
+		t.Errorf("Error reading SubscriptionDiagnosticsArray after delete. want: [], got: %v", ids)
+	}
+
+	ch3 := dial()
+	defer ch3.Close(ctx)
+	if sc := read(ch3, ua.VariableIDServerServerDiagnosticsSessionsDiagnosticsSummarySessionDiagnosticsArray).StatusCode; sc != ua.BadUserAccessDenied {
+		t.Errorf("Error reading SessionDiagnosticsArray anonymously. want: %s, got: %s", ua.BadUserAccessDenied, sc)
+	}
+}
+
+// TestValueChangedHandler tests that handlers added to a VariableNode are called for values set by
+// the server and values written by clients, and are not called after they are removed.
+func TestValueChangedHandler(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	id := ua.ParseNodeID("ns=2;s=Demo.Static.Scalar.Int32")
+	n, ok := testServer.NamespaceManager().FindVariable(id)
+	if !ok {
+		t.Fatalf("Error finding node %s", id)
+	}
+	initial := n.Value()
+	defer n.SetValue(initial)
+	n.SetValue(ua.NewDataValue(int32(1), 0, time.Now(), 0, time.Now(), 0))
+
+	type change struct{ old, new ua.Variant }
+	changes := make(chan change, 4)
+	handle := n.AddValueChangedHandler(func(oldValue, newValue ua.DataValue) {
+		// the handler may read the node, since the lock is released.
+		if n.Value().Value != newValue.Value {
+			t.Errorf("Error reading value in handler. want: %v, got: %v", newValue.Value, n.Value().Value)
+		}
+		changes <- change{oldValue.Value, newValue.Value}
+	})
+
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening client"))
+	}
+	defer ch.Close(ctx)
+	res, err := ch.Write(ctx, &ua.WriteRequest{
+		NodesToWrite: []ua.WriteValue{{NodeID: id, AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(int32(2), 0, time.Time{}, 0, time.Time{}, 0)}},
+	})
+	if err != nil || res.Results[0] != ua.Good {
+		t.Fatalf("Error writing value. err: %v, results: %v", err, res)
+	}
+	n.SetValue(ua.NewDataValue(int32(3), 0, time.Now(), 0, time.Now(), 0))
+	n.RemoveValueChangedHandler(handle)
+	n.SetValue(ua.NewDataValue(int32(4), 0, time.Now(), 0, time.Now(), 0))
+	close(changes)
+
+	got := []change{}
+	for c := range changes {
+		got = append(got, c)
+	}
+	want := []change{{int32(1), int32(2)}, {int32(2), int32(3)}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Error calling value changed handler. want: %v, got: %v", want, got)
+	}
+}
+
+// TestWriteTimestamps tests the timestamps stored by a write of the Value attribute. The SourceTimestamp
+// written by the client is kept if the node allows TimestampWrite, and omitted timestamps are stamped. Writing
+// a timestamp or a StatusCode that the AccessLevel does not allow returns BadWriteNotSupported.
+func TestWriteTimestamps(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	id := ua.ParseNodeID("ns=2;s=Test.WriteTimestamps")
+	n := server.NewVariableNode(
+		id,
+		ua.NewQualifiedName(2, "WriteTimestamps"),
+		ua.NewLocalizedText("WriteTimestamps", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+		},
+		ua.NewDataValue(int32(0), 0, time.Now(), 0, time.Now(), 0),
+		ua.DataTypeIDInt32,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentRead|ua.AccessLevelsCurrentWrite|ua.AccessLevelsTimestampWrite,
+		250,
+		false,
+		nil,
+	)
+	nm := testServer.NamespaceManager()
+	if err := nm.AddNode(n); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(n, false)
+
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening client"))
+	}
+	defer ch.Close(ctx)
+	writeStatus := func(nodeID ua.NodeID, value ua.DataValue) ua.StatusCode {
+		res, err := ch.Write(ctx, &ua.WriteRequest{
+			NodesToWrite: []ua.WriteValue{{NodeID: nodeID, AttributeID: ua.AttributeIDValue, Value: value}},
+		})
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "Error writing value"))
+		}
+		return res.Results[0]
+	}
+	write := func(nodeID ua.NodeID, value ua.DataValue) ua.DataValue {
+		if sc := writeStatus(nodeID, value); sc != ua.Good {
+			t.Fatalf("Error writing value. want: %s, got: %s", ua.Good, sc)
+		}
+		res2, err := ch.Read(ctx, &ua.ReadRequest{
+			NodesToRead:        []ua.ReadValueID{{NodeID: nodeID, AttributeID: ua.AttributeIDValue}},
+			TimestampsToReturn: ua.TimestampsToReturnBoth,
+		})
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "Error reading value"))
+		}
+		return res2.Results[0]
+	}
+
+	start := time.Now().Add(-time.Second)
+	source := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	// the node allows TimestampWrite, so the SourceTimestamp of the client is kept.
+	dv := write(id, ua.NewDataValue(int32(1), 0, source, 0, time.Time{}, 0))
+	if !dv.SourceTimestamp.Equal(source) || dv.ServerTimestamp.Before(start) {
+		t.Errorf("Error writing SourceTimestamp. want: %s, got: %s, %s", source, dv.SourceTimestamp, dv.ServerTimestamp)
+	}
+	// omitted timestamps are stamped with the current time.
+	dv = write(id, ua.NewDataValue(int32(2), 0, time.Time{}, 0, time.Time{}, 0))
+	if dv.StatusCode != ua.Good || dv.SourceTimestamp.Before(start) || dv.ServerTimestamp.Before(start) {
+		t.Errorf("Error writing value without timestamps. got: %s, %s, %s", dv.StatusCode, dv.SourceTimestamp, dv.ServerTimestamp)
+	}
+	// the node does not allow TimestampWrite, so writing a timestamp is not supported.
+	other := ua.ParseNodeID("ns=2;s=Demo.Static.Scalar.Int32")
+	if sc := writeStatus(other, ua.NewDataValue(int32(3), 0, source, 0, time.Time{}, 0)); sc != ua.BadWriteNotSupported {
+		t.Errorf("Error writing SourceTimestamp to node without TimestampWrite. want: %s, got: %s", ua.BadWriteNotSupported, sc)
+	}
+	if sc := writeStatus(other, ua.NewDataValue(int32(3), 0, time.Time{}, 0, source, 0)); sc != ua.BadWriteNotSupported {
+		t.Errorf("Error writing ServerTimestamp to node without TimestampWrite. want: %s, got: %s", ua.BadWriteNotSupported, sc)
+	}
+	// neither node allows StatusWrite.
+	if sc := writeStatus(id, ua.NewDataValue(int32(4), ua.UncertainLastUsableValue, time.Time{}, 0, time.Time{}, 0)); sc != ua.BadWriteNotSupported {
+		t.Errorf("Error writing StatusCode to node without StatusWrite. want: %s, got: %s", ua.BadWriteNotSupported, sc)
+	}
+}
+
+// TestReplaceCertificate tests replacing the server certificate while a client is connected.
+func TestReplaceCertificate(t *testing.T) {
+	serverURL := "opc.tcp://127.0.0.1:46031"
+	srv, err := server.New(
+		ua.ApplicationDescription{ApplicationURI: "urn:127.0.0.1:testserver", ApplicationName: ua.NewLocalizedText("testserver", "")},
+		"./pki/server.crt",
+		"./pki/server.key",
+		serverURL,
+		server.WithAnonymousIdentity(true),
+		server.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error constructing server"))
+		return
+	}
+	defer srv.Close()
+	go srv.ListenAndServe()
+	time.Sleep(100 * time.Millisecond)
+
+	ctx := context.Background()
+	chA, err := client.Dial(ctx, serverURL, client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"), client.WithInsecureSkipVerify())
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client"))
+		return
+	}
+	defer chA.Close(ctx)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating key"))
+		return
+	}
+	applicationURI, _ := url.Parse("urn:127.0.0.1:testserver")
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "testserver"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment | x509.KeyUsageKeyEncipherment | x509.KeyUsageDataEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		URIs:                  []*url.URL{applicationURI},
+	}
+	rawcrt, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error creating certificate"))
+		return
+	}
+	cert := tls.Certificate{Certificate: [][]byte{rawcrt}, PrivateKey: key}
+	other, err := tls.LoadX509KeyPair("./pki/client.crt", "./pki/client.key")
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error loading certificate"))
+		return
+	}
+	if err := srv.ReplaceCertificate(tls.Certificate{Certificate: cert.Certificate, PrivateKey: other.PrivateKey}); err != ua.BadCertificateInvalid {
+		t.Errorf("ReplaceCertificate with mismatched key. want: %s, got: %v", ua.BadCertificateInvalid, err)
+	}
+	if err := srv.ReplaceCertificate(cert); err != nil {
+		t.Error(errors.Wrap(err, "Error replacing certificate"))
+		return
+	}
+
+	res, err := client.GetEndpoints(ctx, &ua.GetEndpointsRequest{EndpointURL: serverURL})
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error getting endpoints"))
+		return
+	}
+	for _, ep := range res.Endpoints {
+		if string(ep.ServerCertificate) != string(cert.Certificate[0]) {
+			t.Errorf("Endpoint %s does not advertise the new certificate.", ep.SecurityPolicyURI)
+		}
+	}
+
+	// existing channel keeps working.
+	req := &ua.ReadRequest{NodesToRead: []ua.ReadValueID{{NodeID: ua.VariableIDServerServerStatusState, AttributeID: ua.AttributeIDValue}}}
+	if _, err := chA.Read(ctx, req); err != nil {
+		t.Error(errors.Wrap(err, "Error reading on existing channel"))
+	}
+
+	// new channel uses the new certificate.
+	chB, err := client.Dial(ctx, serverURL, client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"), client.WithInsecureSkipVerify(), client.WithSecurityPolicyURI(ua.SecurityPolicyURIBasic256Sha256))
+	if err != nil {
+		t.Error(errors.Wrap(err, "Error opening client with new certificate"))
+		return
+	}
+	defer chB.Close(ctx)
+	if _, err := chB.Read(ctx, req); err != nil {
+		t.Error(errors.Wrap(err, "Error reading on new channel"))
+	}
+}
+
+// TestServerConfigurationPushCertificate tests the methods of the ServerConfiguration that a GDS calls
+// to push a new application instance certificate, and the list of rejected client certificates.
+func TestServerConfigurationPushCertificate(t *testing.T) {
+	serverURL := "opc.tcp://127.0.0.1:46032"
+	dir := t.TempDir()
+	if err := os.Mkdir(dir+"/trusted", 0755); err != nil {
+		t.Fatal(errors.Wrap(err, "Error creating trust list"))
+	}
+	for _, name := range []string{"server.crt", "server.key", "trusted/client.crt"} {
+		buf, err := os.ReadFile("./pki/" + filepath.Base(name))
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "Error reading certificate"))
+		}
+		if err := os.WriteFile(dir+"/"+name, buf, 0600); err != nil {
+			t.Fatal(errors.Wrap(err, "Error writing certificate"))
+		}
+	}
+	rules := []server.IdentityMappingRule{
+		{
+			NodeID:              ua.ObjectIDWellKnownRoleAuthenticatedUser,
+			Identities:          []ua.IdentityMappingRuleType{{CriteriaType: ua.IdentityCriteriaTypeAuthenticatedUser}},
+			ApplicationsExclude: true,
+			EndpointsExclude:    true,
+		},
+		{
+			NodeID:              ua.ObjectIDWellKnownRoleSecurityAdmin,
+			Identities:          []ua.IdentityMappingRuleType{{CriteriaType: ua.IdentityCriteriaTypeUserName, Criteria: "admin"}},
+			ApplicationsExclude: true,
+			EndpointsExclude:    true,
+		},
+	}
+	srv, err := server.New(
+		ua.ApplicationDescription{ApplicationURI: "urn:127.0.0.1:testserver", ApplicationName: ua.NewLocalizedText("testserver", "")},
+		dir+"/server.crt",
+		dir+"/server.key",
+		serverURL,
+		server.WithAuthenticateUserNameIdentityFunc(func(userIdentity ua.UserNameIdentity, applicationURI string, endpointURL string) error {
+			if userIdentity.Password != "secret" {
+				return ua.BadUserAccessDenied
+			}
+			return nil
+		}),
+		server.WithRolesProvider(server.NewRulesBasedRolesProvider(rules)),
+		server.WithCertificateValidator(&ua.CertificateValidator{TrustedCertsPath: dir + "/trusted"}),
+		server.WithRejectedCertificatesPath(dir+"/rejected"),
+	)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error constructing server"))
+	}
+	defer srv.Close()
+	go srv.ListenAndServe()
+	time.Sleep(100 * time.Millisecond)
+
+	ctx := context.Background()
+	clientCert := client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key")
+
+	// an untrusted client is rejected and added to the rejected list.
+	if err := createNewCertificate("untrusted-client", dir+"/untrusted.crt", dir+"/untrusted.key"); err != nil {
+		t.Fatal(errors.Wrap(err, "Error creating certificate"))
+	}
+	if ch, err := client.Dial(ctx, serverURL, client.WithClientCertificateFile(dir+"/untrusted.crt", dir+"/untrusted.key"), client.WithInsecureSkipVerify()); err == nil {
+		ch.Close(ctx)
+		t.Error("Dial with untrusted certificate should fail.")
+	}
+	files, _ := os.ReadDir(dir + "/rejected")
+	if len(files) != 1 {
+		t.Errorf("Rejected certificates saved. want: 1, got: %d", len(files))
+	}
+
+	// call calls a method of the ServerConfiguration.
+	call := func(ch *client.Client, method ua.NodeID, args ...ua.Variant) ua.CallMethodResult {
+		res, err := ch.Call(ctx, &ua.CallRequest{
+			MethodsToCall: []ua.CallMethodRequest{{ObjectID: ua.ObjectIDServerConfiguration, MethodID: method, InputArguments: args}},
+		})
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "Error calling method"))
+		}
+		return res.Results[0]
+	}
+
+	user, err := client.Dial(ctx, serverURL, clientCert, client.WithInsecureSkipVerify(), client.WithUserNameIdentity("user", "secret"))
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening client"))
+	}
+	defer user.Close(ctx)
+	if res := call(user, ua.MethodIDServerConfigurationGetRejectedList); res.StatusCode != ua.BadNotExecutable {
+		t.Errorf("GetRejectedList by user. want: %s, got: %s", ua.BadNotExecutable, res.StatusCode)
+	}
+
+	admin, err := client.Dial(ctx, serverURL, clientCert, client.WithInsecureSkipVerify(), client.WithUserNameIdentity("admin", "secret"))
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening client"))
+	}
+	defer admin.Close(ctx)
+	res := call(admin, ua.MethodIDServerConfigurationGetRejectedList)
+	if res.StatusCode != ua.Good {
+		t.Fatalf("GetRejectedList. want: Good, got: %s", res.StatusCode)
+	}
+	if list, _ := res.OutputArguments[0].([]ua.ByteString); len(list) != 1 {
+		t.Errorf("GetRejectedList. want: 1 certificate, got: %d", len(list))
+	}
+
+	group, certType := ua.ObjectIDServerConfigurationCertificateGroupsDefaultApplicationGroup, ua.ObjectTypeIDRsaSha256ApplicationCertificateType
+	res = call(admin, ua.MethodIDServerConfigurationCreateSigningRequest, group, certType, "", true, ua.ByteString(make([]byte, 32)))
+	if res.StatusCode != ua.Good {
+		t.Fatalf("CreateSigningRequest. want: Good, got: %s", res.StatusCode)
+	}
+	der, _ := res.OutputArguments[0].(ua.ByteString)
+	csr, err := x509.ParseCertificateRequest([]byte(der))
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error parsing signing request"))
+	}
+	if err := csr.CheckSignature(); err != nil {
+		t.Error(errors.Wrap(err, "Error checking signing request"))
+	}
+	if len(csr.URIs) != 1 || csr.URIs[0].String() != "urn:127.0.0.1:testserver" {
+		t.Errorf("CreateSigningRequest URIs. want: [urn:127.0.0.1:testserver], got: %v", csr.URIs)
+	}
+
+	// the CA of the GDS issues the certificate.
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error creating key"))
+	}
+	caTemplate := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "testca"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDer, err := x509.CreateCertificate(rand.Reader, &caTemplate, &caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error creating certificate"))
+	}
+	ca, _ := x509.ParseCertificate(caDer)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      csr.Subject,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment | x509.KeyUsageKeyEncipherment | x509.KeyUsageDataEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     csr.DNSNames,
+		IPAddresses:  csr.IPAddresses,
+		URIs:         csr.URIs,
+	}
+	certDer, err := x509.CreateCertificate(rand.Reader, &template, ca, csr.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error creating certificate"))
+	}
+
+	// the certificate must contain the ApplicationURI.
+	otherURI, _ := url.Parse("urn:127.0.0.1:otherserver")
+	otherTemplate := template
+	otherTemplate.SerialNumber = big.NewInt(3)
+	otherTemplate.URIs = []*url.URL{otherURI}
+	otherDer, err := x509.CreateCertificate(rand.Reader, &otherTemplate, ca, csr.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error creating certificate"))
+	}
+	res = call(admin, ua.MethodIDServerConfigurationUpdateCertificate, group, certType, ua.ByteString(otherDer), []ua.ByteString{ua.ByteString(caDer)}, "", ua.ByteString(""))
+	if res.StatusCode != ua.BadCertificateURIInvalid {
+		t.Errorf("UpdateCertificate with other URI. want: %s, got: %s", ua.BadCertificateURIInvalid, res.StatusCode)
+	}
+
+	// the certificate must chain to the issuers, or to the trust list.
+	res = call(admin, ua.MethodIDServerConfigurationUpdateCertificate, group, certType, ua.ByteString(certDer), []ua.ByteString{}, "", ua.ByteString(""))
+	if res.StatusCode != ua.BadCertificateChainIncomplete {
+		t.Errorf("UpdateCertificate without issuers. want: %s, got: %s", ua.BadCertificateChainIncomplete, res.StatusCode)
+	}
+	if err := os.WriteFile(dir+"/trusted/testca.der", caDer, 0600); err != nil {
+		t.Fatal(errors.Wrap(err, "Error writing certificate"))
+	}
+	res = call(admin, ua.MethodIDServerConfigurationUpdateCertificate, group, certType, ua.ByteString(certDer), []ua.ByteString{}, "", ua.ByteString(""))
+	if res.StatusCode != ua.Good {
+		t.Errorf("UpdateCertificate with trusted issuer. want: Good, got: %s", res.StatusCode)
+	}
+	res = call(admin, ua.MethodIDServerConfigurationUpdateCertificate, group, certType, ua.ByteString(certDer), []ua.ByteString{ua.ByteString(caDer)}, "", ua.ByteString(""))
+	if res.StatusCode != ua.Good {
+		t.Fatalf("UpdateCertificate. want: Good, got: %s", res.StatusCode)
+	}
+	if required, _ := res.OutputArguments[0].(bool); !required {
+		t.Error("UpdateCertificate should require ApplyChanges.")
+	}
+	if res := call(admin, ua.MethodIDServerConfigurationApplyChanges); res.StatusCode != ua.Good {
+		t.Fatalf("ApplyChanges. want: Good, got: %s", res.StatusCode)
+	}
+
+	eps, err := client.GetEndpoints(ctx, &ua.GetEndpointsRequest{EndpointURL: serverURL})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error getting endpoints"))
+	}
+	for _, ep := range eps.Endpoints {
+		if string(ep.ServerCertificate) != string(certDer) {
+			t.Errorf("Endpoint %s does not advertise the new certificate.", ep.SecurityPolicyURI)
+		}
+	}
+	saved, err := tls.LoadX509KeyPair(dir+"/server.crt", dir+"/server.key")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error loading saved certificate"))
+	}
+	if string(saved.Certificate[0]) != string(certDer) || len(saved.Certificate) != 2 {
+		t.Error("ApplyChanges should save the new certificate and its issuers.")
+	}
+	if tmp, _ := filepath.Glob(dir + "/*.tmp"); len(tmp) != 0 {
+		t.Errorf("ApplyChanges should remove the temporary files, got: %v", tmp)
+	}
+
+	// the existing session keeps working.
+	if res := call(admin, ua.MethodIDServerConfigurationGetRejectedList); res.StatusCode != ua.Good {
+		t.Errorf("GetRejectedList after ApplyChanges. want: Good, got: %s", res.StatusCode)
+	}
+}
+
+// testProxy forwards the connections accepted by a listener to a server, so a test can drop them.
+type testProxy struct {
+	sync.Mutex
+	listener net.Listener
+	target   string
+	conns    []net.Conn
+}
+
+// newTestProxy starts forwarding the connections to the address to the target address.
+func newTestProxy(address, target string) (*testProxy, error) {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	p := &testProxy{listener: l, target: target}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			remote, err := net.Dial("tcp", p.target)
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			p.Lock()
+			p.conns = append(p.conns, conn, remote)
+			p.Unlock()
+			go io.Copy(remote, conn)
+			go io.Copy(conn, remote)
+		}
+	}()
+	return p, nil
+}
+
+// drop closes the forwarded connections.
+func (p *testProxy) drop() {
+	p.Lock()
+	defer p.Unlock()
+	for _, conn := range p.conns {
+		conn.Close()
+	}
+	p.conns = nil
+}
+
+// Close stops the proxy.
+func (p *testProxy) Close() {
+	p.listener.Close()
+	p.drop()
+}
+
+// TestAutoReconnect tests a client that reconnects when the connection is lost. The session is
+// activated on the new secure channel if the server still has it, or else the subscriptions are
+// recreated on a new session. In both cases, the channels of the monitored items keep delivering.
+func TestAutoReconnect(t *testing.T) {
+	serverURL := "opc.tcp://127.0.0.1:46033"
+	newServer := func() (*server.Server, error) {
+		srv, err := server.New(
+			ua.ApplicationDescription{ApplicationURI: "urn:127.0.0.1:testserver", ApplicationName: ua.NewLocalizedText("testserver", "")},
+			"./pki/server.crt",
+			"./pki/server.key",
+			serverURL,
+			server.WithAnonymousIdentity(true),
+			server.WithInsecureSkipVerify(),
+		)
+		if err != nil {
+			return nil, err
+		}
+		go srv.ListenAndServe()
+		time.Sleep(100 * time.Millisecond)
+		return srv, nil
+	}
+	srv, err := newServer()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error constructing server"))
+	}
+	defer func() { srv.Close() }()
+	proxy, err := newTestProxy("127.0.0.1:46034", "127.0.0.1:46033")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error starting proxy"))
+	}
+	defer proxy.Close()
+
+	ctx := context.Background()
+	states := make(chan client.ConnectionState, 16)
+	ch, err := client.Dial(
+		ctx,
+		"opc.tcp://127.0.0.1:46034",
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithAutoReconnect(func(state client.ConnectionState, err error) {
+			states <- state
+		}),
+		client.WithReconnectInterval(200),
+	)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening client"))
+	}
+	defer ch.Close(ctx)
+	sub, err := ch.Subscribe(ctx, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error subscribing"))
+	}
+	values, err := sub.Monitor(ctx, ua.VariableIDServerServerStatusCurrentTime, ua.AttributeIDValue)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error monitoring"))
+	}
+
+	// waitConnected waits for the client to report Reconnecting and then Connected.
+	waitConnected := func() {
+		want := client.Reconnecting
+		for {
+			select {
+			case state := <-states:
+				if state == client.Connected && want == client.Connected {
+					return
+				}
+				if state == client.Reconnecting {
+					want = client.Connected
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatalf("Timeout waiting for %s.", want)
+			}
+		}
+	}
+	// waitValue waits for a data change that was sampled after the time.
+	waitValue := func(after time.Time) {
+		for {
+			select {
+			case v, ok := <-values:
+				if !ok {
+					t.Fatalf("Monitored item closed. err: %v", sub.Err())
+				}
+				if v.Value.(time.Time).After(after) {
+					return
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("Timeout waiting for data change.")
+			}
+		}
+	}
+	waitValue(time.Time{})
+
+	// the connection is lost, the session is reactivated.
+	sessionID := ch.SessionID()
+	subscriptionID := sub.ID()
+	proxy.drop()
+	waitConnected()
+	if ch.SessionID() != sessionID {
+		t.Errorf("Error reactivating session. want: %s, got: %s", sessionID, ch.SessionID())
+	}
+	if sub.ID() != subscriptionID {
+		t.Errorf("Error keeping subscription. want: %d, got: %d", subscriptionID, sub.ID())
+	}
+	waitValue(time.Now())
+
+	// the server restarts, the subscription is recreated on a new session.
+	srv.Close()
+	proxy.drop()
+	time.Sleep(500 * time.Millisecond)
+	if srv, err = newServer(); err != nil {
+		t.Fatal(errors.Wrap(err, "Error constructing server"))
+	}
+	waitConnected()
+	if ch.SessionID() == sessionID {
+		t.Error("Error creating new session.")
+	}
+	waitValue(time.Now())
+	req := &ua.ReadRequest{NodesToRead: []ua.ReadValueID{{NodeID: ua.VariableIDServerServerStatusState, AttributeID: ua.AttributeIDValue}}}
+	if _, err := ch.Read(ctx, req); err != nil {
+		t.Error(errors.Wrap(err, "Error reading after reconnect"))
+	}
+}
+
+// syncBuffer is a bytes.Buffer that may be written by several goroutines.
+type syncBuffer struct {
+	sync.Mutex
+	buf strings.Builder
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.Write(p)
+}
+
+// records returns the log records written as JSON lines.
+func (b *syncBuffer) records() []map[string]interface{} {
+	b.Lock()
+	defer b.Unlock()
+	records := []map[string]interface{}{}
+	for _, line := range strings.Split(b.buf.String(), "\n") {
+		var r map[string]interface{}
+		if json.Unmarshal([]byte(line), &r) == nil {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+// TestLogger tests the structured logs of the server and client for a session and a service fault.
+func TestLogger(t *testing.T) {
+	serverURL := "opc.tcp://127.0.0.1:46035"
+	serverLog, clientLog := &syncBuffer{}, &syncBuffer{}
+	srv, err := server.New(
+		ua.ApplicationDescription{ApplicationURI: "urn:127.0.0.1:testserver", ApplicationName: ua.NewLocalizedText("testserver", "")},
+		"./pki/server.crt",
+		"./pki/server.key",
+		serverURL,
+		server.WithAnonymousIdentity(true),
+		server.WithAuthenticateUserNameIdentityFunc(func(ua.UserNameIdentity, string, string) error {
+			return ua.BadUserAccessDenied
+		}),
+		server.WithInsecureSkipVerify(),
+		server.WithLogger(slog.New(slog.NewJSONHandler(serverLog, nil))),
+	)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error constructing server"))
+	}
+	defer srv.Close()
+	go srv.ListenAndServe()
+	time.Sleep(100 * time.Millisecond)
+
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		serverURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithLogger(slog.New(slog.NewJSONHandler(clientLog, nil))),
+	)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening client"))
+	}
+	if _, err := ch.Read(ctx, &ua.ReadRequest{}); err != ua.BadNothingToDo {
+		t.Errorf("Read with no nodes. want: %s, got: %v", ua.BadNothingToDo, err)
+	}
+	sessionID := fmt.Sprint(ch.SessionID())
+	if err := ch.Close(ctx); err != nil {
+		t.Error(errors.Wrap(err, "Error closing client"))
+	}
+	if ch, err := client.Dial(
+		ctx,
+		serverURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "wrong"),
+	); err == nil {
+		ch.Close(ctx)
+		t.Error("Error opening client. want: rejected, got: activated")
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// check finds the record with the message, and compares its attributes.
+	check := func(name string, log *syncBuffer, msg string, attrs map[string]interface{}) {
+		for _, r := range log.records() {
+			if r["msg"] != msg {
+				continue
+			}
+			for k, v := range attrs {
+				if r[k] != v {
+					t.Errorf("Error logging %s %q. want %s: %v, got: %v", name, msg, k, v, r[k])
+				}
+			}
+			if _, ok := r[ua.LogKeyChannelID]; !ok {
+				t.Errorf("Error logging %s %q. missing %s", name, msg, ua.LogKeyChannelID)
+			}
+			return
+		}
+		t.Errorf("Error logging %s. missing %q", name, msg)
+	}
+	check("server", serverLog, "Opened secure channel", nil)
+	check("server", serverLog, "Created session", map[string]interface{}{ua.LogKeySessionID: sessionID})
+	check("server", serverLog, "Activated session", map[string]interface{}{ua.LogKeySessionID: sessionID})
+	check("server", serverLog, "Service fault", map[string]interface{}{ua.LogKeyService: "Read", ua.LogKeyStatusCode: "0x800F0000"})
+	check("server", serverLog, "Closed session", map[string]interface{}{ua.LogKeySessionID: sessionID})
+	check("server", serverLog, "Rejected session activation", map[string]interface{}{"user": "root", ua.LogKeyStatusCode: "0x801F0000"})
+	check("server", serverLog, "Closed secure channel", nil)
+	check("client", clientLog, "Opened secure channel", nil)
+	check("client", clientLog, "Created session", map[string]interface{}{ua.LogKeySessionID: sessionID})
+	check("client", clientLog, "Activated session", map[string]interface{}{ua.LogKeySessionID: sessionID})
+	check("client", clientLog, "Closed secure channel", nil)
+	for _, r := range clientLog.records() {
+		if r["msg"] == "Service fault" && (r[ua.LogKeyService] != "Read" || r[ua.LogKeyStatusCode] != "0x800F0000") {
+			t.Errorf("Error logging client service fault. got: %v", r)
+		}
+	}
+}
+
+// TestReadMaxAge tests that the ReadValueHandler is called only if the value it returned is older than the MaxAge.
+func TestReadMaxAge(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	id := ua.ParseNodeID("ns=2;s=Test.MaxAge")
+	node := server.NewVariableNode(
+		id,
+		ua.NewQualifiedName(2, "MaxAge"),
+		ua.NewLocalizedText("MaxAge", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+		},
+		ua.DataValue{},
+		ua.DataTypeIDInt32,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentRead|ua.AccessLevelsCurrentWrite,
+		0,
+		false,
+		nil,
+	)
+	var calls int32
+	node.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
+		return ua.NewDataValue(atomic.AddInt32(&calls, 1), 0, time.Now(), 0, time.Now(), 0)
+	})
+	node.SetWriteValueHandler(func(ctx context.Context, req ua.WriteValue) (ua.DataValue, ua.StatusCode) {
+		return req.Value, ua.Good
+	})
+	if err := nm.AddNode(node); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(node, false)
+
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening client"))
+	}
+	defer ch.Close(ctx)
+
+	// read returns the value of the node, read with the maxAge in milliseconds.
+	read := func(maxAge float64) int32 {
+		res, err := ch.Read(ctx, &ua.ReadRequest{
+			MaxAge:      maxAge,
+			NodesToRead: []ua.ReadValueID{{NodeID: id, AttributeID: ua.AttributeIDValue}},
+		})
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "Error reading"))
+		}
+		v, _ := res.Results[0].Value.(int32)
+		return v
+	}
+	cases := []struct {
+		name   string
+		maxAge float64
+		want   int32
+	}{
+		{"first read", 60000, 1},
+		{"cached read", 60000, 1},
+		{"maxAge 0", 0, 2},
+		{"cached read after maxAge 0", 60000, 2},
+	}
+	for _, c := range cases {
+		if got := read(c.maxAge); got != c.want {
+			t.Errorf("Error reading %s. want: %d, got: %d", c.name, c.want, got)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := read(10); got != 3 {
+		t.Errorf("Error reading expired value. want: %d, got: %d", 3, got)
+	}
+	res, err := ch.Write(ctx, &ua.WriteRequest{
+		NodesToWrite: []ua.WriteValue{
+			{NodeID: id, AttributeID: ua.AttributeIDValue, Value: ua.NewDataValue(int32(0), 0, time.Time{}, 0, time.Time{}, 0)},
+		},
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error writing"))
+	}
+	if res.Results[0] != ua.Good {
+		t.Fatalf("Error writing. want: %s, got: %s", ua.Good, res.Results[0])
+	}
+	if got := read(60000); got != 4 {
+		t.Errorf("Error reading after write. want: %d, got: %d", 4, got)
+	}
 
-	ch.Close(ctx)
+	// only the whole value is cached, and the index range is applied to the cached value.
+	arrayID := ua.ParseNodeID("ns=2;s=Test.MaxAgeArray")
+	arrayNode := server.NewVariableNode(
+		arrayID,
+		ua.NewQualifiedName(2, "MaxAgeArray"),
+		ua.NewLocalizedText("MaxAgeArray", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+		},
+		ua.DataValue{},
+		ua.DataTypeIDInt32,
+		ua.ValueRankOneDimension,
+		[]uint32{0},
+		ua.AccessLevelsCurrentRead,
+		0,
+		false,
+		nil,
+	)
+	var arrayCalls int32
+	arrayNode.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
+		if req.IndexRange != "" {
+			return ua.NewDataValue(nil, ua.BadIndexRangeInvalid, time.Time{}, 0, time.Now(), 0)
+		}
+		n := atomic.AddInt32(&arrayCalls, 1)
+		return ua.NewDataValue([]int32{n, 10 * n, 100 * n}, 0, time.Now(), 0, time.Now(), 0)
+	})
+	if err := nm.AddNode(arrayNode); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(arrayNode, false)
+	res2, err := ch.Read(ctx, &ua.ReadRequest{
+		MaxAge: 60000,
+		NodesToRead: []ua.ReadValueID{
+			{NodeID: arrayID, AttributeID: ua.AttributeIDValue, IndexRange: "1"},
+			{NodeID: arrayID, AttributeID: ua.AttributeIDValue, IndexRange: "0:1"},
+			{NodeID: arrayID, AttributeID: ua.AttributeIDValue},
+		},
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error reading"))
+	}
+	want := []ua.Variant{[]int32{10}, []int32{1, 10}, []int32{1, 10, 100}}
+	for i, r := range res2.Results {
+		if !reflect.DeepEqual(r.Value, want[i]) {
+			t.Errorf("Error reading index range %d. want: %v, got: %v %s", i, want[i], r.Value, r.StatusCode)
+		}
+	}
+	if c := atomic.LoadInt32(&arrayCalls); c != 1 {
+		t.Errorf("Error reading index ranges with MaxAge. want: 1 call, got: %d", c)
+	}
+
+	// a read with maxAge 0 does not wait for a slow read that fills the cache.
+	slowID := ua.ParseNodeID("ns=2;s=Test.MaxAgeSlow")
+	slowNode := server.NewVariableNode(
+		slowID,
+		ua.NewQualifiedName(2, "MaxAgeSlow"),
+		ua.NewLocalizedText("MaxAgeSlow", ""),
+		ua.NewLocalizedText("", ""),
+		nil,
+		[]ua.Reference{
+			{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+		},
+		ua.DataValue{},
+		ua.DataTypeIDInt32,
+		ua.ValueRankScalar,
+		[]uint32{},
+		ua.AccessLevelsCurrentRead,
+		0,
+		false,
+		nil,
+	)
+	var slowCalls int32
+	release := make(chan struct{})
+	slowNode.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
+		n := atomic.AddInt32(&slowCalls, 1)
+		if n == 1 {
+			<-release
+		}
+		return ua.NewDataValue(n, 0, time.Now(), 0, time.Now(), 0)
+	})
+	if err := nm.AddNode(slowNode); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(slowNode, false)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ch.Read(ctx, &ua.ReadRequest{MaxAge: 60000, NodesToRead: []ua.ReadValueID{{NodeID: slowID, AttributeID: ua.AttributeIDValue}}})
+	}()
+	for atomic.LoadInt32(&slowCalls) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	ctx2, cancel := context.WithTimeout(ctx, 5*time.Second)
+	res3, err := ch.Read(ctx2, &ua.ReadRequest{NodesToRead: []ua.ReadValueID{{NodeID: slowID, AttributeID: ua.AttributeIDValue}}})
+	cancel()
+	close(release)
+	<-done
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error reading with maxAge 0 during a slow read"))
+	}
+	if res3.Results[0].Value != int32(2) {
+		t.Errorf("Error reading with maxAge 0 during a slow read. want: 2, got: %v", res3.Results[0].Value)
+	}
 }
-*/
 
-func createNewCertificate(appName, certFile, keyFile string) error {
+// TestQuery tests finding the instances of a type that match a filter, with continuation points.
+func TestQuery(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	pumpTypeID := ua.ParseNodeID("ns=2;s=Test.PumpType")
+	fastPumpTypeID := ua.ParseNodeID("ns=2;s=Test.FastPumpType")
+	speedName := ua.NewQualifiedName(2, "Speed")
+	// newSpeed returns a Speed property with the value.
+	newSpeed := func(id ua.NodeID, value float64) server.Node {
+		return server.NewVariableNode(
+			id,
+			speedName,
+			ua.NewLocalizedText("Speed", ""),
+			ua.NewLocalizedText("", ""),
+			nil,
+			[]ua.Reference{
+				{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDPropertyType)},
+			},
+			ua.NewDataValue(value, 0, time.Now(), 0, time.Now(), 0),
+			ua.DataTypeIDDouble,
+			ua.ValueRankScalar,
+			[]uint32{},
+			ua.AccessLevelsCurrentRead,
+			0,
+			false,
+			nil,
+		)
+	}
+	nodes := []server.Node{
+		server.NewObjectTypeNode(
+			pumpTypeID,
+			ua.NewQualifiedName(2, "PumpType"),
+			ua.NewLocalizedText("PumpType", ""),
+			ua.NewLocalizedText("", ""),
+			nil,
+			[]ua.Reference{
+				{ReferenceTypeID: ua.ReferenceTypeIDHasSubtype, IsInverse: true, TargetID: ua.NewExpandedNodeID(ua.ObjectTypeIDBaseObjectType)},
+				{ReferenceTypeID: ua.ReferenceTypeIDHasProperty, TargetID: ua.NewExpandedNodeID(ua.ParseNodeID("ns=2;s=Test.PumpType.Speed"))},
+			},
+			false,
+		),
+		newSpeed(ua.ParseNodeID("ns=2;s=Test.PumpType.Speed"), 0),
+		server.NewObjectTypeNode(
+			fastPumpTypeID,
+			ua.NewQualifiedName(2, "FastPumpType"),
+			ua.NewLocalizedText("FastPumpType", ""),
+			ua.NewLocalizedText("", ""),
+			nil,
+			[]ua.Reference{
+				{ReferenceTypeID: ua.ReferenceTypeIDHasSubtype, IsInverse: true, TargetID: ua.NewExpandedNodeID(pumpTypeID)},
+			},
+			false,
+		),
+	}
+	for i, pump := range []struct {
+		typeID ua.NodeID
+		speed  float64
+	}{{pumpTypeID, 10}, {pumpTypeID, 50}, {fastPumpTypeID, 100}} {
+		name := fmt.Sprintf("Pump%d", i+1)
+		speedID := ua.ParseNodeID("ns=2;s=Test." + name + ".Speed")
+		nodes = append(nodes,
+			server.NewObjectNode(
+				ua.ParseNodeID("ns=2;s=Test."+name),
+				ua.NewQualifiedName(2, name),
+				ua.NewLocalizedText(name, ""),
+				ua.NewLocalizedText("", ""),
+				nil,
+				[]ua.Reference{
+					{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(pump.typeID)},
+					{ReferenceTypeID: ua.ReferenceTypeIDHasProperty, TargetID: ua.NewExpandedNodeID(speedID)},
+				},
+				0,
+			),
+			newSpeed(speedID, pump.speed),
+		)
+	}
+	if err := nm.AddNodes(nodes...); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding nodes"))
+	}
+	defer nm.DeleteNodes(nodes, false)
 
-	// Create a keypair.
-	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
 	if err != nil {
-		return ua.BadCertificateInvalid
+		t.Fatal(errors.Wrap(err, "Error opening client"))
 	}
+	defer ch.Close(ctx)
 
-	// Create a certificate.
-	host, _ := os.Hostname()
-	applicationURI, _ := url.Parse(fmt.Sprintf("urn:%s:%s", host, appName))
-	serialNumber, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
-	subjectKeyHash := sha1.New()
-	subjectKeyHash.Write(key.PublicKey.N.Bytes())
-	subjectKeyId := subjectKeyHash.Sum(nil)
+	speed := ua.SimpleAttributeOperand{TypeDefinitionID: pumpTypeID, BrowsePath: []ua.QualifiedName{speedName}, AttributeID: ua.AttributeIDValue}
+	nodeTypes := []ua.NodeTypeDescription{
+		{
+			TypeDefinitionNode: ua.NewExpandedNodeID(pumpTypeID),
+			IncludeSubTypes:    true,
+			DataToReturn: []ua.QueryDataDescription{
+				{AttributeID: ua.AttributeIDBrowseName},
+				{RelativePath: ua.RelativePath{Elements: []ua.RelativePathElement{{ReferenceTypeID: ua.ReferenceTypeIDHasProperty, TargetName: speedName}}}, AttributeID: ua.AttributeIDValue},
+			},
+		},
+	}
+	res, err := ch.QueryFirst(ctx, &ua.QueryFirstRequest{
+		NodeTypes: nodeTypes,
+		Filter: ua.ContentFilter{
+			Elements: []ua.ContentFilterElement{
+				{FilterOperator: ua.FilterOperatorGreaterThan, FilterOperands: []ua.ExtensionObject{speed, ua.LiteralOperand{Value: 20.0}}},
+			},
+		},
+		MaxDataSetsToReturn: 1,
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error querying"))
+	}
+	if len(res.QueryDataSets) != 1 || len(res.ContinuationPoint) == 0 {
+		t.Fatalf("Error querying first. want: 1 data set and a continuation point, got: %+v", res)
+	}
+	if ds := res.QueryDataSets[0]; ds.NodeID.NodeID != ua.ParseNodeID("ns=2;s=Test.Pump2") || ds.Values[0] != ua.NewQualifiedName(2, "Pump2") || ds.Values[1] != 50.0 {
+		t.Errorf("Error querying first. want: Pump2, got: %+v", ds)
+	}
+	res2, err := ch.QueryNext(ctx, &ua.QueryNextRequest{ContinuationPoint: res.ContinuationPoint})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error querying next"))
+	}
+	if len(res2.QueryDataSets) != 1 || len(res2.RevisedContinuationPoint) != 0 {
+		t.Fatalf("Error querying next. want: 1 data set and no continuation point, got: %+v", res2)
+	}
+	if ds := res2.QueryDataSets[0]; ds.NodeID.NodeID != ua.ParseNodeID("ns=2;s=Test.Pump3") || ds.TypeDefinitionNode.NodeID != fastPumpTypeID || ds.Values[1] != 100.0 {
+		t.Errorf("Error querying next. want: Pump3, got: %+v", ds)
+	}
+	if _, err := ch.QueryNext(ctx, &ua.QueryNextRequest{ContinuationPoint: res.ContinuationPoint}); err != ua.BadContinuationPointInvalid {
+		t.Errorf("Error querying released continuation point. want: %s, got: %v", ua.BadContinuationPointInvalid, err)
+	}
 
-	template := x509.Certificate{
-		SerialNumber:          serialNumber,
-		Subject:               pkix.Name{CommonName: appName},
-		SubjectKeyId:          subjectKeyId,
-		AuthorityKeyId:        subjectKeyId,
-		NotBefore:             time.Now(),
-		NotAfter:              time.Now().AddDate(1, 0, 0),
-		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment | x509.KeyUsageKeyEncipherment | x509.KeyUsageDataEncipherment | x509.KeyUsageCertSign,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
-		BasicConstraintsValid: true,
-		DNSNames:              []string{host},
-		URIs:                  []*url.URL{applicationURI},
+	// without subtypes and filter, all instances of the type are returned.
+	nodeTypes[0].IncludeSubTypes = false
+	res, err = ch.QueryFirst(ctx, &ua.QueryFirstRequest{NodeTypes: nodeTypes})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error querying"))
+	}
+	if len(res.QueryDataSets) != 2 || len(res.ContinuationPoint) != 0 {
+		t.Errorf("Error querying without subtypes. want: 2 data sets, got: %+v", res)
 	}
 
-	rawcrt, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	// an operand that cannot be resolved is returned in the FilterResult.
+	res, err = ch.QueryFirst(ctx, &ua.QueryFirstRequest{
+		NodeTypes: nodeTypes,
+		Filter: ua.ContentFilter{
+			Elements: []ua.ContentFilterElement{
+				{FilterOperator: ua.FilterOperatorIsNull, FilterOperands: []ua.ExtensionObject{
+					ua.SimpleAttributeOperand{TypeDefinitionID: pumpTypeID, BrowsePath: ua.ParseBrowsePath("2:Unknown"), AttributeID: ua.AttributeIDValue},
+				}},
+			},
+		},
+	})
+	if err != ua.BadContentFilterInvalid {
+		t.Fatalf("Error querying with invalid filter. want: %s, got: %v", ua.BadContentFilterInvalid, err)
+	}
+	if r := res.FilterResult.ElementResults; len(r) != 1 || r[0].StatusCode != ua.BadFilterOperandInvalid || len(r[0].OperandStatusCodes) != 1 || r[0].OperandStatusCodes[0] != ua.BadNodeIDUnknown {
+		t.Errorf("Error querying with invalid filter. got: %+v", res.FilterResult)
+	}
+
+	// a node that is not a type is returned in the ParsingResults.
+	res, err = ch.QueryFirst(ctx, &ua.QueryFirstRequest{
+		NodeTypes: []ua.NodeTypeDescription{{TypeDefinitionNode: ua.NewExpandedNodeID(ua.ParseNodeID("ns=2;s=Test.Pump1"))}},
+	})
+	if err != ua.BadInvalidArgument {
+		t.Fatalf("Error querying with invalid type. want: %s, got: %v", ua.BadInvalidArgument, err)
+	}
+	if len(res.ParsingResults) != 1 || res.ParsingResults[0].StatusCode != ua.BadNotTypeDefinition {
+		t.Errorf("Error querying with invalid type. want: %s, got: %+v", ua.BadNotTypeDefinition, res.ParsingResults)
+	}
+
+	// a view is not supported.
+	view := server.NewViewNode(ua.ParseNodeID("ns=2;s=Test.PumpView"), ua.NewQualifiedName(2, "PumpView"), ua.NewLocalizedText("PumpView", ""), ua.NewLocalizedText("", ""), nil, nil, true, 0)
+	if err := nm.AddNode(view); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding node"))
+	}
+	defer nm.DeleteNode(view, false)
+	for id, want := range map[ua.NodeID]ua.StatusCode{view.NodeID(): ua.BadServiceUnsupported, pumpTypeID: ua.BadViewIDUnknown} {
+		if _, err := ch.QueryFirst(ctx, &ua.QueryFirstRequest{View: ua.ViewDescription{ViewID: id}, NodeTypes: nodeTypes}); err != want {
+			t.Errorf("Error querying view %s. want: %s, got: %v", id, want, err)
+		}
+	}
+
+	// without MaxDataSetsToReturn, the server limits the data sets.
+	manyTypeID := ua.ParseNodeID("ns=2;s=Test.ManyType")
+	many := []server.Node{
+		server.NewObjectTypeNode(
+			manyTypeID,
+			ua.NewQualifiedName(2, "ManyType"),
+			ua.NewLocalizedText("ManyType", ""),
+			ua.NewLocalizedText("", ""),
+			nil,
+			[]ua.Reference{
+				{ReferenceTypeID: ua.ReferenceTypeIDHasSubtype, IsInverse: true, TargetID: ua.NewExpandedNodeID(ua.ObjectTypeIDBaseObjectType)},
+			},
+			false,
+		),
+	}
+	for i := 0; i < 1500; i++ {
+		name := fmt.Sprintf("Many%d", i)
+		many = append(many, server.NewObjectNode(
+			ua.ParseNodeID("ns=2;s=Test."+name),
+			ua.NewQualifiedName(2, name),
+			ua.NewLocalizedText(name, ""),
+			ua.NewLocalizedText("", ""),
+			nil,
+			[]ua.Reference{
+				{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(manyTypeID)},
+			},
+			0,
+		))
+	}
+	if err := nm.AddNodes(many...); err != nil {
+		t.Fatal(errors.Wrap(err, "Error adding nodes"))
+	}
+	defer nm.DeleteNodes(many, false)
+	manyTypes := []ua.NodeTypeDescription{{TypeDefinitionNode: ua.NewExpandedNodeID(manyTypeID), DataToReturn: []ua.QueryDataDescription{{AttributeID: ua.AttributeIDBrowseName}}}}
+	res, err = ch.QueryFirst(ctx, &ua.QueryFirstRequest{NodeTypes: manyTypes})
 	if err != nil {
-		return ua.BadCertificateInvalid
+		t.Fatal(errors.Wrap(err, "Error querying"))
+	}
+	if len(res.QueryDataSets) != 1000 || len(res.ContinuationPoint) == 0 {
+		t.Fatalf("Error querying without limit. want: 1000 data sets and a continuation point, got: %d", len(res.QueryDataSets))
+	}
+	res2, err = ch.QueryNext(ctx, &ua.QueryNextRequest{ContinuationPoint: res.ContinuationPoint})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error querying next"))
+	}
+	if len(res2.QueryDataSets) != 500 || len(res2.RevisedContinuationPoint) != 0 {
+		t.Errorf("Error querying next without limit. want: 500 data sets, got: %d", len(res2.QueryDataSets))
 	}
 
-	if f, err := os.Create(certFile); err == nil {
-		block := &pem.Block{Type: "CERTIFICATE", Bytes: rawcrt}
-		if err := pem.Encode(f, block); err != nil {
-			f.Close()
-			return err
+	// the session holds no more than MaxQueryContinuationPoints.
+	max := int(testServer.ServerCapabilities().MaxQueryContinuationPoints)
+	if max == 0 {
+		t.Fatal("Error reading capabilities. want: MaxQueryContinuationPoints > 0, got: 0")
+	}
+	for i := 0; i < max; i++ {
+		if _, err := ch.QueryFirst(ctx, &ua.QueryFirstRequest{NodeTypes: manyTypes, MaxDataSetsToReturn: 1}); err != nil {
+			t.Fatal(errors.Wrap(err, "Error querying"))
 		}
-		f.Close()
-	} else {
-		return err
 	}
+	if _, err := ch.QueryFirst(ctx, &ua.QueryFirstRequest{NodeTypes: manyTypes, MaxDataSetsToReturn: 1}); err != ua.BadNoContinuationPoints {
+		t.Errorf("Error querying. want: %s, got: %v", ua.BadNoContinuationPoints, err)
+	}
+}
 
-	if f, err := os.Create(keyFile); err == nil {
-		block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
-		if err := pem.Encode(f, block); err != nil {
-			f.Close()
-			return err
+// TestEventWhereClauseInvalidLike tests that an invalid pattern of the Like operator is rejected, and that an
+// invalid pattern taken from an event field does not match.
+func TestEventWhereClauseInvalidLike(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	ctx := context.Background()
+	ch, err := client.Dial(
+		ctx,
+		endpointURL,
+		client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+		client.WithInsecureSkipVerify(),
+		client.WithUserNameIdentity("root", "secret"),
+	)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error opening client"))
+	}
+	defer ch.Close(ctx)
+	res, err := ch.CreateSubscription(ctx, &ua.CreateSubscriptionRequest{
+		RequestedPublishingInterval: 100.0,
+		RequestedMaxKeepAliveCount:  30,
+		RequestedLifetimeCount:      30 * 3,
+		PublishingEnabled:           true,
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error creating subscription"))
+	}
+	sourceName := ua.SimpleAttributeOperand{TypeDefinitionID: ua.ObjectTypeIDBaseEventType, BrowsePath: ua.ParseBrowsePath("SourceName"), AttributeID: ua.AttributeIDValue}
+	item := func(handle uint32, operands ...ua.ExtensionObject) ua.MonitoredItemCreateRequest {
+		return ua.MonitoredItemCreateRequest{
+			ItemToMonitor:  ua.ReadValueID{AttributeID: ua.AttributeIDEventNotifier, NodeID: ua.ObjectIDServer},
+			MonitoringMode: ua.MonitoringModeReporting,
+			RequestedParameters: ua.MonitoringParameters{
+				ClientHandle: handle, QueueSize: 10, DiscardOldest: true,
+				Filter: ua.EventFilter{
+					SelectClauses: []ua.SimpleAttributeOperand{sourceName},
+					WhereClause: ua.ContentFilter{
+						Elements: []ua.ContentFilterElement{{FilterOperator: ua.FilterOperatorLike, FilterOperands: operands}},
+					},
+				},
+			},
 		}
-		f.Close()
-	} else {
-		return err
 	}
+	res2, err := ch.CreateMonitoredItems(ctx, &ua.CreateMonitoredItemsRequest{
+		SubscriptionID:     res.SubscriptionID,
+		TimestampsToReturn: ua.TimestampsToReturnBoth,
+		ItemsToCreate: []ua.MonitoredItemCreateRequest{
+			item(1, sourceName, ua.LiteralOperand{Value: "[z-a]"}),
+			item(2, ua.LiteralOperand{Value: "z"}, sourceName),
+		},
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error creating items"))
+	}
+	if res2.Results[0].StatusCode != ua.BadEventFilterInvalid {
+		t.Errorf("Error creating item with invalid pattern. want: %s, got: %s", ua.BadEventFilterInvalid, res2.Results[0].StatusCode)
+	}
+	if result, ok := res2.Results[0].FilterResult.(ua.EventFilterResult); !ok || len(result.WhereClauseResult.ElementResults) != 1 ||
+		!reflect.DeepEqual(result.WhereClauseResult.ElementResults[0].OperandStatusCodes, []ua.StatusCode{ua.Good, ua.BadFilterOperandInvalid}) {
+		t.Errorf("Error checking operands. got: %v", res2.Results[0].FilterResult)
+	}
+	if res2.Results[1].StatusCode != ua.Good {
+		t.Fatalf("Error creating item. want: %s, got: %s", ua.Good, res2.Results[1].StatusCode)
+	}
+
+	// the pattern of the second item is the SourceName of the event.
+	nm := testServer.NamespaceManager()
+	srvNode, _ := nm.FindObject(ua.ObjectIDServer)
+	for i, name := range []string{"[z-a]", "z"} {
+		nm.OnEvent(srvNode, &ua.BaseEvent{
+			EventID:    ua.ByteString(fmt.Sprintf("like-%d", i)),
+			EventType:  ua.ObjectTypeIDSystemEventType,
+			SourceNode: ua.ObjectIDServer,
+			SourceName: name,
+			Time:       time.Now(),
+			Severity:   100,
+		})
+	}
+	got := []string{}
+	for i := 0; i < 3 && len(got) < 1; i++ {
+		res3, err := ch.Publish(ctx, &ua.PublishRequest{RequestHeader: ua.RequestHeader{TimeoutHint: 60000}})
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "Error publishing"))
+		}
+		for _, data := range res3.NotificationMessage.NotificationData {
+			if body, ok := data.(ua.EventNotificationList); ok {
+				for _, e := range body.Events {
+					if e.ClientHandle == 2 {
+						got = append(got, fmt.Sprint(e.EventFields[0]))
+					}
+				}
+			}
+		}
+	}
+	if !reflect.DeepEqual(got, []string{"z"}) {
+		t.Errorf("Error filtering events. want: [z], got: %v", got)
+	}
+}
 
+// testTransport is a PubSubTransport that keeps the last payload.
+type testTransport struct {
+	sync.Mutex
+	payload []byte
+}
+
+func (t *testTransport) Publish(ctx context.Context, topic string, payload []byte) error {
+	t.Lock()
+	defer t.Unlock()
+	t.payload = payload
 	return nil
 }
 
-func ensurePKI() error {
+// TestPublisherJSON tests the fields of a DataSetMessage decode to the values of the variables.
+func TestPublisherJSON(t *testing.T) {
+	if testServer == nil {
+		t.Skip("Test requires the server started by TestMain")
+	}
+	nm := testServer.NamespaceManager()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	values := map[string]ua.Variant{
+		"Int64":    int64(math.MaxInt64),
+		"DateTime": now,
+		"Text":     ua.NewLocalizedText("hello", "en"),
+		"Array":    []uint16{1, 2, 3},
+	}
+	variables := []server.PublishedVariable{{Name: "Missing", NodeID: ua.ParseNodeID("ns=2;s=Test.Publisher.Missing")}}
+	for name, value := range values {
+		id := ua.ParseNodeID("ns=2;s=Test.Publisher." + name)
+		node := server.NewVariableNode(
+			id,
+			ua.NewQualifiedName(2, name),
+			ua.NewLocalizedText(name, ""),
+			ua.NewLocalizedText("", ""),
+			nil,
+			[]ua.Reference{
+				{ReferenceTypeID: ua.ReferenceTypeIDHasTypeDefinition, TargetID: ua.NewExpandedNodeID(ua.VariableTypeIDBaseDataVariableType)},
+			},
+			ua.NewDataValue(value, 0, now, 0, now, 0),
+			ua.DataTypeIDBaseDataType,
+			ua.ValueRankAny,
+			[]uint32{},
+			ua.AccessLevelsCurrentRead,
+			0,
+			false,
+			nil,
+		)
+		if err := nm.AddNode(node); err != nil {
+			t.Fatal(errors.Wrap(err, "Error adding node"))
+		}
+		defer nm.DeleteNode(node, false)
+		variables = append(variables, server.PublishedVariable{Name: name, NodeID: id})
+	}
 
-	// check if ./pki already exists
-	if _, err := os.Stat("./pki"); !os.IsNotExist(err) {
-		return nil
+	transport := &testTransport{}
+	p := server.NewPublisher(testServer, transport, server.PublisherConfig{Topic: "test", Variables: variables})
+	if err := p.Publish(context.Background()); err != nil {
+		t.Fatal(errors.Wrap(err, "Error publishing"))
+	}
+	var msg struct {
+		Messages []struct {
+			Payload map[string]ua.JSONVariant
+		}
+	}
+	if err := json.Unmarshal(transport.payload, &msg); err != nil {
+		t.Fatal(errors.Wrap(err, "Error decoding payload"))
+	}
+	if len(msg.Messages) != 1 {
+		t.Fatalf("Messages. want: 1, got: %d", len(msg.Messages))
+	}
+	payload := msg.Messages[0].Payload
+	for name, want := range values {
+		if got := payload[name].Value; !reflect.DeepEqual(got, want) {
+			t.Errorf("Field %s. want: %v (%T), got: %v (%T)", name, want, want, got, got)
+		}
+	}
+	if f, ok := payload["Missing"]; !ok || f.Value != nil {
+		t.Errorf("Field Missing. want: null, got: %v", f.Value)
+	}
+}
+
+// TestMQTTTransport tests the transport connects to a broker, and publishes to the topic with QoS 1.
+func TestMQTTTransport(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error listening"))
 	}
+	defer l.Close()
 
-	// make a pki directory, if not exist
-	if err := os.MkdirAll("./pki", os.ModeDir|0755); err != nil {
-		return err
+	// readPacket reads the first byte of the fixed header and the body of an MQTT packet.
+	readPacket := func(r io.Reader) (byte, []byte, error) {
+		b := make([]byte, 1)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return 0, nil, err
+		}
+		header := b[0]
+		n, shift := 0, 0
+		for {
+			if _, err := io.ReadFull(r, b); err != nil {
+				return 0, nil, err
+			}
+			n |= int(b[0]&0x7F) << shift
+			if b[0]&0x80 == 0 {
+				break
+			}
+			shift += 7
+		}
+		body := make([]byte, n)
+		_, err := io.ReadFull(r, body)
+		return header, body, err
 	}
 
-	// create a client cert in ./pki
-	if err := createNewCertificate("test-client", "./pki/client.crt", "./pki/client.key"); err != nil {
-		return err
+	type publish struct {
+		header  byte
+		topic   string
+		payload []byte
 	}
+	published := make(chan publish, 1)
+	brokerErr := make(chan error, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			brokerErr <- err
+			return
+		}
+		defer conn.Close()
+		header, body, err := readPacket(conn)
+		if err != nil {
+			brokerErr <- err
+			return
+		}
+		// CONNECT with protocol name "MQTT", level 4, and user name and password flags.
+		if header != 0x10 || len(body) < 10 || string(body[2:6]) != "MQTT" || body[6] != 4 || body[7]&0xC0 != 0xC0 {
+			brokerErr <- fmt.Errorf("unexpected CONNECT: %x %x", header, body)
+			return
+		}
+		conn.Write([]byte{0x20, 0x02, 0x00, 0x00})
+		header, body, err = readPacket(conn)
+		if err != nil {
+			brokerErr <- err
+			return
+		}
+		n := int(body[0])<<8 | int(body[1])
+		topic := string(body[2 : 2+n])
+		id := body[2+n : 4+n]
+		published <- publish{header: header, topic: topic, payload: body[4+n:]}
+		conn.Write([]byte{0x40, 0x02, id[0], id[1]})
+		// wait for DISCONNECT.
+		readPacket(conn)
+	}()
 
-	// create a server cert in ./pki
-	if err := createNewCertificate("testserver", "./pki/server.crt", "./pki/server.key"); err != nil {
-		return err
+	transport := server.NewMQTTTransport(server.MQTTBrokerConfig{
+		Address:  l.Addr().String(),
+		ClientID: "testpublisher",
+		UserName: "user",
+		Password: "password",
+		QoS:      1,
+	})
+	defer transport.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := transport.Publish(ctx, "opcua/json/data", []byte(`{"MessageId":"1"}`)); err != nil {
+		t.Fatal(errors.Wrap(err, "Error publishing"))
+	}
+	select {
+	case err := <-brokerErr:
+		t.Fatal(errors.Wrap(err, "Error in broker"))
+	case p := <-published:
+		if p.header != 0x32 {
+			t.Errorf("Header. want: 0x32, got: %#x", p.header)
+		}
+		if p.topic != "opcua/json/data" {
+			t.Errorf("Topic. want: opcua/json/data, got: %s", p.topic)
+		}
+		if string(p.payload) != `{"MessageId":"1"}` {
+			t.Errorf("Payload. want: {\"MessageId\":\"1\"}, got: %s", p.payload)
+		}
+	}
+}
+
+// TestLifecycleHook tests that the lifecycle hook observes each secure channel and session event once,
+// when the client closes or aborts the channel, and when the server closes the channel.
+func TestLifecycleHook(t *testing.T) {
+	srv, err := server.New(
+		ua.ApplicationDescription{ApplicationURI: "urn:127.0.0.1:testserver", ApplicationName: ua.NewLocalizedText("testserver", "")},
+		"./pki/server.crt",
+		"./pki/server.key",
+		"opc.tcp://127.0.0.1:46036",
+		server.WithAnonymousIdentity(true),
+		server.WithInsecureSkipVerify(),
+	)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "Error constructing server"))
+	}
+	defer srv.Close()
+	var mu sync.Mutex
+	events := []server.LifecycleEvent{}
+	srv.SetLifecycleHook(func(evt server.LifecycleEvent) {
+		mu.Lock()
+		events = append(events, evt)
+		mu.Unlock()
+	})
+	go srv.ListenAndServe()
+	time.Sleep(500 * time.Millisecond)
+
+	// waitFor returns the types of the events raised until the given number of channels was closed.
+	waitFor := func(channels int) []server.LifecycleEventType {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			mu.Lock()
+			closed := 0
+			for _, evt := range events {
+				if evt.Type == server.LifecycleEventChannelClosed {
+					closed++
+				}
+			}
+			mu.Unlock()
+			if closed >= channels {
+				break
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		// wait for an event raised twice.
+		time.Sleep(200 * time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		types := make([]server.LifecycleEventType, len(events))
+		for i, evt := range events {
+			types[i] = evt.Type
+		}
+		events = events[:0]
+		return types
+	}
+	dial := func() *client.Client {
+		ch, err := client.Dial(
+			context.Background(),
+			"opc.tcp://127.0.0.1:46036",
+			client.WithClientCertificateFile("./pki/client.crt", "./pki/client.key"),
+			client.WithInsecureSkipVerify(),
+		)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "Error opening client"))
+		}
+		return ch
+	}
+	// Dial gets the endpoints of the server over a channel of its own.
+	discovery := []server.LifecycleEventType{
+		server.LifecycleEventChannelOpened,
+		server.LifecycleEventChannelClosed,
+	}
+
+	ctx := context.Background()
+	ch := dial()
+	if err := ch.Close(ctx); err != nil {
+		t.Error(errors.Wrap(err, "Error closing client"))
+	}
+	want := append(discovery,
+		server.LifecycleEventChannelOpened,
+		server.LifecycleEventSessionCreated,
+		server.LifecycleEventSessionActivated,
+		server.LifecycleEventSessionClosed,
+		server.LifecycleEventChannelClosed,
+	)
+	if got := waitFor(2); !reflect.DeepEqual(got, want) {
+		t.Errorf("Error closing channel. want: %v, got: %v", want, got)
+	}
+
+	ch = dial()
+	ch.Abort(ctx)
+	want = append(discovery,
+		server.LifecycleEventChannelOpened,
+		server.LifecycleEventSessionCreated,
+		server.LifecycleEventSessionActivated,
+		server.LifecycleEventChannelClosed,
+	)
+	if got := waitFor(2); !reflect.DeepEqual(got, want) {
+		t.Errorf("Error aborting channel. want: %v, got: %v", want, got)
+	}
+
+	ch = dial()
+	defer ch.Abort(ctx)
+	srv.Close()
+	if got := waitFor(2); !reflect.DeepEqual(got, want) {
+		t.Errorf("Error closing server. want: %v, got: %v", want, got)
 	}
-	return nil
 }
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"encoding/binary"
 	"sync"
 	"sync/atomic"
@@ -21,6 +22,21 @@ type stateChangeOp struct {
 	message        ua.NotificationMessage
 }
 
+// registeredNodeNamespace is the namespace index of the NodeIDs returned by RegisterNodes. The index is
+// reserved, so a registered NodeID never collides with a NodeID of the namespace table.
+const registeredNodeNamespace uint16 = 65535
+
+// maxRegisteredNodes is the maximum number of nodes a session may register. Once reached, RegisterNodes
+// returns the NodeIDs unchanged.
+const maxRegisteredNodes = 1000
+
+// registeredNode is a node registered by RegisterNodes, and the removal count of the namespace before
+// the node was found. While the count is unchanged, the node is still in the namespace.
+type registeredNode struct {
+	node     Node
+	removals uint64
+}
+
 type Session struct {
 	sync.RWMutex
 	server              *Server
@@ -29,6 +45,7 @@ type Session struct {
 	authenticationToken ua.NodeID
 	timeout             time.Duration
 	userIdentity        interface{}
+	userClaims          map[string]interface{}
 	userRoles           []ua.NodeID
 	sessionNonce        ua.ByteString
 	lastAccess          time.Time
@@ -39,15 +56,25 @@ type Session struct {
 		data []ua.ReferenceDescription
 		max  int
 	}
+	queryCPs map[uint32]struct {
+		data []ua.QueryDataSet
+		max  int
+	}
 	lastBrowseCP                            uint32
 	maxBrowseContinuationPoints             int
+	lastQueryCP                             uint32
+	maxQueryContinuationPoints              int
+	registeredNodes                         map[uint32]registeredNode
+	lastRegisteredNode                      uint32
 	historyCPs                              map[uint32]time.Time
 	maxHistoryContinuationPoints            int
+	pendingRequests                         map[uint32][]*pendingRequest
 	clientDescription                       ua.ApplicationDescription
 	serverUri                               string
 	endpointUrl                             string
 	maxResponseMessageSize                  uint32
 	localeIds                               []string
+	timeZone                                ua.TimeZoneDataType
 	timeCreated                             time.Time
 	requestCount                            uint32
 	errorCount                              uint32
@@ -128,9 +155,16 @@ func NewSession(server *Server, sessionId ua.NodeID, sessionName string, authent
 			data []ua.ReferenceDescription
 			max  int
 		}, 16),
+		queryCPs: make(map[uint32]struct {
+			data []ua.QueryDataSet
+			max  int
+		}, 16),
 		maxBrowseContinuationPoints:  int(server.ServerCapabilities().MaxBrowseContinuationPoints),
+		maxQueryContinuationPoints:   int(server.ServerCapabilities().MaxQueryContinuationPoints),
+		registeredNodes:              make(map[uint32]registeredNode, 16),
 		historyCPs:                   make(map[uint32]time.Time, 16),
 		maxHistoryContinuationPoints: int(server.ServerCapabilities().MaxHistoryContinuationPoints),
+		pendingRequests:              make(map[uint32][]*pendingRequest, 16),
 		clientDescription:            clientDescription,
 		serverUri:                    serverUri,
 		endpointUrl:                  endpointUrl,
@@ -150,21 +184,34 @@ func (s *Session) IsExpired() bool {
 
 func (s *Session) delete() {
 	s.Lock()
-	s.server = nil
-	//s.sessionId = nil  // need to keep to look up diagnostics node
 	s.authenticationToken = nil
 	s.userIdentity = nil
-	s.userRoles = nil
+	s.userClaims = nil
 	s.sessionNonce = ua.ByteString("")
 	s.publishRequests = nil
 	for k := range s.browseCPs {
 		delete(s.browseCPs, k)
 	}
 	s.browseCPs = nil
+	for k := range s.queryCPs {
+		delete(s.queryCPs, k)
+	}
+	s.queryCPs = nil
 	for k := range s.historyCPs {
 		delete(s.historyCPs, k)
 	}
 	s.historyCPs = nil
+	for k := range s.registeredNodes {
+		delete(s.registeredNodes, k)
+	}
+	s.registeredNodes = nil
+	for k, list := range s.pendingRequests {
+		for _, r := range list {
+			r.cancel()
+		}
+		delete(s.pendingRequests, k)
+	}
+	s.pendingRequests = nil
 	s.clientUserIdHistory = nil
 	s.Unlock()
 }
@@ -190,6 +237,14 @@ func (s *Session) SessionName() string {
 	return res
 }
 
+// ClientDescription returns the description of the client application, given when the session was created.
+func (s *Session) ClientDescription() ua.ApplicationDescription {
+	s.RLock()
+	res := s.clientDescription
+	s.RUnlock()
+	return res
+}
+
 func (s *Session) AuthenticationToken() ua.NodeID {
 	s.RLock()
 	res := s.authenticationToken
@@ -215,24 +270,53 @@ func (s *Session) SetUserIdentity(value interface{}) {
 	s.Lock()
 	s.userIdentity = value
 	// update diagnostics
-	switch ui := s.userIdentity.(type) {
+	s.clientUserIdOfSession = clientUserID(value)
+	switch s.userIdentity.(type) {
 	case ua.IssuedIdentity:
-		s.clientUserIdOfSession = "<issued>"
 		s.authenticationMechanism = "Issued"
 	case ua.X509Identity:
-		s.clientUserIdOfSession = "<certificate>"
 		s.authenticationMechanism = "X509"
 	case ua.UserNameIdentity:
-		s.clientUserIdOfSession = ui.UserName
 		s.authenticationMechanism = "UserName"
 	default:
-		s.clientUserIdOfSession = "<anonymous>"
 		s.authenticationMechanism = "Anonymous"
 	}
 	s.clientUserIdHistory = append(s.clientUserIdHistory, s.clientUserIdOfSession)
 	s.Unlock()
 }
 
+// clientUserID returns the ClientUserId of the user identity, for diagnostics and audit events.
+func clientUserID(userIdentity interface{}) string {
+	switch ui := userIdentity.(type) {
+	case ua.IssuedIdentity:
+		if sub := jwtSubject(ui.TokenData); sub != "" {
+			return sub
+		}
+		return "<issued>"
+	case ua.X509Identity:
+		return "<certificate>"
+	case ua.UserNameIdentity:
+		return ui.UserName
+	default:
+		return "<anonymous>"
+	}
+}
+
+// Claims returns the claims of the JSON Web Token of the user, as verified by the JWTAuthenticator,
+// or nil if the user is not identified by a verified token.
+func (s *Session) Claims() map[string]interface{} {
+	s.RLock()
+	res := s.userClaims
+	s.RUnlock()
+	return res
+}
+
+func (s *Session) setClaims(value map[string]interface{}) {
+	s.Lock()
+	s.userClaims = value
+	s.Unlock()
+}
+
 func (s *Session) UserRoles() []ua.NodeID {
 	s.RLock()
 	res := s.userRoles
@@ -246,6 +330,39 @@ func (s *Session) SetUserRoles(value []ua.NodeID) {
 	s.Unlock()
 }
 
+// LocaleIDs returns the locales preferred by the client, as requested in ActivateSession.
+func (s *Session) LocaleIDs() []string {
+	s.RLock()
+	res := s.localeIds
+	s.RUnlock()
+	return res
+}
+
+// SetLocaleIDs sets the locales preferred by the client. ActivateSession replaces the locales on each
+// call, and later reads of localized text use the new locales.
+func (s *Session) SetLocaleIDs(value []string) {
+	s.Lock()
+	s.localeIds = value
+	s.Unlock()
+}
+
+// TimeZone returns the local time zone of the client, used to align the intervals of aggregates
+// to local time. The default is UTC. A HistoryReader gets the session from the context with SessionKey.
+func (s *Session) TimeZone() ua.TimeZoneDataType {
+	s.RLock()
+	res := s.timeZone
+	s.RUnlock()
+	return res
+}
+
+// SetTimeZone sets the local time zone of the client. CreateSession and ActivateSession do not
+// carry a time zone, so the application sets it, e.g. in a method called by the client.
+func (s *Session) SetTimeZone(value ua.TimeZoneDataType) {
+	s.Lock()
+	s.timeZone = value
+	s.Unlock()
+}
+
 func (s *Session) SessionNonce() ua.ByteString {
 	s.RLock()
 	res := s.sessionNonce
@@ -335,9 +452,129 @@ func (s *Session) removePublishRequest() (*serverSecureChannel, uint32, *ua.Publ
 	}
 }
 
+// pendingRequest is a request that may be canceled by the client. Several pending requests
+// may have the same requestHandle.
+type pendingRequest struct {
+	cancel context.CancelFunc
+}
+
+// beginRequest returns a context that is canceled when the client sends a Cancel request
+// with a matching requestHandle, or when the session is closed. Call the returned
+// function when the request is completed.
+func (s *Session) beginRequest(ctx context.Context, requestHandle uint32) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	s.Lock()
+	if s.pendingRequests == nil {
+		// session was deleted.
+		s.Unlock()
+		cancel()
+		return ctx, func() {}
+	}
+	r := &pendingRequest{cancel: cancel}
+	s.pendingRequests[requestHandle] = append(s.pendingRequests[requestHandle], r)
+	s.Unlock()
+	return ctx, func() {
+		s.Lock()
+		s.removePendingRequest(requestHandle, r)
+		s.Unlock()
+		cancel()
+	}
+}
+
+// removePendingRequest removes the request from the pending requests with the requestHandle.
+// The caller must hold the lock.
+func (s *Session) removePendingRequest(requestHandle uint32, r *pendingRequest) {
+	list := s.pendingRequests[requestHandle]
+	for i, r1 := range list {
+		if r1 == r {
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(list) == 0 {
+		delete(s.pendingRequests, requestHandle)
+		return
+	}
+	s.pendingRequests[requestHandle] = list
+}
+
+// cancelRequest cancels the pending requests with the given requestHandle, and returns
+// the number of requests canceled.
+func (s *Session) cancelRequest(requestHandle uint32) uint32 {
+	s.Lock()
+	defer s.Unlock()
+	list := s.pendingRequests[requestHandle]
+	delete(s.pendingRequests, requestHandle)
+	for _, r := range list {
+		r.cancel()
+	}
+	return uint32(len(list))
+}
+
+// registerNode returns a NodeID in the reserved namespace that resolves to the node for the lifetime
+// of the session, or until unregisterNode. The removals are the removal count of the namespace before
+// the node was found. If the session is closed, or already holds maxRegisteredNodes, returns the
+// NodeID of the node.
+func (s *Session) registerNode(node Node, removals uint64) ua.NodeID {
+	s.Lock()
+	defer s.Unlock()
+	if s.registeredNodes == nil || len(s.registeredNodes) >= maxRegisteredNodes {
+		return node.NodeID()
+	}
+	id := atomic.AddUint32(&s.lastRegisteredNode, 1)
+	s.registeredNodes[id] = registeredNode{node: node, removals: removals}
+	return ua.NewNodeIDNumeric(registeredNodeNamespace, id)
+}
+
+// unregisterNode releases the NodeID returned by registerNode. Other NodeIDs are ignored.
+func (s *Session) unregisterNode(id ua.NodeID) {
+	if id, ok := id.(ua.NodeIDNumeric); ok && id.NamespaceIndex == registeredNodeNamespace {
+		s.Lock()
+		delete(s.registeredNodes, id.ID)
+		s.Unlock()
+	}
+}
+
+// registeredNode returns the node registered for a NodeID returned by registerNode, and true.
+// If a node was removed from the namespace since the node was found, the node that now has its
+// NodeID is found again, and if there is none, the node is nil.
+func (s *Session) registeredNode(id ua.NodeID) (Node, bool) {
+	id2, ok := id.(ua.NodeIDNumeric)
+	if !ok || id2.NamespaceIndex != registeredNodeNamespace {
+		return nil, false
+	}
+	s.RLock()
+	r, ok := s.registeredNodes[id2.ID]
+	s.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	m := s.server.NamespaceManager()
+	removals := m.removalCount()
+	if r.removals == removals {
+		return r.node, true
+	}
+	// the node may have been deleted, or replaced by a node with the same NodeID.
+	n, ok := m.FindNode(r.node.NodeID())
+	if !ok {
+		return nil, true
+	}
+	s.Lock()
+	if _, ok := s.registeredNodes[id2.ID]; ok {
+		s.registeredNodes[id2.ID] = registeredNode{node: n, removals: removals}
+	}
+	s.Unlock()
+	return n, true
+}
+
+// addBrowseContinuationPoint stores the references that remain to be returned by BrowseNext. Returns
+// BadNoContinuationPoints if the session already holds MaxBrowseContinuationPoints.
 func (s *Session) addBrowseContinuationPoint(data []ua.ReferenceDescription, max int) ([]byte, error) {
 	s.Lock()
 	defer s.Unlock()
+	if s.browseCPs == nil {
+		return nil, ua.BadSessionClosed
+	}
 	if s.maxBrowseContinuationPoints > 0 && len(s.browseCPs) >= s.maxBrowseContinuationPoints {
 		return nil, ua.BadNoContinuationPoints
 	}
@@ -351,8 +588,9 @@ func (s *Session) addBrowseContinuationPoint(data []ua.ReferenceDescription, max
 	return cp, nil
 }
 
+// removeBrowseContinuationPoint releases the continuation point and returns the remaining references.
 func (s *Session) removeBrowseContinuationPoint(cp []byte) ([]ua.ReferenceDescription, int, bool) {
-	if cp == nil {
+	if len(cp) != 4 {
 		return nil, 0, false
 	}
 	s.Lock()
@@ -367,3 +605,42 @@ func (s *Session) removeBrowseContinuationPoint(cp []byte) ([]ua.ReferenceDescri
 	}
 	return nil, 0, false
 }
+
+// addQueryContinuationPoint stores the data sets that remain to be returned by QueryNext. Returns
+// BadNoContinuationPoints if the session already holds MaxQueryContinuationPoints.
+func (s *Session) addQueryContinuationPoint(data []ua.QueryDataSet, max int) ([]byte, error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.queryCPs == nil {
+		return nil, ua.BadSessionClosed
+	}
+	if s.maxQueryContinuationPoints > 0 && len(s.queryCPs) >= s.maxQueryContinuationPoints {
+		return nil, ua.BadNoContinuationPoints
+	}
+	id := atomic.AddUint32(&s.lastQueryCP, 1)
+	s.queryCPs[id] = struct {
+		data []ua.QueryDataSet
+		max  int
+	}{data, max}
+	cp := make([]byte, 4)
+	binary.LittleEndian.PutUint32(cp, id)
+	return cp, nil
+}
+
+// removeQueryContinuationPoint releases the continuation point and returns the remaining data sets.
+func (s *Session) removeQueryContinuationPoint(cp []byte) ([]ua.QueryDataSet, int, bool) {
+	if len(cp) != 4 {
+		return nil, 0, false
+	}
+	s.Lock()
+	id := binary.LittleEndian.Uint32(cp)
+	x, ok := s.queryCPs[id]
+	if ok {
+		delete(s.queryCPs, id)
+	}
+	s.Unlock()
+	if ok {
+		return x.data, x.max, ok
+	}
+	return nil, 0, false
+}
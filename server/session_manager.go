@@ -50,8 +50,8 @@ func (m *SessionManager) Get(authenticationToken ua.NodeID) (*Session, bool) {
 // Add a session to the server.
 func (m *SessionManager) Add(s *Session) error {
 	m.Lock()
-	defer m.Unlock()
 	if maxSessionCount := m.server.MaxSessionCount(); maxSessionCount > 0 && len(m.sessionsByToken) >= int(maxSessionCount) {
+		m.Unlock()
 		return ua.BadTooManySessions
 	}
 	m.sessionsByToken[s.authenticationToken] = s
@@ -62,13 +62,14 @@ func (m *SessionManager) Add(s *Session) error {
 		m.server.serverDiagnosticsSummary.CurrentSessionCount = uint32(len(m.sessionsByToken))
 		m.server.Unlock()
 	}
+	m.Unlock()
+	m.server.raiseSessionEvent(LifecycleEventSessionCreated, s)
 	return nil
 }
 
 // Delete the session from the server.
 func (m *SessionManager) Delete(s *Session) {
 	m.Lock()
-	defer m.Unlock()
 	delete(m.sessionsByToken, s.authenticationToken)
 	if m.server.serverDiagnostics {
 		m.removeDiagnosticsNode(s)
@@ -77,6 +78,8 @@ func (m *SessionManager) Delete(s *Session) {
 		m.server.Unlock()
 	}
 	s.delete()
+	m.Unlock()
+	m.server.raiseSessionEvent(LifecycleEventSessionClosed, s)
 }
 
 // Len returns the number of sessions.
@@ -87,8 +90,8 @@ func (m *SessionManager) Len() int {
 }
 
 func (m *SessionManager) checkForExpiredSessions() {
+	expired := []*Session{}
 	m.Lock()
-	defer m.Unlock()
 	for k, s := range m.sessionsByToken {
 		if s.IsExpired() {
 			delete(m.sessionsByToken, k)
@@ -100,8 +103,14 @@ func (m *SessionManager) checkForExpiredSessions() {
 				m.server.Unlock()
 			}
 			s.delete()
+			expired = append(expired, s)
 		}
 	}
+	m.Unlock()
+	for _, s := range expired {
+		m.server.logger.Info("Expired session", ua.SessionIDAttr(s.sessionId))
+		m.server.raiseSessionEvent(LifecycleEventSessionExpired, s)
+	}
 }
 
 func (m *SessionManager) addDiagnosticsNode(s *Session) {
@@ -142,58 +151,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	sessionDiagnosticsVariable.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		subCount := 0
-		itemCount := 0
-		subs := srv.subscriptionManager.GetBySession(s)
-		subCount = len(subs)
-		for _, sub := range subs {
-			itemCount += len(sub.items)
-		}
-		return ua.NewDataValue(ua.SessionDiagnosticsDataType{
-			SessionID:                          s.sessionId,
-			SessionName:                        s.sessionName,
-			ClientDescription:                  s.clientDescription,
-			ServerURI:                          s.serverUri,
-			EndpointURL:                        s.endpointUrl,
-			LocaleIDs:                          s.localeIds,
-			ActualSessionTimeout:               float64(s.timeout.Nanoseconds() / 1000000),
-			MaxResponseMessageSize:             s.maxResponseMessageSize,
-			ClientConnectionTime:               s.timeCreated,
-			ClientLastContactTime:              s.lastAccess,
-			CurrentSubscriptionsCount:          uint32(subCount),
-			CurrentMonitoredItemsCount:         uint32(itemCount),
-			CurrentPublishRequestsInQueue:      uint32(len(s.publishRequests)),
-			TotalRequestCount:                  ua.ServiceCounterDataType{TotalCount: s.requestCount, ErrorCount: s.errorCount},
-			UnauthorizedRequestCount:           s.unauthorizedRequestCount,
-			ReadCount:                          ua.ServiceCounterDataType{TotalCount: s.readCount, ErrorCount: s.readErrorCount},
-			HistoryReadCount:                   ua.ServiceCounterDataType{TotalCount: s.historyReadCount, ErrorCount: s.historyReadErrorCount},
-			WriteCount:                         ua.ServiceCounterDataType{TotalCount: s.writeCount, ErrorCount: s.writeErrorCount},
-			HistoryUpdateCount:                 ua.ServiceCounterDataType{TotalCount: s.historyUpdateCount, ErrorCount: s.historyUpdateErrorCount},
-			CallCount:                          ua.ServiceCounterDataType{TotalCount: s.callCount, ErrorCount: s.callErrorCount},
-			CreateMonitoredItemsCount:          ua.ServiceCounterDataType{TotalCount: s.createMonitoredItemsCount, ErrorCount: s.createMonitoredItemsErrorCount},
-			ModifyMonitoredItemsCount:          ua.ServiceCounterDataType{TotalCount: s.modifyMonitoredItemsCount, ErrorCount: s.modifyMonitoredItemsErrorCount},
-			SetMonitoringModeCount:             ua.ServiceCounterDataType{TotalCount: s.setMonitoringModeCount, ErrorCount: s.setMonitoringModeErrorCount},
-			SetTriggeringCount:                 ua.ServiceCounterDataType{TotalCount: s.setTriggeringCount, ErrorCount: s.setTriggeringErrorCount},
-			DeleteMonitoredItemsCount:          ua.ServiceCounterDataType{TotalCount: s.deleteMonitoredItemsCount, ErrorCount: s.deleteMonitoredItemsErrorCount},
-			CreateSubscriptionCount:            ua.ServiceCounterDataType{TotalCount: s.createSubscriptionCount, ErrorCount: s.createSubscriptionErrorCount},
-			ModifySubscriptionCount:            ua.ServiceCounterDataType{TotalCount: s.modifySubscriptionCount, ErrorCount: s.modifySubscriptionErrorCount},
-			SetPublishingModeCount:             ua.ServiceCounterDataType{TotalCount: s.setPublishingModeCount, ErrorCount: s.setPublishingModeErrorCount},
-			PublishCount:                       ua.ServiceCounterDataType{TotalCount: s.publishCount, ErrorCount: s.publishErrorCount},
-			RepublishCount:                     ua.ServiceCounterDataType{TotalCount: s.republishCount, ErrorCount: s.republishErrorCount},
-			TransferSubscriptionsCount:         ua.ServiceCounterDataType{TotalCount: s.transferSubscriptionsCount, ErrorCount: s.transferSubscriptionsErrorCount},
-			DeleteSubscriptionsCount:           ua.ServiceCounterDataType{TotalCount: s.deleteSubscriptionsCount, ErrorCount: s.deleteSubscriptionsErrorCount},
-			AddNodesCount:                      ua.ServiceCounterDataType{TotalCount: s.addNodesCount, ErrorCount: s.addNodesErrorCount},
-			AddReferencesCount:                 ua.ServiceCounterDataType{TotalCount: s.addReferencesCount, ErrorCount: s.addReferencesErrorCount},
-			DeleteNodesCount:                   ua.ServiceCounterDataType{TotalCount: s.deleteNodesCount, ErrorCount: s.deleteNodesErrorCount},
-			DeleteReferencesCount:              ua.ServiceCounterDataType{TotalCount: s.deleteReferencesCount, ErrorCount: s.deleteReferencesErrorCount},
-			BrowseCount:                        ua.ServiceCounterDataType{TotalCount: s.browseCount, ErrorCount: s.browseErrorCount},
-			BrowseNextCount:                    ua.ServiceCounterDataType{TotalCount: s.browseNextCount, ErrorCount: s.browseNextErrorCount},
-			TranslateBrowsePathsToNodeIDsCount: ua.ServiceCounterDataType{TotalCount: s.translateBrowsePathsToNodeIdsCount, ErrorCount: s.translateBrowsePathsToNodeIdsErrorCount},
-			QueryFirstCount:                    ua.ServiceCounterDataType{TotalCount: s.queryFirstCount, ErrorCount: s.queryFirstErrorCount},
-			QueryNextCount:                     ua.ServiceCounterDataType{TotalCount: s.queryNextCount, ErrorCount: s.queryNextErrorCount},
-			RegisterNodesCount:                 ua.ServiceCounterDataType{TotalCount: s.registerNodesCount, ErrorCount: s.registerNodesErrorCount},
-			UnregisterNodesCount:               ua.ServiceCounterDataType{TotalCount: s.unregisterNodesCount, ErrorCount: s.unregisterNodesErrorCount},
-		}, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.diagnostics(), 0, time.Now(), 0, time.Now(), 0)
 	})
 	nodes = append(nodes, sessionDiagnosticsVariable)
 	n := NewVariableNode(
@@ -331,7 +289,7 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue(s.localeIds, 0, time.Now(), 0, time.Now(), 0)
+		return ua.NewDataValue(s.LocaleIDs(), 0, time.Now(), 0, time.Now(), 0)
 	})
 	nodes = append(nodes, n)
 	n = NewVariableNode(
@@ -1655,10 +1613,12 @@ func (m *SessionManager) addDiagnosticsNode(s *Session) {
 		srv.historian,
 	)
 	subscriptionDiagnosticsArrayVariable.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		return ua.NewDataValue([]ua.ExtensionObject{}, 0, time.Now(), 0, time.Now(), 0)
+		return srv.subscriptionDiagnosticsArray(ctx, s)
 	})
 	nodes = append(nodes, subscriptionDiagnosticsArrayVariable)
 
+	setDiagnosticsRolePermissions(nodes)
+	setDiagnosticsVisibility(nodes, func() *Session { return s })
 	err := nm.AddNodes(nodes...)
 	if err != nil {
 		log.Printf("Error adding session diagnostics objects.\n")
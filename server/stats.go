@@ -0,0 +1,51 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package server
+
+import (
+	"sync/atomic"
+)
+
+// Stats holds the number of goroutines the server is running for its channels, sessions,
+// subscriptions and samplers. Each count returns to its previous value when the channel,
+// request or subscription is torn down, so a count that keeps growing indicates a leak.
+type Stats struct {
+	// Channels is the number of goroutines that receive the requests of open secure channels, one per channel.
+	Channels int64
+	// Sessions is the number of goroutines that complete the service requests of sessions.
+	Sessions int64
+	// Subscriptions is the number of goroutines that publish subscriptions, one per subscription.
+	Subscriptions int64
+	// Samplers is the number of goroutines that sample monitored items, one per sampling interval in use.
+	Samplers int64
+	// SubscriptionCount is the number of subscriptions, for comparison with the Subscriptions goroutines.
+	SubscriptionCount int
+}
+
+// goroutineCounters counts the running goroutines of the server, by kind.
+type goroutineCounters struct {
+	channels      int64
+	sessions      int64
+	subscriptions int64
+	samplers      int64
+}
+
+// Stats returns the number of goroutines the server is running.
+func (srv *Server) Stats() Stats {
+	return Stats{
+		Channels:          atomic.LoadInt64(&srv.goroutines.channels),
+		Sessions:          atomic.LoadInt64(&srv.goroutines.sessions),
+		Subscriptions:     atomic.LoadInt64(&srv.goroutines.subscriptions),
+		Samplers:          atomic.LoadInt64(&srv.goroutines.samplers),
+		SubscriptionCount: srv.SubscriptionManager().Len(),
+	}
+}
+
+// goSession runs the function in a goroutine that is counted by Stats.Sessions.
+func (srv *Server) goSession(f func()) {
+	atomic.AddInt64(&srv.goroutines.sessions, 1)
+	go func() {
+		defer atomic.AddInt64(&srv.goroutines.sessions, -1)
+		f()
+	}()
+}
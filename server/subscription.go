@@ -1,9 +1,8 @@
 package server
 
 import (
-	"container/list"
 	"context"
-	"log"
+	"log/slog"
 	"math"
 	"sync"
 	"sync/atomic"
@@ -43,11 +42,14 @@ type Subscription struct {
 	moreNotifications            bool
 	session                      *Session
 	manager                      *SubscriptionManager
-	retransmissionQueue          *list.List
+	notificationStore            NotificationStore
+	key                          SubscriptionKey
+	logger                       *slog.Logger
 	isLate                       bool
 	resend                       bool
 	diagnosticsNodeId            ua.NodeID
 	sessionId                    ua.NodeID
+	userIdentity                 interface{}
 	modifyCount                  uint32
 	republishRequestCount        uint32
 	republishMessageRequestCount uint32
@@ -66,18 +68,21 @@ type Subscription struct {
 // NewSubscription instantiates a new Subscription.
 func NewSubscription(manager *SubscriptionManager, session *Session, publishingInterval float64, lifetimeCount uint32, maxKeepAliveCount uint32, maxNotificationsPerPublish uint32, publishingEnabled bool, priority byte) *Subscription {
 	s := &Subscription{
-		manager:             manager,
-		session:             session,
-		id:                  atomic.AddUint32(&subscriptionID, 1),
-		publishingEnabled:   publishingEnabled,
-		priority:            priority,
-		seqNum:              1,
-		keepAliveCounter:    math.MaxUint32,
-		items:               make(map[uint32]MonitoredItem),
-		retransmissionQueue: list.New(),
-		diagnosticsNodeId:   ua.NewNodeIDGUID(1, uuid.New()),
-		sessionId:           session.sessionId,
+		manager:           manager,
+		session:           session,
+		id:                atomic.AddUint32(&subscriptionID, 1),
+		logger:            manager.server.logger,
+		publishingEnabled: publishingEnabled,
+		priority:          priority,
+		seqNum:            1,
+		keepAliveCounter:  math.MaxUint32,
+		items:             make(map[uint32]MonitoredItem),
+		notificationStore: manager.server.notificationStore,
+		diagnosticsNodeId: ua.NewNodeIDGUID(1, uuid.New()),
+		sessionId:         session.sessionId,
+		userIdentity:      session.UserIdentity(),
 	}
+	s.key = SubscriptionKey{InstanceID: manager.server.instanceID, SubscriptionID: s.id}
 	s.setPublishingInterval(publishingInterval)
 	s.setMaxKeepAliveCount(maxKeepAliveCount)
 	s.setLifetimeCount(lifetimeCount)
@@ -106,17 +111,98 @@ func (s *Subscription) deleteImpl() {
 		item.Delete()
 	}
 	s.items = nil
-	q := s.retransmissionQueue
-	// log.Printf("Empty retransmissionQueue len: %d\n", q.Len())
-	for e := q.Front(); e != nil; e = e.Next() {
-		q.Remove(e)
-		e.Value = nil
+	if err := s.notificationStore.Trim(s.key, 0); err != nil {
+		s.logger.Error("Error removing notification messages", ua.SubscriptionIDAttr(s.id), ua.StatusCodeAttr(err))
 	}
-	s.retransmissionQueue = nil
 	s.session = nil
 	s.manager = nil
 }
 
+// orphan detaches the subscription from its session. An orphaned subscription keeps sampling
+// its items until it is transferred to another session or its lifetime expires.
+func (s *Subscription) orphan() {
+	s.Lock()
+	s.session = nil
+	s.Unlock()
+}
+
+// transfer assigns the subscription to the session. The previous session, if any, is sent
+// a StatusChangeNotification. If sendInitialValues is true, the current values of the items are
+// sent in the next publish response.
+func (s *Subscription) transfer(session *Session, sendInitialValues bool) []uint32 {
+	s.Lock()
+	defer s.Unlock()
+	if old := s.session; old != nil && old != session {
+		nm := ua.NotificationMessage{
+			SequenceNumber:   s.seqNum,
+			PublishTime:      time.Now(),
+			NotificationData: []ua.ExtensionObject{ua.StatusChangeNotification{Status: ua.GoodSubscriptionTransferred}},
+		}
+		select {
+		case old.stateChanges <- &stateChangeOp{subscriptionId: s.id, message: nm}:
+			if s.seqNum != math.MaxUint32 {
+				s.seqNum++
+			} else {
+				s.seqNum = 1
+			}
+		default:
+		}
+	}
+	s.session = session
+	s.sessionId = session.sessionId
+	s.lifetimeCounter = 0
+	ctx := context.WithValue(context.Background(), SessionKey, session)
+	for _, item := range s.items {
+		if mi, ok := item.(*DataChangeMonitoredItem); ok {
+			mi.setContext(ctx)
+		}
+	}
+	if sendInitialValues {
+		s.resend = true
+	}
+	return s.available()
+}
+
+// isOwner returns true if the user of the session is the user that created the subscription.
+func (s *Subscription) isOwner(session *Session) bool {
+	s.RLock()
+	owner, current := s.userIdentity, s.session
+	s.RUnlock()
+	switch id := session.UserIdentity().(type) {
+	case ua.UserNameIdentity:
+		if o, ok := owner.(ua.UserNameIdentity); ok {
+			return o.UserName == id.UserName
+		}
+		return false
+	case ua.X509Identity:
+		if o, ok := owner.(ua.X509Identity); ok {
+			return o.Certificate == id.Certificate
+		}
+		return false
+	default:
+		// anonymous identities cannot be told apart, so only the same session is the owner.
+		return current == session
+	}
+}
+
+// removePublishRequest removes a publish request queued by the session. An orphaned
+// subscription has no publish requests.
+func (s *Subscription) removePublishRequest() (*serverSecureChannel, uint32, *ua.PublishRequest, []ua.StatusCode, bool) {
+	if s.session == nil {
+		return nil, 0, nil, nil, false
+	}
+	return s.session.removePublishRequest()
+}
+
+// intercept returns the value transformed by the server's NotificationInterceptorFunc, if any.
+func (s *Subscription) intercept(item MonitoredItem, value ua.DataValue) ua.DataValue {
+	f := s.manager.server.notificationInterceptor
+	if f == nil {
+		return value
+	}
+	return f(context.WithValue(context.Background(), SessionKey, s.session), item, value)
+}
+
 func (s *Subscription) Items() []MonitoredItem {
 	s.RLock()
 	ret := []MonitoredItem{}
@@ -155,6 +241,10 @@ func (s *Subscription) DeleteItem(ctx context.Context, id uint32) bool {
 	if item, ok := s.items[id]; ok {
 		delete(s.items, id)
 		item.Delete()
+		// remove the links from items that trigger the deleted item.
+		for _, other := range s.items {
+			other.RemoveTriggeredItem(item)
+		}
 		s.monitoredItemCount--
 		if item.MonitoringMode() == ua.MonitoringModeDisabled {
 			s.disabledMonitoredItemCount--
@@ -268,25 +358,49 @@ func (s *Subscription) setMaxNotificationsPerPublish(maxNotificationsPerPublish
 	s.maxNotificationsPerPublish = math.MaxInt32
 }
 
-func (s *Subscription) acknowledge(seqNum uint32) bool {
+func (s *Subscription) acknowledge(seqNum uint32) ua.StatusCode {
 	s.Lock()
 	defer s.Unlock()
-	q := s.retransmissionQueue
-	for e := q.Front(); e != nil; e = e.Next() {
-		if nm, ok := e.Value.(ua.NotificationMessage); ok && nm.SequenceNumber == seqNum {
-			q.Remove(e)
-			e.Value = nil
-			return true
+	if err := s.notificationStore.Ack(s.key, seqNum); err != nil {
+		if code, ok := err.(ua.StatusCode); ok && code == ua.BadSequenceNumberUnknown {
+			return code
 		}
+		s.logger.Error("Error acknowledging notification message", ua.SubscriptionIDAttr(s.id), ua.StatusCodeAttr(err))
+		return ua.BadSequenceNumberUnknown
 	}
-	return false
+	return ua.Good
+}
+
+// retain stores the message for republishing, keeping no more than maxRetransmissionQueueLength
+// messages, and returns the sequence numbers of the stored messages.
+func (s *Subscription) retain(nm ua.NotificationMessage) []uint32 {
+	if err := s.notificationStore.Trim(s.key, maxRetransmissionQueueLength-1); err != nil {
+		s.logger.Error("Error trimming notification messages", ua.SubscriptionIDAttr(s.id), ua.StatusCodeAttr(err))
+	}
+	if err := s.notificationStore.Put(s.key, nm); err != nil {
+		s.logger.Error("Error storing notification message", ua.SubscriptionIDAttr(s.id), ua.StatusCodeAttr(err))
+	}
+	return s.available()
+}
+
+// available returns the sequence numbers of the stored messages, or nil if the store fails.
+func (s *Subscription) available() []uint32 {
+	avail, err := s.notificationStore.Available(s.key)
+	if err != nil {
+		s.logger.Error("Error reading available sequence numbers", ua.SubscriptionIDAttr(s.id), ua.StatusCodeAttr(err))
+		return nil
+	}
+	return avail
 }
 
 func (s *Subscription) startPublishing() {
 	// log.Printf("startPublishing %d \n", s.id)
 	s.cancelPublishing = make(chan struct{})
 
+	counter := &s.manager.server.goroutines.subscriptions
+	atomic.AddInt64(counter, 1)
 	go func(done chan struct{}, interval time.Duration, f func(time.Time)) {
+		defer atomic.AddInt64(counter, -1)
 		ticker := time.NewTicker(interval)
 		for {
 			select {
@@ -318,13 +432,7 @@ func (s *Subscription) publish(_ time.Time) {
 	s.resend = false
 	switch {
 	case notificationsAvailable && s.publishingEnabled:
-		sess := s.session
-		if sess == nil {
-			log.Printf("Subscription '%d' session in nil.\n", s.id)
-			s.Unlock()
-			return
-		}
-		if ch, requestid, req, results, ok := sess.removePublishRequest(); ok {
+		if ch, requestid, req, results, ok := s.removePublishRequest(); ok {
 			more := false
 			maxN := int(s.maxNotificationsPerPublish)
 			mins := make([]ua.MonitoredItemNotification, 0, 4)
@@ -352,6 +460,7 @@ func (s *Subscription) publish(_ time.Time) {
 					encs, more1 := mi.notifications(maxN)
 					for _, enc := range encs {
 						if dv, ok := enc.(ua.DataValue); ok {
+							dv = s.intercept(item, dv)
 							mins = append(mins, ua.MonitoredItemNotification{ClientHandle: item.ClientHandle(), Value: dv})
 							s.dataChangeNotificationsCount++
 							s.notificationsCount++
@@ -373,18 +482,7 @@ func (s *Subscription) publish(_ time.Time) {
 				PublishTime:      tn,
 				NotificationData: nd,
 			}
-			q := s.retransmissionQueue
-			for e := q.Front(); e != nil && q.Len() >= maxRetransmissionQueueLength; e = e.Next() {
-				q.Remove(e)
-				e.Value = nil
-			}
-			q.PushBack(nm)
-			avail := make([]uint32, 0, 4)
-			for e := q.Front(); e != nil; e = e.Next() {
-				if nm, ok := e.Value.(ua.NotificationMessage); ok {
-					avail = append(avail, nm.SequenceNumber)
-				}
-			}
+			avail := s.retain(nm)
 			ch.Write(
 				&ua.PublishResponse{
 					ResponseHeader: ua.ResponseHeader{
@@ -424,7 +522,9 @@ func (s *Subscription) publish(_ time.Time) {
 				PublishTime:      time.Now(),
 				NotificationData: []ua.ExtensionObject{ua.StatusChangeNotification{Status: ua.BadTimeout}},
 			}
-			s.session.stateChanges <- &stateChangeOp{subscriptionId: s.id, message: nm}
+			if sess := s.session; sess != nil {
+				sess.stateChanges <- &stateChangeOp{subscriptionId: s.id, message: nm}
+			}
 			if s.seqNum != math.MaxUint32 {
 				s.seqNum++
 			} else {
@@ -437,20 +537,8 @@ func (s *Subscription) publish(_ time.Time) {
 		return
 
 	case s.keepAliveCounter >= s.maxKeepAliveCount:
-		sess := s.session
-		if sess == nil {
-			log.Printf("Subscription '%d' session in nil.\n", s.id)
-			s.Unlock()
-			return
-		}
-		if ch, requestid, req, results, ok := sess.removePublishRequest(); ok {
-			avail := make([]uint32, 0, 4)
-			q := s.retransmissionQueue
-			for e := q.Front(); e != nil; e = e.Next() {
-				if nm, ok := e.Value.(ua.NotificationMessage); ok {
-					avail = append(avail, nm.SequenceNumber)
-				}
-			}
+		if ch, requestid, req, results, ok := s.removePublishRequest(); ok {
+			avail := s.available()
 			ch.Write(
 				&ua.PublishResponse{
 					ResponseHeader: ua.ResponseHeader{
@@ -488,7 +576,9 @@ func (s *Subscription) publish(_ time.Time) {
 				PublishTime:      time.Now(),
 				NotificationData: []ua.ExtensionObject{ua.StatusChangeNotification{Status: ua.BadTimeout}},
 			}
-			s.session.stateChanges <- &stateChangeOp{subscriptionId: s.id, message: nm}
+			if sess := s.session; sess != nil {
+				sess.stateChanges <- &stateChangeOp{subscriptionId: s.id, message: nm}
+			}
 			if s.seqNum != math.MaxUint32 {
 				s.seqNum++
 			} else {
@@ -550,6 +640,7 @@ func (s *Subscription) handleLatePublishRequest(ch *serverSecureChannel, request
 				encs, more1 := mi.notifications(maxN)
 				for _, enc := range encs {
 					if dv, ok := enc.(ua.DataValue); ok {
+						dv = s.intercept(item, dv)
 						mins = append(mins, ua.MonitoredItemNotification{ClientHandle: item.ClientHandle(), Value: dv})
 						s.dataChangeNotificationsCount++
 						s.notificationsCount++
@@ -571,17 +662,7 @@ func (s *Subscription) handleLatePublishRequest(ch *serverSecureChannel, request
 			PublishTime:      tn,
 			NotificationData: nd,
 		}
-		q := s.retransmissionQueue
-		for e := q.Front(); e != nil && q.Len() >= maxRetransmissionQueueLength; e = e.Next() {
-			q.Remove(e)
-		}
-		q.PushBack(nm)
-		avail := make([]uint32, 0, 4)
-		for e := q.Front(); e != nil; e = e.Next() {
-			if nm, ok := e.Value.(ua.NotificationMessage); ok {
-				avail = append(avail, nm.SequenceNumber)
-			}
-		}
+		avail := s.retain(nm)
 		ch.Write(
 			&ua.PublishResponse{
 				ResponseHeader: ua.ResponseHeader{
@@ -614,13 +695,7 @@ func (s *Subscription) handleLatePublishRequest(ch *serverSecureChannel, request
 		s.Unlock()
 		return true
 	case s.keepAliveCounter >= s.maxKeepAliveCount:
-		avail := make([]uint32, 0, 4)
-		q := s.retransmissionQueue
-		for e := q.Front(); e != nil; e = e.Next() {
-			if nm, ok := e.Value.(ua.NotificationMessage); ok {
-				avail = append(avail, nm.SequenceNumber)
-			}
-		}
+		avail := s.available()
 		results := make([]ua.StatusCode, len(req.SubscriptionAcknowledgements))
 		ch.Write(
 			&ua.PublishResponse{
@@ -79,6 +79,20 @@ func (m *SubscriptionManager) Delete(s *Subscription) {
 	}
 }
 
+// Transfer assigns the subscription to the session and returns the sequence numbers
+// available for republish.
+func (m *SubscriptionManager) Transfer(s *Subscription, session *Session, sendInitialValues bool) []uint32 {
+	avail := s.transfer(session, sendInitialValues)
+	if m.server.serverDiagnostics {
+		// move the diagnostics node to the new session.
+		m.Lock()
+		m.removeDiagnosticsNode(s)
+		m.addDiagnosticsNode(s)
+		m.Unlock()
+	}
+	return avail
+}
+
 // Len returns the number of subscriptions.
 func (m *SubscriptionManager) Len() int {
 	m.RLock()
@@ -152,42 +166,7 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 		srv.historian,
 	)
 	subscriptionDiagnosticsVariable.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
-		s.RLock()
-		defer s.RUnlock()
-		dv := ua.NewDataValue(ua.SubscriptionDiagnosticsDataType{
-				SessionID:                  s.sessionId,
-				SubscriptionID:             s.id,
-				Priority:                   s.priority,
-				PublishingInterval:         s.publishingInterval,
-				MaxKeepAliveCount:          s.maxKeepAliveCount,
-				MaxLifetimeCount:           s.lifetimeCount,
-				MaxNotificationsPerPublish: s.maxNotificationsPerPublish,
-				PublishingEnabled:          s.publishingEnabled,
-				ModifyCount:                s.modifyCount,
-				// EnableCount:                  uint32(0),
-				// DisableCount:                 uint32(0),
-				RepublishRequestCount:        s.republishRequestCount,
-				RepublishMessageRequestCount: s.republishMessageRequestCount,
-				RepublishMessageCount:        s.republishMessageCount,
-				// TransferRequestCount:         uint32(0),
-				// TransferredToAltClientCount:  uint32(0),
-				// TransferredToSameClientCount: uint32(0),
-				PublishRequestCount:          s.publishRequestCount,
-				DataChangeNotificationsCount: s.dataChangeNotificationsCount,
-				EventNotificationsCount:      s.eventNotificationsCount,
-				NotificationsCount:           s.notificationsCount,
-				LatePublishRequestCount:      s.latePublishRequestCount,
-				CurrentKeepAliveCount:        s.keepAliveCounter,
-				CurrentLifetimeCount:         s.lifetimeCounter,
-				UnacknowledgedMessageCount:   s.unacknowledgedMessageCount,
-				// DiscardedMessageCount:        uint32(0),
-				MonitoredItemCount:           s.monitoredItemCount,
-				DisabledMonitoredItemCount:   s.disabledMonitoredItemCount,
-				MonitoringQueueOverflowCount: s.monitoringQueueOverflowCount,
-				NextSequenceNumber:           s.seqNum,
-				// EventQueueOverFlowCount:      uint32(0),
-			}, 0, time.Now(), 0, time.Now(), 0)
-		return dv
+		return ua.NewDataValue(s.diagnostics(), 0, time.Now(), 0, time.Now(), 0)
 	})
 	nodes = append(nodes, subscriptionDiagnosticsVariable)
 	n := NewVariableNode(
@@ -905,6 +884,12 @@ func (m *SubscriptionManager) addDiagnosticsNode(s *Subscription) {
 	})
 	nodes = append(nodes, n)
 
+	setDiagnosticsRolePermissions(nodes)
+	setDiagnosticsVisibility(nodes, func() *Session {
+		s.RLock()
+		defer s.RUnlock()
+		return s.session
+	})
 	err := nm.AddNodes(nodes...)
 	if err != nil {
 		log.Printf("Error adding session diagnostics objects.\n")
@@ -1050,6 +1050,28 @@ const testnodeset = `
             </uax:ListOfInt16>
         </Value>
     </UAVariable>
+    <UAVariable DataType="Int32" ValueRank="1" NodeId="ns=1;s=Demo.Static.Arrays.FixedInt32" ArrayDimensions="4" BrowseName="1:FixedInt32" UserAccessLevel="3" AccessLevel="3">
+        <DisplayName>FixedInt32</DisplayName>
+        <References>
+            <Reference ReferenceType="HasTypeDefinition">i=63</Reference>
+            <Reference ReferenceType="Organizes" IsForward="false">ns=1;s=Demo.Static.Arrays</Reference>
+        </References>
+        <Value>
+            <uax:ListOfInt32>
+                <uax:Int32>1</uax:Int32>
+                <uax:Int32>2</uax:Int32>
+                <uax:Int32>3</uax:Int32>
+                <uax:Int32>4</uax:Int32>
+            </uax:ListOfInt32>
+        </Value>
+    </UAVariable>
+    <UAVariable DataType="Int32" ValueRank="0" NodeId="ns=1;s=Demo.Static.Arrays.FixedInt32Matrix" ArrayDimensions="2,3" BrowseName="1:FixedInt32Matrix" UserAccessLevel="3" AccessLevel="3">
+        <DisplayName>FixedInt32Matrix</DisplayName>
+        <References>
+            <Reference ReferenceType="HasTypeDefinition">i=63</Reference>
+            <Reference ReferenceType="Organizes" IsForward="false">ns=1;s=Demo.Static.Arrays</Reference>
+        </References>
+    </UAVariable>
     <UAVariable DataType="Int32" ValueRank="1" NodeId="ns=1;s=Demo.Static.Arrays.Int32" ArrayDimensions="0" BrowseName="1:Int32" UserAccessLevel="3" AccessLevel="3">
         <DisplayName>Int32</DisplayName>
         <References>
@@ -1418,7 +1440,7 @@ const testnodeset = `
             <uax:Int32>1</uax:Int32>
         </Value>
     </UAVariable>
-    <UAVariable DataType="Float" NodeId="ns=1;s=Demo.Static.Scalar.Float" BrowseName="1:Float" UserAccessLevel="3" AccessLevel="3">
+    <UAVariable DataType="Float" NodeId="ns=1;s=Demo.Static.Scalar.Float" BrowseName="1:Float" UserAccessLevel="7" AccessLevel="7">
         <DisplayName>Float</DisplayName>
         <References>
             <Reference ReferenceType="HasTypeDefinition">i=63</Reference>
@@ -1440,6 +1462,17 @@ const testnodeset = `
             </uax:Guid>
         </Value>
     </UAVariable>
+    <UAVariable DataType="Guid" NodeId="ns=1;s=Demo.InvalidGuid" BrowseName="1:InvalidGuid" UserAccessLevel="1" AccessLevel="1">
+        <DisplayName>InvalidGuid</DisplayName>
+        <References>
+            <Reference ReferenceType="HasTypeDefinition">i=63</Reference>
+        </References>
+        <Value>
+            <uax:Guid>
+                <uax:String>not-a-guid</uax:String>
+            </uax:Guid>
+        </Value>
+    </UAVariable>
     <UAVariable DataType="Int16" NodeId="ns=1;s=Demo.Static.Scalar.Int16" BrowseName="1:Int16" UserAccessLevel="3" AccessLevel="3">
         <DisplayName>Int16</DisplayName>
         <References>
@@ -6,6 +6,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/awcullen/opcua/server"
 	"github.com/awcullen/opcua/ua"
@@ -16,6 +17,8 @@ var (
 	host, _         = os.Hostname()
 	port            = 46010
 	SoftwareVersion = "0.3.0"
+	BuildNumber     = "42"
+	BuildDate       = time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
 )
 
 func NewTestServer() (*server.Server, error) {
@@ -31,6 +34,17 @@ func NewTestServer() (*server.Server, error) {
 		userids[i].Password = string(hash)
 	}
 
+	// root user may also toggle historizing
+	rules := append([]server.IdentityMappingRule{}, server.DefaultIdentityMappingRules...)
+	rules = append(rules, server.IdentityMappingRule{
+		NodeID: ua.ObjectIDWellKnownRoleEngineer,
+		Identities: []ua.IdentityMappingRuleType{
+			{CriteriaType: ua.IdentityCriteriaTypeUserName, Criteria: "root"},
+		},
+		ApplicationsExclude: true,
+		EndpointsExclude:    true,
+	})
+
 	// create server
 	srv, err := server.New(
 		ua.ApplicationDescription{
@@ -54,7 +68,13 @@ func NewTestServer() (*server.Server, error) {
 				ManufacturerName: "awcullen",
 				ProductName:      "testserver",
 				SoftwareVersion:  SoftwareVersion,
+				BuildNumber:      BuildNumber,
+				BuildDate:        BuildDate,
 			}),
+		server.WithApplicationNames(
+			ua.LocalizedText{Text: fmt.Sprintf("testserver@%s", host), Locale: "en"},
+			ua.LocalizedText{Text: fmt.Sprintf("Testserver@%s", host), Locale: "de"},
+		),
 		server.WithAuthenticateUserNameIdentityFunc(func(userIdentity ua.UserNameIdentity, applicationURI string, endpointURL string) error {
 			valid := false
 			for _, user := range userids {
@@ -71,6 +91,8 @@ func NewTestServer() (*server.Server, error) {
 			// log.Printf("Login user: %s from %s\n", userIdentity.UserName, applicationURI)
 			return nil
 		}),
+		server.WithRolesProvider(server.NewRulesBasedRolesProvider(rules)),
+		server.WithHistorian(server.NewMemoryHistorian(1000)),
 		server.WithAnonymousIdentity(true),
 		server.WithSecurityPolicyNone(true),
 		server.WithInsecureSkipVerify(),
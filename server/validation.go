@@ -0,0 +1,71 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package server
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/awcullen/opcua/ua"
+)
+
+// ValidationIssue is a problem found in the address space by Validate.
+type ValidationIssue struct {
+	NodeID  ua.NodeID
+	Message string
+}
+
+// String returns a string representation, e.g. "ns=2;s=Demo: missing DataType"
+func (i ValidationIssue) String() string {
+	return fmt.Sprintf("%s: %s", i.NodeID, i.Message)
+}
+
+// Validate checks the referential integrity of the address space. Validate reports references
+// to unknown targets or reference types, variables without a known DataType, and objects and
+// variables without a HasTypeDefinition reference. References to other servers are not checked.
+// Validate may be called before ListenAndServe.
+func (srv *Server) Validate() []ValidationIssue {
+	m := srv.NamespaceManager()
+	m.RLock()
+	defer m.RUnlock()
+	issues := []ValidationIssue{}
+	for id, n := range m.nodes {
+		hasTypeDefinition := false
+		for _, r := range n.References() {
+			if _, ok := m.nodes[r.ReferenceTypeID]; !ok {
+				issues = append(issues, ValidationIssue{id, fmt.Sprintf("unknown reference type %s", r.ReferenceTypeID)})
+			}
+			if r.TargetID.ServerIndex != 0 {
+				continue
+			}
+			if _, ok := m.nodes[ua.ToNodeID(r.TargetID, m.namespaces)]; !ok {
+				issues = append(issues, ValidationIssue{id, fmt.Sprintf("unknown target %s", r.TargetID)})
+			}
+			if !r.IsInverse && r.ReferenceTypeID == ua.ReferenceTypeIDHasTypeDefinition {
+				hasTypeDefinition = true
+			}
+		}
+		switch n1 := n.(type) {
+		case *VariableNode:
+			if n1.DataType() == nil {
+				issues = append(issues, ValidationIssue{id, "missing DataType"})
+			} else if _, ok := m.nodes[n1.DataType()].(*DataTypeNode); !ok {
+				issues = append(issues, ValidationIssue{id, fmt.Sprintf("unknown DataType %s", n1.DataType())})
+			}
+			if !hasTypeDefinition {
+				issues = append(issues, ValidationIssue{id, "missing HasTypeDefinition"})
+			}
+		case *ObjectNode:
+			if !hasTypeDefinition {
+				issues = append(issues, ValidationIssue{id, "missing HasTypeDefinition"})
+			}
+		}
+	}
+	sort.Slice(issues, func(i, j int) bool {
+		if a, b := fmt.Sprint(issues[i].NodeID), fmt.Sprint(issues[j].NodeID); a != b {
+			return a < b
+		}
+		return issues[i].Message < issues[j].Message
+	})
+	return issues
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/awcullen/opcua/ua"
 )
@@ -22,15 +23,50 @@ type VariableNode struct {
 	valueRank               int32
 	arrayDimensions         []uint32
 	accessLevel             byte
+	accessLevelEx           uint32
+	writeMask               uint32
+	audited                 bool
 	minimumSamplingInterval float64
 	historizing             bool
 	historian               HistoryReadWriter
 	readValueHandler        func(context.Context, ua.ReadValueID) ua.DataValue
+	readLock                sync.Mutex
+	readCache               *cachedRead
+	readPerSession          bool
 	writeValueHandler       func(context.Context, ua.WriteValue) (ua.DataValue, ua.StatusCode)
+	writeValidator          func(ua.Variant) ua.StatusCode
+	changeTolerance         *ChangeTolerance
+	initialValueHandler     func(context.Context, ua.ReadValueID) ua.DataValue
+	initialValueLock        sync.Mutex
+	samplingFunction        func(context.Context) ua.DataValue
+	samplingLock            sync.Mutex
+	sample                  ua.DataValue
+	sampleTime              time.Time
+	valueSet                bool
+	structureVersion        uint32
+	semanticsVersion        uint32
+	valueChangedHandlers    []valueChangedHandler
+	lastValueChangedHandle  uint32
+}
+
+// valueChangedHandler is a handler added with AddValueChangedHandler.
+type valueChangedHandler struct {
+	handle uint32
+	f      func(oldValue, newValue ua.DataValue)
+}
+
+// cachedRead is a value returned by the ReadValueHandler, and the time of the read.
+type cachedRead struct {
+	value ua.DataValue
+	time  time.Time
 }
 
 var _ Node = (*VariableNode)(nil)
 
+// defaultVariableWriteMask is the WriteMask of a new VariableNode. The bits of the other attributes
+// are ignored, the Write service supports writing only these attributes and the Value.
+const defaultVariableWriteMask = uint32(ua.AttributeWriteMaskDisplayName | ua.AttributeWriteMaskDescription | ua.AttributeWriteMaskHistorizing)
+
 func NewVariableNode(nodeID ua.NodeID, browseName ua.QualifiedName, displayName ua.LocalizedText, description ua.LocalizedText, rolePermissions []ua.RolePermissionType, references []ua.Reference, value ua.DataValue, dataType ua.NodeID, valueRank int32, arrayDimensions []uint32, accessLevel byte, minimumSamplingInterval float64, historizing bool, historian HistoryReadWriter) *VariableNode {
 	return &VariableNode{
 		nodeId:                  nodeID,
@@ -46,6 +82,7 @@ func NewVariableNode(nodeID ua.NodeID, browseName ua.QualifiedName, displayName
 		valueRank:               valueRank,
 		arrayDimensions:         arrayDimensions,
 		accessLevel:             accessLevel,
+		writeMask:               defaultVariableWriteMask,
 		minimumSamplingInterval: minimumSamplingInterval,
 		historizing:             historizing,
 		historian:               historian,
@@ -64,17 +101,40 @@ func (n *VariableNode) NodeClass() ua.NodeClass {
 
 // BrowseName returns the BrowseName attribute of this node.
 func (n *VariableNode) BrowseName() ua.QualifiedName {
-	return n.browseName
+	n.RLock()
+	res := n.browseName
+	n.RUnlock()
+	return res
 }
 
 // DisplayName returns the DisplayName attribute of this node.
 func (n *VariableNode) DisplayName() ua.LocalizedText {
-	return n.displayName
+	n.RLock()
+	res := n.displayName
+	n.RUnlock()
+	return res
+}
+
+// SetDisplayName sets the DisplayName attribute of this node.
+func (n *VariableNode) SetDisplayName(value ua.LocalizedText) {
+	n.Lock()
+	n.displayName = value
+	n.Unlock()
 }
 
 // Description returns the Description attribute of this node.
 func (n *VariableNode) Description() ua.LocalizedText {
-	return n.description
+	n.RLock()
+	res := n.description
+	n.RUnlock()
+	return res
+}
+
+// SetDescription sets the Description attribute of this node.
+func (n *VariableNode) SetDescription(value ua.LocalizedText) {
+	n.Lock()
+	n.description = value
+	n.Unlock()
 }
 
 // RolePermissions returns the RolePermissions attribute of this node.
@@ -90,10 +150,7 @@ func (n *VariableNode) UserRolePermissions(ctx context.Context) []ua.RolePermiss
 		return filteredPermissions
 	}
 	roles := session.UserRoles()
-	rolePermissions := n.RolePermissions()
-	if rolePermissions == nil {
-		rolePermissions = session.Server().RolePermissions()
-	}
+	rolePermissions := session.Server().effectiveRolePermissions(ctx, n, roles)
 	for _, role := range roles {
 		for _, rp := range rolePermissions {
 			if rp.RoleID == role {
@@ -129,14 +186,168 @@ func (n *VariableNode) Value() ua.DataValue {
 
 // SetValue sets the value of the Variable.
 func (n *VariableNode) SetValue(value ua.DataValue) {
+	n.storeValue(value)()
+}
+
+// storeValue sets the Value attribute, and returns a function that notifies the value changed
+// handlers, so the caller may notify them after releasing its own locks.
+func (n *VariableNode) storeValue(value ua.DataValue) func() {
 	n.Lock()
+	oldValue := n.value
 	n.value = value
-	if n.historizing {
+	n.valueSet = true
+	if n.historizing && n.historian != nil {
 		n.historian.WriteValue(context.Background(), n.nodeId, value)
 	}
+	handlers := n.valueChangedHandlers
+	n.Unlock()
+	return func() {
+		notifyValueChanged(handlers, oldValue, value)
+	}
+}
+
+// restoreValue restores the value replaced by a transactional write that was rolled back. The handlers,
+// the historian and the monitored items are not notified, as the write is not committed.
+func (n *VariableNode) restoreValue(value ua.DataValue, valueSet bool) {
+	n.Lock()
+	n.value = value
+	n.valueSet = valueSet
+	n.readCache = nil
+	n.Unlock()
+}
+
+// SetValueRange writes the elements of the value to the elements of the Value attribute selected
+// by the IndexRange, e.g. "1:2". The elements are merged while holding the lock of the node, so
+// concurrent writes to other parts of the array are not lost. Returns BadIndexRangeInvalid if
+// the number of elements does not match the range, or BadTypeMismatch if the types differ. A value
+// seeded by the InitialValueHandler is seeded first, and BadIndexRangeNoData is returned if the
+// handler did not seed it.
+func (n *VariableNode) SetValueRange(value ua.DataValue, indexRange string) ua.StatusCode {
+	n.initializeValue(context.Background())
+	n.Lock()
+	if !n.valueSet && n.initialValueHandler != nil {
+		n.Unlock()
+		return ua.BadIndexRangeNoData
+	}
+	oldValue := n.value
+	result, status := writeRange(oldValue, value, indexRange)
+	if status != ua.Good {
+		n.Unlock()
+		return status
+	}
+	n.value = result
+	n.valueSet = true
+	if n.historizing && n.historian != nil {
+		n.historian.WriteValue(context.Background(), n.nodeId, result)
+	}
+	handlers := n.valueChangedHandlers
+	n.Unlock()
+	notifyValueChanged(handlers, oldValue, result)
+	return ua.Good
+}
+
+// Update sets the value of the Variable to the result of the func, which receives the current value.
+// The func is called while holding the lock of the node, so it is serialized with writes by clients,
+// SetValue and other updates, and no update is lost, e.g. when incrementing a counter. The func must
+// not call methods of the node. Returns the new value. Monitored items report the new value when
+// they next sample the node.
+func (n *VariableNode) Update(f func(old ua.DataValue) ua.DataValue) ua.DataValue {
+	n.initializeValue(context.Background())
+	n.Lock()
+	oldValue := n.value
+	result := f(oldValue)
+	n.value = result
+	n.valueSet = true
+	if n.historizing && n.historian != nil {
+		n.historian.WriteValue(context.Background(), n.nodeId, result)
+	}
+	handlers := n.valueChangedHandlers
+	n.Unlock()
+	notifyValueChanged(handlers, oldValue, result)
+	return result
+}
+
+// normalizeWriteValue returns the value to store for a write of the Value attribute by a client. The
+// timestamps the client omitted are the current time. A client may only write the timestamps and the
+// StatusCode if the AccessLevel of the node includes TimestampWrite and StatusWrite, which is checked
+// by checkWriteValue. The StatusCode is kept, a client that omits it writes Good.
+func (n *VariableNode) normalizeWriteValue(value ua.DataValue) ua.DataValue {
+	now := time.Now()
+	if value.SourceTimestamp.IsZero() {
+		value.SourceTimestamp, value.SourcePicoseconds = now, 0
+	}
+	if value.ServerTimestamp.IsZero() {
+		value.ServerTimestamp, value.ServerPicoseconds = now, 0
+	}
+	return value
+}
+
+// AddValueChangedHandler adds a func that is called after each time the value of the Variable is stored,
+// by SetValue, SetValueRange, Update or a client's Write, with the previous and the new value. The func is
+// called after the lock of the node is released, so it may read or set the value of the node. Funcs are
+// called in the order they were added, on the goroutine that stored the value. Returns a handle to remove
+// the func with RemoveValueChangedHandler.
+func (n *VariableNode) AddValueChangedHandler(f func(oldValue, newValue ua.DataValue)) uint32 {
+	n.Lock()
+	defer n.Unlock()
+	n.lastValueChangedHandle++
+	handlers := make([]valueChangedHandler, len(n.valueChangedHandlers), len(n.valueChangedHandlers)+1)
+	copy(handlers, n.valueChangedHandlers)
+	n.valueChangedHandlers = append(handlers, valueChangedHandler{handle: n.lastValueChangedHandle, f: f})
+	return n.lastValueChangedHandle
+}
+
+// RemoveValueChangedHandler removes the func added with AddValueChangedHandler.
+func (n *VariableNode) RemoveValueChangedHandler(handle uint32) {
+	n.Lock()
+	defer n.Unlock()
+	handlers := make([]valueChangedHandler, 0, len(n.valueChangedHandlers))
+	for _, h := range n.valueChangedHandlers {
+		if h.handle != handle {
+			handlers = append(handlers, h)
+		}
+	}
+	n.valueChangedHandlers = handlers
+}
+
+// notifyValueChanged calls the handlers with the previous and the new value. The handlers are a copy
+// taken while holding the lock of the node, which is never modified in place.
+func notifyValueChanged(handlers []valueChangedHandler, oldValue, newValue ua.DataValue) {
+	for _, h := range handlers {
+		h.f(oldValue, newValue)
+	}
+}
+
+// SetTimeValue sets the Value attribute of this node to a DateTime with a status of Good.
+// The zero time is encoded as an unspecified DateTime.
+func (n *VariableNode) SetTimeValue(value time.Time) {
+	n.SetValue(ua.GoodDataValue(value))
+}
+
+// ReportStructureChanged reports that the structure of the DataType of the value changed.
+// Each monitored item sets the StructureChanged bit on its next notification, so clients
+// re-read the DataTypeDefinition.
+func (n *VariableNode) ReportStructureChanged() {
+	n.Lock()
+	n.structureVersion++
+	n.Unlock()
+}
+
+// ReportSemanticsChanged reports that the semantics of the value changed, e.g. the EngineeringUnits
+// or EURange properties. Each monitored item sets the SemanticsChanged bit on its next notification.
+func (n *VariableNode) ReportSemanticsChanged() {
+	n.Lock()
+	n.semanticsVersion++
 	n.Unlock()
 }
 
+// changeVersions returns the number of times a structure or semantics change was reported.
+func (n *VariableNode) changeVersions() (structureVersion, semanticsVersion uint32) {
+	n.RLock()
+	defer n.RUnlock()
+	return n.structureVersion, n.semanticsVersion
+}
+
 // DataType returns the DataType attribute of this node.
 func (n *VariableNode) DataType() ua.NodeID {
 	return n.dataType
@@ -154,22 +365,38 @@ func (n *VariableNode) ArrayDimensions() []uint32 {
 
 // AccessLevel returns the AccessLevel attribute of this node.
 func (n *VariableNode) AccessLevel() byte {
-	return n.accessLevel
+	n.RLock()
+	res := n.accessLevel
+	n.RUnlock()
+	return res
+}
+
+// AccessLevelEx returns the AccessLevelEx attribute of this node. The first 8 bits are the AccessLevel.
+func (n *VariableNode) AccessLevelEx() uint32 {
+	n.RLock()
+	res := uint32(n.accessLevel) | n.accessLevelEx
+	n.RUnlock()
+	return res
+}
+
+// SetAccessLevelEx sets the AccessLevelEx attribute of this node. The first 8 bits set the AccessLevel.
+func (n *VariableNode) SetAccessLevelEx(value uint32) {
+	n.Lock()
+	n.accessLevel = byte(value)
+	n.accessLevelEx = value &^ 0xFF
+	n.Unlock()
 }
 
 // UserAccessLevel returns the AccessLevel attribute of this node for this user.
 func (n *VariableNode) UserAccessLevel(ctx context.Context) byte {
-	accessLevel := n.accessLevel
+	accessLevel := n.AccessLevel()
 	session, ok := ctx.Value(SessionKey).(*Session)
 	if !ok {
 		return 0
 	}
 	roles := session.UserRoles()
-	rolePermissions := n.RolePermissions()
-	if rolePermissions == nil {
-		rolePermissions = session.Server().RolePermissions()
-	}
-	var currentRead, currentWrite, historyRead bool
+	rolePermissions := session.Server().effectiveRolePermissions(ctx, n, roles)
+	var currentRead, currentWrite, historyRead, historyWrite bool
 	for _, role := range roles {
 		for _, rp := range rolePermissions {
 			if rp.RoleID == role {
@@ -182,6 +409,9 @@ func (n *VariableNode) UserAccessLevel(ctx context.Context) byte {
 				if rp.Permissions&ua.PermissionTypeReadHistory != 0 {
 					historyRead = true
 				}
+				if rp.Permissions&(ua.PermissionTypeInsertHistory|ua.PermissionTypeModifyHistory|ua.PermissionTypeDeleteHistory) != 0 {
+					historyWrite = true
+				}
 			}
 		}
 	}
@@ -194,9 +424,58 @@ func (n *VariableNode) UserAccessLevel(ctx context.Context) byte {
 	if !historyRead {
 		accessLevel &^= ua.AccessLevelsHistoryRead
 	}
+	if !historyWrite {
+		accessLevel &^= ua.AccessLevelsHistoryWrite
+	}
 	return accessLevel
 }
 
+// WriteMask returns the WriteMask attribute of this node.
+func (n *VariableNode) WriteMask() uint32 {
+	n.RLock()
+	res := n.writeMask
+	n.RUnlock()
+	return res
+}
+
+// SetWriteMask sets the WriteMask attribute of this node.
+func (n *VariableNode) SetWriteMask(value uint32) {
+	n.Lock()
+	n.writeMask = value
+	n.Unlock()
+}
+
+// UserWriteMask returns the WriteMask attribute of this node for this user.
+func (n *VariableNode) UserWriteMask(ctx context.Context) uint32 {
+	writeMask := n.WriteMask()
+	rp := n.UserRolePermissions(ctx)
+	if !IsUserPermitted(rp, ua.PermissionTypeWriteAttribute) {
+		writeMask &= uint32(ua.AttributeWriteMaskHistorizing | ua.AttributeWriteMaskRolePermissions)
+	}
+	if !IsUserPermitted(rp, ua.PermissionTypeWriteHistorizing) {
+		writeMask &^= uint32(ua.AttributeWriteMaskHistorizing)
+	}
+	if !IsUserPermitted(rp, ua.PermissionTypeWriteRolePermissions) {
+		writeMask &^= uint32(ua.AttributeWriteMaskRolePermissions)
+	}
+	return writeMask
+}
+
+// Audited returns whether writes to this node raise audit events.
+func (n *VariableNode) Audited() bool {
+	n.RLock()
+	res := n.audited
+	n.RUnlock()
+	return res
+}
+
+// SetAudited sets whether writes to this node raise audit events, if the server has auditing enabled.
+func (n *VariableNode) SetAudited(value bool) {
+	n.Lock()
+	n.audited = value
+	n.Unlock()
+}
+
 // MinimumSamplingInterval returns the MinimumSamplingInterval attribute of this node.
 func (n *VariableNode) MinimumSamplingInterval() float64 {
 	return n.minimumSamplingInterval
@@ -217,13 +496,171 @@ func (n *VariableNode) SetHistorizing(historizing bool) {
 	n.Unlock()
 }
 
-// SetReadValueHandler sets the ReadValueHandler of this node.
+// Historian returns the HistoryReadWriter that stores the values of this node, or nil.
+func (n *VariableNode) Historian() HistoryReadWriter {
+	n.RLock()
+	ret := n.historian
+	n.RUnlock()
+	return ret
+}
+
+// SetReadValueHandler sets the ReadValueHandler of this node. A value returned by the handler may be
+// returned again to any session that reads the node with a MaxAge, so the value must not depend on the
+// session of the context.
 func (n *VariableNode) SetReadValueHandler(value func(context.Context, ua.ReadValueID) ua.DataValue) {
 	n.Lock()
 	n.readValueHandler = value
+	n.readCache = nil
+	n.Unlock()
+}
+
+// readValue calls the ReadValueHandler, unless the handler returned the whole value within maxAge
+// milliseconds. Only the whole value is cached, and the index range is applied to the cached value. A
+// maxAge of 0 always calls the handler, without waiting for other reads, and updates the cache. Bad
+// values, and the values of handlers that depend on the session, are not cached.
+func (n *VariableNode) readValue(ctx context.Context, f func(context.Context, ua.ReadValueID) ua.DataValue, req ua.ReadValueID, maxAge float64) ua.DataValue {
+	n.RLock()
+	perSession := n.readPerSession
+	n.RUnlock()
+	if perSession || (maxAge <= 0 && req.IndexRange != "") {
+		return f(ctx, req)
+	}
+	if maxAge <= 0 {
+		c := &cachedRead{value: f(ctx, req), time: time.Now()}
+		n.storeReadCache(c)
+		return c.value
+	}
+	// reads with a MaxAge wait for the read that fills the cache, so the handler is called once.
+	n.readLock.Lock()
+	defer n.readLock.Unlock()
+	n.RLock()
+	c := n.readCache
+	n.RUnlock()
+	if c == nil || float64(time.Since(c.time))/float64(time.Millisecond) >= maxAge {
+		whole := req
+		whole.IndexRange = ""
+		c = &cachedRead{value: f(ctx, whole), time: time.Now()}
+		n.storeReadCache(c)
+	}
+	if req.IndexRange == "" || c.value.StatusCode.IsBad() {
+		return c.value
+	}
+	return readRangeDims(c.value, req.IndexRange, n.ArrayDimensions())
+}
+
+// storeReadCache caches the value returned by the ReadValueHandler, unless a later value was cached
+// by a concurrent read. A Bad value discards the cache.
+func (n *VariableNode) storeReadCache(c *cachedRead) {
+	n.Lock()
+	defer n.Unlock()
+	if c.value.StatusCode.IsBad() {
+		n.readCache = nil
+		return
+	}
+	if n.readCache == nil || !n.readCache.time.After(c.time) {
+		n.readCache = c
+	}
+}
+
+// clearReadCache discards the values cached by readValue, e.g. after a write to the device.
+func (n *VariableNode) clearReadCache() {
+	n.Lock()
+	n.readCache = nil
+	n.Unlock()
+}
+
+// SetReadValueErrorHandler sets a ReadValueHandler of this node that may return an error. A
+// ua.StatusCode error is returned to the client as the status of the value. Any other error
+// becomes BadInternalError, and the error text is returned as diagnostics to clients that request
+// operation-level diagnostics.
+func (n *VariableNode) SetReadValueErrorHandler(value func(context.Context, ua.ReadValueID) (ua.DataValue, error)) {
+	n.SetReadValueHandler(func(ctx context.Context, req ua.ReadValueID) ua.DataValue {
+		v, err := value(ctx, req)
+		if err != nil {
+			return ua.NewDataValue(nil, handlerStatusCode(ctx, err), time.Time{}, 0, time.Now(), 0)
+		}
+		return v
+	})
+}
+
+// SetInitialValueHandler sets a handler that seeds the value of this node on first access, e.g. the
+// first Read or the first sample of a MonitoredItem. The handler is called once, even if the node is
+// accessed concurrently, unless it returns a Bad status. The handler is not called if a value was set.
+func (n *VariableNode) SetInitialValueHandler(value func(context.Context, ua.ReadValueID) ua.DataValue) {
+	n.Lock()
+	n.initialValueHandler = value
 	n.Unlock()
 }
 
+// initializeValue calls the InitialValueHandler, if the value was not set. The initialValueLock only
+// serializes the callers of the handler, writers do not take it. So the value is seeded only if it
+// is still not set when the handler returns.
+func (n *VariableNode) initializeValue(ctx context.Context) {
+	n.RLock()
+	f, valueSet := n.initialValueHandler, n.valueSet
+	n.RUnlock()
+	if f == nil || valueSet {
+		return
+	}
+	n.initialValueLock.Lock()
+	defer n.initialValueLock.Unlock()
+	n.RLock()
+	valueSet = n.valueSet
+	n.RUnlock()
+	if valueSet {
+		return
+	}
+	v := f(ctx, ua.ReadValueID{NodeID: n.nodeId, AttributeID: ua.AttributeIDValue})
+	if v.StatusCode.IsBad() {
+		return
+	}
+	n.Lock()
+	if n.valueSet {
+		// the value was set while the handler was called.
+		n.Unlock()
+		return
+	}
+	oldValue := n.value
+	n.value = v
+	n.valueSet = true
+	if n.historizing && n.historian != nil {
+		n.historian.WriteValue(context.Background(), n.nodeId, v)
+	}
+	handlers := n.valueChangedHandlers
+	n.Unlock()
+	notifyValueChanged(handlers, oldValue, v)
+}
+
+// SetSamplingFunction sets a func that computes the value of this node for MonitoredItems, e.g. a
+// moving average of another node. The sampler calls the func in each sampling interval, instead of
+// reading the value of the node. Items that sample the node on the same tick share one call. The
+// Read service is not affected.
+func (n *VariableNode) SetSamplingFunction(value func(context.Context) ua.DataValue) {
+	n.Lock()
+	n.samplingFunction = value
+	n.Unlock()
+}
+
+// SamplingFunction returns the func that computes the value of this node for MonitoredItems, or nil.
+func (n *VariableNode) SamplingFunction() func(context.Context) ua.DataValue {
+	n.RLock()
+	defer n.RUnlock()
+	return n.samplingFunction
+}
+
+// sampleValue returns the value computed by the sampling function. A value computed within half
+// of the sampling interval is reused, so the func is called at most once per tick.
+func (n *VariableNode) sampleValue(ctx context.Context, f func(context.Context) ua.DataValue, interval time.Duration) ua.DataValue {
+	n.samplingLock.Lock()
+	defer n.samplingLock.Unlock()
+	if !n.sampleTime.IsZero() && time.Since(n.sampleTime) < interval/2 {
+		return n.sample
+	}
+	n.sample = f(ctx)
+	n.sampleTime = time.Now()
+	return n.sample
+}
+
 // SetWriteValueHandler sets the WriteValueHandler of this node.
 func (n *VariableNode) SetWriteValueHandler(value func(context.Context, ua.WriteValue) (ua.DataValue, ua.StatusCode)) {
 	n.Lock()
@@ -231,6 +668,52 @@ func (n *VariableNode) SetWriteValueHandler(value func(context.Context, ua.Write
 	n.Unlock()
 }
 
+// SetWriteValueErrorHandler sets a WriteValueHandler of this node that may return an error. A
+// ua.StatusCode error is returned to the client as the result of the write. Any other error
+// becomes BadInternalError, and the error text is returned as diagnostics to clients that request
+// operation-level diagnostics.
+func (n *VariableNode) SetWriteValueErrorHandler(value func(context.Context, ua.WriteValue) (ua.DataValue, error)) {
+	n.SetWriteValueHandler(func(ctx context.Context, req ua.WriteValue) (ua.DataValue, ua.StatusCode) {
+		v, err := value(ctx, req)
+		if err != nil {
+			return v, handlerStatusCode(ctx, err)
+		}
+		return v, ua.Good
+	})
+}
+
+// SetWriteValidator sets a func that validates the content of values written to this node, e.g. the
+// format of a ByteString. The validator is called after the data type is checked, and before the
+// value is stored. If the write specifies an IndexRange, the validator receives the written elements.
+// A status other than Good rejects the write, e.g. BadInvalidArgument.
+func (n *VariableNode) SetWriteValidator(value func(ua.Variant) ua.StatusCode) {
+	n.Lock()
+	n.writeValidator = value
+	n.Unlock()
+}
+
+// WriteValidator returns the func that validates the content of values written to this node, or nil.
+func (n *VariableNode) WriteValidator() func(ua.Variant) ua.StatusCode {
+	n.RLock()
+	defer n.RUnlock()
+	return n.writeValidator
+}
+
+// SetChangeTolerance sets the tolerance used to detect a change of the value, when the client
+// requests no deadband. If nil, the tolerance of the server is used.
+func (n *VariableNode) SetChangeTolerance(value *ChangeTolerance) {
+	n.Lock()
+	n.changeTolerance = value
+	n.Unlock()
+}
+
+// ChangeTolerance returns the tolerance used to detect a change of the value, or nil.
+func (n *VariableNode) ChangeTolerance() *ChangeTolerance {
+	n.RLock()
+	defer n.RUnlock()
+	return n.changeTolerance
+}
+
 // IsAttributeIDValid returns true if attributeId is supported for the node.
 func (n *VariableNode) IsAttributeIDValid(attributeID uint32) bool {
 	switch attributeID {
@@ -238,7 +721,8 @@ func (n *VariableNode) IsAttributeIDValid(attributeID uint32) bool {
 		ua.AttributeIDDisplayName, ua.AttributeIDDescription, ua.AttributeIDRolePermissions,
 		ua.AttributeIDUserRolePermissions, ua.AttributeIDValue, ua.AttributeIDDataType,
 		ua.AttributeIDValueRank, ua.AttributeIDArrayDimensions, ua.AttributeIDAccessLevel,
-		ua.AttributeIDUserAccessLevel, ua.AttributeIDMinimumSamplingInterval, ua.AttributeIDHistorizing:
+		ua.AttributeIDUserAccessLevel, ua.AttributeIDMinimumSamplingInterval, ua.AttributeIDHistorizing,
+		ua.AttributeIDAccessLevelEx, ua.AttributeIDWriteMask, ua.AttributeIDUserWriteMask:
 		return true
 	default:
 		return false
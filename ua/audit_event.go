@@ -0,0 +1,304 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package ua
+
+import (
+	"time"
+)
+
+// AuditEvent structure.
+type AuditEvent struct {
+	EventID            ByteString
+	EventType          NodeID
+	SourceNode         NodeID
+	SourceName         string
+	Time               time.Time
+	ReceiveTime        time.Time
+	Message            LocalizedText
+	Severity           uint16
+	ActionTimeStamp    time.Time
+	Status             bool
+	ServerID           string
+	ClientAuditEntryID string
+	ClientUserID       string
+}
+
+// UnmarshalFields ...
+func (evt *AuditEvent) UnmarshalFields(eventFields []Variant) error {
+	if len(eventFields) != 13 {
+		return BadUnexpectedError
+	}
+	evt.EventID, _ = eventFields[0].(ByteString)
+	evt.EventType, _ = eventFields[1].(NodeID)
+	evt.SourceNode, _ = eventFields[2].(NodeID)
+	evt.SourceName, _ = eventFields[3].(string)
+	evt.Time, _ = eventFields[4].(time.Time)
+	evt.ReceiveTime, _ = eventFields[5].(time.Time)
+	evt.Message, _ = eventFields[6].(LocalizedText)
+	evt.Severity, _ = eventFields[7].(uint16)
+	evt.ActionTimeStamp, _ = eventFields[8].(time.Time)
+	evt.Status, _ = eventFields[9].(bool)
+	evt.ServerID, _ = eventFields[10].(string)
+	evt.ClientAuditEntryID, _ = eventFields[11].(string)
+	evt.ClientUserID, _ = eventFields[12].(string)
+	return nil
+}
+
+// GetAttribute ...
+func (e *AuditEvent) GetAttribute(clause SimpleAttributeOperand) Variant {
+	switch {
+	case EqualSimpleAttributeOperand(clause, AuditEventSelectClauses[0]):
+		return Variant(e.EventID)
+	case EqualSimpleAttributeOperand(clause, AuditEventSelectClauses[1]):
+		return Variant(e.EventType)
+	case EqualSimpleAttributeOperand(clause, AuditEventSelectClauses[2]):
+		return Variant(e.SourceNode)
+	case EqualSimpleAttributeOperand(clause, AuditEventSelectClauses[3]):
+		return Variant(e.SourceName)
+	case EqualSimpleAttributeOperand(clause, AuditEventSelectClauses[4]):
+		return Variant(e.Time)
+	case EqualSimpleAttributeOperand(clause, AuditEventSelectClauses[5]):
+		return Variant(e.ReceiveTime)
+	case EqualSimpleAttributeOperand(clause, AuditEventSelectClauses[6]):
+		return Variant(e.Message)
+	case EqualSimpleAttributeOperand(clause, AuditEventSelectClauses[7]):
+		return Variant(e.Severity)
+	case EqualSimpleAttributeOperand(clause, AuditEventSelectClauses[8]):
+		return Variant(e.ActionTimeStamp)
+	case EqualSimpleAttributeOperand(clause, AuditEventSelectClauses[9]):
+		return Variant(e.Status)
+	case EqualSimpleAttributeOperand(clause, AuditEventSelectClauses[10]):
+		return Variant(e.ServerID)
+	case EqualSimpleAttributeOperand(clause, AuditEventSelectClauses[11]):
+		return Variant(e.ClientAuditEntryID)
+	case EqualSimpleAttributeOperand(clause, AuditEventSelectClauses[12]):
+		return Variant(e.ClientUserID)
+	default:
+		return nil
+	}
+}
+
+// AuditEventSelectClauses ...
+var AuditEventSelectClauses []SimpleAttributeOperand = []SimpleAttributeOperand{
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("EventId"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("EventType"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("SourceNode"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("SourceName"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("Time"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("ReceiveTime"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("Message"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("Severity"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDAuditEventType, BrowsePath: ParseBrowsePath("ActionTimeStamp"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDAuditEventType, BrowsePath: ParseBrowsePath("Status"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDAuditEventType, BrowsePath: ParseBrowsePath("ServerId"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDAuditEventType, BrowsePath: ParseBrowsePath("ClientAuditEntryId"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDAuditEventType, BrowsePath: ParseBrowsePath("ClientUserId"), AttributeID: AttributeIDValue},
+}
+
+// AuditSessionEvent structure.
+type AuditSessionEvent struct {
+	EventID            ByteString
+	EventType          NodeID
+	SourceNode         NodeID
+	SourceName         string
+	Time               time.Time
+	ReceiveTime        time.Time
+	Message            LocalizedText
+	Severity           uint16
+	ActionTimeStamp    time.Time
+	Status             bool
+	ServerID           string
+	ClientAuditEntryID string
+	ClientUserID       string
+	SessionID          NodeID
+	StatusCodeID       StatusCode
+}
+
+// UnmarshalFields ...
+func (evt *AuditSessionEvent) UnmarshalFields(eventFields []Variant) error {
+	if len(eventFields) != 15 {
+		return BadUnexpectedError
+	}
+	evt.EventID, _ = eventFields[0].(ByteString)
+	evt.EventType, _ = eventFields[1].(NodeID)
+	evt.SourceNode, _ = eventFields[2].(NodeID)
+	evt.SourceName, _ = eventFields[3].(string)
+	evt.Time, _ = eventFields[4].(time.Time)
+	evt.ReceiveTime, _ = eventFields[5].(time.Time)
+	evt.Message, _ = eventFields[6].(LocalizedText)
+	evt.Severity, _ = eventFields[7].(uint16)
+	evt.ActionTimeStamp, _ = eventFields[8].(time.Time)
+	evt.Status, _ = eventFields[9].(bool)
+	evt.ServerID, _ = eventFields[10].(string)
+	evt.ClientAuditEntryID, _ = eventFields[11].(string)
+	evt.ClientUserID, _ = eventFields[12].(string)
+	evt.SessionID, _ = eventFields[13].(NodeID)
+	evt.StatusCodeID, _ = eventFields[14].(StatusCode)
+	return nil
+}
+
+// GetAttribute ...
+func (e *AuditSessionEvent) GetAttribute(clause SimpleAttributeOperand) Variant {
+	switch {
+	case EqualSimpleAttributeOperand(clause, AuditSessionEventSelectClauses[0]):
+		return Variant(e.EventID)
+	case EqualSimpleAttributeOperand(clause, AuditSessionEventSelectClauses[1]):
+		return Variant(e.EventType)
+	case EqualSimpleAttributeOperand(clause, AuditSessionEventSelectClauses[2]):
+		return Variant(e.SourceNode)
+	case EqualSimpleAttributeOperand(clause, AuditSessionEventSelectClauses[3]):
+		return Variant(e.SourceName)
+	case EqualSimpleAttributeOperand(clause, AuditSessionEventSelectClauses[4]):
+		return Variant(e.Time)
+	case EqualSimpleAttributeOperand(clause, AuditSessionEventSelectClauses[5]):
+		return Variant(e.ReceiveTime)
+	case EqualSimpleAttributeOperand(clause, AuditSessionEventSelectClauses[6]):
+		return Variant(e.Message)
+	case EqualSimpleAttributeOperand(clause, AuditSessionEventSelectClauses[7]):
+		return Variant(e.Severity)
+	case EqualSimpleAttributeOperand(clause, AuditSessionEventSelectClauses[8]):
+		return Variant(e.ActionTimeStamp)
+	case EqualSimpleAttributeOperand(clause, AuditSessionEventSelectClauses[9]):
+		return Variant(e.Status)
+	case EqualSimpleAttributeOperand(clause, AuditSessionEventSelectClauses[10]):
+		return Variant(e.ServerID)
+	case EqualSimpleAttributeOperand(clause, AuditSessionEventSelectClauses[11]):
+		return Variant(e.ClientAuditEntryID)
+	case EqualSimpleAttributeOperand(clause, AuditSessionEventSelectClauses[12]):
+		return Variant(e.ClientUserID)
+	case EqualSimpleAttributeOperand(clause, AuditSessionEventSelectClauses[13]):
+		return Variant(e.SessionID)
+	case EqualSimpleAttributeOperand(clause, AuditSessionEventSelectClauses[14]):
+		return Variant(e.StatusCodeID)
+	default:
+		return nil
+	}
+}
+
+// AuditSessionEventSelectClauses ...
+var AuditSessionEventSelectClauses []SimpleAttributeOperand = []SimpleAttributeOperand{
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("EventId"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("EventType"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("SourceNode"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("SourceName"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("Time"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("ReceiveTime"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("Message"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("Severity"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDAuditEventType, BrowsePath: ParseBrowsePath("ActionTimeStamp"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDAuditEventType, BrowsePath: ParseBrowsePath("Status"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDAuditEventType, BrowsePath: ParseBrowsePath("ServerId"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDAuditEventType, BrowsePath: ParseBrowsePath("ClientAuditEntryId"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDAuditEventType, BrowsePath: ParseBrowsePath("ClientUserId"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDAuditSessionEventType, BrowsePath: ParseBrowsePath("SessionId"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDAuditSecurityEventType, BrowsePath: ParseBrowsePath("StatusCodeId"), AttributeID: AttributeIDValue},
+}
+
+// AuditWriteUpdateEvent structure.
+type AuditWriteUpdateEvent struct {
+	EventID            ByteString
+	EventType          NodeID
+	SourceNode         NodeID
+	SourceName         string
+	Time               time.Time
+	ReceiveTime        time.Time
+	Message            LocalizedText
+	Severity           uint16
+	ActionTimeStamp    time.Time
+	Status             bool
+	ServerID           string
+	ClientAuditEntryID string
+	ClientUserID       string
+	AttributeID        uint32
+	IndexRange         string
+	OldValue           Variant
+	NewValue           Variant
+}
+
+// UnmarshalFields ...
+func (evt *AuditWriteUpdateEvent) UnmarshalFields(eventFields []Variant) error {
+	if len(eventFields) != 17 {
+		return BadUnexpectedError
+	}
+	evt.EventID, _ = eventFields[0].(ByteString)
+	evt.EventType, _ = eventFields[1].(NodeID)
+	evt.SourceNode, _ = eventFields[2].(NodeID)
+	evt.SourceName, _ = eventFields[3].(string)
+	evt.Time, _ = eventFields[4].(time.Time)
+	evt.ReceiveTime, _ = eventFields[5].(time.Time)
+	evt.Message, _ = eventFields[6].(LocalizedText)
+	evt.Severity, _ = eventFields[7].(uint16)
+	evt.ActionTimeStamp, _ = eventFields[8].(time.Time)
+	evt.Status, _ = eventFields[9].(bool)
+	evt.ServerID, _ = eventFields[10].(string)
+	evt.ClientAuditEntryID, _ = eventFields[11].(string)
+	evt.ClientUserID, _ = eventFields[12].(string)
+	evt.AttributeID, _ = eventFields[13].(uint32)
+	evt.IndexRange, _ = eventFields[14].(string)
+	evt.OldValue = eventFields[15]
+	evt.NewValue = eventFields[16]
+	return nil
+}
+
+// GetAttribute ...
+func (e *AuditWriteUpdateEvent) GetAttribute(clause SimpleAttributeOperand) Variant {
+	switch {
+	case EqualSimpleAttributeOperand(clause, AuditWriteUpdateEventSelectClauses[0]):
+		return Variant(e.EventID)
+	case EqualSimpleAttributeOperand(clause, AuditWriteUpdateEventSelectClauses[1]):
+		return Variant(e.EventType)
+	case EqualSimpleAttributeOperand(clause, AuditWriteUpdateEventSelectClauses[2]):
+		return Variant(e.SourceNode)
+	case EqualSimpleAttributeOperand(clause, AuditWriteUpdateEventSelectClauses[3]):
+		return Variant(e.SourceName)
+	case EqualSimpleAttributeOperand(clause, AuditWriteUpdateEventSelectClauses[4]):
+		return Variant(e.Time)
+	case EqualSimpleAttributeOperand(clause, AuditWriteUpdateEventSelectClauses[5]):
+		return Variant(e.ReceiveTime)
+	case EqualSimpleAttributeOperand(clause, AuditWriteUpdateEventSelectClauses[6]):
+		return Variant(e.Message)
+	case EqualSimpleAttributeOperand(clause, AuditWriteUpdateEventSelectClauses[7]):
+		return Variant(e.Severity)
+	case EqualSimpleAttributeOperand(clause, AuditWriteUpdateEventSelectClauses[8]):
+		return Variant(e.ActionTimeStamp)
+	case EqualSimpleAttributeOperand(clause, AuditWriteUpdateEventSelectClauses[9]):
+		return Variant(e.Status)
+	case EqualSimpleAttributeOperand(clause, AuditWriteUpdateEventSelectClauses[10]):
+		return Variant(e.ServerID)
+	case EqualSimpleAttributeOperand(clause, AuditWriteUpdateEventSelectClauses[11]):
+		return Variant(e.ClientAuditEntryID)
+	case EqualSimpleAttributeOperand(clause, AuditWriteUpdateEventSelectClauses[12]):
+		return Variant(e.ClientUserID)
+	case EqualSimpleAttributeOperand(clause, AuditWriteUpdateEventSelectClauses[13]):
+		return Variant(e.AttributeID)
+	case EqualSimpleAttributeOperand(clause, AuditWriteUpdateEventSelectClauses[14]):
+		return Variant(e.IndexRange)
+	case EqualSimpleAttributeOperand(clause, AuditWriteUpdateEventSelectClauses[15]):
+		return Variant(e.OldValue)
+	case EqualSimpleAttributeOperand(clause, AuditWriteUpdateEventSelectClauses[16]):
+		return Variant(e.NewValue)
+	default:
+		return nil
+	}
+}
+
+// AuditWriteUpdateEventSelectClauses ...
+var AuditWriteUpdateEventSelectClauses []SimpleAttributeOperand = []SimpleAttributeOperand{
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("EventId"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("EventType"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("SourceNode"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("SourceName"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("Time"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("ReceiveTime"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("Message"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDBaseEventType, BrowsePath: ParseBrowsePath("Severity"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDAuditEventType, BrowsePath: ParseBrowsePath("ActionTimeStamp"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDAuditEventType, BrowsePath: ParseBrowsePath("Status"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDAuditEventType, BrowsePath: ParseBrowsePath("ServerId"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDAuditEventType, BrowsePath: ParseBrowsePath("ClientAuditEntryId"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDAuditEventType, BrowsePath: ParseBrowsePath("ClientUserId"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDAuditWriteUpdateEventType, BrowsePath: ParseBrowsePath("AttributeId"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDAuditWriteUpdateEventType, BrowsePath: ParseBrowsePath("IndexRange"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDAuditWriteUpdateEventType, BrowsePath: ParseBrowsePath("OldValue"), AttributeID: AttributeIDValue},
+	{TypeDefinitionID: ObjectTypeIDAuditWriteUpdateEventType, BrowsePath: ParseBrowsePath("NewValue"), AttributeID: AttributeIDValue},
+}
@@ -0,0 +1,188 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package ua
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"reflect"
+	"unsafe"
+)
+
+// arrayChunkSize is the size of the buffer used to write or read the elements of numeric arrays
+// on big-endian platforms.
+const arrayChunkSize = 4096
+
+// nativeLittleEndian is true if the platform stores numbers in little-endian order, the same
+// order as the binary encoding.
+var nativeLittleEndian = func() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}()
+
+// elementBytes returns the memory of the elements of a numeric array.
+func elementBytes[T any](value []T, size int) []byte {
+	return unsafe.Slice((*byte)(unsafe.Pointer(&value[0])), len(value)*size)
+}
+
+// writeElements writes the elements of a numeric array in little-endian order. On little-endian
+// platforms, the memory of the array is written in one call. Otherwise, a buffer is filled
+// with many elements for each write, rather than writing one element at a time.
+func writeElements[T any](enc *BinaryEncoder, value []T, size int, put func([]byte, T)) error {
+	if len(value) == 0 {
+		return nil
+	}
+	if nativeLittleEndian {
+		if _, err := enc.w.Write(elementBytes(value, size)); err != nil {
+			return BadEncodingError
+		}
+		return nil
+	}
+	var buf [arrayChunkSize]byte
+	n := arrayChunkSize / size
+	for len(value) > 0 {
+		m := len(value)
+		if m > n {
+			m = n
+		}
+		b := buf[:m*size]
+		for i, v := range value[:m] {
+			put(b[i*size:], v)
+		}
+		if _, err := enc.w.Write(b); err != nil {
+			return BadEncodingError
+		}
+		value = value[m:]
+	}
+	return nil
+}
+
+// readElements reads the elements of a numeric array in little-endian order. On little-endian
+// platforms, the memory of the array is read in one call. Otherwise, a buffer is filled
+// with many elements for each read, rather than reading one element at a time.
+func readElements[T any](dec *BinaryDecoder, value []T, size int, get func([]byte) T) error {
+	if len(value) == 0 {
+		return nil
+	}
+	if nativeLittleEndian {
+		if _, err := io.ReadFull(dec.r, elementBytes(value, size)); err != nil {
+			return BadDecodingError
+		}
+		return nil
+	}
+	var buf [arrayChunkSize]byte
+	n := arrayChunkSize / size
+	for len(value) > 0 {
+		m := len(value)
+		if m > n {
+			m = n
+		}
+		b := buf[:m*size]
+		if _, err := io.ReadFull(dec.r, b); err != nil {
+			return BadDecodingError
+		}
+		for i := range value[:m] {
+			value[i] = get(b[i*size:])
+		}
+		value = value[m:]
+	}
+	return nil
+}
+
+func putInt16(b []byte, v int16)    { binary.LittleEndian.PutUint16(b, uint16(v)) }
+func putUInt16(b []byte, v uint16)  { binary.LittleEndian.PutUint16(b, v) }
+func putInt32(b []byte, v int32)    { binary.LittleEndian.PutUint32(b, uint32(v)) }
+func putUInt32(b []byte, v uint32)  { binary.LittleEndian.PutUint32(b, v) }
+func putInt64(b []byte, v int64)    { binary.LittleEndian.PutUint64(b, uint64(v)) }
+func putUInt64(b []byte, v uint64)  { binary.LittleEndian.PutUint64(b, v) }
+func putFloat(b []byte, v float32)  { binary.LittleEndian.PutUint32(b, math.Float32bits(v)) }
+func putDouble(b []byte, v float64) { binary.LittleEndian.PutUint64(b, math.Float64bits(v)) }
+func getInt16(b []byte) int16       { return int16(binary.LittleEndian.Uint16(b)) }
+func getUInt16(b []byte) uint16     { return binary.LittleEndian.Uint16(b) }
+func getInt32(b []byte) int32       { return int32(binary.LittleEndian.Uint32(b)) }
+func getUInt32(b []byte) uint32     { return binary.LittleEndian.Uint32(b) }
+func getInt64(b []byte) int64       { return int64(binary.LittleEndian.Uint64(b)) }
+func getUInt64(b []byte) uint64     { return binary.LittleEndian.Uint64(b) }
+func getFloat(b []byte) float32     { return math.Float32frombits(binary.LittleEndian.Uint32(b)) }
+func getDouble(b []byte) float64    { return math.Float64frombits(binary.LittleEndian.Uint64(b)) }
+
+// getElementsEncoder returns an encoder of the elements of a slice of a numeric type, or nil if
+// the elements have another type.
+func getElementsEncoder(elem reflect.Type) func(*BinaryEncoder, unsafe.Pointer, int) error {
+	switch elem {
+	case reflect.TypeOf(int16(0)):
+		return func(enc *BinaryEncoder, p unsafe.Pointer, n int) error {
+			return writeElements(enc, unsafe.Slice((*int16)(p), n), 2, putInt16)
+		}
+	case reflect.TypeOf(uint16(0)):
+		return func(enc *BinaryEncoder, p unsafe.Pointer, n int) error {
+			return writeElements(enc, unsafe.Slice((*uint16)(p), n), 2, putUInt16)
+		}
+	case reflect.TypeOf(int32(0)):
+		return func(enc *BinaryEncoder, p unsafe.Pointer, n int) error {
+			return writeElements(enc, unsafe.Slice((*int32)(p), n), 4, putInt32)
+		}
+	case reflect.TypeOf(uint32(0)):
+		return func(enc *BinaryEncoder, p unsafe.Pointer, n int) error {
+			return writeElements(enc, unsafe.Slice((*uint32)(p), n), 4, putUInt32)
+		}
+	case reflect.TypeOf(int64(0)):
+		return func(enc *BinaryEncoder, p unsafe.Pointer, n int) error {
+			return writeElements(enc, unsafe.Slice((*int64)(p), n), 8, putInt64)
+		}
+	case reflect.TypeOf(uint64(0)):
+		return func(enc *BinaryEncoder, p unsafe.Pointer, n int) error {
+			return writeElements(enc, unsafe.Slice((*uint64)(p), n), 8, putUInt64)
+		}
+	case reflect.TypeOf(float32(0)):
+		return func(enc *BinaryEncoder, p unsafe.Pointer, n int) error {
+			return writeElements(enc, unsafe.Slice((*float32)(p), n), 4, putFloat)
+		}
+	case reflect.TypeOf(float64(0)):
+		return func(enc *BinaryEncoder, p unsafe.Pointer, n int) error {
+			return writeElements(enc, unsafe.Slice((*float64)(p), n), 8, putDouble)
+		}
+	}
+	return nil
+}
+
+// getElementsDecoder returns a decoder of the elements of a slice of a numeric type, or nil if
+// the elements have another type.
+func getElementsDecoder(elem reflect.Type) func(*BinaryDecoder, unsafe.Pointer, int) error {
+	switch elem {
+	case reflect.TypeOf(int16(0)):
+		return func(dec *BinaryDecoder, p unsafe.Pointer, n int) error {
+			return readElements(dec, unsafe.Slice((*int16)(p), n), 2, getInt16)
+		}
+	case reflect.TypeOf(uint16(0)):
+		return func(dec *BinaryDecoder, p unsafe.Pointer, n int) error {
+			return readElements(dec, unsafe.Slice((*uint16)(p), n), 2, getUInt16)
+		}
+	case reflect.TypeOf(int32(0)):
+		return func(dec *BinaryDecoder, p unsafe.Pointer, n int) error {
+			return readElements(dec, unsafe.Slice((*int32)(p), n), 4, getInt32)
+		}
+	case reflect.TypeOf(uint32(0)):
+		return func(dec *BinaryDecoder, p unsafe.Pointer, n int) error {
+			return readElements(dec, unsafe.Slice((*uint32)(p), n), 4, getUInt32)
+		}
+	case reflect.TypeOf(int64(0)):
+		return func(dec *BinaryDecoder, p unsafe.Pointer, n int) error {
+			return readElements(dec, unsafe.Slice((*int64)(p), n), 8, getInt64)
+		}
+	case reflect.TypeOf(uint64(0)):
+		return func(dec *BinaryDecoder, p unsafe.Pointer, n int) error {
+			return readElements(dec, unsafe.Slice((*uint64)(p), n), 8, getUInt64)
+		}
+	case reflect.TypeOf(float32(0)):
+		return func(dec *BinaryDecoder, p unsafe.Pointer, n int) error {
+			return readElements(dec, unsafe.Slice((*float32)(p), n), 4, getFloat)
+		}
+	case reflect.TypeOf(float64(0)):
+		return func(dec *BinaryDecoder, p unsafe.Pointer, n int) error {
+			return readElements(dec, unsafe.Slice((*float64)(p), n), 8, getDouble)
+		}
+	}
+	return nil
+}
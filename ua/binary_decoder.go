@@ -21,14 +21,43 @@ var (
 
 // BinaryDecoder decodes the UA binary protocol.
 type BinaryDecoder struct {
-	r  io.Reader
-	ec EncodingContext
-	bs [8]byte
+	r              io.Reader
+	ec             EncodingContext
+	bs             [8]byte
+	limits         EncodingLimits
+	limitsExceeded bool
 }
 
 // NewBinaryDecoder returns a new decoder that reads from an io.Reader.
 func NewBinaryDecoder(r io.Reader, ec EncodingContext) *BinaryDecoder {
-	return &BinaryDecoder{r, ec, [8]byte{}}
+	return &BinaryDecoder{r: r, ec: ec}
+}
+
+// EncodingLimits limits the length of the strings, byte strings and arrays that are decoded, so a
+// message that claims a huge length is rejected before memory is allocated. A limit of 0 means no limit.
+type EncodingLimits struct {
+	MaxStringLength     uint32
+	MaxByteStringLength uint32
+	MaxArrayLength      uint32
+}
+
+// SetLimits sets the limits of the lengths of decoded strings, byte strings and arrays. Decode
+// returns BadEncodingLimitsExceeded if a length exceeds a limit. (default: no limit)
+func (dec *BinaryDecoder) SetLimits(limits EncodingLimits) {
+	dec.limits = limits
+}
+
+// checkLength returns BadEncodingLimitsExceeded if the length of a string, byte string or array
+// exceeds the limit. Returns BadDecodingError if the length exceeds the bytes remaining in the reader.
+func (dec *BinaryDecoder) checkLength(n int32, limit uint32) error {
+	if limit > 0 && uint32(n) > limit {
+		dec.limitsExceeded = true
+		return BadEncodingLimitsExceeded
+	}
+	if r, ok := dec.r.(interface{ Len() int }); ok && int(n) > r.Len() {
+		return BadDecodingError
+	}
+	return nil
 }
 
 type decoderFunc func(*BinaryDecoder, unsafe.Pointer) error
@@ -46,7 +75,7 @@ func (dec *BinaryDecoder) Decode(v interface{}) error {
 
 		// if found, call it.
 		if err := f.(decoderFunc)(dec, ptr); err != nil {
-			return err
+			return dec.decodeError(err)
 		}
 		return nil
 	}
@@ -59,11 +88,20 @@ func (dec *BinaryDecoder) Decode(v interface{}) error {
 
 	// call the decoder
 	if err := f(dec, ptr); err != nil {
-		return err
+		return dec.decodeError(err)
 	}
 	return nil
 }
 
+// decodeError returns BadEncodingLimitsExceeded if a limit was exceeded, even if the error was
+// replaced by the reader of an enclosing type.
+func (dec *BinaryDecoder) decodeError(err error) error {
+	if dec.limitsExceeded {
+		return BadEncodingLimitsExceeded
+	}
+	return err
+}
+
 func getDecoder(typ reflect.Type) (decoderFunc, error) {
 	switch typ.Kind() {
 	case reflect.Struct:
@@ -191,6 +229,7 @@ func getSliceDecoder(typ reflect.Type) (decoderFunc, error) {
 	if err != nil {
 		return nil, err
 	}
+	elementsDecoder := getElementsDecoder(elem)
 	return func(buf *BinaryDecoder, p unsafe.Pointer) error {
 		hdr := (*sliceHeader)(p)
 		var l int32
@@ -204,11 +243,17 @@ func getSliceDecoder(typ reflect.Type) (decoderFunc, error) {
 			hdr.cap = 0
 			return nil
 		}
+		if err := buf.checkLength(l, buf.limits.MaxArrayLength); err != nil {
+			return err
+		}
 		val := reflect.MakeSlice(typ, len, len)
 		p2 := unsafe.Pointer(val.Pointer())
 		hdr.data = p2
 		hdr.len = len
 		hdr.cap = len
+		if elementsDecoder != nil {
+			return elementsDecoder(buf, p2, len)
+		}
 		for i := 0; i < len; i++ {
 			if err := elemDecoder(buf, p2); err != nil {
 				return err
@@ -443,6 +488,9 @@ func (dec *BinaryDecoder) ReadString(value *string) error {
 		*value = ""
 		return nil
 	}
+	if err := dec.checkLength(n, dec.limits.MaxStringLength); err != nil {
+		return err
+	}
 	bs := make([]byte, n)
 	if _, err := io.ReadFull(dec.r, bs); err != nil {
 		return BadDecodingError
@@ -459,13 +507,7 @@ func (dec *BinaryDecoder) ReadDateTime(value *time.Time) error {
 	if err := dec.ReadInt64(&ticks); err != nil {
 		return BadDecodingError
 	}
-	if ticks < 0 {
-		ticks = 0
-	}
-	if ticks == 0x7FFFFFFFFFFFFFFF {
-		ticks = 2650467743990000000
-	}
-	*value = time.Unix(ticks/10000000-11644473600, (ticks%10000000)*100).UTC()
+	*value = TicksToTime(ticks)
 	return nil
 }
 
@@ -500,6 +542,9 @@ func (dec *BinaryDecoder) ReadByteString(value *ByteString) error {
 		*value = ""
 		return nil
 	}
+	if err := dec.checkLength(n, dec.limits.MaxByteStringLength); err != nil {
+		return err
+	}
 	bs := make([]byte, n)
 	if _, err := io.ReadFull(dec.r, bs); err != nil {
 		return BadDecodingError
@@ -776,8 +821,12 @@ func (dec *BinaryDecoder) ReadExtensionObject(value *ExtensionObject) error {
 			*value = obj
 			return nil
 		}
+		if st, ok := findStructureTypeForBinaryEncodingID(id); ok {
+			return dec.readStructureBody(st, value)
+		}
+		// the body is a ByteString.
 		var body []byte
-		err := dec.ReadByteArray(&body)
+		err := dec.readBytes(&body, dec.limits.MaxByteStringLength)
 		if err != nil {
 			return BadDecodingError
 		}
@@ -1062,219 +1111,237 @@ func (dec *BinaryDecoder) ReadVariant(value *Variant) error {
 		}
 	}
 
+	if err := dec.readVariantArray(b&0x3F, value); err != nil {
+		return err
+	}
 	if (b & 0x40) == 0 {
-		switch b & 0x3F {
-		case VariantTypeNull:
-			*value = nil
-			return nil
+		return nil
+	}
+	// multi-dimensional array
+	var dims []int32
+	if err := dec.ReadInt32Array(&dims); err != nil {
+		return BadDecodingError
+	}
+	m := Matrix{Elements: *value, Dimensions: dims}
+	if err := m.Validate(); err != nil {
+		return BadDecodingError
+	}
+	if len(dims) > 1 {
+		*value = m
+	}
+	return nil
+}
 
-		case VariantTypeBoolean:
-			var v []bool
-			if err := dec.ReadBooleanArray(&v); err != nil {
-				return BadDecodingError
-			}
-			*value = v
-			return nil
+// readVariantArray reads the elements of an array of the VariantType.
+func (dec *BinaryDecoder) readVariantArray(variantType byte, value *Variant) error {
+	switch variantType {
+	case VariantTypeNull:
+		*value = nil
+		return nil
 
-		case VariantTypeSByte:
-			var v []int8
-			if err := dec.ReadSByteArray(&v); err != nil {
-				return BadDecodingError
-			}
-			*value = v
-			return nil
+	case VariantTypeBoolean:
+		var v []bool
+		if err := dec.ReadBooleanArray(&v); err != nil {
+			return BadDecodingError
+		}
+		*value = v
+		return nil
 
-		case VariantTypeByte:
-			var v []byte
-			if err := dec.ReadByteArray(&v); err != nil {
-				return BadDecodingError
-			}
-			*value = v
-			return nil
+	case VariantTypeSByte:
+		var v []int8
+		if err := dec.ReadSByteArray(&v); err != nil {
+			return BadDecodingError
+		}
+		*value = v
+		return nil
 
-		case VariantTypeInt16:
-			var v []int16
-			if err := dec.ReadInt16Array(&v); err != nil {
-				return BadDecodingError
-			}
-			*value = v
-			return nil
+	case VariantTypeByte:
+		var v []byte
+		if err := dec.ReadByteArray(&v); err != nil {
+			return BadDecodingError
+		}
+		*value = v
+		return nil
 
-		case VariantTypeUInt16:
-			var v []uint16
-			if err := dec.ReadUInt16Array(&v); err != nil {
-				return BadDecodingError
-			}
-			*value = v
-			return nil
+	case VariantTypeInt16:
+		var v []int16
+		if err := dec.ReadInt16Array(&v); err != nil {
+			return BadDecodingError
+		}
+		*value = v
+		return nil
 
-		case VariantTypeInt32:
-			var v []int32
-			if err := dec.ReadInt32Array(&v); err != nil {
-				return BadDecodingError
-			}
-			*value = v
-			return nil
+	case VariantTypeUInt16:
+		var v []uint16
+		if err := dec.ReadUInt16Array(&v); err != nil {
+			return BadDecodingError
+		}
+		*value = v
+		return nil
 
-		case VariantTypeUInt32:
-			var v []uint32
-			if err := dec.ReadUInt32Array(&v); err != nil {
-				return BadDecodingError
-			}
-			*value = v
-			return nil
+	case VariantTypeInt32:
+		var v []int32
+		if err := dec.ReadInt32Array(&v); err != nil {
+			return BadDecodingError
+		}
+		*value = v
+		return nil
 
-		case VariantTypeInt64:
-			var v []int64
-			if err := dec.ReadInt64Array(&v); err != nil {
-				return BadDecodingError
-			}
-			*value = v
-			return nil
+	case VariantTypeUInt32:
+		var v []uint32
+		if err := dec.ReadUInt32Array(&v); err != nil {
+			return BadDecodingError
+		}
+		*value = v
+		return nil
 
-		case VariantTypeUInt64:
-			var v []uint64
-			if err := dec.ReadUInt64Array(&v); err != nil {
-				return BadDecodingError
-			}
-			*value = v
-			return nil
+	case VariantTypeInt64:
+		var v []int64
+		if err := dec.ReadInt64Array(&v); err != nil {
+			return BadDecodingError
+		}
+		*value = v
+		return nil
 
-		case VariantTypeFloat:
-			var v []float32
-			if err := dec.ReadFloatArray(&v); err != nil {
-				return BadDecodingError
-			}
-			*value = v
-			return nil
+	case VariantTypeUInt64:
+		var v []uint64
+		if err := dec.ReadUInt64Array(&v); err != nil {
+			return BadDecodingError
+		}
+		*value = v
+		return nil
 
-		case VariantTypeDouble:
-			var v []float64
-			if err := dec.ReadDoubleArray(&v); err != nil {
-				return BadDecodingError
-			}
-			*value = v
-			return nil
+	case VariantTypeFloat:
+		var v []float32
+		if err := dec.ReadFloatArray(&v); err != nil {
+			return BadDecodingError
+		}
+		*value = v
+		return nil
 
-		case VariantTypeString:
-			var v []string
-			if err := dec.ReadStringArray(&v); err != nil {
-				return BadDecodingError
-			}
-			*value = v
-			return nil
+	case VariantTypeDouble:
+		var v []float64
+		if err := dec.ReadDoubleArray(&v); err != nil {
+			return BadDecodingError
+		}
+		*value = v
+		return nil
 
-		case VariantTypeDateTime:
-			var v []time.Time
-			if err := dec.ReadDateTimeArray(&v); err != nil {
-				return BadDecodingError
-			}
-			*value = v
-			return nil
+	case VariantTypeString:
+		var v []string
+		if err := dec.ReadStringArray(&v); err != nil {
+			return BadDecodingError
+		}
+		*value = v
+		return nil
 
-		case VariantTypeGUID:
-			var v []uuid.UUID
-			if err := dec.ReadGUIDArray(&v); err != nil {
-				return BadDecodingError
-			}
-			*value = v
-			return nil
+	case VariantTypeDateTime:
+		var v []time.Time
+		if err := dec.ReadDateTimeArray(&v); err != nil {
+			return BadDecodingError
+		}
+		*value = v
+		return nil
 
-		case VariantTypeByteString:
-			var v []ByteString
-			if err := dec.ReadByteStringArray(&v); err != nil {
-				return BadDecodingError
-			}
-			*value = v
-			return nil
+	case VariantTypeGUID:
+		var v []uuid.UUID
+		if err := dec.ReadGUIDArray(&v); err != nil {
+			return BadDecodingError
+		}
+		*value = v
+		return nil
 
-		case VariantTypeXMLElement:
-			var v []XMLElement
-			if err := dec.ReadXMLElementArray(&v); err != nil {
-				return BadDecodingError
-			}
-			*value = v
-			return nil
+	case VariantTypeByteString:
+		var v []ByteString
+		if err := dec.ReadByteStringArray(&v); err != nil {
+			return BadDecodingError
+		}
+		*value = v
+		return nil
 
-		case VariantTypeNodeID:
-			var v []NodeID
-			if err := dec.ReadNodeIDArray(&v); err != nil {
-				return BadDecodingError
-			}
-			*value = v
-			return nil
+	case VariantTypeXMLElement:
+		var v []XMLElement
+		if err := dec.ReadXMLElementArray(&v); err != nil {
+			return BadDecodingError
+		}
+		*value = v
+		return nil
 
-		case VariantTypeExpandedNodeID:
-			var v []ExpandedNodeID
-			if err := dec.ReadExpandedNodeIDArray(&v); err != nil {
-				return BadDecodingError
-			}
-			*value = v
-			return nil
+	case VariantTypeNodeID:
+		var v []NodeID
+		if err := dec.ReadNodeIDArray(&v); err != nil {
+			return BadDecodingError
+		}
+		*value = v
+		return nil
 
-		case VariantTypeStatusCode:
-			var v []StatusCode
-			if err := dec.ReadStatusCodeArray(&v); err != nil {
-				return BadDecodingError
-			}
-			*value = v
-			return nil
+	case VariantTypeExpandedNodeID:
+		var v []ExpandedNodeID
+		if err := dec.ReadExpandedNodeIDArray(&v); err != nil {
+			return BadDecodingError
+		}
+		*value = v
+		return nil
 
-		case VariantTypeQualifiedName:
-			var v []QualifiedName
-			if err := dec.ReadQualifiedNameArray(&v); err != nil {
-				return BadDecodingError
-			}
-			*value = v
-			return nil
+	case VariantTypeStatusCode:
+		var v []StatusCode
+		if err := dec.ReadStatusCodeArray(&v); err != nil {
+			return BadDecodingError
+		}
+		*value = v
+		return nil
 
-		case VariantTypeLocalizedText:
-			var v []LocalizedText
-			if err := dec.ReadLocalizedTextArray(&v); err != nil {
-				return BadDecodingError
-			}
-			*value = v
-			return nil
+	case VariantTypeQualifiedName:
+		var v []QualifiedName
+		if err := dec.ReadQualifiedNameArray(&v); err != nil {
+			return BadDecodingError
+		}
+		*value = v
+		return nil
 
-		case VariantTypeExtensionObject:
-			var v []ExtensionObject
-			if err := dec.ReadExtensionObjectArray(&v); err != nil {
-				return BadDecodingError
-			}
-			*value = v
-			return nil
+	case VariantTypeLocalizedText:
+		var v []LocalizedText
+		if err := dec.ReadLocalizedTextArray(&v); err != nil {
+			return BadDecodingError
+		}
+		*value = v
+		return nil
 
-		case VariantTypeDataValue:
-			var v []DataValue
-			if err := dec.ReadDataValueArray(&v); err != nil {
-				return BadDecodingError
-			}
-			*value = v
-			return nil
+	case VariantTypeExtensionObject:
+		var v []ExtensionObject
+		if err := dec.ReadExtensionObjectArray(&v); err != nil {
+			return BadDecodingError
+		}
+		*value = v
+		return nil
 
-		case VariantTypeVariant:
-			var v []Variant
-			if err := dec.ReadVariantArray(&v); err != nil {
-				return BadDecodingError
-			}
-			*value = v
-			return nil
+	case VariantTypeDataValue:
+		var v []DataValue
+		if err := dec.ReadDataValueArray(&v); err != nil {
+			return BadDecodingError
+		}
+		*value = v
+		return nil
 
-		case VariantTypeDiagnosticInfo:
-			var v []DiagnosticInfo
-			if err := dec.ReadDiagnosticInfoArray(&v); err != nil {
-				return BadDecodingError
-			}
-			*value = v
-			return nil
+	case VariantTypeVariant:
+		var v []Variant
+		if err := dec.ReadVariantArray(&v); err != nil {
+			return BadDecodingError
+		}
+		*value = v
+		return nil
 
-		default:
+	case VariantTypeDiagnosticInfo:
+		var v []DiagnosticInfo
+		if err := dec.ReadDiagnosticInfoArray(&v); err != nil {
 			return BadDecodingError
 		}
-	}
+		*value = v
+		return nil
 
-	// TODO: Multidimensional array
-	return BadDecodingError
+	default:
+		return BadDecodingError
+	}
 }
 
 // ReadDiagnosticInfo reads a DiagnosticInfo.
@@ -1285,36 +1352,43 @@ func (dec *BinaryDecoder) ReadDiagnosticInfo(value *DiagnosticInfo) error {
 		return BadDecodingError
 	}
 	if (b & 1) != 0 {
+		result.SymbolicID = new(int32)
 		if err := dec.ReadInt32(result.SymbolicID); err != nil {
 			return BadDecodingError
 		}
 	}
 	if (b & 2) != 0 {
+		result.NamespaceURI = new(int32)
 		if err := dec.ReadInt32(result.NamespaceURI); err != nil {
 			return BadDecodingError
 		}
 	}
 	if (b & 8) != 0 {
+		result.Locale = new(int32)
 		if err := dec.ReadInt32(result.Locale); err != nil {
 			return BadDecodingError
 		}
 	}
 	if (b & 4) != 0 {
+		result.LocalizedText = new(int32)
 		if err := dec.ReadInt32(result.LocalizedText); err != nil {
 			return BadDecodingError
 		}
 	}
 	if (b & 16) != 0 {
+		result.AdditionalInfo = new(string)
 		if err := dec.ReadString(result.AdditionalInfo); err != nil {
 			return BadDecodingError
 		}
 	}
 	if (b & 32) != 0 {
+		result.InnerStatusCode = new(StatusCode)
 		if err := dec.ReadStatusCode(result.InnerStatusCode); err != nil {
 			return BadDecodingError
 		}
 	}
 	if (b & 64) != 0 {
+		result.InnerDiagnosticInfo = new(DiagnosticInfo)
 		if err := dec.ReadDiagnosticInfo(result.InnerDiagnosticInfo); err != nil {
 			return BadDecodingError
 		}
@@ -1333,6 +1407,9 @@ func (dec *BinaryDecoder) ReadBooleanArray(value *[]bool) error {
 		*value = nil
 		return nil
 	}
+	if err := dec.checkLength(n, dec.limits.MaxArrayLength); err != nil {
+		return err
+	}
 	temp := make([]bool, n)
 	for i := range temp {
 		if err := dec.ReadBoolean(&temp[i]); err != nil {
@@ -1353,6 +1430,9 @@ func (dec *BinaryDecoder) ReadSByteArray(value *[]int8) error {
 		*value = nil
 		return nil
 	}
+	if err := dec.checkLength(n, dec.limits.MaxArrayLength); err != nil {
+		return err
+	}
 	temp := make([]int8, n)
 	for i := range temp {
 		if err := dec.ReadSByte(&temp[i]); err != nil {
@@ -1365,6 +1445,11 @@ func (dec *BinaryDecoder) ReadSByteArray(value *[]int8) error {
 
 // ReadByteArray reads a byte array.
 func (dec *BinaryDecoder) ReadByteArray(value *[]byte) error {
+	return dec.readBytes(value, dec.limits.MaxArrayLength)
+}
+
+// readBytes reads a length-prefixed sequence of bytes, which may not be longer than max.
+func (dec *BinaryDecoder) readBytes(value *[]byte, max uint32) error {
 	var n int32
 	if err := dec.ReadInt32(&n); err != nil {
 		return BadDecodingError
@@ -1373,6 +1458,9 @@ func (dec *BinaryDecoder) ReadByteArray(value *[]byte) error {
 		*value = nil
 		return nil
 	}
+	if err := dec.checkLength(n, max); err != nil {
+		return err
+	}
 	temp := make([]byte, n)
 	if _, err := io.ReadFull(dec.r, temp); err != nil {
 		return err
@@ -1391,11 +1479,12 @@ func (dec *BinaryDecoder) ReadInt16Array(value *[]int16) error {
 		*value = nil
 		return nil
 	}
+	if err := dec.checkLength(n, dec.limits.MaxArrayLength); err != nil {
+		return err
+	}
 	temp := make([]int16, n)
-	for i := range temp {
-		if err := dec.ReadInt16(&temp[i]); err != nil {
-			return err
-		}
+	if err := readElements(dec, temp, 2, getInt16); err != nil {
+		return err
 	}
 	*value = temp
 	return nil
@@ -1411,11 +1500,12 @@ func (dec *BinaryDecoder) ReadUInt16Array(value *[]uint16) error {
 		*value = nil
 		return nil
 	}
+	if err := dec.checkLength(n, dec.limits.MaxArrayLength); err != nil {
+		return err
+	}
 	temp := make([]uint16, n)
-	for i := range temp {
-		if err := dec.ReadUInt16(&temp[i]); err != nil {
-			return err
-		}
+	if err := readElements(dec, temp, 2, getUInt16); err != nil {
+		return err
 	}
 	*value = temp
 	return nil
@@ -1431,11 +1521,12 @@ func (dec *BinaryDecoder) ReadInt32Array(value *[]int32) error {
 		*value = nil
 		return nil
 	}
+	if err := dec.checkLength(n, dec.limits.MaxArrayLength); err != nil {
+		return err
+	}
 	temp := make([]int32, n)
-	for i := range temp {
-		if err := dec.ReadInt32(&temp[i]); err != nil {
-			return err
-		}
+	if err := readElements(dec, temp, 4, getInt32); err != nil {
+		return err
 	}
 	*value = temp
 	return nil
@@ -1451,11 +1542,12 @@ func (dec *BinaryDecoder) ReadUInt32Array(value *[]uint32) error {
 		*value = nil
 		return nil
 	}
+	if err := dec.checkLength(n, dec.limits.MaxArrayLength); err != nil {
+		return err
+	}
 	temp := make([]uint32, n)
-	for i := range temp {
-		if err := dec.ReadUInt32(&temp[i]); err != nil {
-			return err
-		}
+	if err := readElements(dec, temp, 4, getUInt32); err != nil {
+		return err
 	}
 	*value = temp
 	return nil
@@ -1471,11 +1563,12 @@ func (dec *BinaryDecoder) ReadInt64Array(value *[]int64) error {
 		*value = nil
 		return nil
 	}
+	if err := dec.checkLength(n, dec.limits.MaxArrayLength); err != nil {
+		return err
+	}
 	temp := make([]int64, n)
-	for i := range temp {
-		if err := dec.ReadInt64(&temp[i]); err != nil {
-			return err
-		}
+	if err := readElements(dec, temp, 8, getInt64); err != nil {
+		return err
 	}
 	*value = temp
 	return nil
@@ -1491,11 +1584,12 @@ func (dec *BinaryDecoder) ReadUInt64Array(value *[]uint64) error {
 		*value = nil
 		return nil
 	}
+	if err := dec.checkLength(n, dec.limits.MaxArrayLength); err != nil {
+		return err
+	}
 	temp := make([]uint64, n)
-	for i := range temp {
-		if err := dec.ReadUInt64(&temp[i]); err != nil {
-			return err
-		}
+	if err := readElements(dec, temp, 8, getUInt64); err != nil {
+		return err
 	}
 	*value = temp
 	return nil
@@ -1511,11 +1605,12 @@ func (dec *BinaryDecoder) ReadFloatArray(value *[]float32) error {
 		*value = nil
 		return nil
 	}
+	if err := dec.checkLength(n, dec.limits.MaxArrayLength); err != nil {
+		return err
+	}
 	temp := make([]float32, n)
-	for i := range temp {
-		if err := dec.ReadFloat(&temp[i]); err != nil {
-			return err
-		}
+	if err := readElements(dec, temp, 4, getFloat); err != nil {
+		return err
 	}
 	*value = temp
 	return nil
@@ -1531,11 +1626,12 @@ func (dec *BinaryDecoder) ReadDoubleArray(value *[]float64) error {
 		*value = nil
 		return nil
 	}
+	if err := dec.checkLength(n, dec.limits.MaxArrayLength); err != nil {
+		return err
+	}
 	temp := make([]float64, n)
-	for i := range temp {
-		if err := dec.ReadDouble(&temp[i]); err != nil {
-			return err
-		}
+	if err := readElements(dec, temp, 8, getDouble); err != nil {
+		return err
 	}
 	*value = temp
 	return nil
@@ -1551,6 +1647,9 @@ func (dec *BinaryDecoder) ReadStringArray(value *[]string) error {
 		*value = nil
 		return nil
 	}
+	if err := dec.checkLength(n, dec.limits.MaxArrayLength); err != nil {
+		return err
+	}
 	temp := make([]string, n)
 	for i := range temp {
 		if err := dec.ReadString(&temp[i]); err != nil {
@@ -1571,6 +1670,9 @@ func (dec *BinaryDecoder) ReadDateTimeArray(value *[]time.Time) error {
 		*value = nil
 		return nil
 	}
+	if err := dec.checkLength(n, dec.limits.MaxArrayLength); err != nil {
+		return err
+	}
 	temp := make([]time.Time, n)
 	for i := range temp {
 		if err := dec.ReadDateTime(&temp[i]); err != nil {
@@ -1591,6 +1693,9 @@ func (dec *BinaryDecoder) ReadGUIDArray(value *[]uuid.UUID) error {
 		*value = nil
 		return nil
 	}
+	if err := dec.checkLength(n, dec.limits.MaxArrayLength); err != nil {
+		return err
+	}
 	temp := make([]uuid.UUID, n)
 	for i := range temp {
 		if err := dec.ReadGUID(&temp[i]); err != nil {
@@ -1611,6 +1716,9 @@ func (dec *BinaryDecoder) ReadByteStringArray(value *[]ByteString) error {
 		*value = nil
 		return nil
 	}
+	if err := dec.checkLength(n, dec.limits.MaxArrayLength); err != nil {
+		return err
+	}
 	temp := make([]ByteString, n)
 	for i := 0; i < len(temp); i++ {
 		if err := dec.ReadByteString(&temp[i]); err != nil {
@@ -1631,6 +1739,9 @@ func (dec *BinaryDecoder) ReadXMLElementArray(value *[]XMLElement) error {
 		*value = nil
 		return nil
 	}
+	if err := dec.checkLength(n, dec.limits.MaxArrayLength); err != nil {
+		return err
+	}
 	temp := make([]XMLElement, n)
 	for i := 0; i < len(temp); i++ {
 		if err := dec.ReadXMLElement(&temp[i]); err != nil {
@@ -1651,6 +1762,9 @@ func (dec *BinaryDecoder) ReadNodeIDArray(value *[]NodeID) error {
 		*value = nil
 		return nil
 	}
+	if err := dec.checkLength(n, dec.limits.MaxArrayLength); err != nil {
+		return err
+	}
 	temp := make([]NodeID, n)
 	for i := range temp {
 		if err := dec.ReadNodeID(&temp[i]); err != nil {
@@ -1671,6 +1785,9 @@ func (dec *BinaryDecoder) ReadExpandedNodeIDArray(value *[]ExpandedNodeID) error
 		*value = nil
 		return nil
 	}
+	if err := dec.checkLength(n, dec.limits.MaxArrayLength); err != nil {
+		return err
+	}
 	temp := make([]ExpandedNodeID, n)
 	for i := range temp {
 		if err := dec.ReadExpandedNodeID(&temp[i]); err != nil {
@@ -1691,6 +1808,9 @@ func (dec *BinaryDecoder) ReadStatusCodeArray(value *[]StatusCode) error {
 		*value = nil
 		return nil
 	}
+	if err := dec.checkLength(n, dec.limits.MaxArrayLength); err != nil {
+		return err
+	}
 	temp := make([]StatusCode, n)
 	for i := range temp {
 		if err := dec.ReadStatusCode(&temp[i]); err != nil {
@@ -1711,6 +1831,9 @@ func (dec *BinaryDecoder) ReadQualifiedNameArray(value *[]QualifiedName) error {
 		*value = nil
 		return nil
 	}
+	if err := dec.checkLength(n, dec.limits.MaxArrayLength); err != nil {
+		return err
+	}
 	temp := make([]QualifiedName, n)
 	for i := range temp {
 		if err := dec.ReadQualifiedName(&temp[i]); err != nil {
@@ -1731,6 +1854,9 @@ func (dec *BinaryDecoder) ReadLocalizedTextArray(value *[]LocalizedText) error {
 		*value = nil
 		return nil
 	}
+	if err := dec.checkLength(n, dec.limits.MaxArrayLength); err != nil {
+		return err
+	}
 	temp := make([]LocalizedText, n)
 	for i := range temp {
 		if err := dec.ReadLocalizedText(&temp[i]); err != nil {
@@ -1751,6 +1877,9 @@ func (dec *BinaryDecoder) ReadExtensionObjectArray(value *[]ExtensionObject) err
 		*value = nil
 		return nil
 	}
+	if err := dec.checkLength(n, dec.limits.MaxArrayLength); err != nil {
+		return err
+	}
 	temp := make([]ExtensionObject, n)
 	for i := range temp {
 		if err := dec.ReadExtensionObject(&temp[i]); err != nil {
@@ -1771,6 +1900,9 @@ func (dec *BinaryDecoder) ReadDataValueArray(value *[]DataValue) error {
 		*value = nil
 		return nil
 	}
+	if err := dec.checkLength(n, dec.limits.MaxArrayLength); err != nil {
+		return err
+	}
 	temp := make([]DataValue, n)
 	for i := 0; i < len(temp); i++ {
 		if err := dec.ReadDataValue(&temp[i]); err != nil {
@@ -1791,6 +1923,9 @@ func (dec *BinaryDecoder) ReadVariantArray(value *[]Variant) error {
 		*value = nil
 		return nil
 	}
+	if err := dec.checkLength(n, dec.limits.MaxArrayLength); err != nil {
+		return err
+	}
 	temp := make([]Variant, n)
 	for i := 0; i < len(temp); i++ {
 		if err := dec.ReadVariant(&temp[i]); err != nil {
@@ -1811,6 +1946,9 @@ func (dec *BinaryDecoder) ReadDiagnosticInfoArray(value *[]DiagnosticInfo) error
 		*value = nil
 		return nil
 	}
+	if err := dec.checkLength(n, dec.limits.MaxArrayLength); err != nil {
+		return err
+	}
 	temp := make([]DiagnosticInfo, n)
 	for i := 0; i < len(temp); i++ {
 		if err := dec.ReadDiagnosticInfo(&temp[i]); err != nil {
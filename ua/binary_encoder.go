@@ -212,6 +212,18 @@ func getStructPtrEncoder(typ reflect.Type) (encoderFunc, error) {
 func getSliceEncoder(typ reflect.Type) (encoderFunc, error) {
 	elem := typ.Elem()
 	elemSize := elem.Size()
+	if elementsEncoder := getElementsEncoder(elem); elementsEncoder != nil {
+		return func(buf *BinaryEncoder, p unsafe.Pointer) error {
+			hdr := *(*sliceHeader)(p)
+			if hdr.len == 0 {
+				return buf.WriteInt32(-1)
+			}
+			if err := buf.WriteInt32(int32(hdr.len)); err != nil {
+				return err
+			}
+			return elementsEncoder(buf, hdr.data, hdr.len)
+		}, nil
+	}
 	elemEncoder, err := getEncoder(elem)
 	if err != nil {
 		return nil, err
@@ -479,14 +491,7 @@ func (enc *BinaryEncoder) WriteString(value string) error {
 // WriteDateTime writes a date/time.
 func (enc *BinaryEncoder) WriteDateTime(value time.Time) error {
 	// ticks are 100 nanosecond intervals since January 1, 1601
-	ticks := (value.Unix()+11644473600)*10000000 + int64(value.Nanosecond())/100
-	if ticks < 0 {
-		ticks = 0
-	}
-	if ticks >= 2650467743990000000 {
-		ticks = 0x7FFFFFFFFFFFFFFF
-	}
-	if err := enc.WriteInt64(ticks); err != nil {
+	if err := enc.WriteInt64(TimeToTicks(value)); err != nil {
 		return BadEncodingError
 	}
 	return nil
@@ -764,13 +769,21 @@ func (enc *BinaryEncoder) WriteExtensionObject(value ExtensionObject) error {
 		return nil
 	}
 	// lookup encoding id
-	typ := reflect.TypeOf(value)
-	if typ.Kind() == reflect.Ptr {
-		typ = typ.Elem()
-	}
-	id, ok := FindBinaryEncodingIDForType(typ)
-	if !ok {
-		return BadEncodingError
+	var id ExpandedNodeID
+	var st *structureType
+	if s, ok := value.(Structure); ok {
+		if st, ok = findStructureType(s.DataTypeID); !ok || IsNull(st.encodingID.NodeID) {
+			return BadEncodingError
+		}
+		id = st.encodingID
+	} else {
+		typ := reflect.TypeOf(value)
+		if typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		if id, ok = FindBinaryEncodingIDForType(typ); !ok {
+			return BadEncodingError
+		}
 	}
 	if err := enc.WriteNodeID(ToNodeID(id, enc.ec.NamespaceURIs())); err != nil {
 		return BadEncodingError
@@ -786,7 +799,7 @@ func (enc *BinaryEncoder) WriteExtensionObject(value ExtensionObject) error {
 			return BadEncodingError
 		}
 		start := buf.Len() // mark where encoding starts
-		if err := enc.Encode(value); err != nil {
+		if err := enc.writeExtensionObjectBody(st, value); err != nil {
 			return BadEncodingError
 		}
 		end := buf.Len() // mark where encoding ends
@@ -803,7 +816,7 @@ func (enc *BinaryEncoder) WriteExtensionObject(value ExtensionObject) error {
 	defer bytesPool.Put(&buf2)
 	var writer = NewWriter(buf2)
 	enc2 := NewBinaryEncoder(writer, enc.ec)
-	if err := enc2.Encode(value); err != nil {
+	if err := enc2.writeExtensionObjectBody(st, value); err != nil {
 		return BadEncodingError
 	}
 	if err := enc.WriteByteArray(writer.Bytes()); err != nil {
@@ -812,10 +825,18 @@ func (enc *BinaryEncoder) WriteExtensionObject(value ExtensionObject) error {
 	return nil
 }
 
+// writeExtensionObjectBody writes the body of an ExtensionObject, using the definition of the structure if given.
+func (enc *BinaryEncoder) writeExtensionObjectBody(st *structureType, value ExtensionObject) error {
+	if st != nil {
+		return enc.writeStructure(st, value.(Structure))
+	}
+	return enc.Encode(value)
+}
+
 // WriteDataValue writes a DataValue
 func (enc *BinaryEncoder) WriteDataValue(value DataValue) error {
 	var b byte
-	if value.Value != nil {
+	if !IsNull(value.Value) {
 		b |= 1
 	}
 
@@ -883,8 +904,8 @@ func (enc *BinaryEncoder) WriteDataValue(value DataValue) error {
 // WriteVariant writes a Variant
 func (enc *BinaryEncoder) WriteVariant(value Variant) error {
 	switch v1 := value.(type) {
-	case nil:
-		return enc.WriteByte(0)
+	case nil, Null:
+		return enc.WriteByte(VariantTypeNull)
 	case bool:
 		if err := enc.WriteByte(VariantTypeBoolean); err != nil {
 			return BadEncodingError
@@ -1207,6 +1228,18 @@ func (enc *BinaryEncoder) WriteVariant(value Variant) error {
 		if err := enc.WriteVariantArray(v1); err != nil {
 			return BadEncodingError
 		}
+	case Matrix:
+		if err := v1.Validate(); err != nil {
+			return BadEncodingError
+		}
+		// write the elements as an array, then the dimensions.
+		enc2 := NewBinaryEncoder(&matrixWriter{w: enc.w}, enc.ec)
+		if err := enc2.WriteVariant(v1.Elements); err != nil {
+			return BadEncodingError
+		}
+		if err := enc.WriteInt32Array(v1.Dimensions); err != nil {
+			return BadEncodingError
+		}
 	default:
 		// wrap structs in ExtensionObject
 		if err := enc.WriteByte(VariantTypeExtensionObject); err != nil {
@@ -1219,6 +1252,28 @@ func (enc *BinaryEncoder) WriteVariant(value Variant) error {
 	return nil
 }
 
+// matrixWriter sets the ArrayDimensions flag in the encoding mask of a Variant, which is the first
+// byte written. Returns BadEncodingError if the Variant is not an array.
+type matrixWriter struct {
+	w       io.Writer
+	started bool
+}
+
+func (w *matrixWriter) Write(p []byte) (int, error) {
+	if w.started || len(p) == 0 {
+		return w.w.Write(p)
+	}
+	w.started = true
+	if p[0]&0x80 == 0 {
+		return 0, BadEncodingError
+	}
+	if _, err := w.w.Write([]byte{p[0] | 0x40}); err != nil {
+		return 0, err
+	}
+	n, err := w.w.Write(p[1:])
+	return n + 1, err
+}
+
 // WriteDiagnosticInfo writes a DiagnosticInfo
 func (enc *BinaryEncoder) WriteDiagnosticInfo(value DiagnosticInfo) error {
 	var b byte
@@ -1340,12 +1395,7 @@ func (enc *BinaryEncoder) WriteInt16Array(value []int16) error {
 	if err := enc.WriteInt32(int32(len(value))); err != nil {
 		return BadEncodingError
 	}
-	for i := range value {
-		if err := enc.WriteInt16(value[i]); err != nil {
-			return BadEncodingError
-		}
-	}
-	return nil
+	return writeElements(enc, value, 2, putInt16)
 }
 
 // WriteUInt16Array writes a uint16 array.
@@ -1356,12 +1406,7 @@ func (enc *BinaryEncoder) WriteUInt16Array(value []uint16) error {
 	if err := enc.WriteInt32(int32(len(value))); err != nil {
 		return BadEncodingError
 	}
-	for i := range value {
-		if err := enc.WriteUInt16(value[i]); err != nil {
-			return BadEncodingError
-		}
-	}
-	return nil
+	return writeElements(enc, value, 2, putUInt16)
 }
 
 // WriteInt32Array writes a int32 array.
@@ -1372,12 +1417,7 @@ func (enc *BinaryEncoder) WriteInt32Array(value []int32) error {
 	if err := enc.WriteInt32(int32(len(value))); err != nil {
 		return BadEncodingError
 	}
-	for i := range value {
-		if err := enc.WriteInt32(value[i]); err != nil {
-			return BadEncodingError
-		}
-	}
-	return nil
+	return writeElements(enc, value, 4, putInt32)
 }
 
 // WriteUInt32Array writes a uint32 array.
@@ -1388,12 +1428,7 @@ func (enc *BinaryEncoder) WriteUInt32Array(value []uint32) error {
 	if err := enc.WriteInt32(int32(len(value))); err != nil {
 		return BadEncodingError
 	}
-	for i := range value {
-		if err := enc.WriteUInt32(value[i]); err != nil {
-			return BadEncodingError
-		}
-	}
-	return nil
+	return writeElements(enc, value, 4, putUInt32)
 }
 
 // WriteInt64Array writes a int64 array.
@@ -1404,12 +1439,7 @@ func (enc *BinaryEncoder) WriteInt64Array(value []int64) error {
 	if err := enc.WriteInt32(int32(len(value))); err != nil {
 		return BadEncodingError
 	}
-	for i := range value {
-		if err := enc.WriteInt64(value[i]); err != nil {
-			return BadEncodingError
-		}
-	}
-	return nil
+	return writeElements(enc, value, 8, putInt64)
 }
 
 // WriteUInt64Array writes a uint64 array.
@@ -1420,12 +1450,7 @@ func (enc *BinaryEncoder) WriteUInt64Array(value []uint64) error {
 	if err := enc.WriteInt32(int32(len(value))); err != nil {
 		return BadEncodingError
 	}
-	for i := range value {
-		if err := enc.WriteUInt64(value[i]); err != nil {
-			return BadEncodingError
-		}
-	}
-	return nil
+	return writeElements(enc, value, 8, putUInt64)
 }
 
 // WriteFloatArray writes a float32 array.
@@ -1436,12 +1461,7 @@ func (enc *BinaryEncoder) WriteFloatArray(value []float32) error {
 	if err := enc.WriteInt32(int32(len(value))); err != nil {
 		return BadEncodingError
 	}
-	for i := range value {
-		if err := enc.WriteFloat(value[i]); err != nil {
-			return BadEncodingError
-		}
-	}
-	return nil
+	return writeElements(enc, value, 4, putFloat)
 }
 
 // WriteDoubleArray writes a float64 array.
@@ -1452,12 +1472,7 @@ func (enc *BinaryEncoder) WriteDoubleArray(value []float64) error {
 	if err := enc.WriteInt32(int32(len(value))); err != nil {
 		return BadEncodingError
 	}
-	for i := range value {
-		if err := enc.WriteDouble(value[i]); err != nil {
-			return BadEncodingError
-		}
-	}
-	return nil
+	return writeElements(enc, value, 8, putDouble)
 }
 
 // WriteStringArray writes a string array.
@@ -4,6 +4,9 @@ package ua_test
 
 import (
 	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
 	"testing"
 	"time"
 
@@ -139,6 +142,12 @@ func TestTime(t *testing.T) {
 				0x00, 0xa0, 0xa5, 0xa4, 0xfa, 0x51, 0xd6, 0x01,
 			},
 		},
+		{
+			time.Time{},
+			[]byte{
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+			},
+		},
 	}
 	for _, c := range cases {
 		buf := &bytes.Buffer{}
@@ -157,6 +166,25 @@ func TestTime(t *testing.T) {
 	}
 }
 
+func TestTimeToTicks(t *testing.T) {
+	cases := []struct {
+		in    time.Time
+		ticks int64
+	}{
+		{time.Time{}, 0},
+		{time.Date(1601, time.January, 01, 0, 0, 0, 100, time.UTC), 1},
+		{time.Date(1970, time.January, 01, 0, 0, 0, 0, time.UTC), 116444736000000000},
+		{time.Date(1500, time.January, 01, 0, 0, 0, 0, time.UTC), 0},
+		{time.Date(10000, time.January, 01, 0, 0, 0, 0, time.UTC), math.MaxInt64},
+	}
+	for _, c := range cases {
+		assert.Equal(t, ua.TimeToTicks(c.in), c.ticks)
+	}
+	assert.Assert(t, ua.TicksToTime(0).IsZero())
+	assert.Assert(t, ua.TicksToTime(-1).IsZero())
+	assert.DeepEqual(t, ua.TicksToTime(116444736000000000), time.Date(1970, time.January, 01, 0, 0, 0, 0, time.UTC))
+}
+
 func TestGUID(t *testing.T) {
 	cases := []struct {
 		in    uuid.UUID
@@ -419,6 +447,47 @@ func TestDataValue(t *testing.T) {
 	}
 }
 
+func TestNullVariant(t *testing.T) {
+	cases := []struct {
+		in    ua.Variant
+		bytes []byte
+	}{
+		{
+			nil,
+			[]byte{
+				0x00, // type
+			},
+		},
+		{
+			ua.Null{},
+			[]byte{
+				0x00, // type
+			},
+		},
+	}
+	for _, c := range cases {
+		if !ua.IsNull(c.in) {
+			t.Fatalf("IsNull(%v) returned false", c.in)
+		}
+		buf := &bytes.Buffer{}
+		enc := ua.NewBinaryEncoder(buf, ua.NewEncodingContext())
+		if err := enc.WriteVariant(c.in); err != nil {
+			t.Fatal(err)
+		}
+		assert.DeepEqual(t, buf.Bytes(), c.bytes)
+
+		dec := ua.NewBinaryDecoder(buf, ua.NewEncodingContext())
+		var out ua.Variant
+		if err := dec.ReadVariant(&out); err != nil {
+			t.Fatal(err)
+		}
+		assert.Assert(t, out == nil)
+	}
+	if ua.IsNull(int32(0)) {
+		t.Fatal("IsNull(int32(0)) returned true")
+	}
+}
+
 func TestEnum(t *testing.T) {
 	cases := []struct {
 		in    ua.MessageSecurityMode
@@ -663,3 +732,270 @@ func TestSliceNodeID(t *testing.T) {
 		assert.DeepEqual(t, out, c.in)
 	}
 }
+
+func TestDiagnosticInfo(t *testing.T) {
+	localizedText := int32(0)
+	additionalInfo := "device offline"
+	innerStatusCode := ua.BadTimeout
+	cases := []struct {
+		in    ua.DiagnosticInfo
+		bytes []byte
+	}{
+		{
+			ua.DiagnosticInfo{
+				LocalizedText:   &localizedText,
+				AdditionalInfo:  &additionalInfo,
+				InnerStatusCode: &innerStatusCode,
+			},
+			[]byte{
+				0x34,                   // mask
+				0x00, 0x00, 0x00, 0x00, // localized text
+				0x0e, 0x00, 0x00, 0x00, 0x64, 0x65, 0x76, 0x69, 0x63, 0x65, 0x20, 0x6f, 0x66, 0x66, 0x6c, 0x69, 0x6e, 0x65, // additional info
+				0x00, 0x00, 0x0a, 0x80, // inner status code
+			},
+		},
+	}
+	for _, c := range cases {
+		buf := &bytes.Buffer{}
+		enc := ua.NewBinaryEncoder(buf, ua.NewEncodingContext())
+		if err := enc.WriteDiagnosticInfo(c.in); err != nil {
+			t.Fatal(err)
+		}
+		assert.DeepEqual(t, buf.Bytes(), c.bytes)
+
+		dec := ua.NewBinaryDecoder(buf, ua.NewEncodingContext())
+		var out ua.DiagnosticInfo
+		if err := dec.ReadDiagnosticInfo(&out); err != nil {
+			t.Fatal(err)
+		}
+		assert.DeepEqual(t, out, c.in)
+	}
+}
+
+func TestDecoderLimits(t *testing.T) {
+	// an array that claims 2 billion elements.
+	huge := []byte{0x00, 0x94, 0x35, 0x77}
+
+	dec := ua.NewBinaryDecoder(bytes.NewBuffer(huge), ua.NewEncodingContext())
+	dec.SetLimits(ua.EncodingLimits{MaxArrayLength: 4096})
+	var out []int32
+	if err := dec.ReadInt32Array(&out); err != ua.BadEncodingLimitsExceeded {
+		t.Errorf("Error decoding array. want: %s, got: %v", ua.BadEncodingLimitsExceeded, err)
+	}
+
+	// without limits, the length is checked against the bytes remaining.
+	dec = ua.NewBinaryDecoder(bytes.NewBuffer(huge), ua.NewEncodingContext())
+	if err := dec.ReadInt32Array(&out); err != ua.BadDecodingError {
+		t.Errorf("Error decoding array. want: %s, got: %v", ua.BadDecodingError, err)
+	}
+
+	// a byte array is an array of Byte, so it is limited by the MaxArrayLength.
+	bytes8 := []byte{0x08, 0x00, 0x00, 0x00, 1, 2, 3, 4, 5, 6, 7, 8}
+	dec = ua.NewBinaryDecoder(bytes.NewBuffer(bytes8), ua.NewEncodingContext())
+	dec.SetLimits(ua.EncodingLimits{MaxByteStringLength: 4, MaxArrayLength: 8})
+	var b []byte
+	if err := dec.ReadByteArray(&b); err != nil || len(b) != 8 {
+		t.Errorf("Error decoding byte array. want: 8 bytes, got: %v, %v", b, err)
+	}
+	dec = ua.NewBinaryDecoder(bytes.NewBuffer(bytes8), ua.NewEncodingContext())
+	dec.SetLimits(ua.EncodingLimits{MaxByteStringLength: 8, MaxArrayLength: 4})
+	if err := dec.ReadByteArray(&b); err != ua.BadEncodingLimitsExceeded {
+		t.Errorf("Error decoding byte array. want: %s, got: %v", ua.BadEncodingLimitsExceeded, err)
+	}
+
+	// a limit exceeded by a nested field is reported by Decode.
+	buf := &bytes.Buffer{}
+	enc := ua.NewBinaryEncoder(buf, ua.NewEncodingContext())
+	req := &ua.ReadRequest{NodesToRead: []ua.ReadValueID{{NodeID: ua.ParseNodeID("ns=2;s=" + strings.Repeat("x", 100))}}}
+	if err := enc.Encode(req); err != nil {
+		t.Fatal(err)
+	}
+	dec = ua.NewBinaryDecoder(buf, ua.NewEncodingContext())
+	dec.SetLimits(ua.EncodingLimits{MaxStringLength: 10})
+	if err := dec.Decode(new(ua.ReadRequest)); err != ua.BadEncodingLimitsExceeded {
+		t.Errorf("Error decoding request. want: %s, got: %v", ua.BadEncodingLimitsExceeded, err)
+	}
+}
+
+func TestNumericArrays(t *testing.T) {
+	// compare with the bytes of the elements written one at a time.
+	doubles := []float64{0, 1.5, -2.25, math.MaxFloat64, math.Inf(-1)}
+	want := &bytes.Buffer{}
+	ref := ua.NewBinaryEncoder(want, ua.NewEncodingContext())
+	ref.WriteInt32(int32(len(doubles)))
+	for _, v := range doubles {
+		ref.WriteDouble(v)
+	}
+	buf := &bytes.Buffer{}
+	enc := ua.NewBinaryEncoder(buf, ua.NewEncodingContext())
+	if err := enc.WriteDoubleArray(doubles); err != nil {
+		t.Fatal(err)
+	}
+	assert.DeepEqual(t, buf.Bytes(), want.Bytes())
+	dec := ua.NewBinaryDecoder(buf, ua.NewEncodingContext())
+	var out []float64
+	if err := dec.ReadDoubleArray(&out); err != nil {
+		t.Fatal(err)
+	}
+	assert.DeepEqual(t, out, doubles)
+
+	// the struct encoder writes numeric slices in bulk, too.
+	type arrays struct {
+		A []int16
+		B []uint32
+		C []int64
+		D []float32
+		E []uint16
+	}
+	in := arrays{
+		A: []int16{-1, 2, math.MinInt16},
+		B: []uint32{1, math.MaxUint32},
+		C: []int64{math.MinInt64, 0, math.MaxInt64},
+		D: []float32{0.5, -1},
+		E: nil,
+	}
+	want.Reset()
+	ref.WriteInt16Array(in.A)
+	ref.WriteUInt32Array(in.B)
+	ref.WriteInt64Array(in.C)
+	ref.WriteFloatArray(in.D)
+	ref.WriteInt32(-1)
+	buf.Reset()
+	if err := enc.Encode(in); err != nil {
+		t.Fatal(err)
+	}
+	assert.DeepEqual(t, buf.Bytes(), want.Bytes())
+	dec = ua.NewBinaryDecoder(buf, ua.NewEncodingContext())
+	var out2 arrays
+	if err := dec.Decode(&out2); err != nil {
+		t.Fatal(err)
+	}
+	assert.DeepEqual(t, out2, in)
+}
+
+func TestNumericArraysByteOrder(t *testing.T) {
+	// the encoding of each type is little-endian, whatever the byte order of the platform.
+	cases := []struct {
+		in    interface{}
+		bytes []byte
+	}{
+		{[]int16{1, -2}, []byte{0x02, 0x00, 0x00, 0x00, 0x01, 0x00, 0xfe, 0xff}},
+		{[]uint16{0x1234}, []byte{0x01, 0x00, 0x00, 0x00, 0x34, 0x12}},
+		{[]int32{-1, 0x01020304}, []byte{0x02, 0x00, 0x00, 0x00, 0xff, 0xff, 0xff, 0xff, 0x04, 0x03, 0x02, 0x01}},
+		{[]uint32{0x01020304}, []byte{0x01, 0x00, 0x00, 0x00, 0x04, 0x03, 0x02, 0x01}},
+		{[]int64{-2}, []byte{0x01, 0x00, 0x00, 0x00, 0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{[]uint64{0x0102030405060708}, []byte{0x01, 0x00, 0x00, 0x00, 0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01}},
+		{[]float32{1.5}, []byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0xc0, 0x3f}},
+		{[]float64{1.5, -2}, []byte{0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf8, 0x3f, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xc0}},
+	}
+	// more elements than fit in the buffer of the big-endian path.
+	long := make([]float64, 1000)
+	longBytes := []byte{0xe8, 0x03, 0x00, 0x00}
+	for i := range long {
+		long[i] = float64(i)
+		longBytes = binary.LittleEndian.AppendUint64(longBytes, math.Float64bits(float64(i)))
+	}
+	cases = append(cases, struct {
+		in    interface{}
+		bytes []byte
+	}{long, longBytes})
+
+	for _, le := range []bool{true, false} {
+		restore := ua.SetNativeLittleEndian(le)
+		for _, c := range cases {
+			buf := &bytes.Buffer{}
+			enc := ua.NewBinaryEncoder(buf, ua.NewEncodingContext())
+			if err := enc.WriteVariant(c.in); err != nil {
+				t.Fatal(err)
+			}
+			// skip the encoding mask of the variant.
+			if got := buf.Bytes()[1:]; !bytes.Equal(got, c.bytes) {
+				t.Errorf("Error encoding %T, little-endian: %t. want: %x, got: %x", c.in, le, c.bytes, got)
+			}
+			dec := ua.NewBinaryDecoder(buf, ua.NewEncodingContext())
+			var out ua.Variant
+			if err := dec.ReadVariant(&out); err != nil {
+				t.Fatal(err)
+			}
+			assert.DeepEqual(t, out, c.in)
+		}
+		restore()
+	}
+}
+
+func BenchmarkWriteDoubleArray(b *testing.B) {
+	value := make([]float64, 1_000_000)
+	for i := range value {
+		value[i] = float64(i) / 3
+	}
+	buf := &bytes.Buffer{}
+	buf.Grow(8*len(value) + 4)
+	enc := ua.NewBinaryEncoder(buf, ua.NewEncodingContext())
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		if err := enc.WriteDoubleArray(value); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadDoubleArray(b *testing.B) {
+	value := make([]float64, 1_000_000)
+	for i := range value {
+		value[i] = float64(i) / 3
+	}
+	buf := &bytes.Buffer{}
+	enc := ua.NewBinaryEncoder(buf, ua.NewEncodingContext())
+	if err := enc.WriteDoubleArray(value); err != nil {
+		b.Fatal(err)
+	}
+	data := buf.Bytes()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dec := ua.NewBinaryDecoder(bytes.NewReader(data), ua.NewEncodingContext())
+		var out []float64
+		if err := dec.ReadDoubleArray(&out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestMatrixVariant(t *testing.T) {
+	cases := []struct {
+		in    ua.Variant
+		bytes []byte
+	}{
+		{
+			ua.Matrix{Elements: []int16{1, 2, 3, 4, 5, 6}, Dimensions: []int32{2, 3}},
+			[]byte{
+				0xc4,                   // int16 | array | dimensions
+				0x06, 0x00, 0x00, 0x00, // len
+				0x01, 0x00, 0x02, 0x00, 0x03, 0x00, 0x04, 0x00, 0x05, 0x00, 0x06, 0x00,
+				0x02, 0x00, 0x00, 0x00, // len of dimensions
+				0x02, 0x00, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00,
+			},
+		},
+	}
+	for _, c := range cases {
+		buf := &bytes.Buffer{}
+		enc := ua.NewBinaryEncoder(buf, ua.NewEncodingContext())
+		if err := enc.WriteVariant(c.in); err != nil {
+			t.Fatal(err)
+		}
+		assert.DeepEqual(t, buf.Bytes(), c.bytes)
+
+		dec := ua.NewBinaryDecoder(buf, ua.NewEncodingContext())
+		var out ua.Variant
+		if err := dec.ReadVariant(&out); err != nil {
+			t.Fatal(err)
+		}
+		assert.DeepEqual(t, out, c.in)
+	}
+
+	// the number of elements must be the product of the dimensions.
+	buf := &bytes.Buffer{}
+	enc := ua.NewBinaryEncoder(buf, ua.NewEncodingContext())
+	err := enc.WriteVariant(ua.Matrix{Elements: []int16{1, 2, 3}, Dimensions: []int32{2, 2}})
+	assert.Equal(t, err, ua.BadEncodingError)
+}
@@ -0,0 +1,372 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package ua
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CertificateCheck identifies a check performed by a CertificateValidator.
+type CertificateCheck int
+
+const (
+	// CertificateCheckValidity checks the certificate is within its validity period.
+	CertificateCheckValidity CertificateCheck = iota
+	// CertificateCheckChain checks the certificate chains to a trusted certificate.
+	CertificateCheckChain
+	// CertificateCheckRevocation checks the certificate and its issuers are not revoked.
+	CertificateCheckRevocation
+	// CertificateCheckHostName checks the certificate is valid for the host name.
+	CertificateCheckHostName
+	// CertificateCheckURI checks the certificate contains the application URI.
+	CertificateCheckURI
+	// CertificateCheckKeyUsage checks the certificate may be used for the purpose.
+	CertificateCheckKeyUsage
+)
+
+// String returns the name of the CertificateCheck.
+func (c CertificateCheck) String() string {
+	switch c {
+	case CertificateCheckValidity:
+		return "Validity"
+	case CertificateCheckChain:
+		return "Chain"
+	case CertificateCheckRevocation:
+		return "Revocation"
+	case CertificateCheckHostName:
+		return "HostName"
+	case CertificateCheckURI:
+		return "URI"
+	case CertificateCheckKeyUsage:
+		return "KeyUsage"
+	default:
+		return "Unknown"
+	}
+}
+
+// CertificateCheckResult is the outcome of a single check.
+type CertificateCheckResult struct {
+	Check CertificateCheck
+	// StatusCode is Good if the check passed or was skipped.
+	StatusCode StatusCode
+	// Skipped is true if the check was suppressed or not applicable.
+	Skipped bool
+}
+
+// CertificateValidationResult lists the outcome of each check performed by a CertificateValidator.
+type CertificateValidationResult struct {
+	Checks []CertificateCheckResult
+}
+
+// Err returns the StatusCode of the first failed check, or nil if all checks passed.
+func (r CertificateValidationResult) Err() error {
+	for _, c := range r.Checks {
+		if c.StatusCode.IsBad() {
+			return c.StatusCode
+		}
+	}
+	return nil
+}
+
+// String returns the outcome of each check, e.g. "Validity: Passed; Chain: Failed (0x801A0000) ...".
+func (r CertificateValidationResult) String() string {
+	var b strings.Builder
+	for i, c := range r.Checks {
+		if i > 0 {
+			b.WriteString("; ")
+		}
+		switch {
+		case c.Skipped:
+			fmt.Fprintf(&b, "%s: Skipped", c.Check)
+		case c.StatusCode.IsBad():
+			fmt.Fprintf(&b, "%s: Failed (0x%08X) %s", c.Check, uint32(c.StatusCode), c.StatusCode)
+		default:
+			fmt.Fprintf(&b, "%s: Passed", c.Check)
+		}
+	}
+	return b.String()
+}
+
+// CertificateValidator validates application instance certificates. A validator may be shared
+// by servers and clients. The files are read each time a certificate is validated, so
+// changes to the trust list take effect without a restart.
+type CertificateValidator struct {
+	// TrustedCertsPath is a file or directory of trusted certificates or certificate authorities.
+	TrustedCertsPath string
+	// IssuerCertsPath is a file or directory of certificate authorities that are used to build
+	// the chain of a certificate, but are not trusted themselves.
+	IssuerCertsPath string
+	// CRLPath is a file or directory of the certificate revocation lists of the certificate authorities.
+	// If empty, revocation is not checked.
+	CRLPath string
+	// SuppressCertificateTimeInvalid skips checking the validity period.
+	SuppressCertificateTimeInvalid bool
+	// SuppressCertificateChainIncomplete trusts a certificate that does not chain to a trusted certificate.
+	SuppressCertificateChainIncomplete bool
+	// SuppressCertificateRevocationUnknown accepts a certificate whose issuer has no revocation list.
+	SuppressCertificateRevocationUnknown bool
+	// SuppressCertificateHostNameInvalid skips checking the host name.
+	SuppressCertificateHostNameInvalid bool
+	// SuppressCertificateURIInvalid skips checking the application URI.
+	SuppressCertificateURIInvalid bool
+	// SuppressCertificateUseNotAllowed skips checking the key usage.
+	SuppressCertificateUseNotAllowed bool
+}
+
+// Validate checks the certificate for the purpose given by usage. If hostname or applicationURI
+// is empty, then that check is skipped.
+func (v *CertificateValidator) Validate(certificate *x509.Certificate, usage x509.ExtKeyUsage, hostname, applicationURI string) CertificateValidationResult {
+	if certificate == nil {
+		return CertificateValidationResult{Checks: []CertificateCheckResult{{Check: CertificateCheckChain, StatusCode: BadCertificateInvalid}}}
+	}
+	checks := make([]CertificateCheckResult, 0, 6)
+	checks = append(checks, v.checkValidity(certificate))
+	chain, chainCheck := v.checkChain(certificate)
+	checks = append(checks, chainCheck)
+	checks = append(checks, v.checkRevocation(chain))
+	checks = append(checks, v.checkHostName(certificate, hostname))
+	checks = append(checks, v.checkURI(certificate, applicationURI))
+	checks = append(checks, v.checkKeyUsage(certificate, usage))
+	return CertificateValidationResult{Checks: checks}
+}
+
+func (v *CertificateValidator) checkValidity(certificate *x509.Certificate) CertificateCheckResult {
+	if v.SuppressCertificateTimeInvalid {
+		return CertificateCheckResult{Check: CertificateCheckValidity, Skipped: true}
+	}
+	now := time.Now()
+	if now.Before(certificate.NotBefore) || now.After(certificate.NotAfter) {
+		return CertificateCheckResult{Check: CertificateCheckValidity, StatusCode: BadCertificateTimeInvalid}
+	}
+	return CertificateCheckResult{Check: CertificateCheckValidity}
+}
+
+// checkChain builds the chain of the certificate and checks that it contains a trusted certificate.
+// The chain is returned for the revocation check.
+func (v *CertificateValidator) checkChain(certificate *x509.Certificate) ([]*x509.Certificate, CertificateCheckResult) {
+	trusted := readCertificates(v.TrustedCertsPath)
+	issuers := readCertificates(v.IssuerCertsPath)
+	roots := x509.NewCertPool()
+	intermediates := x509.NewCertPool()
+	for _, c := range append(trusted, issuers...) {
+		if bytes.Equal(c.RawIssuer, c.RawSubject) {
+			roots.AddCert(c)
+		} else {
+			intermediates.AddCert(c)
+		}
+	}
+	if v.SuppressCertificateChainIncomplete {
+		roots.AddCert(certificate)
+		trusted = append(trusted, certificate)
+	}
+	// the issuers must be valid now. The validity period of the certificate itself and the key usage
+	// are checked separately.
+	now := time.Now()
+	if now.Before(certificate.NotBefore) {
+		now = certificate.NotBefore
+	} else if now.After(certificate.NotAfter) {
+		now = certificate.NotAfter
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	chains, err := certificate.Verify(opts)
+	if err != nil {
+		switch e := err.(type) {
+		case x509.UnknownAuthorityError:
+			// a self-signed certificate is complete, but not trusted.
+			if bytes.Equal(certificate.RawIssuer, certificate.RawSubject) {
+				return nil, CertificateCheckResult{Check: CertificateCheckChain, StatusCode: BadCertificateUntrusted}
+			}
+			return nil, CertificateCheckResult{Check: CertificateCheckChain, StatusCode: BadCertificateChainIncomplete}
+		case x509.CertificateInvalidError:
+			if e.Reason == x509.Expired {
+				return nil, CertificateCheckResult{Check: CertificateCheckChain, StatusCode: BadCertificateIssuerTimeInvalid}
+			}
+		}
+		return nil, CertificateCheckResult{Check: CertificateCheckChain, StatusCode: BadSecurityChecksFailed}
+	}
+	// a chain is trusted if it contains a certificate of the trust list.
+	for _, chain := range chains {
+		for _, c := range chain {
+			for _, t := range trusted {
+				if c.Equal(t) {
+					return chain, CertificateCheckResult{Check: CertificateCheckChain}
+				}
+			}
+		}
+	}
+	return nil, CertificateCheckResult{Check: CertificateCheckChain, StatusCode: BadCertificateUntrusted}
+}
+
+// checkRevocation checks the certificates of the chain against the revocation lists of their issuers.
+func (v *CertificateValidator) checkRevocation(chain []*x509.Certificate) CertificateCheckResult {
+	if v.CRLPath == "" || len(chain) == 0 {
+		return CertificateCheckResult{Check: CertificateCheckRevocation, Skipped: true}
+	}
+	crls := readRevocationLists(v.CRLPath)
+	// the last certificate of the chain is self-signed.
+	for i := 0; i < len(chain)-1; i++ {
+		c, issuer := chain[i], chain[i+1]
+		found := false
+		for _, crl := range crls {
+			if !bytes.Equal(crl.RawIssuer, c.RawIssuer) || crl.CheckSignatureFrom(issuer) != nil {
+				continue
+			}
+			found = true
+			for _, rc := range crl.RevokedCertificateEntries {
+				if rc.SerialNumber.Cmp(c.SerialNumber) == 0 {
+					if i == 0 {
+						return CertificateCheckResult{Check: CertificateCheckRevocation, StatusCode: BadCertificateRevoked}
+					}
+					return CertificateCheckResult{Check: CertificateCheckRevocation, StatusCode: BadCertificateIssuerRevoked}
+				}
+			}
+		}
+		if !found && !v.SuppressCertificateRevocationUnknown {
+			if i == 0 {
+				return CertificateCheckResult{Check: CertificateCheckRevocation, StatusCode: BadCertificateRevocationUnknown}
+			}
+			return CertificateCheckResult{Check: CertificateCheckRevocation, StatusCode: BadCertificateIssuerRevocationUnknown}
+		}
+	}
+	return CertificateCheckResult{Check: CertificateCheckRevocation}
+}
+
+func (v *CertificateValidator) checkHostName(certificate *x509.Certificate, hostname string) CertificateCheckResult {
+	if v.SuppressCertificateHostNameInvalid || hostname == "" {
+		return CertificateCheckResult{Check: CertificateCheckHostName, Skipped: true}
+	}
+	if err := certificate.VerifyHostname(hostname); err != nil {
+		return CertificateCheckResult{Check: CertificateCheckHostName, StatusCode: BadCertificateHostNameInvalid}
+	}
+	return CertificateCheckResult{Check: CertificateCheckHostName}
+}
+
+func (v *CertificateValidator) checkURI(certificate *x509.Certificate, applicationURI string) CertificateCheckResult {
+	if v.SuppressCertificateURIInvalid || applicationURI == "" {
+		return CertificateCheckResult{Check: CertificateCheckURI, Skipped: true}
+	}
+	for _, u := range certificate.URIs {
+		if u.String() == applicationURI {
+			return CertificateCheckResult{Check: CertificateCheckURI}
+		}
+	}
+	return CertificateCheckResult{Check: CertificateCheckURI, StatusCode: BadCertificateURIInvalid}
+}
+
+func (v *CertificateValidator) checkKeyUsage(certificate *x509.Certificate, usage x509.ExtKeyUsage) CertificateCheckResult {
+	if v.SuppressCertificateUseNotAllowed {
+		return CertificateCheckResult{Check: CertificateCheckKeyUsage, Skipped: true}
+	}
+	// application instance certificates are used to sign and encrypt.
+	const required = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	if certificate.KeyUsage != 0 && certificate.KeyUsage&required != required {
+		return CertificateCheckResult{Check: CertificateCheckKeyUsage, StatusCode: BadCertificateUseNotAllowed}
+	}
+	if len(certificate.ExtKeyUsage) > 0 && usage != x509.ExtKeyUsageAny {
+		ok := false
+		for _, u := range certificate.ExtKeyUsage {
+			if u == usage || u == x509.ExtKeyUsageAny {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return CertificateCheckResult{Check: CertificateCheckKeyUsage, StatusCode: BadCertificateUseNotAllowed}
+		}
+	}
+	return CertificateCheckResult{Check: CertificateCheckKeyUsage}
+}
+
+// readFiles returns the contents of the file, or of each file in the directory.
+func readFiles(path string) [][]byte {
+	if path == "" {
+		return nil
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	if !fi.IsDir() {
+		buf, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		return [][]byte{buf}
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil
+	}
+	files := make([][]byte, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if buf, err := os.ReadFile(filepath.Join(path, e.Name())); err == nil {
+			files = append(files, buf)
+		}
+	}
+	return files
+}
+
+// readCertificates returns the PEM or DER encoded certificates of the file or directory.
+func readCertificates(path string) []*x509.Certificate {
+	certs := []*x509.Certificate{}
+	for _, buf := range readFiles(path) {
+		for len(buf) > 0 {
+			var block *pem.Block
+			block, buf = pem.Decode(buf)
+			if block == nil {
+				// maybe its der
+				if cert, err := x509.ParseCertificate(buf); err == nil {
+					certs = append(certs, cert)
+				}
+				break
+			}
+			if block.Type != "CERTIFICATE" || len(block.Headers) != 0 {
+				continue
+			}
+			if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+				certs = append(certs, cert)
+			}
+		}
+	}
+	return certs
+}
+
+// readRevocationLists returns the PEM or DER encoded revocation lists of the file or directory.
+func readRevocationLists(path string) []*x509.RevocationList {
+	crls := []*x509.RevocationList{}
+	for _, buf := range readFiles(path) {
+		for len(buf) > 0 {
+			var block *pem.Block
+			block, buf = pem.Decode(buf)
+			if block == nil {
+				// maybe its der
+				if crl, err := x509.ParseRevocationList(buf); err == nil {
+					crls = append(crls, crl)
+				}
+				break
+			}
+			if block.Type != "X509 CRL" {
+				continue
+			}
+			if crl, err := x509.ParseRevocationList(block.Bytes); err == nil {
+				crls = append(crls, crl)
+			}
+		}
+	}
+	return crls
+}
@@ -0,0 +1,161 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package ua_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/awcullen/opcua/ua"
+	"gotest.tools/assert"
+)
+
+// createCertificate returns a certificate signed by the parent, or self-signed if parent is nil.
+func createCertificate(t *testing.T, serial int64, isCA bool, notAfter time.Time, parent *x509.Certificate, parentKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applicationURI, _ := url.Parse("urn:localhost:testapp")
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "testapp"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment | x509.KeyUsageKeyEncipherment | x509.KeyUsageDataEncipherment | x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		DNSNames:              []string{"localhost"},
+		URIs:                  []*url.URL{applicationURI},
+	}
+	if isCA {
+		template.Subject = pkix.Name{CommonName: "testca"}
+		template.DNSNames = nil
+		template.URIs = nil
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func writePEM(t *testing.T, path, typ string, der []byte) {
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCertificateValidatorSelfSigned(t *testing.T) {
+	dir := t.TempDir()
+	cert, _ := createCertificate(t, 1, false, time.Now().Add(time.Hour), nil, nil)
+
+	v := &ua.CertificateValidator{TrustedCertsPath: dir}
+	result := v.Validate(cert, x509.ExtKeyUsageClientAuth, "", "")
+	assert.Equal(t, result.Err(), ua.BadCertificateUntrusted, result.String())
+
+	writePEM(t, filepath.Join(dir, "testapp.crt"), "CERTIFICATE", cert.Raw)
+	result = v.Validate(cert, x509.ExtKeyUsageClientAuth, "localhost", "urn:localhost:testapp")
+	assert.NilError(t, result.Err(), result.String())
+
+	result = v.Validate(cert, x509.ExtKeyUsageClientAuth, "otherhost", "urn:otherhost:testapp")
+	assert.Equal(t, result.Err(), ua.BadCertificateHostNameInvalid, result.String())
+	assert.Equal(t, result.Checks[4].StatusCode, ua.BadCertificateURIInvalid)
+
+	result = v.Validate(cert, x509.ExtKeyUsageServerAuth, "", "")
+	assert.Equal(t, result.Err(), ua.BadCertificateUseNotAllowed, result.String())
+
+	v.SuppressCertificateUseNotAllowed = true
+	result = v.Validate(cert, x509.ExtKeyUsageServerAuth, "", "")
+	assert.NilError(t, result.Err(), result.String())
+	assert.Assert(t, result.Checks[5].Skipped)
+}
+
+func TestCertificateValidatorExpired(t *testing.T) {
+	dir := t.TempDir()
+	cert, _ := createCertificate(t, 1, false, time.Now().Add(-time.Minute), nil, nil)
+	writePEM(t, filepath.Join(dir, "testapp.crt"), "CERTIFICATE", cert.Raw)
+
+	v := &ua.CertificateValidator{TrustedCertsPath: dir}
+	result := v.Validate(cert, x509.ExtKeyUsageClientAuth, "", "")
+	assert.Equal(t, result.Err(), ua.BadCertificateTimeInvalid, result.String())
+	// the other checks do not depend on the validity period.
+	assert.Equal(t, result.Checks[1].StatusCode, ua.Good)
+
+	v.SuppressCertificateTimeInvalid = true
+	result = v.Validate(cert, x509.ExtKeyUsageClientAuth, "", "")
+	assert.NilError(t, result.Err(), result.String())
+}
+
+func TestCertificateValidatorIssuerExpired(t *testing.T) {
+	trustedDir := t.TempDir()
+	ca, caKey := createCertificate(t, 1, true, time.Now().Add(-time.Minute), nil, nil)
+	cert, _ := createCertificate(t, 2, false, time.Now().Add(time.Hour), ca, caKey)
+	writePEM(t, filepath.Join(trustedDir, "testca.crt"), "CERTIFICATE", ca.Raw)
+
+	// the certificate is valid, but its issuer expired.
+	v := &ua.CertificateValidator{TrustedCertsPath: trustedDir}
+	result := v.Validate(cert, x509.ExtKeyUsageClientAuth, "", "")
+	assert.Equal(t, result.Err(), ua.BadCertificateIssuerTimeInvalid, result.String())
+}
+
+func TestCertificateValidatorRevoked(t *testing.T) {
+	trustedDir, issuerDir, crlDir := t.TempDir(), t.TempDir(), t.TempDir()
+	ca, caKey := createCertificate(t, 1, true, time.Now().Add(time.Hour), nil, nil)
+	cert, _ := createCertificate(t, 2, false, time.Now().Add(time.Hour), ca, caKey)
+	writePEM(t, filepath.Join(issuerDir, "testca.crt"), "CERTIFICATE", ca.Raw)
+
+	// the issuer is not trusted.
+	v := &ua.CertificateValidator{TrustedCertsPath: trustedDir, IssuerCertsPath: issuerDir, CRLPath: crlDir}
+	result := v.Validate(cert, x509.ExtKeyUsageClientAuth, "", "")
+	assert.Equal(t, result.Err(), ua.BadCertificateUntrusted, result.String())
+
+	// the certificate is trusted, but the issuer has no revocation list.
+	writePEM(t, filepath.Join(trustedDir, "testapp.crt"), "CERTIFICATE", cert.Raw)
+	result = v.Validate(cert, x509.ExtKeyUsageClientAuth, "", "")
+	assert.Equal(t, result.Err(), ua.BadCertificateRevocationUnknown, result.String())
+
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Hour),
+		NextUpdate: time.Now().Add(time.Hour),
+	}, ca, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, filepath.Join(crlDir, "testca.crl"), "X509 CRL", crl)
+	result = v.Validate(cert, x509.ExtKeyUsageClientAuth, "", "")
+	assert.NilError(t, result.Err(), result.String())
+
+	crl, err = x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(2),
+		ThisUpdate: time.Now().Add(-time.Hour),
+		NextUpdate: time.Now().Add(time.Hour),
+		RevokedCertificateEntries: []x509.RevocationListEntry{
+			{SerialNumber: cert.SerialNumber, RevocationTime: time.Now()},
+		},
+	}, ca, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, filepath.Join(crlDir, "testca.crl"), "X509 CRL", crl)
+	result = v.Validate(cert, x509.ExtKeyUsageClientAuth, "", "")
+	assert.Equal(t, result.Err(), ua.BadCertificateRevoked, result.String())
+}
@@ -3,6 +3,8 @@
 package ua
 
 import (
+	"math"
+	"reflect"
 	"time"
 )
 
@@ -20,5 +22,191 @@ func NewDataValue(value Variant, status StatusCode, sourceTimestamp time.Time, s
 	return DataValue{value, status, sourceTimestamp, sourcePicoseconds, serverTimestamp, serverPicoseconds}
 }
 
+// GoodDataValue returns a DataValue with the value, status Good, and the source and server timestamps set to now.
+func GoodDataValue(value Variant) DataValue {
+	return DataValueWithStatus(value, Good)
+}
+
+// DataValueWithStatus returns a DataValue with the value, status, and the source and server timestamps set to now.
+func DataValueWithStatus(value Variant, status StatusCode) DataValue {
+	now := time.Now()
+	return DataValue{Value: value, StatusCode: status, SourceTimestamp: now, ServerTimestamp: now}
+}
+
 // NilDataValue is the nil value.
 var NilDataValue = DataValue{}
+
+// Equal returns true if the values, the StatusCodes, and the timestamps selected by timestamps are equal.
+// TimestampsToReturnNeither compares no timestamps. Values are compared with EqualVariants.
+func (a DataValue) Equal(b DataValue, timestamps TimestampsToReturn) bool {
+	if a.StatusCode != b.StatusCode {
+		return false
+	}
+	if timestamps == TimestampsToReturnSource || timestamps == TimestampsToReturnBoth {
+		if !a.SourceTimestamp.Equal(b.SourceTimestamp) || a.SourcePicoseconds != b.SourcePicoseconds {
+			return false
+		}
+	}
+	if timestamps == TimestampsToReturnServer || timestamps == TimestampsToReturnBoth {
+		if !a.ServerTimestamp.Equal(b.ServerTimestamp) || a.ServerPicoseconds != b.ServerPicoseconds {
+			return false
+		}
+	}
+	return EqualVariants(a.Value, b.Value)
+}
+
+// EqualVariants returns true if the values have the same type and are equal. Slices, Matrices and
+// structures are compared element by element, times are compared as instants, and a NaN is equal to a
+// NaN. A nil and the explicit Null are equal.
+func EqualVariants(a, b Variant) bool {
+	if IsNull(a) || IsNull(b) {
+		return IsNull(a) && IsNull(b)
+	}
+	return equalValues(reflect.ValueOf(a), reflect.ValueOf(b))
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// equalValues returns true if the values have the same type and are equal.
+func equalValues(a, b reflect.Value) bool {
+	if a.Type() != b.Type() {
+		return false
+	}
+	switch a.Kind() {
+	case reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() && b.IsNil()
+		}
+		if a.CanInterface() && b.CanInterface() {
+			return EqualVariants(a.Interface(), b.Interface())
+		}
+		return equalValues(a.Elem(), b.Elem())
+	case reflect.Ptr:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() && b.IsNil()
+		}
+		return equalValues(a.Elem(), b.Elem())
+	case reflect.Slice:
+		if a.IsNil() != b.IsNil() {
+			return false
+		}
+		fallthrough
+	case reflect.Array:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !equalValues(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		if a.Type() == timeType && a.CanInterface() && b.CanInterface() {
+			return a.Interface().(time.Time).Equal(b.Interface().(time.Time))
+		}
+		for i := 0; i < a.NumField(); i++ {
+			if !equalValues(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Map:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for _, k := range a.MapKeys() {
+			v := b.MapIndex(k)
+			if !v.IsValid() || !equalValues(a.MapIndex(k), v) {
+				return false
+			}
+		}
+		return true
+	case reflect.Float32, reflect.Float64:
+		x, y := a.Float(), b.Float()
+		return x == y || (math.IsNaN(x) && math.IsNaN(y))
+	case reflect.Complex64, reflect.Complex128:
+		return a.Complex() == b.Complex()
+	case reflect.Bool:
+		return a.Bool() == b.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() == b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() == b.Uint()
+	case reflect.String:
+		return a.String() == b.String()
+	default:
+		return a.Pointer() == b.Pointer()
+	}
+}
+
+// AbsoluteDeadbandExceeded returns true if the numeric value of newValue differs from the value of
+// oldValue by more than the deadband. Arrays exceed the deadband if any element does, or if the lengths
+// differ. Values that are not numeric exceed the deadband if they are not equal. The StatusCodes and
+// timestamps are not compared.
+func AbsoluteDeadbandExceeded(oldValue, newValue DataValue, deadband float64) bool {
+	if IsNull(oldValue.Value) || IsNull(newValue.Value) {
+		return !(IsNull(oldValue.Value) && IsNull(newValue.Value))
+	}
+	if m, ok := newValue.Value.(Matrix); ok {
+		if n, ok := oldValue.Value.(Matrix); ok && EqualVariants(m.Dimensions, n.Dimensions) {
+			return AbsoluteDeadbandExceeded(DataValue{Value: n.Elements}, DataValue{Value: m.Elements}, deadband)
+		}
+		return true
+	}
+	return deadbandExceeded(reflect.ValueOf(oldValue.Value), reflect.ValueOf(newValue.Value), deadband)
+}
+
+// deadbandExceeded returns true if the numbers or the elements of the arrays differ by more than the deadband.
+func deadbandExceeded(a, b reflect.Value, deadband float64) bool {
+	if a.Type() != b.Type() {
+		return true
+	}
+	if a.Kind() == reflect.Interface && !a.IsNil() && !b.IsNil() {
+		return deadbandExceeded(a.Elem(), b.Elem(), deadband)
+	}
+	if k := a.Kind(); (k == reflect.Slice || k == reflect.Array) && a.Type().PkgPath() == "" {
+		if a.Len() != b.Len() {
+			return true
+		}
+		for i := 0; i < a.Len(); i++ {
+			if deadbandExceeded(a.Index(i), b.Index(i), deadband) {
+				return true
+			}
+		}
+		return false
+	}
+	if !isNumber(a.Type()) {
+		return !equalValues(a, b)
+	}
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return math.Abs(float64(a.Int())-float64(b.Int())) > deadband
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return math.Abs(float64(a.Uint())-float64(b.Uint())) > deadband
+	case reflect.Float32, reflect.Float64:
+		x, y := a.Float(), b.Float()
+		if math.IsNaN(x) || math.IsNaN(y) {
+			return !(math.IsNaN(x) && math.IsNaN(y))
+		}
+		return math.Abs(x-y) > deadband
+	default:
+		return !equalValues(a, b)
+	}
+}
+
+// isNumber returns true if the type is a built-in integer or floating point number. Named types,
+// such as StatusCode and enumerations, are not numbers.
+func isNumber(t reflect.Type) bool {
+	if t.PkgPath() != "" {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
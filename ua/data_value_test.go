@@ -0,0 +1,89 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package ua_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/awcullen/opcua/ua"
+	"gotest.tools/assert"
+)
+
+func TestGoodDataValue(t *testing.T) {
+	before := time.Now()
+	dv := ua.GoodDataValue(int32(42))
+	assert.Equal(t, dv.Value, int32(42))
+	assert.Equal(t, dv.StatusCode, ua.Good)
+	assert.Assert(t, !dv.SourceTimestamp.Before(before))
+	assert.Equal(t, dv.ServerTimestamp, dv.SourceTimestamp)
+
+	dv = ua.DataValueWithStatus(nil, ua.UncertainLastUsableValue)
+	assert.Equal(t, dv.StatusCode, ua.UncertainLastUsableValue)
+	assert.Assert(t, !dv.SourceTimestamp.IsZero())
+}
+
+func TestStatusCodeLimit(t *testing.T) {
+	c := ua.Good.WithLimit(ua.LimitBitsHigh)
+	assert.Assert(t, c.IsGood())
+	assert.Assert(t, c.IsLimitHigh())
+	assert.Equal(t, uint32(c)&ua.InfoTypeMask, ua.InfoTypeDataValue)
+
+	c = c.WithLimit(ua.LimitBitsLow)
+	assert.Assert(t, c.IsLimitLow())
+	assert.Assert(t, !c.IsLimitHigh())
+
+	// clearing the limit clears the info type.
+	assert.Equal(t, c.WithLimit(ua.LimitBitsNone), ua.Good)
+
+	// the overflow bit is retained.
+	c = ua.StatusCode(ua.InfoTypeDataValue | ua.Overflow).WithLimit(ua.LimitBitsConstant)
+	assert.Assert(t, c.IsLimitConstant())
+	assert.Assert(t, c.IsOverflow())
+	assert.Assert(t, c.WithLimit(ua.LimitBitsNone).IsOverflow())
+
+	// the limit bits of a StatusCode with another info type are not read.
+	assert.Equal(t, ua.StatusCode(0x00000300).Limit(), ua.LimitBitsNone)
+	assert.Equal(t, ua.UncertainLastUsableValue.WithLimit(ua.LimitBitsHigh).Limit(), ua.LimitBitsHigh)
+}
+
+func TestDataValueEqual(t *testing.T) {
+	now := time.Now()
+	a := ua.NewDataValue([]ua.Variant{int32(1), "a", []float64{1, math.NaN()}}, ua.Good, now, 0, now, 0)
+	b := ua.NewDataValue([]ua.Variant{int32(1), "a", []float64{1, math.NaN()}}, ua.Good, now.UTC(), 0, now.Add(time.Second), 0)
+	assert.Assert(t, a.Equal(b, ua.TimestampsToReturnSource))
+	assert.Assert(t, !a.Equal(b, ua.TimestampsToReturnServer))
+	assert.Assert(t, !a.Equal(b, ua.TimestampsToReturnBoth))
+	assert.Assert(t, a.Equal(b, ua.TimestampsToReturnNeither))
+
+	// the status, the types and the elements of slices are compared.
+	assert.Assert(t, !a.Equal(ua.DataValueWithStatus(a.Value, ua.BadNodeIDUnknown), ua.TimestampsToReturnNeither))
+	assert.Assert(t, !a.Equal(ua.NewDataValue([]ua.Variant{int32(1), "a", []float64{2, math.NaN()}}, ua.Good, now, 0, now, 0), ua.TimestampsToReturnNeither))
+	assert.Assert(t, !ua.EqualVariants(int32(1), int64(1)))
+	assert.Assert(t, !ua.EqualVariants([]int32{1}, []int32{1, 2}))
+	assert.Assert(t, ua.EqualVariants(nil, ua.Null{}))
+	assert.Assert(t, ua.EqualVariants(ua.LocalizedText{Text: "a"}, ua.LocalizedText{Text: "a"}))
+	assert.Assert(t, ua.EqualVariants(ua.Matrix{Elements: []time.Time{now}, Dimensions: []int32{1, 1}}, ua.Matrix{Elements: []time.Time{now.UTC()}, Dimensions: []int32{1, 1}}))
+}
+
+func TestAbsoluteDeadbandExceeded(t *testing.T) {
+	dv := func(v ua.Variant) ua.DataValue { return ua.GoodDataValue(v) }
+	assert.Assert(t, !ua.AbsoluteDeadbandExceeded(dv(int32(10)), dv(int32(12)), 2))
+	assert.Assert(t, ua.AbsoluteDeadbandExceeded(dv(int32(10)), dv(int32(13)), 2))
+	assert.Assert(t, !ua.AbsoluteDeadbandExceeded(dv(uint8(5)), dv(uint8(3)), 2))
+	assert.Assert(t, ua.AbsoluteDeadbandExceeded(dv(1.0), dv(math.NaN()), 2))
+	assert.Assert(t, !ua.AbsoluteDeadbandExceeded(dv(math.NaN()), dv(math.NaN()), 2))
+
+	// arrays exceed the deadband if any element does, or if the length changes.
+	assert.Assert(t, !ua.AbsoluteDeadbandExceeded(dv([]float32{1, 2}), dv([]float32{1.5, 2.5}), 0.5))
+	assert.Assert(t, ua.AbsoluteDeadbandExceeded(dv([]float32{1, 2}), dv([]float32{1, 3}), 0.5))
+	assert.Assert(t, ua.AbsoluteDeadbandExceeded(dv([]float32{1, 2}), dv([]float32{1}), 0.5))
+
+	// values of other types exceed the deadband if they are not equal.
+	assert.Assert(t, !ua.AbsoluteDeadbandExceeded(dv("a"), dv("a"), 1))
+	assert.Assert(t, ua.AbsoluteDeadbandExceeded(dv("a"), dv("b"), 1))
+	assert.Assert(t, ua.AbsoluteDeadbandExceeded(dv(ua.Good), dv(ua.StatusCode(1)), 1))
+	assert.Assert(t, ua.AbsoluteDeadbandExceeded(dv(int32(1)), dv(float64(1)), 1))
+	assert.Assert(t, !ua.AbsoluteDeadbandExceeded(dv(nil), dv(ua.Null{}), 1))
+}
@@ -0,0 +1,44 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package ua
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// ticksUnixEpoch is the number of seconds from January 1, 1601 to January 1, 1970.
+	ticksUnixEpoch = 11644473600
+	// ticksMax is the number of ticks at the end of December 31, 9999, the latest DateTime.
+	ticksMax = 2650467743990000000
+)
+
+// TimeToTicks returns the DateTime encoding of the time, i.e. the number of 100 nanosecond
+// intervals since January 1, 1601 (UTC). A zero time, or any time before 1601, returns 0,
+// the unspecified DateTime. Any time after December 31, 9999 returns math.MaxInt64.
+func TimeToTicks(value time.Time) int64 {
+	if value.IsZero() {
+		return 0
+	}
+	ticks := (value.Unix()+ticksUnixEpoch)*10000000 + int64(value.Nanosecond())/100
+	if ticks < 0 {
+		return 0
+	}
+	if ticks >= ticksMax {
+		return math.MaxInt64
+	}
+	return ticks
+}
+
+// TicksToTime returns the time of the DateTime encoding. A value of 0 or less, the unspecified
+// DateTime, returns the zero time. A value of math.MaxInt64 returns the end of December 31, 9999.
+func TicksToTime(ticks int64) time.Time {
+	if ticks <= 0 {
+		return time.Time{}
+	}
+	if ticks == math.MaxInt64 {
+		ticks = ticksMax
+	}
+	return time.Unix(ticks/10000000-ticksUnixEpoch, (ticks%10000000)*100).UTC()
+}
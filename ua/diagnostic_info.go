@@ -19,3 +19,17 @@ type DiagnosticInfo struct {
 	// InnerDiagnosticInfo returns the InnerDiagnosticInfo.
 	InnerDiagnosticInfo *DiagnosticInfo `json:",omitempty"`
 }
+
+// Bits of the ReturnDiagnostics mask of the RequestHeader that select the diagnostics returned by the server.
+const (
+	DiagnosticsServiceSymbolicID         uint32 = 0x0001
+	DiagnosticsServiceLocalizedText      uint32 = 0x0002
+	DiagnosticsServiceAdditionalInfo     uint32 = 0x0004
+	DiagnosticsServiceInnerStatusCode    uint32 = 0x0008
+	DiagnosticsServiceInnerDiagnostics   uint32 = 0x0010
+	DiagnosticsOperationSymbolicID       uint32 = 0x0020
+	DiagnosticsOperationLocalizedText    uint32 = 0x0040
+	DiagnosticsOperationAdditionalInfo   uint32 = 0x0080
+	DiagnosticsOperationInnerStatusCode  uint32 = 0x0100
+	DiagnosticsOperationInnerDiagnostics uint32 = 0x0200
+)
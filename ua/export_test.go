@@ -0,0 +1,11 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package ua
+
+// SetNativeLittleEndian sets the byte order assumed for the platform, so the tests may run the path
+// of big-endian platforms. Returns a func that restores the byte order.
+func SetNativeLittleEndian(v bool) func() {
+	old := nativeLittleEndian
+	nativeLittleEndian = v
+	return func() { nativeLittleEndian = old }
+}
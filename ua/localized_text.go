@@ -17,6 +17,17 @@ func NewLocalizedText(text, locale string) LocalizedText {
 	return LocalizedText{text, locale}
 }
 
+// WithLocale returns a copy of the LocalizedText with the given Locale string.
+func (a LocalizedText) WithLocale(locale string) LocalizedText {
+	a.Locale = locale
+	return a
+}
+
+// Equal returns true if both the text and Locale string are equal.
+func (a LocalizedText) Equal(b LocalizedText) bool {
+	return a.Text == b.Text && a.Locale == b.Locale
+}
+
 // String returns the string representation, e.g. "text (locale)"
 func (a LocalizedText) String() string {
 	if a.Locale == "" {
@@ -0,0 +1,21 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package ua_test
+
+import (
+	"testing"
+
+	"github.com/awcullen/opcua/ua"
+	"gotest.tools/assert"
+)
+
+func TestLocalizedTextHelpers(t *testing.T) {
+	a := ua.NewLocalizedText("bar", "")
+	assert.Equal(t, a.String(), "bar")
+	b := a.WithLocale("foo")
+	assert.Equal(t, a.Locale, "")
+	assert.Equal(t, b.String(), "bar (foo)")
+	assert.Assert(t, b.Equal(ua.NewLocalizedText("bar", "foo")))
+	assert.Assert(t, !b.Equal(a))
+	assert.Assert(t, !b.Equal(ua.NewLocalizedText("baz", "foo")))
+}
@@ -0,0 +1,74 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package ua
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+)
+
+// Keys of the attributes of the structured logs of the server and client.
+const (
+	LogKeySessionID      = "sessionId"
+	LogKeyChannelID      = "channelId"
+	LogKeySubscriptionID = "subscriptionId"
+	LogKeyService        = "service"
+	LogKeyStatusCode     = "statusCode"
+)
+
+// DiscardHandler is a slog.Handler that discards all records. It is the default handler of the
+// loggers of the server and client.
+type DiscardHandler struct{}
+
+// Enabled returns false.
+func (DiscardHandler) Enabled(context.Context, slog.Level) bool { return false }
+
+// Handle discards the record.
+func (DiscardHandler) Handle(context.Context, slog.Record) error { return nil }
+
+// WithAttrs returns the handler.
+func (h DiscardHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+// WithGroup returns the handler.
+func (h DiscardHandler) WithGroup(string) slog.Handler { return h }
+
+// SessionIDAttr returns the attribute of the SessionID, e.g. "ns=1;g=..."
+func SessionIDAttr(id NodeID) slog.Attr {
+	return slog.String(LogKeySessionID, fmt.Sprint(id))
+}
+
+// ChannelIDAttr returns the attribute of the SecureChannelID.
+func ChannelIDAttr(id uint32) slog.Attr {
+	return slog.Uint64(LogKeyChannelID, uint64(id))
+}
+
+// SubscriptionIDAttr returns the attribute of the SubscriptionID.
+func SubscriptionIDAttr(id uint32) slog.Attr {
+	return slog.Uint64(LogKeySubscriptionID, uint64(id))
+}
+
+// ServiceAttr returns the attribute of the service of the request, e.g. "Read".
+func ServiceAttr(req ServiceRequest) slog.Attr {
+	return slog.String(LogKeyService, ServiceName(req))
+}
+
+// ServiceName returns the name of the service of the request, e.g. "Read".
+func ServiceName(req ServiceRequest) string {
+	t := reflect.TypeOf(req)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return strings.TrimSuffix(t.Name(), "Request")
+}
+
+// StatusCodeAttr returns the attribute of the status of an error, e.g. "0x80340000". If the error
+// is not a StatusCode, the attribute is the error message.
+func StatusCodeAttr(err error) slog.Attr {
+	if c, ok := err.(StatusCode); ok {
+		return slog.String(LogKeyStatusCode, fmt.Sprintf("0x%08X", uint32(c)))
+	}
+	return slog.String(LogKeyStatusCode, err.Error())
+}
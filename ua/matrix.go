@@ -0,0 +1,89 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package ua
+
+import (
+	"reflect"
+)
+
+// Matrix stores a multi-dimensional array in a Variant. The elements are stored in a slice of one
+// of the Variant types, e.g. []float64, in the order of the binary encoding: the last dimension
+// varies fastest. For example, a matrix with Dimensions [2 3] stores the element [i, j] at
+// Elements[i*3+j].
+type Matrix struct {
+	Elements   interface{}
+	Dimensions []int32
+}
+
+// NewMatrix returns a Matrix of the elements with the given dimensions.
+// Returns BadTypeMismatch if elements is not a slice, or if the number of elements is not the
+// product of the dimensions.
+func NewMatrix(elements interface{}, dimensions []int32) (Matrix, error) {
+	m := Matrix{Elements: elements, Dimensions: dimensions}
+	if err := m.Validate(); err != nil {
+		return Matrix{}, err
+	}
+	return m, nil
+}
+
+// Validate returns BadTypeMismatch if the Elements is not a slice, if a dimension is negative,
+// or if the number of elements is not the product of the dimensions.
+func (m Matrix) Validate() error {
+	v := reflect.ValueOf(m.Elements)
+	if v.Kind() != reflect.Slice || v.Type() == reflect.TypeOf(ByteString("")) {
+		return BadTypeMismatch
+	}
+	if len(m.Dimensions) == 0 {
+		return BadTypeMismatch
+	}
+	n := 1
+	for _, d := range m.Dimensions {
+		if d < 0 {
+			return BadTypeMismatch
+		}
+		n *= int(d)
+	}
+	if v.Len() != n {
+		return BadTypeMismatch
+	}
+	return nil
+}
+
+// Len returns the number of elements of the matrix.
+func (m Matrix) Len() int {
+	v := reflect.ValueOf(m.Elements)
+	if v.Kind() != reflect.Slice {
+		return 0
+	}
+	return v.Len()
+}
+
+// Index returns the position in Elements of the element at the given indexes, one for each
+// dimension. Returns false if the number of indexes does not match the dimensions, or if an
+// index is out of range.
+func (m Matrix) Index(indexes ...int) (int, bool) {
+	if len(indexes) != len(m.Dimensions) {
+		return 0, false
+	}
+	i := 0
+	for k, d := range m.Dimensions {
+		if indexes[k] < 0 || indexes[k] >= int(d) {
+			return 0, false
+		}
+		i = i*int(d) + indexes[k]
+	}
+	if i >= m.Len() {
+		return 0, false
+	}
+	return i, true
+}
+
+// At returns the element at the given indexes, one for each dimension, e.g. m.At(1, 2).
+// Returns false if the indexes are out of range.
+func (m Matrix) At(indexes ...int) (interface{}, bool) {
+	i, ok := m.Index(indexes...)
+	if !ok {
+		return nil, false
+	}
+	return reflect.ValueOf(m.Elements).Index(i).Interface(), true
+}
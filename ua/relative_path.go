@@ -0,0 +1,71 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package ua
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ParseRelativePath returns a RelativePath from a string, e.g. ParseRelativePath("/2:DeviceSet/2:Motor/2:Speed").
+// Each element is preceded by '/', which follows hierarchical references (and subtypes) in the forward
+// direction. The leading '/' may be omitted. The target name of each element takes the form
+// "namespaceIndex:name", where the namespace index defaults to 0. The reserved characters '/', ':' and '&'
+// may be included in a name by escaping them with '&'. See part4 Annex A.2.
+func ParseRelativePath(s string) (RelativePath, error) {
+	elements := []RelativePathElement{}
+	if len(s) == 0 {
+		return RelativePath{Elements: elements}, nil
+	}
+	if s[0] == '/' {
+		s = s[1:]
+	}
+	var b strings.Builder
+	ns := uint16(0)
+	hasNs := false
+	appendElement := func() error {
+		if b.Len() == 0 {
+			return BadBrowseNameInvalid
+		}
+		elements = append(elements, RelativePathElement{
+			ReferenceTypeID: ReferenceTypeIDHierarchicalReferences,
+			IncludeSubtypes: true,
+			TargetName:      QualifiedName{NamespaceIndex: ns, Name: b.String()},
+		})
+		b.Reset()
+		ns = 0
+		hasNs = false
+		return nil
+	}
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '&':
+			i++
+			if i == len(s) {
+				return RelativePath{}, BadSyntaxError
+			}
+			b.WriteByte(s[i])
+		case '/':
+			if err := appendElement(); err != nil {
+				return RelativePath{}, err
+			}
+		case ':':
+			if hasNs {
+				return RelativePath{}, BadBrowseNameInvalid
+			}
+			v, err := strconv.ParseUint(b.String(), 10, 16)
+			if err != nil {
+				return RelativePath{}, BadBrowseNameInvalid
+			}
+			ns = uint16(v)
+			hasNs = true
+			b.Reset()
+		default:
+			b.WriteByte(c)
+		}
+	}
+	if err := appendElement(); err != nil {
+		return RelativePath{}, err
+	}
+	return RelativePath{Elements: elements}, nil
+}
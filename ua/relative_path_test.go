@@ -0,0 +1,33 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package ua_test
+
+import (
+	"testing"
+
+	"github.com/awcullen/opcua/ua"
+	"gotest.tools/assert"
+)
+
+func TestParseRelativePath(t *testing.T) {
+	p, err := ua.ParseRelativePath("/2:DeviceSet/2:Motor/Speed")
+	assert.NilError(t, err)
+	assert.Equal(t, len(p.Elements), 3)
+	assert.Equal(t, p.Elements[0].TargetName, ua.NewQualifiedName(2, "DeviceSet"))
+	assert.Equal(t, p.Elements[1].TargetName, ua.NewQualifiedName(2, "Motor"))
+	assert.Equal(t, p.Elements[2].TargetName, ua.NewQualifiedName(0, "Speed"))
+	assert.Equal(t, p.Elements[0].ReferenceTypeID, ua.ReferenceTypeIDHierarchicalReferences)
+	assert.Assert(t, p.Elements[0].IncludeSubtypes)
+
+	p, err = ua.ParseRelativePath("2:Demo/3:A&/B&:C")
+	assert.NilError(t, err)
+	assert.Equal(t, len(p.Elements), 2)
+	assert.Equal(t, p.Elements[1].TargetName, ua.NewQualifiedName(3, "A/B:C"))
+
+	_, err = ua.ParseRelativePath("/2:Demo//Static")
+	assert.Equal(t, err, ua.BadBrowseNameInvalid)
+	_, err = ua.ParseRelativePath("/x:Demo")
+	assert.Equal(t, err, ua.BadBrowseNameInvalid)
+	_, err = ua.ParseRelativePath("/2:Demo&")
+	assert.Equal(t, err, ua.BadSyntaxError)
+}
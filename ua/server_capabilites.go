@@ -1,6 +1,7 @@
 package ua
 
-// ServerCapabilities contains the server capabilities.
+// ServerCapabilities contains the server capabilities. A MaxStringLength, MaxArrayLength or
+// MaxByteStringLength of 0 means no limit.
 type ServerCapabilities struct {
 	LocaleIDArray                []string
 	MaxStringLength              uint32
@@ -18,19 +19,19 @@ type ServerCapabilities struct {
 func NewServerCapabilities() *ServerCapabilities {
 	return &ServerCapabilities{
 		LocaleIDArray:                []string{"en"},
-		MaxStringLength:              4096,
-		MaxArrayLength:               4096,
-		MaxByteStringLength:          4096,
+		MaxStringLength:              0,
+		MaxArrayLength:               0,
+		MaxByteStringLength:          0,
 		MaxBrowseContinuationPoints:  10,
 		MaxHistoryContinuationPoints: 100,
-		MaxQueryContinuationPoints:   0,
+		MaxQueryContinuationPoints:   10,
 		MinSupportedSampleRate:       100,
-		ServerProfileArray:           []string{"http://opcfoundation.org/UA-Profile/Server/StandardUA2017", "http://opcfoundation.org/UAProfile/Server/Methods"},
+		ServerProfileArray:           []string{ServerProfileURIStandardUA2017, ServerProfileURIMethods},
 		OperationLimits:              NewOperationLimits(),
 	}
 }
 
-// OperationLimits contains the server's operation limits.
+// OperationLimits contains the server's operation limits. A limit of 0 means no limit.
 type OperationLimits struct {
 	MaxNodesPerRead                          uint32
 	MaxNodesPerHistoryReadData               uint32
@@ -0,0 +1,15 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package ua
+
+// ServerProfileURIs
+const (
+	ServerProfileURIStandardUA2017            = "http://opcfoundation.org/UA-Profile/Server/StandardUA2017"
+	ServerProfileURIEmbeddedUA2017            = "http://opcfoundation.org/UA-Profile/Server/EmbeddedUA2017"
+	ServerProfileURIMicroEmbeddedDevice2017   = "http://opcfoundation.org/UA-Profile/Server/MicroEmbeddedDevice2017"
+	ServerProfileURINanoEmbeddedDevice2017    = "http://opcfoundation.org/UA-Profile/Server/NanoEmbeddedDevice2017"
+	ServerProfileURIMethods                   = "http://opcfoundation.org/UA-Profile/Server/Methods"
+	ServerProfileURIStandardEventSubscription = "http://opcfoundation.org/UA-Profile/Server/StandardEventSubscription"
+	ServerProfileURIHistoricalRawData         = "http://opcfoundation.org/UA-Profile/Server/HistoricalRawData"
+	ServerProfileURINodeManagement            = "http://opcfoundation.org/UA-Profile/Server/NodeManagement"
+)
@@ -12,6 +12,23 @@ func (h *RequestHeader) Header() *RequestHeader {
 	return h
 }
 
+// AdditionalParameterTransactional is the key of a parameter of the AdditionalHeader of a WriteRequest.
+// If the value is true, the server writes all values or, if any value fails, none.
+const AdditionalParameterTransactional = "Transactional"
+
+// AdditionalParameter returns the value of the parameter with the key, and true if the AdditionalHeader
+// is an AdditionalParametersType with the parameter.
+func (h *RequestHeader) AdditionalParameter(key string) (Variant, bool) {
+	if p, ok := h.AdditionalHeader.(AdditionalParametersType); ok {
+		for _, kv := range p.Parameters {
+			if kv.Key.Name == key {
+				return kv.Value, true
+			}
+		}
+	}
+	return nil, false
+}
+
 // ServiceResponse is a response from a service.
 type ServiceResponse interface {
 	Header() *ResponseHeader
@@ -30,11 +30,50 @@ func (c StatusCode) IsSemanticsChanged() bool {
 	return (uint32(c) & SemanticsChanged) == SemanticsChanged
 }
 
-// IsOverflow returns true if the data value has exceeded the limits of the data type.
+// IsOverflow returns true if values were discarded from the queue of the monitored item that reported this data value.
 func (c StatusCode) IsOverflow() bool {
 	return ((uint32(c) & InfoTypeMask) == InfoTypeDataValue) && ((uint32(c) & Overflow) == Overflow)
 }
 
+// Limit returns the limit bits of the data value, one of LimitBitsNone, LimitBitsLow, LimitBitsHigh or LimitBitsConstant.
+func (c StatusCode) Limit() uint32 {
+	if (uint32(c) & InfoTypeMask) != InfoTypeDataValue {
+		return LimitBitsNone
+	}
+	return uint32(c) & LimitBitsMask
+}
+
+// IsLimitLow returns true if the data value is at its low limit.
+func (c StatusCode) IsLimitLow() bool {
+	return c.Limit() == LimitBitsLow
+}
+
+// IsLimitHigh returns true if the data value is at its high limit.
+func (c StatusCode) IsLimitHigh() bool {
+	return c.Limit() == LimitBitsHigh
+}
+
+// IsLimitConstant returns true if the data value is constant and cannot change.
+func (c StatusCode) IsLimitConstant() bool {
+	return c.Limit() == LimitBitsConstant
+}
+
+// WithLimit returns the StatusCode with the limit bits set to limit, one of LimitBitsNone, LimitBitsLow,
+// LimitBitsHigh or LimitBitsConstant. The InfoType is set to DataValue, or cleared if no info bits remain.
+func (c StatusCode) WithLimit(limit uint32) StatusCode {
+	v := uint32(c)
+	if (v & InfoTypeMask) != InfoTypeDataValue {
+		v &^= InfoTypeMask | InfoBitsMask
+	}
+	v = (v &^ LimitBitsMask) | (limit & LimitBitsMask)
+	if (v & InfoBitsMask) != 0 {
+		v |= InfoTypeDataValue
+	} else {
+		v &^= InfoTypeMask
+	}
+	return StatusCode(v)
+}
+
 const (
 	// Good - The operation completed successfully.
 	Good StatusCode = 0x00000000
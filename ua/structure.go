@@ -0,0 +1,888 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package ua
+
+import (
+	"bytes"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Structure is the value of a structured DataType that has no Go type, but a registered StructureDefinition.
+// The Fields hold the values in the order of the fields of the definition. The value of an absent
+// optional field, and of every field of a union except the selected one, is nil.
+type Structure struct {
+	DataTypeID ExpandedNodeID
+	Fields     []Variant
+}
+
+// structureType is the registered definition of a structured DataType.
+type structureType struct {
+	dataTypeID    ExpandedNodeID
+	encodingID    ExpandedNodeID
+	structureType StructureType
+	fields        []StructureField
+	fieldTypes    []ExpandedNodeID
+}
+
+var (
+	structureTypes        sync.Map // map[ExpandedNodeID]*structureType, by DataType id
+	structureEncodingIDs  sync.Map // map[ExpandedNodeID]*structureType, by binary encoding id
+	enumerationDataTypes  sync.Map // map[ExpandedNodeID]EnumDefinition, by DataType id
+	typeStructure         = reflect.TypeOf(Structure{})
+	wellKnownBuiltinTypes = map[ExpandedNodeID]byte{
+		NewExpandedNodeID(DataTypeIDNumber):                         VariantTypeVariant,
+		NewExpandedNodeID(DataTypeIDInteger):                        VariantTypeVariant,
+		NewExpandedNodeID(DataTypeIDUInteger):                       VariantTypeVariant,
+		NewExpandedNodeID(DataTypeIDEnumeration):                    VariantTypeInt32,
+		NewExpandedNodeID(DataTypeIDImage):                          VariantTypeByteString,
+		NewExpandedNodeID(DataTypeIDIntegerID):                      VariantTypeUInt32,
+		NewExpandedNodeID(DataTypeIDCounter):                        VariantTypeUInt32,
+		NewExpandedNodeID(DataTypeIDDuration):                       VariantTypeDouble,
+		NewExpandedNodeID(DataTypeIDNumericRange):                   VariantTypeString,
+		NewExpandedNodeID(DataTypeIDUtcTime):                        VariantTypeDateTime,
+		NewExpandedNodeID(DataTypeIDLocaleID):                       VariantTypeString,
+		NewExpandedNodeID(DataTypeIDApplicationInstanceCertificate): VariantTypeByteString,
+	}
+)
+
+// RegisterStructureDefinition registers the StructureDefinition of the DataType with the BinaryEncoder and
+// BinaryDecoder, so ExtensionObjects with the DefaultEncodingID of the definition are decoded as a Structure,
+// and a Structure of the DataType is encoded using the fields of the definition. The NodeIDs of the definition
+// are resolved using the namespaceURIs. Registering a DataType again replaces the definition.
+func RegisterStructureDefinition(dataTypeID ExpandedNodeID, definition StructureDefinition, namespaceURIs []string) {
+	t := &structureType{
+		dataTypeID:    dataTypeID,
+		encodingID:    ToExpandedNodeID(definition.DefaultEncodingID, namespaceURIs),
+		structureType: definition.StructureType,
+		fields:        definition.Fields,
+		fieldTypes:    make([]ExpandedNodeID, len(definition.Fields)),
+	}
+	for i, f := range definition.Fields {
+		t.fieldTypes[i] = ToExpandedNodeID(f.DataType, namespaceURIs)
+	}
+	structureTypes.Store(dataTypeID, t)
+	if !IsNull(t.encodingID.NodeID) {
+		structureEncodingIDs.Store(t.encodingID, t)
+	}
+}
+
+// RegisterEnumDefinition registers the EnumDefinition of the DataType, so fields of the DataType are encoded as Int32.
+func RegisterEnumDefinition(dataTypeID ExpandedNodeID, definition EnumDefinition) {
+	enumerationDataTypes.Store(dataTypeID, definition)
+}
+
+// FindStructureDefinition finds the registered StructureDefinition of the DataType.
+func FindStructureDefinition(dataTypeID ExpandedNodeID) (StructureDefinition, bool) {
+	val, ok := structureTypes.Load(dataTypeID)
+	if !ok {
+		return StructureDefinition{}, false
+	}
+	t := val.(*structureType)
+	return StructureDefinition{
+		DefaultEncodingID: t.encodingID.NodeID,
+		StructureType:     t.structureType,
+		Fields:            t.fields,
+	}, true
+}
+
+// findStructureType finds the registered definition of the DataType.
+func findStructureType(dataTypeID ExpandedNodeID) (*structureType, bool) {
+	if val, ok := structureTypes.Load(dataTypeID); ok {
+		return val.(*structureType), true
+	}
+	return nil, false
+}
+
+// findStructureTypeForBinaryEncodingID finds the registered definition of the DataType with the BinaryEncodingID.
+func findStructureTypeForBinaryEncodingID(id ExpandedNodeID) (*structureType, bool) {
+	if val, ok := structureEncodingIDs.Load(id); ok {
+		return val.(*structureType), true
+	}
+	return nil, false
+}
+
+// builtinTypeOf returns the builtin type that encodes values of the DataType.
+func builtinTypeOf(dataTypeID ExpandedNodeID) (byte, bool) {
+	if dataTypeID.ServerIndex == 0 && dataTypeID.NamespaceURI == "" {
+		if id, ok := dataTypeID.NodeID.(NodeIDNumeric); ok && id.NamespaceIndex == 0 && id.ID >= 1 && id.ID <= 25 {
+			return byte(id.ID), true
+		}
+	}
+	if b, ok := wellKnownBuiltinTypes[dataTypeID]; ok {
+		return b, true
+	}
+	if _, ok := enumerationDataTypes.Load(dataTypeID); ok {
+		return VariantTypeInt32, true
+	}
+	return 0, false
+}
+
+// goType returns the registered Go type of the structured DataType, else the Structure type.
+func (t *structureType) goType() reflect.Type {
+	if typ, ok := FindTypeForBinaryEncodingID(t.encodingID); ok {
+		return typ
+	}
+	return typeStructure
+}
+
+// writeStructure writes the fields of a structure.
+func (enc *BinaryEncoder) writeStructure(t *structureType, value Structure) error {
+	if len(value.Fields) != len(t.fields) {
+		return BadEncodingError
+	}
+	switch t.structureType {
+	case StructureTypeStructureWithOptionalFields:
+		var mask uint32
+		var bit uint
+		for i, f := range t.fields {
+			if f.IsOptional {
+				if value.Fields[i] != nil {
+					mask |= 1 << bit
+				}
+				bit++
+			}
+		}
+		if err := enc.WriteUInt32(mask); err != nil {
+			return BadEncodingError
+		}
+		for i, f := range t.fields {
+			if f.IsOptional && value.Fields[i] == nil {
+				continue
+			}
+			if err := enc.writeField(t.fieldTypes[i], f.ValueRank, value.Fields[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case StructureTypeUnion:
+		for i, f := range t.fields {
+			if value.Fields[i] == nil {
+				continue
+			}
+			if err := enc.WriteUInt32(uint32(i + 1)); err != nil {
+				return BadEncodingError
+			}
+			return enc.writeField(t.fieldTypes[i], f.ValueRank, value.Fields[i])
+		}
+		return enc.WriteUInt32(0)
+	default:
+		for i, f := range t.fields {
+			if err := enc.writeField(t.fieldTypes[i], f.ValueRank, value.Fields[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// readStructure reads the fields of a structure.
+func (dec *BinaryDecoder) readStructure(t *structureType, value *Structure) error {
+	fields := make([]Variant, len(t.fields))
+	switch t.structureType {
+	case StructureTypeStructureWithOptionalFields:
+		var mask uint32
+		if err := dec.ReadUInt32(&mask); err != nil {
+			return BadDecodingError
+		}
+		var bit uint
+		for i, f := range t.fields {
+			if f.IsOptional {
+				present := mask&(1<<bit) != 0
+				bit++
+				if !present {
+					continue
+				}
+			}
+			if err := dec.readField(t.fieldTypes[i], f.ValueRank, &fields[i]); err != nil {
+				return err
+			}
+		}
+	case StructureTypeUnion:
+		var sw uint32
+		if err := dec.ReadUInt32(&sw); err != nil {
+			return BadDecodingError
+		}
+		if sw > uint32(len(t.fields)) {
+			return BadDecodingError
+		}
+		if sw > 0 {
+			if err := dec.readField(t.fieldTypes[sw-1], t.fields[sw-1].ValueRank, &fields[sw-1]); err != nil {
+				return err
+			}
+		}
+	default:
+		for i, f := range t.fields {
+			if err := dec.readField(t.fieldTypes[i], f.ValueRank, &fields[i]); err != nil {
+				return err
+			}
+		}
+	}
+	*value = Structure{DataTypeID: t.dataTypeID, Fields: fields}
+	return nil
+}
+
+// writeField writes the value of a field with the DataType and ValueRank. Only scalars and
+// one-dimensional arrays are supported.
+func (enc *BinaryEncoder) writeField(dataTypeID ExpandedNodeID, valueRank int32, value Variant) error {
+	isArray := valueRank == ValueRankOneDimension
+	if !isArray && valueRank != ValueRankScalar {
+		return BadEncodingError
+	}
+	if b, ok := builtinTypeOf(dataTypeID); ok {
+		return enc.writeBuiltin(b, isArray, value)
+	}
+	t, ok := findStructureType(dataTypeID)
+	if !ok {
+		return BadEncodingError
+	}
+	if !isArray {
+		return enc.writeNested(t, value)
+	}
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice {
+		if value == nil {
+			return enc.WriteInt32(-1)
+		}
+		return BadEncodingError
+	}
+	if v.IsNil() {
+		return enc.WriteInt32(-1)
+	}
+	if err := enc.WriteInt32(int32(v.Len())); err != nil {
+		return BadEncodingError
+	}
+	for i := 0; i < v.Len(); i++ {
+		if err := enc.writeNested(t, v.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeNested writes the value of a field with a structured DataType, either a Structure or the registered Go type.
+func (enc *BinaryEncoder) writeNested(t *structureType, value Variant) error {
+	if s, ok := value.(Structure); ok {
+		return enc.writeStructure(t, s)
+	}
+	if value == nil || reflect.TypeOf(value) != t.goType() {
+		return BadEncodingError
+	}
+	if err := enc.Encode(value); err != nil {
+		return BadEncodingError
+	}
+	return nil
+}
+
+// readField reads the value of a field with the DataType and ValueRank.
+func (dec *BinaryDecoder) readField(dataTypeID ExpandedNodeID, valueRank int32, value *Variant) error {
+	isArray := valueRank == ValueRankOneDimension
+	if !isArray && valueRank != ValueRankScalar {
+		return BadDecodingError
+	}
+	if b, ok := builtinTypeOf(dataTypeID); ok {
+		return dec.readBuiltin(b, isArray, value)
+	}
+	t, ok := findStructureType(dataTypeID)
+	if !ok {
+		return BadDecodingError
+	}
+	typ := t.goType()
+	if !isArray {
+		v, err := dec.readNested(t, typ)
+		if err != nil {
+			return err
+		}
+		*value = v
+		return nil
+	}
+	var n int32
+	if err := dec.ReadInt32(&n); err != nil {
+		return BadDecodingError
+	}
+	if n < 0 {
+		*value = reflect.Zero(reflect.SliceOf(typ)).Interface()
+		return nil
+	}
+	if err := dec.checkLength(n, dec.limits.MaxArrayLength); err != nil {
+		return err
+	}
+	temp := reflect.MakeSlice(reflect.SliceOf(typ), int(n), int(n))
+	for i := 0; i < int(n); i++ {
+		v, err := dec.readNested(t, typ)
+		if err != nil {
+			return err
+		}
+		temp.Index(i).Set(reflect.ValueOf(v))
+	}
+	*value = temp.Interface()
+	return nil
+}
+
+// readNested reads the value of a field with a structured DataType, either a Structure or the registered Go type.
+func (dec *BinaryDecoder) readNested(t *structureType, typ reflect.Type) (Variant, error) {
+	if typ == typeStructure {
+		var s Structure
+		if err := dec.readStructure(t, &s); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	obj := reflect.New(typ)
+	if err := dec.Decode(obj.Interface()); err != nil {
+		return nil, BadDecodingError
+	}
+	return obj.Elem().Interface(), nil
+}
+
+// readStructureBody reads the body of an ExtensionObject with the definition of the structure.
+func (dec *BinaryDecoder) readStructureBody(t *structureType, value *ExtensionObject) error {
+	var body []byte
+	if err := dec.readBytes(&body, dec.limits.MaxByteStringLength); err != nil {
+		return BadDecodingError
+	}
+	dec2 := NewBinaryDecoder(bytes.NewReader(body), dec.ec)
+	dec2.limits = dec.limits
+	var s Structure
+	if err := dec2.readStructure(t, &s); err != nil {
+		return err
+	}
+	*value = s
+	return nil
+}
+
+// writeBuiltin writes the value of a field with the builtin type. Returns BadEncodingError if the
+// value is not of the Go type of the builtin type. A nil array is written as a null array.
+func (enc *BinaryEncoder) writeBuiltin(b byte, isArray bool, value Variant) error {
+	var err error
+	if isArray {
+		switch b {
+		case VariantTypeBoolean:
+			v, ok := value.([]bool)
+			if !ok && value != nil {
+				return BadEncodingError
+			}
+			err = enc.WriteBooleanArray(v)
+		case VariantTypeSByte:
+			v, ok := value.([]int8)
+			if !ok && value != nil {
+				return BadEncodingError
+			}
+			err = enc.WriteSByteArray(v)
+		case VariantTypeByte:
+			v, ok := value.([]byte)
+			if !ok && value != nil {
+				return BadEncodingError
+			}
+			err = enc.WriteByteArray(v)
+		case VariantTypeInt16:
+			v, ok := value.([]int16)
+			if !ok && value != nil {
+				return BadEncodingError
+			}
+			err = enc.WriteInt16Array(v)
+		case VariantTypeUInt16:
+			v, ok := value.([]uint16)
+			if !ok && value != nil {
+				return BadEncodingError
+			}
+			err = enc.WriteUInt16Array(v)
+		case VariantTypeInt32:
+			v, ok := value.([]int32)
+			if !ok && value != nil {
+				return BadEncodingError
+			}
+			err = enc.WriteInt32Array(v)
+		case VariantTypeUInt32:
+			v, ok := value.([]uint32)
+			if !ok && value != nil {
+				return BadEncodingError
+			}
+			err = enc.WriteUInt32Array(v)
+		case VariantTypeInt64:
+			v, ok := value.([]int64)
+			if !ok && value != nil {
+				return BadEncodingError
+			}
+			err = enc.WriteInt64Array(v)
+		case VariantTypeUInt64:
+			v, ok := value.([]uint64)
+			if !ok && value != nil {
+				return BadEncodingError
+			}
+			err = enc.WriteUInt64Array(v)
+		case VariantTypeFloat:
+			v, ok := value.([]float32)
+			if !ok && value != nil {
+				return BadEncodingError
+			}
+			err = enc.WriteFloatArray(v)
+		case VariantTypeDouble:
+			v, ok := value.([]float64)
+			if !ok && value != nil {
+				return BadEncodingError
+			}
+			err = enc.WriteDoubleArray(v)
+		case VariantTypeString:
+			v, ok := value.([]string)
+			if !ok && value != nil {
+				return BadEncodingError
+			}
+			err = enc.WriteStringArray(v)
+		case VariantTypeDateTime:
+			v, ok := value.([]time.Time)
+			if !ok && value != nil {
+				return BadEncodingError
+			}
+			err = enc.WriteDateTimeArray(v)
+		case VariantTypeGUID:
+			v, ok := value.([]uuid.UUID)
+			if !ok && value != nil {
+				return BadEncodingError
+			}
+			err = enc.WriteGUIDArray(v)
+		case VariantTypeByteString:
+			v, ok := value.([]ByteString)
+			if !ok && value != nil {
+				return BadEncodingError
+			}
+			err = enc.WriteByteStringArray(v)
+		case VariantTypeXMLElement:
+			v, ok := value.([]XMLElement)
+			if !ok && value != nil {
+				return BadEncodingError
+			}
+			err = enc.WriteXMLElementArray(v)
+		case VariantTypeNodeID:
+			v, ok := value.([]NodeID)
+			if !ok && value != nil {
+				return BadEncodingError
+			}
+			err = enc.WriteNodeIDArray(v)
+		case VariantTypeExpandedNodeID:
+			v, ok := value.([]ExpandedNodeID)
+			if !ok && value != nil {
+				return BadEncodingError
+			}
+			err = enc.WriteExpandedNodeIDArray(v)
+		case VariantTypeStatusCode:
+			v, ok := value.([]StatusCode)
+			if !ok && value != nil {
+				return BadEncodingError
+			}
+			err = enc.WriteStatusCodeArray(v)
+		case VariantTypeQualifiedName:
+			v, ok := value.([]QualifiedName)
+			if !ok && value != nil {
+				return BadEncodingError
+			}
+			err = enc.WriteQualifiedNameArray(v)
+		case VariantTypeLocalizedText:
+			v, ok := value.([]LocalizedText)
+			if !ok && value != nil {
+				return BadEncodingError
+			}
+			err = enc.WriteLocalizedTextArray(v)
+		case VariantTypeExtensionObject:
+			v, ok := value.([]ExtensionObject)
+			if !ok && value != nil {
+				return BadEncodingError
+			}
+			err = enc.WriteExtensionObjectArray(v)
+		case VariantTypeDataValue:
+			v, ok := value.([]DataValue)
+			if !ok && value != nil {
+				return BadEncodingError
+			}
+			err = enc.WriteDataValueArray(v)
+		case VariantTypeVariant:
+			v, ok := value.([]Variant)
+			if !ok && value != nil {
+				return BadEncodingError
+			}
+			err = enc.WriteVariantArray(v)
+		case VariantTypeDiagnosticInfo:
+			v, ok := value.([]DiagnosticInfo)
+			if !ok && value != nil {
+				return BadEncodingError
+			}
+			err = enc.WriteDiagnosticInfoArray(v)
+		default:
+			return BadEncodingError
+		}
+		if err != nil {
+			return BadEncodingError
+		}
+		return nil
+	}
+	switch b {
+	case VariantTypeBoolean:
+		v, ok := value.(bool)
+		if !ok {
+			return BadEncodingError
+		}
+		err = enc.WriteBoolean(v)
+	case VariantTypeSByte:
+		v, ok := value.(int8)
+		if !ok {
+			return BadEncodingError
+		}
+		err = enc.WriteSByte(v)
+	case VariantTypeByte:
+		v, ok := value.(byte)
+		if !ok {
+			return BadEncodingError
+		}
+		err = enc.WriteByte(v)
+	case VariantTypeInt16:
+		v, ok := value.(int16)
+		if !ok {
+			return BadEncodingError
+		}
+		err = enc.WriteInt16(v)
+	case VariantTypeUInt16:
+		v, ok := value.(uint16)
+		if !ok {
+			return BadEncodingError
+		}
+		err = enc.WriteUInt16(v)
+	case VariantTypeInt32:
+		v, ok := value.(int32)
+		if !ok {
+			return BadEncodingError
+		}
+		err = enc.WriteInt32(v)
+	case VariantTypeUInt32:
+		v, ok := value.(uint32)
+		if !ok {
+			return BadEncodingError
+		}
+		err = enc.WriteUInt32(v)
+	case VariantTypeInt64:
+		v, ok := value.(int64)
+		if !ok {
+			return BadEncodingError
+		}
+		err = enc.WriteInt64(v)
+	case VariantTypeUInt64:
+		v, ok := value.(uint64)
+		if !ok {
+			return BadEncodingError
+		}
+		err = enc.WriteUInt64(v)
+	case VariantTypeFloat:
+		v, ok := value.(float32)
+		if !ok {
+			return BadEncodingError
+		}
+		err = enc.WriteFloat(v)
+	case VariantTypeDouble:
+		v, ok := value.(float64)
+		if !ok {
+			return BadEncodingError
+		}
+		err = enc.WriteDouble(v)
+	case VariantTypeString:
+		v, ok := value.(string)
+		if !ok {
+			return BadEncodingError
+		}
+		err = enc.WriteString(v)
+	case VariantTypeDateTime:
+		v, ok := value.(time.Time)
+		if !ok {
+			return BadEncodingError
+		}
+		err = enc.WriteDateTime(v)
+	case VariantTypeGUID:
+		v, ok := value.(uuid.UUID)
+		if !ok {
+			return BadEncodingError
+		}
+		err = enc.WriteGUID(v)
+	case VariantTypeByteString:
+		v, ok := value.(ByteString)
+		if !ok {
+			return BadEncodingError
+		}
+		err = enc.WriteByteString(v)
+	case VariantTypeXMLElement:
+		v, ok := value.(XMLElement)
+		if !ok {
+			return BadEncodingError
+		}
+		err = enc.WriteXMLElement(v)
+	case VariantTypeNodeID:
+		v, ok := value.(NodeID)
+		if !ok {
+			return BadEncodingError
+		}
+		err = enc.WriteNodeID(v)
+	case VariantTypeExpandedNodeID:
+		v, ok := value.(ExpandedNodeID)
+		if !ok {
+			return BadEncodingError
+		}
+		err = enc.WriteExpandedNodeID(v)
+	case VariantTypeStatusCode:
+		v, ok := value.(StatusCode)
+		if !ok {
+			return BadEncodingError
+		}
+		err = enc.WriteStatusCode(v)
+	case VariantTypeQualifiedName:
+		v, ok := value.(QualifiedName)
+		if !ok {
+			return BadEncodingError
+		}
+		err = enc.WriteQualifiedName(v)
+	case VariantTypeLocalizedText:
+		v, ok := value.(LocalizedText)
+		if !ok {
+			return BadEncodingError
+		}
+		err = enc.WriteLocalizedText(v)
+	case VariantTypeExtensionObject:
+		err = enc.WriteExtensionObject(value)
+	case VariantTypeDataValue:
+		v, ok := value.(DataValue)
+		if !ok {
+			return BadEncodingError
+		}
+		err = enc.WriteDataValue(v)
+	case VariantTypeVariant:
+		err = enc.WriteVariant(value)
+	case VariantTypeDiagnosticInfo:
+		v, ok := value.(DiagnosticInfo)
+		if !ok {
+			return BadEncodingError
+		}
+		err = enc.WriteDiagnosticInfo(v)
+	default:
+		return BadEncodingError
+	}
+	if err != nil {
+		return BadEncodingError
+	}
+	return nil
+}
+
+// readBuiltin reads the value of a field with the builtin type.
+func (dec *BinaryDecoder) readBuiltin(b byte, isArray bool, value *Variant) error {
+	var err error
+	if isArray {
+		switch b {
+		case VariantTypeBoolean:
+			var v []bool
+			err = dec.ReadBooleanArray(&v)
+			*value = v
+		case VariantTypeSByte:
+			var v []int8
+			err = dec.ReadSByteArray(&v)
+			*value = v
+		case VariantTypeByte:
+			var v []byte
+			err = dec.ReadByteArray(&v)
+			*value = v
+		case VariantTypeInt16:
+			var v []int16
+			err = dec.ReadInt16Array(&v)
+			*value = v
+		case VariantTypeUInt16:
+			var v []uint16
+			err = dec.ReadUInt16Array(&v)
+			*value = v
+		case VariantTypeInt32:
+			var v []int32
+			err = dec.ReadInt32Array(&v)
+			*value = v
+		case VariantTypeUInt32:
+			var v []uint32
+			err = dec.ReadUInt32Array(&v)
+			*value = v
+		case VariantTypeInt64:
+			var v []int64
+			err = dec.ReadInt64Array(&v)
+			*value = v
+		case VariantTypeUInt64:
+			var v []uint64
+			err = dec.ReadUInt64Array(&v)
+			*value = v
+		case VariantTypeFloat:
+			var v []float32
+			err = dec.ReadFloatArray(&v)
+			*value = v
+		case VariantTypeDouble:
+			var v []float64
+			err = dec.ReadDoubleArray(&v)
+			*value = v
+		case VariantTypeString:
+			var v []string
+			err = dec.ReadStringArray(&v)
+			*value = v
+		case VariantTypeDateTime:
+			var v []time.Time
+			err = dec.ReadDateTimeArray(&v)
+			*value = v
+		case VariantTypeGUID:
+			var v []uuid.UUID
+			err = dec.ReadGUIDArray(&v)
+			*value = v
+		case VariantTypeByteString:
+			var v []ByteString
+			err = dec.ReadByteStringArray(&v)
+			*value = v
+		case VariantTypeXMLElement:
+			var v []XMLElement
+			err = dec.ReadXMLElementArray(&v)
+			*value = v
+		case VariantTypeNodeID:
+			var v []NodeID
+			err = dec.ReadNodeIDArray(&v)
+			*value = v
+		case VariantTypeExpandedNodeID:
+			var v []ExpandedNodeID
+			err = dec.ReadExpandedNodeIDArray(&v)
+			*value = v
+		case VariantTypeStatusCode:
+			var v []StatusCode
+			err = dec.ReadStatusCodeArray(&v)
+			*value = v
+		case VariantTypeQualifiedName:
+			var v []QualifiedName
+			err = dec.ReadQualifiedNameArray(&v)
+			*value = v
+		case VariantTypeLocalizedText:
+			var v []LocalizedText
+			err = dec.ReadLocalizedTextArray(&v)
+			*value = v
+		case VariantTypeExtensionObject:
+			var v []ExtensionObject
+			err = dec.ReadExtensionObjectArray(&v)
+			*value = v
+		case VariantTypeDataValue:
+			var v []DataValue
+			err = dec.ReadDataValueArray(&v)
+			*value = v
+		case VariantTypeVariant:
+			var v []Variant
+			err = dec.ReadVariantArray(&v)
+			*value = v
+		case VariantTypeDiagnosticInfo:
+			var v []DiagnosticInfo
+			err = dec.ReadDiagnosticInfoArray(&v)
+			*value = v
+		default:
+			return BadDecodingError
+		}
+		return err
+	}
+	switch b {
+	case VariantTypeBoolean:
+		var v bool
+		err = dec.ReadBoolean(&v)
+		*value = v
+	case VariantTypeSByte:
+		var v int8
+		err = dec.ReadSByte(&v)
+		*value = v
+	case VariantTypeByte:
+		var v byte
+		err = dec.ReadByte(&v)
+		*value = v
+	case VariantTypeInt16:
+		var v int16
+		err = dec.ReadInt16(&v)
+		*value = v
+	case VariantTypeUInt16:
+		var v uint16
+		err = dec.ReadUInt16(&v)
+		*value = v
+	case VariantTypeInt32:
+		var v int32
+		err = dec.ReadInt32(&v)
+		*value = v
+	case VariantTypeUInt32:
+		var v uint32
+		err = dec.ReadUInt32(&v)
+		*value = v
+	case VariantTypeInt64:
+		var v int64
+		err = dec.ReadInt64(&v)
+		*value = v
+	case VariantTypeUInt64:
+		var v uint64
+		err = dec.ReadUInt64(&v)
+		*value = v
+	case VariantTypeFloat:
+		var v float32
+		err = dec.ReadFloat(&v)
+		*value = v
+	case VariantTypeDouble:
+		var v float64
+		err = dec.ReadDouble(&v)
+		*value = v
+	case VariantTypeString:
+		var v string
+		err = dec.ReadString(&v)
+		*value = v
+	case VariantTypeDateTime:
+		var v time.Time
+		err = dec.ReadDateTime(&v)
+		*value = v
+	case VariantTypeGUID:
+		var v uuid.UUID
+		err = dec.ReadGUID(&v)
+		*value = v
+	case VariantTypeByteString:
+		var v ByteString
+		err = dec.ReadByteString(&v)
+		*value = v
+	case VariantTypeXMLElement:
+		var v XMLElement
+		err = dec.ReadXMLElement(&v)
+		*value = v
+	case VariantTypeNodeID:
+		var v NodeID
+		err = dec.ReadNodeID(&v)
+		*value = v
+	case VariantTypeExpandedNodeID:
+		var v ExpandedNodeID
+		err = dec.ReadExpandedNodeID(&v)
+		*value = v
+	case VariantTypeStatusCode:
+		var v StatusCode
+		err = dec.ReadStatusCode(&v)
+		*value = v
+	case VariantTypeQualifiedName:
+		var v QualifiedName
+		err = dec.ReadQualifiedName(&v)
+		*value = v
+	case VariantTypeLocalizedText:
+		var v LocalizedText
+		err = dec.ReadLocalizedText(&v)
+		*value = v
+	case VariantTypeExtensionObject:
+		var v ExtensionObject
+		err = dec.ReadExtensionObject(&v)
+		*value = v
+	case VariantTypeDataValue:
+		var v DataValue
+		err = dec.ReadDataValue(&v)
+		*value = v
+	case VariantTypeVariant:
+		var v Variant
+		err = dec.ReadVariant(&v)
+		*value = v
+	case VariantTypeDiagnosticInfo:
+		var v DiagnosticInfo
+		err = dec.ReadDiagnosticInfo(&v)
+		*value = v
+	default:
+		return BadDecodingError
+	}
+	return err
+}
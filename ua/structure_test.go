@@ -0,0 +1,94 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package ua_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/awcullen/opcua/ua"
+	"gotest.tools/assert"
+)
+
+func TestStructureRoundTrip(t *testing.T) {
+	nsURIs := ua.NewEncodingContext().NamespaceURIs()
+	pointID := ua.NewExpandedNodeID(ua.NewNodeIDNumeric(1, 3001))
+	ua.RegisterStructureDefinition(pointID, ua.StructureDefinition{
+		DefaultEncodingID: ua.NewNodeIDNumeric(1, 3002),
+		StructureType:     ua.StructureTypeStructure,
+		Fields: []ua.StructureField{
+			{Name: "X", DataType: ua.DataTypeIDDouble, ValueRank: ua.ValueRankScalar},
+			{Name: "Y", DataType: ua.DataTypeIDDouble, ValueRank: ua.ValueRankScalar},
+		},
+	}, nsURIs)
+	ua.RegisterStructureDefinition(ua.NewExpandedNodeID(ua.DataTypeIDRange), ua.StructureDefinition{
+		DefaultEncodingID: ua.ObjectIDRangeEncodingDefaultBinary,
+		StructureType:     ua.StructureTypeStructure,
+		Fields: []ua.StructureField{
+			{Name: "Low", DataType: ua.DataTypeIDDouble, ValueRank: ua.ValueRankScalar},
+			{Name: "High", DataType: ua.DataTypeIDDouble, ValueRank: ua.ValueRankScalar},
+		},
+	}, nsURIs)
+	shapeID := ua.NewExpandedNodeID(ua.NewNodeIDNumeric(1, 3003))
+	ua.RegisterStructureDefinition(shapeID, ua.StructureDefinition{
+		DefaultEncodingID: ua.NewNodeIDNumeric(1, 3004),
+		StructureType:     ua.StructureTypeStructureWithOptionalFields,
+		Fields: []ua.StructureField{
+			{Name: "Name", DataType: ua.DataTypeIDString, ValueRank: ua.ValueRankScalar},
+			{Name: "Points", DataType: ua.NewNodeIDNumeric(1, 3001), ValueRank: ua.ValueRankOneDimension},
+			{Name: "Range", DataType: ua.DataTypeIDRange, ValueRank: ua.ValueRankScalar, IsOptional: true},
+			{Name: "Tags", DataType: ua.DataTypeIDString, ValueRank: ua.ValueRankOneDimension, IsOptional: true},
+			{Name: "Timeout", DataType: ua.DataTypeIDDuration, ValueRank: ua.ValueRankScalar},
+		},
+	}, nsURIs)
+	choiceID := ua.NewExpandedNodeID(ua.NewNodeIDNumeric(1, 3005))
+	ua.RegisterStructureDefinition(choiceID, ua.StructureDefinition{
+		DefaultEncodingID: ua.NewNodeIDNumeric(1, 3006),
+		StructureType:     ua.StructureTypeUnion,
+		Fields: []ua.StructureField{
+			{Name: "Count", DataType: ua.DataTypeIDInt32, ValueRank: ua.ValueRankScalar},
+			{Name: "Text", DataType: ua.DataTypeIDLocalizedText, ValueRank: ua.ValueRankScalar},
+		},
+	}, nsURIs)
+
+	cases := []ua.Variant{
+		ua.Structure{DataTypeID: pointID, Fields: []ua.Variant{1.5, -2.5}},
+		ua.Structure{DataTypeID: shapeID, Fields: []ua.Variant{
+			"Triangle",
+			[]ua.Structure{
+				{DataTypeID: pointID, Fields: []ua.Variant{0.0, 0.0}},
+				{DataTypeID: pointID, Fields: []ua.Variant{1.0, 0.0}},
+			},
+			ua.Range{Low: 0, High: 10},
+			nil,
+			250.0,
+		}},
+		ua.Structure{DataTypeID: shapeID, Fields: []ua.Variant{"Empty", []ua.Structure(nil), nil, []string{"a", "b"}, 0.0}},
+		ua.Structure{DataTypeID: choiceID, Fields: []ua.Variant{nil, ua.NewLocalizedText("on", "en")}},
+		ua.Structure{DataTypeID: choiceID, Fields: []ua.Variant{nil, nil}},
+		[]ua.ExtensionObject{ua.Structure{DataTypeID: choiceID, Fields: []ua.Variant{int32(3), nil}}, ua.Range{Low: 1, High: 2}},
+	}
+	for _, c := range cases {
+		buf := &bytes.Buffer{}
+		enc := ua.NewBinaryEncoder(buf, ua.NewEncodingContext())
+		assert.NilError(t, enc.WriteVariant(c))
+		dec := ua.NewBinaryDecoder(buf, ua.NewEncodingContext())
+		var out ua.Variant
+		assert.NilError(t, dec.ReadVariant(&out))
+		assert.DeepEqual(t, out, c)
+		assert.Equal(t, buf.Len(), 0)
+	}
+
+	// the value of a field must match the DataType of the field.
+	enc := ua.NewBinaryEncoder(&bytes.Buffer{}, ua.NewEncodingContext())
+	assert.Equal(t, enc.WriteExtensionObject(ua.Structure{DataTypeID: pointID, Fields: []ua.Variant{1.5}}), ua.BadEncodingError)
+	assert.Equal(t, enc.WriteExtensionObject(ua.Structure{DataTypeID: shapeID, Fields: []ua.Variant{"Bad", nil, "Range", nil, 0.0}}), ua.BadEncodingError)
+	assert.Equal(t, enc.WriteExtensionObject(ua.Structure{DataTypeID: ua.NewExpandedNodeID(ua.NewNodeIDNumeric(1, 3999))}), ua.BadEncodingError)
+	assert.Equal(t, enc.WriteExtensionObject(ua.Structure{DataTypeID: pointID, Fields: []ua.Variant{"1.5", -2.5}}), ua.BadEncodingError)
+	assert.Equal(t, enc.WriteExtensionObject(ua.Structure{DataTypeID: pointID, Fields: []ua.Variant{nil, -2.5}}), ua.BadEncodingError)
+	assert.Equal(t, enc.WriteExtensionObject(ua.Structure{DataTypeID: shapeID, Fields: []ua.Variant{"Bad", nil, nil, []int32{1}, 0.0}}), ua.BadEncodingError)
+
+	def, ok := ua.FindStructureDefinition(shapeID)
+	assert.Assert(t, ok)
+	assert.Equal(t, len(def.Fields), 5)
+}
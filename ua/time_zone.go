@@ -0,0 +1,23 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package ua
+
+import (
+	"fmt"
+	"time"
+)
+
+// Location returns a fixed time zone with the offset of the TimeZoneDataType. The offset is
+// in minutes from UTC. A zero TimeZoneDataType returns UTC.
+func (tz TimeZoneDataType) Location() *time.Location {
+	if tz.Offset == 0 {
+		return time.UTC
+	}
+	sign := '+'
+	offset := int(tz.Offset)
+	if offset < 0 {
+		sign = '-'
+		offset = -offset
+	}
+	return time.FixedZone(fmt.Sprintf("UTC%c%02d:%02d", sign, offset/60, offset%60), int(tz.Offset)*60)
+}
@@ -0,0 +1,20 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package ua_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/awcullen/opcua/ua"
+	"gotest.tools/assert"
+)
+
+func TestTimeZoneLocation(t *testing.T) {
+	assert.Equal(t, ua.TimeZoneDataType{}.Location(), time.UTC)
+	loc := ua.TimeZoneDataType{Offset: -300, DaylightSavingInOffset: true}.Location()
+	assert.Equal(t, loc.String(), "UTC-05:00")
+	// local midnight of the client starts a daily interval.
+	midnight := time.Date(2021, 6, 1, 0, 0, 0, 0, loc)
+	assert.Equal(t, midnight.UTC(), time.Date(2021, 6, 1, 5, 0, 0, 0, time.UTC))
+}
@@ -77,13 +77,27 @@ type UADataTypeDefinition struct {
 
 // UADataTypeField supports reading UANodeSet from xml.
 type UADataTypeField struct {
-	Description string               `xml:"Description"`
-	Definition  UADataTypeDefinition `xml:"Definition"`
-	Name        string               `xml:"Name,attr"`
-	DataType    string               `xml:"DataType,attr"`
-	ValueRank   int                  `xml:"ValueRank,attr"`
-	Value       int                  `xml:"Value,attr"`
-	IsOptional  bool                 `xml:"IsOptional,attr"`
+	Description     string               `xml:"Description"`
+	Definition      UADataTypeDefinition `xml:"Definition"`
+	Name            string               `xml:"Name,attr"`
+	DataType        string               `xml:"DataType,attr"`
+	ValueRank       int                  `xml:"ValueRank,attr"`
+	Value           int                  `xml:"Value,attr"`
+	IsOptional      bool                 `xml:"IsOptional,attr"`
+	DisplayName     UALocalizedText      `xml:"DisplayName"`
+	ArrayDimensions string               `xml:"ArrayDimensions,attr"`
+	MaxStringLength uint32               `xml:"MaxStringLength,attr"`
+}
+
+// UnmarshalXML reads the field, with a ValueRank of Scalar if the attribute is missing.
+func (f *UADataTypeField) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type field UADataTypeField
+	v := field{ValueRank: int(ValueRankScalar)}
+	if err := d.DecodeElement(&v, &start); err != nil {
+		return err
+	}
+	*f = UADataTypeField(v)
+	return nil
 }
 
 // ListOfBoolean supports reading UANodeSet from xml.
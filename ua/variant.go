@@ -2,6 +2,13 @@
 
 package ua
 
+import (
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+)
+
 // VariantTypes
 const (
 	VariantTypeNull byte = iota
@@ -41,8 +48,236 @@ Variant stores a single value or slice of the following types:
    NodeId, ExpandedNodeId, StatusCode, QualifiedName
    LocalizedText, DataValue, Variant
 
+A multi-dimensional array is stored as a Matrix.
+
 In addition, you may store any type that is registered with the BinaryEncoder.
 These types will be encoded as an ExtensionObject by the BinaryEncoder.
 
 */
 type Variant interface{}
+
+// Null is the explicit null Variant. Like a nil Variant, it is encoded as VariantTypeNull with no body.
+type Null struct{}
+
+// IsNull returns true if the Variant is nil or the explicit Null.
+func IsNull(v Variant) bool {
+	switch v.(type) {
+	case nil, Null:
+		return true
+	default:
+		return false
+	}
+}
+
+// VariantTypeOf returns the VariantType used to encode the value stored in the Variant, e.g.
+// VariantTypeInt16 for int16 or []int16. Returns VariantTypeNull for nil, and
+// VariantTypeExtensionObject for types that are encoded as an ExtensionObject.
+func VariantTypeOf(v Variant) byte {
+	switch x := v.(type) {
+	case nil, Null:
+		return VariantTypeNull
+	case bool, []bool:
+		return VariantTypeBoolean
+	case int8, []int8:
+		return VariantTypeSByte
+	case uint8, []uint8:
+		return VariantTypeByte
+	case int16, []int16:
+		return VariantTypeInt16
+	case uint16, []uint16:
+		return VariantTypeUInt16
+	case int32, []int32:
+		return VariantTypeInt32
+	case uint32, []uint32:
+		return VariantTypeUInt32
+	case int64, []int64:
+		return VariantTypeInt64
+	case uint64, []uint64:
+		return VariantTypeUInt64
+	case float32, []float32:
+		return VariantTypeFloat
+	case float64, []float64:
+		return VariantTypeDouble
+	case string, []string:
+		return VariantTypeString
+	case time.Time, []time.Time:
+		return VariantTypeDateTime
+	case uuid.UUID, []uuid.UUID:
+		return VariantTypeGUID
+	case ByteString, []ByteString:
+		return VariantTypeByteString
+	case XMLElement, []XMLElement:
+		return VariantTypeXMLElement
+	case NodeID, []NodeID:
+		return VariantTypeNodeID
+	case ExpandedNodeID, []ExpandedNodeID:
+		return VariantTypeExpandedNodeID
+	case StatusCode, []StatusCode:
+		return VariantTypeStatusCode
+	case QualifiedName, []QualifiedName:
+		return VariantTypeQualifiedName
+	case LocalizedText, []LocalizedText:
+		return VariantTypeLocalizedText
+	case DataValue, []DataValue:
+		return VariantTypeDataValue
+	case []Variant:
+		return VariantTypeVariant
+	case Matrix:
+		return VariantTypeOf(x.Elements)
+	default:
+		return VariantTypeExtensionObject
+	}
+}
+
+// The following accessors return the scalar stored in a Variant. Numbers are converted to the
+// requested type only if no precision is lost, e.g. int16 to int64 or float32 to float64.
+
+// AsBool returns the bool stored in the Variant, or false if the Variant stores another type.
+func AsBool(v Variant) (bool, bool) {
+	b, ok := v.(bool)
+	return b, ok
+}
+
+// AsInt64 returns the integer stored in the Variant as an int64, or false if the Variant stores
+// another type or a uint64 that is too large.
+func AsInt64(v Variant) (int64, bool) {
+	switch x := v.(type) {
+	case int8:
+		return int64(x), true
+	case uint8:
+		return int64(x), true
+	case int16:
+		return int64(x), true
+	case uint16:
+		return int64(x), true
+	case int32:
+		return int64(x), true
+	case uint32:
+		return int64(x), true
+	case int64:
+		return x, true
+	case uint64:
+		if x <= math.MaxInt64 {
+			return int64(x), true
+		}
+	}
+	return 0, false
+}
+
+// AsUint64 returns the integer stored in the Variant as a uint64, or false if the Variant stores
+// another type or a negative number.
+func AsUint64(v Variant) (uint64, bool) {
+	switch x := v.(type) {
+	case uint8:
+		return uint64(x), true
+	case uint16:
+		return uint64(x), true
+	case uint32:
+		return uint64(x), true
+	case uint64:
+		return x, true
+	}
+	if x, ok := AsInt64(v); ok && x >= 0 {
+		return uint64(x), true
+	}
+	return 0, false
+}
+
+// AsFloat64 returns the number stored in the Variant as a float64, or false if the Variant stores
+// another type. Integers of more than 32 bits are not converted, since they may lose precision.
+func AsFloat64(v Variant) (float64, bool) {
+	switch x := v.(type) {
+	case float32:
+		return float64(x), true
+	case float64:
+		return x, true
+	case int8:
+		return float64(x), true
+	case uint8:
+		return float64(x), true
+	case int16:
+		return float64(x), true
+	case uint16:
+		return float64(x), true
+	case int32:
+		return float64(x), true
+	case uint32:
+		return float64(x), true
+	}
+	return 0, false
+}
+
+// AsString returns the string stored in the Variant, or false if the Variant stores another type.
+func AsString(v Variant) (string, bool) {
+	s, ok := v.(string)
+	return s, ok
+}
+
+// AsTime returns the time.Time stored in the Variant, or false if the Variant stores another type.
+func AsTime(v Variant) (time.Time, bool) {
+	t, ok := v.(time.Time)
+	return t, ok
+}
+
+// The following accessors return the slice stored in a Variant without copying. The
+// returned slice shares memory with the Variant and must be treated as read-only.
+
+// AsInt8Slice returns the []int8 stored in the Variant, or false if the Variant stores another type.
+func AsInt8Slice(v Variant) ([]int8, bool) {
+	s, ok := v.([]int8)
+	return s, ok
+}
+
+// AsUint8Slice returns the []uint8 stored in the Variant, or false if the Variant stores another type.
+func AsUint8Slice(v Variant) ([]uint8, bool) {
+	s, ok := v.([]uint8)
+	return s, ok
+}
+
+// AsInt16Slice returns the []int16 stored in the Variant, or false if the Variant stores another type.
+func AsInt16Slice(v Variant) ([]int16, bool) {
+	s, ok := v.([]int16)
+	return s, ok
+}
+
+// AsUint16Slice returns the []uint16 stored in the Variant, or false if the Variant stores another type.
+func AsUint16Slice(v Variant) ([]uint16, bool) {
+	s, ok := v.([]uint16)
+	return s, ok
+}
+
+// AsInt32Slice returns the []int32 stored in the Variant, or false if the Variant stores another type.
+func AsInt32Slice(v Variant) ([]int32, bool) {
+	s, ok := v.([]int32)
+	return s, ok
+}
+
+// AsUint32Slice returns the []uint32 stored in the Variant, or false if the Variant stores another type.
+func AsUint32Slice(v Variant) ([]uint32, bool) {
+	s, ok := v.([]uint32)
+	return s, ok
+}
+
+// AsInt64Slice returns the []int64 stored in the Variant, or false if the Variant stores another type.
+func AsInt64Slice(v Variant) ([]int64, bool) {
+	s, ok := v.([]int64)
+	return s, ok
+}
+
+// AsUint64Slice returns the []uint64 stored in the Variant, or false if the Variant stores another type.
+func AsUint64Slice(v Variant) ([]uint64, bool) {
+	s, ok := v.([]uint64)
+	return s, ok
+}
+
+// AsFloat32Slice returns the []float32 stored in the Variant, or false if the Variant stores another type.
+func AsFloat32Slice(v Variant) ([]float32, bool) {
+	s, ok := v.([]float32)
+	return s, ok
+}
+
+// AsFloat64Slice returns the []float64 stored in the Variant, or false if the Variant stores another type.
+func AsFloat64Slice(v Variant) ([]float64, bool) {
+	s, ok := v.([]float64)
+	return s, ok
+}
@@ -0,0 +1,164 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package ua
+
+import (
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// variantGoTypes maps each VariantType to the Go type stored in a Variant of that type.
+var variantGoTypes = map[byte]reflect.Type{
+	VariantTypeBoolean:        reflect.TypeOf(false),
+	VariantTypeSByte:          reflect.TypeOf(int8(0)),
+	VariantTypeByte:           reflect.TypeOf(uint8(0)),
+	VariantTypeInt16:          reflect.TypeOf(int16(0)),
+	VariantTypeUInt16:         reflect.TypeOf(uint16(0)),
+	VariantTypeInt32:          reflect.TypeOf(int32(0)),
+	VariantTypeUInt32:         reflect.TypeOf(uint32(0)),
+	VariantTypeInt64:          reflect.TypeOf(int64(0)),
+	VariantTypeUInt64:         reflect.TypeOf(uint64(0)),
+	VariantTypeFloat:          reflect.TypeOf(float32(0)),
+	VariantTypeDouble:         reflect.TypeOf(float64(0)),
+	VariantTypeString:         reflect.TypeOf(""),
+	VariantTypeDateTime:       reflect.TypeOf(time.Time{}),
+	VariantTypeGUID:           reflect.TypeOf(uuid.UUID{}),
+	VariantTypeByteString:     reflect.TypeOf(ByteString("")),
+	VariantTypeXMLElement:     reflect.TypeOf(XMLElement("")),
+	VariantTypeExpandedNodeID: reflect.TypeOf(ExpandedNodeID{}),
+	VariantTypeStatusCode:     reflect.TypeOf(StatusCode(0)),
+	VariantTypeQualifiedName:  reflect.TypeOf(QualifiedName{}),
+	VariantTypeLocalizedText:  reflect.TypeOf(LocalizedText{}),
+	VariantTypeDataValue:      reflect.TypeOf(DataValue{}),
+}
+
+// NewVariantAs returns a Variant that stores the value as the given VariantType, e.g.
+// NewVariantAs(VariantTypeInt16, 42) returns int16(42). Numbers of any Go type are converted to
+// the numeric VariantTypes, and slices are converted element by element. Returns BadOutOfRange
+// if a number does not fit the VariantType, or BadTypeMismatch if the value cannot be stored
+// as the VariantType.
+func NewVariantAs(variantType byte, value interface{}) (Variant, error) {
+	if value == nil {
+		return nil, nil
+	}
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Slice && v.Type() != reflect.TypeOf(ByteString("")) {
+		if variantType == VariantTypeByteString && v.Type().Elem().Kind() == reflect.Uint8 {
+			return ByteString(v.Bytes()), nil
+		}
+		if variantType == VariantTypeVariant {
+			s := make([]Variant, v.Len())
+			for i := range s {
+				s[i] = v.Index(i).Interface()
+			}
+			return s, nil
+		}
+		t, ok := variantGoTypes[variantType]
+		if !ok {
+			return nil, BadTypeMismatch
+		}
+		s := reflect.MakeSlice(reflect.SliceOf(t), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			e, err := convertScalar(variantType, t, v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			s.Index(i).Set(e)
+		}
+		return s.Interface(), nil
+	}
+	switch variantType {
+	case VariantTypeNodeID:
+		if id, ok := value.(NodeID); ok {
+			return id, nil
+		}
+		return nil, BadTypeMismatch
+	case VariantTypeVariant, VariantTypeExtensionObject:
+		return value, nil
+	}
+	t, ok := variantGoTypes[variantType]
+	if !ok {
+		return nil, BadTypeMismatch
+	}
+	e, err := convertScalar(variantType, t, v)
+	if err != nil {
+		return nil, err
+	}
+	return e.Interface(), nil
+}
+
+// convertScalar converts the value to the Go type t of the VariantType.
+func convertScalar(variantType byte, t reflect.Type, v reflect.Value) (reflect.Value, error) {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if v.Type() == t {
+		return v, nil
+	}
+	switch variantType {
+	case VariantTypeSByte, VariantTypeInt16, VariantTypeInt32, VariantTypeInt64:
+		var i int64
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			i = v.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if v.Uint() > math.MaxInt64 {
+				return reflect.Value{}, BadOutOfRange
+			}
+			i = int64(v.Uint())
+		default:
+			return reflect.Value{}, BadTypeMismatch
+		}
+		r := reflect.New(t).Elem()
+		if r.OverflowInt(i) {
+			return reflect.Value{}, BadOutOfRange
+		}
+		r.SetInt(i)
+		return r, nil
+	case VariantTypeByte, VariantTypeUInt16, VariantTypeUInt32, VariantTypeUInt64:
+		var u uint64
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if v.Int() < 0 {
+				return reflect.Value{}, BadOutOfRange
+			}
+			u = uint64(v.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			u = v.Uint()
+		default:
+			return reflect.Value{}, BadTypeMismatch
+		}
+		r := reflect.New(t).Elem()
+		if r.OverflowUint(u) {
+			return reflect.Value{}, BadOutOfRange
+		}
+		r.SetUint(u)
+		return r, nil
+	case VariantTypeFloat, VariantTypeDouble:
+		var f float64
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			f = float64(v.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			f = float64(v.Uint())
+		case reflect.Float32, reflect.Float64:
+			f = v.Float()
+		default:
+			return reflect.Value{}, BadTypeMismatch
+		}
+		r := reflect.New(t).Elem()
+		if r.OverflowFloat(f) {
+			return reflect.Value{}, BadOutOfRange
+		}
+		r.SetFloat(f)
+		return r, nil
+	default:
+		if v.Type().ConvertibleTo(t) && v.Kind() == t.Kind() {
+			return v.Convert(t), nil
+		}
+		return reflect.Value{}, BadTypeMismatch
+	}
+}
@@ -0,0 +1,606 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package ua
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// JSONVariant stores a Variant that is encoded with the reversible form of the OPC UA JSON encoding,
+// e.g. {"Type":6,"Body":42}. Use it as a field of a struct that is passed to json.Marshal and json.Unmarshal.
+type JSONVariant struct {
+	Value Variant
+}
+
+// MarshalJSON encodes the Variant with the reversible form of the OPC UA JSON encoding.
+func (v JSONVariant) MarshalJSON() ([]byte, error) {
+	return MarshalVariantJSON(v.Value)
+}
+
+// UnmarshalJSON decodes a Variant encoded with the reversible form of the OPC UA JSON encoding.
+func (v *JSONVariant) UnmarshalJSON(b []byte) error {
+	value, err := UnmarshalVariantJSON(b)
+	if err != nil {
+		return err
+	}
+	v.Value = value
+	return nil
+}
+
+// JSONOption is a functional option to be applied to the JSON encoding of a Variant.
+type JSONOption func(*jsonEncoder)
+
+// WithNonReversibleJSON selects the non-reversible form of the OPC UA JSON encoding. The Variant is
+// encoded as the bare value, e.g. 42, a LocalizedText as its text, a matrix as nested arrays, and an
+// ExtensionObject as the JSON of the struct. This form is intended for consumers that do not decode OPC UA.
+func WithNonReversibleJSON() JSONOption {
+	return func(e *jsonEncoder) {
+		e.nonReversible = true
+	}
+}
+
+// MarshalVariantJSON encodes the Variant with the OPC UA JSON encoding, by default the reversible form
+// {"Type": <VariantType>, "Body": <value>, "Dimensions": <dimensions of a Matrix>}.
+// Int64 and UInt64 are encoded as strings, DateTime as ISO 8601 strings in UTC, ByteString as base64,
+// NodeID and ExpandedNodeID in their string form, e.g. "ns=2;s=Demo", and an ExtensionObject as the
+// base64 of its binary encoding. A nil Variant is encoded as null.
+// Returns BadEncodingError if the Variant stores a type that cannot be encoded.
+func MarshalVariantJSON(v Variant, opts ...JSONOption) ([]byte, error) {
+	e := &jsonEncoder{}
+	for _, opt := range opts {
+		opt(e)
+	}
+	value, err := e.variant(v)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, BadEncodingError
+	}
+	return b, nil
+}
+
+// UnmarshalVariantJSON decodes a Variant encoded with the reversible form of the OPC UA JSON encoding.
+// Arrays are returned as slices of the Variant type, e.g. []int32, and arrays with Dimensions as a Matrix.
+// Returns BadDecodingError if the JSON is not a valid Variant.
+func UnmarshalVariantJSON(b []byte) (Variant, error) {
+	return jsonVariantValue(b)
+}
+
+type jsonEncoder struct {
+	nonReversible bool
+}
+
+type jsonVariant struct {
+	Type       byte        `json:"Type"`
+	Body       interface{} `json:"Body"`
+	Dimensions []int32     `json:"Dimensions,omitempty"`
+}
+
+type jsonQualifiedName struct {
+	Name string `json:"Name,omitempty"`
+	URI  uint16 `json:"Uri,omitempty"`
+}
+
+type jsonLocalizedText struct {
+	Locale string `json:"Locale,omitempty"`
+	Text   string `json:"Text,omitempty"`
+}
+
+type jsonStatusCode struct {
+	Code uint32 `json:"Code"`
+}
+
+type jsonExtensionObject struct {
+	TypeID   string          `json:"TypeId"`
+	Encoding byte            `json:"Encoding,omitempty"`
+	Body     json.RawMessage `json:"Body"`
+}
+
+type jsonDataValue struct {
+	Value             interface{} `json:"Value,omitempty"`
+	Status            interface{} `json:"Status,omitempty"`
+	SourceTimestamp   string      `json:"SourceTimestamp,omitempty"`
+	SourcePicoseconds uint16      `json:"SourcePicoseconds,omitempty"`
+	ServerTimestamp   string      `json:"ServerTimestamp,omitempty"`
+	ServerPicoseconds uint16      `json:"ServerPicoseconds,omitempty"`
+}
+
+// variant returns a value that json.Marshal encodes as the Variant.
+func (e *jsonEncoder) variant(v Variant) (interface{}, error) {
+	if IsNull(v) {
+		return nil, nil
+	}
+	typ := VariantTypeOf(v)
+	var dims []int32
+	if m, ok := v.(Matrix); ok {
+		if err := m.Validate(); err != nil {
+			return nil, BadEncodingError
+		}
+		v, dims = m.Elements, m.Dimensions
+	}
+	switch v.(type) {
+	case DiagnosticInfo, []DiagnosticInfo:
+		typ = VariantTypeDiagnosticInfo
+	}
+	var body interface{}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice {
+		elems := make([]interface{}, rv.Len())
+		for i := range elems {
+			elem, err := e.value(typ, rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = elem
+		}
+		if e.nonReversible && dims != nil {
+			return nestJSONArray(elems, dims), nil
+		}
+		body = elems
+	} else {
+		elem, err := e.value(typ, v)
+		if err != nil {
+			return nil, err
+		}
+		body = elem
+	}
+	if e.nonReversible {
+		return body, nil
+	}
+	return jsonVariant{Type: typ, Body: body, Dimensions: dims}, nil
+}
+
+// value returns a value that json.Marshal encodes as the scalar of the given VariantType.
+func (e *jsonEncoder) value(typ byte, v interface{}) (interface{}, error) {
+	if typ == VariantTypeVariant {
+		return e.variant(v)
+	}
+	switch x := v.(type) {
+	case bool, int8, uint8, int16, uint16, int32, uint32, string:
+		return x, nil
+	case int64:
+		return strconv.FormatInt(x, 10), nil
+	case uint64:
+		return strconv.FormatUint(x, 10), nil
+	case float32:
+		return jsonFloat(float64(x), x), nil
+	case float64:
+		return jsonFloat(x, x), nil
+	case time.Time:
+		return jsonTime(x), nil
+	case uuid.UUID:
+		return strings.ToUpper(x.String()), nil
+	case ByteString:
+		return base64.StdEncoding.EncodeToString([]byte(x)), nil
+	case XMLElement:
+		return string(x), nil
+	case NodeID:
+		if x == nil {
+			return nil, nil
+		}
+		return ExpandedNodeID{NodeID: x}.String(), nil
+	case ExpandedNodeID:
+		if x.NodeID == nil {
+			return nil, nil
+		}
+		return x.String(), nil
+	case StatusCode:
+		if e.nonReversible {
+			return jsonStatusCode{Code: uint32(x)}, nil
+		}
+		return uint32(x), nil
+	case QualifiedName:
+		return jsonQualifiedName{Name: x.Name, URI: x.NamespaceIndex}, nil
+	case LocalizedText:
+		if e.nonReversible {
+			return x.Text, nil
+		}
+		return jsonLocalizedText{Locale: x.Locale, Text: x.Text}, nil
+	case DataValue:
+		return e.dataValue(x)
+	case DiagnosticInfo:
+		return x, nil
+	}
+	if v == nil {
+		return nil, nil
+	}
+	return e.extensionObject(v)
+}
+
+func (e *jsonEncoder) dataValue(dv DataValue) (interface{}, error) {
+	value, err := e.variant(dv.Value)
+	if err != nil {
+		return nil, err
+	}
+	out := jsonDataValue{
+		Value:             value,
+		SourcePicoseconds: dv.SourcePicoseconds,
+		ServerPicoseconds: dv.ServerPicoseconds,
+	}
+	if dv.StatusCode != Good {
+		out.Status, _ = e.value(VariantTypeStatusCode, dv.StatusCode)
+	}
+	if !dv.SourceTimestamp.IsZero() {
+		out.SourceTimestamp = jsonTime(dv.SourceTimestamp)
+	}
+	if !dv.ServerTimestamp.IsZero() {
+		out.ServerTimestamp = jsonTime(dv.ServerTimestamp)
+	}
+	return out, nil
+}
+
+// extensionObject encodes the struct as the base64 of its binary encoding, or as the JSON of the
+// struct in the non-reversible form.
+func (e *jsonEncoder) extensionObject(v interface{}) (interface{}, error) {
+	if e.nonReversible {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, BadEncodingError
+		}
+		return json.RawMessage(b), nil
+	}
+	typ := reflect.TypeOf(v)
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	id, ok := FindBinaryEncodingIDForType(typ)
+	if !ok {
+		return nil, BadEncodingError
+	}
+	buf := &bytes.Buffer{}
+	if err := NewBinaryEncoder(buf, NewEncodingContext()).Encode(v); err != nil {
+		return nil, BadEncodingError
+	}
+	body, _ := json.Marshal(base64.StdEncoding.EncodeToString(buf.Bytes()))
+	return jsonExtensionObject{TypeID: id.String(), Encoding: 1, Body: body}, nil
+}
+
+// jsonFloat returns the number, or the strings "NaN", "Infinity" and "-Infinity" that JSON lacks.
+func jsonFloat(f float64, v interface{}) interface{} {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	default:
+		return v
+	}
+}
+
+func jsonTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// nestJSONArray returns the elements of a matrix as nested arrays, one level for each dimension.
+func nestJSONArray(elems []interface{}, dims []int32) interface{} {
+	if len(dims) == 1 {
+		return elems
+	}
+	out := make([]interface{}, dims[0])
+	if len(out) == 0 {
+		return out
+	}
+	n := len(elems) / len(out)
+	for i := range out {
+		out[i] = nestJSONArray(elems[i*n:(i+1)*n], dims[1:])
+	}
+	return out
+}
+
+var jsonElementTypes = map[byte]reflect.Type{
+	VariantTypeBoolean:         reflect.TypeOf(false),
+	VariantTypeSByte:           reflect.TypeOf(int8(0)),
+	VariantTypeByte:            reflect.TypeOf(uint8(0)),
+	VariantTypeInt16:           reflect.TypeOf(int16(0)),
+	VariantTypeUInt16:          reflect.TypeOf(uint16(0)),
+	VariantTypeInt32:           reflect.TypeOf(int32(0)),
+	VariantTypeUInt32:          reflect.TypeOf(uint32(0)),
+	VariantTypeInt64:           reflect.TypeOf(int64(0)),
+	VariantTypeUInt64:          reflect.TypeOf(uint64(0)),
+	VariantTypeFloat:           reflect.TypeOf(float32(0)),
+	VariantTypeDouble:          reflect.TypeOf(float64(0)),
+	VariantTypeString:          reflect.TypeOf(""),
+	VariantTypeDateTime:        reflect.TypeOf(time.Time{}),
+	VariantTypeGUID:            reflect.TypeOf(uuid.UUID{}),
+	VariantTypeByteString:      reflect.TypeOf(ByteString("")),
+	VariantTypeXMLElement:      reflect.TypeOf(XMLElement("")),
+	VariantTypeNodeID:          reflect.TypeOf((*NodeID)(nil)).Elem(),
+	VariantTypeExpandedNodeID:  reflect.TypeOf(ExpandedNodeID{}),
+	VariantTypeStatusCode:      reflect.TypeOf(StatusCode(0)),
+	VariantTypeQualifiedName:   reflect.TypeOf(QualifiedName{}),
+	VariantTypeLocalizedText:   reflect.TypeOf(LocalizedText{}),
+	VariantTypeExtensionObject: reflect.TypeOf((*ExtensionObject)(nil)).Elem(),
+	VariantTypeDataValue:       reflect.TypeOf(DataValue{}),
+	VariantTypeVariant:         reflect.TypeOf((*Variant)(nil)).Elem(),
+	VariantTypeDiagnosticInfo:  reflect.TypeOf(DiagnosticInfo{}),
+}
+
+func jsonVariantValue(b []byte) (Variant, error) {
+	if isJSONNull(b) {
+		return nil, nil
+	}
+	var in struct {
+		Type       byte
+		Body       json.RawMessage
+		Dimensions []int32
+	}
+	if err := json.Unmarshal(b, &in); err != nil {
+		return nil, BadDecodingError
+	}
+	if in.Type == VariantTypeNull {
+		return nil, nil
+	}
+	elemType, ok := jsonElementTypes[in.Type]
+	if !ok {
+		return nil, BadDecodingError
+	}
+	body := bytes.TrimSpace(in.Body)
+	if len(body) == 0 || body[0] != '[' {
+		if in.Dimensions != nil {
+			return nil, BadDecodingError
+		}
+		return jsonValue(in.Type, body)
+	}
+	var elems []json.RawMessage
+	if err := json.Unmarshal(body, &elems); err != nil {
+		return nil, BadDecodingError
+	}
+	slice := reflect.MakeSlice(reflect.SliceOf(elemType), len(elems), len(elems))
+	for i, elem := range elems {
+		v, err := jsonValue(in.Type, elem)
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			slice.Index(i).Set(reflect.ValueOf(v))
+		}
+	}
+	if in.Dimensions != nil {
+		m, err := NewMatrix(slice.Interface(), in.Dimensions)
+		if err != nil {
+			return nil, BadDecodingError
+		}
+		return m, nil
+	}
+	return slice.Interface(), nil
+}
+
+// jsonValue decodes the scalar of the given VariantType.
+func jsonValue(typ byte, b []byte) (interface{}, error) {
+	if isJSONNull(b) {
+		switch typ {
+		case VariantTypeNodeID, VariantTypeExtensionObject, VariantTypeVariant:
+			return nil, nil
+		default:
+			return reflect.Zero(jsonElementTypes[typ]).Interface(), nil
+		}
+	}
+	switch typ {
+	case VariantTypeInt64:
+		v, err := strconv.ParseInt(jsonUnquote(b), 10, 64)
+		if err != nil {
+			return nil, BadDecodingError
+		}
+		return v, nil
+	case VariantTypeUInt64:
+		v, err := strconv.ParseUint(jsonUnquote(b), 10, 64)
+		if err != nil {
+			return nil, BadDecodingError
+		}
+		return v, nil
+	case VariantTypeFloat:
+		v, err := strconv.ParseFloat(jsonFloatString(b), 32)
+		if err != nil {
+			return nil, BadDecodingError
+		}
+		return float32(v), nil
+	case VariantTypeDouble:
+		v, err := strconv.ParseFloat(jsonFloatString(b), 64)
+		if err != nil {
+			return nil, BadDecodingError
+		}
+		return v, nil
+	case VariantTypeDateTime:
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return nil, BadDecodingError
+		}
+		v, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, BadDecodingError
+		}
+		return v.UTC(), nil
+	case VariantTypeGUID:
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return nil, BadDecodingError
+		}
+		v, err := uuid.Parse(s)
+		if err != nil {
+			return nil, BadDecodingError
+		}
+		return v, nil
+	case VariantTypeByteString:
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return nil, BadDecodingError
+		}
+		v, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, BadDecodingError
+		}
+		return ByteString(v), nil
+	case VariantTypeXMLElement:
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return nil, BadDecodingError
+		}
+		return XMLElement(s), nil
+	case VariantTypeNodeID, VariantTypeExpandedNodeID:
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return nil, BadDecodingError
+		}
+		id := ParseExpandedNodeID(s)
+		if id.NodeID == nil {
+			return nil, BadDecodingError
+		}
+		if typ == VariantTypeNodeID {
+			if id.ServerIndex != 0 || id.NamespaceURI != "" {
+				return nil, BadDecodingError
+			}
+			return id.NodeID, nil
+		}
+		return id, nil
+	case VariantTypeQualifiedName:
+		var v jsonQualifiedName
+		if err := json.Unmarshal(b, &v); err != nil {
+			return nil, BadDecodingError
+		}
+		return QualifiedName{NamespaceIndex: v.URI, Name: v.Name}, nil
+	case VariantTypeLocalizedText:
+		var v jsonLocalizedText
+		if err := json.Unmarshal(b, &v); err != nil {
+			return nil, BadDecodingError
+		}
+		return LocalizedText{Text: v.Text, Locale: v.Locale}, nil
+	case VariantTypeExtensionObject:
+		return jsonExtensionObjectValue(b)
+	case VariantTypeDataValue:
+		return jsonDataValueValue(b)
+	case VariantTypeVariant:
+		return jsonVariantValue(b)
+	}
+	// the remaining types are decoded by encoding/json.
+	v := reflect.New(jsonElementTypes[typ])
+	if err := json.Unmarshal(b, v.Interface()); err != nil {
+		return nil, BadDecodingError
+	}
+	return v.Elem().Interface(), nil
+}
+
+func jsonExtensionObjectValue(b []byte) (interface{}, error) {
+	var in jsonExtensionObject
+	if err := json.Unmarshal(b, &in); err != nil {
+		return nil, BadDecodingError
+	}
+	id := ParseExpandedNodeID(in.TypeID)
+	typ, ok := FindTypeForBinaryEncodingID(id)
+	if !ok {
+		return nil, BadDecodingError
+	}
+	switch in.Encoding {
+	case 0:
+		// the body is the JSON of the struct.
+		v := reflect.New(typ)
+		if err := json.Unmarshal(in.Body, v.Interface()); err != nil {
+			return nil, BadDecodingError
+		}
+		return v.Elem().Interface(), nil
+	case 1:
+		// the body is the base64 of the binary encoding, which the BinaryDecoder reads with the id.
+		var body ByteString
+		if v, err := jsonValue(VariantTypeByteString, in.Body); err == nil {
+			body = v.(ByteString)
+		} else {
+			return nil, err
+		}
+		ec := NewEncodingContext()
+		buf := &bytes.Buffer{}
+		enc := NewBinaryEncoder(buf, ec)
+		if err := enc.WriteNodeID(ToNodeID(id, ec.NamespaceURIs())); err != nil {
+			return nil, BadDecodingError
+		}
+		if err := enc.WriteByte(0x01); err != nil {
+			return nil, BadDecodingError
+		}
+		if err := enc.WriteByteString(body); err != nil {
+			return nil, BadDecodingError
+		}
+		var v ExtensionObject
+		if err := NewBinaryDecoder(buf, ec).ReadExtensionObject(&v); err != nil {
+			return nil, BadDecodingError
+		}
+		return v, nil
+	default:
+		return nil, BadDecodingError
+	}
+}
+
+func jsonDataValueValue(b []byte) (interface{}, error) {
+	var in struct {
+		Value             json.RawMessage
+		Status            uint32
+		SourceTimestamp   string
+		SourcePicoseconds uint16
+		ServerTimestamp   string
+		ServerPicoseconds uint16
+	}
+	if err := json.Unmarshal(b, &in); err != nil {
+		return nil, BadDecodingError
+	}
+	dv := DataValue{
+		StatusCode:        StatusCode(in.Status),
+		SourcePicoseconds: in.SourcePicoseconds,
+		ServerPicoseconds: in.ServerPicoseconds,
+	}
+	if len(in.Value) > 0 {
+		v, err := jsonVariantValue(in.Value)
+		if err != nil {
+			return nil, err
+		}
+		dv.Value = v
+	}
+	for _, ts := range []struct {
+		s string
+		t *time.Time
+	}{{in.SourceTimestamp, &dv.SourceTimestamp}, {in.ServerTimestamp, &dv.ServerTimestamp}} {
+		if ts.s == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, ts.s)
+		if err != nil {
+			return nil, BadDecodingError
+		}
+		*ts.t = t.UTC()
+	}
+	return dv, nil
+}
+
+func isJSONNull(b []byte) bool {
+	b = bytes.TrimSpace(b)
+	return len(b) == 0 || string(b) == "null"
+}
+
+// jsonUnquote returns the content of a JSON string, or the bytes of a JSON number.
+func jsonUnquote(b []byte) string {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		return s
+	}
+	return string(b)
+}
+
+// jsonFloatString returns a string that strconv.ParseFloat accepts, including "NaN" and "Infinity".
+func jsonFloatString(b []byte) string {
+	s := jsonUnquote(b)
+	switch s {
+	case "Infinity":
+		return "+Inf"
+	case "-Infinity":
+		return "-Inf"
+	}
+	return s
+}
@@ -0,0 +1,150 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package ua_test
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/awcullen/opcua/ua"
+	"github.com/google/uuid"
+	"gotest.tools/assert"
+)
+
+func TestVariantJSONRoundTrip(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 30, 15, 123456700, time.UTC)
+	id := uuid.MustParse("72962b91-fa75-4ae6-8d28-b404dc7daf63")
+	symbolicID := int32(3)
+	inner := ua.BadNodeIDUnknown
+	cases := []ua.Variant{
+		nil,
+		true,
+		[]bool{true, false},
+		int8(-8),
+		[]int8{-8, 8},
+		uint8(8),
+		[]uint8{0, 255},
+		int16(-16),
+		[]int16{-16, 16},
+		uint16(16),
+		[]uint16{0, 65535},
+		int32(-32),
+		[]int32{math.MinInt32, math.MaxInt32},
+		uint32(32),
+		[]uint32{0, math.MaxUint32},
+		int64(math.MinInt64),
+		[]int64{math.MinInt64, math.MaxInt64},
+		uint64(math.MaxUint64),
+		[]uint64{0, math.MaxUint64},
+		float32(3.25),
+		[]float32{-1.5, float32(math.Inf(1))},
+		float64(math.Pi),
+		[]float64{math.Inf(-1), math.MaxFloat64},
+		"abc",
+		[]string{"abc", ""},
+		now,
+		[]time.Time{now, {}},
+		id,
+		[]uuid.UUID{id, uuid.Nil},
+		ua.ByteString("\x00\x01\xff"),
+		[]ua.ByteString{"abc", ""},
+		ua.XMLElement("<a>b</a>"),
+		[]ua.XMLElement{"<a/>"},
+		ua.NewNodeIDNumeric(0, 85),
+		[]ua.NodeID{ua.NewNodeIDString(2, "Demo"), ua.NewNodeIDGUID(1, id), ua.NewNodeIDOpaque(3, "\x01\x02"), nil},
+		ua.ParseExpandedNodeID("svr=1;nsu=http://test.org/;s=Demo"),
+		[]ua.ExpandedNodeID{ua.NewExpandedNodeID(ua.NewNodeIDNumeric(2, 7))},
+		ua.BadNodeIDUnknown,
+		[]ua.StatusCode{ua.Good, ua.UncertainLastUsableValue},
+		ua.NewQualifiedName(2, "Demo"),
+		[]ua.QualifiedName{ua.NewQualifiedName(0, "Server")},
+		ua.NewLocalizedText("Hello", "en"),
+		[]ua.LocalizedText{ua.NewLocalizedText("Hallo", "de"), {}},
+		ua.Argument{Name: "Offset", DataType: ua.DataTypeIDDouble, ValueRank: ua.ValueRankScalar, Description: ua.NewLocalizedText("offset", "")},
+		[]ua.ExtensionObject{ua.Argument{Name: "Points", DataType: ua.DataTypeIDInt32, ValueRank: ua.ValueRankOneDimension, ArrayDimensions: []uint32{0}}, nil},
+		ua.NewDataValue(float64(1.5), ua.Good, now, 10, now, 20),
+		[]ua.DataValue{ua.NewDataValue(nil, ua.BadWaitingForInitialData, time.Time{}, 0, now, 0), {}},
+		[]ua.Variant{int32(1), "two", ua.NewLocalizedText("three", ""), []ua.Variant{uint64(4)}, nil},
+		ua.DiagnosticInfo{SymbolicID: &symbolicID, InnerStatusCode: &inner},
+		[]ua.DiagnosticInfo{{}},
+		ua.Matrix{Elements: []int32{1, 2, 3, 4, 5, 6}, Dimensions: []int32{2, 3}},
+	}
+	for _, c := range cases {
+		b, err := ua.MarshalVariantJSON(c)
+		assert.NilError(t, err)
+		out, err := ua.UnmarshalVariantJSON(b)
+		assert.NilError(t, err, string(b))
+		assert.DeepEqual(t, out, c)
+	}
+}
+
+func TestVariantJSONReversible(t *testing.T) {
+	cases := []struct {
+		in   ua.Variant
+		json string
+	}{
+		{nil, `null`},
+		{int32(42), `{"Type":6,"Body":42}`},
+		{int64(42), `{"Type":8,"Body":"42"}`},
+		{math.NaN(), `{"Type":11,"Body":"NaN"}`},
+		{time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC), `{"Type":13,"Body":"2021-06-01T12:00:00Z"}`},
+		{ua.ByteString("abcd"), `{"Type":15,"Body":"YWJjZA=="}`},
+		{ua.NewNodeIDString(2, "Demo"), `{"Type":17,"Body":"ns=2;s=Demo"}`},
+		{ua.NewLocalizedText("Hello", "en"), `{"Type":21,"Body":{"Locale":"en","Text":"Hello"}}`},
+		{[]ua.Variant{true, nil}, `{"Type":24,"Body":[{"Type":1,"Body":true},null]}`},
+		{ua.Matrix{Elements: []uint16{1, 2, 3, 4}, Dimensions: []int32{2, 2}}, `{"Type":5,"Body":[1,2,3,4],"Dimensions":[2,2]}`},
+	}
+	for _, c := range cases {
+		b, err := ua.MarshalVariantJSON(c.in)
+		assert.NilError(t, err)
+		assert.Equal(t, string(b), c.json)
+	}
+
+	// NaN is not equal to itself, so check the decoded value separately.
+	v, err := ua.UnmarshalVariantJSON([]byte(`{"Type":11,"Body":"NaN"}`))
+	assert.NilError(t, err)
+	f, _ := v.(float64)
+	assert.Assert(t, math.IsNaN(f))
+
+	_, err = ua.UnmarshalVariantJSON([]byte(`{"Type":99,"Body":1}`))
+	assert.Equal(t, err, ua.BadDecodingError)
+	_, err = ua.UnmarshalVariantJSON([]byte(`{"Type":6,"Body":"abc"}`))
+	assert.Equal(t, err, ua.BadDecodingError)
+	_, err = ua.MarshalVariantJSON(struct{ A int }{1})
+	assert.Equal(t, err, ua.BadEncodingError)
+}
+
+func TestVariantJSONNonReversible(t *testing.T) {
+	cases := []struct {
+		in   ua.Variant
+		json string
+	}{
+		{int32(42), `42`},
+		{ua.NewLocalizedText("Hello", "en"), `"Hello"`},
+		{ua.BadNodeIDUnknown, `{"Code":2150891520}`},
+		{ua.Matrix{Elements: []int32{1, 2, 3, 4, 5, 6}, Dimensions: []int32{2, 3}}, `[[1,2,3],[4,5,6]]`},
+		{[]ua.Variant{int32(1), "two"}, `[1,"two"]`},
+		{ua.Argument{Name: "Offset"}, `{"Name":"Offset","DataType":null,"ValueRank":0,"ArrayDimensions":null,"Description":""}`},
+	}
+	for _, c := range cases {
+		b, err := ua.MarshalVariantJSON(c.in, ua.WithNonReversibleJSON())
+		assert.NilError(t, err)
+		assert.Equal(t, string(b), c.json)
+	}
+}
+
+func TestJSONVariant(t *testing.T) {
+	type sample struct {
+		Name  string
+		Value ua.JSONVariant
+	}
+	in := sample{Name: "Demo", Value: ua.JSONVariant{Value: []float32{1, 2}}}
+	b, err := json.Marshal(in)
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), `{"Name":"Demo","Value":{"Type":10,"Body":[1,2]}}`)
+	var out sample
+	assert.NilError(t, json.Unmarshal(b, &out))
+	assert.DeepEqual(t, out, in)
+}
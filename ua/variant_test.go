@@ -0,0 +1,147 @@
+// Copyright 2021 Converter Systems LLC. All rights reserved.
+
+package ua_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/awcullen/opcua/ua"
+	"gotest.tools/assert"
+)
+
+func TestAsSlice(t *testing.T) {
+	var v ua.Variant = []float64{1, 2, 3}
+	s, ok := ua.AsFloat64Slice(v)
+	assert.Assert(t, ok)
+	assert.DeepEqual(t, s, []float64{1, 2, 3})
+	// the slice is not copied.
+	assert.Equal(t, &s[0], &v.([]float64)[0])
+
+	_, ok = ua.AsFloat32Slice(v)
+	assert.Assert(t, !ok)
+	_, ok = ua.AsFloat64Slice(float64(1))
+	assert.Assert(t, !ok)
+	_, ok = ua.AsInt32Slice(nil)
+	assert.Assert(t, !ok)
+
+	u, ok := ua.AsUint16Slice([]uint16{7})
+	assert.Assert(t, ok)
+	assert.DeepEqual(t, u, []uint16{7})
+}
+
+func TestNewVariantAs(t *testing.T) {
+	v, err := ua.NewVariantAs(ua.VariantTypeInt16, 42)
+	assert.NilError(t, err)
+	assert.Equal(t, v, ua.Variant(int16(42)))
+
+	v, err = ua.NewVariantAs(ua.VariantTypeUInt64, int8(7))
+	assert.NilError(t, err)
+	assert.Equal(t, v, ua.Variant(uint64(7)))
+
+	v, err = ua.NewVariantAs(ua.VariantTypeFloat, 3)
+	assert.NilError(t, err)
+	assert.Equal(t, v, ua.Variant(float32(3)))
+
+	v, err = ua.NewVariantAs(ua.VariantTypeInt32, []int{1, 2, 3})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, v, ua.Variant([]int32{1, 2, 3}))
+
+	v, err = ua.NewVariantAs(ua.VariantTypeString, "abc")
+	assert.NilError(t, err)
+	assert.Equal(t, v, ua.Variant("abc"))
+
+	v, err = ua.NewVariantAs(ua.VariantTypeByteString, []byte{1, 2})
+	assert.NilError(t, err)
+	assert.Equal(t, v, ua.Variant(ua.ByteString("\x01\x02")))
+
+	_, err = ua.NewVariantAs(ua.VariantTypeInt16, 40000)
+	assert.Equal(t, err, ua.BadOutOfRange)
+	_, err = ua.NewVariantAs(ua.VariantTypeByte, -1)
+	assert.Equal(t, err, ua.BadOutOfRange)
+	_, err = ua.NewVariantAs(ua.VariantTypeInt32, 1.5)
+	assert.Equal(t, err, ua.BadTypeMismatch)
+	_, err = ua.NewVariantAs(ua.VariantTypeBoolean, "true")
+	assert.Equal(t, err, ua.BadTypeMismatch)
+	_, err = ua.NewVariantAs(ua.VariantTypeInt16, []int{1, 40000})
+	assert.Equal(t, err, ua.BadOutOfRange)
+}
+
+func TestVariantTypeOf(t *testing.T) {
+	assert.Equal(t, ua.VariantTypeOf(nil), ua.VariantTypeNull)
+	assert.Equal(t, ua.VariantTypeOf(ua.Null{}), ua.VariantTypeNull)
+	assert.Equal(t, ua.VariantTypeOf(int16(1)), ua.VariantTypeInt16)
+	assert.Equal(t, ua.VariantTypeOf([]float32{1}), ua.VariantTypeFloat)
+	assert.Equal(t, ua.VariantTypeOf("a"), ua.VariantTypeString)
+	assert.Equal(t, ua.VariantTypeOf(ua.ByteString("a")), ua.VariantTypeByteString)
+	assert.Equal(t, ua.VariantTypeOf(ua.ParseNodeID("ns=2;s=Demo")), ua.VariantTypeNodeID)
+	assert.Equal(t, ua.VariantTypeOf([]ua.Variant{int32(1)}), ua.VariantTypeVariant)
+	assert.Equal(t, ua.VariantTypeOf(ua.Range{Low: 0, High: 100}), ua.VariantTypeExtensionObject)
+}
+
+func TestAsScalar(t *testing.T) {
+	i, ok := ua.AsInt64(int16(-7))
+	assert.Assert(t, ok)
+	assert.Equal(t, i, int64(-7))
+	_, ok = ua.AsInt64(uint64(math.MaxUint64))
+	assert.Assert(t, !ok)
+	_, ok = ua.AsInt64(float64(1))
+	assert.Assert(t, !ok)
+
+	u, ok := ua.AsUint64(int32(7))
+	assert.Assert(t, ok)
+	assert.Equal(t, u, uint64(7))
+	_, ok = ua.AsUint64(int32(-7))
+	assert.Assert(t, !ok)
+
+	f, ok := ua.AsFloat64(float32(1.5))
+	assert.Assert(t, ok)
+	assert.Equal(t, f, 1.5)
+	f, ok = ua.AsFloat64(uint32(42))
+	assert.Assert(t, ok)
+	assert.Equal(t, f, 42.0)
+	_, ok = ua.AsFloat64(int64(42))
+	assert.Assert(t, !ok)
+
+	b, ok := ua.AsBool(true)
+	assert.Assert(t, ok && b)
+	_, ok = ua.AsBool(int32(1))
+	assert.Assert(t, !ok)
+
+	s, ok := ua.AsString("a")
+	assert.Assert(t, ok)
+	assert.Equal(t, s, "a")
+	_, ok = ua.AsString(ua.ByteString("a"))
+	assert.Assert(t, !ok)
+
+	now := time.Now()
+	tm, ok := ua.AsTime(now)
+	assert.Assert(t, ok)
+	assert.Equal(t, tm, now)
+	_, ok = ua.AsTime(nil)
+	assert.Assert(t, !ok)
+}
+
+func TestMatrix(t *testing.T) {
+	m, err := ua.NewMatrix([]float64{1, 2, 3, 4, 5, 6}, []int32{2, 3})
+	assert.NilError(t, err)
+	assert.Equal(t, m.Len(), 6)
+	assert.Equal(t, ua.VariantTypeOf(m), ua.VariantTypeDouble)
+
+	i, ok := m.Index(1, 2)
+	assert.Assert(t, ok)
+	assert.Equal(t, i, 5)
+	v, ok := m.At(1, 0)
+	assert.Assert(t, ok)
+	assert.Equal(t, v, interface{}(4.0))
+	_, ok = m.At(2, 0)
+	assert.Assert(t, !ok)
+	_, ok = m.At(1)
+	assert.Assert(t, !ok)
+
+	_, err = ua.NewMatrix([]float64{1, 2, 3}, []int32{2, 2})
+	assert.Equal(t, err, ua.BadTypeMismatch)
+	_, err = ua.NewMatrix(1.0, []int32{1})
+	assert.Equal(t, err, ua.BadTypeMismatch)
+}